@@ -10,8 +10,7 @@ import (
 func main() {
 	rootCmd := cli.NewRootCmd()
 	if err := rootCmd.Execute(); err != nil {
-		// Simply use fmt.Println instead of fmt.Fprintf to avoid potential stderr issues
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(cli.ExitCode(err))
 	}
 }
@@ -0,0 +1,54 @@
+// Package agent implements the passh agent, a long-running process that
+// caches decrypted entries for a short time, so scripts reading many entries
+// don't pay for SSH agent round-trips and passphrase prompts on every call.
+// It listens on a Unix socket only accessible to its user.
+package agent
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SocketEnv overrides the agent socket path
+const SocketEnv = "PASSH_AGENT_SOCK"
+
+// Operations understood by the agent
+const (
+	OpGet    = "get"
+	OpPut    = "put"
+	OpClear  = "clear"
+	OpStatus = "status"
+	OpStop   = "stop"
+)
+
+// Request is sent as a JSON line to the agent, one per connection
+type Request struct {
+	Op   string `json:"op"`
+	Key  string `json:"key,omitempty"`
+	Data []byte `json:"data,omitempty"`
+	// TTL is how long to cache a put entry, in seconds, instead of the
+	// agent's TTL
+	TTL int `json:"ttl,omitempty"`
+}
+
+// Response is the agent's JSON answer to a Request
+type Response struct {
+	Found   bool   `json:"found,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	Entries int    `json:"entries,omitempty"`
+	// TTL is how long entries are cached, in seconds
+	TTL   int    `json:"ttl,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SocketPath returns the agent socket: $PASSH_AGENT_SOCK, or passh-agent.sock
+// in $XDG_RUNTIME_DIR, or in the given fallback directory
+func SocketPath(fallbackDir string) string {
+	if path := os.Getenv(SocketEnv); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "passh-agent.sock")
+	}
+	return filepath.Join(fallbackDir, "agent.sock")
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startAgent runs an agent on a temporary socket
+func startAgent(t *testing.T, ttl time.Duration) (*Server, *Client) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	server, err := NewServer(ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return server, NewClient(path)
+}
+
+func TestAgentCache(t *testing.T) {
+	_, client := startAgent(t, time.Minute)
+
+	if _, found, err := client.Get("entry"); err != nil || found {
+		t.Fatalf("Expected an empty cache, got found=%v err=%v", found, err)
+	}
+	if err := client.Put("entry", []byte("secret")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	data, found, err := client.Get("entry")
+	if err != nil || !found || string(data) != "secret" {
+		t.Fatalf("Expected the cached entry, got %q found=%v err=%v", data, found, err)
+	}
+
+	if entries, ttl, err := client.Status(); err != nil || entries != 1 || ttl != time.Minute {
+		t.Errorf("Unexpected status: %d entries, TTL %s, err %v", entries, ttl, err)
+	}
+
+	if err := client.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if _, found, _ := client.Get("entry"); found {
+		t.Error("Expected the cache to be cleared")
+	}
+}
+
+func TestAgentTTL(t *testing.T) {
+	server, client := startAgent(t, time.Minute)
+	server.ttl = 10 * time.Millisecond
+
+	if err := client.Put("entry", []byte("secret")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, found, _ := client.Get("entry"); found {
+		t.Error("Expected the entry to expire")
+	}
+}
+
+func TestAgentPutFor(t *testing.T) {
+	server, client := startAgent(t, time.Minute)
+	server.ttl = 10 * time.Millisecond
+
+	// Entries put with their own TTL outlive the agent's
+	if err := client.PutFor("entry", []byte("secret"), time.Minute); err != nil {
+		t.Fatalf("PutFor failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, found, _ := client.Get("entry"); !found {
+		t.Error("Expected the entry to be cached for its own TTL")
+	}
+}
+
+func TestAgentSealsEntries(t *testing.T) {
+	server, client := startAgent(t, time.Minute)
+	if err := client.Put("entry", []byte("secret")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	server.mu.Lock()
+	sealed := server.entries["entry"].sealed
+	server.mu.Unlock()
+	if len(sealed) == 0 || string(sealed) == "secret" {
+		t.Errorf("Expected the entry to be sealed, got %q", sealed)
+	}
+}
+
+func TestAgentStop(t *testing.T) {
+	server, client := startAgent(t, time.Minute)
+	path := client.path
+
+	if _, err := Listen(path); err == nil {
+		t.Error("Expected a second agent on the same socket to be refused")
+	}
+	if err := client.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	select {
+	case <-server.done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the agent to stop")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.key.Len() != 0 {
+		t.Error("Expected the session key to be wiped")
+	}
+}
+
+func TestAgentMetrics(t *testing.T) {
+	server, client := startAgent(t, time.Minute)
+	client.Put("entry", []byte("secret"))
+	client.Get("entry")
+	client.Get("other")
+
+	recorder := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, line := range []string{
+		`passh_agent_requests_total{op="get"} 2`,
+		`passh_agent_requests_total{op="put"} 1`,
+		"passh_agent_cache_hits_total 1",
+		"passh_agent_cache_misses_total 1",
+		"passh_agent_cached_entries 1",
+		"passh_agent_ttl_seconds 60",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in the metrics:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "secret") {
+		t.Error("Expected no cached data in the metrics")
+	}
+}
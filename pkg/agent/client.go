@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// Client talks to a running agent
+type Client struct {
+	path string
+}
+
+// NewClient returns a client for the agent listening on path
+func NewClient(path string) *Client {
+	return &Client{path: path}
+}
+
+// Running reports whether an agent answers on path
+func Running(path string) bool {
+	_, _, err := NewClient(path).Status()
+	return err == nil
+}
+
+// Get returns a cached entry, if the agent has it
+func (c *Client) Get(key string) ([]byte, bool, error) {
+	response, err := c.call(Request{Op: OpGet, Key: key})
+	if err != nil {
+		return nil, false, err
+	}
+	return response.Data, response.Found, nil
+}
+
+// Put caches an entry in the agent
+func (c *Client) Put(key string, data []byte) error {
+	_, err := c.call(Request{Op: OpPut, Key: key, Data: data})
+	return err
+}
+
+// PutFor caches an entry in the agent for ttl instead of the agent's TTL
+func (c *Client) PutFor(key string, data []byte, ttl time.Duration) error {
+	_, err := c.call(Request{Op: OpPut, Key: key, Data: data, TTL: int(ttl / time.Second)})
+	return err
+}
+
+// Clear wipes all cached entries
+func (c *Client) Clear() error {
+	_, err := c.call(Request{Op: OpClear})
+	return err
+}
+
+// Status returns the number of cached entries and their TTL
+func (c *Client) Status() (entries int, ttl time.Duration, err error) {
+	response, err := c.call(Request{Op: OpStatus})
+	if err != nil {
+		return 0, 0, err
+	}
+	return response.Entries, time.Duration(response.TTL) * time.Second, nil
+}
+
+// Stop asks the agent to wipe its cache and exit
+func (c *Client) Stop() error {
+	_, err := c.call(Request{Op: OpStop})
+	return err
+}
+
+// call sends one request and reads the response
+func (c *Client) call(request Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("passh agent is not running: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(line)
+	if _, err := conn.Write(line); err != nil {
+		return nil, fmt.Errorf("failed to talk to passh agent: %w", err)
+	}
+	if _, err := conn.Write([]byte("\n")); err != nil {
+		return nil, fmt.Errorf("failed to talk to passh agent: %w", err)
+	}
+
+	var response Response
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to talk to passh agent: %w", err)
+	}
+	if response.Error != "" {
+		return nil, errors.New("passh agent: " + response.Error)
+	}
+	return &response, nil
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// metrics counts the agent's work for its Prometheus endpoint. The fields
+// are guarded by Server.mu.
+type metrics struct {
+	started  time.Time
+	requests map[string]uint64
+	hits     uint64
+	misses   uint64
+	errors   uint64
+}
+
+// count records an answered request
+func (m *metrics) count(request Request, response Response) {
+	op := request.Op
+	switch op {
+	case OpGet, OpPut, OpClear, OpStatus, OpStop:
+	default:
+		op = "unknown"
+	}
+	m.requests[op]++
+	if request.Op == OpGet && response.Error == "" {
+		if response.Found {
+			m.hits++
+		} else {
+			m.misses++
+		}
+	}
+	if response.Error != "" {
+		m.errors++
+	}
+}
+
+// MetricsHandler serves the agent's counters in the Prometheus text format.
+// They tell how the cache is used, never what it holds.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ops := make([]string, 0, len(s.metrics.requests))
+		for op := range s.metrics.requests {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		requests := make([]uint64, len(ops))
+		for i, op := range ops {
+			requests[i] = s.metrics.requests[op]
+		}
+		m, entries, ttl := s.metrics, len(s.entries), s.ttl
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP passh_agent_requests_total Requests answered by the passh agent, by operation.")
+		fmt.Fprintln(w, "# TYPE passh_agent_requests_total counter")
+		for i, op := range ops {
+			fmt.Fprintf(w, "passh_agent_requests_total{op=%q} %d\n", op, requests[i])
+		}
+		writeMetric(w, "passh_agent_cache_hits_total", "counter", "Gets answered from the cache.", m.hits)
+		writeMetric(w, "passh_agent_cache_misses_total", "counter", "Gets of entries that were not cached.", m.misses)
+		writeMetric(w, "passh_agent_errors_total", "counter", "Requests that failed.", m.errors)
+		writeMetric(w, "passh_agent_cached_entries", "gauge", "Entries currently cached.", entries)
+		writeMetric(w, "passh_agent_ttl_seconds", "gauge", "How long entries are cached.", int(ttl/time.Second))
+		writeMetric(w, "passh_agent_start_time_seconds", "gauge", "When the agent started, in seconds since the epoch.", m.started.Unix())
+	})
+}
+
+// writeMetric writes one metric without labels
+func writeMetric(w http.ResponseWriter, name, kind, help string, value any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// maxRequestSize bounds a request line, which holds at most one entry
+const maxRequestSize = 4 << 20
+
+// Server caches decrypted entries for its TTL. Entries are sealed with a
+// session key that only exists in the agent's memory, so a swapped out or
+// dumped cache reveals nothing once the agent exits.
+type Server struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	key     *secure.Buffer
+	entries map[string]cacheEntry
+	metrics metrics
+	done    chan struct{}
+
+	listener net.Listener
+}
+
+// cacheEntry is a sealed entry and when it expires
+type cacheEntry struct {
+	sealed  []byte
+	expires time.Time
+}
+
+// NewServer creates an agent caching entries for ttl
+func NewServer(ttl time.Duration) (*Server, error) {
+	if ttl <= 0 {
+		return nil, errors.New("cache TTL must be positive")
+	}
+	key := secure.New(chacha20poly1305.KeySize)
+	if _, err := rand.Read(key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("failed to generate session key: %w", err)
+	}
+	return &Server{
+		ttl:     ttl,
+		key:     key,
+		entries: make(map[string]cacheEntry),
+		metrics: metrics{started: time.Now(), requests: make(map[string]uint64)},
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Listen creates the agent socket, replacing a stale one left by an agent
+// that didn't exit cleanly. It fails if another agent is already running.
+func Listen(path string) (net.Listener, error) {
+	if Running(path) {
+		return nil, fmt.Errorf("an agent is already running on %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve answers requests until Close is called or a client asks the agent
+// to stop. Expired entries are dropped within a second.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	go s.expire()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+				return err
+			}
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the agent and wipes the cache and session key
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	s.clear()
+	s.key.Destroy()
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// handle answers the request on one connection
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		line, err = readLongLine(reader, line)
+	}
+	if err != nil {
+		logging.Debugf("agent: failed to read request: %v", err)
+		return
+	}
+	defer secure.Wipe(line)
+
+	var request Request
+	if err := json.Unmarshal(line, &request); err != nil {
+		json.NewEncoder(conn).Encode(Response{Error: "invalid request"})
+		return
+	}
+	defer secure.Wipe(request.Data)
+
+	response := s.answer(request)
+	defer secure.Wipe(response.Data)
+	json.NewEncoder(conn).Encode(response)
+
+	if request.Op == OpStop {
+		s.Close()
+	}
+}
+
+// readLongLine finishes reading a request line longer than the reader's
+// buffer, up to maxRequestSize
+func readLongLine(reader *bufio.Reader, start []byte) ([]byte, error) {
+	line := append([]byte(nil), start...)
+	for len(line) < maxRequestSize {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+	secure.Wipe(line)
+	return nil, errors.New("request too large")
+}
+
+// answer handles one request
+func (s *Server) answer(request Request) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response := s.respond(request)
+	s.metrics.count(request, response)
+	return response
+}
+
+// respond works out the answer to a request; the caller holds s.mu
+func (s *Server) respond(request Request) Response {
+	switch request.Op {
+	case OpGet:
+		entry, ok := s.entries[request.Key]
+		if !ok || time.Now().After(entry.expires) {
+			return Response{}
+		}
+		data, err := s.open(request.Key, entry.sealed)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		return Response{Found: true, Data: data}
+	case OpPut:
+		if request.Key == "" {
+			return Response{Error: "missing key"}
+		}
+		sealed, err := s.seal(request.Key, request.Data)
+		if err != nil {
+			return Response{Error: err.Error()}
+		}
+		ttl := s.ttl
+		if request.TTL > 0 {
+			ttl = time.Duration(request.TTL) * time.Second
+		}
+		s.entries[request.Key] = cacheEntry{sealed: sealed, expires: time.Now().Add(ttl)}
+		return Response{}
+	case OpClear:
+		s.clear()
+		return Response{}
+	case OpStatus, OpStop:
+		return Response{Entries: len(s.entries), TTL: int(s.ttl / time.Second)}
+	}
+	return Response{Error: fmt.Sprintf("unknown operation '%s'", request.Op)}
+}
+
+// seal encrypts an entry with the session key, bound to its cache key
+func (s *Server) seal(key string, data []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(s.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, []byte(key)), nil
+}
+
+// open decrypts an entry sealed by seal
+func (s *Server) open(key string, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(s.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(key))
+}
+
+// clear forgets all entries; the caller holds s.mu
+func (s *Server) clear() {
+	for key := range s.entries {
+		delete(s.entries, key)
+	}
+}
+
+// expire drops expired entries every second
+func (s *Server) expire() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, entry := range s.entries {
+				if now.After(entry.expires) {
+					delete(s.entries, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package autotype types text into other applications' windows using the
+// platform's input automation tools.
+package autotype
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSequence types the username, a tab, the password and Enter
+const DefaultSequence = "{username}{tab}{password}{enter}"
+
+// PasswordSequence is used for entries without a username
+const PasswordSequence = "{password}{enter}"
+
+// Special keys that can appear in a sequence
+const (
+	KeyTab   = "tab"
+	KeyEnter = "enter"
+	KeySpace = "space"
+)
+
+// Action is a single step of an autotype sequence: typing text, pressing a
+// special key, or pausing
+type Action struct {
+	Text  string
+	Key   string
+	Delay time.Duration
+}
+
+// Parse expands a sequence template such as "{username}{tab}{password}{enter}"
+// into actions. Placeholders name entry fields, the special keys {tab},
+// {enter} and {space}, or a pause as {delay} or {delay 500ms}. Literal
+// braces are written as {{ and }}.
+func Parse(sequence string, fields map[string][]byte) ([]Action, error) {
+	var actions []Action
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			actions = append(actions, Action{Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(sequence); i++ {
+		c := sequence[i]
+		switch {
+		case c == '{' && strings.HasPrefix(sequence[i:], "{{"):
+			text.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(sequence[i:], "}}"):
+			text.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(sequence[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder in autotype sequence %q", sequence)
+			}
+			placeholder := strings.TrimSpace(sequence[i+1 : i+end])
+			i += end
+
+			action, isText, err := expand(placeholder, fields)
+			if err != nil {
+				return nil, err
+			}
+			if isText {
+				text.WriteString(action.Text)
+				continue
+			}
+			flush()
+			actions = append(actions, action)
+		default:
+			text.WriteByte(c)
+		}
+	}
+	flush()
+
+	return actions, nil
+}
+
+// expand resolves a single placeholder. Field values are returned as text so
+// adjacent text can be typed in one go.
+func expand(placeholder string, fields map[string][]byte) (Action, bool, error) {
+	name, arg, _ := strings.Cut(placeholder, " ")
+	name = strings.ToLower(name)
+
+	switch name {
+	case KeyTab, KeyEnter, KeySpace:
+		return Action{Key: name}, false, nil
+	case "delay":
+		delay := 500 * time.Millisecond
+		if arg != "" {
+			var err error
+			if delay, err = time.ParseDuration(strings.TrimSpace(arg)); err != nil {
+				// Plain numbers are milliseconds
+				ms, numErr := strconv.Atoi(strings.TrimSpace(arg))
+				if numErr != nil {
+					return Action{}, false, fmt.Errorf("invalid autotype delay %q", arg)
+				}
+				delay = time.Duration(ms) * time.Millisecond
+			}
+		}
+		return Action{Delay: delay}, false, nil
+	}
+
+	value, ok := fields[name]
+	if !ok {
+		return Action{}, false, fmt.Errorf("entry has no field %q for the autotype sequence", name)
+	}
+	return Action{Text: string(value)}, true, nil
+}
+
+// Run performs the actions with the given typer
+func Run(typer Typer, actions []Action) error {
+	for _, action := range actions {
+		var err error
+		switch {
+		case action.Delay > 0:
+			time.Sleep(action.Delay)
+		case action.Key != "":
+			err = typer.Key(action.Key)
+		default:
+			err = typer.Type(action.Text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
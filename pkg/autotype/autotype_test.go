@@ -0,0 +1,78 @@
+package autotype
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingTyper records keystrokes instead of sending them
+type recordingTyper struct {
+	typed []string
+}
+
+func (t *recordingTyper) Name() string { return "recording" }
+
+func (t *recordingTyper) Type(text string) error {
+	t.typed = append(t.typed, text)
+	return nil
+}
+
+func (t *recordingTyper) Key(key string) error {
+	t.typed = append(t.typed, "<"+key+">")
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	fields := map[string][]byte{"username": []byte("alice"), "password": []byte("p{a}ss"), "pin": []byte("1234")}
+
+	actions, err := Parse("{username}{tab}{password}{delay 1s}{pin} {{x}}{enter}", fields)
+	if err != nil {
+		t.Fatalf("Failed to parse sequence: %v", err)
+	}
+
+	expected := []Action{
+		{Text: "alice"},
+		{Key: KeyTab},
+		{Text: "p{a}ss"},
+		{Delay: time.Second},
+		{Text: "1234 {x}"},
+		{Key: KeyEnter},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, actions)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	fields := map[string][]byte{"password": []byte("secret")}
+	for _, sequence := range []string{"{username}", "{password", "{delay soon}"} {
+		if _, err := Parse(sequence, fields); err == nil {
+			t.Errorf("Expected %q to be rejected", sequence)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	actions, err := Parse(DefaultSequence, map[string][]byte{"username": []byte("alice"), "password": []byte("secret")})
+	if err != nil {
+		t.Fatalf("Failed to parse sequence: %v", err)
+	}
+
+	typer := &recordingTyper{}
+	if err := Run(typer, actions); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !reflect.DeepEqual(typer.typed, []string{"alice", "<tab>", "secret", "<enter>"}) {
+		t.Fatalf("Unexpected keystrokes: %v", typer.typed)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	if script := appleScript(`say "hi"\`, ""); script != "tell application \"System Events\" to keystroke \"say \\\"hi\\\"\\\\\"\n" {
+		t.Errorf("Unexpected AppleScript: %q", script)
+	}
+	if script := powerShellScript("a+b's", ""); script != "Add-Type -AssemblyName System.Windows.Forms\n[System.Windows.Forms.SendKeys]::SendWait('a{+}b''s')\n" {
+		t.Errorf("Unexpected PowerShell script: %q", script)
+	}
+}
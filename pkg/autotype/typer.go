@@ -0,0 +1,154 @@
+package autotype
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Typer sends keystrokes to the focused window
+type Typer interface {
+	// Name identifies the automation tool
+	Name() string
+	// Type types literal text
+	Type(text string) error
+	// Key presses one of the special keys KeyTab, KeyEnter or KeySpace
+	Key(key string) error
+}
+
+// ErrNoTyper is returned when no automation tool is available
+var ErrNoTyper = errors.New("no supported autotype tool found (install xdotool on X11 or wtype on Wayland)")
+
+// Detect picks the automation tool for the current platform and session.
+// Text is always passed on stdin so secrets never show up in process lists.
+func Detect() (Typer, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return &scriptTyper{name: "osascript", command: []string{"osascript", "-"}, script: appleScript}, nil
+	case "windows":
+		return &scriptTyper{name: "powershell", command: []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "-"}, script: powerShellScript}, nil
+	}
+
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wtype"); err == nil {
+			return &wtypeTyper{}, nil
+		}
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if _, err := exec.LookPath("xdotool"); err == nil {
+			return &xdotoolTyper{}, nil
+		}
+	}
+	return nil, ErrNoTyper
+}
+
+// run executes a command with input on stdin
+func run(input string, command ...string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// xdotoolTyper types on X11
+type xdotoolTyper struct{}
+
+func (t *xdotoolTyper) Name() string { return "xdotool" }
+
+func (t *xdotoolTyper) Type(text string) error {
+	return run(text, "xdotool", "type", "--clearmodifiers", "--file", "-")
+}
+
+func (t *xdotoolTyper) Key(key string) error {
+	names := map[string]string{KeyTab: "Tab", KeyEnter: "Return", KeySpace: "space"}
+	return run("", "xdotool", "key", "--clearmodifiers", names[key])
+}
+
+// wtypeTyper types on Wayland compositors supporting the virtual keyboard protocol
+type wtypeTyper struct{}
+
+func (t *wtypeTyper) Name() string { return "wtype" }
+
+func (t *wtypeTyper) Type(text string) error {
+	return run(text, "wtype", "-")
+}
+
+func (t *wtypeTyper) Key(key string) error {
+	names := map[string]string{KeyTab: "Tab", KeyEnter: "Return", KeySpace: "space"}
+	return run("", "wtype", "-k", names[key])
+}
+
+// scriptTyper generates a script for an interpreter reading from stdin
+type scriptTyper struct {
+	name    string
+	command []string
+	script  func(text, key string) string
+}
+
+func (t *scriptTyper) Name() string { return t.name }
+
+func (t *scriptTyper) Type(text string) error {
+	return run(t.script(text, ""), t.command...)
+}
+
+func (t *scriptTyper) Key(key string) error {
+	return run(t.script("", key), t.command...)
+}
+
+// appleScript types through System Events, which posts CGEvents
+func appleScript(text, key string) string {
+	if key != "" {
+		codes := map[string]int{KeyTab: 48, KeyEnter: 36, KeySpace: 49}
+		return fmt.Sprintf("tell application \"System Events\" to key code %d\n", codes[key])
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+	return fmt.Sprintf("tell application \"System Events\" to keystroke \"%s\"\n", escaped)
+}
+
+// powerShellScript types through SendKeys, which uses SendInput
+func powerShellScript(text, key string) string {
+	keys := map[string]string{KeyTab: "{TAB}", KeyEnter: "{ENTER}", KeySpace: " "}[key]
+	if key == "" {
+		// Characters with a special meaning to SendKeys must be wrapped in braces
+		var b strings.Builder
+		for _, r := range text {
+			if strings.ContainsRune("+^%~(){}[]", r) {
+				b.WriteString("{" + string(r) + "}")
+			} else {
+				b.WriteRune(r)
+			}
+		}
+		keys = b.String()
+	}
+	quoted := strings.ReplaceAll(keys, "'", "''")
+	return "Add-Type -AssemblyName System.Windows.Forms\n" +
+		"[System.Windows.Forms.SendKeys]::SendWait('" + quoted + "')\n"
+}
+
+// Focuser is implemented by typers that can restore focus to a window
+type Focuser interface {
+	// ActiveWindow identifies the currently focused window
+	ActiveWindow() (string, error)
+	// Focus activates a window returned by ActiveWindow
+	Focus(window string) error
+}
+
+func (t *xdotoolTyper) ActiveWindow() (string, error) {
+	output, err := exec.Command("xdotool", "getactivewindow").Output()
+	if err != nil {
+		return "", fmt.Errorf("xdotool failed to get the active window: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (t *xdotoolTyper) Focus(window string) error {
+	return run("", "xdotool", "windowactivate", "--sync", window)
+}
@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/agent"
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultAgentTTL is how long the agent caches decrypted entries
+const defaultAgentTTL = 2 * time.Minute
+
+// cachedAnnotation marks commands that may read entries from the passh agent
+// instead of decrypting them, so their keys are only loaded on a cache miss
+const cachedAnnotation = "passh-cached"
+
+func newAgentCmd() *cobra.Command {
+	var ttl, metrics string
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Cache decrypted entries for repeated gets",
+		Long: "Run the passh agent in the foreground. While it runs, 'passh get' keeps decrypted " +
+			"entries in the agent for a short time (2 minutes by default, or agent.ttl), so scripts " +
+			"reading the same entries many times don't wait for ssh-agent or ask for passphrases again.\n\n" +
+			"Entries are held encrypted with a key that only exists in the agent's memory. The agent " +
+			"listens on $PASSH_AGENT_SOCK, $XDG_RUNTIME_DIR/passh-agent.sock or ~/.config/passh/agent.sock.\n\n" +
+			"With --metrics (or agent.metrics) the agent also serves Prometheus metrics on " +
+			"http://ADDR/metrics: requests by operation, cache hits and misses and the number of " +
+			"cached entries, never names or secrets.",
+		Example: "  passh agent --ttl 10m &\n" +
+			"  passh agent --metrics localhost:9420",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			duration, err := agentTTL(cmd, ttl)
+			if err != nil {
+				return err
+			}
+			path, err := agentSocket()
+			if err != nil {
+				return err
+			}
+
+			server, err := agent.NewServer(duration)
+			if err != nil {
+				return err
+			}
+			listener, err := agent.Listen(path)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(path)
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-signals
+				server.Close()
+			}()
+
+			if metrics == "" {
+				cfg, err := loadConfig(cmd)
+				if err != nil {
+					return err
+				}
+				metrics = cfg.Get("agent.metrics")
+			}
+			if metrics != "" {
+				metricsListener, err := net.Listen("tcp", metrics)
+				if err != nil {
+					server.Close()
+					return fmt.Errorf("failed to serve metrics: %w", err)
+				}
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", server.MetricsHandler())
+				metricsServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+				defer metricsServer.Close()
+				go metricsServer.Serve(metricsListener)
+				logging.Infof("Serving metrics on http://%s/metrics", metricsListener.Addr())
+			}
+
+			logging.Infof("passh agent listening on %s, caching entries for %s", path, duration)
+			return server.Serve(listener)
+		},
+	}
+
+	cmd.Flags().StringVar(&ttl, "ttl", "", "How long to cache entries (default: agent.ttl setting, or 2m)")
+	cmd.Flags().StringVar(&metrics, "metrics", "", "Serve Prometheus metrics on this address, such as localhost:9420 (default: agent.metrics setting)")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "status",
+			Short:   "Show whether the agent is running",
+			Example: "  passh agent status",
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, err := agentClient()
+				if err != nil {
+					return err
+				}
+				entries, ttl, err := client.Status()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "passh agent is running with %d cached entries (TTL %s)\n", entries, ttl)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "clear",
+			Short:   "Forget all cached entries",
+			Example: "  passh agent clear",
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, err := agentClient()
+				if err != nil {
+					return err
+				}
+				if err := client.Clear(); err != nil {
+					return err
+				}
+				logging.Infof("Cleared the agent cache")
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "stop",
+			Short:   "Stop the agent",
+			Example: "  passh agent stop",
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, err := agentClient()
+				if err != nil {
+					return err
+				}
+				if err := client.Stop(); err != nil {
+					return err
+				}
+				logging.Infof("Stopped the passh agent")
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// isAgentCmd reports whether cmd is the agent command or one of its subcommands
+func isAgentCmd(cmd *cobra.Command) bool {
+	return cmd.Name() == "agent" || cmd.HasParent() && cmd.Parent().Name() == "agent"
+}
+
+// agentTTL returns the cache TTL from --ttl or the agent.ttl setting
+func agentTTL(cmd *cobra.Command, flag string) (time.Duration, error) {
+	value := flag
+	if value == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return 0, err
+		}
+		value = cfg.Get("agent.ttl")
+	}
+	if value == "" {
+		return defaultAgentTTL, nil
+	}
+	ttl, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid agent TTL: %w", err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("agent TTL must be positive")
+	}
+	return ttl, nil
+}
+
+// agentSocket returns the path of the agent socket
+func agentSocket() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return agent.SocketPath(dir), nil
+}
+
+// agentClient returns a client for the agent socket
+func agentClient() (*agent.Client, error) {
+	path, err := agentSocket()
+	if err != nil {
+		return nil, err
+	}
+	return agent.NewClient(path), nil
+}
+
+// runningAgent returns a client for the passh agent if it is running
+func runningAgent() *agent.Client {
+	path, err := agentSocket()
+	if err != nil || !agent.Running(path) {
+		return nil
+	}
+	logging.Debugf("using the passh agent on %s", path)
+	return agent.NewClient(path)
+}
+
+// deferredEncryptor sets up the real encryptor on first use, so commands
+// served from the agent's cache don't load keys or ask for passphrases
+type deferredEncryptor struct {
+	cmd   *cobra.Command
+	setup func() error
+
+	encryptor crypto.Encryptor
+	err       error
+}
+
+// resolve runs the setup once and returns the real encryptor
+func (d *deferredEncryptor) resolve() (crypto.Encryptor, error) {
+	if d.encryptor == nil && d.err == nil {
+		if d.err = d.setup(); d.err == nil {
+			d.encryptor = cmdApp(d.cmd).encryptor
+		}
+	}
+	return d.encryptor, d.err
+}
+
+// resolved reports whether the real encryptor has been set up
+func (d *deferredEncryptor) resolved() bool {
+	return d.encryptor != nil
+}
+
+func (d *deferredEncryptor) Encrypt(data []byte) (string, error) {
+	encryptor, err := d.resolve()
+	if err != nil {
+		return "", err
+	}
+	return encryptor.Encrypt(data)
+}
+
+func (d *deferredEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	encryptor, err := d.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return encryptor.Decrypt(encryptedData)
+}
+
+func (d *deferredEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	encryptor, err := d.resolve()
+	if err != nil {
+		return err
+	}
+	return encryptor.EncryptStream(r, w)
+}
+
+func (d *deferredEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	encryptor, err := d.resolve()
+	if err != nil {
+		return err
+	}
+	return encryptor.DecryptStream(r, w)
+}
+
+// deferredRecipientEncryptor is a deferredEncryptor for backends that
+// encrypt to explicit recipients, so the store still applies recipients
+// files, the access policy and added recipients to what it writes
+type deferredRecipientEncryptor struct {
+	*deferredEncryptor
+}
+
+// newDeferredEncryptor returns an encryptor that runs setup on first use.
+// With recipients, setup must set up a crypto.RecipientEncryptor.
+func newDeferredEncryptor(cmd *cobra.Command, setup func() error, recipients bool) crypto.Encryptor {
+	deferred := &deferredEncryptor{cmd: cmd, setup: setup}
+	if recipients {
+		return deferredRecipientEncryptor{deferred}
+	}
+	return deferred
+}
+
+// asDeferred returns the deferredEncryptor behind an encryptor, if any
+func asDeferred(encryptor crypto.Encryptor) (*deferredEncryptor, bool) {
+	switch deferred := encryptor.(type) {
+	case *deferredEncryptor:
+		return deferred, true
+	case deferredRecipientEncryptor:
+		return deferred.deferredEncryptor, true
+	}
+	return nil, false
+}
+
+// resolveRecipients runs the setup and returns the real encryptor
+func (d deferredRecipientEncryptor) resolveRecipients() (crypto.RecipientEncryptor, error) {
+	encryptor, err := d.resolve()
+	if err != nil {
+		return nil, err
+	}
+	recipientEncryptor, ok := encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return nil, errors.New("the encryptor does not support recipients")
+	}
+	return recipientEncryptor, nil
+}
+
+func (d deferredRecipientEncryptor) PublicKeys() []ssh.PublicKey {
+	encryptor, err := d.resolveRecipients()
+	if err != nil {
+		return nil
+	}
+	return encryptor.PublicKeys()
+}
+
+func (d deferredRecipientEncryptor) EncryptTo(data []byte, recipients []ssh.PublicKey) (string, error) {
+	encryptor, err := d.resolveRecipients()
+	if err != nil {
+		return "", err
+	}
+	return encryptor.EncryptTo(data, recipients)
+}
+
+func (d deferredRecipientEncryptor) Recipients(encryptedData string) ([]ssh.PublicKey, error) {
+	encryptor, err := d.resolveRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return encryptor.Recipients(encryptedData)
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAgentTTL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if ttl, err := agentTTL(&cobra.Command{}, ""); err != nil || ttl != defaultAgentTTL {
+		t.Errorf("Expected the default TTL, got %s (%v)", ttl, err)
+	}
+	if ttl, err := agentTTL(&cobra.Command{}, "30s"); err != nil || ttl != 30*time.Second {
+		t.Errorf("Expected 30s, got %s (%v)", ttl, err)
+	}
+	if _, err := agentTTL(&cobra.Command{}, "0"); err == nil {
+		t.Error("Expected a zero TTL to be rejected")
+	}
+}
+
+func TestDeferredEncryptor(t *testing.T) {
+	encryptor, err := crypto.NewPassphraseEncryptor([]byte("passphrase"), crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	setups := 0
+	deferred := &deferredEncryptor{cmd: cmd, setup: func() error {
+		setups++
+		setEncryptor(cmd, encryptor)
+		return nil
+	}}
+	if deferred.resolved() {
+		t.Fatal("Expected nothing to be set up before first use")
+	}
+
+	encrypted, err := deferred.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if decrypted, err := deferred.Decrypt(encrypted); err != nil || string(decrypted) != "secret" {
+		t.Fatalf("Expected 'secret', got %q (%v)", decrypted, err)
+	}
+	if setups != 1 || !deferred.resolved() {
+		t.Errorf("Expected one setup, got %d", setups)
+	}
+}
+
+func TestListingIndexWithoutKeys(t *testing.T) {
+	backend := storage.NewMemoryBackend()
+	if err := backend.Put("web/mail", []byte("encrypted")); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	deferred := &deferredEncryptor{cmd: cmd, setup: func() error { return errors.New("no keys") }}
+	setEncryptor(cmd, deferred)
+
+	index, err := listingIndex(cmd, storage.NewStoreWithBackend(backend, deferred))
+	if err != nil {
+		t.Fatalf("Expected the names to be listed without keys, got %v", err)
+	}
+	if names := index.Names(); len(names) != 1 || names[0] != "web/mail" {
+		t.Errorf("Expected [web/mail], got %v", names)
+	}
+}
+
+// testSigner returns a new ed25519 key
+func testSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// runWithDeferredKeys runs passh with keys that are only set up once they
+// are used, as for commands that may get by without them
+func runWithDeferredKeys(encryptor crypto.Encryptor, cfg *config.Config, args ...string) error {
+	a := &app{config: cfg, out: io.Discard}
+	ctx := withApp(context.Background(), a)
+	holder := &cobra.Command{}
+	holder.SetContext(ctx)
+	a.encryptor = newDeferredEncryptor(holder, func() error {
+		setEncryptor(holder, encryptor)
+		return nil
+	}, true)
+
+	rootCmd := NewRootCmd()
+	rootCmd.SetArgs(args)
+	return rootCmd.ExecuteContext(ctx)
+}
+
+func TestGenerateWithDeferredKeys(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	me, bob, eve := testSigner(t), testSigner(t), testSigner(t)
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	encryptor.AddPublicKey(me.PublicKey())
+	encryptor.AddSigner(me)
+
+	storeDir := t.TempDir()
+	if err := os.Chmod(storeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(storeDir, "team"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	recipients := string(ssh.MarshalAuthorizedKey(me.PublicKey())) + string(ssh.MarshalAuthorizedKey(bob.PublicKey()))
+	if err := os.WriteFile(filepath.Join(storeDir, "team", storage.RecipientsFile), []byte(recipients), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy := "/ " + ssh.FingerprintSHA256(me.PublicKey()) + " " + ssh.FingerprintSHA256(bob.PublicKey()) + "\n"
+	if err := os.WriteFile(filepath.Join(storeDir, storage.PolicyFile), []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// generate loads keys lazily, as they aren't needed with --no-save
+	generate := func(name string) error {
+		return runWithDeferredKeys(encryptor, nil, "--batch", "--store", storeDir, "generate", name)
+	}
+
+	if err := generate("team/b"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	store, err := storage.NewStore(storeDir, encryptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := store.ListRecipients("team")
+	if err != nil {
+		t.Fatalf("Failed to list recipients: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Stale || len(listed[0].Keys) != 2 {
+		t.Errorf("Expected team/b to be encrypted to both recipients, got %+v", listed)
+	}
+
+	// The policy applies too
+	recipients += string(ssh.MarshalAuthorizedKey(eve.PublicKey()))
+	if err := os.WriteFile(filepath.Join(storeDir, "team", storage.RecipientsFile), []byte(recipients), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := generate("team/c"); err == nil {
+		t.Error("Expected generate to refuse a recipient outside the policy")
+	}
+}
+
+func TestSigningWithDeferredKeys(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	me := testSigner(t)
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	encryptor.AddPublicKey(me.PublicKey())
+	encryptor.AddSigner(me)
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	cfg.Set("sign.entries", "true")
+	storeDir := t.TempDir()
+	if err := os.Chmod(storeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// generate writes, so it signs even though its keys are deferred
+	if err := runWithDeferredKeys(encryptor, cfg, "--batch", "--store", storeDir, "generate", "web/mail"); err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	store, err := storage.NewStore(storeDir, encryptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.VerifySignature("web/mail", []ssh.PublicKey{me.PublicKey()}); err != nil {
+		t.Errorf("Expected the generated entry to be signed, got %v", err)
+	}
+
+	// list only reads, so it needn't load keys to sign
+	if err := runWithDeferredKeys(encryptor, cfg, "--batch", "--store", storeDir, "list"); err != nil {
+		t.Errorf("list failed: %v", err)
+	}
+	if readsOnly(newGenerateCmd()) || !readsOnly(newListCmd()) || !readsOnly(newGetCmd()) {
+		t.Error("Expected only list and get to read only")
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newAliasCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias",
+		Short: "Keep entries reachable under other names",
+		Long: "Aliases let an entry be read under another name, for example its old name after a " +
+			"service was renamed. 'passh get' and other commands reading an alias read the entry it " +
+			"refers to, and writing to an alias writes to that entry. Delete an alias with " +
+			"'passh delete ALIAS'; deleting the entry leaves its aliases dangling.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "add ALIAS ENTRY",
+		Short:             "Make ALIAS refer to ENTRY",
+		Example:           "  passh alias add web/oldname web/newname",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := store.AddAlias(args[0], args[1]); err != nil {
+				return err
+			}
+			logging.Infof("'%s' now refers to '%s'", args[0], args[1])
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Short:   "List aliases and the entries they refer to",
+		Example: "  passh alias list",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			index, err := store.Index()
+			if err != nil {
+				return err
+			}
+			printAliases(cmd.OutOrStdout(), index)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// printAliases prints each alias with the entry it refers to
+func printAliases(out io.Writer, index *storage.Index) {
+	aliases := index.Aliases()
+	for _, name := range sortedKeys(aliases) {
+		fmt.Fprintf(out, "%s -> %s\n", name, aliases[name])
+	}
+}
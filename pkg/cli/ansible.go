@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+)
+
+// lookupRequest is one line read by passh ansible-lookup
+type lookupRequest struct {
+	Name  string `json:"name"`
+	Field string `json:"field,omitempty"`
+	Full  bool   `json:"full,omitempty"`
+}
+
+// lookupReply answers a lookupRequest on one line, with either a value or an
+// error and the exit code passh would have used for it
+type lookupReply struct {
+	Value string `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  int    `json:"code,omitempty"`
+}
+
+func newAnsibleLookupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ansible-lookup",
+		Short: "Answer lookups from the Ansible lookup plugin",
+		Long: "Serve entry lookups for an Ansible lookup plugin, or any other program. Each line of " +
+			"standard input is a JSON request, answered by one JSON line on standard output in the " +
+			"same order:\n\n" +
+			"  {\"name\": \"db/prod\"}                       -> {\"value\": \"hunter2\"}\n" +
+			"  {\"name\": \"db/prod\", \"field\": \"username\"}  -> {\"value\": \"alice\"}\n" +
+			"  {\"name\": \"db/prod\", \"full\": true}         -> {\"value\": \"hunter2\\nusername: alice\"}\n" +
+			"  {\"name\": \"missing\"}                       -> {\"error\": \"entry not found: missing\", \"code\": 2}\n\n" +
+			"Errors use the exit codes of other commands. Each entry is decrypted once per run, and " +
+			"while 'passh agent' runs entries are cached across runs, for example for a whole play.",
+		Example:     "  echo '{\"name\": \"db/prod\", \"field\": \"username\"}' | passh ansible-lookup",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{cachedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			return serveLookups(cmd.InOrStdin(), cmd.OutOrStdout(), func(name string) ([]byte, error) {
+				content, err := store.Get(name)
+				if err == nil {
+					recordAccess(cmd, name)
+				}
+				return content, err
+			})
+		},
+	}
+
+	return cmd
+}
+
+// serveLookups answers lookup requests until the end of input, decrypting
+// each entry at most once
+func serveLookups(r io.Reader, w io.Writer, get func(name string) ([]byte, error)) error {
+	entries := make(map[string][]byte)
+	defer func() {
+		for _, content := range entries {
+			secure.Wipe(content)
+		}
+	}()
+
+	scanner := bufio.NewScanner(r)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var reply lookupReply
+		var request lookupRequest
+		if err := json.Unmarshal([]byte(line), &request); err != nil || request.Name == "" {
+			reply = lookupReply{Error: fmt.Sprintf("invalid lookup request: %s", line), Code: ExitError}
+		} else {
+			reply = lookup(request, entries, get)
+		}
+		if err := encoder.Encode(reply); err != nil {
+			return fmt.Errorf("failed to write lookup reply: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read lookup requests: %w", err)
+	}
+	return nil
+}
+
+// lookup answers one request, keeping decrypted entries in entries
+func lookup(request lookupRequest, entries map[string][]byte, get func(name string) ([]byte, error)) lookupReply {
+	content, ok := entries[request.Name]
+	if !ok {
+		var err error
+		content, err = get(request.Name)
+		if err != nil {
+			return lookupReply{Error: err.Error(), Code: ExitCode(err)}
+		}
+		entries[request.Name] = content
+	}
+
+	switch {
+	case request.Full:
+		return lookupReply{Value: strings.TrimRight(string(content), "\n")}
+	case request.Field != "":
+		value, ok := parseEntryFields(content)[strings.ToLower(request.Field)]
+		if !ok {
+			return lookupReply{Error: fmt.Sprintf("entry '%s' has no field '%s'", request.Name, request.Field), Code: ExitError}
+		}
+		return lookupReply{Value: string(value)}
+	default:
+		return lookupReply{Value: string(firstLine(content))}
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestServeLookups(t *testing.T) {
+	gets := 0
+	get := func(name string) ([]byte, error) {
+		gets++
+		if name != "db/prod" {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, name)
+		}
+		return []byte("hunter2\nuser: alice\n"), nil
+	}
+
+	input := strings.Join([]string{
+		`{"name": "db/prod"}`,
+		`{"name": "db/prod", "field": "username"}`,
+		``,
+		`{"name": "db/prod", "full": true}`,
+		`{"name": "db/prod", "field": "port"}`,
+		`{"name": "missing"}`,
+		`not json`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := serveLookups(strings.NewReader(input), &out, get); err != nil {
+		t.Fatalf("serveLookups failed: %v", err)
+	}
+
+	expected := `{"value":"hunter2"}
+{"value":"alice"}
+{"value":"hunter2\nuser: alice"}
+{"error":"entry 'db/prod' has no field 'port'","code":1}
+{"error":"entry not found: missing","code":2}
+{"error":"invalid lookup request: not json","code":1}
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if gets != 2 {
+		t.Errorf("Expected db/prod to be decrypted once, got %d reads", gets)
+	}
+}
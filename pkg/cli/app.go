@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// app holds what the root command sets up for the command being run.
+// Tests can give a command one with fakes before running it: keys aren't
+// set up when it already has an encryptor, and getStore returns its store.
+type app struct {
+	// encryptor encrypts entries. It is a *deferredEncryptor until keys are
+	// loaded for commands that may not need them.
+	encryptor crypto.Encryptor
+	// cache serves entries from the passh agent, if it is running
+	cache storage.Cache
+	// config is loaded on first use
+	config *config.Config
+	// in, out and errOut replace the command's input, output and error
+	// streams, which are standard input, output and error by default.
+	// Commands read and print through cmd.InOrStdin, cmd.OutOrStdout and
+	// cmd.ErrOrStderr.
+	in     io.Reader
+	out    io.Writer
+	errOut io.Writer
+	// prompter asks the user for input, from the command's streams if unset
+	prompter prompter
+	// store is used instead of opening the store from --store. Commands
+	// close it like any other.
+	store *storage.Store
+}
+
+// appKey is the context key of the app
+type appKey struct{}
+
+// cmdApp returns the app of a command, giving it an empty one if it
+// has none yet
+func cmdApp(cmd *cobra.Command) *app {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if a, ok := ctx.Value(appKey{}).(*app); ok {
+		return a
+	}
+	a := &app{}
+	cmd.SetContext(context.WithValue(ctx, appKey{}, a))
+	return a
+}
+
+// setStreams gives a command the streams of its app, if it has any
+func setStreams(cmd *cobra.Command) {
+	a := cmdApp(cmd)
+	if a.in != nil {
+		cmd.SetIn(a.in)
+	}
+	if a.out != nil {
+		cmd.SetOut(a.out)
+	}
+	if a.errOut != nil {
+		cmd.SetErr(a.errOut)
+	}
+}
+
+// withApp returns ctx with an app, for running commands with fakes
+func withApp(ctx context.Context, a *app) context.Context {
+	return context.WithValue(ctx, appKey{}, a)
+}
+
+// setEncryptor sets the encryptor of a command
+func setEncryptor(cmd *cobra.Command, encryptor crypto.Encryptor) {
+	cmdApp(cmd).encryptor = encryptor
+}
+
+// cmdEncryptor returns the encryptor of a command, which the root command
+// sets up before commands that use keys run
+func cmdEncryptor(cmd *cobra.Command) (crypto.Encryptor, error) {
+	encryptor := cmdApp(cmd).encryptor
+	if encryptor == nil {
+		return nil, errors.New("no keys are set up for this command")
+	}
+	return encryptor, nil
+}
+
+// resolvedEncryptor returns the encryptor of a command, loading its keys
+// if they were deferred
+func resolvedEncryptor(cmd *cobra.Command) (crypto.Encryptor, error) {
+	encryptor, err := cmdEncryptor(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if deferred, ok := asDeferred(encryptor); ok {
+		return deferred.resolve()
+	}
+	return encryptor, nil
+}
+
+// loadConfig returns the configuration of a command, loading it once
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	a := cmdApp(cmd)
+	if a.config == nil {
+		cfg, err := config.Load()
+		if err != nil {
+			return nil, err
+		}
+		a.config = cfg
+	}
+	return a.config, nil
+}
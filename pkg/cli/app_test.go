@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestCommandWithFakeApp(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	encryptor, err := crypto.NewPassphraseEncryptor([]byte("passphrase"), crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewStoreWithBackend(storage.NewMemoryBackend(), encryptor)
+	if err := store.Add("web/mail", []byte("hunter2\nuser: alice")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	rootCmd := NewRootCmd()
+	rootCmd.SetArgs([]string{"--batch", "--color", "never", "get", "web/mail"})
+	var output bytes.Buffer
+	ctx := withApp(context.Background(), &app{encryptor: encryptor, store: store, out: &output})
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if !strings.Contains(output.String(), "hunter2") {
+		t.Errorf("Expected the password from the fake store, got %q", output)
+	}
+}
+
+func TestCommandWithFakeConfig(t *testing.T) {
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	cfg.Set("clip.timeout", "10s")
+
+	var output bytes.Buffer
+	rootCmd := NewRootCmd()
+	rootCmd.SetArgs([]string{"config", "get", "clip.timeout"})
+	ctx := withApp(context.Background(), &app{config: cfg, out: &output})
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		t.Fatalf("config get failed: %v", err)
+	}
+	if output.String() != "10s\n" {
+		t.Errorf("Expected the setting from the fake config, got %q", output.String())
+	}
+}
+
+func TestCmdEncryptorWithoutKeys(t *testing.T) {
+	cmd := NewRootCmd()
+	if _, err := cmdEncryptor(cmd); err == nil {
+		t.Error("Expected an error for a command without keys")
+	}
+	if _, err := getStore(cmd); err == nil {
+		t.Error("Expected getStore to fail without keys")
+	}
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Report weak, reused, stale and expired passwords",
+		Long: fmt.Sprintf("Decrypt every entry and report passwords that are shorter than %d characters, "+
+			"used by several entries, unchanged for a year, or past or near their expiry date, and "+
+			"entries with %d or fewer unused recovery codes. "+
+			"Set an expiry date with an 'expires: YYYY-MM-DD' line in the entry.",
+			storage.MinPasswordLength, storage.LowRecoveryCodes),
+		Example: "  passh audit\n" +
+			"  passh audit --no-pager > audit.txt",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			progress, finish := progressBar("Auditing")
+			store.SetProgress(progress)
+			store.SetContext(ctx)
+			findings, err := store.Audit(time.Now())
+			finish()
+			if err != nil {
+				return err
+			}
+
+			closePager := pageOutput(cmd)
+			for _, finding := range findings {
+				printFinding(cmd.OutOrStdout(), finding)
+			}
+			closePager()
+			logging.Infof("%d findings", len(findings))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(newAuditExpiryCmd(), newAuditPolicyCmd())
+
+	return cmd
+}
+
+func newAuditExpiryCmd() *cobra.Command {
+	var within string
+
+	cmd := &cobra.Command{
+		Use:   "expiry",
+		Short: "Report passwords that expired or are due for rotation",
+		Long: "List the entries whose 'expires: YYYY-MM-DD' date has passed or falls within --within " +
+			"(30 days by default), soonest first. Expiry dates are read from the store index, so " +
+			"entries are not decrypted.",
+		Example: "  passh audit expiry\n" +
+			"  passh audit expiry --within 90d",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			window, err := parseDuration(within)
+			if err != nil {
+				return fmt.Errorf("invalid --within: %w", err)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			index, err := store.Index()
+			if err != nil {
+				return err
+			}
+
+			closePager := pageOutput(cmd)
+			names := printExpiring(cmd.OutOrStdout(), index, time.Now(), window)
+			closePager()
+			if len(names) == 0 {
+				logging.Infof("No passwords expire within %s", within)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&within, "within", "30d", "Also report passwords expiring within this time")
+
+	return cmd
+}
+
+func newAuditPolicyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "policy",
+		Short: "Report entries readable by keys the access policy does not allow",
+		Long: "Check every entry against the " + storage.PolicyFile + " file at the root of the store, " +
+			"which lists a path prefix and the SHA256 fingerprints of the keys allowed under it on each " +
+			"line, for example:\n\n" +
+			"  team      SHA256:abc... SHA256:def...\n" +
+			"  team/ops  SHA256:abc...\n\n" +
+			"Entries encrypted to other keys are reported, as are entries whose recipients file would " +
+			"add such keys when re-encrypted. Entries are not decrypted. 'passh add' and 'passh reencrypt' " +
+			"refuse to encrypt entries to keys outside the policy.",
+		Example: "  passh audit policy",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			findings, err := store.AuditPolicy()
+			if err != nil {
+				return err
+			}
+			closePager := pageOutput(cmd)
+			for _, finding := range findings {
+				printFinding(cmd.OutOrStdout(), finding)
+			}
+			closePager()
+			if len(findings) > 0 {
+				return fmt.Errorf("%d access policy violations", len(findings))
+			}
+			logging.Infof("All entries follow the access policy")
+			return nil
+		},
+	}
+}
+
+// printFinding prints an audit finding, colored by how serious it is
+func printFinding(out io.Writer, finding storage.Finding) {
+	kind := paint(findingStyle(finding.Kind), fmt.Sprintf("%-10s", finding.Kind))
+	fmt.Fprintf(out, "%s  %s: %s\n", kind, finding.Name, finding.Message)
+}
+
+// printExpiring lists the entries that expire within window of now and
+// returns them
+func printExpiring(out io.Writer, index *storage.Index, now time.Time, window time.Duration) []string {
+	names := index.Expiring(now.Add(window))
+	for _, name := range names {
+		expires := index.Entries[name].Expires
+		state := paint(styleWarning, "expires")
+		if !now.Before(expires) {
+			state = paint(styleDanger, "expired")
+		}
+		fmt.Fprintf(out, "%s %s  %s\n", state, expires.Format(storage.ExpiryLayout), name)
+	}
+	return names
+}
+
+// warnIfExpired warns when the entry being read is past its expiry date
+func warnIfExpired(name string, content []byte) {
+	expires, err := storage.Expiry(content)
+	if err != nil {
+		logging.Warnf("entry '%s': %v", name, err)
+		return
+	}
+	if !expires.IsZero() && !time.Now().Before(expires) {
+		logging.Warnf("'%s' expired on %s; time to change it", name, expires.Format(storage.ExpiryLayout))
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/autotype"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+func newAutotypeCmd() *cobra.Command {
+	var delay time.Duration
+	var sequence string
+
+	cmd := &cobra.Command{
+		Use:   "autotype NAME",
+		Short: "Type an entry's username and password into the active window",
+		Long: "Type an entry into another window, by default as username<TAB>password<ENTER>. The " +
+			"window that was active when passh started, for example when launched from a hotkey or " +
+			"a launcher menu, is focused again before typing. From a terminal, use --delay to switch " +
+			"to the target window first.\n\n" +
+			"The sequence is taken from --sequence, an 'autotype:' line in the entry, the " +
+			"autotype.sequence config setting, or the default " + autotype.DefaultSequence + ". " +
+			"Placeholders name entry fields (the first line is {password}, 'key: value' lines add " +
+			"fields), the keys {tab}, {enter} and {space}, or a pause as {delay 1s}.\n\n" +
+			"Uses xdotool on X11, wtype on Wayland, System Events on macOS and SendKeys on Windows.",
+		Example: "  passh autotype web/github\n" +
+			"  passh autotype web/github --delay 3s\n" +
+			"  passh autotype web/bank --sequence '{password}{enter}'",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			typer, err := autotype.Detect()
+			if err != nil {
+				return err
+			}
+
+			// Remember the target before any prompt can take focus
+			var window string
+			focuser, canFocus := typer.(autotype.Focuser)
+			if canFocus {
+				if window, err = focuser.ActiveWindow(); err != nil {
+					return err
+				}
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			data, err := store.Get(name)
+			if err != nil {
+				return err
+			}
+			recordAccess(cmd, name)
+
+			fields := parseEntryFields(data)
+			if sequence == "" {
+				sequence, err = autotypeSequence(cmd, fields)
+				if err != nil {
+					return err
+				}
+			}
+			actions, err := autotype.Parse(sequence, fields)
+			if err != nil {
+				return err
+			}
+
+			if delay > 0 {
+				logging.Infof("Typing in %s, switch to the target window...", delay)
+				time.Sleep(delay)
+			} else if canFocus {
+				if err := focuser.Focus(window); err != nil {
+					return err
+				}
+			}
+
+			return autotype.Run(typer, actions)
+		},
+	}
+
+	cmd.Flags().DurationVarP(&delay, "delay", "d", 0, "Wait this long before typing instead of refocusing the previous window")
+	cmd.Flags().StringVarP(&sequence, "sequence", "s", "", "Autotype sequence, overriding the entry and config")
+
+	return cmd
+}
+
+// autotypeSequence picks the sequence for an entry: its own autotype field,
+// the configured default, or a built-in default depending on whether the
+// entry has a username
+func autotypeSequence(cmd *cobra.Command, fields map[string][]byte) (string, error) {
+	if sequence, ok := fields["autotype"]; ok {
+		return string(sequence), nil
+	}
+
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	if sequence := cfg.Get("autotype.sequence"); sequence != "" {
+		return sequence, nil
+	}
+
+	if _, ok := fields["username"]; ok {
+		return autotype.DefaultSequence, nil
+	}
+	return autotype.PasswordSequence, nil
+}
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+)
+
+// Encryption backends
+const (
+	backendSSH        = "ssh"
+	backendGPG        = "gpg"
+	backendPassphrase = "passphrase"
+	backendAWSKMS     = "awskms"
+	backendGCPKMS     = "gcpkms"
+	backendAzureKV    = "azurekv"
+	backendVault      = "vault"
+)
+
+// backendName returns the encryption backend chosen with --backend or the
+// backend setting, defaulting to ssh. Names other than the built-in backends
+// refer to plugins.
+func backendName(cmd *cobra.Command, cfg *config.Config) (string, error) {
+	name, _ := cmd.Flags().GetString("backend")
+	if name == "" {
+		name = cfg.Get("backend")
+	}
+	switch name {
+	case "":
+		return backendSSH, nil
+	case backendSSH, backendGPG, backendPassphrase, backendAWSKMS, backendGCPKMS, backendAzureKV, backendVault:
+		return name, nil
+	}
+	if _, err := pluginPath(name); err != nil {
+		return "", fmt.Errorf("unknown backend '%s', expected ssh, gpg, passphrase, awskms, gcpkms, azurekv, vault or a plugin: %w", name, err)
+	}
+	return name, nil
+}
+
+// pluginPath returns the executable of an encryptor plugin, which lives in
+// the plugins folder of the config directory
+func pluginPath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\:`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid plugin name '%s'", name)
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "plugins", name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("no plugin at %s", path)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("plugin %s is not executable", path)
+	}
+	return path, nil
+}
+
+// setupPluginEncryptor attaches an encryptor plugin to the command context,
+// passing it the plugin.NAME.* settings
+func setupPluginEncryptor(cmd *cobra.Command, cfg *config.Config, name string) error {
+	path, err := pluginPath(name)
+	if err != nil {
+		return err
+	}
+
+	options := make(map[string]string)
+	prefix := "plugin." + name + "."
+	for _, key := range cfg.Keys() {
+		if option, ok := strings.CutPrefix(key, prefix); ok {
+			options[option] = cfg.Get(key)
+		}
+	}
+
+	encryptor := crypto.NewPluginEncryptor(name, path, options)
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// setupGPGEncryptor attaches a GPG encryptor for the keys in the gpg.id
+// setting to the command context
+func setupGPGEncryptor(cmd *cobra.Command, cfg *config.Config) error {
+	encryptor, err := crypto.NewGPGEncryptor(strings.Fields(cfg.Get("gpg.id")))
+	if err != nil {
+		return err
+	}
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// setupKMSEncryptor attaches an encryptor wrapping data keys with a cloud
+// KMS key, chosen with --key-id or the kms.key_id setting. Vault transit
+// keys are chosen with --transit-key or vault.transit_key instead.
+func setupKMSEncryptor(cmd *cobra.Command, cfg *config.Config, name string) error {
+	var wrapper crypto.KeyWrapper
+	switch name {
+	case backendAWSKMS:
+		wrapper = crypto.AWSKMS{}
+	case backendGCPKMS:
+		wrapper = crypto.GCPKMS{}
+	case backendAzureKV:
+		wrapper = crypto.AzureKeyVault{}
+	case backendVault:
+		wrapper = vaultTransit(cfg)
+	}
+
+	var keyID string
+	if name == backendVault {
+		keyID, _ = cmd.Flags().GetString("transit-key")
+		if keyID == "" {
+			keyID = cfg.Get("vault.transit_key")
+		}
+	}
+	if keyID == "" {
+		keyID, _ = cmd.Flags().GetString("key-id")
+	}
+	if keyID == "" {
+		keyID = cfg.Get("kms.key_id")
+	}
+	if keyID != "" {
+		logging.Verbosef("Wrapping data keys with %s key %s", name, keyID)
+	}
+
+	encryptor := crypto.NewKMSEncryptor(wrapper, keyID)
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// vaultTransit configures Vault from the vault.address, vault.mount and
+// vault.namespace settings, falling back to the VAULT_ADDR and
+// VAULT_NAMESPACE variables the vault CLI uses
+func vaultTransit(cfg *config.Config) crypto.VaultTransit {
+	setting := func(key, env string) string {
+		if value := cfg.Get(key); value != "" {
+			return value
+		}
+		return os.Getenv(env)
+	}
+	return crypto.VaultTransit{
+		Address:   setting("vault.address", "VAULT_ADDR"),
+		Mount:     cfg.Get("vault.mount"),
+		Namespace: setting("vault.namespace", "VAULT_NAMESPACE"),
+	}
+}
+
+// setupPassphraseEncryptor asks for the store passphrase and attaches a
+// passphrase encryptor to the command context. The Argon2id parameters for
+// new entries come from the passphrase.time, passphrase.memory (MiB) and
+// passphrase.threads settings.
+func setupPassphraseEncryptor(cmd *cobra.Command, cfg *config.Config) error {
+	params, err := kdfParams(cfg)
+	if err != nil {
+		return err
+	}
+
+	if isBatch(cmd) {
+		return fmt.Errorf("the passphrase backend needs a passphrase: %w", errBatchInput)
+	}
+	passphrase, err := cmdPrompter(cmd).ReadPassword("Enter store passphrase: ")
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	defer secure.Wipe(passphrase)
+
+	encryptor, err := crypto.NewPassphraseEncryptor(passphrase, params)
+	if err != nil {
+		return err
+	}
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// kdfParams reads the Argon2id parameters for new entries from the config
+func kdfParams(cfg *config.Config) (crypto.KDFParams, error) {
+	params := crypto.DefaultKDFParams
+	setting := func(key string, bits int) (uint64, bool, error) {
+		value := cfg.Get(key)
+		if value == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.ParseUint(value, 10, bits)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return n, true, nil
+	}
+
+	if n, ok, err := setting("passphrase.time", 32); err != nil {
+		return params, err
+	} else if ok {
+		params.Time = uint32(n)
+	}
+	if n, ok, err := setting("passphrase.memory", 22); err != nil {
+		return params, err
+	} else if ok {
+		params.Memory = uint32(n) * 1024
+	}
+	if n, ok, err := setting("passphrase.threads", 8); err != nil {
+		return params, err
+	} else if ok {
+		params.Threads = uint8(n)
+	}
+	return params, params.Validate()
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+)
+
+func TestKDFParams(t *testing.T) {
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	cfg.Set("passphrase.memory", "128")
+	cfg.Set("passphrase.threads", "2")
+
+	params, err := kdfParams(cfg)
+	if err != nil {
+		t.Fatalf("kdfParams failed: %v", err)
+	}
+	expected := crypto.KDFParams{Time: crypto.DefaultKDFParams.Time, Memory: 128 * 1024, Threads: 2}
+	if params != expected {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	cfg.Set("passphrase.memory", "1")
+	if _, err := kdfParams(cfg); err == nil {
+		t.Error("Expected 1 MiB of memory to be rejected")
+	}
+}
+
+func TestPluginPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "passh", "plugins")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatalf("Failed to create plugins dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kms"), []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes"), []byte("not a plugin"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if path, err := pluginPath("kms"); err != nil || path != filepath.Join(dir, "kms") {
+		t.Errorf("pluginPath(kms) = %q, %v", path, err)
+	}
+	for _, name := range []string{"notes", "missing", "../kms", ".hidden"} {
+		if _, err := pluginPath(name); err == nil {
+			t.Errorf("Expected pluginPath(%q) to fail", name)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Create and restore encrypted backups",
+		Long: "Create a single encrypted archive of the whole store, for example for cold backups " +
+			"on a USB drive, and restore it later. The archive is encrypted with the store's backend and " +
+			"contains a manifest with a checksum for every entry.\n\n" +
+			"The ssh backend does not encrypt yet: its archives are only encoded, and anyone who gets " +
+			"the file can read every entry in it. Keep such backups as safe as the plaintext, or back " +
+			"up a store using --backend passphrase, gpg or a key service.",
+	}
+
+	cmd.AddCommand(newBackupCreateCmd(), newBackupRestoreCmd(), newBackupVerifyCmd())
+
+	return cmd
+}
+
+func newBackupCreateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "create FILE",
+		Short:   "Write an encrypted backup of the store to FILE",
+		Example: "  passh backup create /media/usb/passh-backup.enc",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create backup: %w", err)
+			}
+
+			manifest, err := store.CreateBackup(file)
+			if closeErr := file.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write backup: %w", closeErr)
+			}
+			if err != nil {
+				_ = os.Remove(args[0])
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d entries to '%s'\n", len(manifest.Entries), args[0])
+			return nil
+		},
+	}
+}
+
+func newBackupRestoreCmd() *cobra.Command {
+	var merge bool
+
+	cmd := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Restore the store from an encrypted backup",
+		Long: "Restore the store from an encrypted backup. Entries are re-encrypted to your current keys.\n\n" +
+			"By default the store is made to match the backup exactly, so entries that are not in the " +
+			"backup are removed. With --merge, existing entries are kept and only missing ones are restored.",
+		Example: "  passh backup restore /media/usb/passh-backup.enc\n" +
+			"  passh backup restore /media/usb/passh-backup.enc --merge",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read backup: %w", err)
+			}
+			defer file.Close()
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			backup, err := store.ReadBackup(file)
+			if err != nil {
+				return err
+			}
+			defer backup.Wipe()
+
+			if !merge && !confirm(cmd, fmt.Sprintf("Replace the store with the %d entries from '%s'? Entries not in the backup will be deleted.",
+				len(backup.Manifest.Entries), args[0])) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Restore cancelled")
+				return nil
+			}
+
+			result, err := store.RestoreBackup(backup, merge)
+			if err != nil {
+				return err
+			}
+
+			for _, name := range result.Skipped {
+				fmt.Fprintf(cmd.OutOrStdout(), "skipped  %s (already exists)\n", name)
+			}
+			for _, name := range result.Removed {
+				fmt.Fprintf(cmd.OutOrStdout(), "removed  %s\n", name)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Restored %d entries from backup created %s\n",
+				len(result.Restored), backup.Manifest.Created.Local().Format("2006-01-02 15:04:05"))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&merge, "merge", "m", false, "Keep existing entries and only restore missing ones")
+
+	return cmd
+}
+
+func newBackupVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "verify FILE",
+		Short:   "Check that a backup can be decrypted and is complete",
+		Example: "  passh backup verify /media/usb/passh-backup.enc",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read backup: %w", err)
+			}
+			defer file.Close()
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			backup, err := store.ReadBackup(file)
+			if err != nil {
+				return err
+			}
+			defer backup.Wipe()
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Backup OK: %d entries, created %s\n",
+				len(backup.Manifest.Entries), backup.Manifest.Created.Local().Format("2006-01-02 15:04:05"))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// batchGenerateLength is the length of passwords made by generate lines
+// without one
+const batchGenerateLength = 16
+
+func newBatchCmd() *cobra.Command {
+	var message string
+
+	cmd := &cobra.Command{
+		Use:   "batch [FILE]",
+		Short: "Apply a script of changes all at once, or not at all",
+		Long: "Apply the changes in a script, read from FILE or standard input, as one transaction. " +
+			"Each line is one of:\n\n" +
+			"  add NAME PASSWORD     add an entry; the rest of the line is the password\n" +
+			"  generate NAME [LEN]   add an entry with a generated password\n" +
+			"  mv OLD NEW            rename an entry\n" +
+			"  delete NAME           delete an entry\n\n" +
+			"Blank lines and lines starting with # are skipped. Every line is checked and every entry " +
+			"encrypted before the store is touched, so a mistake anywhere changes nothing. If writing " +
+			"fails part way, the entries already written are restored; if passh is killed, the next " +
+			"batch restores them. Stores at the root of a git repository get one commit for the batch.\n\n" +
+			"Entries are never replaced: add and mv fail if the name is taken. With --dry-run the " +
+			"script is checked and the changes listed.",
+		Example: "  passh batch < changes.txt\n" +
+			"  printf 'mv web/old web/new\\ndelete web/unused\\n' | passh batch -",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{dryRunAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := cmd.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open batch script: %w", err)
+				}
+				defer file.Close()
+				input = file
+			}
+			ops, err := readBatchScript(input)
+			defer func() {
+				for _, op := range ops {
+					secure.Wipe(op.Secret)
+				}
+			}()
+			if err != nil {
+				return err
+			}
+			if len(ops) == 0 {
+				logging.Infof("Nothing to do")
+				return nil
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if isDryRun(cmd) {
+				if err := store.CheckBatch(ops); err != nil {
+					return err
+				}
+				printBatch(cmd.OutOrStdout(), ops, true)
+				return nil
+			}
+
+			if message == "" {
+				message = fmt.Sprintf("Apply batch of %d changes", len(ops))
+			}
+			if err := store.ApplyBatch(ops, message); err != nil {
+				return err
+			}
+			printBatch(cmd.OutOrStdout(), ops, false)
+			logging.Infof("Applied %d changes", len(ops))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&message, "message", "m", "", "Git commit message for stores kept in git")
+
+	return cmd
+}
+
+// readBatchScript parses a batch script into operations. Generated
+// passwords are made here, so the script is complete before it is applied.
+func readBatchScript(r io.Reader) ([]storage.BatchOp, error) {
+	script, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch script: %w", err)
+	}
+	defer secure.Wipe(script)
+
+	var ops []storage.BatchOp
+	for i, line := range bytes.Split(script, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		op, err := parseBatchLine(line)
+		if err != nil {
+			return ops, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// parseBatchLine parses one line of a batch script. The line is not turned
+// into a string, as it may hold a password.
+func parseBatchLine(line []byte) (storage.BatchOp, error) {
+	verb, rest := cutField(line)
+	switch string(verb) {
+	case "add":
+		name, password := cutField(rest)
+		if len(name) == 0 || len(password) == 0 {
+			return storage.BatchOp{}, fmt.Errorf("expected 'add NAME PASSWORD'")
+		}
+		return storage.BatchOp{Kind: storage.BatchAdd, Name: string(name), Secret: append([]byte(nil), password...)}, nil
+
+	case "generate":
+		fields := strings.Fields(string(rest))
+		if len(fields) < 1 || len(fields) > 2 {
+			return storage.BatchOp{}, fmt.Errorf("expected 'generate NAME [LENGTH]'")
+		}
+		length := batchGenerateLength
+		if len(fields) == 2 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				return storage.BatchOp{}, fmt.Errorf("invalid length '%s'", fields[1])
+			}
+			length = n
+		}
+		password, err := generateRandomPassword(length, true)
+		if err != nil {
+			return storage.BatchOp{}, err
+		}
+		return storage.BatchOp{Kind: storage.BatchAdd, Name: fields[0], Secret: password}, nil
+
+	case "mv":
+		fields := strings.Fields(string(rest))
+		if len(fields) != 2 {
+			return storage.BatchOp{}, fmt.Errorf("expected 'mv OLD NEW'")
+		}
+		return storage.BatchOp{Kind: storage.BatchMove, Name: fields[0], Target: fields[1]}, nil
+
+	case "delete":
+		fields := strings.Fields(string(rest))
+		if len(fields) != 1 {
+			return storage.BatchOp{}, fmt.Errorf("expected 'delete NAME'")
+		}
+		return storage.BatchOp{Kind: storage.BatchDelete, Name: fields[0]}, nil
+
+	default:
+		return storage.BatchOp{}, fmt.Errorf("unknown command '%s', expected add, generate, mv or delete", verb)
+	}
+}
+
+// cutField splits off the first whitespace-separated field of a line
+func cutField(line []byte) ([]byte, []byte) {
+	i := bytes.IndexAny(line, " \t")
+	if i < 0 {
+		return line, nil
+	}
+	return line[:i], bytes.TrimLeft(line[i:], " \t")
+}
+
+// printBatch lists the changes of a batch, or with dryRun the changes it
+// would make
+func printBatch(out io.Writer, ops []storage.BatchOp, dryRun bool) {
+	add, move, del := "added  ", "moved  ", "deleted"
+	if dryRun {
+		add, move, del = "would add   ", "would move  ", "would delete"
+	}
+	for _, op := range ops {
+		switch op.Kind {
+		case storage.BatchAdd:
+			fmt.Fprintf(out, "%s %s\n", add, op.Name)
+		case storage.BatchMove:
+			fmt.Fprintf(out, "%s %s -> %s\n", move, op.Name, op.Target)
+		case storage.BatchDelete:
+			fmt.Fprintf(out, "%s %s\n", del, op.Name)
+		}
+	}
+}
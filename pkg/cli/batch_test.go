@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestReadBatchScript(t *testing.T) {
+	script := "# Reorganize\n" +
+		"add web/mail  correct horse battery\r\n" +
+		"\n" +
+		"generate web/new 24\n" +
+		"mv\tweb/old   web/renamed\n" +
+		"delete web/unused\n"
+	ops, err := readBatchScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("readBatchScript failed: %v", err)
+	}
+	if len(ops) != 4 {
+		t.Fatalf("Expected 4 operations, got %d", len(ops))
+	}
+
+	if ops[0].Kind != storage.BatchAdd || ops[0].Name != "web/mail" || string(ops[0].Secret) != "correct horse battery" {
+		t.Errorf("Unexpected add: %+v", ops[0])
+	}
+	if ops[1].Kind != storage.BatchAdd || ops[1].Name != "web/new" || len(ops[1].Secret) != 24 {
+		t.Errorf("Unexpected generate: %v with %d characters", ops[1], len(ops[1].Secret))
+	}
+	if ops[2].Kind != storage.BatchMove || ops[2].Name != "web/old" || ops[2].Target != "web/renamed" {
+		t.Errorf("Unexpected mv: %+v", ops[2])
+	}
+	if ops[3].Kind != storage.BatchDelete || ops[3].Name != "web/unused" {
+		t.Errorf("Unexpected delete: %+v", ops[3])
+	}
+
+	for script, message := range map[string]string{
+		"delete a\nadd web/mail\n": "line 2: expected 'add NAME PASSWORD'",
+		"mv a\n":                   "line 1: expected 'mv OLD NEW'",
+		"generate a x\n":           "line 1: invalid length 'x'",
+		"rename a b\n":             "line 1: unknown command 'rename'",
+	} {
+		if _, err := readBatchScript(strings.NewReader(script)); err == nil || !strings.HasPrefix(err.Error(), message) {
+			t.Errorf("Expected %q for %q, got %v", message, script, err)
+		}
+	}
+}
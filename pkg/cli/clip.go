@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/clipboard"
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+// defaultClipTimeout is how long copied secrets stay on the clipboard
+const defaultClipTimeout = 45 * time.Second
+
+// clipClearCmd is the hidden command that clears the clipboard in the background
+const clipClearCmd = "clipboard-clear"
+
+// clipTimeoutEnv overrides the clip.timeout setting, in seconds or as a
+// duration
+const clipTimeoutEnv = "PASSH_CLIP_TIME"
+
+// clipTimeout returns how long copied secrets stay on the clipboard
+func clipTimeout(cfg *config.Config) (time.Duration, error) {
+	if value, ok := os.LookupEnv(clipTimeoutEnv); ok {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, nil
+		}
+		timeout, err := parseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid $%s: %w", clipTimeoutEnv, err)
+		}
+		return timeout, nil
+	}
+
+	value := cfg.Get("clip.timeout")
+	if value == "" {
+		return defaultClipTimeout, nil
+	}
+	timeout, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clip.timeout: %w", err)
+	}
+	return timeout, nil
+}
+
+// detectClipboard returns the passh tmux buffer with tmux, the commands in
+// clip.copy_cmd and clip.paste_cmd if set, or the system clipboard
+func detectClipboard(cfg *config.Config, tmux bool) (*clipboard.Clipboard, error) {
+	if tmux {
+		return clipboard.Tmux()
+	}
+	if copyCmd := cfg.Get("clip.copy_cmd"); copyCmd != "" {
+		return clipboard.Command(copyCmd, cfg.Get("clip.paste_cmd")), nil
+	}
+	return clipboard.Detect()
+}
+
+// copyToClipboard copies a secret, to the tmux buffer with tmux, and starts a
+// background process that clears it again after the clip.timeout setting
+func copyToClipboard(cmd *cobra.Command, name string, secret []byte, tmux bool) error {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	board, err := detectClipboard(cfg, tmux)
+	if err != nil {
+		return err
+	}
+	target := "the clipboard"
+	if tmux {
+		target = "the tmux buffer '" + clipboard.TmuxBuffer + "'"
+	}
+	timeout, err := clipTimeout(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := board.Copy(secret); err != nil {
+		return err
+	}
+	if timeout == 0 {
+		logging.Infof("Copied '%s' to %s", name, target)
+		return nil
+	}
+
+	if err := startClipboardClear(secret, timeout, tmux); err != nil {
+		return err
+	}
+	logging.Infof("Copied '%s' to %s. Will clear in %s.", name, target, timeout)
+	return nil
+}
+
+// copyChain copies an entry's username, waits for Enter or the delay, and
+// then copies its password, which is cleared again like any other copy
+func copyChain(cmd *cobra.Command, name string, username, password []byte, delay time.Duration, tmux bool) error {
+	if delay == 0 && isBatch(cmd) {
+		return fmt.Errorf("waiting for Enter between username and password; use --chain-delay: %w", errBatchInput)
+	}
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+	board, err := detectClipboard(cfg, tmux)
+	if err != nil {
+		return err
+	}
+
+	if err := board.Copy(username); err != nil {
+		return err
+	}
+	if delay > 0 {
+		logging.Infof("Copied the username of '%s'. Copying the password in %s.", name, delay)
+		time.Sleep(delay)
+	} else {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Copied the username of '%s'. Press Enter to copy the password: ", name)
+		if _, err := readLine(cmd.InOrStdin()); err != nil {
+			fmt.Fprintln(cmd.ErrOrStderr())
+			return fmt.Errorf("not copying the password: %w", err)
+		}
+	}
+	return copyToClipboard(cmd, name, password, tmux)
+}
+
+// startClipboardClear runs the hidden clear command detached from this one.
+// It only learns a digest of the secret, passed on stdin so it doesn't show
+// up in process lists.
+func startClipboardClear(secret []byte, timeout time.Duration, tmux bool) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find passh executable: %w", err)
+	}
+
+	// Write the digest into a pipe up front: passh exits right away, so the
+	// child must inherit the pipe rather than be fed by a goroutine
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to schedule clearing the clipboard: %w", err)
+	}
+	defer reader.Close()
+	digest := sha256.Sum256(secret)
+	_, err = writer.WriteString(hex.EncodeToString(digest[:]) + "\n")
+	writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to schedule clearing the clipboard: %w", err)
+	}
+
+	args := []string{clipClearCmd, timeout.String()}
+	if tmux {
+		args = append(args, "--tmux")
+	}
+	child := exec.Command(executable, args...)
+	child.Stdin = reader
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to schedule clearing the clipboard: %w", err)
+	}
+	return child.Process.Release()
+}
+
+func newClipboardClearCmd() *cobra.Command {
+	var tmux bool
+
+	cmd := &cobra.Command{
+		Use:         clipClearCmd + " DURATION",
+		Short:       "Clear the clipboard after a delay if it still holds a copied secret",
+		Hidden:      true,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Outlive the terminal the secret was copied from
+			signal.Ignore(syscall.SIGHUP)
+
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil {
+				return err
+			}
+			digest, err := readLine(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to read secret digest: %w", err)
+			}
+
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			board, err := detectClipboard(cfg, tmux)
+			if err != nil {
+				return err
+			}
+
+			time.Sleep(timeout)
+
+			// Leave the clipboard alone if something else was copied since,
+			// unless it can't be read back
+			if !board.CanPaste() {
+				return board.Clear()
+			}
+			current, err := board.Paste()
+			if err != nil {
+				return err
+			}
+			if !clipboardHolds(current, digest) {
+				return nil
+			}
+			return board.Clear()
+		},
+	}
+
+	cmd.Flags().BoolVar(&tmux, "tmux", false, "Clear the passh tmux buffer instead of the clipboard")
+
+	return cmd
+}
+
+// clipboardHolds reports whether clipboard contents match a hex SHA-256
+// digest, allowing for a line break added by the paste tool
+func clipboardHolds(current []byte, digest string) bool {
+	for _, candidate := range [][]byte{current, bytes.TrimRight(current, "\r\n")} {
+		sum := sha256.Sum256(candidate)
+		if hex.EncodeToString(sum[:]) == digest {
+			return true
+		}
+	}
+	return false
+}
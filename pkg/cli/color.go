@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/term"
+)
+
+// ANSI styles of list and audit output
+const (
+	styleFolder  = "1;34"
+	styleDanger  = "31"
+	styleWarning = "33"
+	styleMarker  = "36"
+)
+
+// otpMarker follows the names of entries with an OTP key
+const otpMarker = " ⏱"
+
+// useColor is set from --color before a command runs
+var useColor bool
+
+// setColor applies --color: auto colors output on a terminal unless
+// NO_COLOR is set, as https://no-color.org asks
+func setColor(mode string) error {
+	switch mode {
+	case "always":
+		useColor = true
+	case "never":
+		useColor = false
+	case "auto":
+		useColor = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" &&
+			term.IsTerminal(int(os.Stdout.Fd()))
+	default:
+		return fmt.Errorf("invalid --color '%s', expected auto, always or never", mode)
+	}
+	return nil
+}
+
+// paint wraps text in an ANSI style if output is colored
+func paint(style, text string) string {
+	if !useColor {
+		return text
+	}
+	return "\x1b[" + style + "m" + text + "\x1b[0m"
+}
+
+// formatEntry returns an entry name for listing. With color, its folders are
+// highlighted, expired entries shown in red and entries with an OTP key
+// marked; without, it is the plain name, so scripts can read it.
+func formatEntry(index *storage.Index, name string, now time.Time) string {
+	if !useColor {
+		return name
+	}
+	entry := index.Entries[name]
+	dir, base := path.Split(name)
+	if !entry.Expires.IsZero() && !now.Before(entry.Expires) {
+		base = paint(styleDanger, base)
+	}
+	if dir != "" {
+		base = paint(styleFolder, dir) + base
+	}
+	if entry.OTP {
+		base += paint(styleMarker, otpMarker)
+	}
+	return base
+}
+
+// findingStyle returns the style of an audit finding kind
+func findingStyle(kind string) string {
+	switch kind {
+	case storage.FindingStale, storage.FindingExpiring, storage.FindingRecovery:
+		return styleWarning
+	}
+	return styleDanger
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestSetColor(t *testing.T) {
+	defer func() { useColor = false }()
+
+	t.Setenv("NO_COLOR", "1")
+	if err := setColor("always"); err != nil || !useColor {
+		t.Errorf("Expected --color always to override NO_COLOR, got %v, %v", useColor, err)
+	}
+	if err := setColor("auto"); err != nil || useColor {
+		t.Errorf("Expected NO_COLOR to turn off color, got %v, %v", useColor, err)
+	}
+	if err := setColor("never"); err != nil || useColor {
+		t.Errorf("Expected --color never to turn off color, got %v, %v", useColor, err)
+	}
+	if err := setColor("sometimes"); err == nil {
+		t.Error("Expected an invalid --color to fail")
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	defer func() { useColor = false }()
+
+	now := time.Now()
+	index := &storage.Index{Entries: map[string]storage.IndexEntry{
+		"web/mail":  {OTP: true},
+		"bank/card": {Expires: now.Add(-time.Hour)},
+		"plain":     {},
+	}}
+
+	useColor = false
+	if got := formatEntry(index, "web/mail", now); got != "web/mail" {
+		t.Errorf("Expected the plain name without color, got %q", got)
+	}
+
+	useColor = true
+	for name, expected := range map[string]string{
+		"web/mail":  "\x1b[1;34mweb/\x1b[0mmail\x1b[36m ⏱\x1b[0m",
+		"bank/card": "\x1b[1;34mbank/\x1b[0m\x1b[31mcard\x1b[0m",
+		"plain":     "plain",
+	} {
+		if got := formatEntry(index, name, now); got != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, name, got)
+		}
+	}
+}
@@ -1,64 +1,169 @@
 package cli
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"path"
+	"sort"
 	"strings"
-	"syscall"
+	"time"
 
+	"github.com/rejoice4156/passh/pkg/clipboard"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 // Subcommands
 
 func newAddCmd() *cobra.Command {
+	return newWriteCmd(false)
+}
+
+func newUpdateCmd() *cobra.Command {
+	return newWriteCmd(true)
+}
+
+// newWriteCmd builds add, which creates an entry and only replaces one when
+// asked to, or update, which replaces an existing entry
+func newWriteCmd(update bool) *cobra.Command {
 	var generatePassword bool
 	var passwordLength int
+	var fromStdin bool
+	var templateName string
+	var force bool
 
 	cmd := &cobra.Command{
 		Use:   "add NAME",
 		Short: "Add a new password",
-		Long:  "Add a new password entry to the store",
-		Args:  cobra.ExactArgs(1),
+		Long: "Add a new password entry to the store. The password is prompted for twice, " +
+			"generated with --generate, or read from standard input with --stdin.\n\n" +
+			"An existing entry is only replaced after confirming, or with --force when the password " +
+			"comes from --stdin or in --batch mode; 'passh update' replaces entries without asking.\n\n" +
+			"With --template the entry is filled in from a template (see 'passh template'), which " +
+			"also decides whether the password is generated unless --generate or --stdin is given.\n\n" +
+			"With --dry-run nothing is prompted for or written; passh only says whether the entry " +
+			"would be added or replaced.",
+		Example: "  passh add web/github\n" +
+			"  passh add web/github --generate --length 24\n" +
+			"  echo \"$TOKEN\" | passh add ci/token --stdin\n" +
+			"  passh add web/shop --template web-login",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{dryRunAnnotation: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if generatePassword && fromStdin {
+				return fmt.Errorf("cannot combine --generate with --stdin")
+			}
+
 			store, err := getStore(cmd)
 			if err != nil {
 				return err
 			}
+			defer store.Close()
+
+			var template *entryTemplate
+			if templateName != "" {
+				content, err := store.Template(templateName)
+				if err != nil {
+					return err
+				}
+				template, err = parseTemplate(string(content))
+				secure.Wipe(content)
+				if err != nil {
+					return fmt.Errorf("template '%s': %w", templateName, err)
+				}
+			}
+			length, symbols := passwordLength, true
+			if template != nil && template.generate && !fromStdin {
+				generatePassword = true
+				if !cmd.Flags().Changed("length") {
+					length, symbols = template.length, template.symbols
+				}
+			}
+			if !generatePassword && !fromStdin && isBatch(cmd) && !isDryRun(cmd) {
+				return fmt.Errorf("no password given; use --stdin or --generate: %w", errBatchInput)
+			}
 
 			name := args[0]
+			_, err = store.Stat(name)
+			exists := err == nil
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			switch {
+			case update && !exists:
+				return fmt.Errorf("%w: %s; use 'passh add' to create it", storage.ErrNotFound, name)
+			case !update && exists && !force:
+				// Standard input may carry the password, so only the prompt can ask
+				if isBatch(cmd) || fromStdin {
+					return fmt.Errorf("'%s' already exists; use --force or 'passh update' to replace it", name)
+				}
+				if isDryRun(cmd) {
+					fmt.Fprintf(cmd.OutOrStdout(), "Would ask before replacing %s\n", name)
+					return nil
+				}
+				if !askYesNo(cmd, fmt.Sprintf("'%s' already exists. Replace it?", name)) {
+					logging.Infof("Not replacing '%s'", name)
+					return nil
+				}
+			}
+			if isDryRun(cmd) {
+				if exists {
+					fmt.Fprintf(cmd.OutOrStdout(), "Would replace %s\n", name)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "Would add %s\n", name)
+				}
+				return nil
+			}
+
 			var password []byte
+			defer func() { secure.Wipe(password) }()
 
 			if generatePassword {
 				// Generate a random password
-				password, err = generateRandomPassword(passwordLength)
+				password, err = generateRandomPassword(length, symbols)
+				if err != nil {
+					return err
+				}
+				logging.Infof("Generated password for '%s':", name)
+				printSecret(cmd, password)
+			} else if fromStdin {
+				password, err = readSecret(cmd.InOrStdin())
 				if err != nil {
 					return err
 				}
-				fmt.Printf("Generated password for '%s': %s\n", name, password)
 			} else {
-				// Read password from stdin with confirmation
-				fmt.Printf("Enter password for '%s': ", name)
-				password, err = term.ReadPassword(int(syscall.Stdin))
+				password, err = promptPassword(cmd, name)
 				if err != nil {
-					return fmt.Errorf("failed to read password: %w", err)
+					return err
 				}
-				fmt.Println() // Add newline after password input
+			}
 
-				// Ask for confirmation
-				fmt.Print("Confirm password: ")
-				confirmPassword, err := term.ReadPassword(int(syscall.Stdin))
+			if template != nil {
+				lines, err := template.render(name, func(question string) (string, error) {
+					return askTemplateField(cmd, question)
+				})
 				if err != nil {
-					return fmt.Errorf("failed to read confirmation password: %w", err)
+					return err
 				}
-				fmt.Println() // Add newline after confirmation input
-
-				// Check if passwords match
-				if string(password) != string(confirmPassword) {
-					return fmt.Errorf("passwords do not match")
+				// Size the entry up front so no partial copies are left unwiped
+				size := len(password)
+				for _, line := range lines {
+					size += 1 + len(line)
+				}
+				content := append(make([]byte, 0, size), password...)
+				for _, line := range lines {
+					content = append(append(content, '\n'), line...)
 				}
+				secure.Wipe(password)
+				password = content
 			}
 
 			// Add the password to the store
@@ -66,164 +171,548 @@ func newAddCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("Added password '%s'\n", name)
+			if exists {
+				logging.Infof("Updated password '%s'", name)
+			} else {
+				logging.Infof("Added password '%s'", name)
+			}
 			return nil
 		},
 	}
+	if update {
+		cmd.Use = "update NAME"
+		cmd.Short = "Replace an existing password"
+		cmd.Long = "Replace the password of an existing entry, prompted for twice, generated with " +
+			"--generate, or read from standard input with --stdin. Unlike add, update fails if the " +
+			"entry does not exist, so a typo can't create a new entry.\n\n" +
+			"With --template the entry is filled in from a template (see 'passh template'). " +
+			"With --dry-run nothing is prompted for or written."
+		cmd.Example = "  passh update web/github\n" +
+			"  passh update web/github --generate\n" +
+			"  echo \"$NEW_TOKEN\" | passh update ci/token --stdin"
+		cmd.ValidArgsFunction = completeEntries
+	}
 
 	cmd.Flags().BoolVarP(&generatePassword, "generate", "g", false, "Generate a random password")
 	cmd.Flags().IntVarP(&passwordLength, "length", "l", 16, "Length of generated password")
+	cmd.Flags().BoolVar(&fromStdin, "stdin", false, "Read the password from standard input without prompting")
+	cmd.Flags().StringVarP(&templateName, "template", "t", "", "Fill in the entry from this template")
+	if !update {
+		cmd.Flags().BoolVarP(&force, "force", "f", false, "Replace the entry if it already exists")
+	}
 
 	return cmd
 }
 
+// promptPassword asks for a password twice without echoing it
+func promptPassword(cmd *cobra.Command, name string) ([]byte, error) {
+	prompt := cmdPrompter(cmd)
+	password, err := prompt.ReadPassword(fmt.Sprintf("Enter password for '%s': ", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %w", err)
+	}
+
+	// Ask for confirmation
+	confirmPassword, err := prompt.ReadPassword("Confirm password: ")
+	if err != nil {
+		secure.Wipe(password)
+		return nil, fmt.Errorf("failed to read confirmation password: %w", err)
+	}
+	defer secure.Wipe(confirmPassword)
+
+	// Check if passwords match
+	if subtle.ConstantTimeCompare(password, confirmPassword) != 1 {
+		secure.Wipe(password)
+		return nil, fmt.Errorf("passwords do not match")
+	}
+	return password, nil
+}
+
+// readSecret reads a secret from a pipe, dropping the trailing newline that
+// echo and most files add
+func readSecret(r io.Reader) ([]byte, error) {
+	secret, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %w", err)
+	}
+	secret = bytes.TrimSuffix(secret, []byte("\n"))
+	secret = bytes.TrimSuffix(secret, []byte("\r"))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("no password given on standard input")
+	}
+	return secret, nil
+}
+
+// printSecret writes a secret and a newline to the command's output without
+// converting it to a string, which would leave a copy that can't be wiped
+func printSecret(cmd *cobra.Command, secret []byte) {
+	out := cmd.OutOrStdout()
+	out.Write(secret)
+	out.Write([]byte("\n"))
+}
+
 func newGetCmd() *cobra.Command {
+	var full bool
+	var field string
+	var clip bool
+	var tmux bool
+	var clipChain bool
+	var chainDelay time.Duration
+	var attempts bool
+	var showQR bool
+	var qrPNG string
+
 	cmd := &cobra.Command{
 		Use:   "get [name]",
 		Short: "Retrieve a password",
-		Args:  cobra.ExactArgs(1),
+		Long: "Print the password of an entry, which is its first line. Use --full to print " +
+			"every line, for example of entries stored with 'passh insert --multiline'.\n\n" +
+			"Lines after the first in the form 'key: value' are fields, which --field prints, " +
+			"as in pass. With --clip the password or field is copied to the clipboard instead, " +
+			"and cleared again after 45 seconds (set clip.timeout to change this). Inside tmux, " +
+			"--tmux loads it into the '" + clipboard.TmuxBuffer + "' paste buffer instead, for sessions " +
+			"without a system clipboard.\n\n" +
+			"--clip-chain copies the entry's username field, waits for Enter (or --chain-delay), " +
+			"then copies the password, to paste both into a login form.\n\n" +
+			"--attempts shows which keys the entry is encrypted to and which of your private keys, " +
+			"from key files and ssh-agent, were tried and decrypted it, to find out why an entry " +
+			"can't be read.",
+		Example: "  passh get web/github\n" +
+			"  passh get web/github --clip\n" +
+			"  passh get web/github --field username\n" +
+			"  passh get api/stripe --full",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		Annotations:       map[string]string{cachedAnnotation: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			name := args[0]
+			if full && field != "" {
+				return fmt.Errorf("cannot combine --full with --field")
+			}
+			if clip && tmux {
+				return fmt.Errorf("cannot combine --clip with --tmux")
+			}
+			if clipChain && (clip || full || field != "") {
+				return fmt.Errorf("cannot combine --clip-chain with --clip, --full or --field")
+			}
 
 			store, err := getStore(cmd)
 			if err != nil {
 				return err
 			}
+			defer store.Close()
 
-			password, err := store.Get(name)
+			content, err := store.Get(name)
+			if attempts {
+				if reportErr := printDecryptAttempts(cmd, store, name); reportErr != nil {
+					logging.Warnf("Failed to show the keys tried: %v", reportErr)
+				}
+			}
 			if err != nil {
 				return err
 			}
+			entry := secure.Take(content)
+			defer entry.Destroy()
+			recordAccess(cmd, name)
+			warnIfExpired(name, content)
+
+			password := content
+			switch {
+			case field != "":
+				value, ok := parseEntryFields(content)[strings.ToLower(field)]
+				if !ok {
+					return fmt.Errorf("entry '%s' has no field '%s'", name, field)
+				}
+				password = value
+			case !full:
+				password = firstLine(content)
+			}
+
+			if clipChain {
+				username, ok := parseEntryFields(content)["username"]
+				if !ok {
+					return fmt.Errorf("entry '%s' has no username field", name)
+				}
+				return copyChain(cmd, name, username, password, chainDelay, tmux)
+			}
+			if clip || tmux {
+				return copyToClipboard(cmd, name, password, tmux)
+			}
 
-			fmt.Println(string(password))
+			if qrPNG != "" {
+				if err := writeQRPNG(qrPNG, password); err != nil {
+					return err
+				}
+				logging.Infof("Wrote QR code to %s", qrPNG)
+				return nil
+			}
+			if showQR {
+				return printQR(cmd.OutOrStdout(), password)
+			}
+
+			printSecret(cmd, password)
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVarP(&full, "full", "f", false, "Print the whole entry instead of the first line")
+	cmd.Flags().StringVar(&field, "field", "", "Print the value of a 'key: value' field instead of the password")
+	cmd.Flags().BoolVarP(&clip, "clip", "c", false, "Copy to the clipboard instead of printing")
+	cmd.Flags().BoolVar(&tmux, "tmux", false, "Load into a tmux paste buffer instead of printing")
+	cmd.Flags().BoolVar(&clipChain, "clip-chain", false, "Copy the username, then the password after Enter")
+	cmd.Flags().DurationVar(&chainDelay, "chain-delay", 0, "With --clip-chain, copy the password after this delay instead of waiting for Enter")
+	cmd.Flags().BoolVar(&attempts, "attempts", false, "Show which private keys were tried to decrypt the entry")
+	cmd.Flags().BoolVar(&showQR, "qr", false, "Show the password as a QR code in the terminal")
+	cmd.Flags().StringVar(&qrPNG, "qr-png", "", "Write the password as a QR code PNG to this file")
+
 	return cmd
 }
 
 func newListCmd() *cobra.Command {
+	var long, showHidden, showAliases bool
+	var expiring, order string
+
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all passwords",
-		Args:  cobra.NoArgs,
+		Long: "List all entries. With --expiring only entries whose 'expires: YYYY-MM-DD' date has " +
+			"passed or falls within the given time, such as 30d, are listed, soonest first.\n\n" +
+			"Entries with a 'hidden: true' line are left out unless --show-hidden is given, and " +
+			"aliases unless --aliases is given, which lists them as 'ALIAS -> ENTRY'. If " +
+			"your private key is unavailable or only your public key is loaded, only the entry names " +
+			"are listed.\n\n" +
+			"Entries are sorted by name, naturally in your locale so that web10 follows web9, with " +
+			"folders before the entries next to them. --sort modified and --sort accessed list the " +
+			"most recently changed or read entries first.",
+		Example: "  passh list\n" +
+			"  passh list --long --sort accessed\n" +
+			"  passh list --expiring 30d",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{keysAnnotation: keysLazy, readOnlyAnnotation: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkSortOrder(order); err != nil {
+				return err
+			}
+			if expiring != "" && cmd.Flags().Changed("sort") {
+				return fmt.Errorf("cannot combine --sort with --expiring, which sorts by expiry date")
+			}
+			var window time.Duration
+			if expiring != "" {
+				var err error
+				if window, err = parseDuration(expiring); err != nil {
+					return fmt.Errorf("invalid --expiring: %w", err)
+				}
+			}
+
 			store, err := getStore(cmd)
 			if err != nil {
 				return err
 			}
+			defer store.Close()
 
-			entries, err := store.List()
+			// Only the names can be listed without keys
+			var index *storage.Index
+			if expiring != "" || long || order != sortName {
+				if err := loadKeys(cmd); err != nil {
+					return err
+				}
+				if !canDecrypt(cmd) {
+					return fmt.Errorf("--long, --expiring and --sort read the index: %w", crypto.ErrNoPrivateKey)
+				}
+				index, err = store.Index()
+			} else {
+				index, err = listingIndex(cmd, store)
+			}
 			if err != nil {
 				return err
 			}
+			if !showHidden {
+				index = index.WithoutHidden()
+			}
+			aliases := index
+			index = index.WithoutAliases()
+
+			if expiring != "" {
+				closePager := pageOutput(cmd)
+				printExpiring(cmd.OutOrStdout(), index, time.Now(), window)
+				closePager()
+				return nil
+			}
+			names := index.Names()
+			sortEntries(cmd, index, names, order)
+			if long {
+				// Read before paging, as it may warn
+				access := loadAccessRecords(cmd)
+				closePager := pageOutput(cmd)
+				printLongList(cmd.OutOrStdout(), index, names, access)
+				closePager()
+				return nil
+			}
 
-			for _, entry := range entries {
-				fmt.Println(entry)
+			closePager := pageOutput(cmd)
+			now := time.Now()
+			for _, entry := range names {
+				fmt.Fprintln(cmd.OutOrStdout(), formatEntry(index, entry, now))
 			}
+			if showAliases {
+				printAliases(cmd.OutOrStdout(), aliases)
+			}
+			closePager()
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVarP(&long, "long", "l", false, "Show modification time, last access and read count")
+	cmd.Flags().StringVar(&expiring, "expiring", "", "Only list entries expired or expiring within this time, such as 30d")
+	cmd.Flags().BoolVar(&showHidden, "show-hidden", false, "Also list entries marked 'hidden: true'")
+	cmd.Flags().BoolVar(&showAliases, "aliases", false, "Also list aliases, after the entries")
+	cmd.Flags().StringVar(&order, "sort", sortName, "Sort by name, modified or accessed")
+
 	return cmd
 }
 
 func newDeleteCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "delete NAME",
-		Short: "Delete a password",
-		Long:  "Delete a stored password entry",
-		Args:  cobra.ExactArgs(1),
+	var recursive, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "delete NAME|PATTERN...",
+		Short: "Delete passwords",
+		Long: "Delete stored password entries. Each argument is an entry name or a glob pattern, " +
+			"where * and ? match within one folder level, such as 'web/old-*'; quote patterns so " +
+			"the shell doesn't expand them. With --recursive, folders and the folders patterns " +
+			"match are deleted with every entry in them.\n\n" +
+			"The entries are listed and deleted after a single confirmation. --dry-run only lists them.",
+		Example: "  passh delete web/github\n" +
+			"  passh delete 'web/old-*' --dry-run\n" +
+			"  passh delete --recursive archive/2023",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeEntries,
+		Annotations:       map[string]string{dryRunAnnotation: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun := isDryRun(cmd)
 			store, err := getStore(cmd)
 			if err != nil {
 				return err
 			}
+			defer store.Close()
 
-			name := args[0]
-
-			// Check if password exists first
-			_, err = store.Get(name)
+			all, err := store.List()
+			if err != nil {
+				return err
+			}
+			names, err := matchEntries(all, args, recursive)
 			if err != nil {
-				return fmt.Errorf("password '%s' not found: %w", name, err)
+				return err
 			}
 
-			// Ask for confirmation before deleting
-			fmt.Printf("Are you sure you want to delete password '%s'? (y/N): ", name)
-			var response string
-			if _, err := fmt.Scanln(&response); err != nil {
-				if err.Error() != "unexpected newline" {
-					fmt.Printf("Error reading input: %v\n", err)
+			// A single entry named outright is confirmed by name, as before
+			if len(names) == 1 && names[0] == strings.Trim(args[0], "/") && len(args) == 1 {
+				if dryRun {
+					fmt.Fprintf(cmd.OutOrStdout(), "Would delete %s\n", names[0])
+					return nil
+				}
+				if !yes && !confirm(cmd, fmt.Sprintf("Are you sure you want to delete password '%s'?", names[0])) {
+					logging.Infof("Deletion cancelled")
+					return nil
+				}
+				if err := store.Delete(names[0]); err != nil {
+					return err
 				}
-				// Default to "n" for empty or error
-				response = "n"
+				logging.Infof("Deleted password '%s'", names[0])
+				return nil
 			}
 
-			if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
-				fmt.Println("Deletion cancelled")
+			verb := "Deleting"
+			if dryRun {
+				verb = "Would delete"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %d entries:\n", verb, len(names))
+			for _, name := range names {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", name)
+			}
+			if dryRun {
 				return nil
 			}
-
-			// Proceed with deletion
-			if err := store.Delete(name); err != nil {
-				return err
+			if !yes && !confirm(cmd, fmt.Sprintf("Delete these %d entries?", len(names))) {
+				logging.Infof("Deletion cancelled")
+				return nil
 			}
 
-			fmt.Printf("Deleted password '%s'\n", name)
+			for i, name := range names {
+				if err := store.Delete(name); err != nil {
+					return fmt.Errorf("deleted %d of %d entries: %w", i, len(names), err)
+				}
+			}
+			logging.Infof("Deleted %d entries", len(names))
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Also delete folders with every entry in them")
+	cmd.Flags().BoolP("dry-run", "n", false, "Only list the entries that would be deleted")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete without asking")
+
+	return cmd
+}
+
+// matchEntries returns the names matched by each of the arguments of delete:
+// an entry name or a glob pattern, and with recursive also the entries in
+// the folders they name or match. Arguments matching nothing are an error.
+func matchEntries(names, patterns []string, recursive bool) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+
+		matched, folder := false, false
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				selected[name] = true
+				matched = true
+				continue
+			}
+			// Folders are matched by the names of the entries below them
+			for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+				if ok, _ := path.Match(pattern, dir); ok {
+					folder = true
+					if recursive {
+						selected[name] = true
+						matched = true
+					}
+					break
+				}
+			}
+		}
+		if !matched && folder {
+			return nil, fmt.Errorf("'%s' is a folder; use --recursive to delete the entries in it", pattern)
+		}
+		if !matched {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, pattern)
+		}
+	}
+
+	result := make([]string, 0, len(selected))
+	for name := range selected {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
 }
 
 func newGenerateCmd() *cobra.Command {
 	var length int
 	var noSymbols bool
+	var noSave bool
+	var count int
+	var clip bool
 
 	cmd := &cobra.Command{
-		Use:   "generate [name]",
+		Use:   "generate [NAME]",
 		Short: "Generate a password",
-		Args:  cobra.ExactArgs(1),
+		Long: "Generate a random password, save it as NAME and print it.\n\n" +
+			"With --no-save no NAME is given and the store is left alone; --count prints several " +
+			"candidates to choose from. --clip copies the password to the clipboard instead of printing it.",
+		Example: "  passh generate web/github\n" +
+			"  passh generate --no-save --count 5 --length 24",
+		Annotations: map[string]string{keysAnnotation: keysLazy},
+		Args:        cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			name := args[0]
-
-			// Character sets for password generation
-			lowerChars := "abcdefghijklmnopqrstuvwxyz"
-			upperChars := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-			numberChars := "0123456789"
-			symbolChars := "!@#$%^&*()-_=+[]{}|;:,.<>?"
-
-			charset := lowerChars + upperChars + numberChars
-			if !noSymbols {
-				charset += symbolChars
+			switch {
+			case noSave && len(args) > 0:
+				return fmt.Errorf("--no-save takes no NAME")
+			case !noSave && len(args) == 0:
+				return fmt.Errorf("NAME is required unless --no-save is given")
+			case count < 1:
+				return fmt.Errorf("--count must be at least 1")
+			case count > 1 && !noSave:
+				return fmt.Errorf("--count can only be used with --no-save")
+			case count > 1 && clip:
+				return fmt.Errorf("cannot combine --count with --clip")
 			}
 
-			// Generate the password
-			passwordBytes := make([]byte, length)
-			for i := 0; i < length; i++ {
-				n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-				if err != nil {
-					return fmt.Errorf("failed to generate random number: %w", err)
+			if noSave {
+				for i := 0; i < count; i++ {
+					password, err := generateRandomPassword(length, !noSymbols)
+					if err != nil {
+						return err
+					}
+					if clip {
+						err = copyToClipboard(cmd, "generated password", password, false)
+					} else {
+						printSecret(cmd, password)
+					}
+					secure.Wipe(password)
+					if err != nil {
+						return err
+					}
 				}
-				passwordBytes[i] = charset[n.Int64()]
+				return nil
 			}
-			password := []byte(string(passwordBytes))
 
-			// Save the password
+			name := args[0]
+
+			password, err := generateRandomPassword(length, !noSymbols)
+			if err != nil {
+				return err
+			}
+			defer secure.Wipe(password)
+
+			// Keys are only deferred for --no-save; saving needs them to pick
+			// the recipients, check the policy and sign
+			if _, err := resolvedEncryptor(cmd); err != nil {
+				return err
+			}
 			store, err := getStore(cmd)
 			if err != nil {
 				return err
 			}
+			defer store.Close()
 
 			if err := store.Add(name, password); err != nil {
 				return err
 			}
 
-			fmt.Println(string(password))
+			if clip {
+				return copyToClipboard(cmd, name, password, false)
+			}
+			printSecret(cmd, password)
 			return nil
 		},
 	}
 
 	cmd.Flags().IntVarP(&length, "length", "l", 16, "Password length")
 	cmd.Flags().BoolVarP(&noSymbols, "no-symbols", "n", false, "Don't include symbols in the password")
+	cmd.Flags().BoolVar(&noSave, "no-save", false, "Only print the password, without saving it")
+	cmd.Flags().IntVar(&count, "count", 1, "Number of passwords to print with --no-save")
+	cmd.Flags().BoolVarP(&clip, "clip", "c", false, "Copy the password to the clipboard instead of printing it")
 
 	return cmd
 }
+
+// generateRandomPassword creates a random password of the given length,
+// optionally including symbol characters
+func generateRandomPassword(length int, symbols bool) ([]byte, error) {
+	// Character sets for password generation
+	lowerChars := "abcdefghijklmnopqrstuvwxyz"
+	upperChars := "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numberChars := "0123456789"
+	symbolChars := "!@#$%^&*()-_=+[]{}|;:,.<>?"
+
+	charset := lowerChars + upperChars + numberChars
+	if symbols {
+		charset += symbolChars
+	}
+
+	password := make([]byte, length)
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random number: %w", err)
+		}
+		password[i] = charset[n.Int64()]
+	}
+
+	return password, nil
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/rejoice4156/passh/pkg/logging"
 )
 
 func TestRootCommand(t *testing.T) {
@@ -40,7 +43,7 @@ func TestSubCommands(t *testing.T) {
 	cmd := NewRootCmd()
 
 	// Updated to include the new setup command
-	subCommands := []string{"add", "get", "list", "delete", "generate", "setup"}
+	subCommands := []string{"add", "update", "get", "list", "delete", "generate", "setup", "verify"}
 	for _, name := range subCommands {
 		found := false
 		for _, subCmd := range cmd.Commands() {
@@ -271,3 +274,73 @@ func TestDeleteConfirmation(t *testing.T) {
 		t.Error("Delete confirmation incorrectly confirmed for empty string")
 	}
 }
+
+func TestMatchEntries(t *testing.T) {
+	names := []string{"web/github", "web/old-forum", "web/old-mail", "archive/2023/bank", "archive/2023/mail", "bank"}
+
+	tests := []struct {
+		patterns  []string
+		recursive bool
+		expected  []string
+	}{
+		{[]string{"bank"}, false, []string{"bank"}},
+		{[]string{"web/old-*"}, false, []string{"web/old-forum", "web/old-mail"}},
+		{[]string{"archive/2023"}, true, []string{"archive/2023/bank", "archive/2023/mail"}},
+		{[]string{"arch*"}, true, []string{"archive/2023/bank", "archive/2023/mail"}},
+		{[]string{"bank", "web/github/"}, false, []string{"bank", "web/github"}},
+	}
+	for _, tt := range tests {
+		matched, err := matchEntries(names, tt.patterns, tt.recursive)
+		if err != nil {
+			t.Fatalf("matchEntries(%v) failed: %v", tt.patterns, err)
+		}
+		if !reflect.DeepEqual(matched, tt.expected) {
+			t.Errorf("matchEntries(%v) = %v, want %v", tt.patterns, matched, tt.expected)
+		}
+	}
+
+	if _, err := matchEntries(names, []string{"archive"}, false); err == nil || !strings.Contains(err.Error(), "--recursive") {
+		t.Errorf("Expected a folder without --recursive to fail, got %v", err)
+	}
+	if _, err := matchEntries(names, []string{"web/new-*"}, true); err == nil {
+		t.Error("Expected an error for a pattern matching nothing")
+	}
+	if _, err := matchEntries(names, []string{"web/["}, false); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer logging.SetLevel(logging.LevelInfo)
+
+	tests := []struct {
+		quiet, verbose, debug bool
+		expected              logging.Level
+	}{
+		{false, false, false, logging.LevelInfo},
+		{true, false, false, logging.LevelQuiet},
+		{false, true, false, logging.LevelVerbose},
+		{false, true, true, logging.LevelDebug},
+	}
+	for _, test := range tests {
+		if err := setLogLevel(test.quiet, test.verbose, test.debug); err != nil {
+			t.Fatalf("setLogLevel failed: %v", err)
+		}
+		if logging.GetLevel() != test.expected {
+			t.Errorf("Expected level %d, got %d", test.expected, logging.GetLevel())
+		}
+	}
+
+	if err := setLogLevel(true, true, false); err == nil {
+		t.Error("Expected --quiet with --verbose to be rejected")
+	}
+}
+
+func TestDryRunRefusedByOtherCommands(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"--dry-run", "recovery", "use", "web/example"})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "does not support --dry-run") {
+		t.Errorf("Expected --dry-run to be refused, got %v", err)
+	}
+}
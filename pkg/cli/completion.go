@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+// addCompletionCmd sets up cobra's completion command with an install
+// subcommand. None of them use the store or keys.
+func addCompletionCmd(rootCmd *cobra.Command) {
+	rootCmd.InitDefaultCompletionCmd()
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() != "completion" {
+			continue
+		}
+		cmd.AddCommand(newCompletionInstallCmd())
+		for _, sub := range cmd.Commands() {
+			sub.Annotations = map[string]string{keysAnnotation: keysNone}
+		}
+	}
+}
+
+func newCompletionInstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "install [bash|zsh|fish]",
+		Short: "Install shell completion for your shell",
+		Long: "Write the completion script for SHELL, or the shell in $SHELL, where the shell loads " +
+			"it for new sessions:\n\n" +
+			"  bash  $XDG_DATA_HOME/bash-completion/completions/passh, loaded by bash-completion\n" +
+			"  zsh   $XDG_DATA_HOME/zsh/site-functions/_passh, which must be in $fpath\n" +
+			"  fish  $XDG_CONFIG_HOME/fish/completions/passh.fish\n\n" +
+			"$XDG_DATA_HOME defaults to ~/.local/share and $XDG_CONFIG_HOME to ~/.config. Run it " +
+			"again after upgrading passh.",
+		Example: "  passh completion install\n" +
+			"  passh completion install zsh",
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			shell := ""
+			if len(args) == 1 {
+				shell = args[0]
+			} else if shell = filepath.Base(os.Getenv("SHELL")); shell == "." {
+				return fmt.Errorf("can't tell your shell from $SHELL; give it as an argument")
+			}
+
+			path, err := completionPath(shell)
+			if err != nil {
+				return err
+			}
+			var script bytes.Buffer
+			if err := writeCompletion(cmd.Root(), shell, &script); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create completion directory: %w", err)
+			}
+			if err := os.WriteFile(path, script.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write completion script: %w", err)
+			}
+			logging.Infof("Installed %s completion to %s", shell, path)
+
+			switch shell {
+			case "bash":
+				logging.Infof("It is loaded in new shells if the bash-completion package is installed")
+			case "zsh":
+				if !zshrcMentions(filepath.Dir(path)) {
+					logging.Infof("Add this line to ~/.zshrc before compinit is called, then start a new shell:\n"+
+						"  fpath=(%s $fpath)", filepath.Dir(path))
+				} else {
+					logging.Infof("Start a new shell to use it")
+				}
+			case "fish":
+				logging.Infof("Start a new shell to use it")
+			}
+			return nil
+		},
+	}
+}
+
+// completionPath returns where a shell loads user completion scripts from
+func completionPath(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(home, ".config")
+	}
+
+	switch shell {
+	case "bash":
+		return filepath.Join(dataDir, "bash-completion", "completions", "passh"), nil
+	case "zsh":
+		return filepath.Join(dataDir, "zsh", "site-functions", "_passh"), nil
+	case "fish":
+		return filepath.Join(configDir, "fish", "completions", "passh.fish"), nil
+	case "powershell", "pwsh":
+		return "", fmt.Errorf("PowerShell has no completion directory; add 'passh completion powershell | Out-String | Invoke-Expression' to your $PROFILE")
+	}
+	return "", fmt.Errorf("unsupported shell '%s', expected bash, zsh or fish", shell)
+}
+
+// writeCompletion writes the completion script of a shell
+func writeCompletion(rootCmd *cobra.Command, shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(w, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(w)
+	case "fish":
+		return rootCmd.GenFishCompletion(w, true)
+	}
+	return fmt.Errorf("unsupported shell '%s'", shell)
+}
+
+// zshrcMentions reports whether ~/.zshrc, or the one in $ZDOTDIR, already
+// refers to dir, so it is likely in $fpath
+func zshrcMentions(dir string) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	rcDir := os.Getenv("ZDOTDIR")
+	if rcDir == "" {
+		rcDir = home
+	}
+	data, err := os.ReadFile(filepath.Join(rcDir, ".zshrc"))
+	if err != nil {
+		return false
+	}
+	rc := string(data)
+	return strings.Contains(rc, dir) || strings.Contains(rc, strings.Replace(dir, home, "~", 1)) ||
+		strings.Contains(rc, strings.Replace(dir, home, "$HOME", 1))
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompletionInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("SHELL", "/usr/bin/fish")
+
+	for args, path := range map[string]string{
+		"bash": ".local/share/bash-completion/completions/passh",
+		"zsh":  ".local/share/zsh/site-functions/_passh",
+		"":     ".config/fish/completions/passh.fish",
+	} {
+		cmd := NewRootCmd()
+		cmd.SetArgs(append([]string{"completion", "install"}, strings.Fields(args)...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("completion install %s failed: %v", args, err)
+		}
+		script, err := os.ReadFile(filepath.Join(home, path))
+		if err != nil {
+			t.Fatalf("Expected a completion script at %s: %v", path, err)
+		}
+		if !bytes.Contains(script, []byte("passh")) {
+			t.Errorf("Unexpected completion script at %s", path)
+		}
+	}
+
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"completion", "install", "tcsh"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("Expected an unsupported shell to fail")
+	}
+}
+
+func TestCompletionNeedsNoKeys(t *testing.T) {
+	// No SSH keys in an empty home
+	t.Setenv("HOME", t.TempDir())
+
+	// The script is written to os.Stdout as it was when the command was made
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"completion", "zsh", "--no-descriptions"})
+	if err := cmd.Execute(); err != nil {
+		t.Errorf("completion zsh failed: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show or change configuration",
+		Long:  "Show or change settings in the passh config file (~/.config/passh/config)",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "list",
+			Short:   "List all settings",
+			Example: "  passh config list",
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig(cmd)
+				if err != nil {
+					return err
+				}
+				for _, key := range cfg.Keys() {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s = %s\n", key, cfg.Get(key))
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "get KEY",
+			Short:   "Print a setting",
+			Example: "  passh config get clip.timeout",
+			Args:    cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig(cmd)
+				if err != nil {
+					return err
+				}
+				value, ok := cfg.Lookup(args[0])
+				if !ok {
+					return fmt.Errorf("setting '%s' is not set", args[0])
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), value)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "set KEY VALUE",
+			Short: "Change a setting",
+			Example: "  passh config set clip.timeout 20s\n" +
+				"  passh config set sync.remote ssh://user@host/srv/passh",
+			Args: cobra.ExactArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig(cmd)
+				if err != nil {
+					return err
+				}
+				cfg.Set(args[0], args[1])
+				return cfg.Save()
+			},
+		},
+		&cobra.Command{
+			Use:     "unset KEY",
+			Short:   "Remove a setting",
+			Example: "  passh config unset clip.timeout",
+			Args:    cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig(cmd)
+				if err != nil {
+					return err
+				}
+				cfg.Unset(args[0])
+				return cfg.Save()
+			},
+		},
+	)
+
+	return cmd
+}
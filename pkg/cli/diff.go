@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCmd() *cobra.Command {
+	var (
+		content bool
+		remote  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diff [REV1 [REV2]]",
+		Short: "Show which entries changed",
+		Long: "Show the entries added, removed or modified between two states of the store, with " +
+			"their modification times.\n\n" +
+			"Without arguments the store is compared to the last sync with sync.remote (or --remote). " +
+			"With one git revision the store is compared to that revision, and with two the revisions " +
+			"are compared to each other; this needs a local store kept in git.\n\n" +
+			"With --content the decrypted changes are shown as well. The last sync point only records " +
+			"hashes, so --content needs git revisions.",
+		Example: "  passh diff\n" +
+			"  passh diff HEAD~3 --content\n" +
+			"  passh diff v1 v2",
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			var old, new map[string]storage.Version
+			if len(args) == 0 {
+				old, err = syncPoint(cmd, remote)
+			} else {
+				old, err = gitRevision(store, args[0])
+			}
+			if err != nil {
+				return err
+			}
+			if len(args) == 2 {
+				new, err = gitRevision(store, args[1])
+			} else {
+				new, err = store.Versions()
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, change := range storage.Diff(old, new) {
+				if err := printChange(cmd.OutOrStdout(), store, change, content); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&content, "content", false, "Show the decrypted changes")
+	cmd.Flags().StringVar(&remote, "remote", "", "Compare to the last sync with this remote (default: sync.remote setting)")
+
+	return cmd
+}
+
+// syncPoint returns the entries as of the last sync with a remote
+func syncPoint(cmd *cobra.Command, remote string) (map[string]storage.Version, error) {
+	if remote == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
+		remote = cfg.Get("sync.remote")
+	}
+	if remote == "" {
+		return nil, fmt.Errorf("no remote to compare with; pass git revisions or --remote, or set sync.remote")
+	}
+
+	storeDir, _ := cmd.Flags().GetString("store")
+	path, err := syncStatePath(storeDir, remote)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadSyncState(path)
+	if err != nil {
+		return nil, err
+	}
+	if state.Entries == nil {
+		return nil, fmt.Errorf("the store was never synced with %s", remote)
+	}
+	return state.Versions(), nil
+}
+
+// gitRevision returns the entries of the store as of a git revision
+func gitRevision(store *storage.Store, rev string) (map[string]storage.Version, error) {
+	dir, ok := storage.LocalDir(store.Backend())
+	if !ok {
+		return nil, fmt.Errorf("git revisions can only be compared for a local store")
+	}
+	return storage.GitVersions(dir, rev)
+}
+
+// printChange prints one changed entry with its modification times, and with
+// content its decrypted changes
+func printChange(out io.Writer, store *storage.Store, change storage.Change, content bool) error {
+	label := map[storage.ChangeKind]string{
+		storage.Added:    "added",
+		storage.Removed:  "removed",
+		storage.Modified: "modified",
+	}[change.Kind]
+
+	var oldSecret, newSecret []byte
+	var oldMeta, newMeta storage.Metadata
+	var err error
+	if change.Old.Data != nil {
+		if oldSecret, oldMeta, err = store.Open(change.Name, change.Old); err != nil {
+			return err
+		}
+		defer secure.Wipe(oldSecret)
+	}
+	if change.New.Data != nil {
+		if newSecret, newMeta, err = store.Open(change.Name, change.New); err != nil {
+			return err
+		}
+		defer secure.Wipe(newSecret)
+	}
+
+	// Stores with encrypted names compare file names
+	name := store.EntryName(change.Name)
+	for _, meta := range []storage.Metadata{oldMeta, newMeta} {
+		if meta.Name != "" {
+			name = meta.Name
+		}
+	}
+
+	var times []string
+	if !oldMeta.Modified.IsZero() {
+		times = append(times, oldMeta.Modified.Local().Format(timeFormat))
+	}
+	if !newMeta.Modified.IsZero() {
+		times = append(times, newMeta.Modified.Local().Format(timeFormat))
+	}
+	if len(times) > 0 {
+		fmt.Fprintf(out, "%-8s %s (%s)\n", label, name, strings.Join(times, " -> "))
+	} else {
+		fmt.Fprintf(out, "%-8s %s\n", label, name)
+	}
+
+	if !content {
+		return nil
+	}
+	if change.Kind != storage.Added && change.Old.Data == nil {
+		return fmt.Errorf("the previous content of '%s' is not known; compare git revisions for --content", name)
+	}
+	for _, line := range diffLines(splitLines(oldSecret), splitLines(newSecret)) {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+	return nil
+}
+
+// splitLines splits an entry into lines
+func splitLines(secret []byte) []string {
+	if len(secret) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(secret), "\n"), "\n")
+}
+
+// diffLines returns the lines of old and new prefixed with "-" if removed,
+// "+" if added and " " if unchanged, using a longest common subsequence
+func diffLines(old, new []string) []string {
+	// common[i][j] is the length of the longest common subsequence of
+	// old[i:] and new[j:]
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			lines = append(lines, " "+old[i])
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, "-"+old[i])
+			i++
+		default:
+			lines = append(lines, "+"+new[j])
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		lines = append(lines, "-"+old[i])
+	}
+	for ; j < len(new); j++ {
+		lines = append(lines, "+"+new[j])
+	}
+	return lines
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	old := splitLines([]byte("hunter2\nuser: alice\nurl: https://example.com\n"))
+	new := splitLines([]byte("correct horse\nuser: alice\nurl: https://example.com\nnote: rotated"))
+
+	expected := []string{
+		"-hunter2",
+		"+correct horse",
+		" user: alice",
+		" url: https://example.com",
+		"+note: rotated",
+	}
+	if lines := diffLines(old, new); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+
+	if lines := diffLines(nil, []string{"added"}); !reflect.DeepEqual(lines, []string{"+added"}) {
+		t.Errorf("Unexpected diff of an added entry: %q", lines)
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newDocsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "docs",
+		Short:       "Generate documentation for packaging",
+		Annotations: map[string]string{keysAnnotation: keysNone},
+	}
+
+	var dir string
+	man := &cobra.Command{
+		Use:   "man",
+		Short: "Write a man page for every command",
+		Long: "Write man pages for passh and each of its commands to --dir, such as passh.1 and " +
+			"passh-sync.1, from the same descriptions and examples as --help. Install them into " +
+			"a man1 directory.\n\n" +
+			"Pages are dated $SOURCE_DATE_EPOCH if it is set, for reproducible builds, and " +
+			"otherwise the build date.",
+		Example: "  passh docs man --dir ./man\n" +
+			"  man ./man/passh-sync.1",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create man page directory: %w", err)
+			}
+
+			build := currentBuild()
+			header := &doc.GenManHeader{
+				Section: "1",
+				Source:  "passh " + build.Version,
+				Manual:  "passh Manual",
+			}
+			// cobra reads SOURCE_DATE_EPOCH itself when no date is given
+			if _, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); !ok {
+				if built, err := time.Parse(time.RFC3339, build.Date); err == nil {
+					header.Date = &built
+				}
+			}
+
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			manDescriptions(root)
+			if err := doc.GenManTree(root, header, dir); err != nil {
+				return fmt.Errorf("failed to write man pages: %w", err)
+			}
+			logging.Infof("Wrote man pages to %s", dir)
+			return nil
+		},
+	}
+	man.Flags().StringVar(&dir, "dir", "man", "Directory to write the pages to")
+
+	cmd.AddCommand(man, newDocsPackagingCmd())
+
+	return cmd
+}
+
+// manDescriptions prepares the descriptions of cmd and its subcommands for
+// man pages. Lines indented by two spaces, such as examples and tables in
+// --help, are indented further to keep them as they are instead of being
+// filled into paragraphs.
+func manDescriptions(cmd *cobra.Command) {
+	lines := strings.Split(cmd.Long, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "  ") {
+			lines[i] = "  " + line
+		}
+	}
+	cmd.Long = strings.Join(lines, "\n")
+	for _, sub := range cmd.Commands() {
+		manDescriptions(sub)
+	}
+}
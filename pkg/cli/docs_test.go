@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestDocsMan(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	dir := filepath.Join(t.TempDir(), "man")
+
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"docs", "man", "--dir", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("docs man failed: %v", err)
+	}
+
+	page, err := os.ReadFile(filepath.Join(dir, "passh-batch.1"))
+	if err != nil {
+		t.Fatalf("Expected a page for batch: %v", err)
+	}
+	for _, expected := range []string{`.TH "PASSH-BATCH" "1" "Nov 2023"`, ".SH EXAMPLE", "passh batch < changes.txt", ".EX\nadd NAME PASSWORD"} {
+		if !strings.Contains(string(page), expected) {
+			t.Errorf("Expected the page to contain %q", expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "passh-ssh-askpass.1")); err == nil {
+		t.Error("Expected no pages for hidden commands")
+	}
+}
+
+// TestCommandExamples checks that every command has examples, and that they
+// use commands, flags and arguments that exist
+func TestCommandExamples(t *testing.T) {
+	root := NewRootCmd()
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+		// cobra's own completion commands come with their help
+		generated := cmd.HasParent() && cmd.Parent().Name() == "completion" && cmd.Name() != "install"
+		if !cmd.Runnable() || !cmd.IsAvailableCommand() || generated {
+			return
+		}
+		if cmd.Example == "" {
+			t.Errorf("%s has no Example", cmd.CommandPath())
+			return
+		}
+
+		for _, line := range strings.Split(cmd.Example, "\n") {
+			i := strings.Index(line, "passh ")
+			if i < 0 {
+				continue
+			}
+			command := line[i:]
+			for _, end := range []string{" | ", " > ", " < ", " && ", " &", ")"} {
+				command, _, _ = strings.Cut(command, end)
+			}
+			args := splitExample(command)[1:]
+
+			// Examples may run other commands first, such as config set
+			found, rest, err := root.Find(args)
+			if err != nil {
+				t.Errorf("%s: example %q: %v", cmd.CommandPath(), line, err)
+				continue
+			}
+			if err := found.ParseFlags(rest); err != nil {
+				t.Errorf("%s: example %q: %v", cmd.CommandPath(), line, err)
+				continue
+			}
+			if err := found.ValidateArgs(found.Flags().Args()); err != nil {
+				t.Errorf("%s: example %q: %v", cmd.CommandPath(), line, err)
+			}
+			// Parsed flags are kept by the command, so reset them
+			found.Flags().VisitAll(func(flag *pflag.Flag) {
+				flag.Value.Set(flag.DefValue)
+				flag.Changed = false
+			})
+		}
+	}
+	walk(root)
+}
+
+// splitExample splits an example command line into arguments, honoring
+// single and double quotes
+func splitExample(line string) []string {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
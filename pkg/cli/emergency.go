@@ -0,0 +1,401 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// emergencyGrant records an emergency bundle handed to a trusted contact
+type emergencyGrant struct {
+	ID        string     `json:"id"`
+	Recipient string     `json:"recipient"`
+	File      string     `json:"file"`
+	Created   time.Time  `json:"created"`
+	NotBefore time.Time  `json:"not_before,omitempty"`
+	Entries   []string   `json:"entries"`
+	Revoked   *time.Time `json:"revoked,omitempty"`
+}
+
+func newEmergencyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "emergency",
+		Short: "Give a trusted contact delayed access to selected entries",
+		Long: "Export selected entries into a bundle encrypted to a trusted contact's SSH key, so they " +
+			"can access them if you are unavailable. The bundle carries an authenticated not-before " +
+			"time and 'passh emergency open' refuses to open it earlier.\n\n" +
+			"The delay is enforced by passh, not by cryptography: a contact determined to bypass it " +
+			"with modified software could do so. Only hand bundles to people you trust.\n\n" +
+			"Encryption to SSH keys is not implemented yet, so bundles are only encoded for now: " +
+			"anyone who gets hold of one, not just the contact, can read the entries in it. Store " +
+			"and hand over bundles as you would the passwords themselves.",
+	}
+
+	cmd.AddCommand(newEmergencyExportCmd(), newEmergencyListCmd(), newEmergencyRevokeCmd(), newEmergencyOpenCmd())
+
+	return cmd
+}
+
+func newEmergencyExportCmd() *cobra.Command {
+	var recipientPath string
+	var delay string
+	var output string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "export [NAME|FOLDER]...",
+		Short: "Export entries into a bundle for a trusted contact",
+		Long: "Export the given entries, or every entry under the given folders, into a bundle " +
+			"encrypted to the contact's SSH public key. The contact can open it with " +
+			"'passh emergency open' once the delay has passed.\n\n" +
+			"The bundle is not protected by the SSH key yet, only encoded, whatever the store's " +
+			"backend. Keep it as safe as the exported passwords.",
+		Example: "  passh emergency export --recipient alice.pub --delay 30d bank email/\n" +
+			"  passh emergency export --recipient alice.pub --delay 2w --all -o alice.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if recipientPath == "" {
+				return errors.New("specify the contact's public key with --recipient")
+			}
+			if !all && len(args) == 0 {
+				return errors.New("specify the entries to export, or use --all")
+			}
+
+			wait, err := parseDuration(delay)
+			if err != nil {
+				return fmt.Errorf("invalid --delay: %w", err)
+			}
+
+			fingerprint, err := publicKeyFingerprint(recipientPath)
+			if err != nil {
+				return err
+			}
+
+			recipient, err := crypto.NewSSHEncryptor(false)
+			if err != nil {
+				return fmt.Errorf("failed to create encryptor: %w", err)
+			}
+			if err := recipient.AddPublicKeyFromFile(recipientPath); err != nil {
+				return fmt.Errorf("failed to load recipient key: %w", err)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.List()
+			if err != nil {
+				return err
+			}
+			if !all {
+				names, err = selectEntries(names, args)
+				if err != nil {
+					return err
+				}
+			}
+			if len(names) == 0 {
+				return errors.New("no entries to export")
+			}
+
+			var notBefore time.Time
+			if wait > 0 {
+				notBefore = time.Now().Add(wait)
+			}
+
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			progress, finish := progressBar("Exporting")
+			store.SetProgress(progress)
+			store.SetContext(ctx)
+			data, header, err := store.ExportBundle(names, recipient, fingerprint, "emergency", notBefore, time.Time{})
+			finish()
+			if err != nil {
+				return err
+			}
+
+			if output == "" {
+				output = "passh-emergency-" + header.ID + ".json"
+			}
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+
+			grants, err := loadEmergencyGrants()
+			if err != nil {
+				return err
+			}
+			absOutput, _ := filepath.Abs(output)
+			grants = append(grants, emergencyGrant{
+				ID:        header.ID,
+				Recipient: header.Recipient,
+				File:      absOutput,
+				Created:   header.Created,
+				NotBefore: header.NotBefore,
+				Entries:   header.Entries,
+			})
+			if err := saveEmergencyGrants(grants); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Exported %d entries to '%s' (id %s)\n", len(header.Entries), output, header.ID)
+			if !header.NotBefore.IsZero() {
+				fmt.Fprintf(cmd.OutOrStdout(), "The bundle can be opened from %s\n", header.NotBefore.Local().Format("2006-01-02 15:04"))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&recipientPath, "recipient", "r", "", "SSH public key file of the trusted contact")
+	cmd.Flags().StringVarP(&delay, "delay", "d", "0", "Time before the bundle can be opened, e.g. 72h, 30d or 2w")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Bundle file to write (default: passh-emergency-ID.json)")
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Export every entry in the store")
+
+	return cmd
+}
+
+func newEmergencyListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Short:   "List emergency bundles you have exported",
+		Example: "  passh emergency list",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			grants, err := loadEmergencyGrants()
+			if err != nil {
+				return err
+			}
+			if len(grants) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No emergency bundles exported")
+				return nil
+			}
+
+			now := time.Now()
+			for _, grant := range grants {
+				status := "open"
+				switch {
+				case grant.Revoked != nil:
+					status = "revoked " + grant.Revoked.Local().Format("2006-01-02")
+				case now.Before(grant.NotBefore):
+					status = "locked until " + grant.NotBefore.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  %d entries  %s\n", grant.ID, grant.Recipient, len(grant.Entries), status)
+			}
+			return nil
+		},
+	}
+}
+
+func newEmergencyRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke ID",
+		Short: "Revoke an emergency bundle",
+		Long: "Mark an emergency bundle as revoked and delete the local bundle file if it still exists.\n\n" +
+			"A copy already handed to the contact cannot be recalled, so the entries it contains are " +
+			"listed and should be rotated.",
+		Example: "  passh emergency revoke ID",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			grants, err := loadEmergencyGrants()
+			if err != nil {
+				return err
+			}
+
+			var grant *emergencyGrant
+			for i := range grants {
+				if grants[i].ID == args[0] {
+					grant = &grants[i]
+					break
+				}
+			}
+			if grant == nil {
+				return fmt.Errorf("no emergency bundle with id '%s'", args[0])
+			}
+			if grant.Revoked != nil {
+				return fmt.Errorf("emergency bundle '%s' is already revoked", args[0])
+			}
+
+			now := time.Now().UTC()
+			grant.Revoked = &now
+			if err := saveEmergencyGrants(grants); err != nil {
+				return err
+			}
+
+			if grant.File != "" {
+				if err := os.Remove(grant.File); err == nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "Deleted '%s'\n", grant.File)
+				} else if !os.IsNotExist(err) {
+					logging.Warnf("failed to delete '%s': %v", grant.File, err)
+				}
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked emergency bundle %s\n", grant.ID)
+			fmt.Fprintln(cmd.OutOrStdout(), "Copies already given away remain readable; rotate these entries:")
+			for _, name := range grant.Entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", name)
+			}
+			return nil
+		},
+	}
+}
+
+func newEmergencyOpenCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "open FILE",
+		Short:   "Open an emergency bundle addressed to you",
+		Example: "  passh emergency open passh-emergency-ID.json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read bundle: %w", err)
+			}
+
+			encryptor, err := cmdEncryptor(cmd)
+			if err != nil {
+				return err
+			}
+			bundle, err := storage.OpenBundle(data, encryptor, time.Now())
+			if err != nil {
+				return err
+			}
+			defer bundle.Wipe()
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Emergency bundle %s created %s\n\n", bundle.Header.ID, bundle.Header.Created.Local().Format("2006-01-02 15:04"))
+			for _, name := range bundle.Header.Entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, bundle.Entries[name])
+			}
+			return nil
+		},
+	}
+}
+
+// selectEntries returns the entries matching the given names or folders
+func selectEntries(names, patterns []string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		matched := false
+		for _, name := range names {
+			if name == pattern || strings.HasPrefix(name, pattern+"/") {
+				selected[name] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no entries match '%s'", pattern)
+		}
+	}
+
+	result := make([]string, 0, len(selected))
+	for name := range selected {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// parseDuration parses a duration like time.ParseDuration, additionally
+// accepting whole days ("30d") and weeks ("2w")
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if count, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// publicKeyFingerprint returns the SHA256 fingerprint of a public key file
+func publicKeyFingerprint(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read public key file: %w", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return ssh.FingerprintSHA256(publicKey), nil
+}
+
+// emergencyGrantsPath returns the file recording exported emergency bundles
+func emergencyGrantsPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "emergency.json"), nil
+}
+
+// loadEmergencyGrants reads the exported emergency bundles
+func loadEmergencyGrants() ([]emergencyGrant, error) {
+	path, err := emergencyGrantsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read emergency grants: %w", err)
+	}
+
+	var grants []emergencyGrant
+	if err := json.Unmarshal(data, &grants); err != nil {
+		return nil, fmt.Errorf("failed to parse emergency grants: %w", err)
+	}
+	return grants, nil
+}
+
+// saveEmergencyGrants records the exported emergency bundles
+func saveEmergencyGrants(grants []emergencyGrant) error {
+	path, err := emergencyGrantsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(grants, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode emergency grants: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write emergency grants: %w", err)
+	}
+	return nil
+}
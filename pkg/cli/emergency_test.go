@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"0":   0,
+		"72h": 72 * time.Hour,
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	}
+	for input, expected := range tests {
+		got, err := parseDuration(input)
+		if err != nil {
+			t.Errorf("parseDuration(%q) failed: %v", input, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("parseDuration(%q) = %v, expected %v", input, got, expected)
+		}
+	}
+
+	for _, input := range []string{"xd", "-1d", "soon", "-5h"} {
+		if _, err := parseDuration(input); err == nil {
+			t.Errorf("Expected parseDuration(%q) to fail", input)
+		}
+	}
+}
+
+func TestSelectEntries(t *testing.T) {
+	names := []string{"bank", "email/personal", "email/work", "emails"}
+
+	selected, err := selectEntries(names, []string{"email/", "bank"})
+	if err != nil {
+		t.Fatalf("selectEntries failed: %v", err)
+	}
+	expected := []string{"bank", "email/personal", "email/work"}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Errorf("Expected %v, got %v", expected, selected)
+	}
+
+	if _, err := selectEntries(names, []string{"missing"}); err == nil {
+		t.Error("Expected an error for a pattern matching nothing")
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+)
+
+// firstLine returns the password line of an entry
+func firstLine(content []byte) []byte {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r"))
+}
+
+// parseEntryFields splits an entry into named fields. The first line is the
+// password; following "key: value" lines become fields with lower-case keys.
+// The usual aliases for the username are normalized to "username". Values
+// share content's memory, so wiping content wipes them.
+func parseEntryFields(content []byte) map[string][]byte {
+	lines := bytes.Split(bytes.TrimRight(content, "\n"), []byte("\n"))
+	fields := map[string][]byte{"password": lines[0]}
+
+	for _, line := range lines[1:] {
+		key, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok || bytes.Contains(key, []byte(" ")) {
+			continue
+		}
+		name := strings.ToLower(string(bytes.TrimSpace(key)))
+		if _, exists := fields[name]; !exists {
+			fields[name] = bytes.TrimSpace(value)
+		}
+	}
+
+	if _, ok := fields["username"]; !ok {
+		for _, alias := range []string{"user", "login", "email"} {
+			if value, ok := fields[alias]; ok {
+				fields["username"] = value
+				break
+			}
+		}
+	}
+
+	return fields
+}
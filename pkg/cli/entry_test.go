@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseEntryFields(t *testing.T) {
+	fields := parseEntryFields([]byte("hunter2\nLogin: alice\nurl: https://example.com\nautotype: {username}{enter}\nfree text here\n"))
+
+	expected := map[string]string{
+		"password": "hunter2",
+		"login":    "alice",
+		"username": "alice",
+		"url":      "https://example.com",
+		"autotype": "{username}{enter}",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fields)
+	}
+	for key, value := range expected {
+		if string(fields[key]) != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, fields[key])
+		}
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	for content, expected := range map[string]string{
+		"hunter2":                 "hunter2",
+		"hunter2\nuser: alice\n":  "hunter2",
+		"hunter2\r\nuser: alice":  "hunter2",
+		"\n-----BEGIN KEY-----\n": "",
+	} {
+		if got := string(firstLine([]byte(content))); got != expected {
+			t.Errorf("firstLine(%q) = %q, expected %q", content, got, expected)
+		}
+	}
+}
+
+func TestReadMultiline(t *testing.T) {
+	content, err := readMultiline(strings.NewReader("-----BEGIN KEY-----\nabc\n-----END KEY-----\n"))
+	if err != nil || string(content) != "-----BEGIN KEY-----\nabc\n-----END KEY-----" {
+		t.Fatalf("Unexpected content %q (%v)", content, err)
+	}
+	if _, err := readMultiline(strings.NewReader(" \n\n")); err == nil {
+		t.Fatal("Expected empty input to be rejected")
+	}
+}
+
+func TestClipboardHolds(t *testing.T) {
+	sum := sha256.Sum256([]byte("hunter2"))
+	digest := hex.EncodeToString(sum[:])
+
+	for current, expected := range map[string]bool{
+		"hunter2":   true,
+		"hunter2\n": true,
+		"hunter3":   false,
+		"":          false,
+	} {
+		if got := clipboardHolds([]byte(current), digest); got != expected {
+			t.Errorf("clipboardHolds(%q) = %v, expected %v", current, got, expected)
+		}
+	}
+}
+
+func TestPrintEntryFields(t *testing.T) {
+	var output bytes.Buffer
+	password := printEntryFields(&output, []byte("hunter2\nuser: alice\nsome notes\notpauth://totp/x?secret=AAAA\n"))
+	if string(password) != "hunter2" {
+		t.Errorf("Expected password 'hunter2', got %q", password)
+	}
+
+	if output.String() != "user:      alice\n(2 more lines, see 'passh get --full')\n" {
+		t.Fatalf("Unexpected output: %q", output.String())
+	}
+}
@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// envVarPattern matches valid environment variable names
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func newExecCmd() *cobra.Command {
+	var mappings []string
+
+	cmd := &cobra.Command{
+		Use:   "exec --env VAR=NAME... -- COMMAND [ARGS...]",
+		Short: "Run a command with passwords in its environment",
+		Long: "Run COMMAND with the password of each entry NAME in the environment variable VAR, " +
+			"instead of keeping secrets in .env files. The passwords are only given to the command, " +
+			"and passh exits with the command's exit status.",
+		Example:     "  passh exec --env DB_PASS=db/prod --env API_KEY=svc/stripe -- ./deploy.sh",
+		Args:        cobra.MinimumNArgs(1),
+		Annotations: map[string]string{cachedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(mappings) == 0 {
+				return fmt.Errorf("no variables given; use --env VAR=NAME")
+			}
+			vars, err := parseEnvMappings(mappings)
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			env := os.Environ()
+			for _, v := range vars {
+				content, err := store.Get(v.name)
+				if err != nil {
+					return err
+				}
+				recordAccess(cmd, v.name)
+				env = append(env, v.variable+"="+string(firstLine(content)))
+				secure.Wipe(content)
+			}
+
+			child := exec.Command(args[0], args[1:]...)
+			child.Env = env
+			child.Stdin = cmd.InOrStdin()
+			child.Stdout = cmd.OutOrStdout()
+			child.Stderr = cmd.ErrOrStderr()
+			return runChild(child)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&mappings, "env", "e", nil, "Set VAR to the password of entry NAME (repeatable)")
+
+	return cmd
+}
+
+func newEnvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env PREFIX",
+		Short: "Print export lines for the entries in a folder",
+		Long: "Print a shell export line for every entry in the folder PREFIX, setting a variable " +
+			"named after the rest of the entry name to its password. For example app/prod/db-pass " +
+			"becomes DB_PASS with 'passh env app/prod', and app/prod/aws/key becomes AWS_KEY.",
+		Example:     "  eval \"$(passh env app/prod)\"",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{cachedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix := strings.TrimSuffix(args[0], "/") + "/"
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.List()
+			if err != nil {
+				return err
+			}
+			vars, err := envVarsForPrefix(prefix, names)
+			if err != nil {
+				return err
+			}
+			if len(vars) == 0 {
+				return fmt.Errorf("no entries in '%s': %w", strings.TrimSuffix(prefix, "/"), storage.ErrNotFound)
+			}
+
+			out := cmd.OutOrStdout()
+			for _, v := range vars {
+				content, err := store.Get(v.name)
+				if err != nil {
+					return err
+				}
+				recordAccess(cmd, v.name)
+				fmt.Fprintf(out, "export %s=%s\n", v.variable, shellQuote(string(firstLine(content))))
+				secure.Wipe(content)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// envVar is an environment variable set from an entry's password
+type envVar struct {
+	variable string
+	name     string
+}
+
+// parseEnvMappings parses VAR=NAME flags
+func parseEnvMappings(mappings []string) ([]envVar, error) {
+	seen := make(map[string]bool, len(mappings))
+	vars := make([]envVar, 0, len(mappings))
+	for _, mapping := range mappings {
+		variable, name, ok := strings.Cut(mapping, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --env '%s'; expected VAR=NAME", mapping)
+		}
+		if !envVarPattern.MatchString(variable) {
+			return nil, fmt.Errorf("invalid environment variable name '%s'", variable)
+		}
+		if seen[variable] {
+			return nil, fmt.Errorf("environment variable '%s' is given more than once", variable)
+		}
+		seen[variable] = true
+		vars = append(vars, envVar{variable: variable, name: name})
+	}
+	return vars, nil
+}
+
+// envVarsForPrefix names a variable for every entry under prefix, sorted by
+// variable name
+func envVarsForPrefix(prefix string, names []string) ([]envVar, error) {
+	byVariable := make(map[string]string)
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		variable := envVarName(rest)
+		if other, ok := byVariable[variable]; ok {
+			return nil, fmt.Errorf("entries '%s' and '%s' would both set %s", other, name, variable)
+		}
+		byVariable[variable] = name
+	}
+
+	vars := make([]envVar, 0, len(byVariable))
+	for variable, name := range byVariable {
+		vars = append(vars, envVar{variable: variable, name: name})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].variable < vars[j].variable })
+	return vars, nil
+}
+
+// envVarName turns an entry name into an environment variable name, upper
+// case with every other character replaced by an underscore
+func envVarName(name string) string {
+	variable := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if variable[0] >= '0' && variable[0] <= '9' {
+		variable = "_" + variable
+	}
+	return variable
+}
+
+// shellQuote quotes a value for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// runChild runs a command, passing on interrupts so that it can shut down
+// cleanly while passh waits for it
+func runChild(child *exec.Cmd) error {
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", child.Args[0], err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+
+	if err := child.Wait(); err != nil {
+		return fmt.Errorf("%s: %w", child.Args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEnvMappings(t *testing.T) {
+	vars, err := parseEnvMappings([]string{"DB_PASS=db/prod", "API_KEY=svc/stripe=live"})
+	if err != nil {
+		t.Fatalf("parseEnvMappings failed: %v", err)
+	}
+	expected := []envVar{{"DB_PASS", "db/prod"}, {"API_KEY", "svc/stripe=live"}}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected %v, got %v", expected, vars)
+	}
+
+	for _, invalid := range [][]string{{"DB_PASS"}, {"DB_PASS="}, {"1X=db"}, {"DB-PASS=db"}, {"A=x", "A=y"}} {
+		if _, err := parseEnvMappings(invalid); err == nil {
+			t.Errorf("Expected %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestEnvVarsForPrefix(t *testing.T) {
+	vars, err := envVarsForPrefix("app/prod/", []string{"app/prod/db-pass", "app/prod/aws/key", "app/prod/2fa", "app/staging/db-pass", "app/production"})
+	if err != nil {
+		t.Fatalf("envVarsForPrefix failed: %v", err)
+	}
+	expected := []envVar{{"AWS_KEY", "app/prod/aws/key"}, {"DB_PASS", "app/prod/db-pass"}, {"_2FA", "app/prod/2fa"}}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected %v, got %v", expected, vars)
+	}
+
+	if _, err := envVarsForPrefix("app/", []string{"app/db-pass", "app/db_pass"}); err == nil {
+		t.Error("Expected clashing variable names to be rejected")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if quoted := shellQuote(`it's $HOME`); quoted != `'it'\''s $HOME'` {
+		t.Errorf("Unexpected quoting %s", quoted)
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variables that stand in for global flags
+const envPrefix = "PASSH_"
+
+// flagEnv returns the environment variable of a global flag, such as
+// PASSH_PUBLIC_KEY for --public-key
+func flagEnv(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// documentFlagEnv names the environment variable of each global flag in its
+// help
+func documentFlagEnv(flags *pflag.FlagSet) {
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "help" {
+			flag.Usage += fmt.Sprintf(" [$%s]", flagEnv(flag.Name))
+		}
+	})
+}
+
+// applyFlagEnv sets the global flags not given on the command line from
+// their environment variables, so containers and CI can configure passh
+// without flags
+func applyFlagEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Root().PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "help" {
+			return
+		}
+		value, ok := os.LookupEnv(flagEnv(flag.Name))
+		if !ok {
+			return
+		}
+		if setErr := flag.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid $%s: %w", flagEnv(flag.Name), setErr)
+			return
+		}
+		flag.Changed = true
+	})
+	return err
+}
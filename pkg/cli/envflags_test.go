@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func TestApplyFlagEnv(t *testing.T) {
+	root := &cobra.Command{Use: "passh"}
+	var store string
+	var noAgent bool
+	root.PersistentFlags().StringVar(&store, "store", "", "")
+	root.PersistentFlags().String("public-key", "", "")
+	root.PersistentFlags().BoolVar(&noAgent, "no-agent", false, "")
+	child := &cobra.Command{Use: "get"}
+	root.AddCommand(child)
+
+	t.Setenv("PASSH_STORE", "/srv/passh")
+	t.Setenv("PASSH_PUBLIC_KEY", "/keys/ci.pub")
+	t.Setenv("PASSH_NO_AGENT", "true")
+	if err := root.PersistentFlags().Set("public-key", "/keys/explicit.pub"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if err := applyFlagEnv(child); err != nil {
+		t.Fatalf("applyFlagEnv failed: %v", err)
+	}
+	if store != "/srv/passh" || !noAgent {
+		t.Errorf("Expected the flags to be set from the environment, got store %q and no-agent %v", store, noAgent)
+	}
+	if key, _ := root.PersistentFlags().GetString("public-key"); key != "/keys/explicit.pub" {
+		t.Errorf("Expected the command line to win over the environment, got %q", key)
+	}
+
+	t.Setenv("PASSH_NO_AGENT", "sometimes")
+	root.PersistentFlags().Lookup("no-agent").Changed = false
+	if err := applyFlagEnv(child); err == nil {
+		t.Error("Expected an invalid boolean to be rejected")
+	}
+}
+
+func TestClipTimeoutEnv(t *testing.T) {
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Set("clip.timeout", "20s")
+
+	for value, want := range map[string]time.Duration{"10": 10 * time.Second, "2m": 2 * time.Minute, "0": 0} {
+		t.Setenv("PASSH_CLIP_TIME", value)
+		if timeout, err := clipTimeout(cfg); err != nil || timeout != want {
+			t.Errorf("PASSH_CLIP_TIME=%s: expected %v, got %v (%v)", value, want, timeout, err)
+		}
+	}
+	t.Setenv("PASSH_CLIP_TIME", "soon")
+	if _, err := clipTimeout(cfg); err == nil {
+		t.Error("Expected an invalid PASSH_CLIP_TIME to be rejected")
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+// Exit codes let scripts tell common failures apart
+const (
+	// ExitError is used for any other failure, such as an unreadable store
+	ExitError = 1
+	// ExitNotFound means the entry does not exist
+	ExitNotFound = 2
+	// ExitDecryptFailed means the entry exists but the loaded keys can't decrypt it
+	ExitDecryptFailed = 3
+	// ExitNoRecipients means there is no public key to encrypt to
+	ExitNoRecipients = 4
+	// ExitInterrupted means a bulk operation was stopped with Ctrl-C, as
+	// shells report for commands killed by SIGINT
+	ExitInterrupted = 130
+)
+
+// ExitCode returns the process exit code for an error returned by a command.
+// Commands run by passh exec pass on their own exit status instead.
+func ExitCode(err error) int {
+	var childErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, storage.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, crypto.ErrDecryptFailed):
+		return ExitDecryptFailed
+	case errors.Is(err, crypto.ErrNoRecipients):
+		return ExitNoRecipients
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.As(err, &childErr) && childErr.ExitCode() > 0:
+		return childErr.ExitCode()
+	default:
+		return ExitError
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, 0},
+		{errors.New("store unreadable"), ExitError},
+		{fmt.Errorf("%w: github/personal", storage.ErrNotFound), ExitNotFound},
+		{fmt.Errorf("entry 'x': %w", crypto.ErrDecryptFailed), ExitDecryptFailed},
+		{fmt.Errorf("encryption failed: %w", crypto.ErrNoRecipients), ExitNoRecipients},
+		{fmt.Errorf("interrupted after 3 of 10 entries: %w", context.Canceled), ExitInterrupted},
+	}
+
+	if err := exec.Command("sh", "-c", "exit 7").Run(); err != nil {
+		tests = append(tests, struct {
+			err      error
+			expected int
+		}{fmt.Errorf("sh: %w", err), 7})
+	}
+
+	for _, test := range tests {
+		if got := ExitCode(test.err); got != test.expected {
+			t.Errorf("ExitCode(%v) = %d, expected %d", test.err, got, test.expected)
+		}
+	}
+}
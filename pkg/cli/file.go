@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+func newFileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "file",
+		Short: "Store encrypted files such as keyfiles or recovery code PDFs",
+		Long: "Store small binary files in the password store. Files are encrypted in chunks as they " +
+			"are read, so even large files are never held in memory as a whole.\n\n" +
+			"The chunks are sealed with a random key, which is wrapped like an entry. The ssh backend " +
+			"does not encrypt entries yet, only encodes them, so with it files are not protected either. " +
+			"Use --backend passphrase, gpg or a key service for files that must stay secret.",
+	}
+
+	cmd.AddCommand(newFileAddCmd(), newFileGetCmd(), newFileListCmd(), newFileDeleteCmd())
+
+	return cmd
+}
+
+func newFileAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add NAME PATH",
+		Short: "Encrypt a file into the store (use - to read stdin)",
+		Example: "  passh file add docs/recovery-codes ~/Downloads/recovery-codes.pdf\n" +
+			"  tar cz ~/.gnupg | passh file add backups/gnupg -",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, path := args[0], args[1]
+
+			var input io.Reader = os.Stdin
+			if path != "-" {
+				file, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("failed to open file: %w", err)
+				}
+				defer file.Close()
+				input = file
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			written, err := store.AddFile(name, input)
+			if err != nil {
+				return err
+			}
+
+			logging.Infof("Stored file '%s' (%d bytes)", name, written)
+			return nil
+		},
+	}
+}
+
+func newFileGetCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:     "get NAME",
+		Short:   "Decrypt a file from the store",
+		Example: "  passh file get docs/recovery-codes -o recovery-codes.pdf",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if output == "" || output == "-" {
+				_, err := store.GetFile(name, cmd.OutOrStdout())
+				return err
+			}
+
+			file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+
+			written, err := store.GetFile(name, file)
+			if closeErr := file.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write output file: %w", closeErr)
+			}
+			if err != nil {
+				// Don't leave a partially decrypted file behind
+				_ = os.Remove(output)
+				return err
+			}
+
+			logging.Infof("Wrote '%s' (%d bytes)", output, written)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the file here instead of to stdout (must not exist)")
+
+	return cmd
+}
+
+func newFileListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Short:   "List stored files",
+		Example: "  passh file list",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.ListFiles()
+			if err != nil {
+				return err
+			}
+
+			for _, name := range names {
+				fmt.Fprintln(cmd.OutOrStdout(), name)
+			}
+			return nil
+		},
+	}
+}
+
+func newFileDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete NAME",
+		Short:   "Delete a stored file",
+		Example: "  passh file delete docs/recovery-codes",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			// Ask for confirmation before deleting
+			if !confirm(cmd, fmt.Sprintf("Are you sure you want to delete file '%s'?", name)) {
+				logging.Infof("Deletion cancelled")
+				return nil
+			}
+
+			if err := store.DeleteFile(name); err != nil {
+				return err
+			}
+
+			logging.Infof("Deleted file '%s'", name)
+			return nil
+		},
+	}
+}
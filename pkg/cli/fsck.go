@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newFsckCmd() *cobra.Command {
+	var fix bool
+
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Find and repair damaged or stray files in the store",
+		Long: "Check the store for entry files that can't be parsed or decrypted, drift between " +
+			"the index and the entries, and, for local and ssh:// stores, empty directories, " +
+			"temporary files left behind for over an hour and files others can read. Entries " +
+			"encrypted to other keys only are skipped.\n\n" +
+			"With --fix the repairs that lose nothing are made: corrupt files are moved to " +
+			".passh/quarantine, where they can still be inspected, the index is rebuilt, empty " +
+			"directories and stale temporary files are removed and permissions are tightened. " +
+			"Entries the loaded keys fail to decrypt are only reported, as they may be fine for " +
+			"other keys.",
+		Example: "  passh fsck\n" +
+			"  passh fsck --fix",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			progress, finish := progressBar("Checking")
+			store.SetProgress(progress)
+			problems, err := store.Check(fix)
+			finish()
+
+			remaining := 0
+			for _, problem := range problems {
+				path := problem.Path
+				if path == "" {
+					path = "-"
+				} else if problem.Kind == storage.ProblemCorrupt || problem.Kind == storage.ProblemUnreadable {
+					path = store.EntryName(path)
+				}
+				status := ""
+				if problem.Fixed {
+					status = " (fixed)"
+				} else {
+					remaining++
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%-11s  %s: %s%s\n", problem.Kind, path, problem.Detail, status)
+			}
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case remaining > 0 && fix:
+				return fmt.Errorf("%d problems could not be repaired", remaining)
+			case remaining > 0:
+				return fmt.Errorf("%d problems found; run 'passh fsck --fix' to repair them", remaining)
+			case len(problems) > 0:
+				logging.Infof("Repaired %d problems", len(problems))
+			default:
+				logging.Infof("No problems found")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "Repair what can be repaired safely")
+
+	return cmd
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+func newGCCmd() *cobra.Command {
+	var keep string
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove what the store no longer needs",
+		Long: "Clean up the store: remove empty directories and temporary files left behind for over " +
+			"an hour, delete files 'passh fsck --fix' quarantined longer ago than --keep, and drop " +
+			"index entries of entries removed outside passh. Stores kept at the root of a local git " +
+			"repository are compacted with 'git gc'. The space freed is reported.\n\n" +
+			"Deleting entries already removes the directories they leave empty in local and ssh:// " +
+			"stores; gc catches the rest. Use --dry-run to see what would be removed.",
+		Example: "  passh gc --dry-run\n" +
+			"  passh gc --keep 7d",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{dryRunAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun := isDryRun(cmd)
+			retention, err := parseDuration(keep)
+			if err != nil {
+				return fmt.Errorf("invalid --keep: %w", err)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			result, err := store.GC(retention, dryRun)
+			if err != nil {
+				return err
+			}
+
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			}
+			for _, group := range []struct {
+				label string
+				paths []string
+			}{
+				{"empty directory", result.EmptyDirs},
+				{"temporary file", result.TempFiles},
+				{"quarantined file", result.Quarantined},
+				{"index entry", result.IndexEntries},
+			} {
+				for _, path := range group.paths {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s %s %s\n", verb, group.label, path)
+				}
+			}
+
+			switch {
+			case dryRun:
+				logging.Infof("Would free %s, not counting 'git gc'", formatBytes(result.Reclaimed))
+			case result.Reclaimed > 0 || len(result.EmptyDirs)+len(result.IndexEntries) > 0:
+				logging.Infof("Freed %s", formatBytes(result.Reclaimed))
+			default:
+				logging.Infof("Nothing to clean up")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&keep, "keep", "30d", "How long to keep quarantined files, e.g. 7d or 0 to remove them all")
+	cmd.Flags().BoolP("dry-run", "n", false, "Only show what would be removed")
+
+	return cmd
+}
+
+// formatBytes shows a size in bytes with a binary unit
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[prefix])
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// disableCoreDumps keeps decrypted secrets out of core files. Failing to do
+// so isn't fatal, as secrets are still wiped after use.
+func disableCoreDumps() {
+	if err := secure.DisableCoreDumps(); err != nil {
+		logging.Warnf("Failed to disable core dumps: %v", err)
+	}
+}
+
+// lockMemory locks all process memory into RAM when the security.mlockall
+// setting is on, so no decrypted secret can be written to swap
+func lockMemory(cfg *config.Config) error {
+	value := cfg.Get("security.mlockall")
+	if value == "" {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid security.mlockall: %w", err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	if err := secure.LockAll(); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			return errors.New("security.mlockall is not supported on this platform")
+		}
+		return fmt.Errorf("failed to lock memory (raise the limit with 'ulimit -l' or unset security.mlockall): %w", err)
+	}
+	logging.Debugf("locked all memory into RAM")
+	return nil
+}
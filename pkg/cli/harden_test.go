@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/config"
+)
+
+func TestLockMemorySetting(t *testing.T) {
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lockMemory(cfg); err != nil {
+		t.Errorf("Expected nothing to be locked by default: %v", err)
+	}
+	cfg.Set("security.mlockall", "false")
+	if err := lockMemory(cfg); err != nil {
+		t.Errorf("Expected nothing to be locked when disabled: %v", err)
+	}
+	cfg.Set("security.mlockall", "sometimes")
+	if err := lockMemory(cfg); err == nil {
+		t.Error("Expected an invalid setting to be rejected")
+	}
+}
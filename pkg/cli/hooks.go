@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+// hookMarker identifies pre-commit hooks written by passh, which may be
+// replaced without --force
+const hookMarker = "# Installed by 'passh hooks install-git'"
+
+// allowConfigKey is the git config key of a repository's allow-list
+const allowConfigKey = "passh.allow"
+
+func newHooksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hooks",
+		Short: "Install hooks that keep stored passwords out of other repositories",
+	}
+
+	var force bool
+	install := &cobra.Command{
+		Use:   "install-git",
+		Short: "Block commits containing stored passwords in this repository",
+		Long: "Install a git pre-commit hook in the current repository that runs " +
+			"'passh scan --staged', so commits adding the password of any of your entries are " +
+			"refused. The hook needs your keys, for example in ssh-agent; 'git commit --no-verify' " +
+			"skips it.\n\n" +
+			"Entries whose passwords belong in the repository, such as a shared test fixture, are " +
+			"allowed with 'passh hooks allow', which is kept in the repository's local git config " +
+			"and not committed.",
+		Example:     "  cd ~/src/project && passh hooks install-git",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hooksDir, err := repoGit("rev-parse", "--git-path", "hooks")
+			if err != nil {
+				return fmt.Errorf("not in a git repository: %w", err)
+			}
+			hook := filepath.Join(hooksDir, "pre-commit")
+
+			if existing, err := os.ReadFile(hook); err == nil && !bytes.Contains(existing, []byte(hookMarker)) && !force {
+				return fmt.Errorf("%s already exists; use --force to replace it, or add 'passh scan --staged' to it", hook)
+			}
+			executable, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to find passh executable: %w", err)
+			}
+
+			command := shellQuote(executable) + " --batch"
+			if storeDir, _ := cmd.Flags().GetString("store"); storeDir != "" {
+				// Keep scanning the store given at install time
+				command += " --store " + shellQuote(storeDir)
+			}
+			script := "#!/bin/sh\n" + hookMarker + "\n" +
+				"# Refuses commits containing stored passwords; allow entries with 'passh hooks allow'\n" +
+				"exec " + command + " scan --staged\n"
+			if err := os.MkdirAll(hooksDir, 0755); err != nil {
+				return fmt.Errorf("failed to create hooks directory: %w", err)
+			}
+			if err := os.WriteFile(hook, []byte(script), 0755); err != nil {
+				return fmt.Errorf("failed to write hook: %w", err)
+			}
+			logging.Infof("Installed %s", hook)
+			return nil
+		},
+	}
+	install.Flags().BoolVarP(&force, "force", "f", false, "Replace an existing pre-commit hook")
+
+	allow := &cobra.Command{
+		Use:   "allow [PATTERN...]",
+		Short: "Allow entries' passwords in this repository, or list the allowed entries",
+		Long: "Let the pre-commit hook accept the passwords of entries matching PATTERN: an entry " +
+			"name, a folder, or a glob such as 'test/*'. Without PATTERN the allowed patterns are " +
+			"listed. They are kept in the repository's local git config as " + allowConfigKey + ".",
+		Example: "  passh hooks allow 'test/*'\n" +
+			"  passh hooks allow",
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				patterns, err := allowedEntries()
+				if err != nil {
+					return err
+				}
+				for _, pattern := range patterns {
+					fmt.Fprintln(cmd.OutOrStdout(), pattern)
+				}
+				return nil
+			}
+
+			for _, pattern := range args {
+				pattern = strings.Trim(pattern, "/")
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+				}
+				if _, err := repoGit("config", "--local", "--add", allowConfigKey, pattern); err != nil {
+					return err
+				}
+				logging.Infof("Allowed '%s' in this repository", pattern)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(install, allow)
+
+	return cmd
+}
+
+// allowedEntries returns the patterns of entries allowed in the current
+// repository
+func allowedEntries() ([]string, error) {
+	output, err := repoGit("config", "--get-all", allowConfigKey)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// Exit status 1 means the key is not set
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// entryAllowed reports whether an entry matches one of the patterns: by name,
+// as a folder, or as a glob
+func entryAllowed(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok || strings.HasPrefix(name, pattern+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stagedFiles returns the repository root and the files added or changed in
+// the index, relative to it
+func stagedFiles() (string, []string, error) {
+	root, err := repoGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, fmt.Errorf("not in a git repository: %w", err)
+	}
+	output, err := repoGit("-C", root, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+	if err != nil {
+		return "", nil, err
+	}
+	var files []string
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return root, files, nil
+}
+
+// repoGit runs git in the current directory and returns its trimmed output
+func repoGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %w", message, err)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,24 @@
+package cli
+
+import "testing"
+
+func TestEntryAllowed(t *testing.T) {
+	patterns := []string{"test/*", "shared", "web/fixture"}
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"test/db", true},
+		{"shared/api", true},
+		{"shared/ci/token", true},
+		{"web/fixture", true},
+		{"web/login", false},
+		{"test/nested/db", false},
+		{"sharedkey", false},
+	}
+	for _, tt := range tests {
+		if got := entryAllowed(tt.name, patterns); got != tt.expected {
+			t.Errorf("entryAllowed(%q) = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/spf13/cobra"
+)
+
+// defaultHostKey is used by a bare --host-key
+const defaultHostKey = "/etc/ssh/ssh_host_ed25519_key"
+
+// setupHostKeyEncryptor uses an SSH host key as the identity, so servers
+// and containers can read entries encrypted to the machine
+func setupHostKeyEncryptor(cmd *cobra.Command, path string) error {
+	if err := checkHostKey(path); err != nil {
+		return err
+	}
+
+	// Host keys are never in ssh-agent and have no passphrase
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		return fmt.Errorf("failed to create encryptor: %w", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(path + ".pub"); err != nil {
+		return fmt.Errorf("failed to load host public key: %w", err)
+	}
+	if err := encryptor.AddPrivateKeyFromFile(path, nil); err != nil {
+		return fmt.Errorf("failed to load host key: %w", err)
+	}
+
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// checkHostKey makes sure a host key can be read, and that nobody but its
+// owner and group could have read or changed it
+func checkHostKey(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("host key: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("host key %s is not a file", path)
+	}
+	// Windows doesn't use permission bits
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o027 != 0 {
+		return fmt.Errorf("host key %s has insecure permissions %04o; it must not be writable by its group or accessible to other users (chmod 600 %s)",
+			path, info.Mode().Perm(), path)
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("host key %s can't be read by this user; host keys are normally only readable by root, so run passh as root or give a service account's group read access",
+			path)
+	}
+	if err != nil {
+		return fmt.Errorf("host key: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCheckHostKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not used on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ssh_host_ed25519_key")
+	if err := os.WriteFile(path, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []os.FileMode{0o600, 0o640, 0o400} {
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkHostKey(path); err != nil {
+			t.Errorf("Expected mode %04o to be accepted, got %v", mode, err)
+		}
+	}
+	for _, mode := range []os.FileMode{0o644, 0o660, 0o602} {
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkHostKey(path); err == nil {
+			t.Errorf("Expected mode %04o to be rejected", mode)
+		}
+	}
+
+	if err := checkHostKey(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing host key to be rejected")
+	}
+	if err := checkHostKey(dir); err == nil {
+		t.Error("Expected a directory to be rejected")
+	}
+}
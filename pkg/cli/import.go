@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import entries",
+	}
+
+	cmd.AddCommand(newImportBulkCmd())
+
+	return cmd
+}
+
+// bulkEntry is one entry of a bulk import file
+type bulkEntry struct {
+	Name     string            `json:"name"`
+	Password string            `json:"password"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+}
+
+func newImportBulkCmd() *cobra.Command {
+	var skipExisting, overwrite bool
+
+	cmd := &cobra.Command{
+		Use:   "bulk [FILE]",
+		Short: "Add many entries from a JSON file",
+		Long: "Add many entries in one run from a JSON array of objects with a name, a password and " +
+			"optionally fields and notes, read from FILE or standard input:\n\n" +
+			"  [{\"name\": \"web/example\", \"password\": \"hunter2\",\n" +
+			"    \"fields\": {\"username\": \"alice\", \"url\": \"https://example.com\"}}]\n\n" +
+			"Fields become 'key: value' lines after the password, followed by the notes. The whole " +
+			"file is checked before anything is written. If an entry already exists the import fails, " +
+			"unless --skip-existing keeps the existing entry or --overwrite replaces it. With " +
+			"--dry-run the file is checked and the changes listed, but nothing is written.",
+		Example: "  passh import bulk accounts.json\n" +
+			"  passh import bulk --skip-existing < accounts.json",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{dryRunAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if skipExisting && overwrite {
+				return fmt.Errorf("cannot combine --skip-existing with --overwrite")
+			}
+
+			input := cmd.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open import file: %w", err)
+				}
+				defer file.Close()
+				input = file
+			}
+			entries, err := readBulkEntries(input)
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			existing, err := store.List()
+			if err != nil {
+				return err
+			}
+			exists := make(map[string]bool, len(existing))
+			for _, name := range existing {
+				exists[name] = true
+			}
+
+			var toAdd []storage.NewEntry
+			var skipped, replaced, conflicts []string
+			for _, entry := range entries {
+				switch {
+				case !exists[entry.Name]:
+				case skipExisting:
+					skipped = append(skipped, entry.Name)
+					continue
+				case overwrite:
+					replaced = append(replaced, entry.Name)
+				default:
+					conflicts = append(conflicts, entry.Name)
+					continue
+				}
+				toAdd = append(toAdd, storage.NewEntry{Name: entry.Name, Secret: entry.secret()})
+			}
+			defer func() {
+				for _, entry := range toAdd {
+					secure.Wipe(entry.Secret)
+				}
+			}()
+			if len(conflicts) > 0 {
+				return fmt.Errorf("nothing imported; these entries already exist (use --skip-existing or --overwrite): %s",
+					strings.Join(conflicts, ", "))
+			}
+
+			if isDryRun(cmd) {
+				printImportPlan(cmd.OutOrStdout(), toAdd, replaced, skipped)
+				return nil
+			}
+
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			progress, finish := progressBar("Importing")
+			store.SetProgress(progress)
+			store.SetContext(ctx)
+			added, err := store.AddEntries(toAdd)
+			finish()
+
+			isReplaced := make(map[string]bool, len(replaced))
+			for _, name := range replaced {
+				isReplaced[name] = true
+			}
+			created := 0
+			for _, name := range added {
+				if isReplaced[name] {
+					fmt.Fprintf(cmd.OutOrStdout(), "replaced %s\n", name)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "added    %s\n", name)
+					created++
+				}
+			}
+			for _, name := range skipped {
+				fmt.Fprintf(cmd.OutOrStdout(), "skipped  %s\n", name)
+			}
+			status := "complete"
+			if errors.Is(err, context.Canceled) {
+				status = "interrupted"
+			} else if err != nil {
+				status = "failed"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Import %s: %d added, %d replaced, %d skipped, %d not imported\n",
+				status, created, len(added)-created, len(skipped), len(toAdd)-len(added))
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Keep entries that already exist")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace entries that already exist")
+
+	return cmd
+}
+
+// printImportPlan lists what a bulk import would do, for --dry-run
+func printImportPlan(out io.Writer, toAdd []storage.NewEntry, replaced, skipped []string) {
+	isReplaced := make(map[string]bool, len(replaced))
+	for _, name := range replaced {
+		isReplaced[name] = true
+	}
+	for _, entry := range toAdd {
+		if isReplaced[entry.Name] {
+			fmt.Fprintf(out, "would replace %s\n", entry.Name)
+		} else {
+			fmt.Fprintf(out, "would add     %s\n", entry.Name)
+		}
+	}
+	for _, name := range skipped {
+		fmt.Fprintf(out, "would skip    %s\n", name)
+	}
+	fmt.Fprintf(out, "Dry run: %d to add, %d to replace, %d to skip\n",
+		len(toAdd)-len(replaced), len(replaced), len(skipped))
+}
+
+// readBulkEntries parses and checks a bulk import file
+func readBulkEntries(r io.Reader) ([]bulkEntry, error) {
+	var entries []bulkEntry
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse import file: %w", err)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		switch {
+		case entry.Name == "":
+			return nil, fmt.Errorf("entry %d has no name", i+1)
+		case strings.HasPrefix(entry.Name, ".passh/"):
+			return nil, fmt.Errorf("entry '%s' is in the folder reserved for store metadata", entry.Name)
+		case seen[entry.Name]:
+			return nil, fmt.Errorf("entry '%s' is given more than once", entry.Name)
+		case entry.Password == "":
+			return nil, fmt.Errorf("entry '%s' has no password", entry.Name)
+		case strings.ContainsAny(entry.Password, "\r\n"):
+			return nil, fmt.Errorf("the password of '%s' has more than one line", entry.Name)
+		}
+		seen[entry.Name] = true
+
+		for key, value := range entry.Fields {
+			if key == "" || strings.ContainsAny(key, ": \r\n") {
+				return nil, fmt.Errorf("entry '%s' has an invalid field name '%s'", entry.Name, key)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, fmt.Errorf("field '%s' of '%s' has more than one line", key, entry.Name)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		logging.Warnf("the import file has no entries")
+	}
+	return entries, nil
+}
+
+// secret builds the content of an imported entry: the password, the fields
+// sorted by name, and the notes
+func (e bulkEntry) secret() []byte {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(e.Password)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\n%s: %s", key, e.Fields[key])
+	}
+	if notes := strings.TrimRight(e.Notes, "\n"); notes != "" {
+		b.WriteString("\n" + notes)
+	}
+	return []byte(b.String())
+}
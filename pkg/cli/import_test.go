@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadBulkEntries(t *testing.T) {
+	entries, err := readBulkEntries(strings.NewReader(`[
+		{"name": "web/example", "password": "hunter2", "fields": {"username": "alice", "url": "https://example.com"}, "notes": "created by ops\n"},
+		{"name": "wifi", "password": "correct horse"}
+	]`))
+	if err != nil {
+		t.Fatalf("readBulkEntries failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+
+	expected := "hunter2\nurl: https://example.com\nusername: alice\ncreated by ops"
+	if secret := string(entries[0].secret()); secret != expected {
+		t.Errorf("Expected %q, got %q", expected, secret)
+	}
+	if secret := string(entries[1].secret()); secret != "correct horse" {
+		t.Errorf("Expected only the password, got %q", secret)
+	}
+
+	for _, invalid := range []string{
+		`{"name": "a", "password": "b"}`,
+		`[{"name": "a", "password": "b", "extra": 1}]`,
+		`[{"name": "", "password": "b"}]`,
+		`[{"name": "a", "password": ""}]`,
+		`[{"name": "a", "password": "b"}, {"name": "a", "password": "c"}]`,
+		`[{"name": "a", "password": "b\nc"}]`,
+		`[{"name": "a", "password": "b", "fields": {"user name": "x"}}]`,
+		`[{"name": ".passh/x", "password": "b"}]`,
+	} {
+		if _, err := readBulkEntries(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+}
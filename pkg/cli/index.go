@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newIndexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Manage the store index",
+		Long: "passh keeps an encrypted index of entry names, tags and timestamps outside the store, " +
+			"so 'list' and 'find' don't decrypt every entry. It is updated whenever passh changes " +
+			"the store. Rebuild it if the store was changed by other means, such as git.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "rebuild",
+		Short:   "Rebuild the index by decrypting every entry",
+		Example: "  passh index rebuild",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			progress, finish := progressBar("Indexing")
+			store.SetProgress(progress)
+			index, err := store.RebuildIndex()
+			finish()
+			if err != nil {
+				return err
+			}
+
+			logging.Infof("Indexed %d entries", len(index.Entries))
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+func newFindCmd() *cobra.Command {
+	var showHidden, namesOnly bool
+	var order string
+
+	cmd := &cobra.Command{
+		Use:   "find QUERY",
+		Short: "Find entries by name or tag",
+		Long: "List the entries whose name contains QUERY or that have QUERY as a tag, ignoring case. " +
+			"Tags are given on a 'tags:' line of an entry, separated by commas or spaces. Entries " +
+			"with a 'hidden: true' line are only found with --show-hidden.\n\n" +
+			"With --names only the names of the entry files are searched, without the index, so " +
+			"no private key is needed. Tags are not searched and hidden entries are included.\n\n" +
+			"Matches are sorted like 'passh list', by name or with --sort by when they were last " +
+			"modified or accessed.",
+		Example: "  passh find mail\n" +
+			"  passh find work --sort modified\n" +
+			"  passh find --names github",
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{keysAnnotation: keysLazy, readOnlyAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkSortOrder(order); err != nil {
+				return err
+			}
+			if namesOnly && order != sortName {
+				return fmt.Errorf("--names can only sort by name")
+			}
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			var index *storage.Index
+			if namesOnly {
+				index, err = namesIndex(store)
+			} else {
+				index, err = listingIndex(cmd, store)
+			}
+			if err != nil {
+				return err
+			}
+			if !showHidden {
+				index = index.WithoutHidden()
+			}
+
+			matches := index.Find(args[0])
+			if len(matches) == 0 {
+				return fmt.Errorf("no entries match '%s'", args[0])
+			}
+			sortEntries(cmd, index, matches, order)
+			now := time.Now()
+			for _, name := range matches {
+				fmt.Fprintln(cmd.OutOrStdout(), formatEntry(index, name, now))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&showHidden, "show-hidden", false, "Also find entries marked 'hidden: true'")
+	cmd.Flags().BoolVar(&namesOnly, "names", false, "Only search entry names, without needing the private key")
+	cmd.Flags().StringVar(&order, "sort", sortName, "Sort by name, modified or accessed")
+
+	return cmd
+}
+
+// listingIndex returns the index of the store for listing entry names. If
+// the keys can't be loaded, it falls back to the names of the entry files,
+// without tags, times or hidden markers.
+func listingIndex(cmd *cobra.Command, store *storage.Store) (*storage.Index, error) {
+	err := loadKeys(cmd)
+	if err == nil && !canDecrypt(cmd) {
+		err = crypto.ErrNoPrivateKey
+	}
+	if err != nil {
+		logging.Debugf("not reading the index: %v", err)
+		logging.Warnf("Your private key could not be loaded; listing entry names only")
+		return namesIndex(store)
+	}
+	return store.Index()
+}
+
+// namesIndex returns an index of the names of the entry files only, which
+// needs no keys unless the store encrypts names
+func namesIndex(store *storage.Store) (*storage.Index, error) {
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	index := &storage.Index{Entries: make(map[string]storage.IndexEntry, len(names))}
+	for _, name := range names {
+		index.Entries[name] = storage.IndexEntry{}
+	}
+	return index, nil
+}
+
+// loadKeys sets up the keys of a command whose encryptor is deferred
+func loadKeys(cmd *cobra.Command) error {
+	if deferred, ok := asDeferred(cmdApp(cmd).encryptor); ok {
+		_, err := deferred.resolve()
+		return err
+	}
+	return nil
+}
+
+// canDecrypt reports whether the keys of a command include a private key.
+// Only SSH keys can be loaded without one.
+func canDecrypt(cmd *cobra.Command) bool {
+	encryptor := cmdApp(cmd).encryptor
+	if deferred, ok := asDeferred(encryptor); ok {
+		encryptor = deferred.encryptor
+	}
+	if ssh, ok := encryptor.(*crypto.SSHEncryptor); ok {
+		return ssh.CanDecrypt()
+	}
+	return true
+}
+
+// indexPath returns where the index of a store is kept
+func indexPath(storeDir string) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(storeDir))
+	return filepath.Join(dir, "index", hex.EncodeToString(sum[:8])+".enc"), nil
+}
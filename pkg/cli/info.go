@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// timeFormat is used when showing entry timestamps
+const timeFormat = "2006-01-02 15:04"
+
+func newInfoCmd() *cobra.Command {
+	var recipients bool
+
+	cmd := &cobra.Command{
+		Use:   "info NAME",
+		Short: "Show when an entry was created, modified and last read",
+		Long: "Show when an entry was created, modified and last read, and its size. With only the " +
+			"public key loaded, the metadata kept inside the encrypted entry can't be read, and only " +
+			"the file time, the size and, with --recipients, the recipients are shown.",
+		Example: "  passh info github/personal\n" +
+			"  passh info team/db --recipients",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			meta, err := store.Metadata(name)
+			if errors.Is(err, crypto.ErrNoPrivateKey) {
+				logging.Debugf("showing public information only: %v", err)
+			} else if err != nil {
+				return err
+			}
+			if err := printEntryInfo(cmd, store, name, meta); err != nil {
+				return err
+			}
+			if recipients {
+				return printEntryRecipients(cmd, store, name)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&recipients, "recipients", false, "Also show the keys the entry is encrypted to")
+
+	return cmd
+}
+
+// printEntryInfo prints the name, timestamps, reads and size of an entry
+func printEntryInfo(cmd *cobra.Command, store *storage.Store, name string, meta storage.Metadata) error {
+	info, err := store.Stat(name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Name:      %s\n", name)
+	if meta.Created.IsZero() {
+		// Written before metadata was recorded, or not decrypted
+		fmt.Fprintf(cmd.OutOrStdout(), "Created:   unknown\n")
+		fmt.Fprintf(cmd.OutOrStdout(), "Modified:  %s (file time)\n", info.ModTime.Local().Format(timeFormat))
+	} else {
+		fmt.Fprintf(cmd.OutOrStdout(), "Created:   %s\n", meta.Created.Local().Format(timeFormat))
+		fmt.Fprintf(cmd.OutOrStdout(), "Modified:  %s\n", meta.Modified.Local().Format(timeFormat))
+	}
+	// The access log is encrypted like the entries
+	if canDecrypt(cmd) {
+		access := loadAccessRecords(cmd).Entries[name]
+		fmt.Fprintf(cmd.OutOrStdout(), "Accessed:  %s (%d reads)\n", formatAccess(access), access.Count)
+	} else {
+		fmt.Fprintf(cmd.OutOrStdout(), "Accessed:  unknown\n")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Size:      %d bytes encrypted\n", info.Size)
+	return nil
+}
+
+// printLongList prints entries with their modification and access times
+func printLongList(out io.Writer, index *storage.Index, names []string, access *storage.AccessLog) {
+	fmt.Fprintf(out, "%-16s  %-16s  %5s  %s\n", "MODIFIED", "ACCESSED", "READS", "NAME")
+	now := time.Now()
+	for _, entry := range names {
+		modified := "?"
+		if info := index.Entries[entry]; !info.Modified.IsZero() {
+			modified = info.Modified.Local().Format(timeFormat)
+		}
+
+		record := access.Entries[entry]
+		fmt.Fprintf(out, "%-16s  %-16s  %5d  %s\n", modified, formatAccess(record), record.Count, formatEntry(index, entry, now))
+	}
+}
+
+// formatAccess shows when an entry was last read
+func formatAccess(record storage.AccessRecord) string {
+	if record.Count == 0 {
+		return "never"
+	}
+	return record.Last.Local().Format(timeFormat)
+}
+
+// accessLogPath returns where reads of entries in a store are recorded
+func accessLogPath(storeDir string) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(storeDir))
+	return filepath.Join(dir, "access", hex.EncodeToString(sum[:8])+".enc"), nil
+}
+
+// loadAccessRecords loads the access log of the current store. Problems are
+// reported as warnings, since the log is informational only.
+func loadAccessRecords(cmd *cobra.Command) *storage.AccessLog {
+	empty := &storage.AccessLog{Entries: make(map[string]storage.AccessRecord)}
+
+	storeDir, _ := cmd.Flags().GetString("store")
+	path, err := accessLogPath(storeDir)
+	if err != nil {
+		return empty
+	}
+
+	encryptor, err := cmdEncryptor(cmd)
+	if err != nil {
+		return empty
+	}
+	log, err := storage.LoadAccessLog(path, encryptor)
+	if err != nil {
+		logging.Warnf("%v", err)
+		return empty
+	}
+	return log
+}
+
+// recordAccess counts a read of an entry in the access log
+func recordAccess(cmd *cobra.Command, name string) {
+	storeDir, _ := cmd.Flags().GetString("store")
+	path, err := accessLogPath(storeDir)
+	if err != nil {
+		return
+	}
+
+	encryptor, err := cmdEncryptor(cmd)
+	if err != nil {
+		return
+	}
+	// Reads served by the passh agent aren't recorded, as that needs the keys
+	if deferred, ok := asDeferred(encryptor); ok && !deferred.resolved() {
+		return
+	}
+	log, err := storage.LoadAccessLog(path, encryptor)
+	if err != nil {
+		logging.Warnf("%v", err)
+		return
+	}
+
+	log.Record(name, time.Now())
+	if err := log.Save(path, encryptor); err != nil {
+		logging.Warnf("%v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/passh"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newInitCmd() *cobra.Command {
+	var recipients []string
+	var useGit bool
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a new store",
+		Long: "Create the store directory given by --store (~/.passh by default) and record its " +
+			"encryption backend. Each --recipient is a public key file or an authorized_keys line; " +
+			"they are checked and written to the store's " + storage.RecipientsFile + " file, so " +
+			"entries are encrypted to them instead of only your own keys. With --git the store is " +
+			"made a git repository and the new files are committed.\n\n" +
+			"Use 'passh setup' to check your SSH keys and agent first.",
+		Example: "  passh init\n" +
+			"  passh init --store ~/team-store --recipient ~/.ssh/id_ed25519.pub --recipient alice.pub --git",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			backend, err := backendName(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			if len(recipients) > 0 && backend != backendSSH {
+				return fmt.Errorf("--recipient needs the ssh backend, not %s", backend)
+			}
+
+			var lines [][]byte
+			var keys []ssh.PublicKey
+			for _, recipient := range recipients {
+				parsed, err := parseRecipientKeys(recipient)
+				if err != nil {
+					return err
+				}
+				for _, key := range parsed {
+					keys = append(keys, key.key)
+					lines = append(lines, key.line)
+				}
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := checkUninitialized(store); err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := checkRecipientsUsable(cmd, keys); err != nil {
+					return err
+				}
+				if err := store.Backend().WriteFile(storage.RecipientsFile, bytes.Join(lines, nil)); err != nil {
+					return fmt.Errorf("failed to write %s: %w", storage.RecipientsFile, err)
+				}
+			}
+			if err := store.WriteMeta(passh.BackendMeta, []byte(backend+"\n")); err != nil {
+				return err
+			}
+
+			location, _ := cmd.Flags().GetString("store")
+			if location == "" {
+				location = "~/.passh"
+			}
+			if useGit {
+				dir, ok := storage.LocalDir(store.Backend())
+				if !ok {
+					return errors.New("--git needs a local store")
+				}
+				if err := gitInit(dir); err != nil {
+					return err
+				}
+			}
+			logging.Infof("Initialized store in %s with the %s backend", location, backend)
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&recipients, "recipient", nil, "Public key file or authorized_keys line to encrypt entries to (repeatable)")
+	cmd.Flags().BoolVar(&useGit, "git", false, "Make the store a git repository")
+
+	return cmd
+}
+
+// recipientKey is a parsed recipient with its authorized_keys line
+type recipientKey struct {
+	key  ssh.PublicKey
+	line []byte
+}
+
+// parseRecipientKeys reads the keys of a --recipient, given as a public key
+// file, an authorized_keys line, or github:USER or gitlab:USER for the keys
+// a user published there, and rejects weak ones
+func parseRecipientKeys(value string) ([]recipientKey, error) {
+	if server, user, ok := keyServerUser(value); ok {
+		return fetchRecipientKeys(server, user)
+	}
+
+	data := []byte(value)
+	if fileData, err := os.ReadFile(value); err == nil {
+		data = fileData
+	} else if !strings.Contains(value, " ") {
+		return nil, fmt.Errorf("recipient: %w", err)
+	}
+	return parseKeyLines(value, data, "")
+}
+
+// parseKeyLines parses the authorized_keys lines of a recipient. Keys without
+// a comment are given defaultComment, so the recipients file shows whose they are.
+func parseKeyLines(value string, data []byte, defaultComment string) ([]recipientKey, error) {
+	var keys []recipientKey
+	for rest := data; len(bytes.TrimSpace(rest)) > 0; {
+		key, comment, _, next, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return nil, fmt.Errorf("recipient '%s' is not a valid public key: %w", value, err)
+		}
+		if comment == "" {
+			comment = defaultComment
+		}
+		if err := crypto.CheckKeyType(key); err != nil {
+			return nil, fmt.Errorf("recipient '%s': %w", value, err)
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if err := crypto.CheckCertificate(cert, time.Now()); err != nil {
+				return nil, fmt.Errorf("recipient '%s': %w", value, err)
+			}
+		}
+		keys = append(keys, recipientKey{key: key, line: recipientLine(key, comment)})
+		rest = next
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("recipient '%s' holds no public keys", value)
+	}
+	return keys, nil
+}
+
+// recipientLine returns the authorized_keys line of a key, without options
+func recipientLine(key ssh.PublicKey, comment string) []byte {
+	line := bytes.TrimSuffix(ssh.MarshalAuthorizedKey(key), []byte("\n"))
+	if comment != "" {
+		line = append(line, ' ')
+		line = append(line, comment...)
+	}
+	return append(line, '\n')
+}
+
+// checkRecipientsUsable makes sure the user creating the store can read
+// entries encrypted to the recipients
+func checkRecipientsUsable(cmd *cobra.Command, keys []ssh.PublicKey) error {
+	encryptor, ok := cmdApp(cmd).encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return nil
+	}
+	if !slices.ContainsFunc(encryptor.PublicKeys(), func(own ssh.PublicKey) bool {
+		return slices.ContainsFunc(keys, func(key ssh.PublicKey) bool {
+			return bytes.Equal(own.Marshal(), crypto.CertifiedKey(key).Marshal())
+		})
+	}) {
+		logging.Warnf("none of your keys is a recipient; you won't be able to read the entries you add")
+		return nil
+	}
+
+	encrypted, err := encryptor.EncryptTo([]byte("passh"), keys)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt to the recipients: %w", err)
+	}
+	if _, err := encryptor.Decrypt(encrypted); err != nil {
+		return fmt.Errorf("your private key can't decrypt entries encrypted to the recipients: %w", err)
+	}
+	return nil
+}
+
+// checkUninitialized refuses to initialize a store that is already in use
+func checkUninitialized(store *storage.Store) error {
+	names, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("the store already holds %d entries", len(names))
+	}
+	if _, err := store.Backend().ReadFile(storage.RecipientsFile); err == nil {
+		return fmt.Errorf("the store already has a %s file", storage.RecipientsFile)
+	}
+	return nil
+}
+
+// gitInit makes a store directory a git repository and commits its files
+func gitInit(dir string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is not installed: %w", err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "Initialize passh store"},
+	} {
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKey(t *testing.T, public any, comment string) string {
+	t.Helper()
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatalf("NewPublicKey failed: %v", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + " " + comment
+}
+
+func TestParseRecipientKeys(t *testing.T) {
+	alice, _, _ := ed25519.GenerateKey(rand.Reader)
+	bob, _, _ := ed25519.GenerateKey(rand.Reader)
+	aliceLine := authorizedKey(t, alice, "alice@laptop")
+
+	keys, err := parseRecipientKeys(aliceLine)
+	if err != nil {
+		t.Fatalf("Expected an authorized_keys line to parse: %v", err)
+	}
+	if len(keys) != 1 || string(keys[0].line) != aliceLine+"\n" {
+		t.Errorf("Expected the line with its comment, got %q", keys)
+	}
+
+	path := filepath.Join(t.TempDir(), "team.pub")
+	content := "# team\n" + aliceLine + "\n\n" + authorizedKey(t, bob, "bob") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	keys, err = parseRecipientKeys(path)
+	if err != nil {
+		t.Fatalf("Expected a key file to parse: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys from the file, got %d", len(keys))
+	}
+	if parsed, err := storage.ParseRecipients([]byte(string(keys[0].line) + string(keys[1].line))); err != nil || len(parsed) != 2 {
+		t.Errorf("Expected the written lines to be a valid recipients file, got %d keys (%v)", len(parsed), err)
+	}
+
+	for _, invalid := range []string{"missing.pub", "ssh-ed25519 not-base64", ""} {
+		if _, err := parseRecipientKeys(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestParseRecipientKeysRejectsWeakRSA(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if _, err := parseRecipientKeys(authorizedKey(t, &weak.PublicKey, "old")); err == nil {
+		t.Error("Expected a 1024-bit RSA key to be rejected")
+	}
+}
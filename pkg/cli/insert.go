@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newInsertCmd() *cobra.Command {
+	var multiline bool
+
+	cmd := &cobra.Command{
+		Use:   "insert NAME",
+		Short: "Insert an entry, optionally spanning multiple lines",
+		Long: "Insert an entry. With --multiline everything up to end of input is stored, such as " +
+			"an API key with notes, a PEM block or a list of recovery codes. Type the text and press " +
+			"Ctrl+D, or pipe it in. The first line is what 'passh get' prints; 'passh get --full' " +
+			"prints everything.\n\n" +
+			"Without --multiline, a single line is read: prompted for twice on a terminal, or read " +
+			"from standard input otherwise.",
+		Example: "  passh insert web/github\n" +
+			"  passh insert --multiline api/stripe\n" +
+			"  cat server.key | passh insert -m certs/server-key",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			interactive := !isBatch(cmd) && term.IsTerminal(int(os.Stdin.Fd()))
+
+			var content []byte
+			var err error
+			switch {
+			case multiline:
+				if interactive {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Enter contents of '%s' and press Ctrl+D when finished:\n", name)
+				}
+				content, err = readMultiline(cmd.InOrStdin())
+			case interactive:
+				content, err = promptPassword(cmd, name)
+			default:
+				var line string
+				line, err = readLine(cmd.InOrStdin())
+				if err == nil && line == "" {
+					err = fmt.Errorf("no password given on standard input")
+				}
+				content = []byte(line)
+			}
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := store.Add(name, content); err != nil {
+				return err
+			}
+
+			logging.Infof("Added entry '%s'", name)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&multiline, "multiline", "m", false, "Read lines until end of input")
+
+	return cmd
+}
+
+// readMultiline reads an entry until end of input. Only the final line
+// break is dropped, so the text round-trips through 'get --full'.
+func readMultiline(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entry: %w", err)
+	}
+	content = bytes.TrimSuffix(content, []byte("\n"))
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, fmt.Errorf("no content given")
+	}
+	return content, nil
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// k8sNamePattern matches Kubernetes object and namespace names (DNS subdomains)
+	k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	// k8sKeyPattern matches Secret data keys
+	k8sKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+func newK8sCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "k8s",
+		Short: "Share entries with Kubernetes",
+	}
+
+	cmd.AddCommand(newK8sExportCmd())
+
+	return cmd
+}
+
+func newK8sExportCmd() *cobra.Command {
+	var secretName, namespace, kubeconfig, kubeContext string
+	var labels, annotations []string
+	var full, apply bool
+
+	cmd := &cobra.Command{
+		Use:   "export NAME...",
+		Short: "Print a Kubernetes Secret manifest for entries",
+		Long: "Print a Kubernetes Secret manifest holding the password of each entry NAME, or of every " +
+			"entry in the folder NAME. Keys are the last part of the entry name unless given as " +
+			"KEY=NAME. With --apply the Secret is passed to 'kubectl apply' instead of printed.",
+		Example: "  passh k8s export app/prod --secret-name app --namespace web > secret.yaml\n" +
+			"  passh k8s export DATABASE_URL=db/prod --secret-name db --apply",
+		Args:        cobra.MinimumNArgs(1),
+		Annotations: map[string]string{cachedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !k8sNamePattern.MatchString(secretName) || len(secretName) > 253 {
+				return fmt.Errorf("invalid secret name '%s'", secretName)
+			}
+			if namespace != "" && !k8sNamePattern.MatchString(namespace) {
+				return fmt.Errorf("invalid namespace '%s'", namespace)
+			}
+			labelMap, err := parseKeyValues("label", labels)
+			if err != nil {
+				return err
+			}
+			annotationMap, err := parseKeyValues("annotation", annotations)
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.List()
+			if err != nil {
+				return err
+			}
+			keys, err := k8sSecretKeys(args, names)
+			if err != nil {
+				return err
+			}
+
+			data := make(map[string][]byte, len(keys))
+			defer func() {
+				for _, value := range data {
+					secure.Wipe(value)
+				}
+			}()
+			for key, name := range keys {
+				content, err := store.Get(name)
+				if err != nil {
+					return err
+				}
+				recordAccess(cmd, name)
+				if full {
+					data[key] = content
+				} else {
+					data[key] = append([]byte(nil), firstLine(content)...)
+					secure.Wipe(content)
+				}
+			}
+
+			manifest := k8sSecretManifest(secretName, namespace, labelMap, annotationMap, data)
+			defer secure.Wipe(manifest)
+			if !apply {
+				cmd.OutOrStdout().Write(manifest)
+				return nil
+			}
+
+			kubectlArgs := []string{"apply", "-f", "-"}
+			if kubeconfig != "" {
+				kubectlArgs = append(kubectlArgs, "--kubeconfig", kubeconfig)
+			}
+			if kubeContext != "" {
+				kubectlArgs = append(kubectlArgs, "--context", kubeContext)
+			}
+			kubectl := exec.Command("kubectl", kubectlArgs...)
+			kubectl.Stdin = bytes.NewReader(manifest)
+			kubectl.Stdout = cmd.OutOrStdout()
+			kubectl.Stderr = cmd.ErrOrStderr()
+			if err := kubectl.Run(); err != nil {
+				return fmt.Errorf("kubectl apply failed: %w", err)
+			}
+			logging.Infof("Applied secret '%s' with %d keys", secretName, len(data))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&secretName, "secret-name", "", "Name of the Kubernetes Secret")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the Secret")
+	cmd.Flags().StringArrayVarP(&labels, "label", "l", nil, "Add a KEY=VALUE label (repeatable)")
+	cmd.Flags().StringArrayVar(&annotations, "annotation", nil, "Add a KEY=VALUE annotation (repeatable)")
+	cmd.Flags().BoolVarP(&full, "full", "f", false, "Store whole entries instead of their first line")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Apply the Secret with kubectl instead of printing it")
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig file for --apply (default: kubectl's)")
+	cmd.Flags().StringVar(&kubeContext, "context", "", "kubeconfig context for --apply")
+	cmd.MarkFlagRequired("secret-name")
+
+	return cmd
+}
+
+// parseKeyValues parses repeated KEY=VALUE flags
+func parseKeyValues(flag string, values []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --%s '%s'; expected KEY=VALUE", flag, value)
+		}
+		parsed[key] = val
+	}
+	return parsed, nil
+}
+
+// k8sSecretKeys maps Secret data keys to the entries given as arguments, each
+// an entry, a folder or KEY=NAME
+func k8sSecretKeys(args, names []string) (map[string]string, error) {
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	keys := make(map[string]string)
+	add := func(key, name string) error {
+		if !k8sKeyPattern.MatchString(key) {
+			return fmt.Errorf("'%s' is not a valid secret key; use KEY=%s", key, name)
+		}
+		if other, ok := keys[key]; ok && other != name {
+			return fmt.Errorf("entries '%s' and '%s' would both set key %s", other, name, key)
+		}
+		keys[key] = name
+		return nil
+	}
+
+	for _, arg := range args {
+		if key, name, ok := strings.Cut(arg, "="); ok {
+			if !exists[name] {
+				return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, name)
+			}
+			if err := add(key, name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if exists[arg] {
+			if err := add(path.Base(arg), arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		prefix := strings.TrimSuffix(arg, "/") + "/"
+		found := false
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				found = true
+				if err := add(path.Base(name), name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, arg)
+		}
+	}
+	return keys, nil
+}
+
+// k8sSecretManifest builds an Opaque Secret manifest. Strings are written
+// as double-quoted YAML scalars, which Go's quoting produces for any text.
+func k8sSecretManifest(name, namespace string, labels, annotations map[string]string, data map[string][]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", name)
+	if namespace != "" {
+		fmt.Fprintf(&b, "  namespace: %s\n", namespace)
+	}
+	writeYAMLMap(&b, "labels", labels)
+	writeYAMLMap(&b, "annotations", annotations)
+	b.WriteString("type: Opaque\ndata:\n")
+	for _, key := range sortedKeys(data) {
+		fmt.Fprintf(&b, "  %s: %s\n", key, base64.StdEncoding.EncodeToString(data[key]))
+	}
+	return b.Bytes()
+}
+
+// writeYAMLMap writes a metadata map, if it has any entries
+func writeYAMLMap(b *bytes.Buffer, field string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "  %s:\n", field)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(b, "    %s: %s\n", strconv.Quote(key), strconv.Quote(values[key]))
+	}
+}
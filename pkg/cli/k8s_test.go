@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestK8sSecretKeys(t *testing.T) {
+	names := []string{"app/prod/db-pass", "app/prod/api/token", "app/staging/db-pass", "db/prod"}
+
+	keys, err := k8sSecretKeys([]string{"app/prod", "DATABASE_URL=db/prod"}, names)
+	if err != nil {
+		t.Fatalf("k8sSecretKeys failed: %v", err)
+	}
+	expected := map[string]string{
+		"db-pass":      "app/prod/db-pass",
+		"token":        "app/prod/api/token",
+		"DATABASE_URL": "db/prod",
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+
+	if _, err := k8sSecretKeys([]string{"app/prod", "app/staging"}, names); err == nil {
+		t.Error("Expected clashing keys to be rejected")
+	}
+	if _, err := k8sSecretKeys([]string{"missing"}, names); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := k8sSecretKeys([]string{"bad key=db/prod"}, names); err == nil {
+		t.Error("Expected an invalid key to be rejected")
+	}
+}
+
+func TestK8sSecretManifest(t *testing.T) {
+	manifest := k8sSecretManifest("app", "web",
+		map[string]string{"app.kubernetes.io/name": "app"},
+		nil,
+		map[string][]byte{"token": []byte("hunter2"), "db-pass": []byte("s3cret")})
+
+	expected := `apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  namespace: web
+  labels:
+    "app.kubernetes.io/name": "app"
+type: Opaque
+data:
+  db-pass: czNjcmV0
+  token: aHVudGVyMg==
+`
+	if string(manifest) != expected {
+		t.Errorf("Unexpected manifest:\n%s", manifest)
+	}
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/keychain"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newKeychainCmd() *cobra.Command {
+	var service, account string
+
+	cmd := &cobra.Command{
+		Use:   "keychain",
+		Short: "Mirror entries into the OS credential store",
+		Long: "Copy passwords between passh and the macOS Keychain, the Windows Credential Manager or " +
+			"a libsecret keyring (through secret-tool), for applications that only read the platform's " +
+			"credential store. Items are found by service and account, which default to 'passh' and the " +
+			"entry name; set them with --service and --account to match what an application looks up. " +
+			"On Windows the credential is named SERVICE:ACCOUNT.",
+	}
+	cmd.PersistentFlags().StringVar(&service, "service", "passh", "Service of the credential store items")
+	cmd.PersistentFlags().StringVar(&account, "account", "", "Account of the item, for a single entry (default: the entry name)")
+
+	accountFor := func(names []string) (func(string) string, error) {
+		if account != "" && len(names) > 1 {
+			return nil, fmt.Errorf("--account can only be used with a single entry")
+		}
+		return func(name string) string {
+			if account != "" {
+				return account
+			}
+			return name
+		}, nil
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "push NAME...",
+			Short: "Copy entry passwords into the credential store",
+			Example: "  passh keychain push github/work\n" +
+				"  passh keychain push db/prod --service myapp --account admin",
+			Args:        cobra.MinimumNArgs(1),
+			Annotations: map[string]string{cachedAnnotation: "true"},
+			RunE: func(cmd *cobra.Command, args []string) error {
+				itemAccount, err := accountFor(args)
+				if err != nil {
+					return err
+				}
+				keys, err := keychain.Detect()
+				if err != nil {
+					return err
+				}
+
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				for _, name := range args {
+					content, err := store.Get(name)
+					if err != nil {
+						return err
+					}
+					recordAccess(cmd, name)
+					err = keys.Set(service, itemAccount(name), firstLine(content))
+					secure.Wipe(content)
+					if err != nil {
+						return fmt.Errorf("failed to push '%s': %w", name, err)
+					}
+					logging.Infof("Copied '%s' to the %s", name, keys.Name())
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "pull NAME...",
+			Short: "Copy passwords from the credential store into entries",
+			Long: "Set the password of each entry to the one in the credential store, keeping the " +
+				"rest of the entry. Entries that don't exist yet are created.",
+			Example: "  passh keychain pull db/prod --service myapp --account admin",
+			Args:    cobra.MinimumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				itemAccount, err := accountFor(args)
+				if err != nil {
+					return err
+				}
+				keys, err := keychain.Detect()
+				if err != nil {
+					return err
+				}
+
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				for _, name := range args {
+					password, err := keys.Get(service, itemAccount(name))
+					if err != nil {
+						return fmt.Errorf("failed to pull '%s': %w", name, err)
+					}
+					err = pullPassword(store, name, password)
+					secure.Wipe(password)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// pullPassword sets the password of an entry, creating it if needed
+func pullPassword(store *storage.Store, name string, password []byte) error {
+	if len(password) == 0 || bytes.ContainsAny(password, "\r\n") {
+		return fmt.Errorf("the credential store item for '%s' is not a single-line password", name)
+	}
+
+	content, err := store.Get(name)
+	if errors.Is(err, storage.ErrNotFound) {
+		if err := store.Add(name, password); err != nil {
+			return err
+		}
+		logging.Infof("Added entry '%s'", name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(content)
+
+	updated := withPassword(content, password)
+	defer secure.Wipe(updated)
+	if bytes.Equal(updated, content) {
+		logging.Infof("'%s' is unchanged", name)
+		return nil
+	}
+	if err := store.Add(name, updated); err != nil {
+		return err
+	}
+	logging.Infof("Updated the password of '%s'", name)
+	return nil
+}
+
+// withPassword returns a copy of an entry with its first line replaced
+func withPassword(content, password []byte) []byte {
+	_, rest, hasRest := bytes.Cut(content, []byte("\n"))
+	updated := make([]byte, 0, len(password)+1+len(rest))
+	updated = append(updated, password...)
+	if hasRest {
+		updated = append(updated, '\n')
+		updated = append(updated, rest...)
+	}
+	return updated
+}
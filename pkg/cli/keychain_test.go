@@ -0,0 +1,20 @@
+package cli
+
+import "testing"
+
+func TestWithPassword(t *testing.T) {
+	tests := []struct {
+		content, expected string
+	}{
+		{"old", "new"},
+		{"old\n", "new\n"},
+		{"old\r\nuser: alice\n", "new\nuser: alice\n"},
+		{"old\nuser: alice\nurl: example.com", "new\nuser: alice\nurl: example.com"},
+	}
+
+	for _, test := range tests {
+		if updated := string(withPassword([]byte(test.content), []byte("new"))); updated != test.expected {
+			t.Errorf("withPassword(%q) = %q, expected %q", test.content, updated, test.expected)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+// keyServers maps recipient prefixes to where users publish their SSH keys
+var keyServers = map[string]string{
+	"github": "https://github.com/%s.keys",
+	"gitlab": "https://gitlab.com/%s.keys",
+}
+
+// keyServerUserPattern matches the user names GitHub and GitLab allow
+var keyServerUserPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// keyServerUser splits a recipient such as github:alice into the server and
+// user name
+func keyServerUser(value string) (server, user string, ok bool) {
+	server, user, found := strings.Cut(value, ":")
+	if _, known := keyServers[server]; !found || !known {
+		return "", "", false
+	}
+	return server, user, true
+}
+
+// fetchRecipientKeys downloads the SSH keys a user published on GitHub or
+// GitLab. Only HTTPS is used, so the keys come from the server named.
+func fetchRecipientKeys(server, user string) ([]recipientKey, error) {
+	source := server + ":" + user
+	if !keyServerUserPattern.MatchString(user) {
+		return nil, fmt.Errorf("recipient '%s': invalid %s user name", source, server)
+	}
+
+	data, err := fetchKeys(fmt.Sprintf(keyServers[server], user), source)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, fmt.Errorf("recipient '%s' has published no SSH keys", source)
+	}
+	return parseKeyLines(source, data, source)
+}
+
+// fetchKeys downloads a keys file over HTTPS
+func fetchKeys(url, source string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("recipient '%s' not found", source)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the keys of %s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of %s: %w", source, err)
+	}
+	return data, nil
+}
+
+// readKeySource reads a keys file to import recipients from, given as a
+// path or an HTTPS URL
+func readKeySource(source string) ([]byte, error) {
+	if strings.HasPrefix(source, "http://") {
+		return nil, fmt.Errorf("refusing to fetch keys from %s over plain HTTP", source)
+	}
+	if strings.HasPrefix(source, "https://") {
+		return fetchKeys(source, source)
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys: %w", err)
+	}
+	return data, nil
+}
+
+// importKeyLines parses a keys file such as ~/.ssh/authorized_keys for
+// recipients. Keys keep their comments, which name them in recipient
+// listings. Unlike a single --recipient, a shared file may hold keys that
+// can't be recipients; those are skipped with a warning.
+func importKeyLines(source string, data []byte) ([]recipientKey, error) {
+	var keys []recipientKey
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", source, i+1, err)
+		}
+		if slices.Contains(options, "cert-authority") {
+			logging.Verbosef("Skipping the CA key on line %d of %s; list it in %s to allow its certificates",
+				i+1, source, storage.PolicyFile)
+			continue
+		}
+		if err := crypto.CheckKeyType(key); err != nil {
+			logging.Warnf("skipping the key on line %d of %s: %v", i+1, source, err)
+			continue
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			if err := crypto.CheckCertificate(cert, time.Now()); err != nil {
+				logging.Warnf("skipping the key on line %d of %s: %v", i+1, source, err)
+				continue
+			}
+		}
+		keys = append(keys, recipientKey{key: key, line: recipientLine(key, comment)})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s holds no usable public keys", source)
+	}
+	return keys, nil
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFetchRecipientKeys(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alice.keys":
+			w.Write(ssh.MarshalAuthorizedKey(key))
+		case "/empty.keys":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	defer func(url string) { keyServers["github"] = url }(keyServers["github"])
+	keyServers["github"] = server.URL + "/%s.keys"
+
+	keys, err := parseRecipientKeys("github:alice")
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	if len(keys) != 1 || ssh.FingerprintSHA256(keys[0].key) != ssh.FingerprintSHA256(key) {
+		t.Fatalf("Expected alice's key, got %+v", keys)
+	}
+	if !strings.HasSuffix(string(keys[0].line), " github:alice\n") {
+		t.Errorf("Expected the key to be labelled with its source, got %q", keys[0].line)
+	}
+
+	for _, recipient := range []string{"github:empty", "github:nobody", "github:../alice", "github:"} {
+		if _, err := parseRecipientKeys(recipient); err == nil {
+			t.Errorf("Expected %s to fail", recipient)
+		}
+	}
+}
+
+func TestImportKeyLines(t *testing.T) {
+	key := func() ssh.PublicKey {
+		publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+		key, err := ssh.NewPublicKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	line := func(key ssh.PublicKey) string {
+		return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	}
+	alice, ca := key(), key()
+
+	data := "# team keys\n" +
+		`no-pty,command="echo hi" ` + line(alice) + " alice@corp\n" +
+		"cert-authority " + line(ca) + "\n"
+	keys, err := importKeyLines("team.keys", []byte(data))
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(keys) != 1 || string(keys[0].line) != line(alice)+" alice@corp\n" {
+		t.Fatalf("Expected alice's key without options, got %+v", keys)
+	}
+
+	if _, err := importKeyLines("team.keys", []byte("cert-authority "+line(ca)+"\n")); err == nil {
+		t.Error("Expected a file without recipients to be refused")
+	}
+	if _, err := readKeySource("http://example.com/team.keys"); err == nil {
+		t.Error("Expected plain HTTP to be refused")
+	}
+}
@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newMergeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "merge [NAME]",
+		Short: "Merge entries kept as NAME.conflict by sync",
+		Long: "When both versions of a conflicting entry are kept, sync stores the remote one as " +
+			"NAME.conflict. 'passh merge NAME' shows how the two versions differ field by field, " +
+			"asks which value to keep for each field, writes the result to NAME and removes " +
+			"NAME.conflict. Without NAME every conflict copy in the store is merged.\n\n" +
+			"Run 'passh sync' afterwards to update the remote.",
+		Example: "  passh merge web/github\n" +
+			"  passh merge",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if isBatch(cmd) {
+				return fmt.Errorf("merging asks which fields to keep: %w", errBatchInput)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names := args
+			if len(names) == 0 {
+				entries, err := store.List()
+				if err != nil {
+					return err
+				}
+				for _, entry := range entries {
+					if name, ok := strings.CutSuffix(entry, storage.ConflictSuffix); ok {
+						names = append(names, name)
+					}
+				}
+				if len(names) == 0 {
+					logging.Infof("No conflicts to merge")
+					return nil
+				}
+			}
+
+			for _, name := range names {
+				if err := mergeConflictCopy(cmd, store, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// mergeConflictCopy merges NAME.conflict into NAME and removes it
+func mergeConflictCopy(cmd *cobra.Command, store *storage.Store, name string) error {
+	local, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(local)
+	remote, err := store.Get(name + storage.ConflictSuffix)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(remote)
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Merging '%s' with '%s%s':\n", name, name, storage.ConflictSuffix)
+	merged, err := mergeEntries(cmd.InOrStdin(), cmd.ErrOrStderr(), local, remote)
+	if err != nil {
+		return fmt.Errorf("merge of '%s' aborted: %w", name, err)
+	}
+	defer secure.Wipe(merged)
+
+	if err := store.Add(name, merged); err != nil {
+		return err
+	}
+	if err := store.Delete(name + storage.ConflictSuffix); err != nil {
+		return err
+	}
+	logging.Infof("Merged '%s'; run 'passh sync' to update the remote", name)
+	return nil
+}
+
+// mergeConflict merges both versions of a conflict found by sync and
+// returns the merged entry, encrypted for the store
+func mergeConflict(cmd *cobra.Command, store *storage.Store, conflict storage.Conflict) ([]byte, error) {
+	local, localMeta, err := store.Open(conflict.Name, storage.Version{Data: conflict.Local})
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(local)
+	remote, remoteMeta, err := store.Open(conflict.Name, storage.Version{Data: conflict.Remote})
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(remote)
+
+	merged, err := mergeEntries(cmd.InOrStdin(), cmd.ErrOrStderr(), local, remote)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(merged)
+
+	meta := storage.Metadata{Created: localMeta.Created, Modified: time.Now().UTC()}
+	if meta.Created.IsZero() || !remoteMeta.Created.IsZero() && remoteMeta.Created.Before(meta.Created) {
+		meta.Created = remoteMeta.Created
+	}
+	return store.Seal(conflict.Name, merged, meta)
+}
+
+// entryField is one line of an entry: the password, a "key: value" field or
+// free text
+type entryField struct {
+	// id tells fields apart when merging: the lower-case key, numbered if it
+	// repeats, and "text" for free text
+	id    string
+	label string
+	line  string
+}
+
+// splitFields splits an entry into its fields, in order
+func splitFields(secret []byte) []entryField {
+	if len(secret) == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(secret), "\n"), "\n")
+	fields := []entryField{{id: "password", label: "password", line: lines[0]}}
+
+	seen := make(map[string]int)
+	for _, line := range lines[1:] {
+		key, _, ok := strings.Cut(line, ":")
+		label := strings.ToLower(strings.TrimSpace(key))
+		if !ok || strings.Contains(key, " ") || label == "" {
+			label = "text"
+		}
+		seen[label]++
+		id := label
+		if seen[label] > 1 {
+			id = fmt.Sprintf("%s#%d", label, seen[label])
+		}
+		fields = append(fields, entryField{id: id, label: label, line: line})
+	}
+	return fields
+}
+
+// mergeFields combines two versions of an entry field by field. Fields that
+// are the same on both sides are kept; for the others choose decides, and a
+// nil choice drops the field. Fields keep the local order, followed by
+// fields only the remote has.
+func mergeFields(local, remote []entryField, choose func(local, remote *entryField) (*entryField, error)) ([]entryField, error) {
+	remoteByID := make(map[string]*entryField, len(remote))
+	for i := range remote {
+		remoteByID[remote[i].id] = &remote[i]
+	}
+	localIDs := make(map[string]bool, len(local))
+
+	var merged []entryField
+	add := func(l, r *entryField) error {
+		field := l
+		if l == nil || r == nil || l.line != r.line {
+			var err error
+			if field, err = choose(l, r); err != nil {
+				return err
+			}
+		}
+		if field != nil {
+			merged = append(merged, *field)
+		}
+		return nil
+	}
+
+	for i := range local {
+		localIDs[local[i].id] = true
+		if err := add(&local[i], remoteByID[local[i].id]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range remote {
+		if !localIDs[remote[i].id] {
+			if err := add(nil, &remote[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return merged, nil
+}
+
+// mergeEntries asks for every field that differs which version to keep and
+// returns the merged entry
+func mergeEntries(in io.Reader, out io.Writer, local, remote []byte) ([]byte, error) {
+	merged, err := mergeFields(splitFields(local), splitFields(remote), func(l, r *entryField) (*entryField, error) {
+		field := l
+		if field == nil {
+			field = r
+		}
+		fmt.Fprintf(out, "  %s\n", field.label)
+		fmt.Fprintf(out, "    [l]ocal:  %s\n", fieldLine(l))
+		fmt.Fprintf(out, "    [r]emote: %s\n", fieldLine(r))
+
+		for {
+			fmt.Fprint(out, "  Keep [l]ocal or [r]emote, or [a]bort? ")
+			response, err := readLine(in)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read input: %w", err)
+			}
+			switch strings.ToLower(strings.TrimSpace(response)) {
+			case "l", "local":
+				return l, nil
+			case "r", "remote":
+				return r, nil
+			case "a", "abort":
+				return nil, fmt.Errorf("aborted")
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(merged) == 0 || merged[0].id != "password" {
+		return nil, fmt.Errorf("the merged entry has no password")
+	}
+
+	lines := make([]string, len(merged))
+	for i, field := range merged {
+		lines[i] = field.line
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// fieldLine shows a field in a merge prompt
+func fieldLine(field *entryField) string {
+	if field == nil {
+		return "(none)"
+	}
+	return field.line
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMergeEntries(t *testing.T) {
+	local := []byte("hunter2\nuser: alice\nurl: https://example.com\nold note\n")
+	remote := []byte("correct horse\nuser: alice\npin: 1234\nold note\n")
+
+	// password: remote, url (local only): local, pin (remote only): remote
+	merged, err := mergeEntries(strings.NewReader("x\nr\nl\nr\n"), io.Discard, local, remote)
+	if err != nil {
+		t.Fatalf("mergeEntries failed: %v", err)
+	}
+	expected := "correct horse\nuser: alice\nurl: https://example.com\nold note\npin: 1234"
+	if string(merged) != expected {
+		t.Errorf("Expected %q, got %q", expected, merged)
+	}
+
+	// Dropping a field by picking the side that lacks it
+	merged, err = mergeEntries(strings.NewReader("l\nr\nr\n"), io.Discard, local, remote)
+	if err != nil {
+		t.Fatalf("mergeEntries failed: %v", err)
+	}
+	if expected := "hunter2\nuser: alice\nold note\npin: 1234"; string(merged) != expected {
+		t.Errorf("Expected %q, got %q", expected, merged)
+	}
+
+	if _, err := mergeEntries(strings.NewReader("a\n"), io.Discard, local, remote); err == nil {
+		t.Error("Expected an aborted merge to fail")
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd() *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade entries to the current file format",
+		Long: fmt.Sprintf("Rewrite entries stored in an older file format in the current one, format "+
+			"version %d. Older entries can still be read, and any entry is written in the current "+
+			"format when it changes, so migrating is only needed to upgrade the whole store at once, "+
+			"for example before dropping support for an old format. Entries keep their content and "+
+			"are not decrypted.\n\n"+
+			"With --check nothing is changed; the entries are counted by format version, and the "+
+			"command fails if any need migrating.", storage.FormatVersion),
+		Example: "  passh migrate --check\n" +
+			"  passh migrate",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if check {
+				counts, err := store.FormatVersions()
+				if err != nil {
+					return err
+				}
+				outdated := 0
+				for _, version := range sortedKeys(counts) {
+					fmt.Fprintf(cmd.OutOrStdout(), "format v%d: %d entries\n", version, counts[version])
+					if version < storage.FormatVersion {
+						outdated += counts[version]
+					}
+				}
+				if outdated > 0 {
+					return fmt.Errorf("%d entries need migrating; run 'passh migrate'", outdated)
+				}
+				return nil
+			}
+
+			progress, finish := progressBar("Migrating")
+			store.SetProgress(progress)
+			result, err := store.Migrate()
+			finish()
+			if result == nil {
+				return err
+			}
+			for _, step := range result.Steps {
+				logging.Infof("Applied %s", step)
+			}
+			if err != nil {
+				return fmt.Errorf("migrated %d entries before failing: %w", len(result.Migrated), err)
+			}
+			logging.Infof("Migrated %d entries to format v%d", len(result.Migrated), storage.FormatVersion)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "Only report the format versions in use")
+
+	return cmd
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+)
+
+func newEncryptNamesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt-names",
+		Short: "Store entries under opaque file names",
+		Long: "Move every entry to a file named after a keyed hash of its name, so that someone " +
+			"who can read the store's files can't tell which sites and accounts it holds. The names " +
+			"are kept inside the encrypted entries and in the index. The key is stored encrypted in " +
+			"the store, to everyone who can read any entry, and 'passh reencrypt' updates it.\n\n" +
+			"The names of folders with recipients files stay visible, and stores with encrypted " +
+			"names can't hold attachments. There is no way back short of restoring a backup.",
+		Example: "  passh encrypt-names",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if !confirm(cmd, "Move every entry to an encrypted file name? This can't be undone.") {
+				logging.Infof("Cancelled")
+				return nil
+			}
+
+			if err := store.EncryptNames(); err != nil {
+				return fmt.Errorf("failed to encrypt entry names: %w", err)
+			}
+			logging.Infof("Entry names are now encrypted")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+)
+
+func newOpenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "open NAME",
+		Short: "Copy an entry's password and open its URL",
+		Long: "Copy the password of an entry to the clipboard, as 'passh get --clip' does, and open " +
+			"its url field in the default browser. A URL without a scheme is opened with https://; " +
+			"only http and https URLs are opened.",
+		Example:           "  passh open email/work",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			content, err := store.Get(name)
+			if err != nil {
+				return err
+			}
+			entry := secure.Take(content)
+			defer entry.Destroy()
+			recordAccess(cmd, name)
+			warnIfExpired(name, content)
+
+			value, ok := parseEntryFields(content)["url"]
+			if !ok {
+				return fmt.Errorf("entry '%s' has no url field", name)
+			}
+			link, err := browserURL(string(value))
+			if err != nil {
+				return fmt.Errorf("entry '%s': %w", name, err)
+			}
+
+			if err := copyToClipboard(cmd, name, firstLine(content), false); err != nil {
+				return err
+			}
+			return openURL(link)
+		},
+	}
+
+	return cmd
+}
+
+// browserURL checks the url field of an entry before it is handed to the
+// browser, adding https:// when there is no scheme. Other schemes are
+// refused, so a shared entry can't open local files or applications.
+func browserURL(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid url '%s': %w", value, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("not opening url '%s': only http and https are supported", value)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid url '%s': no host", value)
+	}
+	return u.String(), nil
+}
+
+// openURL opens a URL in the default browser
+func openURL(link string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", link)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	// Some openers run the browser itself, so don't wait for them
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", link, err)
+	}
+	return nil
+}
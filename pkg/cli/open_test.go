@@ -0,0 +1,29 @@
+package cli
+
+import "testing"
+
+func TestBrowserURL(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"https://mail.example.com/login", "https://mail.example.com/login"},
+		{"http://router.lan", "http://router.lan"},
+		{" example.com/signin ", "https://example.com/signin"},
+	}
+	for _, tt := range tests {
+		link, err := browserURL(tt.value)
+		if err != nil {
+			t.Fatalf("browserURL(%q) failed: %v", tt.value, err)
+		}
+		if link != tt.expected {
+			t.Errorf("browserURL(%q) = %q, want %q", tt.value, link, tt.expected)
+		}
+	}
+
+	for _, value := range []string{"file:///etc/passwd", "javascript://alert(1)", "https://"} {
+		if _, err := browserURL(value); err == nil {
+			t.Errorf("Expected browserURL(%q) to fail", value)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newLogCmd() *cobra.Command {
+	var entry, actor, op, since string
+
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show the operation log of the store",
+		Long: "Show who added, changed, deleted or re-encrypted which entries, and when. The log " +
+			"is kept in the store once enabled with 'passh log enable', so it is synced with it. " +
+			"It records entry names, never secrets. Each record holds the hash of the one before, " +
+			"and the chain is checked every time the log is shown.",
+		Example: "  passh log\n" +
+			"  passh log --entry team/ --since 30d\n" +
+			"  passh log --actor alice --op delete",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			window, err := parseDuration(since)
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			records, err := store.ReadLog()
+			if err != nil {
+				return err
+			}
+			if err := storage.VerifyLog(records); err != nil {
+				return err
+			}
+
+			closePager := pageOutput(cmd)
+			defer closePager()
+			for _, record := range records {
+				// Stores with encrypted names log file names
+				if record.Name != "" {
+					record.Name = store.EntryName(record.Name)
+				}
+				if entry != "" && !strings.HasPrefix(record.Name, entry) {
+					continue
+				}
+				if actor != "" && !strings.Contains(record.Actor, actor) {
+					continue
+				}
+				if op != "" && record.Op != op {
+					continue
+				}
+				if window > 0 && time.Since(record.Time) > window {
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %-9s  %s  %s\n", record.Time.Local().Format(timeFormat), record.Op, record.Name, record.Actor)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&entry, "entry", "", "Only show operations on entries under this prefix")
+	cmd.Flags().StringVar(&actor, "actor", "", "Only show operations by actors containing this text")
+	cmd.Flags().StringVar(&op, "op", "", "Only show this operation (add, update, delete, reencrypt)")
+	cmd.Flags().StringVar(&since, "since", "", "Only show operations within this duration, e.g. 7d or 12h")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "enable",
+		Short:   "Start the operation log of the store",
+		Example: "  passh log enable",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := store.EnableLog(); err != nil {
+				return err
+			}
+			logging.Infof("Operation log enabled")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// logActor identifies the user in the operation log, as user@host followed
+// by the fingerprint of their first key when there is one
+func logActor(cmd *cobra.Command) string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	if keys := ownKeys(cmd); len(keys) > 0 {
+		name += " " + ssh.FingerprintSHA256(keys[0])
+	}
+	return name
+}
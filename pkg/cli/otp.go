@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/clipboard"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/otp"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newOTPCmd() *cobra.Command {
+	var showQR bool
+	var qrPNG string
+	var tmux bool
+	var settings otpSettings
+
+	cmd := &cobra.Command{
+		Use:   "otp NAME",
+		Short: "Show the current one-time password for an entry",
+		Long: "Generate a time-based one-time password (TOTP) from an entry. The entry holds either an " +
+			"otpauth:// URI on any line, or just the base32 secret.\n\n" +
+			"For counter-based codes (HOTP, an otpauth://hotp/ URI) the counter in the entry is " +
+			"advanced and saved before the code is shown, so no code is shown twice. Use " +
+			"'passh otp resync' when the server no longer accepts the codes.\n\n" +
+			"Steam Guard codes come from an otpauth://steam/ URI, an otpauth:// URI with " +
+			"encoder=steam, or a steam:// secret. --algorithm, --digits and --period override " +
+			"the entry's settings, for example for bare secrets of sites that don't use the defaults.\n\n" +
+			"With --qr the otpauth:// URI is shown as a QR code instead, to add the account to an " +
+			"authenticator app on a phone. Inside tmux, --tmux loads the code into the '" +
+			clipboard.TmuxBuffer + "' paste buffer instead of printing it.",
+		Example: "  passh otp github/2fa\n" +
+			"  passh otp github/2fa --qr\n" +
+			"  passh otp web/2fa --algorithm sha256 --digits 8 --period 60",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			data, err := store.Get(name)
+			if err != nil {
+				return err
+			}
+			recordAccess(cmd, name)
+
+			key, err := parseOTPEntry(name, data)
+			if err != nil {
+				return err
+			}
+			if err := settings.apply(key); err != nil {
+				return err
+			}
+
+			if qrPNG != "" {
+				if err := writeQRPNG(qrPNG, []byte(key.URI())); err != nil {
+					return err
+				}
+				logging.Infof("Wrote QR code to %s", qrPNG)
+				return nil
+			}
+			if showQR {
+				return printQR(cmd.OutOrStdout(), []byte(key.URI()))
+			}
+
+			now := time.Now()
+			var code string
+			if key.Type == otp.HOTP {
+				code, err = takeHOTPCode(store, name, settings)
+			} else {
+				code, err = key.Code(now)
+			}
+			if err != nil {
+				return err
+			}
+			if tmux {
+				return copyToClipboard(cmd, name, []byte(code), true)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), code)
+			if key.Type != otp.HOTP && term.IsTerminal(int(os.Stdout.Fd())) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Valid for %s\n", key.Remaining(now))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&showQR, "qr", false, "Show the otpauth:// URI as a QR code in the terminal")
+	cmd.Flags().StringVar(&qrPNG, "qr-png", "", "Write the otpauth:// URI as a QR code PNG to this file")
+	cmd.Flags().BoolVar(&tmux, "tmux", false, "Load the code into a tmux paste buffer instead of printing it")
+	cmd.Flags().StringVar(&settings.algorithm, "algorithm", "", "Hash algorithm: SHA1, SHA256 or SHA512 (default: the entry's, or SHA1)")
+	cmd.Flags().IntVar(&settings.digits, "digits", 0, "Number of digits (default: the entry's, or 6)")
+	cmd.Flags().IntVar(&settings.period, "period", 0, "Seconds each code is valid (default: the entry's, or 30)")
+
+	cmd.AddCommand(newOTPResyncCmd())
+
+	return cmd
+}
+
+func newOTPResyncCmd() *cobra.Command {
+	var lookAhead int
+
+	cmd := &cobra.Command{
+		Use:   "resync NAME [CODE]",
+		Short: "Realign an HOTP entry's counter with the server",
+		Long: "Find the counter of an HOTP code, such as the last one the server accepted or one " +
+			"from another device sharing the secret, and continue after it. Counters within " +
+			"--look-ahead of the entry's own are searched in both directions. Without CODE it is " +
+			"prompted for.",
+		Example: "  passh otp resync bank/token 287082\n" +
+			"  passh otp resync bank/token 287082 --look-ahead 20",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if lookAhead < 1 {
+				return fmt.Errorf("--look-ahead must be at least 1")
+			}
+
+			var code string
+			if len(args) == 2 {
+				code = args[1]
+			} else {
+				if isBatch(cmd) {
+					return fmt.Errorf("no code given: %w", errBatchInput)
+				}
+				fmt.Fprint(cmd.ErrOrStderr(), "Code the server accepted: ")
+				line, err := readLine(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("failed to read code: %w", err)
+				}
+				code = line
+			}
+			code = strings.Join(strings.Fields(code), "")
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			var counter uint64
+			err = store.Update(name, func(content []byte) ([]byte, error) {
+				key, err := parseOTPEntry(name, content)
+				if err != nil {
+					return nil, err
+				}
+				if counter, err = key.Resync(code, lookAhead); err != nil {
+					return nil, err
+				}
+				key.Counter = counter
+				return setOTPKey(content, key), nil
+			})
+			if err != nil {
+				return fmt.Errorf("entry '%s': %w", name, err)
+			}
+
+			logging.Infof("Resynchronized '%s'; the next code uses counter %d", name, counter)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&lookAhead, "look-ahead", 10, "How many counters to search on either side")
+
+	return cmd
+}
+
+// otpSettings override the settings of an entry's OTP key
+type otpSettings struct {
+	algorithm string
+	digits    int
+	period    int
+}
+
+// apply overrides the settings of key that were given
+func (o otpSettings) apply(key *otp.Key) error {
+	if o.algorithm != "" {
+		key.Algorithm = strings.ToUpper(o.algorithm)
+	}
+	if o.digits != 0 {
+		key.Digits = o.digits
+	}
+	if o.period != 0 {
+		key.Period = o.period
+	}
+	return key.Validate()
+}
+
+// takeHOTPCode returns the code for an HOTP entry's counter and saves the
+// advanced counter before the code is used, under the entry's lock so that
+// concurrent calls never return the same code. The settings only change the
+// code, not the entry.
+func takeHOTPCode(store *storage.Store, name string, settings otpSettings) (string, error) {
+	var code string
+	err := store.Update(name, func(content []byte) ([]byte, error) {
+		key, err := parseOTPEntry(name, content)
+		if err != nil {
+			return nil, err
+		}
+		generator := *key
+		if err := settings.apply(&generator); err != nil {
+			return nil, err
+		}
+		if code, err = generator.At(key.Counter); err != nil {
+			return nil, err
+		}
+		key.Counter++
+		return setOTPKey(content, key), nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("entry '%s': %w", name, err)
+	}
+	return code, nil
+}
+
+// setOTPKey replaces the otpauth:// line of an entry with the URI of key
+func setOTPKey(content []byte, key *otp.Key) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("otpauth://")) {
+			lines[i] = []byte(key.URI())
+			break
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// parseOTPEntry finds the OTP key in an entry: the first otpauth:// or
+// steam:// line, or the whole entry as a base32 secret
+func parseOTPEntry(name string, content []byte) (*otp.Key, error) {
+	// Only the line holding the key is copied into a string for otp.Parse
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("otpauth://")) {
+			return otp.Parse(string(line))
+		}
+		if bytes.HasPrefix(line, []byte("steam://")) {
+			key, err := otp.Parse(string(line))
+			if err != nil {
+				return nil, err
+			}
+			key.Issuer = "Steam"
+			key.Account = name
+			return key, nil
+		}
+	}
+
+	key, err := otp.Parse(string(bytes.TrimSpace(content)))
+	if err != nil {
+		return nil, errors.New("entry has no otpauth:// URI or base32 OTP secret")
+	}
+	// Label bare secrets with the entry name for authenticator apps
+	key.Issuer = "passh"
+	key.Account = name
+	return key, nil
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/otp"
+)
+
+func TestParseOTPEntry(t *testing.T) {
+	key, err := parseOTPEntry("github", []byte("hunter2\nuser: alice\notpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse entry: %v", err)
+	}
+	if key.Issuer != "GitHub" || key.Account != "alice" {
+		t.Errorf("Expected the URI's label, got %+v", key)
+	}
+
+	key, err = parseOTPEntry("github", []byte("JBSWY3DPEHPK3PXP\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse bare secret: %v", err)
+	}
+	if key.Issuer != "passh" || key.Account != "github" {
+		t.Errorf("Expected the entry name as label, got %+v", key)
+	}
+
+	key, err = parseOTPEntry("steam", []byte("hunter2\nsteam://JBSWY3DPEHPK3PXP\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse steam:// secret: %v", err)
+	}
+	if key.Type != otp.Steam || key.Issuer != "Steam" || key.Account != "steam" {
+		t.Errorf("Expected a labelled Steam Guard key, got %+v", key)
+	}
+
+	if _, err := parseOTPEntry("github", []byte("hunter2!")); err == nil {
+		t.Error("Expected an entry without an OTP secret to be rejected")
+	}
+}
+
+func TestOTPSettings(t *testing.T) {
+	key, err := parseOTPEntry("site", []byte("JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("Failed to parse entry: %v", err)
+	}
+	if err := (otpSettings{algorithm: "sha256", digits: 8, period: 60}).apply(key); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if key.Algorithm != "SHA256" || key.Digits != 8 || key.Period != 60 {
+		t.Errorf("Expected the settings to be applied, got %+v", key)
+	}
+	if err := (otpSettings{algorithm: "md5"}).apply(key); err == nil {
+		t.Error("Expected an unsupported algorithm to be rejected")
+	}
+}
+
+func TestSetOTPKey(t *testing.T) {
+	content := "hunter2\nuser: alice\notpauth://hotp/Bank:alice?secret=JBSWY3DPEHPK3PXP&issuer=Bank&counter=3\nnote: keep"
+	key, err := parseOTPEntry("bank", []byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse entry: %v", err)
+	}
+	key.Counter++
+
+	updated := setOTPKey([]byte(content), key)
+	again, err := parseOTPEntry("bank", updated)
+	if err != nil {
+		t.Fatalf("Failed to parse updated entry: %v", err)
+	}
+	if again.Counter != 4 {
+		t.Errorf("Expected counter 4, got %d", again.Counter)
+	}
+	if !bytes.HasPrefix(updated, []byte("hunter2\nuser: alice\n")) || !bytes.HasSuffix(updated, []byte("\nnote: keep")) {
+		t.Errorf("Expected the other lines to be kept, got %q", updated)
+	}
+}
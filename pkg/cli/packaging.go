@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// Project details for package metadata
+const (
+	projectURL     = "https://github.com/rejoice4156/passh"
+	projectLicense = "GPL-3.0-only"
+)
+
+// releaseVersion matches the versions of tagged releases, without the v
+var releaseVersion = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+func newDocsPackagingCmd() *cobra.Command {
+	var version string
+
+	cmd := &cobra.Command{
+		Use:   "packaging brew|scoop|nfpm",
+		Short: "Print package manager metadata for a release",
+		Long: "Print a template for packaging a release, which installs shell completion and the man " +
+			"page of every command along with the binary:\n\n" +
+			"  brew   a Homebrew formula building from the source tarball\n" +
+			"  scoop  a Scoop manifest for the Windows release archives\n" +
+			"  nfpm   an nfpm configuration building .deb and .rpm packages for apt and dnf\n\n" +
+			"The version defaults to the one passh was built as. Checksums and the maintainer are " +
+			"left as placeholders to fill in, as is done when a release is made.",
+		Example: "  passh docs packaging brew --version 1.2.0 > Formula/passh.rb\n" +
+			"  passh docs packaging nfpm > nfpm.yaml && nfpm package --packager deb",
+		Args:        cobra.ExactArgs(1),
+		ValidArgs:   []string{"brew", "scoop", "nfpm"},
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if version == "" {
+				version = strings.TrimPrefix(currentBuild().Version, "v")
+			}
+			version = strings.TrimPrefix(version, "v")
+			if !releaseVersion.MatchString(version) {
+				return fmt.Errorf("'%s' is not a release version; give one with --version, such as 1.2.0", version)
+			}
+			return writePackaging(cmd.OutOrStdout(), args[0], cmd.Root(), version)
+		},
+	}
+	cmd.Flags().StringVar(&version, "version", "", "Version to package (default: the version of this passh)")
+
+	return cmd
+}
+
+// packagingTemplates are the templates of each packaging format
+var packagingTemplates = map[string]string{
+	"brew": `class Passh < Formula
+  desc "{{.Description}}"
+  homepage "{{.URL}}"
+  url "{{.URL}}/archive/refs/tags/v{{.Version}}.tar.gz"
+  sha256 "SHA256_OF_SOURCE_TARBALL"
+  license "{{.License}}"
+
+  depends_on "go" => :build
+
+  def install
+    ldflags = "-s -w -X github.com/rejoice4156/passh/pkg/cli.version=v#{version}"
+    system "go", "build", *std_go_args(ldflags:), "./cmd/passh"
+    generate_completions_from_executable(bin/"passh", "completion")
+    system bin/"passh", "docs", "man", "--dir", "man"
+    man1.install Dir["man/*.1"]
+  end
+
+  test do
+    assert_match version.to_s, shell_output("#{bin}/passh version")
+  end
+end
+`,
+	"scoop": `{
+    "version": "{{.Version}}",
+    "description": "{{.Description}}",
+    "homepage": "{{.URL}}",
+    "license": "{{.License}}",
+    "architecture": {
+        "64bit": {
+            "url": "{{.URL}}/releases/download/v{{.Version}}/passh_windows_amd64.zip",
+            "hash": "SHA256_OF_WINDOWS_AMD64_ZIP"
+        },
+        "arm64": {
+            "url": "{{.URL}}/releases/download/v{{.Version}}/passh_windows_arm64.zip",
+            "hash": "SHA256_OF_WINDOWS_ARM64_ZIP"
+        }
+    },
+    "bin": "passh.exe",
+    "notes": "For tab completion, add this line to your $PROFILE: passh completion powershell | Out-String | Invoke-Expression",
+    "checkver": "github",
+    "autoupdate": {
+        "architecture": {
+            "64bit": {
+                "url": "{{.URL}}/releases/download/v$version/passh_windows_amd64.zip"
+            },
+            "arm64": {
+                "url": "{{.URL}}/releases/download/v$version/passh_windows_arm64.zip"
+            }
+        }
+    }
+}
+`,
+	"nfpm": `# Build the files listed below first:
+#   go build -ldflags "-X github.com/rejoice4156/passh/pkg/cli.version=v{{.Version}}" -o passh ./cmd/passh
+#   mkdir -p completions
+#   ./passh completion bash > completions/passh.bash
+#   ./passh completion zsh > completions/_passh
+#   ./passh completion fish > completions/passh.fish
+#   ./passh docs man --dir man
+name: passh
+arch: amd64
+platform: linux
+version: {{.Version}}
+section: utils
+priority: optional
+maintainer: MAINTAINER <EMAIL>
+description: {{.Description}}
+homepage: {{.URL}}
+license: {{.License}}
+depends:
+  - openssh-client
+overrides:
+  rpm:
+    depends:
+      - openssh-clients
+contents:
+  - src: ./passh
+    dst: /usr/bin/passh
+  - src: ./completions/passh.bash
+    dst: /usr/share/bash-completion/completions/passh
+  - src: ./completions/_passh
+    dst: /usr/share/zsh/vendor-completions/_passh
+  - src: ./completions/passh.fish
+    dst: /usr/share/fish/vendor_completions.d/passh.fish
+{{- range .ManPages}}
+  - src: ./man/{{.}}
+    dst: /usr/share/man/man1/{{.}}
+{{- end}}
+`,
+}
+
+// writePackaging writes the packaging template of a format for a version
+func writePackaging(w io.Writer, format string, root *cobra.Command, version string) error {
+	text, ok := packagingTemplates[format]
+	if !ok {
+		return fmt.Errorf("unknown packaging format '%s', expected brew, scoop or nfpm", format)
+	}
+	tmpl, err := template.New(format).Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct {
+		Description string
+		URL         string
+		License     string
+		Version     string
+		ManPages    []string
+	}{
+		Description: root.Short,
+		URL:         projectURL,
+		License:     projectLicense,
+		Version:     version,
+		ManPages:    manPages(root),
+	})
+}
+
+// manPages returns the names of the pages 'passh docs man' writes
+func manPages(cmd *cobra.Command) []string {
+	pages := []string{strings.ReplaceAll(cmd.CommandPath(), " ", "-") + ".1"}
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() && !sub.IsAdditionalHelpTopicCommand() {
+			pages = append(pages, manPages(sub)...)
+		}
+	}
+	return pages
+}
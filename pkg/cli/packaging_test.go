@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWritePackaging(t *testing.T) {
+	root := NewRootCmd()
+
+	var brew bytes.Buffer
+	if err := writePackaging(&brew, "brew", root, "1.2.0"); err != nil {
+		t.Fatalf("brew failed: %v", err)
+	}
+	for _, expected := range []string{"/archive/refs/tags/v1.2.0.tar.gz", `generate_completions_from_executable(bin/"passh", "completion")`, `man1.install Dir["man/*.1"]`} {
+		if !strings.Contains(brew.String(), expected) {
+			t.Errorf("Expected the formula to contain %q", expected)
+		}
+	}
+
+	var scoop bytes.Buffer
+	if err := writePackaging(&scoop, "scoop", root, "1.2.0"); err != nil {
+		t.Fatalf("scoop failed: %v", err)
+	}
+	var manifest struct {
+		Version string
+		Bin     string
+	}
+	if err := json.Unmarshal(scoop.Bytes(), &manifest); err != nil || manifest.Version != "1.2.0" || manifest.Bin != "passh.exe" {
+		t.Errorf("Unexpected scoop manifest %+v: %v", manifest, err)
+	}
+
+	if err := writePackaging(&bytes.Buffer{}, "apt", root, "1.2.0"); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+}
+
+func TestManPagesMatchDocsMan(t *testing.T) {
+	dir := t.TempDir()
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"docs", "man", "--dir", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []string
+	for _, file := range files {
+		written = append(written, file.Name())
+	}
+
+	pages := manPages(NewRootCmd())
+	sort.Strings(pages)
+	if !reflect.DeepEqual(pages, written) {
+		t.Errorf("Expected the packaged man pages %v to be those written, %v", pages, written)
+	}
+}
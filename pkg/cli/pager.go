@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// defaultPager is used when $PAGER is not set
+const defaultPager = "less"
+
+// pageOutput sends what the command prints next through $PAGER when standard
+// output is a terminal, so long output can be scrolled instead of running
+// past the scrollback. The returned function waits for the pager to exit and
+// must be called before anything else is written to the terminal.
+func pageOutput(cmd *cobra.Command) func() {
+	noPager, _ := cmd.Root().PersistentFlags().GetBool("no-pager")
+	stdout, ok := cmd.OutOrStdout().(*os.File)
+	if noPager || !ok || !term.IsTerminal(int(stdout.Fd())) {
+		return func() {}
+	}
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = defaultPager
+	}
+	// An empty $PAGER or cat turns paging off, as for git
+	args := strings.Fields(pager)
+	if len(args) == 0 || args[0] == "cat" {
+		return func() {}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		logging.Debugf("not paging output: %v", err)
+		return func() {}
+	}
+	process := exec.Command(args[0], args[1:]...)
+	process.Stdin, process.Stdout, process.Stderr = r, stdout, cmd.ErrOrStderr()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// Exit if everything fits on one screen, and keep colors
+		process.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := process.Start(); err != nil {
+		logging.Debugf("not paging output: %v", err)
+		r.Close()
+		w.Close()
+		return func() {}
+	}
+	r.Close()
+
+	cmd.SetOut(w)
+	done := false
+	return func() {
+		if done {
+			return
+		}
+		done = true
+		cmd.SetOut(stdout)
+		w.Close()
+		// Ctrl-C is for the pager, which exits when it is done
+		signal.Ignore(os.Interrupt)
+		defer signal.Reset(os.Interrupt)
+		if err := process.Wait(); err != nil {
+			logging.Debugf("pager: %v", err)
+		}
+	}
+}
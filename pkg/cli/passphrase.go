@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/keychain"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+)
+
+// Where passphrases of private keys can be cached between runs
+const (
+	passphraseCacheAgent    = "agent"
+	passphraseCacheKeychain = "keychain"
+)
+
+// defaultPassphraseTTL is how long a cached passphrase is kept
+const defaultPassphraseTTL = 15 * time.Minute
+
+// passphraseService names the keychain items holding cached passphrases
+const passphraseService = "passh-passphrase"
+
+// passphraseCache keeps the passphrase of private key files for a while, so
+// users without ssh-agent aren't asked for it on every run
+type passphraseCache struct {
+	kind string
+	ttl  time.Duration
+}
+
+// loadPassphraseCache returns the cache set by passphrase.cache and
+// passphrase.cache_ttl, or nil if passphrases aren't cached
+func loadPassphraseCache(cmd *cobra.Command) (*passphraseCache, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := cfg.Get("passphrase.cache")
+	switch kind {
+	case "":
+		return nil, nil
+	case passphraseCacheAgent, passphraseCacheKeychain:
+	default:
+		return nil, fmt.Errorf("invalid passphrase.cache '%s': must be %s or %s",
+			kind, passphraseCacheAgent, passphraseCacheKeychain)
+	}
+
+	ttl := defaultPassphraseTTL
+	if value := cfg.Get("passphrase.cache_ttl"); value != "" {
+		if ttl, err = parseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid passphrase.cache_ttl: %w", err)
+		}
+		if ttl < time.Second {
+			return nil, fmt.Errorf("passphrase.cache_ttl must be at least a second")
+		}
+	}
+	return &passphraseCache{kind: kind, ttl: ttl}, nil
+}
+
+// cacheKey identifies the passphrase of a key file
+func (c *passphraseCache) cacheKey(keyPath string) string {
+	if abs, err := filepath.Abs(keyPath); err == nil {
+		keyPath = abs
+	}
+	return "passphrase:" + keyPath
+}
+
+// get returns the cached passphrase of a key file, or nil. Cache problems
+// are only logged, as the passphrase can still be asked for.
+func (c *passphraseCache) get(keyPath string) []byte {
+	switch c.kind {
+	case passphraseCacheAgent:
+		client := runningAgent()
+		if client == nil {
+			logging.Debugf("not reading the cached passphrase: the passh agent is not running")
+			return nil
+		}
+		passphrase, found, err := client.Get(c.cacheKey(keyPath))
+		if err != nil {
+			logging.Warnf("failed to read the cached passphrase: %v", err)
+		}
+		if !found || len(passphrase) == 0 {
+			return nil
+		}
+		return passphrase
+
+	case passphraseCacheKeychain:
+		keys, err := keychain.Detect()
+		if err != nil {
+			logging.Warnf("failed to read the cached passphrase: %v", err)
+			return nil
+		}
+		item, err := keys.Get(passphraseService, c.cacheKey(keyPath))
+		if errors.Is(err, keychain.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			logging.Warnf("failed to read the cached passphrase: %v", err)
+			return nil
+		}
+		defer secure.Wipe(item)
+
+		// The keychain doesn't expire items, so each holds its expiry time
+		expiry, passphrase, ok := bytes.Cut(item, []byte("\n"))
+		expires, err := strconv.ParseInt(string(expiry), 10, 64)
+		if !ok || err != nil || time.Now().Unix() >= expires {
+			c.forget(keyPath)
+			return nil
+		}
+		return bytes.Clone(passphrase)
+	}
+	return nil
+}
+
+// put caches the passphrase of a key file
+func (c *passphraseCache) put(keyPath string, passphrase []byte) {
+	switch c.kind {
+	case passphraseCacheAgent:
+		client := runningAgent()
+		if client == nil {
+			logging.Infof("Start the passh agent to cache your passphrase: passh agent &")
+			return
+		}
+		if err := client.PutFor(c.cacheKey(keyPath), passphrase, c.ttl); err != nil {
+			logging.Warnf("failed to cache the passphrase: %v", err)
+			return
+		}
+
+	case passphraseCacheKeychain:
+		keys, err := keychain.Detect()
+		if err != nil {
+			logging.Warnf("failed to cache the passphrase: %v", err)
+			return
+		}
+		expires := strconv.FormatInt(time.Now().Add(c.ttl).Unix(), 10)
+		item := append([]byte(expires+"\n"), passphrase...)
+		err = keys.Set(passphraseService, c.cacheKey(keyPath), item)
+		secure.Wipe(item)
+		if err != nil {
+			logging.Warnf("failed to cache the passphrase: %v", err)
+			return
+		}
+	}
+	logging.Verbosef("Cached the passphrase of %s for %s", keyPath, c.ttl)
+}
+
+// forget removes the cached passphrase of a key file, such as one that no
+// longer unlocks it
+func (c *passphraseCache) forget(keyPath string) {
+	switch c.kind {
+	case passphraseCacheAgent:
+		// The agent has no way to drop one entry, so it is emptied instead
+		if client := runningAgent(); client != nil {
+			if err := client.Put(c.cacheKey(keyPath), nil); err != nil {
+				logging.Debugf("failed to forget the cached passphrase: %v", err)
+			}
+		}
+
+	case passphraseCacheKeychain:
+		keys, err := keychain.Detect()
+		if err == nil {
+			err = keys.Delete(passphraseService, c.cacheKey(keyPath))
+		}
+		if err != nil {
+			logging.Warnf("failed to remove the cached passphrase: %v", err)
+		}
+	}
+}
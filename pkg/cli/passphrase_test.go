@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/agent"
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func TestLoadPassphraseCache(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if cache, err := loadPassphraseCache(&cobra.Command{}); err != nil || cache != nil {
+		t.Fatalf("Expected no cache by default, got %v (%v)", cache, err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Set("passphrase.cache", "keychain")
+	cfg.Set("passphrase.cache_ttl", "1h")
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if cache, err := loadPassphraseCache(&cobra.Command{}); err != nil || cache.kind != passphraseCacheKeychain || cache.ttl != time.Hour {
+		t.Errorf("Expected a keychain cache for an hour, got %+v (%v)", cache, err)
+	}
+
+	cfg.Set("passphrase.cache", "disk")
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPassphraseCache(&cobra.Command{}); err == nil {
+		t.Error("Expected an unknown cache to be rejected")
+	}
+}
+
+func TestPassphraseCacheAgent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	t.Setenv(agent.SocketEnv, path)
+	server, err := agent.NewServer(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := agent.Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	cache := &passphraseCache{kind: passphraseCacheAgent, ttl: time.Minute}
+	if passphrase := cache.get("id_ed25519"); passphrase != nil {
+		t.Fatalf("Expected no cached passphrase, got %q", passphrase)
+	}
+	cache.put("id_ed25519", []byte("hunter2"))
+	if passphrase := cache.get("id_ed25519"); string(passphrase) != "hunter2" {
+		t.Errorf("Expected the cached passphrase, got %q", passphrase)
+	}
+	cache.forget("id_ed25519")
+	if passphrase := cache.get("id_ed25519"); passphrase != nil {
+		t.Errorf("Expected the passphrase to be forgotten, got %q", passphrase)
+	}
+}
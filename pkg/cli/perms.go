@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/passh"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// fixPerms tells whether loose permissions should be restricted rather than
+// only reported
+func fixPerms(cmd *cobra.Command) bool {
+	fix, _ := cmd.Flags().GetBool("fix-perms")
+	return fix
+}
+
+// checkStorePermissions warns about files of a local store that other users
+// can access, restricting them with --fix-perms, and about stores on network
+// mounts that anyone can read
+func checkStorePermissions(cmd *cobra.Command, store *storage.Store) error {
+	dir, ok := storage.LocalDir(store.Backend())
+	if !ok {
+		return nil
+	}
+
+	fix := fixPerms(cmd)
+	problems, err := store.CheckPermissions(fix)
+	if err != nil {
+		if fix {
+			return err
+		}
+		logging.Debugf("not checking store permissions: %v", err)
+	}
+	switch {
+	case len(problems) > 0 && fix:
+		logging.Infof("Restricted the permissions of %d files and directories of the store", len(problems))
+	case len(problems) > 0:
+		logging.Warnf("%d files and directories of the store can be accessed by other users, such as %s (%s); "+
+			"run with --fix-perms to restrict them", len(problems), problems[0].Path, problems[0].Detail)
+	}
+
+	fsType, err := secure.NetworkFilesystem(dir)
+	if err != nil || fsType == "" {
+		return nil
+	}
+	if info, err := os.Stat(dir); err == nil && info.Mode().Perm()&0007 != 0 {
+		logging.Warnf("WARNING: the store %s is on a %s network mount and readable by everyone; anyone with "+
+			"access to the share can copy your encrypted entries. Move it to a local disk or restrict the share.",
+			dir, fsType)
+	}
+	return nil
+}
+
+// checkKeyPermissions warns about a private key file other users can read,
+// restricting it with --fix-perms
+func checkKeyPermissions(cmd *cobra.Command, path string) error {
+	info, err := os.Stat(path)
+	if err != nil || runtime.GOOS == "windows" || info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+
+	if fixPerms(cmd) {
+		if err := os.Chmod(path, 0600); err != nil {
+			return fmt.Errorf("failed to restrict private key '%s': %w", path, err)
+		}
+		logging.Infof("Restricted private key %s to mode 0600", path)
+		return nil
+	}
+	logging.Warnf("private key %s has mode %04o and can be read by other users; run 'chmod 600 %s' or "+
+		"use --fix-perms", path, info.Mode().Perm(), path)
+	return nil
+}
+
+// loosePermissions lists the private key and the files of the local store
+// that other users can access, restricting them with fix
+func loosePermissions(cmd *cobra.Command, keyPath string, fix bool) ([]string, error) {
+	var loose []string
+	if info, err := os.Stat(keyPath); keyPath != "" && err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		if fix {
+			if err := os.Chmod(keyPath, 0600); err != nil {
+				return loose, fmt.Errorf("failed to restrict private key '%s': %w", keyPath, err)
+			}
+		}
+		loose = append(loose, keyPath)
+	}
+
+	dir, _ := cmd.Flags().GetString("store")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".passh")
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return loose, nil
+	}
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return loose, err
+	}
+	options, err := passh.BackendOptions(cfg, nil)
+	if err != nil {
+		return loose, err
+	}
+	backend, err := storage.OpenBackendWithOptions(dir, options)
+	if err != nil {
+		return loose, err
+	}
+	defer backend.Close()
+	problems, err := storage.NewStoreWithBackend(backend, nil).CheckPermissions(fix)
+	for _, problem := range problems {
+		loose = append(loose, filepath.Join(dir, problem.Path))
+	}
+	return loose, err
+}
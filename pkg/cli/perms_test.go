@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoosePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	key := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(key, []byte("key"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	store := filepath.Join(dir, "store")
+	if err := os.MkdirAll(filepath.Join(store, "web"), 0700); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(store, "web", "github.pass"), []byte("data"), 0640); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("store", store, "")
+
+	loose, err := loosePermissions(cmd, key, false)
+	if err != nil {
+		t.Fatalf("loosePermissions failed: %v", err)
+	}
+	if len(loose) != 2 {
+		t.Fatalf("Expected the key and entry to be reported, got %v", loose)
+	}
+
+	if _, err := loosePermissions(cmd, key, true); err != nil {
+		t.Fatalf("loosePermissions with fix failed: %v", err)
+	}
+	if loose, err := loosePermissions(cmd, key, false); err != nil || len(loose) != 0 {
+		t.Errorf("Expected nothing left to restrict, got %v (%v)", loose, err)
+	}
+	if info, err := os.Stat(key); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key to be restricted to 0600, got %v (%v)", info.Mode(), err)
+	}
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// progressWidth is the width of the bar in characters
+const progressWidth = 30
+
+// progressBar returns a progress function drawing a bar on stderr, and a
+// function ending the bar's line, which may be called early to print below
+// the bar. Nothing is drawn when stderr isn't a terminal or notices are
+// silenced with --quiet.
+func progressBar(label string) (storage.Progress, func()) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) || !logging.Enabled(logging.LevelInfo) {
+		return nil, func() {}
+	}
+
+	drawn := false
+	progress := func(done, total int) {
+		filled := progressWidth * done / total
+		fmt.Fprintf(os.Stderr, "\r%s [%s%s] %d/%d", label,
+			strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled), done, total)
+		drawn = true
+	}
+	finish := func() {
+		if drawn {
+			fmt.Fprintln(os.Stderr)
+			drawn = false
+		}
+	}
+	return progress, finish
+}
+
+// interruptible returns a context for a bulk operation that is cancelled by
+// the first Ctrl-C or SIGTERM, so entries in progress are finished and what
+// was done can be reported. A second Ctrl-C quits at once. The returned
+// function must be called when the operation is over.
+func interruptible(cmd *cobra.Command) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			// Restore the default handling for the second signal
+			signal.Stop(signals)
+			if term.IsTerminal(int(os.Stderr.Fd())) {
+				// Leave the progress bar and ^C on their line
+				fmt.Fprintln(os.Stderr)
+			}
+			logging.Warnf("Interrupted; finishing the entries in progress (press Ctrl-C again to quit now)")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
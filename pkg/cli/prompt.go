@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// errBatchInput is returned where input would be needed in batch mode
+var errBatchInput = errors.New("input required, but running with --batch")
+
+// isBatch reports whether prompts are disabled with --batch
+func isBatch(cmd *cobra.Command) bool {
+	batch, _ := cmd.Flags().GetBool("batch")
+	return batch
+}
+
+// confirm asks before doing something the user asked for, such as deleting
+// an entry. In batch mode the action goes ahead without asking.
+func confirm(cmd *cobra.Command, question string) bool {
+	if isBatch(cmd) {
+		return true
+	}
+	return askYesNo(cmd, question)
+}
+
+// offer asks whether to do something optional the user did not ask for. In
+// batch mode the offer is declined.
+func offer(cmd *cobra.Command, question string) bool {
+	if isBatch(cmd) {
+		return false
+	}
+	return askYesNo(cmd, question)
+}
+
+// askYesNo prompts for y/N; anything but yes, including read errors, is no
+func askYesNo(cmd *cobra.Command, question string) bool {
+	return cmdPrompter(cmd).Confirm(question)
+}
+
+// prompter asks the user for input. Commands get theirs from their app, so
+// tests and the TUI can answer prompts without a terminal.
+type prompter interface {
+	// ReadPassword asks for a secret without echoing it
+	ReadPassword(prompt string) ([]byte, error)
+	// ReadLine asks for a line of text, which is echoed
+	ReadLine(prompt string) (string, error)
+	// Confirm asks a yes or no question; anything but yes is no
+	Confirm(question string) bool
+	// Select asks for one of choices, each of which can be answered with
+	// its first letter, and returns its index
+	Select(question string, choices []string) (int, error)
+}
+
+// cmdPrompter returns the prompter of a command, which by default reads
+// from its input and prompts on its error output
+func cmdPrompter(cmd *cobra.Command) prompter {
+	if p := cmdApp(cmd).prompter; p != nil {
+		return p
+	}
+	return &streamPrompter{in: cmd.InOrStdin(), out: cmd.ErrOrStderr()}
+}
+
+// streamPrompter prompts on out, which is standard error so that standard
+// output only ever carries requested data, and reads answers from in
+type streamPrompter struct {
+	in  io.Reader
+	out io.Writer
+}
+
+// ReadPassword needs a terminal to turn off echo when in is a file, so a
+// secret piped to the command is never taken for a passphrase
+func (p *streamPrompter) ReadPassword(prompt string) ([]byte, error) {
+	fmt.Fprint(p.out, prompt)
+	defer fmt.Fprintln(p.out)
+	if file, ok := p.in.(*os.File); ok {
+		return term.ReadPassword(int(file.Fd()))
+	}
+	line, err := readLine(p.in)
+	return []byte(line), err
+}
+
+func (p *streamPrompter) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	line, err := readLine(p.in)
+	if err != nil {
+		fmt.Fprintln(p.out)
+	}
+	return line, err
+}
+
+func (p *streamPrompter) Confirm(question string) bool {
+	fmt.Fprintf(p.out, "%s (y/N): ", question)
+	response, err := readLine(p.in)
+	if err != nil {
+		fmt.Fprintln(p.out)
+		return false
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+// Select shows the choices as "[l]ocal, [r]emote or [b]oth"
+func (p *streamPrompter) Select(question string, choices []string) (int, error) {
+	labels := make([]string, len(choices))
+	for i, choice := range choices {
+		labels[i] = "[" + choice[:1] + "]" + choice[1:]
+	}
+	list := labels[len(labels)-1]
+	if len(labels) > 1 {
+		list = strings.Join(labels[:len(labels)-1], ", ") + " or " + list
+	}
+	fmt.Fprintf(p.out, "%s %s? ", question, list)
+
+	response, err := readLine(p.in)
+	if err != nil {
+		fmt.Fprintln(p.out)
+		return -1, fmt.Errorf("failed to read input: %w", err)
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	for i, choice := range choices {
+		if response != "" && (response == choice || response == choice[:1]) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("'%s' is not one of the choices", response)
+}
+
+// readLine reads one line without buffering past it, so later prompts and
+// commands reading the same input see the rest
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newPromptCmd(batch bool, input string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("batch", batch, "")
+	cmd.SetIn(strings.NewReader(input))
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	return cmd
+}
+
+func TestAskYesNoPromptsOnStderr(t *testing.T) {
+	cmd := newPromptCmd(false, "y\n")
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(stdout)
+	cmd.SetErr(stderr)
+
+	if !askYesNo(cmd, "Delete?") {
+		t.Fatal("Expected yes")
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Delete? (y/N)") {
+		t.Errorf("Expected prompt on stderr, got %q", stderr.String())
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		batch  bool
+		input  string
+		expect bool
+	}{
+		{false, "y\n", true},
+		{false, "YES\n", true},
+		{false, "n\n", false},
+		{false, "\n", false},
+		{false, "", false},
+		{true, "", true},
+	}
+
+	for _, test := range tests {
+		if got := confirm(newPromptCmd(test.batch, test.input), "Delete?"); got != test.expect {
+			t.Errorf("confirm(batch=%v, %q) = %v, expected %v", test.batch, test.input, got, test.expect)
+		}
+	}
+
+	if offer(newPromptCmd(true, "y\n"), "Generate a key?") {
+		t.Error("Expected offers to be declined in batch mode")
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	input := strings.NewReader("first\r\nsecond\nlast")
+	for _, expected := range []string{"first", "second", "last"} {
+		line, err := readLine(input)
+		if err != nil || line != expected {
+			t.Fatalf("Expected %q, got %q (%v)", expected, line, err)
+		}
+	}
+	if _, err := readLine(input); err == nil {
+		t.Fatal("Expected an error at end of input")
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	secret, err := readSecret(strings.NewReader("hunter2\n"))
+	if err != nil || string(secret) != "hunter2" {
+		t.Fatalf("Expected 'hunter2', got %q (%v)", secret, err)
+	}
+	secret, err = readSecret(strings.NewReader("  spaced \r\n"))
+	if err != nil || string(secret) != "  spaced " {
+		t.Fatalf("Expected surrounding spaces to be kept, got %q (%v)", secret, err)
+	}
+	if _, err := readSecret(strings.NewReader("\n")); err == nil {
+		t.Fatal("Expected an empty password to be rejected")
+	}
+}
+
+func TestBatchConflictResolver(t *testing.T) {
+	resolve, err := conflictResolver(newPromptCmd(true, ""), "prompt", nil)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	if _, err := resolve(storage.Conflict{Name: "github"}); !errors.Is(err, errBatchInput) {
+		t.Fatalf("Expected a batch input error, got %v", err)
+	}
+}
+
+// fakePrompter answers prompts from scripted answers
+type fakePrompter struct {
+	passwords []string
+	lines     []string
+	confirm   bool
+	choice    string
+	asked     []string
+}
+
+func (p *fakePrompter) ReadPassword(prompt string) ([]byte, error) {
+	p.asked = append(p.asked, prompt)
+	if len(p.passwords) == 0 {
+		return nil, errors.New("no more passwords")
+	}
+	password := p.passwords[0]
+	p.passwords = p.passwords[1:]
+	return []byte(password), nil
+}
+
+func (p *fakePrompter) ReadLine(prompt string) (string, error) {
+	p.asked = append(p.asked, prompt)
+	if len(p.lines) == 0 {
+		return "", io.EOF
+	}
+	line := p.lines[0]
+	p.lines = p.lines[1:]
+	return line, nil
+}
+
+func (p *fakePrompter) Confirm(question string) bool {
+	p.asked = append(p.asked, question)
+	return p.confirm
+}
+
+func (p *fakePrompter) Select(question string, choices []string) (int, error) {
+	p.asked = append(p.asked, question)
+	for i, choice := range choices {
+		if choice == p.choice {
+			return i, nil
+		}
+	}
+	return -1, errors.New("not a choice")
+}
+
+func TestStreamPrompterSelect(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	prompt := &streamPrompter{in: strings.NewReader("R\nboth\nx\n"), out: stderr}
+	choices := []string{"local", "remote", "both"}
+
+	for _, expected := range []int{1, 2} {
+		if choice, err := prompt.Select("Keep", choices); err != nil || choice != expected {
+			t.Fatalf("Expected %d, got %d (%v)", expected, choice, err)
+		}
+	}
+	if _, err := prompt.Select("Keep", choices); err == nil {
+		t.Error("Expected an answer that isn't a choice to fail")
+	}
+	if !strings.Contains(stderr.String(), "Keep [l]ocal, [r]emote or [b]oth? ") {
+		t.Errorf("Expected the choices on stderr, got %q", stderr.String())
+	}
+}
+
+func TestStreamPrompterReadPassword(t *testing.T) {
+	prompt := &streamPrompter{in: strings.NewReader("hunter2\n"), out: new(bytes.Buffer)}
+	if password, err := prompt.ReadPassword("Password: "); err != nil || string(password) != "hunter2" {
+		t.Errorf("Expected 'hunter2', got %q (%v)", password, err)
+	}
+}
+
+func TestCommandsWithFakePrompter(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	encryptor, err := crypto.NewPassphraseEncryptor([]byte("passphrase"), crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := storage.NewMemoryBackend()
+	run := func(prompt prompter, args ...string) error {
+		rootCmd := NewRootCmd()
+		rootCmd.SetArgs(args)
+		store := storage.NewStoreWithBackend(backend, encryptor)
+		return rootCmd.ExecuteContext(withApp(context.Background(), &app{encryptor: encryptor, store: store, prompter: prompt}))
+	}
+
+	prompt := &fakePrompter{passwords: []string{"hunter2", "hunter2"}}
+	if err := run(prompt, "add", "web/mail"); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if len(prompt.asked) != 2 {
+		t.Errorf("Expected the password and its confirmation to be asked for, got %q", prompt.asked)
+	}
+
+	if err := run(&fakePrompter{passwords: []string{"one", "two"}}, "add", "web/bank"); err == nil {
+		t.Error("Expected passwords that don't match to fail")
+	}
+
+	// Declining the confirmation keeps the entry
+	if err := run(&fakePrompter{confirm: false}, "delete", "web/mail"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := backend.Get("web/mail"); err != nil {
+		t.Errorf("Expected a declined delete to keep the entry, got %v", err)
+	}
+	if err := run(&fakePrompter{confirm: true}, "delete", "web/mail"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := backend.Get("web/mail"); err == nil {
+		t.Error("Expected a confirmed delete to remove the entry")
+	}
+}
+
+func TestPromptConflict(t *testing.T) {
+	conflict := storage.Conflict{Name: "github", LocalExists: true, RemoteExists: true}
+	resolution, err := promptConflict(io.Discard, &fakePrompter{choice: "remote"}, conflict, nil)
+	if err != nil || resolution != storage.KeepRemote {
+		t.Errorf("Expected KeepRemote, got %v (%v)", resolution, err)
+	}
+	if _, err := promptConflict(io.Discard, &fakePrompter{choice: "merge"}, conflict, nil); err == nil {
+		t.Error("Expected merge not to be offered without a merge function")
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// qrPNGSize is the width and height in pixels of QR code images
+const qrPNGSize = 384
+
+// printQR renders content as a QR code made of block characters
+func printQR(out io.Writer, content []byte) error {
+	// go-qrcode only takes strings, so this copy can't be wiped
+	qr, err := qrcode.New(string(content), qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to create QR code: %w", err)
+	}
+	fmt.Fprint(out, qr.ToSmallString(false))
+	return nil
+}
+
+// writeQRPNG writes content as a QR code PNG image readable only by the user
+func writeQRPNG(path string, content []byte) error {
+	qr, err := qrcode.New(string(content), qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to create QR code: %w", err)
+	}
+	png, err := qr.PNG(qrPNGSize)
+	if err != nil {
+		return fmt.Errorf("failed to render QR code: %w", err)
+	}
+	if err := os.WriteFile(path, png, 0600); err != nil {
+		return fmt.Errorf("failed to write QR code: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,424 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newRecipientsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Show who can read entries",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list [PREFIX]",
+		Short: "List the keys entries are encrypted to",
+		Long: "List the SSH keys each entry under PREFIX is encrypted to, by type and SHA256 " +
+			"fingerprint as 'ssh-keygen -lf' shows them, so you can check who can read shared entries " +
+			"before pushing them. This reads the encrypted files and needs no private key. Entries " +
+			"not yet re-encrypted after their " + storage.RecipientsFile + " file changed are marked.",
+		Example: "  passh recipients list\n" +
+			"  passh recipients list team",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix := ""
+			if len(args) == 1 {
+				prefix = args[0]
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			entries, err := store.ListRecipients(prefix)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 && prefix != "" {
+				return fmt.Errorf("%w: %s", storage.ErrNotFound, prefix)
+			}
+
+			own := ownKeys(cmd)
+			stale := 0
+			for _, entry := range entries {
+				fmt.Fprintln(cmd.OutOrStdout(), entry.Name)
+				printRecipientKeys(cmd.OutOrStdout(), store, entry.Keys, own)
+				if entry.Stale {
+					fmt.Fprintln(cmd.OutOrStdout(), "  ! recipients changed since it was encrypted")
+					stale++
+				}
+			}
+			if stale > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "\n%d entries don't match their recipients; run 'passh reencrypt' to update them\n", stale)
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(newRecipientsAddCmd())
+	cmd.AddCommand(newRecipientsSyncCmd())
+
+	return cmd
+}
+
+func newRecipientsAddCmd() *cobra.Command {
+	var folder string
+	var fromFile string
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "add RECIPIENT...",
+		Short: "Share a folder with more keys",
+		Long: "Add keys to the " + storage.RecipientsFile + " file of --folder, or of the whole store. " +
+			"Each RECIPIENT is a public key file, an authorized_keys line, or github:USER or gitlab:USER " +
+			"for the SSH keys a user published there, fetched over HTTPS. The keys' fingerprints are " +
+			"shown for confirmation first; compare them with the ones your teammate sees.\n\n" +
+			"--from-file imports every key in an authorized_keys file or HTTPS URL, such as a keys file " +
+			"your team maintains, and records it as the source of those keys so 'passh recipients sync' " +
+			"can keep them up to date. Keys are named by their comments.\n\n" +
+			"A folder without a recipients file gets one that also lists the keys its entries are " +
+			"encrypted to now. New entries are encrypted to the added keys; run 'passh reencrypt' to " +
+			"share the existing ones.",
+		Example: "  passh recipients add github:alice\n" +
+			"  passh recipients add --folder team gitlab:bob carol.pub\n" +
+			"  passh recipients add --folder team --from-file https://example.com/team.keys",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if fromFile != "" && len(args) > 0 {
+				return errors.New("--from-file can't be combined with RECIPIENT arguments")
+			}
+			if fromFile != "" {
+				return nil
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fromFile != "" {
+				return importRecipients(cmd, folder, fromFile, yes)
+			}
+
+			var keys []recipientKey
+			for _, recipient := range args {
+				parsed, err := parseRecipientKeys(recipient)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, parsed...)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			target := "the whole store"
+			if folder = strings.Trim(folder, "/"); folder != "" {
+				target = "'" + folder + "'"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Keys to share %s with:\n", target)
+			lines := make([][]byte, len(keys))
+			for i, key := range keys {
+				lines[i] = key.line
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", strings.TrimSpace(keyLabel(key.key, nil)+" "+keyComment(key.line)))
+			}
+			if !yes && !confirm(cmd, fmt.Sprintf("Add %d keys as recipients?", len(keys))) {
+				fmt.Fprintln(cmd.OutOrStdout(), "No recipients added")
+				return nil
+			}
+
+			added, err := store.AddRecipients(folder, lines)
+			if err != nil {
+				return err
+			}
+			if len(added) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All keys are already recipients")
+				return nil
+			}
+			logging.Infof("Added %d keys to %s", len(added), path.Join(folder, storage.RecipientsFile))
+			logging.Infof("Run '%s' to share existing entries with them", strings.TrimSpace("passh reencrypt "+folder))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&folder, "folder", "", "Folder to share (default: the whole store)")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Import the keys in an authorized_keys file or HTTPS URL, and keep them in sync with it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Add the keys without asking")
+
+	return cmd
+}
+
+func newRecipientsSyncCmd() *cobra.Command {
+	var folder string
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Update recipients imported with --from-file",
+		Long: "Read the keys files that 'passh recipients add --from-file' imported again, and update " +
+			"the recipients files of --folder, or of every folder, to match them. Keys added to a source " +
+			"are added, and keys removed from it are removed; the changes are shown for confirmation " +
+			"first. Run it periodically, for example from cron, to follow a team's keys file.\n\n" +
+			"Existing entries keep their recipients until 'passh reencrypt' is run, so run it after " +
+			"keys were removed.",
+		Example: "  passh recipients sync\n" +
+			"  passh recipients sync --folder team --yes && passh reencrypt team --yes",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			folders := []string{strings.Trim(folder, "/")}
+			if !cmd.Flags().Changed("folder") {
+				if folders, err = store.RecipientFolders(); err != nil {
+					return err
+				}
+			}
+
+			type update struct {
+				folder, source string
+				keys           []recipientKey
+			}
+			var updates []update
+			for _, folder := range folders {
+				sources, err := store.RecipientSources(folder)
+				if err != nil {
+					return err
+				}
+				for _, source := range sources {
+					data, err := readKeySource(source)
+					if err != nil {
+						return err
+					}
+					keys, err := importKeyLines(source, data)
+					if err != nil {
+						return err
+					}
+					change, err := store.ImportChanges(folder, source, recipientLines(keys))
+					if err != nil {
+						return err
+					}
+					if len(change.Added) == 0 && len(change.Removed) == 0 {
+						continue
+					}
+					printImportChange(cmd.OutOrStdout(), store, change, keys, source)
+					updates = append(updates, update{folder, source, keys})
+				}
+			}
+			if len(updates) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All recipients match their sources")
+				return nil
+			}
+
+			if !yes && !confirm(cmd, fmt.Sprintf("Update %d recipients files?", len(updates))) {
+				fmt.Fprintln(cmd.OutOrStdout(), "No recipients changed")
+				return nil
+			}
+			for _, update := range updates {
+				if err := store.ImportRecipients(update.folder, update.source, recipientLines(update.keys)); err != nil {
+					return err
+				}
+			}
+			logging.Infof("Updated %d recipients files", len(updates))
+			logging.Infof("Run 'passh reencrypt' to re-encrypt existing entries to them")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&folder, "folder", "", "Only update the recipients of this folder")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Update without asking")
+
+	return cmd
+}
+
+// importRecipients imports the keys in a keys file into the recipients file
+// of a folder, for recipients add --from-file
+func importRecipients(cmd *cobra.Command, folder, source string, yes bool) error {
+	data, err := readKeySource(source)
+	if err != nil {
+		return err
+	}
+	// Relative paths are recorded as absolute ones, so sync finds them
+	if !strings.HasPrefix(source, "https://") {
+		if source, err = filepath.Abs(source); err != nil {
+			return err
+		}
+	}
+	keys, err := importKeyLines(source, data)
+	if err != nil {
+		return err
+	}
+
+	store, err := getStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	change, err := store.ImportChanges(folder, source, recipientLines(keys))
+	if err != nil {
+		return err
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "All keys are already recipients")
+	} else {
+		printImportChange(cmd.OutOrStdout(), store, change, keys, source)
+	}
+	if !yes && !confirm(cmd, fmt.Sprintf("Import the recipients from %s?", source)) {
+		fmt.Fprintln(cmd.OutOrStdout(), "No recipients added")
+		return nil
+	}
+
+	if err := store.ImportRecipients(folder, source, recipientLines(keys)); err != nil {
+		return err
+	}
+	logging.Infof("Imported %d keys from %s into %s", len(keys), source, change.Name)
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		logging.Infof("Run '%s' to re-encrypt existing entries to them", strings.TrimSpace("passh reencrypt "+strings.Trim(folder, "/")))
+	}
+	return nil
+}
+
+// recipientLines returns the authorized_keys lines of recipients
+func recipientLines(keys []recipientKey) [][]byte {
+	lines := make([][]byte, len(keys))
+	for i, key := range keys {
+		lines[i] = key.line
+	}
+	return lines
+}
+
+// printImportChange shows the keys importing from a source adds to and
+// removes from a recipients file, with their names
+func printImportChange(out io.Writer, store *storage.Store, change storage.RecipientChange, keys []recipientKey, source string) {
+	names := make(map[string]string)
+	for _, key := range keys {
+		names[ssh.FingerprintSHA256(crypto.CertifiedKey(key.key))] = keyComment(key.line)
+	}
+	label := func(key ssh.PublicKey) string {
+		name := names[ssh.FingerprintSHA256(crypto.CertifiedKey(key))]
+		if name == "" {
+			name = store.RecipientName(key)
+		}
+		return strings.TrimSpace(keyLabel(key, nil) + " " + name)
+	}
+
+	fmt.Fprintf(out, "%s from %s:\n", change.Name, source)
+	for _, key := range change.Added {
+		fmt.Fprintf(out, "  + %s\n", label(key))
+	}
+	for _, key := range change.Removed {
+		fmt.Fprintf(out, "  - %s\n", label(key))
+	}
+}
+
+// keyComment returns the comment of an authorized_keys line, such as the
+// github:USER it was fetched for
+func keyComment(line []byte) string {
+	fields := strings.SplitN(strings.TrimSpace(string(line)), " ", 3)
+	if len(fields) < 3 {
+		return ""
+	}
+	return fields[2]
+}
+
+// printEntryRecipients prints the keys an entry is encrypted to, for info
+func printEntryRecipients(cmd *cobra.Command, store *storage.Store, name string) error {
+	entries, err := store.ListRecipients(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name != name {
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Recipients:\n")
+		printRecipientKeys(cmd.OutOrStdout(), store, entry.Keys, ownKeys(cmd))
+		if entry.Stale {
+			fmt.Fprintln(cmd.OutOrStdout(), "  ! recipients changed since it was encrypted; run 'passh reencrypt'")
+		}
+	}
+	return nil
+}
+
+// printRecipientKeys prints one key per line, with the name its recipients
+// file gives it
+func printRecipientKeys(out io.Writer, store *storage.Store, keys []ssh.PublicKey, own []ssh.PublicKey) {
+	for _, key := range keys {
+		fmt.Fprintf(out, "  %s\n", strings.TrimSpace(keyLabel(key, own)+" "+store.RecipientName(key)))
+	}
+}
+
+// printDecryptAttempts shows the keys an entry is encrypted to and whether
+// each loaded private key is one of them, for get --attempts
+func printDecryptAttempts(cmd *cobra.Command, store *storage.Store, name string) error {
+	encryptor, err := resolvedEncryptor(cmd)
+	if err != nil {
+		return err
+	}
+	keyring, ok := encryptor.(interface{ DecryptionKeys() []ssh.PublicKey })
+	if !ok {
+		return errors.New("the encryption backend doesn't use SSH keys")
+	}
+
+	entries, err := store.ListRecipients(name)
+	if err != nil {
+		return err
+	}
+	var recipients []ssh.PublicKey
+	for _, entry := range entries {
+		if entry.Name == name {
+			recipients = entry.Keys
+		}
+	}
+
+	stderr := cmd.ErrOrStderr()
+	fmt.Fprintf(stderr, "'%s' is encrypted to:\n", name)
+	for _, key := range recipients {
+		fmt.Fprintf(stderr, "  %s\n", strings.TrimSpace(keyLabel(key, nil)+" "+store.RecipientName(key)))
+	}
+
+	fmt.Fprintln(stderr, "Private keys tried:")
+	keys := keyring.DecryptionKeys()
+	if len(keys) == 0 {
+		fmt.Fprintln(stderr, "  none loaded")
+	}
+	used := false
+	for _, key := range keys {
+		result := "not a recipient"
+		if containsKey(recipients, key) {
+			result = "a recipient"
+			if !used {
+				result, used = "decrypted it", true
+			}
+		}
+		fmt.Fprintf(stderr, "  %s: %s\n", keyLabel(key, nil), result)
+	}
+	return nil
+}
+
+// containsKey reports whether keys holds key, comparing certified keys
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, candidate := range keys {
+		if bytes.Equal(crypto.CertifiedKey(candidate).Marshal(), crypto.CertifiedKey(key).Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newRecoveryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recovery",
+		Short: "Keep an account's one-time recovery codes",
+		Long: "Store the recovery codes a site gives out for when its second factor is lost, and take " +
+			"them one at a time. The codes are kept in the account's entry as 'recovery: CODE' lines, " +
+			"which become 'recovery-used: CODE' once used. 'passh audit' reports entries with " +
+			fmt.Sprintf("%d or fewer unused codes left.", storage.LowRecoveryCodes),
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add NAME [CODE...]",
+		Short: "Store recovery codes in an entry, replacing its old ones",
+		Long: "Store recovery codes in an existing entry, replacing any it had, used or not. The codes " +
+			"are given as arguments, or one per line on standard input, as copied from the site.",
+		Example:           "  passh recovery add web/github < github-recovery-codes.txt",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, codes := args[0], args[1:]
+			if len(codes) == 0 {
+				if !isBatch(cmd) && term.IsTerminal(int(os.Stdin.Fd())) {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Enter the recovery codes for '%s', one per line, and press Ctrl+D when finished:\n", name)
+				}
+				content, err := readMultiline(cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				codes = parseRecoveryCodes(content)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := store.SetRecoveryCodes(name, codes); err != nil {
+				return err
+			}
+			logging.Infof("Stored %d recovery codes in '%s'", len(codes), name)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "use NAME",
+		Short:             "Print the next unused recovery code and mark it used",
+		Example:           "  passh recovery use web/github",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			code, left, err := store.UseRecoveryCode(name)
+			if err != nil {
+				return err
+			}
+			recordAccess(cmd, name)
+
+			fmt.Fprintln(cmd.OutOrStdout(), code)
+			if left <= storage.LowRecoveryCodes {
+				logging.Warnf("'%s' has %d unused recovery codes left; generate new ones and store them with 'passh recovery add'", name, left)
+			} else {
+				logging.Infof("%d unused recovery codes left", left)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// parseRecoveryCodes takes one code per line, skipping blank lines and the
+// numbering some sites put in front of each code
+func parseRecoveryCodes(content []byte) []string {
+	var codes []string
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if number, rest, ok := bytes.Cut(line, []byte(". ")); ok && len(bytes.Trim(number, "0123456789")) == 0 && len(number) > 0 {
+			line = bytes.TrimSpace(rest)
+		}
+		if len(line) > 0 {
+			codes = append(codes, string(line))
+		}
+	}
+	return codes
+}
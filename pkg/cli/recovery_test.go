@@ -0,0 +1,14 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRecoveryCodes(t *testing.T) {
+	codes := parseRecoveryCodes([]byte("1. abcd-1234\n2. efgh-5678\n\n  1234 5678  \n"))
+	expected := []string{"abcd-1234", "efgh-5678", "1234 5678"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Expected %v, got %v", expected, codes)
+	}
+}
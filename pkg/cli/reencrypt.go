@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newReencryptCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "reencrypt [PREFIX]",
+		Short: "Re-encrypt entries after their recipients changed",
+		Long: "Re-encrypt entries whose recipients changed, for example after editing a " +
+			storage.RecipientsFile + " file. Each directory's entries are encrypted to the keys in the " +
+			"nearest " + storage.RecipientsFile + " file up the tree, or to your own keys if there is none.\n\n" +
+			"Before anything is rewritten, the keys that gain or lose access are shown for confirmation. " +
+			"--dry-run shows them and the entries that would be re-encrypted, and stops there.",
+		Example: "  passh reencrypt\n" +
+			"  passh reencrypt team --yes",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{dryRunAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix := ""
+			if len(args) == 1 {
+				prefix = args[0]
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			changes, err := store.RecipientChanges(prefix)
+			if err != nil {
+				return err
+			}
+			if len(changes) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All entries are already encrypted to their recipients")
+				return nil
+			}
+
+			printRecipientChanges(cmd.OutOrStdout(), changes, ownKeys(cmd))
+
+			names := make([]string, len(changes))
+			for i, change := range changes {
+				names[i] = change.Name
+			}
+			if err := store.CheckPolicy(names); err != nil {
+				return err
+			}
+			if isDryRun(cmd) {
+				for _, name := range names {
+					fmt.Fprintf(cmd.OutOrStdout(), "Would re-encrypt %s\n", name)
+				}
+				return nil
+			}
+
+			if !yes && !confirm(cmd, fmt.Sprintf("Re-encrypt %d entries?", len(changes))) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Re-encryption cancelled")
+				return nil
+			}
+
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			progress, finish := progressBar("Re-encrypting")
+			store.SetProgress(progress)
+			store.SetContext(ctx)
+			err = store.ReencryptEntries(names)
+			finish()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Re-encrypted %d entries\n", len(names))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+
+	return cmd
+}
+
+// printRecipientChanges shows which keys gain or lose access to how many entries
+func printRecipientChanges(out io.Writer, changes []storage.RecipientChange, own []ssh.PublicKey) {
+	added := make(map[string]int)
+	removed := make(map[string]int)
+	labels := make(map[string]string)
+
+	label := func(key ssh.PublicKey) string {
+		fingerprint := ssh.FingerprintSHA256(key)
+		labels[fingerprint] = keyLabel(key, own)
+		return fingerprint
+	}
+
+	for _, change := range changes {
+		for _, key := range change.Added {
+			added[label(key)]++
+		}
+		for _, key := range change.Removed {
+			removed[label(key)]++
+		}
+	}
+
+	fmt.Fprintf(out, "%d entries will change recipients:\n", len(changes))
+	for _, fingerprint := range sortedKeys(added) {
+		fmt.Fprintf(out, "  + %s gains access to %d entries\n", labels[fingerprint], added[fingerprint])
+	}
+	for _, fingerprint := range sortedKeys(removed) {
+		fmt.Fprintf(out, "  - %s loses access to %d entries\n", labels[fingerprint], removed[fingerprint])
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// ownKeys returns the public keys of the current user, if the encryptor
+// uses SSH keys
+func ownKeys(cmd *cobra.Command) []ssh.PublicKey {
+	if encryptor, ok := cmdApp(cmd).encryptor.(crypto.RecipientEncryptor); ok {
+		return encryptor.PublicKeys()
+	}
+	return nil
+}
+
+// keyLabel shows a key's type and fingerprint, marking the user's own keys.
+// Certificates also show their CA and when they expire.
+func keyLabel(key ssh.PublicKey, own []ssh.PublicKey) string {
+	text := key.Type() + " " + ssh.FingerprintSHA256(crypto.CertifiedKey(key))
+	if cert, ok := key.(*ssh.Certificate); ok {
+		text += " " + certificateLabel(cert, time.Now())
+	}
+	for _, ownKey := range own {
+		if bytes.Equal(crypto.CertifiedKey(ownKey).Marshal(), crypto.CertifiedKey(key).Marshal()) {
+			return text + " (you)"
+		}
+	}
+	return text
+}
+
+// certificateLabel shows who signed a certificate and its validity window
+func certificateLabel(cert *ssh.Certificate, now time.Time) string {
+	ca := "CA " + ssh.FingerprintSHA256(cert.SignatureKey)
+	if err := crypto.CheckCertificate(cert, now); err != nil {
+		return fmt.Sprintf("[%s, %v]", ca, err)
+	}
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return "[" + ca + ", valid forever]"
+	}
+	until := time.Unix(int64(cert.ValidBefore), 0)
+	return fmt.Sprintf("[%s, valid until %s]", ca, until.Local().Format(timeFormat))
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/relay"
+	"github.com/spf13/cobra"
+)
+
+func newRelayCmd() *cobra.Command {
+	var listen, maxTTL, tlsCert, tlsKey, metrics string
+	var behindProxy bool
+
+	cmd := &cobra.Command{
+		Use:   "relay",
+		Short: "Serve one-time links made with 'passh share --link'",
+		Long: "Run a relay in the foreground that holds secrets shared with 'passh share --link' until " +
+			"they are viewed once or expire, at most --max-ttl. Secrets are encrypted before they are " +
+			"uploaded and the relay never sees their keys, which only travel in the links. Secrets are " +
+			"kept in memory, so restarting the relay burns them all.\n\n" +
+			"Links are opened in a browser, so serve the relay over HTTPS, with --tls-cert and --tls-key " +
+			"or behind a reverse proxy, and point share.relay at its public URL. Behind a proxy, pass " +
+			"--behind-proxy so clients are told apart by the address it forwards.\n\n" +
+			"Each client address is rate limited, can hold at most 100 secrets and is locked out, for " +
+			"longer each time, after fetching several links that are gone, so no one can fill the " +
+			"relay or guess links. With --metrics the relay serves Prometheus metrics on " +
+			"http://ADDR/metrics: refused requests by reason and the number of secrets held.",
+		Example: "  passh relay --listen :8443 --tls-cert relay.crt --tls-key relay.key\n" +
+			"  passh config set share.relay https://relay.example.com",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			duration, err := parseDuration(maxTTL)
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("invalid --max-ttl '%s'", maxTTL)
+			}
+			if (tlsCert == "") != (tlsKey == "") {
+				return errors.New("--tls-cert and --tls-key must be given together")
+			}
+
+			listener, err := net.Listen("tcp", listen)
+			if err != nil {
+				return fmt.Errorf("failed to listen: %w", err)
+			}
+			relayServer := relay.NewServer(duration)
+			relayServer.SetBehindProxy(behindProxy)
+			server := &http.Server{Handler: relayServer.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-signals
+				server.Close()
+			}()
+
+			if metrics != "" {
+				metricsListener, err := net.Listen("tcp", metrics)
+				if err != nil {
+					listener.Close()
+					return fmt.Errorf("failed to serve metrics: %w", err)
+				}
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", relayServer.MetricsHandler())
+				metricsServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+				defer metricsServer.Close()
+				go metricsServer.Serve(metricsListener)
+				logging.Infof("Serving metrics on http://%s/metrics", metricsListener.Addr())
+			}
+
+			scheme := "http"
+			if tlsCert != "" {
+				scheme = "https"
+			}
+			logging.Infof("passh relay listening on %s://%s, keeping secrets for at most %s", scheme, listener.Addr(), duration)
+			if tlsCert != "" {
+				err = server.ServeTLS(listener, tlsCert, tlsKey)
+			} else {
+				err = server.Serve(listener)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", "localhost:8420", "Address to listen on")
+	cmd.Flags().StringVar(&maxTTL, "max-ttl", "7d", "Longest time a secret is kept, e.g. 24h or 7d")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "Certificate file to serve HTTPS with")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "Private key file of --tls-cert")
+	cmd.Flags().BoolVar(&behindProxy, "behind-proxy", false, "Tell clients apart by the last X-Forwarded-For address, for a relay only reachable through a reverse proxy")
+	cmd.Flags().StringVar(&metrics, "metrics", "", "Serve Prometheus metrics on this address, such as localhost:9421")
+
+	return cmd
+}
+
+// relayURL returns the relay to share links through, from --relay or the
+// share.relay setting
+func relayURL(cmd *cobra.Command, flag string) (string, error) {
+	if flag == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return "", err
+		}
+		flag = cfg.Get("share.relay")
+	}
+	if flag == "" {
+		return "", errors.New("no relay to share the link through; pass --relay or run 'passh config set share.relay URL'")
+	}
+
+	parsed, err := url.Parse(flag)
+	if err != nil {
+		return "", fmt.Errorf("invalid relay URL '%s': %w", flag, err)
+	}
+	if parsed.Scheme == "http" && !isLoopback(parsed.Hostname()) {
+		logging.Warnf("The relay %s doesn't use HTTPS, so the link can be read on the way", flag)
+	}
+	return flag, nil
+}
+
+// isLoopback reports whether host only reaches this machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
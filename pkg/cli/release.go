@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// confirmRelease returns the check the store runs before releasing an entry
+// marked "confirm: true": a touch of a security key in ssh-agent if there is
+// one, or else a yes on the terminal. The question is not read from standard
+// input, which a script could answer.
+func confirmRelease(cmd *cobra.Command) func(name string) error {
+	// Bulk reads ask from several goroutines, one question at a time
+	var mu sync.Mutex
+	return func(name string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if isBatch(cmd) {
+			return fmt.Errorf("entry '%s' is marked 'confirm: true', which --batch can't confirm: %w",
+				name, storage.ErrNotConfirmed)
+		}
+
+		signer, err := crypto.SecurityKey()
+		if err == nil {
+			logging.Infof("Touch your security key to release '%s'", name)
+			if err := crypto.Touch(signer); err != nil {
+				return fmt.Errorf("entry '%s': %w: %v", name, storage.ErrNotConfirmed, err)
+			}
+			return nil
+		}
+		if !errors.Is(err, crypto.ErrNoSecurityKey) {
+			logging.Debugf("not using a security key: %v", err)
+		}
+
+		if !askTerminal(fmt.Sprintf("Release '%s', which is marked for confirmation?", name)) {
+			return fmt.Errorf("entry '%s': %w", name, storage.ErrNotConfirmed)
+		}
+		return nil
+	}
+}
+
+// askTerminal asks a y/N question on the controlling terminal, bypassing
+// redirected input. Without a terminal the answer is no.
+func askTerminal(question string) bool {
+	in, out := "/dev/tty", "/dev/tty"
+	if runtime.GOOS == "windows" {
+		in, out = "CONIN$", "CONOUT$"
+	}
+	reader, err := os.Open(in)
+	if err != nil {
+		logging.Warnf("no terminal to confirm on: %v", err)
+		return false
+	}
+	defer reader.Close()
+	var writer io.Writer = os.Stderr
+	if tty, err := os.OpenFile(out, os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		writer = tty
+	}
+
+	fmt.Fprintf(writer, "%s (y/N): ", question)
+	response, err := readLine(reader)
+	if err != nil {
+		fmt.Fprintln(writer)
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
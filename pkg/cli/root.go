@@ -1,24 +1,26 @@
 package cli
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"syscall"
+	"slices"
 
 	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/passh"
+	"github.com/rejoice4156/passh/pkg/secure"
 	"github.com/rejoice4156/passh/pkg/storage"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 // Default SSH key paths - prioritize modern Ed25519 keys over RSA
 var (
 	defaultSSHDir         = filepath.Join(os.Getenv("HOME"), ".ssh")
-	defaultSSHPrivateKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"} // Ed25519 first, RSA last
-	defaultSSHPublicKeys  = []string{"id_ed25519.pub", "id_ecdsa.pub", "id_rsa.pub"}
+	defaultSSHPrivateKeys = passh.DefaultPrivateKeys
+	defaultSSHPublicKeys  = passh.DefaultPublicKeys
 )
 
 // NewRootCmd creates the root command
@@ -27,45 +29,276 @@ func NewRootCmd() *cobra.Command {
 	var publicKeyPath string
 	var privateKeyPath string
 	var noAgent bool
+	var pkcs11Module string
+	var hostKey string
+	var batch bool
+	var quiet bool
+	var verbose bool
+	var debug bool
+	var logFormat string
+	var color string
 
 	rootCmd := &cobra.Command{
 		Use:   "passh",
 		Short: "A terminal password manager backed by SSH keys",
+		// main prints errors, so that they go to stderr exactly once
+		SilenceErrors: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			// Skip setup for completion and help commands
-			if cmd.Name() == "completion" || cmd.Name() == "help" {
+			// Arguments have been validated by now, so later errors are not
+			// usage mistakes and shouldn't print the usage
+			cmd.SilenceUsage = true
+			setStreams(cmd)
+
+			if err := applyFlagEnv(cmd); err != nil {
+				return err
+			}
+			if err := setLogLevel(quiet, verbose, debug); err != nil {
+				return err
+			}
+			format, err := logging.ParseFormat(logFormat)
+			if err != nil {
+				return err
+			}
+			logging.SetFormat(format)
+			if err := setColor(color); err != nil {
+				return err
+			}
+			disableCoreDumps()
+
+			// Refuse rather than let a command change the store regardless
+			if isDryRun(cmd) && cmd.Annotations[dryRunAnnotation] == "" && !noSetupCmds[cmd.Name()] {
+				return fmt.Errorf("'%s' does not support --dry-run", cmd.CommandPath())
+			}
+
+			// Completing entry names runs in the background of the shell,
+			// where nothing can be prompted for
+			if cmd.Name() == cobra.ShellCompRequestCmd {
+				batch = true
+			}
+
+			// Skip setup for commands that don't use the store or keys
+			if noSetupCmds[cmd.Name()] || cmd.Annotations[keysAnnotation] == keysNone || isConfigCmd(cmd) || isAgentCmd(cmd) {
+				return nil
+			}
+
+			// Keys given with the runtime, such as fakes in tests, are used as they are
+			if cmdApp(cmd).encryptor != nil {
 				return nil
 			}
 
-			// Check for SSH environment first
-			if err := checkSSHEnvironment(); err != nil {
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			if err := lockMemory(cfg); err != nil {
 				return err
 			}
+			backend, err := backendName(cmd, cfg)
+			if err != nil {
+				return err
+			}
+
+			setup := func() error {
+				switch backend {
+				case backendGPG:
+					return setupGPGEncryptor(cmd, cfg)
+				case backendPassphrase:
+					return setupPassphraseEncryptor(cmd, cfg)
+				case backendAWSKMS, backendGCPKMS, backendAzureKV, backendVault:
+					return setupKMSEncryptor(cmd, cfg, backend)
+				case backendSSH:
+					// Set up below
+				default:
+					return setupPluginEncryptor(cmd, cfg, backend)
+				}
+
+				if hostKey != "" {
+					if publicKeyPath != "" || privateKeyPath != "" || pkcs11Module != "" {
+						return fmt.Errorf("cannot combine --host-key with --public-key, --private-key or --pkcs11-module")
+					}
+					return setupHostKeyEncryptor(cmd, hostKey)
+				}
+
+				// Check for SSH environment first
+				if err := checkSSHEnvironment(); err != nil {
+					return err
+				}
+				// Passphrases can't be prompted for in batch mode anyway
+				if !batch {
+					printAgentNote()
+				}
+
+				return setupEncryptor(cmd, publicKeyPath, privateKeyPath, pkcs11Module, noAgent)
+			}
+
+			// With the passh agent running, keys are only needed on a cache miss
+			if cmd.Annotations[cachedAnnotation] != "" {
+				if client := runningAgent(); client != nil {
+					a := cmdApp(cmd)
+					a.cache = client
+					a.encryptor = newDeferredEncryptor(cmd, setup, backend == backendSSH)
+					return nil
+				}
+			}
 
-			return setupEncryptor(cmd, publicKeyPath, privateKeyPath, noAgent)
+			// Completing entry names only needs keys for the index
+			if cmd.Annotations[keysAnnotation] == keysLazy || cmd.Name() == cobra.ShellCompRequestCmd {
+				setEncryptor(cmd, newDeferredEncryptor(cmd, setup, backend == backendSSH))
+				return nil
+			}
+			return setup()
 		},
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&storeDir, "store", "", "Password store directory (default: ~/.passh)")
+	rootCmd.PersistentFlags().StringVar(&storeDir, "store", "", "Password store directory, ssh://[user@]host/path or webdav(s)://host/path URL (default: ~/.passh)")
 	rootCmd.PersistentFlags().StringVar(&publicKeyPath, "public-key", "", "SSH public key path (default: ~/.ssh/id_ed25519.pub)")
 	rootCmd.PersistentFlags().StringVar(&privateKeyPath, "private-key", "", "SSH private key path (default: ~/.ssh/id_ed25519)")
+	rootCmd.PersistentFlags().String("backend", "", "Encryption backend: ssh, gpg, passphrase, awskms, gcpkms, azurekv, vault or a plugin name (default: backend setting, or ssh)")
+	rootCmd.PersistentFlags().String("key-id", "", "KMS key for the awskms, gcpkms and azurekv backends (default: kms.key_id setting)")
+	rootCmd.PersistentFlags().String("transit-key", "", "Transit key for the vault backend (default: vault.transit_key setting)")
 	rootCmd.PersistentFlags().BoolVar(&noAgent, "no-agent", false, "Don't use SSH agent even if available")
+	rootCmd.PersistentFlags().StringVar(&pkcs11Module, "pkcs11-module", "", "Use the keys on a PKCS#11 token through ssh-agent (default: pkcs11.module setting)")
+	rootCmd.PersistentFlags().StringVar(&hostKey, "host-key", "", "Use an SSH host key instead of your own keys, for machine accounts")
+	rootCmd.PersistentFlags().Lookup("host-key").NoOptDefVal = defaultHostKey
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print requested data, warnings and errors")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show which keys, agent and store are used")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Show detailed tracing for troubleshooting")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of warnings and log messages: text or json")
+	rootCmd.PersistentFlags().StringVar(&color, "color", "auto", "Color output: auto (on a terminal unless NO_COLOR is set), always or never")
+	rootCmd.PersistentFlags().Bool("no-pager", false, "Don't page long list, log and audit output through $PAGER")
+	rootCmd.PersistentFlags().Bool("fix-perms", false, "Restrict store files and private keys that other users can access")
+	rootCmd.PersistentFlags().BoolVar(&batch, "batch", false, "Never prompt: confirmations are accepted, and anything needing input fails")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "Show what add, update, delete, import, sync, reencrypt and gc would change, without changing anything")
+	documentFlagEnv(rootCmd.PersistentFlags())
 
 	// Add subcommands
 	rootCmd.AddCommand(
 		newSetupCmd(),
+		newInitCmd(),
 		newVersionCmd(),
 		newAddCmd(),
+		newUpdateCmd(),
+		newInsertCmd(),
+		newTemplateCmd(),
 		newGetCmd(),
 		newListCmd(),
+		newFindCmd(),
 		newDeleteCmd(),
+		newAliasCmd(),
 		newGenerateCmd(),
+		newVerifyCmd(),
+		newSyncCmd(),
+		newDiffCmd(),
+		newMergeCmd(),
+		newConfigCmd(),
+		newBackupCmd(),
+		newSnapshotCmd(),
+		newImportCmd(),
+		newBatchCmd(),
+		newExecCmd(),
+		newEnvCmd(),
+		newK8sCmd(),
+		newAnsibleLookupCmd(),
+		newKeychainCmd(),
+		newEmergencyCmd(),
+		newShareCmd(),
+		newReceiveCmd(),
+		newRelayCmd(),
+		newShardCmd(),
+		newReencryptCmd(),
+		newRecipientsCmd(),
+		newEncryptNamesCmd(),
+		newMigrateCmd(),
+		newFsckCmd(),
+		newGCCmd(),
+		newInfoCmd(),
+		newAuditCmd(),
+		newScanCmd(),
+		newHooksCmd(),
+		newLogCmd(),
+		newShowCmd(),
+		newFileCmd(),
+		newOTPCmd(),
+		newRecoveryCmd(),
+		newAutotypeCmd(),
+		newOpenCmd(),
+		newSSHCmd(),
+		newTUICmd(),
+		newVerifyBinaryCmd(),
+		newDocsCmd(),
+		newAgentCmd(),
+		newIndexCmd(),
+		newClipboardClearCmd(),
+		newSSHAskpassCmd(),
 	)
+	addCompletionCmd(rootCmd)
 
 	return rootCmd
 }
 
+// keysAnnotation declares when a command needs the user's keys. Commands
+// without it load them before running.
+const keysAnnotation = "passh-keys"
+
+const (
+	// keysNone marks commands that never use the store or keys
+	keysNone = "none"
+	// keysLazy marks commands that may get by without keys, which are only
+	// loaded once something is encrypted or decrypted
+	keysLazy = "lazy"
+)
+
+// readOnlyAnnotation marks commands that only read entries, so their store
+// doesn't sign and their keys can wait until an entry is decrypted
+const readOnlyAnnotation = "passh-read-only"
+
+// readsOnly reports whether a command only reads entries: those marked
+// read-only, those the passh agent may serve, and shell completion
+func readsOnly(cmd *cobra.Command) bool {
+	return cmd.Annotations[readOnlyAnnotation] != "" || cmd.Annotations[cachedAnnotation] != "" ||
+		cmd.Name() == cobra.ShellCompRequestCmd
+}
+
+// dryRunAnnotation marks commands that honor --dry-run; others refuse it
+const dryRunAnnotation = "passh-dry-run"
+
+// isDryRun reports whether changes should only be shown, with the global
+// --dry-run or the --dry-run of delete and gc
+func isDryRun(cmd *cobra.Command) bool {
+	local, _ := cmd.Flags().GetBool("dry-run")
+	global, _ := cmd.Root().PersistentFlags().GetBool("dry-run")
+	return local || global
+}
+
+// noSetupCmds are cobra's own commands, which don't use the store or keys
+var noSetupCmds = map[string]bool{
+	"completion": true,
+	"help":       true,
+}
+
+// setLogLevel applies the --quiet, --verbose and --debug flags
+func setLogLevel(quiet, verbose, debug bool) error {
+	switch {
+	case quiet && (verbose || debug):
+		return fmt.Errorf("cannot combine --quiet with --verbose or --debug")
+	case debug:
+		logging.SetLevel(logging.LevelDebug)
+	case verbose:
+		logging.SetLevel(logging.LevelVerbose)
+	case quiet:
+		logging.SetLevel(logging.LevelQuiet)
+	default:
+		logging.SetLevel(logging.LevelInfo)
+	}
+	return nil
+}
+
+// isConfigCmd reports whether cmd is the config command or one of its subcommands
+func isConfigCmd(cmd *cobra.Command) bool {
+	return cmd.Name() == "config" || cmd.HasParent() && cmd.Parent().Name() == "config"
+}
+
 // checkSSHEnvironment verifies that SSH is installed and keys are available
 func checkSSHEnvironment() error {
 	// Check if ssh is installed
@@ -77,9 +310,10 @@ func checkSSHEnvironment() error {
 			"  - On Windows: Install Git for Windows or OpenSSH via Windows Optional Features")
 	}
 
-	// Check for existing SSH keys
+	// Check for existing SSH keys, of which a public key is enough to add
+	// entries
 	keysExist := false
-	for _, keyName := range defaultSSHPrivateKeys {
+	for _, keyName := range slices.Concat(defaultSSHPrivateKeys, defaultSSHPublicKeys) {
 		keyPath := filepath.Join(defaultSSHDir, keyName)
 		if _, err := os.Stat(keyPath); err == nil {
 			keysExist = true
@@ -97,26 +331,45 @@ func checkSSHEnvironment() error {
 			"After creating keys, run passh again.")
 	}
 
-	// Check if SSH agent is running
-	agentSock := os.Getenv("SSH_AUTH_SOCK")
-	if agentSock == "" {
-		fmt.Println("Note: SSH agent is not running. You may need to enter your key passphrase repeatedly.")
-		fmt.Println("To start the SSH agent:")
-		fmt.Println("  eval `ssh-agent`")
-		fmt.Println("  ssh-add")
-	}
-
 	return nil
 }
 
+// printAgentNote suggests starting the SSH agent when it isn't running
+func printAgentNote() {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		logging.Infof("Note: SSH agent is not running. You may need to enter your key passphrase repeatedly.\n" +
+			"To start the SSH agent:\n" +
+			"  eval `ssh-agent`\n" +
+			"  ssh-add")
+	}
+}
+
 // setupEncryptor initializes the SSH encryptor and attaches it to the command context
-func setupEncryptor(cmd *cobra.Command, publicKeyPath, privateKeyPath string, noAgent bool) error {
+func setupEncryptor(cmd *cobra.Command, publicKeyPath, privateKeyPath, pkcs11Module string, noAgent bool) error {
 	// Pass the inverse of noAgent to indicate whether to use the agent
 	encryptor, err := crypto.NewSSHEncryptor(!noAgent)
 	if err != nil {
 		return fmt.Errorf("failed to create encryptor: %w", err)
 	}
 
+	if pkcs11Module == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		pkcs11Module = cfg.Get("pkcs11.module")
+	}
+	if pkcs11Module != "" {
+		if err := addTokenKeys(cmd, encryptor, pkcs11Module); err != nil {
+			return err
+		}
+		// Key files are only used alongside the token when given explicitly
+		if publicKeyPath == "" && privateKeyPath == "" {
+			setEncryptor(cmd, encryptor)
+			return nil
+		}
+	}
+
 	// Try to find SSH keys if not specified
 	if publicKeyPath == "" {
 		for _, name := range defaultSSHPublicKeys {
@@ -142,39 +395,89 @@ func setupEncryptor(cmd *cobra.Command, publicKeyPath, privateKeyPath string, no
 		return fmt.Errorf("no SSH public key found, specify with --public-key")
 	}
 
-	if privateKeyPath == "" {
-		return fmt.Errorf("no SSH private key found, specify with --private-key")
-	}
-
 	// Load the keys
 	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
 		return fmt.Errorf("failed to load public key: %w", err)
 	}
 
+	// Without a private key entries can still be added and listed
+	if privateKeyPath == "" {
+		logging.Verbosef("No SSH private key found; entries can be added but not read")
+	} else if err := loadPrivateKey(cmd, encryptor, privateKeyPath); err != nil {
+		return err
+	}
+
+	setEncryptor(cmd, encryptor)
+	return nil
+}
+
+// loadPrivateKey loads a private key file, asking for its passphrase if
+// needed
+func loadPrivateKey(cmd *cobra.Command, encryptor *crypto.SSHEncryptor, path string) error {
+	if err := checkKeyPermissions(cmd, path); err != nil {
+		return err
+	}
+
 	// First try without passphrase
-	err = encryptor.AddPrivateKeyFromFile(privateKeyPath, nil)
+	err := encryptor.AddPrivateKeyFromFile(path, nil)
 	if err != nil && isPassphraseError(err) {
+		cache, err := loadPassphraseCache(cmd)
+		if err != nil {
+			return err
+		}
+		if cache != nil {
+			if passphrase := cache.get(path); passphrase != nil {
+				err := encryptor.AddPrivateKeyFromFile(path, passphrase)
+				secure.Wipe(passphrase)
+				if err == nil {
+					logging.Debugf("unlocked %s with the cached passphrase", path)
+					return nil
+				}
+				logging.Debugf("cached passphrase of %s failed: %v", path, err)
+				cache.forget(path)
+			}
+		}
+
+		if isBatch(cmd) {
+			return fmt.Errorf("private key '%s' is passphrase protected; add it to ssh-agent for batch use: %w",
+				path, errBatchInput)
+		}
+
 		// If it fails due to passphrase, prompt for it
-		fmt.Printf("Enter passphrase for key '%s': ", privateKeyPath)
-		passphrase, err := term.ReadPassword(syscall.Stdin)
+		passphrase, err := cmdPrompter(cmd).ReadPassword(fmt.Sprintf("Enter passphrase for key '%s': ", path))
 		if err != nil {
 			return fmt.Errorf("failed to read passphrase: %w", err)
 		}
-		fmt.Println() // Add newline after passphrase input
+		defer secure.Wipe(passphrase)
 
 		// Try again with the passphrase
-		if err := encryptor.AddPrivateKeyFromFile(privateKeyPath, passphrase); err != nil {
+		if err := encryptor.AddPrivateKeyFromFile(path, passphrase); err != nil {
 			return fmt.Errorf("failed to load private key with passphrase: %w", err)
 		}
+		if cache != nil {
+			cache.put(path, passphrase)
+		}
 	} else if err != nil {
 		return fmt.Errorf("failed to load private key: %w", err)
 	}
+	return nil
+}
 
-	// Store the encryptor in the command context
-	ctx := context.WithValue(cmd.Context(), "encryptor", encryptor)
-	cmd.SetContext(ctx)
+// addTokenKeys uses the keys on a PKCS#11 token, adding the token to
+// ssh-agent first if needed, which asks for its PIN
+func addTokenKeys(cmd *cobra.Command, encryptor *crypto.SSHEncryptor, module string) error {
+	err := encryptor.AddPKCS11Keys(module)
+	if !errors.Is(err, crypto.ErrTokenNotInAgent) {
+		return err
+	}
+	if isBatch(cmd) {
+		return fmt.Errorf("add the token to ssh-agent with 'ssh-add -s %s' for batch use: %w", module, errBatchInput)
+	}
 
-	return nil
+	if err := crypto.LoadPKCS11Module(module); err != nil {
+		return err
+	}
+	return encryptor.AddPKCS11Keys(module)
 }
 
 // isPassphraseError checks if an error is due to a missing passphrase
@@ -183,10 +486,53 @@ func isPassphraseError(err error) bool {
 		err.Error() == "failed to parse private key: ssh: this private key is passphrase protected")
 }
 
-// getStore gets the storage from command context
+// getStore opens the store of a command with the keys set up for it
 func getStore(cmd *cobra.Command) (*storage.Store, error) {
+	a := cmdApp(cmd)
+	if a.store != nil {
+		return a.store, nil
+	}
 	storeDir, _ := cmd.Flags().GetString("store")
-	encryptor := cmd.Context().Value("encryptor").(crypto.Encryptor)
+	encryptor, err := cmdEncryptor(cmd)
+	if err != nil {
+		return nil, err
+	}
 
-	return storage.NewStore(storeDir, encryptor)
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	encryption, err := backendName(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	index, err := indexPath(storeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := passh.OpenStorage(passh.Options{
+		Dir:       storeDir,
+		Encryptor: encryptor,
+		IndexPath: index,
+		Backend:   encryption,
+		Config:    cfg,
+		Confirm:   confirmRelease(cmd),
+		Cache:     a.cache,
+		Actor:     logActor(cmd),
+		NoSign:    readsOnly(cmd),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if storeDir == "" {
+		storeDir = "~/.passh"
+	}
+	logging.Verbosef("Using store %s", storeDir)
+
+	if err := checkStorePermissions(cmd, store); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
 }
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/scan"
+	"github.com/spf13/cobra"
+)
+
+// scanSkipDirs are version control directories, whose contents are
+// compressed or duplicated in the working tree
+var scanSkipDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+func newScanCmd() *cobra.Command {
+	var history bool
+	var staged bool
+	var allow []string
+	var minLength int
+	var maxSize int64
+
+	cmd := &cobra.Command{
+		Use:   "scan [PATH...]",
+		Short: "Find passwords from the store in plaintext files",
+		Long: "Look for the passwords of your entries in files, such as a code base about to be " +
+			"committed or your shell history. Matches are reported by file, line, column and entry " +
+			"name; the passwords themselves are never printed. Use - to scan standard input, for " +
+			"example 'git log -p | passh scan -' to search a repository's history.\n\n" +
+			"Only passwords (the first line of entries) of at least --min-length characters are " +
+			"looked for, as shorter ones match ordinary text. Without PATH the current directory is " +
+			"scanned. Version control directories and files over --max-size MiB are skipped. passh " +
+			"exits with an error if anything is found, so it can run in CI or a pre-commit hook.\n\n" +
+			"--staged scans what is staged for the next commit in the current git repository, as " +
+			"the hook installed by 'passh hooks install-git' does. Entries matching --allow, or " +
+			"allowed in the repository with 'passh hooks allow', are not looked for.",
+		Example: "  passh scan ~/src/project\n" +
+			"  passh scan --history\n" +
+			"  passh scan --staged --allow 'test/*'\n" +
+			"  git log -p | passh scan -",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if staged && (len(args) > 0 || history) {
+				return fmt.Errorf("cannot combine --staged with paths or --history")
+			}
+			paths := args
+			if history {
+				paths = append(paths, shellHistoryFiles()...)
+			} else if len(paths) == 0 {
+				paths = []string{"."}
+			}
+
+			var root string
+			var files []string
+			if staged {
+				var err error
+				if root, files, err = stagedFiles(); err != nil {
+					return err
+				}
+				repoAllowed, err := allowedEntries()
+				if err != nil {
+					return err
+				}
+				allow = append(allow, repoAllowed...)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.List()
+			if err != nil {
+				return err
+			}
+			scanner := scan.New(minLength)
+			progress, finish := progressBar("Reading entries")
+			store.SetProgress(progress)
+			err = store.ReadEntries(names, func(name string, secret []byte, err error) error {
+				if err != nil {
+					logging.Warnf("Skipping %v", err)
+					return nil
+				}
+				if !entryAllowed(name, allow) {
+					scanner.Add(name, firstLine(secret))
+				}
+				return nil
+			})
+			finish()
+			if err != nil {
+				return err
+			}
+			logging.Verbosef("Looking for %d passwords", scanner.Len())
+
+			found := 0
+			report := func(m scan.Match) {
+				found++
+				fmt.Fprintf(cmd.OutOrStdout(), "%s:%d:%d: password of '%s'\n", m.Path, m.Line, m.Column, m.Name)
+			}
+			if staged {
+				if err := scanStaged(scanner, root, files, maxSize<<20, report); err != nil {
+					return err
+				}
+			} else {
+				for _, path := range paths {
+					if err := scanPath(cmd, scanner, path, maxSize<<20, report); err != nil {
+						return err
+					}
+				}
+			}
+
+			if found > 0 {
+				return fmt.Errorf("found %d passwords in plaintext", found)
+			}
+			logging.Infof("No passwords found")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&history, "history", false, "Also scan the shell history files of bash, zsh, fish and PowerShell")
+	cmd.Flags().BoolVar(&staged, "staged", false, "Scan the changes staged for commit in the current git repository")
+	cmd.Flags().StringArrayVar(&allow, "allow", nil, "Don't look for the passwords of entries matching this name, folder or glob (repeatable)")
+	cmd.Flags().IntVar(&minLength, "min-length", scan.DefaultMinLength, "Ignore passwords shorter than this")
+	cmd.Flags().Int64Var(&maxSize, "max-size", 10, "Skip files larger than this many MiB")
+
+	return cmd
+}
+
+// scanPath scans standard input for -, a file, or every file below a
+// directory. Files that can't be read are skipped with a warning.
+func scanPath(cmd *cobra.Command, scanner *scan.Scanner, root string, maxSize int64, report func(scan.Match)) error {
+	if root == "-" {
+		return scanner.Scan(cmd.InOrStdin(), "-", report)
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			logging.Warnf("Skipping %v", err)
+			return nil
+		}
+		if entry.IsDir() {
+			if path != root && scanSkipDirs[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Size() > maxSize {
+			logging.Verbosef("Skipping %s: larger than %d MiB", path, maxSize>>20)
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			logging.Warnf("Skipping %v", err)
+			return nil
+		}
+		defer file.Close()
+		if err := scanner.Scan(file, path, report); err != nil {
+			logging.Warnf("Failed to scan %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// scanStaged scans the staged version of files in the repository at root,
+// as they will be committed
+func scanStaged(scanner *scan.Scanner, root string, files []string, maxSize int64, report func(scan.Match)) error {
+	for _, file := range files {
+		size, err := repoGit("-C", root, "cat-file", "-s", ":"+file)
+		if err != nil {
+			return err
+		}
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil && n > maxSize {
+			logging.Verbosef("Skipping %s: larger than %d MiB", file, maxSize>>20)
+			continue
+		}
+
+		show := exec.Command("git", "-C", root, "cat-file", "blob", ":"+file)
+		blob, err := show.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := show.Start(); err != nil {
+			return fmt.Errorf("failed to run git: %w", err)
+		}
+		scanErr := scanner.Scan(blob, file, report)
+		if err := show.Wait(); err != nil {
+			return fmt.Errorf("failed to read staged %s: %w", file, err)
+		}
+		if scanErr != nil {
+			return scanErr
+		}
+	}
+	return nil
+}
+
+// shellHistoryFiles returns the history files of common shells that exist
+func shellHistoryFiles() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	candidates := []string{
+		os.Getenv("HISTFILE"),
+		filepath.Join(home, ".bash_history"),
+		filepath.Join(home, ".zsh_history"),
+		filepath.Join(home, ".local", "share", "fish", "fish_history"),
+	}
+	if runtime.GOOS == "windows" {
+		candidates = append(candidates, filepath.Join(os.Getenv("APPDATA"),
+			"Microsoft", "Windows", "PowerShell", "PSReadLine", "ConsoleHost_history.txt"))
+	} else {
+		candidates = append(candidates, filepath.Join(home, ".local", "share", "powershell", "PSReadLine", "ConsoleHost_history.txt"))
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
@@ -5,43 +5,45 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 func newSetupCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "setup",
-		Short: "Set up passh environment",
-		Long:  "Check and set up the environment needed for passh including SSH keys and agent",
+		Use:         "setup",
+		Short:       "Set up passh environment",
+		Long:        "Check and set up the environment needed for passh including SSH keys and agent",
+		Example:     "  passh setup",
+		Annotations: map[string]string{keysAnnotation: keysNone},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runSetup()
+			return runSetup(cmd)
 		},
 	}
 }
 
-func runSetup() error {
-	fmt.Println("🔑 Passh Setup Wizard")
-	fmt.Println("=====================")
+func runSetup(command *cobra.Command) error {
+	out := command.OutOrStdout()
+	fmt.Fprintln(out, "🔑 Passh Setup Wizard")
+	fmt.Fprintln(out, "=====================")
 
 	// 1. Check for SSH installation
-	fmt.Print("Checking for SSH installation... ")
+	fmt.Fprint(out, "Checking for SSH installation... ")
 	sshPath, err := exec.LookPath("ssh")
 	if err != nil {
-		fmt.Println("❌ Not Found")
-		fmt.Println("\nSSH is required but not installed or not in your PATH.")
-		fmt.Println("Please install SSH with one of these commands:")
-		fmt.Println("  - On Debian/Ubuntu: sudo apt-get install openssh-client")
-		fmt.Println("  - On Fedora/RHEL: sudo dnf install openssh-clients")
-		fmt.Println("  - On macOS: brew install openssh")
-		fmt.Println("  - On Windows: Install Git for Windows or OpenSSH via Windows Optional Features")
+		fmt.Fprintln(out, "❌ Not Found")
+		fmt.Fprintln(out, "\nSSH is required but not installed or not in your PATH.")
+		fmt.Fprintln(out, "Please install SSH with one of these commands:")
+		fmt.Fprintln(out, "  - On Debian/Ubuntu: sudo apt-get install openssh-client")
+		fmt.Fprintln(out, "  - On Fedora/RHEL: sudo dnf install openssh-clients")
+		fmt.Fprintln(out, "  - On macOS: brew install openssh")
+		fmt.Fprintln(out, "  - On Windows: Install Git for Windows or OpenSSH via Windows Optional Features")
 		return fmt.Errorf("SSH not installed")
 	}
-	fmt.Printf("✅ Found (%s)\n", sshPath)
+	fmt.Fprintf(out, "✅ Found (%s)\n", sshPath)
 
 	// 2. Check for existing keys
-	fmt.Print("Checking for existing SSH keys... ")
+	fmt.Fprint(out, "Checking for existing SSH keys... ")
 	sshDir := filepath.Join(os.Getenv("HOME"), ".ssh")
 
 	keyTypes := []struct {
@@ -69,104 +71,102 @@ func runSetup() error {
 	}
 
 	if foundKeys {
-		fmt.Printf("✅ Found %s key (%s)\n", foundKeyType, foundKeyPath)
+		fmt.Fprintf(out, "✅ Found %s key (%s)\n", foundKeyType, foundKeyPath)
 	} else {
-		fmt.Println("❌ Not Found")
-		fmt.Print("\nWould you like to generate a new Ed25519 SSH key? [y/N]: ")
-		var userResponse string
-		if _, err := fmt.Scanln(&userResponse); err != nil {
-			// Handle specific error for unexpected newline
-			if err.Error() != "unexpected newline" {
-				fmt.Printf("Error reading input: %v\n", err)
-			}
-			// Default to "n" for empty or error
-			userResponse = "n"
-		}
-
-		if strings.ToLower(userResponse) == "y" || strings.ToLower(userResponse) == "yes" {
+		fmt.Fprintln(out, "❌ Not Found")
+		fmt.Fprintln(out)
+		if offer(command, "Would you like to generate a new Ed25519 SSH key?") {
 			// Ensure SSH directory exists
 			if err := os.MkdirAll(sshDir, 0700); err != nil {
 				return fmt.Errorf("failed to create SSH directory: %w", err)
 			}
 
 			// Generate a new Ed25519 key
-			fmt.Println("Generating new Ed25519 key...")
+			fmt.Fprintln(out, "Generating new Ed25519 key...")
 			cmd := exec.Command("ssh-keygen", "-t", "ed25519")
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Stdin = os.Stdin
+			cmd.Stdout = out
+			cmd.Stderr = command.ErrOrStderr()
+			cmd.Stdin = command.InOrStdin()
 			if err := cmd.Run(); err != nil {
 				return fmt.Errorf("failed to generate SSH key: %w", err)
 			}
 			foundKeys = true
-			fmt.Println("✅ Key generated successfully")
+			fmt.Fprintln(out, "✅ Key generated successfully")
 		} else {
-			fmt.Println("\nPlease generate SSH keys manually with 'ssh-keygen -t ed25519' before using passh.")
+			fmt.Fprintln(out, "\nPlease generate SSH keys manually with 'ssh-keygen -t ed25519' before using passh.")
 			return fmt.Errorf("no SSH keys available")
 		}
 	}
 
 	// 3. Check for SSH agent
-	fmt.Print("Checking for SSH agent... ")
+	fmt.Fprint(out, "Checking for SSH agent... ")
 	agentSock := os.Getenv("SSH_AUTH_SOCK")
 	if agentSock == "" {
-		fmt.Println("❌ Not Running")
-		fmt.Print("\nWould you like to start the SSH agent? [y/N]: ")
-		var userResponse string
-		if _, err := fmt.Scanln(&userResponse); err != nil {
-			if err.Error() != "unexpected newline" {
-				fmt.Printf("Error reading input: %v\n", err)
-			}
-			// Default to "n" for empty or error
-			userResponse = "n"
-		}
-
-		if strings.ToLower(userResponse) == "y" || strings.ToLower(userResponse) == "yes" {
-			fmt.Println("\nStarting SSH agent...")
-			fmt.Println("Please run these commands in your shell:")
-			fmt.Println("  eval `ssh-agent`")
-			fmt.Println("  ssh-add")
-			fmt.Println("\nAfter starting the agent, run passh again.")
+		fmt.Fprintln(out, "❌ Not Running")
+		fmt.Fprintln(out)
+		if offer(command, "Would you like to start the SSH agent?") {
+			fmt.Fprintln(out, "\nStarting SSH agent...")
+			fmt.Fprintln(out, "Please run these commands in your shell:")
+			fmt.Fprintln(out, "  eval `ssh-agent`")
+			fmt.Fprintln(out, "  ssh-add")
+			fmt.Fprintln(out, "\nAfter starting the agent, run passh again.")
 		} else {
-			fmt.Println("\nWithout the SSH agent, you'll need to enter your key passphrase each time.")
+			fmt.Fprintln(out, "\nWithout the SSH agent, you'll need to enter your key passphrase each time.")
 		}
 	} else {
-		fmt.Printf("✅ Running (Socket: %s)\n", agentSock)
+		fmt.Fprintf(out, "✅ Running (Socket: %s)\n", agentSock)
 
 		// Check if keys are added to agent
-		fmt.Print("Checking if keys are added to agent... ")
+		fmt.Fprint(out, "Checking if keys are added to agent... ")
 		cmd := exec.Command("ssh-add", "-l")
 		output, err := cmd.CombinedOutput()
 		if err != nil || string(output) == "The agent has no identities.\n" {
-			fmt.Println("❌ No keys added")
-			fmt.Print("\nWould you like to add your key to the SSH agent? [y/N]: ")
-			var userResponse string
-			if _, err := fmt.Scanln(&userResponse); err != nil {
-				if err.Error() != "unexpected newline" {
-					fmt.Printf("Error reading input: %v\n", err)
-				}
-				// Default to "n" for empty or error
-				userResponse = "n"
-			}
-
-			if strings.ToLower(userResponse) == "y" || strings.ToLower(userResponse) == "yes" {
+			fmt.Fprintln(out, "❌ No keys added")
+			fmt.Fprintln(out)
+			if offer(command, "Would you like to add your key to the SSH agent?") {
 				cmd := exec.Command("ssh-add")
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				cmd.Stdin = os.Stdin
+				cmd.Stdout = out
+				cmd.Stderr = command.ErrOrStderr()
+				cmd.Stdin = command.InOrStdin()
 				if err := cmd.Run(); err != nil {
 					return fmt.Errorf("failed to add key to SSH agent: %w", err)
 				}
-				fmt.Println("✅ Key added to agent")
+				fmt.Fprintln(out, "✅ Key added to agent")
 			}
 		} else {
-			fmt.Println("✅ Keys are present in agent")
+			fmt.Fprintln(out, "✅ Keys are present in agent")
+		}
+	}
+
+	// 4. Check that no one else can read the key or the store
+	fmt.Fprint(out, "Checking file permissions... ")
+	loose, err := loosePermissions(command, foundKeyPath, false)
+	if err != nil {
+		return err
+	}
+	if len(loose) == 0 {
+		fmt.Fprintln(out, "✅ Only you can access your key and store")
+	} else {
+		fmt.Fprintf(out, "❌ %d files can be accessed by other users\n", len(loose))
+		for i, path := range loose {
+			if i == 5 {
+				fmt.Fprintf(out, "  ... and %d more\n", len(loose)-i)
+				break
+			}
+			fmt.Fprintf(out, "  %s\n", path)
+		}
+		fmt.Fprintln(out)
+		if fixPerms(command) || offer(command, "Would you like to restrict them to your user?") {
+			if _, err := loosePermissions(command, foundKeyPath, true); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "✅ Permissions restricted")
 		}
 	}
 
-	fmt.Println("✅ Passh setup complete!")
-	fmt.Println("You can now use passh to securely store and retrieve passwords.")
-	fmt.Println("Try: passh add example/password")
+	fmt.Fprintln(out, "✅ Passh setup complete!")
+	fmt.Fprintln(out, "You can now use passh to securely store and retrieve passwords.")
+	fmt.Fprintln(out, "Try: passh add example/password")
 
 	return nil
 }
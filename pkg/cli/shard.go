@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/passh"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newShardCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shard",
+		Short: "Split a recovery key into shares to regain access without your SSH key",
+		Long: "Create a recovery key for the store and split it into Shamir shares. Every entry is " +
+			"also encrypted to the recovery key, so if your SSH key is lost, any threshold of the " +
+			"shares can be combined to re-encrypt the store to a new key. Fewer shares reveal nothing " +
+			"about the recovery key.\n\n" +
+			"Encryption to SSH keys, the recovery key included, is not implemented yet: entries are " +
+			"only encoded, so for now the shares guard against losing your key, not against anyone " +
+			"who can read the store.",
+	}
+
+	cmd.AddCommand(newShardCreateCmd(), newShardRecoverCmd())
+
+	return cmd
+}
+
+func newShardCreateCmd() *cobra.Command {
+	var shares int
+	var threshold int
+	var showQR bool
+	var outputDir string
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a recovery key and print its shares",
+		Long: "Create a recovery key, re-encrypt every entry to it as well and print its Shamir shares. " +
+			"The ssh backend only encodes entries so far, so the recovery key adds no protection " +
+			"of its own until encryption to SSH keys is implemented.",
+		Example: "  passh shard create -n 5 -k 3\n" +
+			"  passh shard create -n 5 -k 3 --qr --output ./shares",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			existing, err := passh.ReadRecoveryKey(store)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return fmt.Errorf("store already has a recovery key (%s)", crypto.RecoveryKeyID(existing))
+			}
+
+			seed, signer, err := crypto.GenerateRecoveryKey()
+			if err != nil {
+				return err
+			}
+			defer secure.Wipe(seed)
+
+			parts, err := crypto.SplitSecret(seed, shares, threshold)
+			if err != nil {
+				return err
+			}
+
+			// Encrypt every entry to the recovery key before publishing it
+			store.AddRecipient(signer.PublicKey())
+			names, err := store.Reencrypt("")
+			if err != nil {
+				return err
+			}
+			if err := store.WriteMeta(passh.RecoveryKeyMeta, ssh.MarshalAuthorizedKey(signer.PublicKey())); err != nil {
+				return err
+			}
+
+			keyID := crypto.RecoveryKeyID(signer.PublicKey())
+			fmt.Fprintf(cmd.OutOrStdout(), "Created recovery key %s and encrypted %d entries to it.\n", keyID, len(names))
+			fmt.Fprintf(cmd.OutOrStdout(), "Any %d of these %d shares recover the store. Keep them in separate places;\n", threshold, shares)
+			fmt.Fprintf(cmd.OutOrStdout(), "they will not be shown again.\n\n")
+
+			if outputDir != "" {
+				if err := os.MkdirAll(outputDir, 0700); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+			}
+
+			for i, part := range parts {
+				share := crypto.RecoveryShare{KeyID: keyID, Threshold: threshold, Data: part}.String()
+				if err := printShare(cmd.OutOrStdout(), i+1, shares, share, showQR, outputDir); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&shares, "shares", "n", 5, "Number of shares to create")
+	cmd.Flags().IntVarP(&threshold, "threshold", "k", 3, "Number of shares needed to recover")
+	cmd.Flags().BoolVar(&showQR, "qr", false, "Also print every share as a QR code")
+	cmd.Flags().StringVarP(&outputDir, "output", "o", "", "Write the shares to files in this directory instead of printing them")
+
+	return cmd
+}
+
+// printShare prints a share, or writes it to DIR/shard-N.txt (and .png with QR)
+func printShare(out io.Writer, index, total int, share string, showQR bool, outputDir string) error {
+	if outputDir != "" {
+		base := filepath.Join(outputDir, fmt.Sprintf("shard-%d", index))
+		if err := os.WriteFile(base+".txt", []byte(share+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write share: %w", err)
+		}
+		fmt.Fprintf(out, "Wrote share %d of %d to %s.txt\n", index, total, base)
+
+		if showQR {
+			return writeQRPNG(base+".png", []byte(share))
+		}
+		return nil
+	}
+
+	fmt.Fprintf(out, "Share %d of %d:\n%s\n", index, total, share)
+	if showQR {
+		if err := printQR(out, []byte(share)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+func newShardRecoverCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "recover [SHARE|FILE]...",
+		Short: "Combine shares and re-encrypt the store to your current key",
+		Long: "Combine recovery shares and re-encrypt every entry to your current SSH key, for example " +
+			"a newly generated one after the old key was lost. Shares are read from the arguments, " +
+			"from files, or interactively when none are given.",
+		Example: "  passh shard recover shares/shard-1.txt shares/shard-4.txt shares/shard-5.txt\n" +
+			"  passh shard recover",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sshEncryptor, ok := cmdApp(cmd).encryptor.(*crypto.SSHEncryptor)
+			if !ok {
+				return errors.New("recovery keys require the SSH encryptor")
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			publicKey, err := passh.ReadRecoveryKey(store)
+			if err != nil {
+				return err
+			}
+			if publicKey == nil {
+				return errors.New("store has no recovery key; create one with 'passh shard create'")
+			}
+			keyID := crypto.RecoveryKeyID(publicKey)
+
+			shares, err := collectShares(cmdPrompter(cmd), args, keyID, isBatch(cmd))
+			if err != nil {
+				return err
+			}
+
+			var parts [][]byte
+			for _, share := range shares {
+				parts = append(parts, share.Data)
+			}
+			seed, err := crypto.CombineShares(parts)
+			if err != nil {
+				return err
+			}
+			defer secure.Wipe(seed)
+
+			signer, err := crypto.RecoveryKeyFromSeed(seed)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) {
+				return errors.New("the shares do not reconstruct this store's recovery key")
+			}
+
+			sshEncryptor.AddSigner(signer)
+			names, err := store.Reencrypt("")
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Recovered key %s and re-encrypted %d entries to your current key\n", keyID, len(names))
+			return nil
+		},
+	}
+}
+
+// collectShares parses shares for the given recovery key from arguments and
+// files, prompting for more until the threshold is reached unless running in
+// batch mode
+func collectShares(prompt prompter, args []string, keyID string, batch bool) ([]crypto.RecoveryShare, error) {
+	var shares []crypto.RecoveryShare
+	seen := make(map[byte]bool)
+
+	add := func(encoded string) error {
+		share, err := crypto.ParseShare(encoded)
+		if err != nil {
+			return err
+		}
+		if share.KeyID != keyID {
+			return fmt.Errorf("share belongs to recovery key %s, not %s", share.KeyID, keyID)
+		}
+		if !seen[share.Data[0]] {
+			seen[share.Data[0]] = true
+			shares = append(shares, share)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		if data, err := os.ReadFile(arg); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if strings.HasPrefix(strings.TrimSpace(line), "passh-shard") {
+					if err := add(line); err != nil {
+						return nil, fmt.Errorf("%s: %w", arg, err)
+					}
+				}
+			}
+			continue
+		}
+		if err := add(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	threshold := func() int {
+		if len(shares) == 0 {
+			return 2
+		}
+		return shares[0].Threshold
+	}
+
+	if batch && len(shares) < threshold() {
+		return nil, fmt.Errorf("need %d shares, got %d: %w", threshold(), len(shares), errBatchInput)
+	}
+
+	for len(shares) < threshold() {
+		line, err := prompt.ReadLine(fmt.Sprintf("Enter share %d: ", len(shares)+1))
+		if err != nil {
+			return nil, fmt.Errorf("need %d shares, got %d", threshold(), len(shares))
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := add(line); err != nil {
+			logging.Warnf("Invalid share: %v", err)
+		}
+	}
+
+	return shares, nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+)
+
+func TestCollectSharesPrompts(t *testing.T) {
+	seed, signer, err := crypto.GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := crypto.SplitSecret(seed, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := crypto.RecoveryKeyID(signer.PublicKey())
+	share := func(i int) string {
+		return crypto.RecoveryShare{KeyID: keyID, Threshold: 3, Data: parts[i]}.String()
+	}
+
+	// Blank, invalid and repeated shares are asked for again
+	prompt := &fakePrompter{lines: []string{"", "not a share", share(0), share(2), share(4)}}
+	shares, err := collectShares(prompt, []string{share(0)}, keyID, false)
+	if err != nil {
+		t.Fatalf("collectShares failed: %v", err)
+	}
+	if len(shares) != 3 {
+		t.Fatalf("Expected 3 shares, got %d", len(shares))
+	}
+	if len(prompt.asked) != 5 || prompt.asked[4] != "Enter share 3: " {
+		t.Errorf("Unexpected prompts %q", prompt.asked)
+	}
+
+	if _, err := collectShares(&fakePrompter{lines: []string{share(1)}}, nil, keyID, false); err == nil {
+		t.Error("Expected running out of input before the threshold to fail")
+	}
+	if _, err := collectShares(&fakePrompter{}, []string{share(0)}, keyID, true); !errors.Is(err, errBatchInput) {
+		t.Errorf("Expected batch mode not to prompt, got %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/relay"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// shareBlockType labels shared bundles armored for pasting
+const shareBlockType = "PASSH SHARE"
+
+func newShareCmd() *cobra.Command {
+	var with []string
+	var expire string
+	var output string
+	var link bool
+	var relayFlag string
+
+	cmd := &cobra.Command{
+		Use:   "share NAME|FOLDER... --with RECIPIENT",
+		Short: "Share entries with someone outside the store",
+		Long: "Export entries into a standalone bundle encrypted to another person's SSH keys, so they " +
+			"can read them with 'passh receive' without access to your store. Each --with is a public " +
+			"key file, an authorized_keys line, or github:USER or gitlab:USER for the keys a user " +
+			"published there; their fingerprints are shown for confirmation first.\n\n" +
+			"The bundle is printed as text that can be pasted into a chat or email, or written to " +
+			"--output. With --expire, 'passh receive' refuses to open it after that time. Like the " +
+			"emergency delay, the expiry is enforced by passh, not by cryptography, and a copy already " +
+			"opened stays known to the recipient, so rotate secrets that must no longer be shared.\n\n" +
+			"For someone who doesn't use passh, --link uploads one entry to a relay (--relay or " +
+			"share.relay, such as one run with 'passh relay') encrypted to a random key, and prints a " +
+			"link that shows it once in a browser or with 'passh receive LINK'. The key is only in the " +
+			"part of the link after #, which is never sent to the relay. The relay deletes the entry " +
+			"when it is first viewed or after --expire, 24 hours by default.",
+		Example: "  passh share db/prod --with github:alice --expire 7d\n" +
+			"  passh share team/ --with bob.pub --output team.share\n" +
+			"  passh share wifi/guest --link --expire 1h",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if link {
+				if len(with) > 0 || output != "" {
+					return errors.New("--link can't be combined with --with or --output")
+				}
+				if len(args) != 1 {
+					return errors.New("--link shares a single entry")
+				}
+				if !cmd.Flags().Changed("expire") {
+					expire = "24h"
+				}
+				return shareLink(cmd, args[0], relayFlag, expire)
+			}
+			if len(with) == 0 {
+				return errors.New("specify who to share with using --with")
+			}
+			lifetime, err := parseDuration(expire)
+			if err != nil {
+				return fmt.Errorf("invalid --expire: %w", err)
+			}
+
+			recipient, err := crypto.NewSSHEncryptor(false)
+			if err != nil {
+				return fmt.Errorf("failed to create encryptor: %w", err)
+			}
+			var keys []recipientKey
+			for _, value := range with {
+				parsed, err := parseRecipientKeys(value)
+				if err != nil {
+					return err
+				}
+				for _, key := range parsed {
+					recipient.AddPublicKey(key.key)
+				}
+				keys = append(keys, parsed...)
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names, err := store.List()
+			if err != nil {
+				return err
+			}
+			if names, err = selectEntries(names, args); err != nil {
+				return err
+			}
+
+			stderr := cmd.ErrOrStderr()
+			fmt.Fprintf(stderr, "Sharing %d entries with:\n", len(names))
+			for _, key := range keys {
+				fmt.Fprintf(stderr, "  %s\n", strings.TrimSpace(keyLabel(key.key, nil)+" "+keyComment(key.line)))
+			}
+			if !confirm(cmd, "Share them?") {
+				fmt.Fprintln(stderr, "Nothing shared")
+				return nil
+			}
+
+			var notAfter time.Time
+			if lifetime > 0 {
+				notAfter = time.Now().Add(lifetime)
+			}
+			data, header, err := store.ExportBundle(names, recipient, strings.Join(with, ", "), "share", time.Time{}, notAfter)
+			if err != nil {
+				return err
+			}
+			armored := pem.EncodeToMemory(&pem.Block{Type: shareBlockType, Bytes: data})
+
+			if output == "" {
+				fmt.Fprint(cmd.OutOrStdout(), string(armored))
+			} else if err := os.WriteFile(output, armored, 0600); err != nil {
+				return fmt.Errorf("failed to write bundle: %w", err)
+			} else {
+				logging.Infof("Wrote the bundle to '%s'", output)
+			}
+			if header.NotAfter != nil {
+				logging.Infof("They can open it with 'passh receive' until %s", header.NotAfter.Local().Format(timeFormat))
+			} else {
+				logging.Infof("They can open it with 'passh receive'")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&with, "with", nil, "Public key file, authorized_keys line, github:USER or gitlab:USER to share with (repeatable)")
+	cmd.Flags().StringVar(&expire, "expire", "0", "Time after which the bundle can't be opened, e.g. 12h, 7d or 2w (default: never)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the bundle to (default: print it)")
+	cmd.Flags().BoolVar(&link, "link", false, "Share one entry as a one-time link through a relay")
+	cmd.Flags().StringVar(&relayFlag, "relay", "", "Relay URL for --link (default: share.relay setting)")
+
+	return cmd
+}
+
+// shareLink uploads an entry to a relay and prints its one-time link
+func shareLink(cmd *cobra.Command, name, relayFlag, expire string) error {
+	lifetime, err := parseDuration(expire)
+	if err != nil || lifetime <= 0 {
+		return fmt.Errorf("invalid --expire '%s'", expire)
+	}
+	server, err := relayURL(cmd, relayFlag)
+	if err != nil {
+		return err
+	}
+
+	store, err := getStore(cmd)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	content, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(content)
+
+	if !confirm(cmd, fmt.Sprintf("Upload '%s' to %s as a one-time link?", name, server)) {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Nothing shared")
+		return nil
+	}
+	link, expires, err := relay.Share(server, content, lifetime)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), link)
+	logging.Infof("The link shows '%s' once, until %s", name, expires.Local().Format(timeFormat))
+	return nil
+}
+
+func newReceiveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "receive [FILE|LINK]",
+		Short: "Open entries someone shared with you",
+		Long: "Decrypt a bundle made with 'passh share' for one of your SSH keys and print its entries. " +
+			"The bundle is read from FILE, or pasted on standard input.\n\n" +
+			"Given a one-time link made with 'passh share --link', the entry is fetched from the relay " +
+			"and printed instead. The link can't be opened again afterwards.",
+		Example: "  passh receive\n" +
+			"  passh receive team.share",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{keysAnnotation: keysLazy},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 && (strings.HasPrefix(args[0], "https://") || strings.HasPrefix(args[0], "http://")) {
+				secret, err := relay.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer secure.Wipe(secret)
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", secret)
+				return nil
+			}
+
+			var data []byte
+			var err error
+			if len(args) == 1 && args[0] != "-" {
+				data, err = os.ReadFile(args[0])
+			} else {
+				if term.IsTerminal(int(os.Stdin.Fd())) {
+					fmt.Fprintln(cmd.ErrOrStderr(), "Paste the shared bundle, then press Ctrl-D:")
+				}
+				data, err = io.ReadAll(io.LimitReader(cmd.InOrStdin(), 64<<20))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read bundle: %w", err)
+			}
+			if block, _ := pem.Decode(data); block != nil && block.Type == shareBlockType {
+				data = block.Bytes
+			}
+
+			encryptor, err := cmdEncryptor(cmd)
+			if err != nil {
+				return err
+			}
+			bundle, err := storage.OpenBundle(data, encryptor, time.Now())
+			if err != nil {
+				return err
+			}
+			defer bundle.Wipe()
+
+			logging.Infof("Shared bundle %s created %s", bundle.Header.ID, bundle.Header.Created.Local().Format(timeFormat))
+			for _, name := range bundle.Header.Entries {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, bundle.Entries[name])
+			}
+			return nil
+		},
+	}
+}
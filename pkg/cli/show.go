@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passwordMask hides a password without revealing its length
+const passwordMask = "••••••••"
+
+func newShowCmd() *cobra.Command {
+	var reveal bool
+
+	cmd := &cobra.Command{
+		Use:   "show NAME",
+		Short: "Show an entry with its password masked",
+		Long: "Show an entry's details and fields with the password masked. On a terminal, press " +
+			"r to reveal the password and any key to hide it again, so it doesn't stay on screen " +
+			"or in the scrollback. Use --reveal to print it directly.",
+		Example: "  passh show email/work\n" +
+			"  passh show email/work --reveal",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEntries,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			content, meta, err := store.GetWithMetadata(name)
+			if err != nil {
+				return err
+			}
+			defer secure.Wipe(content)
+
+			if err := printEntryInfo(cmd, store, name, meta); err != nil {
+				return err
+			}
+			password := printEntryFields(cmd.OutOrStdout(), content)
+
+			if reveal {
+				recordAccess(cmd, name)
+				fmt.Fprintf(cmd.OutOrStdout(), "Password:  %s\n", password)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Password:  %s\n", passwordMask)
+			interactive := !isBatch(cmd) && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+			if !interactive {
+				return nil
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), "Press r to reveal the password, any other key to quit")
+			if key, err := readKey(); err != nil || key != 'r' {
+				fmt.Fprint(cmd.OutOrStdout(), "\r\x1b[2K")
+				return err
+			}
+
+			recordAccess(cmd, name)
+			// Rewrite the password line in place, then mask it again
+			fmt.Fprintf(cmd.OutOrStdout(), "\r\x1b[2K\x1b[1A\x1b[2KPassword:  %s\nPress any key to hide it", password)
+			_, err = readKey()
+			fmt.Fprintf(cmd.OutOrStdout(), "\r\x1b[2K\x1b[1A\x1b[2KPassword:  %s\n", passwordMask)
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVarP(&reveal, "reveal", "r", false, "Print the password instead of masking it")
+
+	return cmd
+}
+
+// printEntryFields prints the "key: value" fields of an entry and notes how
+// many other lines there are. It returns the password line.
+func printEntryFields(out io.Writer, content []byte) []byte {
+	lines := bytes.Split(bytes.TrimRight(content, "\n"), []byte("\n"))
+
+	other := 0
+	for _, line := range lines[1:] {
+		key, value, ok := bytes.Cut(line, []byte(":"))
+		// URIs such as otpauth:// are not fields and may hold secrets
+		if !ok || bytes.Contains(key, []byte(" ")) || len(bytes.TrimSpace(key)) == 0 || bytes.HasPrefix(value, []byte("//")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				other++
+			}
+			continue
+		}
+		fmt.Fprintf(out, "%-10s %s\n", string(bytes.TrimSpace(key))+":", bytes.TrimSpace(value))
+	}
+	switch {
+	case other == 1:
+		fmt.Fprintf(out, "(1 more line, see 'passh get --full')\n")
+	case other > 1:
+		fmt.Fprintf(out, "(%d more lines, see 'passh get --full')\n", other)
+	}
+
+	return bytes.TrimSuffix(lines[0], []byte("\r"))
+}
+
+// readKey reads a single key press from the terminal
+func readKey() (byte, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read key: %w", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	key := make([]byte, 1)
+	if _, err := os.Stdin.Read(key); err != nil {
+		return 0, fmt.Errorf("failed to read key: %w", err)
+	}
+	return key[0], nil
+}
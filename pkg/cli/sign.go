@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// loadAllowedSigners reads the keys trusted to sign entries from path, or
+// from the sign.allowed_signers setting. It returns nil if neither is set.
+func loadAllowedSigners(cmd *cobra.Command, path string) ([]ssh.PublicKey, error) {
+	if path == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
+		path = cfg.Get("sign.allowed_signers")
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+	keys, err := storage.ParseAllowedSigners(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed signers file %s: %w", path, err)
+	}
+	return keys, nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Record and check the state of the store",
+		Long: "Write a signed manifest with the checksum of every encrypted entry file, and later check " +
+			"the store against it, for example before and after syncing, or after restoring a copy of " +
+			"the store, to see that nothing went missing or changed unexpectedly. Nothing is decrypted, " +
+			"and the manifest holds no secrets.\n\n" +
+			"Entries re-encrypted since, with 'passh reencrypt' or by restoring a backup, show up as changed.",
+	}
+
+	cmd.AddCommand(newSnapshotCreateCmd(), newSnapshotVerifyCmd())
+
+	return cmd
+}
+
+func newSnapshotCreateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "create FILE",
+		Short:   "Write a signed snapshot of the store to FILE",
+		Example: "  passh snapshot create before-sync.json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			encryptor, ok := cmdApp(cmd).encryptor.(*crypto.SSHEncryptor)
+			if !ok {
+				return errors.New("snapshots are signed with your SSH key and need the ssh backend")
+			}
+			signer := encryptor.Signer()
+			if signer == nil {
+				return errors.New("the private key for your public key is not loaded, so the snapshot can't be signed")
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			data, snapshot, err := store.CreateSnapshot(signer)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(args[0], data, 0600); err != nil {
+				return fmt.Errorf("failed to write snapshot: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Recorded %d entries in '%s'\n", len(snapshot.Entries), args[0])
+			return nil
+		},
+	}
+}
+
+func newSnapshotVerifyCmd() *cobra.Command {
+	var allowedSignersPath string
+
+	cmd := &cobra.Command{
+		Use:   "verify FILE",
+		Short: "Compare the store with a snapshot",
+		Long: "Check that a snapshot was signed by you, or by a key in --allowed-signers or the " +
+			"sign.allowed_signers setting, and list the entry files added (+), removed (-) or " +
+			"changed (~) since it was created. Fails if the store differs.",
+		Example: "  passh snapshot verify before-sync.json\n" +
+			"  passh snapshot verify team.json --allowed-signers ./allowed_signers",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read snapshot: %w", err)
+			}
+			trusted, err := loadAllowedSigners(cmd, allowedSignersPath)
+			if err != nil {
+				return err
+			}
+			if trusted == nil {
+				trusted = ownKeys(cmd)
+			}
+
+			snapshot, key, err := storage.ParseSnapshot(data, trusted)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Snapshot of %d entries created %s, signed by %s\n",
+				len(snapshot.Entries), snapshot.Created.Local().Format(timeFormat), keyLabel(key, ownKeys(cmd)))
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			diff, err := store.CompareSnapshot(snapshot)
+			if err != nil {
+				return err
+			}
+			if diff.Empty() {
+				fmt.Fprintln(cmd.OutOrStdout(), "The store matches the snapshot")
+				return nil
+			}
+			for _, file := range diff.Added {
+				fmt.Fprintf(cmd.OutOrStdout(), "+ %s\n", file)
+			}
+			for _, file := range diff.Removed {
+				fmt.Fprintf(cmd.OutOrStdout(), "- %s\n", file)
+			}
+			for _, file := range diff.Changed {
+				fmt.Fprintf(cmd.OutOrStdout(), "~ %s\n", file)
+			}
+			return fmt.Errorf("the store differs from the snapshot: %d added, %d removed, %d changed",
+				len(diff.Added), len(diff.Removed), len(diff.Changed))
+		},
+	}
+
+	cmd.Flags().StringVar(&allowedSignersPath, "allowed-signers", "", "Accept snapshots signed by the keys in this allowed signers file (default: sign.allowed_signers setting, or your own keys)")
+
+	return cmd
+}
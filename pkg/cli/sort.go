@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Orders of list and find output
+const (
+	sortName     = "name"
+	sortModified = "modified"
+	sortAccessed = "accessed"
+)
+
+// checkSortOrder returns an error for an unknown --sort value
+func checkSortOrder(order string) error {
+	switch order {
+	case sortName, sortModified, sortAccessed:
+		return nil
+	}
+	return fmt.Errorf("invalid --sort '%s', expected name, modified or accessed", order)
+}
+
+// sortEntries sorts entry names for listing. Names are ordered naturally in
+// the user's locale, folders before entries; modified and accessed put the
+// most recent first, and entries without a time last.
+func sortEntries(cmd *cobra.Command, index *storage.Index, names []string, order string) {
+	collator := collate.New(userLocale(), collate.Numeric)
+	slices.SortFunc(names, func(a, b string) int {
+		return compareNames(collator, a, b)
+	})
+
+	switch order {
+	case sortModified:
+		slices.SortStableFunc(names, func(a, b string) int {
+			return index.Entries[b].Modified.Compare(index.Entries[a].Modified)
+		})
+	case sortAccessed:
+		access := loadAccessRecords(cmd)
+		slices.SortStableFunc(names, func(a, b string) int {
+			return access.Entries[b].Last.Compare(access.Entries[a].Last)
+		})
+	}
+}
+
+// compareNames compares entry names folder by folder. Folders come before
+// the entries next to them, and names equal to the collator are ordered by
+// their bytes, so the order never depends on the input.
+func compareNames(collator *collate.Collator, a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		aFolder, bFolder := i < len(as)-1, i < len(bs)-1
+		if aFolder != bFolder {
+			if aFolder {
+				return -1
+			}
+			return 1
+		}
+		if as[i] == bs[i] {
+			continue
+		}
+		if c := collator.CompareString(as[i], bs[i]); c != 0 {
+			return c
+		}
+		return strings.Compare(as[i], bs[i])
+	}
+	return len(as) - len(bs)
+}
+
+// userLocale returns the collation locale from LC_ALL, LC_COLLATE or LANG,
+// falling back to the root locale for C, POSIX or anything unknown
+func userLocale() language.Tag {
+	for _, name := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		// en_US.UTF-8@euro -> en-US
+		value, _, _ = strings.Cut(value, ".")
+		value, _, _ = strings.Cut(value, "@")
+		tag, err := language.Parse(strings.ReplaceAll(value, "_", "-"))
+		if err != nil {
+			return language.Und
+		}
+		return tag
+	}
+	return language.Und
+}
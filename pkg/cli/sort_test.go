@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+func TestCompareNames(t *testing.T) {
+	names := []string{"web10", "web/z", "Web2", "bank", "web/a/b", "web9", "web", "émail", "email", "web2"}
+	collator := collate.New(language.English, collate.Numeric)
+	slices.SortFunc(names, func(a, b string) int {
+		return compareNames(collator, a, b)
+	})
+
+	expected := []string{"web/a/b", "web/z", "bank", "email", "émail", "web", "web2", "Web2", "web9", "web10"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestSortEntriesByModified(t *testing.T) {
+	t.Setenv("LC_ALL", "C")
+	now := time.Now()
+	index := &storage.Index{Entries: map[string]storage.IndexEntry{
+		"old":      {Modified: now.Add(-time.Hour)},
+		"new":      {Modified: now},
+		"unknown":  {},
+		"also-old": {Modified: now.Add(-time.Hour)},
+	}}
+	names := index.Names()
+	sortEntries(nil, index, names, sortModified)
+
+	expected := []string{"new", "also-old", "old", "unknown"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestUserLocale(t *testing.T) {
+	for value, expected := range map[string]language.Tag{
+		"de_DE.UTF-8":      language.MustParse("de-DE"),
+		"sv_SE.UTF-8@euro": language.MustParse("sv-SE"),
+		"C":                language.Und,
+		"":                 language.Und,
+	} {
+		t.Setenv("LC_ALL", "")
+		t.Setenv("LC_COLLATE", "")
+		t.Setenv("LANG", value)
+		if got := userLocale(); got != expected {
+			t.Errorf("Expected %v for LANG=%q, got %v", expected, value, got)
+		}
+	}
+}
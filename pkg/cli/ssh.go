@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// sshAskpassCmd is the hidden command ssh runs, through SSH_ASKPASS, to ask
+// passh ssh for the password
+const sshAskpassCmd = "ssh-askpass"
+
+// sshAskpassEnv names the socket the askpass command fetches the password from
+const sshAskpassEnv = "PASSH_ASKPASS_SOCKET"
+
+// sshEntryPrefix is the folder passh ssh looks up hosts in
+const sshEntryPrefix = "ssh/"
+
+func newSSHCmd() *cobra.Command {
+	var entry string
+
+	cmd := &cobra.Command{
+		Use:   "ssh [--entry NAME] [USER@]HOST [SSH ARGS...]",
+		Short: "Log in with ssh using a stored password",
+		Long: "Run ssh with the password of the entry ssh/HOST (or ssh/USER@HOST, if it exists), for " +
+			"devices that only take passwords. The entry's username field is used as the login name " +
+			"unless USER@ or -l is given. Arguments after HOST are passed to ssh; put '--' before " +
+			"them if they start with a dash.\n\n" +
+			"The password is handed to ssh through SSH_ASKPASS, which needs OpenSSH 8.4 or later, " +
+			"and never appears in the environment or on a command line. It is given once, so a " +
+			"wrong password fails instead of being retried. Other questions from ssh, such as " +
+			"whether to trust a new host key, are asked on the terminal.",
+		Example: "  passh ssh admin@switch01\n" +
+			"  passh ssh --entry network/router router.lan -- -p 2222",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if runtime.GOOS == "windows" {
+				return errors.New("passh ssh is not supported on Windows")
+			}
+			host, sshArgs := args[0], args[1:]
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if entry == "" {
+				entry = sshEntry(store, host)
+			}
+			content, err := store.Get(entry)
+			if err != nil {
+				return err
+			}
+			secret := secure.Take(content)
+			defer secret.Destroy()
+			recordAccess(cmd, entry)
+			warnIfExpired(entry, content)
+
+			var login []string
+			if username, ok := parseEntryFields(content)["username"]; ok && !strings.Contains(host, "@") && !hasLoginFlag(sshArgs) {
+				login = []string{"-l", string(username)}
+			}
+
+			executable, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to find passh executable: %w", err)
+			}
+			dir, err := os.MkdirTemp("", "passh-ssh-")
+			if err != nil {
+				return fmt.Errorf("failed to create askpass directory: %w", err)
+			}
+			defer os.RemoveAll(dir)
+
+			// SSH_ASKPASS takes a program without arguments
+			askpass := filepath.Join(dir, "askpass")
+			script := "#!/bin/sh\nexec " + shellQuote(executable) + " " + sshAskpassCmd + " \"$@\"\n"
+			if err := os.WriteFile(askpass, []byte(script), 0700); err != nil {
+				return fmt.Errorf("failed to write askpass script: %w", err)
+			}
+			socket := filepath.Join(dir, "socket")
+			listener, err := net.Listen("unix", socket)
+			if err != nil {
+				return fmt.Errorf("failed to listen for askpass: %w", err)
+			}
+			defer listener.Close()
+			go serveAskpass(listener, firstLine(content))
+
+			sshArgv := append(append([]string{"-o", "NumberOfPasswordPrompts=1"}, login...), host)
+			child := exec.Command("ssh", append(sshArgv, sshArgs...)...)
+			child.Env = append(os.Environ(),
+				"SSH_ASKPASS="+askpass,
+				"SSH_ASKPASS_REQUIRE=force",
+				sshAskpassEnv+"="+socket)
+			child.Stdin = cmd.InOrStdin()
+			child.Stdout = cmd.OutOrStdout()
+			child.Stderr = cmd.ErrOrStderr()
+			return runChild(child)
+		},
+	}
+
+	cmd.Flags().StringVar(&entry, "entry", "", "Entry holding the password (default: ssh/HOST)")
+
+	return cmd
+}
+
+func newSSHAskpassCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:         sshAskpassCmd + " PROMPT",
+		Short:       "Answer a prompt from ssh for passh ssh",
+		Hidden:      true,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var prompt string
+			if len(args) > 0 {
+				prompt = args[0]
+			}
+
+			// Only password prompts get the password; anything else, like a
+			// new host key, is for the user to answer
+			if !strings.Contains(strings.ToLower(prompt), "password") {
+				answer, err := askTerminalLine(prompt)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), answer)
+				return nil
+			}
+
+			socket := os.Getenv(sshAskpassEnv)
+			if socket == "" {
+				return fmt.Errorf("$%s is not set; this command is run by passh ssh", sshAskpassEnv)
+			}
+			password, err := fetchAskpass(socket)
+			if err != nil {
+				return err
+			}
+			defer secure.Wipe(password)
+			out := cmd.OutOrStdout()
+			out.Write(password)
+			out.Write([]byte("\n"))
+			return nil
+		},
+	}
+}
+
+// sshEntry returns the entry for an ssh destination: ssh/USER@HOST if it
+// exists, or else ssh/HOST
+func sshEntry(store *storage.Store, destination string) string {
+	name := sshEntryPrefix + destination
+	if _, err := store.Stat(name); err == nil || !strings.Contains(destination, "@") {
+		return name
+	}
+	_, host, _ := strings.Cut(destination, "@")
+	return sshEntryPrefix + host
+}
+
+// sshArgOptions are the ssh options that take an argument
+const sshArgOptions = "BbcDEeFIiJLlmOoPpQRSWw"
+
+// hasLoginFlag reports whether ssh arguments set the login name with -l or
+// -o User. Like ssh, it stops at the first argument that is not an option,
+// where the remote command starts.
+func hasLoginFlag(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return false
+		}
+		// Options without an argument can be grouped, as in -tl admin
+		for j := 1; j < len(arg); j++ {
+			option := arg[j]
+			if !strings.ContainsRune(sshArgOptions, rune(option)) {
+				continue
+			}
+			value := arg[j+1:]
+			if value == "" && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			switch {
+			case option == 'l':
+				return true
+			case option == 'o' && isUserOption(value):
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+// isUserOption reports whether an -o argument sets User, as in User=admin
+// or "User admin"
+func isUserOption(option string) bool {
+	key, _, _ := strings.Cut(strings.TrimSpace(option), "=")
+	key, _, _ = strings.Cut(key, " ")
+	return strings.EqualFold(strings.TrimSpace(key), "user")
+}
+
+// serveAskpass hands the password to the first askpass command to ask for
+// it, so that a wrong password is not tried again
+func serveAskpass(listener net.Listener, password []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	conn.Write(password)
+	listener.Close()
+}
+
+// fetchAskpass reads the password from passh ssh
+func fetchAskpass(socket string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socket, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach passh ssh: %w", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	password, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password from passh ssh: %w", err)
+	}
+	return password, nil
+}
+
+// askTerminalLine asks a question on the controlling terminal and returns
+// the answer, as askTerminal does for yes/no questions
+func askTerminalLine(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to answer '%s' on: %w", strings.TrimSpace(prompt), err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	return readLine(tty)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestSSHEntry(t *testing.T) {
+	backend := storage.NewMemoryBackend()
+	for _, name := range []string{"ssh/switch01", "ssh/root@router"} {
+		if err := backend.Put(name, []byte("encrypted")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	store := storage.NewStoreWithBackend(backend, nil)
+
+	tests := map[string]string{
+		"switch01":       "ssh/switch01",
+		"admin@switch01": "ssh/switch01",
+		"root@router":    "ssh/root@router",
+		"router":         "ssh/router",
+	}
+	for destination, expected := range tests {
+		if entry := sshEntry(store, destination); entry != expected {
+			t.Errorf("sshEntry(%q) = %q, want %q", destination, entry, expected)
+		}
+	}
+}
+
+func TestHasLoginFlag(t *testing.T) {
+	set := [][]string{
+		{"-l", "admin"},
+		{"-ladmin"},
+		{"-tl", "admin"},
+		{"-o", "User=admin"},
+		{"-oUser=admin"},
+		{"-o", "user admin"},
+		{"-p", "2222", "-l", "admin", "uptime"},
+	}
+	for _, args := range set {
+		if !hasLoginFlag(args) {
+			t.Errorf("Expected %v to set the login name", args)
+		}
+	}
+
+	unset := [][]string{
+		{"-p", "2222", "uptime"},
+		{"ls", "-la"},
+		{"-t", "ls", "-l"},
+		{"--", "-l", "admin"},
+		{"-i", "-lkey", "uptime"},
+		{"-o", "UserKnownHostsFile=/dev/null"},
+	}
+	for _, args := range unset {
+		if hasLoginFlag(args) {
+			t.Errorf("Expected %v not to set the login name", args)
+		}
+	}
+}
+
+func TestAskpassSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+	go serveAskpass(listener, []byte("hunter2"))
+
+	password, err := fetchAskpass(socket)
+	if err != nil {
+		t.Fatalf("fetchAskpass failed: %v", err)
+	}
+	if string(password) != "hunter2" {
+		t.Errorf("Expected 'hunter2', got %q", password)
+	}
+
+	// The password is only handed out once
+	if _, err := fetchAskpass(socket); err == nil {
+		t.Error("Expected a second request to fail")
+	}
+}
@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/passh"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+func newSyncCmd() *cobra.Command {
+	var strategy string
+
+	cmd := &cobra.Command{
+		Use:   "sync [REMOTE]",
+		Short: "Synchronize the store with a remote",
+		Long: "Synchronize the store with a remote store, such as ssh://user@host/path, " +
+			"webdavs://host/remote.php/dav/files/user/passh or a directory on a mounted drive. " +
+			"Only these ssh (sftp), WebDAV and directory remotes are supported; git, rsync and S3 " +
+			"remotes are not. Push and pull a store kept in git with git itself.\n\n" +
+			"The remote defaults to the sync.remote config setting.\n\n" +
+			"WebDAV credentials are taken from the webdav.user and webdav.password or webdav.token " +
+			"settings, or read from a store entry named by webdav.password_entry or webdav.token_entry. " +
+			"They are only sent to webdav:// URLs, over plain HTTP, with webdav.insecure set to true.\n\n" +
+			"Entries changed on only one side since the last sync are copied to the other side. " +
+			"Entries changed on both sides are conflicts, resolved with --strategy or interactively.\n\n" +
+			"With --dry-run both sides are compared and the changes listed, but nothing is written. " +
+			"Conflicts are listed rather than prompted for, unless --strategy is given.",
+		Example: "  passh sync\n" +
+			"  passh sync ssh://user@host/srv/passh --strategy keep-both\n" +
+			"  passh --dry-run sync",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{dryRunAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun := isDryRun(cmd)
+			// The store is opened after checking the strategy
+			var store *storage.Store
+			resolve, err := conflictResolver(cmd, strategy, func(conflict storage.Conflict) ([]byte, error) {
+				return mergeConflict(cmd, store, conflict)
+			})
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			remoteLocation := cfg.Get("sync.remote")
+			if len(args) == 1 {
+				remoteLocation = args[0]
+			}
+			if remoteLocation == "" {
+				return fmt.Errorf("no remote given; pass REMOTE or run 'passh config set sync.remote URL'")
+			}
+
+			store, err = getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			options, err := passh.BackendOptions(cfg, store)
+			if err != nil {
+				return err
+			}
+			remote, err := storage.OpenBackendWithOptions(remoteLocation, options)
+			if err != nil {
+				return fmt.Errorf("failed to open remote: %w", err)
+			}
+			defer remote.Close()
+
+			storeDir, _ := cmd.Flags().GetString("store")
+			statePath, err := syncStatePath(storeDir, remoteLocation)
+			if err != nil {
+				return err
+			}
+			state, err := loadSyncState(statePath)
+			if err != nil {
+				return err
+			}
+
+			local := store.Backend()
+			if dryRun {
+				local, remote = storage.NewDryRunBackend(local), storage.NewDryRunBackend(remote)
+				if strategy == "prompt" {
+					resolve = func(storage.Conflict) (storage.Resolution, error) {
+						return storage.Skip, nil
+					}
+				}
+			}
+
+			ctx, stop := interruptible(cmd)
+			defer stop()
+			progress, finish := progressBar("Syncing")
+			// Conflict prompts go below the bar
+			prompting := resolve
+			resolve = func(conflict storage.Conflict) (storage.Resolution, error) {
+				finish()
+				return prompting(conflict)
+			}
+			result, err := storage.SyncContext(ctx, local, remote, state, resolve, progress)
+			finish()
+			if result == nil {
+				return err
+			}
+			if dryRun {
+				printSyncResult(cmd.OutOrStdout(), result, true)
+				return err
+			}
+
+			// An interrupted sync still records what it synced
+			if err := saveSyncState(statePath, result.State); err != nil {
+				return err
+			}
+			changed := append(append([]string(nil), result.Pulled...), result.DeletedLocal...)
+			if err := store.RefreshIndex(changed); err != nil {
+				logging.Warnf("failed to update the index, run 'passh index rebuild': %v", err)
+			}
+
+			printSyncResult(cmd.OutOrStdout(), result, false)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&strategy, "strategy", "prompt", "Conflict resolution: prompt, keep-local, keep-remote or keep-both")
+
+	return cmd
+}
+
+// conflictResolver returns the resolver for a --strategy value. In batch
+// mode conflicts can't be prompted for and fail the sync instead. merge
+// merges both versions of a conflict when the user asks to.
+func conflictResolver(cmd *cobra.Command, strategy string, merge func(storage.Conflict) ([]byte, error)) (storage.ConflictResolver, error) {
+	fixed := func(resolution storage.Resolution) storage.ConflictResolver {
+		return func(storage.Conflict) (storage.Resolution, error) {
+			return resolution, nil
+		}
+	}
+
+	switch strategy {
+	case "prompt":
+		if isBatch(cmd) {
+			return func(conflict storage.Conflict) (storage.Resolution, error) {
+				return 0, fmt.Errorf("conflict on '%s': %w; choose a --strategy", conflict.Name, errBatchInput)
+			}, nil
+		}
+		return func(conflict storage.Conflict) (storage.Resolution, error) {
+			return promptConflict(cmd.ErrOrStderr(), cmdPrompter(cmd), conflict, merge)
+		}, nil
+	case "keep-local":
+		return fixed(storage.KeepLocal), nil
+	case "keep-remote":
+		return fixed(storage.KeepRemote), nil
+	case "keep-both":
+		return fixed(storage.KeepBoth), nil
+	default:
+		return nil, fmt.Errorf("unknown strategy '%s', expected prompt, keep-local, keep-remote or keep-both", strategy)
+	}
+}
+
+// promptConflict describes a conflict on out and asks the user how to
+// resolve it. Entries changed on both sides can also be merged field by field.
+func promptConflict(out io.Writer, prompt prompter, conflict storage.Conflict, merge func(storage.Conflict) ([]byte, error)) (storage.Resolution, error) {
+	switch {
+	case !conflict.LocalExists:
+		fmt.Fprintf(out, "Conflict: '%s' was deleted locally but changed on the remote.\n", conflict.Name)
+	case !conflict.RemoteExists:
+		fmt.Fprintf(out, "Conflict: '%s' was changed locally but deleted on the remote.\n", conflict.Name)
+	default:
+		fmt.Fprintf(out, "Conflict: '%s' was changed both locally and on the remote.\n", conflict.Name)
+	}
+	choices := []string{"local", "remote", "both"}
+	if conflict.LocalExists && conflict.RemoteExists && merge != nil {
+		choices = append(choices, "merge")
+	}
+
+	choice, err := prompt.Select("Keep", choices)
+	if err != nil {
+		return 0, fmt.Errorf("sync aborted at '%s': %w", conflict.Name, err)
+	}
+	switch choices[choice] {
+	case "local":
+		return storage.KeepLocal, nil
+	case "remote":
+		return storage.KeepRemote, nil
+	case "both":
+		return storage.KeepBoth, nil
+	}
+	merged, err := merge(conflict)
+	if err != nil {
+		return 0, fmt.Errorf("sync aborted at '%s': %w", conflict.Name, err)
+	}
+	conflict.Merge(merged)
+	return storage.KeepMerged, nil
+}
+
+// syncStatePath returns where the base state for a store/remote pair is kept.
+// Local paths are made absolute first, so that the same store given as
+// ~/.passh, its full path or by default shares one state.
+func syncStatePath(storeDir, remoteLocation string) (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	store, err := syncLocation(storeDir, true)
+	if err != nil {
+		return "", err
+	}
+	remote, err := syncLocation(remoteLocation, false)
+	if err != nil {
+		return "", err
+	}
+
+	path := stateFile(dir, store, remote)
+	// States were once kept by the locations as given
+	if legacy := stateFile(dir, storeDir, remoteLocation); legacy != path {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.Rename(legacy, path); err != nil && !os.IsNotExist(err) {
+				logging.Warnf("failed to move sync state: %v", err)
+			}
+		}
+	}
+	return path, nil
+}
+
+// stateFile returns the sync state file in dir for a store/remote pair
+func stateFile(dir, storeDir, remoteLocation string) string {
+	sum := sha256.Sum256([]byte(storeDir + "\x00" + remoteLocation))
+	return filepath.Join(dir, "sync", hex.EncodeToString(sum[:8])+".json")
+}
+
+// syncLocation returns a store location in one form: URLs as they are, and
+// local paths absolute and cleaned. An empty store location is ~/.passh.
+func syncLocation(location string, store bool) (string, error) {
+	if strings.Contains(location, "://") {
+		return location, nil
+	}
+	if location == "" && store {
+		location = "~/.passh"
+	}
+	if location == "~" || strings.HasPrefix(location, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		location = filepath.Join(home, location[1:])
+	}
+	return filepath.Abs(location)
+}
+
+// loadSyncState reads the state of the last sync, or an empty state if there was none
+func loadSyncState(path string) (storage.SyncState, error) {
+	var state storage.SyncState
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse sync state: %w", err)
+	}
+	return state, nil
+}
+
+// saveSyncState records the state after a successful sync
+func saveSyncState(path string, state storage.SyncState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create sync state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
+
+// printSyncResult summarizes what a sync changed, or with dryRun what it
+// would change
+func printSyncResult(out io.Writer, result *storage.SyncResult, dryRun bool) {
+	pull, push, del := "pulled  ", "pushed  ", "deleted "
+	if dryRun {
+		pull, push, del = "would pull  ", "would push  ", "would delete"
+	}
+	for _, name := range result.Pulled {
+		fmt.Fprintf(out, "%s %s\n", pull, name)
+	}
+	for _, name := range result.Pushed {
+		fmt.Fprintf(out, "%s %s\n", push, name)
+	}
+	for _, name := range result.DeletedLocal {
+		fmt.Fprintf(out, "%s %s (local)\n", del, name)
+	}
+	for _, name := range result.DeletedRemote {
+		fmt.Fprintf(out, "%s %s (remote)\n", del, name)
+	}
+
+	if dryRun {
+		for _, name := range result.Conflicts {
+			fmt.Fprintf(out, "conflict     %s\n", name)
+		}
+		fmt.Fprintf(out, "Dry run: %d to pull, %d to push, %d to delete, %d conflicts\n",
+			len(result.Pulled), len(result.Pushed),
+			len(result.DeletedLocal)+len(result.DeletedRemote), len(result.Conflicts))
+		return
+	}
+	fmt.Fprintf(out, "Sync complete: %d pulled, %d pushed, %d deleted, %d conflicts resolved\n",
+		len(result.Pulled), len(result.Pushed),
+		len(result.DeletedLocal)+len(result.DeletedRemote), len(result.Conflicts))
+}
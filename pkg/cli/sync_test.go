@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncStatePathResolvesStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	expected, err := syncStatePath(filepath.Join(home, ".passh"), "/mnt/usb/passh")
+	if err != nil {
+		t.Fatalf("Failed to get sync state path: %v", err)
+	}
+	for _, store := range []string{"", "~/.passh", home + "/./.passh/"} {
+		path, err := syncStatePath(store, "/mnt/usb/../usb/passh")
+		if err != nil {
+			t.Fatalf("Failed to get sync state path for %q: %v", store, err)
+		}
+		if path != expected {
+			t.Errorf("Expected store %q to share the state %s, got %s", store, expected, path)
+		}
+	}
+
+	if path, _ := syncStatePath("ssh://host/srv/passh", "/mnt/usb/passh"); path == expected {
+		t.Errorf("Expected a remote store to have its own state")
+	}
+}
+
+func TestSyncStatePathMovesLegacyState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	legacy := stateFile(filepath.Join(config, "passh"), "", "/mnt/usb/passh")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := syncStatePath("", "/mnt/usb/passh")
+	if err != nil {
+		t.Fatalf("Failed to get sync state path: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the legacy state to be moved to %s: %v", path, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy state to be gone")
+	}
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+)
+
+// templatePlaceholder matches {name}, {prompt} and {prompt:Question} in
+// template lines
+var templatePlaceholder = regexp.MustCompile(`\{(name|prompt(?::[^{}]*)?)\}`)
+
+func newTemplateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Manage templates for new entries",
+		Long: "Templates give new entries a standard shape, for example for everyone sharing a store. " +
+			"They are kept encrypted in the store and used with 'passh add NAME --template TEMPLATE'.\n\n" +
+			"The first line of a template says how the password is chosen: {prompt} asks for it, and " +
+			"{generate [LENGTH] [nosymbols]} generates one. The other lines are copied into the entry, " +
+			"with {name} replaced by the entry name, and {prompt} or {prompt:Question} by an answer " +
+			"asked for when the entry is added. Lines whose prompts are all left empty are dropped, and " +
+			"lines starting with # are comments. For example:\n\n" +
+			"  {generate 24}\n" +
+			"  username: {prompt}\n" +
+			"  url: https://{prompt:Domain}\n" +
+			"  otpauth: {prompt:TOTP URI (optional)}",
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:     "add NAME",
+			Short:   "Store a template read from standard input",
+			Example: "  passh template add web-login < web-login.txt",
+			Args:    cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				content, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return fmt.Errorf("failed to read template: %w", err)
+				}
+				if _, err := parseTemplate(string(content)); err != nil {
+					return err
+				}
+
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				if err := store.AddTemplate(args[0], content); err != nil {
+					return err
+				}
+				logging.Infof("Added template '%s'", args[0])
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "show NAME",
+			Short:   "Print a template",
+			Example: "  passh template show web-login",
+			Args:    cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				content, err := store.Template(args[0])
+				if err != nil {
+					return err
+				}
+				defer secure.Wipe(content)
+				cmd.OutOrStdout().Write(content)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "list",
+			Short:   "List templates",
+			Example: "  passh template list",
+			Args:    cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				names, err := store.ListTemplates()
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					fmt.Fprintln(cmd.OutOrStdout(), name)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:     "delete NAME",
+			Short:   "Delete a template",
+			Example: "  passh template delete web-login",
+			Args:    cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				store, err := getStore(cmd)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				if !confirm(cmd, fmt.Sprintf("Delete template '%s'?", args[0])) {
+					logging.Infof("Deletion cancelled")
+					return nil
+				}
+				if err := store.DeleteTemplate(args[0]); err != nil {
+					return err
+				}
+				logging.Infof("Deleted template '%s'", args[0])
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
+
+// entryTemplate is a parsed template for new entries
+type entryTemplate struct {
+	// generate chooses a generated password over prompting for one
+	generate bool
+	length   int
+	symbols  bool
+	// lines follow the password in new entries
+	lines []string
+}
+
+// parseTemplate parses a template, checking its password line
+func parseTemplate(content string) (*entryTemplate, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the template is empty")
+	}
+
+	t := &entryTemplate{length: 16, symbols: true, lines: lines[1:]}
+	rule := strings.TrimSpace(lines[0])
+	if rule == "{prompt}" {
+		return t, nil
+	}
+
+	words := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(rule, "{"), "}"))
+	if !strings.HasPrefix(rule, "{") || !strings.HasSuffix(rule, "}") || len(words) == 0 || words[0] != "generate" {
+		return nil, fmt.Errorf("the first line of a template must be {prompt} or {generate [LENGTH] [nosymbols]}, not '%s'", rule)
+	}
+	t.generate = true
+	for _, word := range words[1:] {
+		if word == "nosymbols" {
+			t.symbols = false
+			continue
+		}
+		length, err := strconv.Atoi(word)
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("invalid template password rule '%s'", rule)
+		}
+		t.length = length
+	}
+	return t, nil
+}
+
+// render fills in the template lines for an entry, asking for every prompt
+func (t *entryTemplate) render(name string, ask func(question string) (string, error)) ([]string, error) {
+	var rendered []string
+	for _, line := range t.lines {
+		var out strings.Builder
+		prompts, answered := 0, 0
+		last := 0
+		for _, match := range templatePlaceholder.FindAllStringSubmatchIndex(line, -1) {
+			out.WriteString(line[last:match[0]])
+			last = match[1]
+
+			placeholder := line[match[2]:match[3]]
+			if placeholder == "name" {
+				out.WriteString(name)
+				continue
+			}
+
+			question, ok := strings.CutPrefix(placeholder, "prompt:")
+			if !ok {
+				// A bare {prompt} asks for the field it is in
+				question, _, _ = strings.Cut(line, ":")
+				if question == line {
+					question = "Value"
+				}
+			}
+			answer, err := ask(strings.TrimSpace(question))
+			if err != nil {
+				return nil, err
+			}
+			prompts++
+			if answer != "" {
+				answered++
+			}
+			out.WriteString(answer)
+		}
+		out.WriteString(line[last:])
+
+		if prompts > 0 && answered == 0 {
+			continue
+		}
+		rendered = append(rendered, out.String())
+	}
+	return rendered, nil
+}
+
+// askTemplateField prompts for a template field on the command's input
+func askTemplateField(cmd *cobra.Command, question string) (string, error) {
+	if isBatch(cmd) {
+		return "", fmt.Errorf("the template asks for '%s': %w", question, errBatchInput)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s: ", question)
+	answer, err := readLine(cmd.InOrStdin())
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", question, err)
+	}
+	return strings.TrimSpace(answer), nil
+}
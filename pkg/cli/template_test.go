@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	template, err := parseTemplate("# Web logins\n{generate 24 nosymbols}\nusername: {prompt}\n")
+	if err != nil {
+		t.Fatalf("parseTemplate failed: %v", err)
+	}
+	if !template.generate || template.length != 24 || template.symbols {
+		t.Errorf("Unexpected password rule %+v", template)
+	}
+	if !reflect.DeepEqual(template.lines, []string{"username: {prompt}"}) {
+		t.Errorf("Unexpected lines %q", template.lines)
+	}
+
+	if template, err := parseTemplate("{prompt}\nurl: https://"); err != nil || template.generate {
+		t.Errorf("Expected a prompted password, got %+v (%v)", template, err)
+	}
+	for _, invalid := range []string{"", "hunter2\nuser: {prompt}", "{generate many}"} {
+		if _, err := parseTemplate(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	template, err := parseTemplate("{prompt}\nusername: {prompt}\nurl: https://{prompt:Domain}/login\notpauth: {prompt:TOTP URI}\nnote: created for {name}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := map[string]string{"username": "alice", "Domain": "example.com", "TOTP URI": ""}
+	var asked []string
+	lines, err := template.render("web/example", func(question string) (string, error) {
+		asked = append(asked, question)
+		return answers[question], nil
+	})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	if expected := []string{"username", "Domain", "TOTP URI"}; !reflect.DeepEqual(asked, expected) {
+		t.Errorf("Expected questions %q, got %q", expected, asked)
+	}
+	expected := []string{
+		"username: alice",
+		"url: https://example.com/login",
+		"note: created for web/example",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
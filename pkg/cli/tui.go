@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/tui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func newTUICmd() *cobra.Command {
+	var showHidden bool
+
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Browse and edit the store in a full-screen interface",
+		Long: "Open a full-screen interface to browse the store's folders, view and edit entries, " +
+			"generate passwords and audit the store for weak, reused, stale or unreadable passwords.",
+		Example: "  passh tui\n" +
+			"  passh tui --show-hidden",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if isBatch(cmd) {
+				return fmt.Errorf("tui is interactive: %w", errBatchInput)
+			}
+			if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				return errors.New("tui requires a terminal")
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			return tui.Run(store, generateRandomPassword, showHidden)
+		},
+	}
+	cmd.Flags().BoolVar(&showHidden, "show-hidden", false, "Also show entries marked 'hidden: true'")
+
+	return cmd
+}
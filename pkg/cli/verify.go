@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+func newVerifyCmd() *cobra.Command {
+	var all bool
+	var allowedSignersPath string
+
+	cmd := &cobra.Command{
+		Use:   "verify [NAME]",
+		Short: "Check that entries can be decrypted",
+		Long: "Check that the available private keys or agent identities can decrypt an entry, " +
+			"without printing it. Use --all to check every entry in the store.\n\n" +
+			"With an allowed signers file, from --allowed-signers or the sign.allowed_signers setting, " +
+			"entries must also be signed by one of its keys. This detects entries written by anyone " +
+			"else, as anyone who knows the recipients' public keys can write an entry. The file has " +
+			"the format of 'ssh-keygen -Y verify' and git: principals followed by a public key.",
+		Example: "  passh verify github/personal\n" +
+			"  passh verify --all\n" +
+			"  passh verify team/db --allowed-signers ./allowed_signers",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) > 0 {
+				return fmt.Errorf("cannot combine NAME with --all")
+			}
+			if !all && len(args) != 1 {
+				return fmt.Errorf("requires exactly one NAME, or --all")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			allowed, err := loadAllowedSigners(cmd, allowedSignersPath)
+			if err != nil {
+				return err
+			}
+
+			store, err := getStore(cmd)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			names := args
+			if all {
+				names, err = store.List()
+				if err != nil {
+					return err
+				}
+			}
+
+			failed := 0
+			for _, name := range names {
+				if allowed == nil {
+					password, err := store.Get(name)
+					if err != nil {
+						failed++
+						fmt.Fprintf(cmd.OutOrStdout(), "FAIL %s: %v\n", name, err)
+						continue
+					}
+					// Wipe the plaintext, we only care that decryption succeeded
+					secure.Wipe(password)
+					fmt.Fprintf(cmd.OutOrStdout(), "OK   %s\n", name)
+					continue
+				}
+
+				key, err := store.VerifySignature(name, allowed)
+				if err != nil {
+					failed++
+					fmt.Fprintf(cmd.OutOrStdout(), "FAIL %s: %v\n", name, err)
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "OK   %s (signed by %s %s)\n", name, key.Type(), ssh.FingerprintSHA256(key))
+			}
+
+			if failed > 0 && allowed != nil {
+				return fmt.Errorf("%d of %d entries could not be decrypted or have no valid signature", failed, len(names))
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d entries could not be decrypted", failed, len(names))
+			}
+
+			if all && allowed != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "All %d entries can be decrypted and are signed by allowed signers\n", len(names))
+			} else if all {
+				fmt.Fprintf(cmd.OutOrStdout(), "All %d entries can be decrypted\n", len(names))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Verify every entry in the store")
+	cmd.Flags().StringVar(&allowedSignersPath, "allowed-signers", "", "Also check signatures against this allowed signers file (default: sign.allowed_signers setting)")
+
+	return cmd
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// releaseNamespace is the ssh-keygen signature namespace for releases
+const releaseNamespace = "passh-release"
+
+//go:embed release_signing_keys.pub
+var releaseSigningKeys []byte
+
+func newVerifyBinaryCmd() *cobra.Command {
+	var keyFile string
+
+	cmd := &cobra.Command{
+		Use:   "verify-binary FILE [SIGNATURE]",
+		Short: "Verify the signature of a passh release",
+		Long: "Check that a downloaded passh release was signed by the passh release key " +
+			"built into this binary. The signature defaults to FILE.sig, as made by " +
+			"'ssh-keygen -Y sign -n passh-release'. Use --key to trust a different key, " +
+			"for example for your own builds.",
+		Example: "  passh verify-binary passh_linux_amd64 passh_linux_amd64.sig\n" +
+			"  passh verify-binary passh_linux_amd64 --key release_keys.pub",
+		Args:        cobra.RangeArgs(1, 2),
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := args[0]
+			signatureFile := file + ".sig"
+			if len(args) == 2 {
+				signatureFile = args[1]
+			}
+
+			keyData := releaseSigningKeys
+			if keyFile != "" {
+				var err error
+				if keyData, err = os.ReadFile(keyFile); err != nil {
+					return fmt.Errorf("failed to read signing key: %w", err)
+				}
+			}
+			trusted, err := storage.ParseRecipients(keyData)
+			if err != nil {
+				return fmt.Errorf("invalid signing key: %w", err)
+			}
+			if len(trusted) == 0 {
+				return errors.New("this build has no release signing key; specify one with --key")
+			}
+
+			signature, err := os.ReadFile(signatureFile)
+			if err != nil {
+				return fmt.Errorf("failed to read signature: %w", err)
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			key, err := crypto.VerifySSHSignature(trusted, releaseNamespace, f, signature)
+			if err != nil {
+				return fmt.Errorf("'%s' failed verification: %w", file, err)
+			}
+
+			logging.Infof("Good signature on '%s' by %s", file, ssh.FingerprintSHA256(key))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key", "", "Trust the signing key(s) in this authorized_keys file instead")
+
+	return cmd
+}
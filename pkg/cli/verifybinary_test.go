@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestReleaseSigningKeysParse(t *testing.T) {
+	if _, err := storage.ParseRecipients(releaseSigningKeys); err != nil {
+		t.Fatalf("Embedded release signing keys are invalid: %v", err)
+	}
+}
+
+// TestReleaseSigningKeysPresent stops a release that verify-binary could not
+// check. It runs when PASSH_RELEASE is set, as the release steps do.
+func TestReleaseSigningKeysPresent(t *testing.T) {
+	if os.Getenv("PASSH_RELEASE") == "" {
+		t.Skip("PASSH_RELEASE is not set")
+	}
+	keys, err := storage.ParseRecipients(releaseSigningKeys)
+	if err != nil {
+		t.Fatalf("Embedded release signing keys are invalid: %v", err)
+	}
+	if len(keys) == 0 {
+		t.Fatal("Expected a release signing key in release_signing_keys.pub")
+	}
+}
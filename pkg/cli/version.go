@@ -1,20 +1,189 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// Build metadata, set when building a release with
+//
+//	-ldflags "-X github.com/rejoice4156/passh/pkg/cli.version=v1.2.0
+//	          -X github.com/rejoice4156/passh/pkg/cli.commit=abc1234
+//	          -X github.com/rejoice4156/passh/pkg/cli.date=2025-04-08T11:32:27Z"
+//
+// Anything left empty is filled in from the module build info where possible.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// releasesURL is the GitHub API endpoint for the latest release
+var releasesURL = "https://api.github.com/repos/rejoice4156/passh/releases/latest"
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version  string
+	Commit   string
+	Date     string
+	Modified bool
+}
+
+// currentBuild combines the ldflags metadata with what the Go toolchain
+// records, so 'go install ...@v1.2.0' and plain 'go build' report something
+// useful too
+func currentBuild() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: date}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if len(info.Commit) > 12 {
+		info.Commit = info.Commit[:12]
+	}
+	return info
+}
+
 func newVersionCmd() *cobra.Command {
-	return &cobra.Command{
+	var check bool
+
+	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Display version information",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Passh - SSH-backed password manager")
-			fmt.Println("Build date: 2025-04-08 11:32:27")
-			fmt.Println("Author: rejoice4156")
-			fmt.Println("License: MIT")
+		Long: "Display the version, commit and build date of passh. With --check, also ask " +
+			"GitHub whether a newer release is available.",
+		Example: "  passh version\n" +
+			"  passh version --check",
+		Args:        cobra.NoArgs,
+		Annotations: map[string]string{keysAnnotation: keysNone},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			info := currentBuild()
+
+			fmt.Fprintf(out, "passh %s\n", info.Version)
+			if info.Commit != "" {
+				modified := ""
+				if info.Modified {
+					modified = " (modified)"
+				}
+				fmt.Fprintf(out, "Commit:   %s%s\n", info.Commit, modified)
+			}
+			if info.Date != "" {
+				fmt.Fprintf(out, "Built:    %s\n", info.Date)
+			}
+			fmt.Fprintf(out, "Go:       %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+			fmt.Fprintln(out, "Author:   rejoice4156")
+			fmt.Fprintln(out, "License:  MIT")
+
+			if !check {
+				return nil
+			}
+
+			latest, url, err := latestRelease()
+			if err != nil {
+				return err
+			}
+			switch {
+			case info.Version == "dev":
+				fmt.Fprintf(out, "\nThe latest release is %s: %s\n", latest, url)
+			case newerVersion(latest, info.Version):
+				fmt.Fprintf(out, "\nA newer release is available: %s\n%s\n", latest, url)
+			default:
+				fmt.Fprintln(out, "\npassh is up to date")
+			}
+			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "Check GitHub for a newer release")
+
+	return cmd
+}
+
+// latestRelease returns the tag and page of the latest GitHub release
+func latestRelease() (string, string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(http.MethodGet, releasesURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to check for updates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to check for updates: %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&release); err != nil {
+		return "", "", fmt.Errorf("failed to parse release information: %w", err)
+	}
+	if release.TagName == "" {
+		return "", "", fmt.Errorf("failed to parse release information: no tag name")
+	}
+	return release.TagName, release.HTMLURL, nil
+}
+
+// newerVersion reports whether version a is newer than b, comparing the
+// numeric vMAJOR.MINOR.PATCH parts. A release is newer than a pre-release of
+// the same version.
+func newerVersion(a, b string) bool {
+	aParts, aPre := parseVersion(a)
+	bParts, bPre := parseVersion(b)
+	for i := range aParts {
+		if aParts[i] != bParts[i] {
+			return aParts[i] > bParts[i]
+		}
+	}
+	return bPre && !aPre
+}
+
+// parseVersion splits a version like v1.2.3-rc.1 into its numbers and
+// whether it is a pre-release
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, _, prerelease := strings.Cut(v, "-")
+	for i, field := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts, prerelease
 }
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.1.0", "v1.2.0", false},
+		{"v1.2.0", "v1.2.0-rc.1", true},
+		{"v1.2.0-rc.1", "v1.2.0", false},
+		{"v2.0.0", "v1.9.9+dirty", true},
+	}
+
+	for _, test := range tests {
+		if got := newerVersion(test.a, test.b); got != test.expected {
+			t.Errorf("newerVersion(%q, %q) = %v, expected %v", test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.3.0", "html_url": "https://github.com/rejoice4156/passh/releases/tag/v1.3.0"}`))
+	}))
+	defer server.Close()
+
+	defer func(url string) { releasesURL = url }(releasesURL)
+	releasesURL = server.URL
+
+	tag, url, err := latestRelease()
+	if err != nil {
+		t.Fatalf("latestRelease failed: %v", err)
+	}
+	if tag != "v1.3.0" || url != "https://github.com/rejoice4156/passh/releases/tag/v1.3.0" {
+		t.Errorf("Unexpected release %q at %q", tag, url)
+	}
+}
+
+func TestCurrentBuildUsesLdflags(t *testing.T) {
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.0", "0123456789abcdef"
+
+	info := currentBuild()
+	if info.Version != "v1.2.0" {
+		t.Errorf("Expected version v1.2.0, got %q", info.Version)
+	}
+	if info.Commit != "0123456789ab" {
+		t.Errorf("Expected shortened commit, got %q", info.Commit)
+	}
+}
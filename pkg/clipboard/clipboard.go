@@ -0,0 +1,144 @@
+// Package clipboard copies text to the system clipboard using the
+// platform's clipboard tools.
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ErrUnavailable is returned when no clipboard tool is installed
+var ErrUnavailable = errors.New("no clipboard tool found (install wl-clipboard on Wayland, or xclip or xsel on X11)")
+
+// ErrNoTmux is returned when a tmux buffer is asked for outside tmux
+var ErrNoTmux = errors.New("not running inside tmux")
+
+// TmuxBuffer is the tmux paste buffer secrets are loaded into
+const TmuxBuffer = "passh"
+
+// Clipboard runs the commands that copy to, paste from and clear the clipboard
+type Clipboard struct {
+	Name  string
+	copy  []string
+	paste []string
+	clear []string
+}
+
+// tools lists the supported clipboard tools in order of preference
+var tools = []struct {
+	goos    string
+	env     string
+	command string
+	board   Clipboard
+}{
+	{"darwin", "", "pbcopy", Clipboard{Name: "pbcopy", copy: []string{"pbcopy"}, paste: []string{"pbpaste"}}},
+	{"windows", "", "powershell", Clipboard{Name: "powershell",
+		copy:  []string{"powershell", "-NoProfile", "-Command", "Set-Clipboard -Value ([Console]::In.ReadToEnd())"},
+		paste: []string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"},
+		clear: []string{"powershell", "-NoProfile", "-Command", "Set-Clipboard -Value $null"}}},
+	{"", "WAYLAND_DISPLAY", "wl-copy", Clipboard{Name: "wl-copy",
+		copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}, clear: []string{"wl-copy", "--clear"}}},
+	{"", "DISPLAY", "xclip", Clipboard{Name: "xclip",
+		copy: []string{"xclip", "-selection", "clipboard", "-in"}, paste: []string{"xclip", "-selection", "clipboard", "-out"}}},
+	{"", "DISPLAY", "xsel", Clipboard{Name: "xsel",
+		copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}, clear: []string{"xsel", "--clipboard", "--delete"}}},
+}
+
+// Detect finds a clipboard tool for the current platform and session
+func Detect() (*Clipboard, error) {
+	for _, tool := range tools {
+		if tool.goos != "" && tool.goos != runtime.GOOS {
+			continue
+		}
+		if tool.env != "" && os.Getenv(tool.env) == "" {
+			continue
+		}
+		if _, err := exec.LookPath(tool.command); err == nil {
+			board := tool.board
+			return &board, nil
+		}
+	}
+	return nil, ErrUnavailable
+}
+
+// Tmux returns a clipboard backed by the passh paste buffer of the tmux
+// server the current pane belongs to, for sessions without a system
+// clipboard such as on remote hosts
+func Tmux() (*Clipboard, error) {
+	if os.Getenv("TMUX") == "" {
+		return nil, ErrNoTmux
+	}
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil, fmt.Errorf("tmux not found: %w", err)
+	}
+	return &Clipboard{
+		Name:  "tmux",
+		copy:  []string{"tmux", "load-buffer", "-b", TmuxBuffer, "-"},
+		paste: []string{"tmux", "show-buffer", "-b", TmuxBuffer},
+		clear: []string{"tmux", "delete-buffer", "-b", TmuxBuffer},
+	}, nil
+}
+
+// Command returns a clipboard that runs shell commands, for environments
+// without a supported tool. copy reads the data on stdin, and is run with no
+// input to clear the clipboard. paste may be empty, in which case the
+// clipboard can't be read back.
+func Command(copy, paste string) *Clipboard {
+	board := &Clipboard{Name: "clip.copy_cmd", copy: shell(copy)}
+	if paste != "" {
+		board.paste = shell(paste)
+	}
+	return board
+}
+
+// shell runs a command line with the platform's shell
+func shell(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+// CanPaste reports whether the clipboard can be read back
+func (c *Clipboard) CanPaste() bool {
+	return c.paste != nil
+}
+
+// Copy places data on the clipboard
+func (c *Clipboard) Copy(data []byte) error {
+	cmd := exec.Command(c.copy[0], c.copy[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	// Output is not captured: X11 tools keep running in the background to
+	// serve the selection, and would hold captured pipes open
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", c.Name, err)
+	}
+	return nil
+}
+
+// Paste returns the clipboard contents
+func (c *Clipboard) Paste() ([]byte, error) {
+	if c.paste == nil {
+		return nil, fmt.Errorf("%s can't read the clipboard", c.Name)
+	}
+	output, err := exec.Command(c.paste[0], c.paste[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to read the clipboard: %w", c.Name, err)
+	}
+	return output, nil
+}
+
+// Clear empties the clipboard
+func (c *Clipboard) Clear() error {
+	if c.clear == nil {
+		return c.Copy(nil)
+	}
+	if err := exec.Command(c.clear[0], c.clear[1:]...).Run(); err != nil {
+		return fmt.Errorf("%s failed to clear the clipboard: %w", c.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package clipboard
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeXclip installs a shell script standing in for xclip that keeps the
+// clipboard in a file
+func fakeXclip(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the fake clipboard tool is a Unix shell script for X11")
+	}
+
+	dir := t.TempDir()
+	store := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\n" +
+		"case \"$3\" in\n" +
+		"  -in) cat > " + store + " ;;\n" +
+		"  -out) cat " + store + " 2>/dev/null ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake xclip: %v", err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", ":0")
+}
+
+func TestCopyPasteClear(t *testing.T) {
+	fakeXclip(t)
+
+	board, err := Detect()
+	if err != nil {
+		t.Fatalf("Failed to detect clipboard: %v", err)
+	}
+	if board.Name != "xclip" {
+		t.Fatalf("Expected xclip, got %s", board.Name)
+	}
+
+	if err := board.Copy([]byte("hunter2")); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	data, err := board.Paste()
+	if err != nil || string(data) != "hunter2" {
+		t.Fatalf("Expected 'hunter2', got %q (%v)", data, err)
+	}
+
+	if err := board.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	data, err = board.Paste()
+	if err != nil || len(data) != 0 {
+		t.Fatalf("Expected an empty clipboard, got %q (%v)", data, err)
+	}
+}
+
+func TestDetectUnavailable(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", "")
+
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("clipboard tools are part of the system")
+	}
+	if _, err := Detect(); err != ErrUnavailable {
+		t.Fatalf("Expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestTmuxBuffer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tmux is a shell script")
+	}
+	t.Setenv("TMUX", "")
+	if _, err := Tmux(); err != ErrNoTmux {
+		t.Fatalf("Expected ErrNoTmux outside tmux, got %v", err)
+	}
+
+	dir := t.TempDir()
+	buffer := filepath.Join(dir, "buffer")
+	script := "#!/bin/sh\n" +
+		"[ \"$3\" = " + TmuxBuffer + " ] || exit 1\n" +
+		"case \"$1\" in\n" +
+		"  load-buffer) cat > " + buffer + " ;;\n" +
+		"  show-buffer) cat " + buffer + " ;;\n" +
+		"  delete-buffer) rm " + buffer + " ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "tmux"), []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake tmux: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+
+	board, err := Tmux()
+	if err != nil {
+		t.Fatalf("Failed to find tmux: %v", err)
+	}
+	if err := board.Copy([]byte("hunter2")); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if data, err := board.Paste(); err != nil || string(data) != "hunter2" {
+		t.Fatalf("Expected 'hunter2', got %q (%v)", data, err)
+	}
+	if err := board.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if _, err := board.Paste(); err == nil {
+		t.Fatal("Expected the buffer to be deleted")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are written for sh")
+	}
+	file := filepath.Join(t.TempDir(), "clipboard")
+
+	board := Command("cat > "+file, "cat "+file)
+	if err := board.Copy([]byte("hunter2")); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if data, err := board.Paste(); err != nil || string(data) != "hunter2" {
+		t.Fatalf("Expected 'hunter2', got %q (%v)", data, err)
+	}
+	if err := board.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if data, err := board.Paste(); err != nil || len(data) != 0 {
+		t.Fatalf("Expected an empty clipboard, got %q (%v)", data, err)
+	}
+
+	copyOnly := Command("cat > "+file, "")
+	if copyOnly.CanPaste() {
+		t.Fatal("Expected a clipboard without a paste command to be write-only")
+	}
+	if _, err := copyOnly.Paste(); err == nil {
+		t.Fatal("Expected Paste to fail without a paste command")
+	}
+}
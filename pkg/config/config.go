@@ -0,0 +1,145 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+)
+
+// Config holds user settings as flat "key = value" pairs, for example:
+//
+//	# ~/.config/passh/config
+//	sync.remote = ssh://user@host/srv/passh
+type Config struct {
+	path   string
+	values map[string]string
+}
+
+// Dir returns the passh configuration directory, honoring XDG_CONFIG_HOME
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "passh"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "passh"), nil
+}
+
+// Load reads the default configuration file. A missing file yields an empty config.
+func Load() (*Config, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(filepath.Join(dir, "config"))
+}
+
+// LoadFile reads configuration from the given path. A missing file yields an empty config.
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{path: path, values: make(map[string]string)}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected 'key = value'", path, lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		// Values may be quoted to keep surrounding spaces or special characters
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value: %w", path, lineNumber, err)
+			}
+			value = unquoted
+		}
+
+		cfg.values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	logging.Debugf("loaded %d settings from %s", len(cfg.values), path)
+	return cfg, nil
+}
+
+// Path returns the file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Get returns the value for a key, or an empty string if unset
+func (c *Config) Get(key string) string {
+	return c.values[key]
+}
+
+// Lookup returns the value for a key and whether it was set
+func (c *Config) Lookup(key string) (string, bool) {
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// Set assigns a value to a key
+func (c *Config) Set(key, value string) {
+	c.values[key] = value
+}
+
+// Unset removes a key
+func (c *Config) Unset(key string) {
+	delete(c.values, key)
+}
+
+// Keys returns all configured keys in sorted order
+func (c *Config) Keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Save writes the configuration back to its file
+func (c *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	var b strings.Builder
+	for _, key := range c.Keys() {
+		fmt.Fprintf(&b, "%s = %s\n", key, strconv.Quote(c.values[key]))
+	}
+
+	if err := os.WriteFile(c.path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
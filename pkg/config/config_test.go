@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("Expected missing config to load, got: %v", err)
+	}
+	if len(cfg.Keys()) != 0 {
+		t.Fatalf("Expected empty config, got keys %v", cfg.Keys())
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	content := "# comment\n\nsync.remote = ssh://host/srv/passh\ncopy_cmd = \"xsel -ib\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got := cfg.Get("sync.remote"); got != "ssh://host/srv/passh" {
+		t.Errorf("Expected sync.remote to be 'ssh://host/srv/passh', got '%s'", got)
+	}
+	if got := cfg.Get("copy_cmd"); got != "xsel -ib" {
+		t.Errorf("Expected quoted value to be unquoted, got '%s'", got)
+	}
+	if _, ok := cfg.Lookup("missing"); ok {
+		t.Error("Expected missing key not to be found")
+	}
+}
+
+func TestLoadInvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("not a setting\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := LoadFile(path); err == nil {
+		t.Fatal("Expected an error for a line without '='")
+	}
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	cfg.Set("sync.remote", "/mnt/usb/passh")
+	cfg.Set("note", "  spaced \"value\"  ")
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	reloaded, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	for _, key := range cfg.Keys() {
+		if reloaded.Get(key) != cfg.Get(key) {
+			t.Errorf("Key %s: expected '%s', got '%s'", key, cfg.Get(key), reloaded.Get(key))
+		}
+	}
+}
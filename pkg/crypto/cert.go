@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidCertificate is returned for SSH certificates that are expired,
+// not yet valid or not signed by the CA they name
+var ErrInvalidCertificate = errors.New("invalid SSH certificate")
+
+// CertifiedKey returns the key an SSH certificate certifies, or key itself if
+// it is not a certificate. Entries are encrypted to the certified key, so
+// renewing a certificate doesn't require re-encrypting anything.
+func CertifiedKey(key ssh.PublicKey) ssh.PublicKey {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		return cert.Key
+	}
+	return key
+}
+
+// CheckCertificate verifies that a certificate is signed by its CA and valid
+// at the given time
+func CheckCertificate(cert *ssh.Certificate, now time.Time) error {
+	checker := &ssh.CertChecker{Clock: func() time.Time { return now }}
+	// Critical options restrict logins, not who may read entries
+	for option := range cert.CriticalOptions {
+		checker.SupportedCriticalOptions = append(checker.SupportedCriticalOptions, option)
+	}
+	principal := ""
+	if len(cert.ValidPrincipals) > 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrInvalidCertificate, cert.KeyId, err)
+	}
+	return nil
+}
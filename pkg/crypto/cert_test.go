@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCheckCertificate(t *testing.T) {
+	_, caKey, _ := ed25519.GenerateKey(rand.Reader)
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	publicKey, err := ssh.NewPublicKey(userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		KeyId:           "alice",
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"alice"},
+		ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		Permissions:     ssh.Permissions{CriticalOptions: map[string]string{"force-command": "true"}},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckCertificate(cert, now); err != nil {
+		t.Errorf("Expected a valid certificate, got %v", err)
+	}
+	if err := CheckCertificate(cert, now.Add(2*time.Hour)); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("Expected an expired certificate to be rejected, got %v", err)
+	}
+	if err := CheckCertificate(cert, now.Add(-2*time.Hour)); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("Expected a certificate not yet valid to be rejected, got %v", err)
+	}
+
+	forged := *cert
+	forged.KeyId = "mallory"
+	if err := CheckCertificate(&forged, now); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("Expected a certificate not signed by its CA to be rejected, got %v", err)
+	}
+
+	if key := CertifiedKey(cert); string(key.Marshal()) != string(publicKey.Marshal()) {
+		t.Error("Expected the certified key")
+	}
+	if key := CertifiedKey(publicKey); string(key.Marshal()) != string(publicKey.Marshal()) {
+		t.Error("Expected a plain key to be returned as is")
+	}
+}
@@ -1,7 +1,75 @@
 package crypto
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrNoRecipients is returned when there is no public key to encrypt to
+	ErrNoRecipients = errors.New("no public keys available for encryption")
+	// ErrDecryptFailed is returned when none of the loaded private keys can
+	// decrypt the data, usually because it was encrypted to other keys
+	ErrDecryptFailed = errors.New("decryption failed")
+	// ErrNoPrivateKey is returned along with ErrDecryptFailed when only
+	// public keys are loaded, which can encrypt but not decrypt
+	ErrNoPrivateKey = errors.New("no private key loaded")
+)
+
+// DecryptError is returned when none of the loaded private keys is a
+// recipient of an entry. It lists the keys on both sides, so users can tell
+// which key they are missing.
+type DecryptError struct {
+	// Recipients are the keys the entry is encrypted to
+	Recipients []ssh.PublicKey
+	// Available are the keys that were tried
+	Available []ssh.PublicKey
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("%v: none of the available private keys is a recipient of this entry "+
+		"(encrypted to %s; available: %s)", ErrDecryptFailed, fingerprints(e.Recipients), fingerprints(e.Available))
+}
+
+// Unwrap makes errors.Is(err, ErrDecryptFailed) hold
+func (e *DecryptError) Unwrap() error {
+	return ErrDecryptFailed
+}
+
+// fingerprints lists keys by type and SHA256 fingerprint
+func fingerprints(keys []ssh.PublicKey) string {
+	if len(keys) == 0 {
+		return "none"
+	}
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		labels[i] = key.Type() + " " + ssh.FingerprintSHA256(CertifiedKey(key))
+	}
+	return strings.Join(labels, ", ")
+}
+
 // Encryptor defines the interface for encryption/decryption operations
 type Encryptor interface {
 	Encrypt(data []byte) (string, error)
 	Decrypt(encryptedData string) ([]byte, error)
+	// EncryptStream encrypts r into w in constant memory
+	EncryptStream(r io.Reader, w io.Writer) error
+	// DecryptStream decrypts a stream written by EncryptStream
+	DecryptStream(r io.Reader, w io.Writer) error
+}
+
+// RecipientEncryptor is an Encryptor that can encrypt to an explicit set of
+// public keys and tell who an encrypted entry is readable by
+type RecipientEncryptor interface {
+	Encryptor
+	// PublicKeys returns the keys Encrypt encrypts to
+	PublicKeys() []ssh.PublicKey
+	// EncryptTo encrypts data to the given keys instead
+	EncryptTo(data []byte, recipients []ssh.PublicKey) (string, error)
+	// Recipients returns the keys encryptedData is encrypted to
+	Recipients(encryptedData string) ([]ssh.PublicKey, error)
 }
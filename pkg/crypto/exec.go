@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+)
+
+// runTool runs an external tool such as gpg or a cloud CLI with input on
+// stdin and returns its output, reporting the tool's own message on failure
+func runTool(binary string, args []string, input []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	logging.Debugf("running %s %s", binary, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, errors.New(message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+)
+
+// gpgArmorHeader starts every entry encrypted by GPGEncryptor
+const gpgArmorHeader = "-----BEGIN PGP MESSAGE-----"
+
+// GPGEncryptor encrypts entries with gpg, so that pass users can keep their
+// GPG keys. Decryption goes through gpg-agent, which asks for the passphrase
+// or talks to a smartcard as configured.
+type GPGEncryptor struct {
+	recipients []string
+	// binary is the gpg executable, gpg unless overridden in tests
+	binary string
+}
+
+// NewGPGEncryptor creates an encryptor that encrypts to the given GPG key
+// IDs, fingerprints or email addresses
+func NewGPGEncryptor(recipients []string) (*GPGEncryptor, error) {
+	binary, err := exec.LookPath("gpg")
+	if err != nil {
+		return nil, errors.New("gpg is not installed or not in your PATH")
+	}
+	for _, recipient := range recipients {
+		logging.Verbosef("Encrypting to GPG key %s", recipient)
+	}
+	return &GPGEncryptor{recipients: recipients, binary: binary}, nil
+}
+
+// IsGPGMessage reports whether encrypted data was written by GPGEncryptor
+func IsGPGMessage(encryptedData string) bool {
+	return strings.HasPrefix(encryptedData, gpgArmorHeader)
+}
+
+// Encrypt encrypts data to the configured recipients as an armored message
+func (e *GPGEncryptor) Encrypt(data []byte) (string, error) {
+	if len(e.recipients) == 0 {
+		return "", fmt.Errorf("%w: set gpg.id to your GPG key", ErrNoRecipients)
+	}
+
+	args := []string{"--batch", "--yes", "--quiet", "--armor", "--encrypt"}
+	for _, recipient := range e.recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	output, err := e.run(args, data)
+	if err != nil {
+		return "", fmt.Errorf("gpg encryption failed: %w", err)
+	}
+	return string(output), nil
+}
+
+// Decrypt decrypts an armored message
+func (e *GPGEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	if !IsGPGMessage(encryptedData) {
+		return nil, fmt.Errorf("%w: entry was not encrypted with gpg", ErrDecryptFailed)
+	}
+
+	output, err := e.run([]string{"--quiet", "--decrypt"}, []byte(encryptedData))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptFailed, err)
+	}
+	return output, nil
+}
+
+// EncryptStream encrypts r into w in constant memory, wrapping the content
+// key with gpg
+func (e *GPGEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return EncryptStreamWith(e.Encrypt, r, w)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream
+func (e *GPGEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return DecryptStreamWith(e.Decrypt, r, w)
+}
+
+// run runs gpg with input on stdin and returns its output
+func (e *GPGEncryptor) run(args []string, input []byte) ([]byte, error) {
+	return runTool(e.binary, args, input)
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+// newTestGPGEncryptor creates a throwaway GPG key in a temporary GNUPGHOME
+func newTestGPGEncryptor(t *testing.T) *GPGEncryptor {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	keygen := exec.Command("gpg", "--batch", "--quiet", "--passphrase", "", "--quick-gen-key", "test@example.com", "default", "default", "never")
+	if output, err := keygen.CombinedOutput(); err != nil {
+		t.Skipf("Failed to create GPG key: %v: %s", err, output)
+	}
+
+	encryptor, err := NewGPGEncryptor([]string{"test@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	return encryptor
+}
+
+func TestGPGEncryptionDecryption(t *testing.T) {
+	encryptor := newTestGPGEncryptor(t)
+
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if !IsGPGMessage(encrypted) {
+		t.Errorf("Expected an armored PGP message, got %q", encrypted)
+	}
+
+	decrypted, err := encryptor.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Errorf("Expected 'secret', got %q", decrypted)
+	}
+
+	// Entries from the ssh backend are rejected with a clear error
+	if _, err := encryptor.Decrypt("c2VjcmV0:a2V5"); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed for an ssh entry, got %v", err)
+	}
+}
+
+func TestGPGEncryptWithoutRecipients(t *testing.T) {
+	encryptor := &GPGEncryptor{binary: "gpg"}
+	if _, err := encryptor.Encrypt([]byte("secret")); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("Expected ErrNoRecipients, got %v", err)
+	}
+}
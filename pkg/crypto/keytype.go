@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// MinRSABits is the smallest RSA key entries are encrypted to
+const MinRSABits = 2048
+
+// ErrUnsupportedKey is returned for SSH keys entries can't be encrypted to
+// or decrypted with
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// CheckKeyType accepts Ed25519 keys, ECDSA keys on the P-256, P-384 and
+// P-521 curves, RSA keys of at least MinRSABits bits and the security key
+// variants of Ed25519 and ECDSA. Certificates are checked by the key they
+// certify.
+func CheckKeyType(key ssh.PublicKey) error {
+	key = CertifiedKey(key)
+	switch key.Type() {
+	case ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoSKED25519, ssh.KeyAlgoSKECDSA256:
+		return nil
+	case ssh.KeyAlgoRSA:
+		if cryptoKey, ok := key.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < MinRSABits {
+				return fmt.Errorf("%w: RSA keys must have at least %d bits, this one has %d",
+					ErrUnsupportedKey, MinRSABits, rsaKey.N.BitLen())
+			}
+		}
+		return nil
+	case ssh.KeyAlgoDSA:
+		return fmt.Errorf("%w: DSA keys are not supported; create an Ed25519 key with ssh-keygen -t ed25519", ErrUnsupportedKey)
+	}
+	return fmt.Errorf("%w: %s keys are not supported", ErrUnsupportedKey, key.Type())
+}
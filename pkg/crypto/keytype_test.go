@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// supportedTestKeys returns a new private key of every supported type
+func supportedTestKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	keys := make(map[string]crypto.Signer)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys["ed25519"] = ed25519Key
+	for name, curve := range map[string]elliptic.Curve{"ecdsa-p256": elliptic.P256(), "ecdsa-p384": elliptic.P384(), "ecdsa-p521": elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+	for name, bits := range map[string]int{"rsa-2048": 2048, "rsa-4096": 4096} {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+	return keys
+}
+
+// writeTestKey writes a private key and its public key to dir
+func writeTestKey(t *testing.T, dir, name string, key crypto.Signer) (privatePath, publicPath string) {
+	t.Helper()
+	block, err := ssh.MarshalPrivateKey(key, name)
+	if err != nil {
+		t.Fatalf("%s: failed to marshal private key: %v", name, err)
+	}
+	publicKey, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("%s: failed to convert public key: %v", name, err)
+	}
+	privatePath = filepath.Join(dir, name)
+	publicPath = privatePath + ".pub"
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, ssh.MarshalAuthorizedKey(publicKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestKeyTypeMatrix(t *testing.T) {
+	dir := t.TempDir()
+	keys := supportedTestKeys(t)
+
+	var all []ssh.PublicKey
+	fromFiles := make(map[string]*SSHEncryptor)
+	fromAgent := make(map[string]*SSHEncryptor)
+	for name, key := range keys {
+		privatePath, publicPath := writeTestKey(t, dir, name, key)
+		encryptor, err := NewSSHEncryptor(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := encryptor.AddPublicKeyFromFile(publicPath); err != nil {
+			t.Fatalf("%s: failed to add public key: %v", name, err)
+		}
+		if err := encryptor.AddPrivateKeyFromFile(privatePath, nil); err != nil {
+			t.Fatalf("%s: failed to add private key: %v", name, err)
+		}
+		fromFiles[name] = encryptor
+		all = append(all, encryptor.PublicKeys()...)
+
+		// The private key is only in the agent
+		keyring := agent.NewKeyring()
+		if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+			t.Fatalf("%s: failed to add key to agent: %v", name, err)
+		}
+		agentOnly := &SSHEncryptor{useAgent: true, agentClient: keyring}
+		agentOnly.AddPublicKey(encryptor.PublicKeys()[0])
+		if err := agentOnly.AddPrivateKeyFromFile(filepath.Join(dir, "missing"), nil); err != nil {
+			t.Fatalf("%s: failed to use agent key: %v", name, err)
+		}
+		fromAgent[name] = agentOnly
+	}
+
+	for name := range keys {
+		for source, encryptor := range map[string]*SSHEncryptor{"file": fromFiles[name], "agent": fromAgent[name]} {
+			encrypted, err := encryptor.Encrypt([]byte("hunter2"))
+			if err != nil {
+				t.Fatalf("%s from %s: encryption failed: %v", name, source, err)
+			}
+			if decrypted, err := encryptor.Decrypt(encrypted); err != nil || string(decrypted) != "hunter2" {
+				t.Errorf("%s from %s: expected 'hunter2', got %q (%v)", name, source, decrypted, err)
+			}
+		}
+	}
+
+	// A store shared by keys of every type is readable by each of them
+	encrypted, err := fromFiles["ed25519"].EncryptTo([]byte("shared"), all)
+	if err != nil {
+		t.Fatalf("Encryption to every key type failed: %v", err)
+	}
+	for name, encryptor := range fromAgent {
+		if decrypted, err := encryptor.Decrypt(encrypted); err != nil || string(decrypted) != "shared" {
+			t.Errorf("%s: expected 'shared', got %q (%v)", name, decrypted, err)
+		}
+	}
+}
+
+func TestUnsupportedKeyTypes(t *testing.T) {
+	dir := t.TempDir()
+
+	var params dsa.Parameters
+	if err := dsa.GenerateParameters(&params, rand.Reader, dsa.L1024N160); err != nil {
+		t.Fatal(err)
+	}
+	dsaKey := &dsa.PrivateKey{PublicKey: dsa.PublicKey{Parameters: params}}
+	if err := dsa.GenerateKey(dsaKey, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]any{"dsa": &dsaKey.PublicKey, "rsa-1024": &weakRSA.PublicKey} {
+		publicKey, err := ssh.NewPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckKeyType(publicKey); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("%s: expected ErrUnsupportedKey, got %v", name, err)
+		}
+
+		path := filepath.Join(dir, name+".pub")
+		if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(publicKey), 0644); err != nil {
+			t.Fatal(err)
+		}
+		encryptor := &SSHEncryptor{}
+		if err := encryptor.AddPublicKeyFromFile(path); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("%s: expected loading the public key to fail with ErrUnsupportedKey, got %v", name, err)
+		}
+		if _, err := encryptor.EncryptTo([]byte("secret"), []ssh.PublicKey{publicKey}); !errors.Is(err, ErrUnsupportedKey) {
+			t.Errorf("%s: expected encrypting to it to fail with ErrUnsupportedKey, got %v", name, err)
+		}
+	}
+
+	// DSA keys in the agent are skipped rather than used
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: dsaKey}); err != nil {
+		t.Fatal(err)
+	}
+	encryptor := &SSHEncryptor{useAgent: true, agentClient: keyring}
+	if err := encryptor.AddPrivateKeyFromFile(filepath.Join(dir, "missing"), nil); err == nil || encryptor.CanDecrypt() {
+		t.Errorf("Expected the DSA agent key to be skipped, got %v", err)
+	}
+}
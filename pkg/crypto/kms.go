@@ -0,0 +1,281 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cloud key management services are reached through their own command line
+// tools, so their usual credentials (instance roles, workload identity,
+// 'aws configure', 'gcloud auth login', 'az login') apply and no SDK is
+// needed. Data keys are always passed on stdin, never as arguments.
+
+// AWSKMS wraps data keys with AWS KMS using the aws CLI
+type AWSKMS struct{}
+
+// Name identifies the service
+func (AWSKMS) Name() string { return "awskms" }
+
+// Wrap encrypts a data key with a KMS key ID, ARN or alias
+func (AWSKMS) Wrap(keyID string, key []byte) ([]byte, error) {
+	output, err := runTool("aws", []string{"kms", "encrypt", "--key-id", keyID,
+		"--plaintext", "fileb:///dev/stdin", "--output", "text", "--query", "CiphertextBlob"}, key)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+}
+
+// Unwrap decrypts a data key wrapped by Wrap
+func (AWSKMS) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	output, err := runTool("aws", []string{"kms", "decrypt", "--key-id", keyID,
+		"--ciphertext-blob", "fileb:///dev/stdin", "--output", "text", "--query", "Plaintext"}, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+}
+
+// GCPKMS wraps data keys with Google Cloud KMS using the gcloud CLI. Key IDs
+// are resource names like
+// projects/P/locations/L/keyRings/R/cryptoKeys/K.
+type GCPKMS struct{}
+
+// Name identifies the service
+func (GCPKMS) Name() string { return "gcpkms" }
+
+// Wrap encrypts a data key with a Cloud KMS key
+func (GCPKMS) Wrap(keyID string, key []byte) ([]byte, error) {
+	return runTool("gcloud", []string{"kms", "encrypt", "--key", keyID,
+		"--plaintext-file", "-", "--ciphertext-file", "-"}, key)
+}
+
+// Unwrap decrypts a data key wrapped by Wrap
+func (GCPKMS) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	return runTool("gcloud", []string{"kms", "decrypt", "--key", keyID,
+		"--ciphertext-file", "-", "--plaintext-file", "-"}, wrapped)
+}
+
+// AzureKeyVault wraps data keys with an Azure Key Vault RSA key through the
+// Key Vault REST API, with an access token from the az CLI. Key IDs are key
+// URLs like https://VAULT.vault.azure.net/keys/NAME/VERSION; include the
+// version so entries stay readable after the key is rotated.
+type AzureKeyVault struct {
+	// Token returns an access token for Key Vault, from the az CLI unless
+	// overridden in tests
+	Token func() (string, error)
+	// Client sends the requests, with a 30 second timeout by default
+	Client *http.Client
+}
+
+// Name identifies the service
+func (AzureKeyVault) Name() string { return "azurekv" }
+
+// Wrap encrypts a data key with RSA-OAEP-256
+func (a AzureKeyVault) Wrap(keyID string, key []byte) ([]byte, error) {
+	return a.call(keyID, "wrapkey", key)
+}
+
+// Unwrap decrypts a data key wrapped by Wrap
+func (a AzureKeyVault) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	return a.call(keyID, "unwrapkey", wrapped)
+}
+
+// call runs a wrapkey or unwrapkey operation
+func (a AzureKeyVault) call(keyID, operation string, value []byte) ([]byte, error) {
+	if !strings.HasPrefix(keyID, "https://") {
+		return nil, fmt.Errorf("key ID must be a Key Vault key URL, not '%s'", keyID)
+	}
+
+	token := a.Token
+	if token == nil {
+		token = azureCLIToken
+	}
+	accessToken, err := token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a Key Vault access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"alg":   "RSA-OAEP-256",
+		"value": base64.RawURLEncoding.EncodeToString(value),
+	})
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(keyID, "/") + "/" + operation + "?api-version=7.4"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Value string `json:"value"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, result.Error.Message)
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+}
+
+// azureCLIToken gets a Key Vault access token from the az CLI
+func azureCLIToken() (string, error) {
+	output, err := runTool("az", []string{"account", "get-access-token",
+		"--resource", "https://vault.azure.net", "--query", "accessToken", "--output", "tsv"}, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// VaultTransit wraps data keys with a HashiCorp Vault transit engine key
+// through the Vault HTTP API. Key IDs are transit key names; the token
+// needs the encrypt and decrypt capabilities on the key.
+type VaultTransit struct {
+	// Address is the Vault server URL, such as https://vault.example:8200
+	Address string
+	// Mount is the path the transit engine is mounted at, transit if empty
+	Mount string
+	// Namespace is the Vault Enterprise namespace, if any
+	Namespace string
+	// Token returns the Vault token, from VAULT_TOKEN or ~/.vault-token
+	// unless overridden in tests
+	Token func() (string, error)
+	// Client sends the requests, with a 30 second timeout by default
+	Client *http.Client
+}
+
+// Name identifies the service
+func (VaultTransit) Name() string { return "vault" }
+
+// Wrap encrypts a data key with a transit key. The wrapped key is Vault's
+// vault:vN:... ciphertext, so it names the key version it needs.
+func (v VaultTransit) Wrap(keyID string, key []byte) ([]byte, error) {
+	data, err := v.call("encrypt", keyID, map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)})
+	if err != nil {
+		return nil, err
+	}
+	if data.Ciphertext == "" {
+		return nil, errors.New("vault returned no ciphertext")
+	}
+	return []byte(data.Ciphertext), nil
+}
+
+// Unwrap decrypts a data key wrapped by Wrap
+func (v VaultTransit) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	data, err := v.call("decrypt", keyID, map[string]string{"ciphertext": string(wrapped)})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(data.Plaintext)
+}
+
+// vaultTransitData is the data of a transit encrypt or decrypt response
+type vaultTransitData struct {
+	Ciphertext string `json:"ciphertext"`
+	Plaintext  string `json:"plaintext"`
+}
+
+// call runs a transit encrypt or decrypt operation
+func (v VaultTransit) call(operation, keyID string, request map[string]string) (*vaultTransitData, error) {
+	if v.Address == "" {
+		return nil, errors.New("no Vault address; set VAULT_ADDR or vault.address")
+	}
+	if keyID == "" || strings.Contains(keyID, "/") {
+		return nil, fmt.Errorf("invalid transit key name '%s'", keyID)
+	}
+
+	token := v.Token
+	if token == nil {
+		token = vaultToken
+	}
+	accessToken, err := token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a Vault token: %w", err)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	mount := strings.Trim(v.Mount, "/")
+	if mount == "" {
+		mount = "transit"
+	}
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + mount + "/" + operation + "/" + keyID
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   vaultTransitData `json:"data"`
+		Errors []string         `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.Join(result.Errors, "; "))
+	}
+	return &result.Data, nil
+}
+
+// vaultToken reads the Vault token from VAULT_TOKEN or the token helper
+// file written by 'vault login'
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", errors.New("set VAULT_TOKEN or run 'vault login'")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,166 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// kmsPrefix starts every entry encrypted by KMSEncryptor
+const kmsPrefix = "passh-kms-v1"
+
+// KeyWrapper wraps and unwraps data keys with a key that never leaves a key
+// management service
+type KeyWrapper interface {
+	// Name identifies the service, such as awskms
+	Name() string
+	// Wrap encrypts a data key with the given KMS key
+	Wrap(keyID string, key []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped with the given KMS key
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KMSEncryptor encrypts entries with envelope encryption: data is sealed
+// with XChaCha20-Poly1305 under a random data key, and the data key is
+// wrapped by a KMS, so decryption is controlled by the KMS's access
+// policies (for example IAM roles on CI runners) instead of key files. Each
+// entry is stored as
+//
+//	passh-kms-v1$<service>$<key ID>$<wrapped data key>$<nonce and ciphertext>
+type KMSEncryptor struct {
+	wrapper KeyWrapper
+	keyID   string
+
+	// dataKey and wrappedKey are reused for everything encrypted by this
+	// encryptor, so writing many entries costs a single KMS request
+	dataKey    *secure.Buffer
+	wrappedKey []byte
+	// unwrapped caches data keys by wrapped key
+	unwrapped map[string]*secure.Buffer
+	// mu guards the keys, as stores encrypt entries concurrently
+	mu sync.Mutex
+}
+
+// NewKMSEncryptor creates an encryptor wrapping data keys with keyID. The
+// key ID is stored with each entry, so entries stay readable after keyID
+// is changed.
+func NewKMSEncryptor(wrapper KeyWrapper, keyID string) *KMSEncryptor {
+	return &KMSEncryptor{wrapper: wrapper, keyID: keyID, unwrapped: make(map[string]*secure.Buffer)}
+}
+
+// Encrypt seals data under a data key wrapped by the KMS
+func (e *KMSEncryptor) Encrypt(data []byte) (string, error) {
+	if e.keyID == "" {
+		return "", fmt.Errorf("%w: specify the %s key with --key-id or kms.key_id", ErrNoRecipients, e.wrapper.Name())
+	}
+
+	e.mu.Lock()
+	if e.dataKey == nil {
+		key := secure.New(chacha20poly1305.KeySize)
+		if _, err := rand.Read(key.Bytes()); err != nil {
+			e.mu.Unlock()
+			key.Destroy()
+			return "", fmt.Errorf("failed to generate data key: %w", err)
+		}
+		wrapped, err := e.wrapper.Wrap(e.keyID, key.Bytes())
+		if err != nil {
+			e.mu.Unlock()
+			key.Destroy()
+			return "", fmt.Errorf("failed to wrap data key with %s: %w", e.wrapper.Name(), err)
+		}
+		e.dataKey, e.wrappedKey = key, wrapped
+	}
+	aead, err := chacha20poly1305.NewX(e.dataKey.Bytes())
+	wrappedKey := e.wrappedKey
+	e.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, data, nil)
+
+	return strings.Join([]string{
+		kmsPrefix,
+		e.wrapper.Name(),
+		base64.RawStdEncoding.EncodeToString([]byte(e.keyID)),
+		base64.RawStdEncoding.EncodeToString(wrappedKey),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, "$"), nil
+}
+
+// Decrypt has the KMS unwrap the data key of an entry and opens it
+func (e *KMSEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	parts := strings.Split(encryptedData, "$")
+	if len(parts) != 5 || parts[0] != kmsPrefix {
+		return nil, fmt.Errorf("%w: entry was not encrypted with a KMS", ErrDecryptFailed)
+	}
+	if parts[1] != e.wrapper.Name() {
+		return nil, fmt.Errorf("%w: entry was encrypted with %s; use --backend %s", ErrDecryptFailed, parts[1], parts[1])
+	}
+
+	var decoded [3][]byte
+	for i, part := range parts[2:] {
+		var err error
+		if decoded[i], err = base64.RawStdEncoding.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("failed to decode encrypted data: %w", err)
+		}
+	}
+	keyID, wrapped, sealed := string(decoded[0]), decoded[1], decoded[2]
+
+	e.mu.Lock()
+	key, ok := e.unwrapped[string(wrapped)]
+	if !ok {
+		unwrapped, err := e.wrapper.Unwrap(keyID, wrapped)
+		if err != nil {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s could not unwrap the data key: %v", ErrDecryptFailed, e.wrapper.Name(), err)
+		}
+		key = secure.Take(unwrapped)
+		e.unwrapped[string(wrapped)] = key
+	}
+	aead, err := chacha20poly1305.NewX(key.Bytes())
+	e.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid data key: %v", ErrDecryptFailed, err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted data format")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: entry has been modified", ErrDecryptFailed)
+	}
+	return plaintext, nil
+}
+
+// EncryptStream encrypts r into w in constant memory
+func (e *KMSEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return EncryptStreamWith(e.Encrypt, r, w)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream
+func (e *KMSEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return DecryptStreamWith(e.Decrypt, r, w)
+}
+
+// Wipe clears data keys from memory
+func (e *KMSEncryptor) Wipe() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dataKey.Destroy()
+	e.dataKey = nil
+	for wrapped, key := range e.unwrapped {
+		key.Destroy()
+		delete(e.unwrapped, wrapped)
+	}
+}
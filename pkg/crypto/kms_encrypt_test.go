@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeWrapper "wraps" keys by flipping bits and counts requests
+type fakeWrapper struct {
+	name           string
+	wraps, unwraps int
+}
+
+func (f *fakeWrapper) Name() string { return f.name }
+
+func (f *fakeWrapper) Wrap(keyID string, key []byte) ([]byte, error) {
+	f.wraps++
+	return flip(key), nil
+}
+
+func (f *fakeWrapper) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	f.unwraps++
+	if keyID != "key-1" {
+		return nil, errors.New("access denied")
+	}
+	return flip(wrapped), nil
+}
+
+func flip(data []byte) []byte {
+	flipped := make([]byte, len(data))
+	for i, b := range data {
+		flipped[i] = b ^ 0xff
+	}
+	return flipped
+}
+
+func TestKMSEncryptionDecryption(t *testing.T) {
+	wrapper := &fakeWrapper{name: "awskms"}
+	encryptor := NewKMSEncryptor(wrapper, "key-1")
+
+	first, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	second, err := encryptor.Encrypt([]byte("another secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if wrapper.wraps != 1 {
+		t.Errorf("Expected a single wrap request, got %d", wrapper.wraps)
+	}
+	if !strings.HasPrefix(first, kmsPrefix+"$awskms$") {
+		t.Errorf("Expected the service in the header, got %q", first)
+	}
+
+	// A new encryptor configured with another key still reads the entries,
+	// since the key ID is stored with them
+	reader := NewKMSEncryptor(wrapper, "key-2")
+	for encrypted, expected := range map[string]string{first: "secret", second: "another secret"} {
+		decrypted, err := reader.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decryption failed: %v", err)
+		}
+		if string(decrypted) != expected {
+			t.Errorf("Expected %q, got %q", expected, decrypted)
+		}
+	}
+	if wrapper.unwraps != 1 {
+		t.Errorf("Expected the unwrapped key to be cached, got %d unwrap requests", wrapper.unwraps)
+	}
+
+	other := NewKMSEncryptor(&fakeWrapper{name: "gcpkms"}, "key-1")
+	if _, err := other.Decrypt(first); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed for another service, got %v", err)
+	}
+}
+
+func TestKMSEncryptWithoutKey(t *testing.T) {
+	encryptor := NewKMSEncryptor(&fakeWrapper{name: "awskms"}, "")
+	if _, err := encryptor.Encrypt([]byte("secret")); !errors.Is(err, ErrNoRecipients) {
+		t.Errorf("Expected ErrNoRecipients, got %v", err)
+	}
+}
+
+func TestKMSUnwrapDenied(t *testing.T) {
+	wrapper := &fakeWrapper{name: "awskms"}
+	encrypted, err := NewKMSEncryptor(wrapper, "key-2").Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if _, err := NewKMSEncryptor(wrapper, "key-2").Decrypt(encrypted); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed when the KMS denies access, got %v", err)
+	}
+}
+
+func TestAWSKMSUsesStdin(t *testing.T) {
+	// The fake aws CLI returns its stdin as the base64 "ciphertext"
+	dir := t.TempDir()
+	script := "#!/bin/sh\nbase64\n"
+	if err := os.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake aws: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	wrapped, err := AWSKMS{}.Wrap("alias/passh", []byte("data key"))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if string(wrapped) != "data key" {
+		t.Errorf("Expected the data key on stdin, got %q", wrapped)
+	}
+}
+
+func TestAzureKeyVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "unauthorized"}}`))
+			return
+		}
+		var request struct{ Alg, Value string }
+		json.NewDecoder(r.Body).Decode(&request)
+		value, _ := base64.RawURLEncoding.DecodeString(request.Value)
+		if !strings.HasSuffix(r.URL.Path, "/keys/passh/v1/wrapkey") && !strings.HasSuffix(r.URL.Path, "/keys/passh/v1/unwrapkey") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"message": "not found"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"value": base64.RawURLEncoding.EncodeToString(flip(value))})
+	}))
+	defer server.Close()
+
+	// The test server isn't https, so call it through a key ID rewrite
+	keyID := "https://vault.example/keys/passh/v1"
+	vault := AzureKeyVault{
+		Token:  func() (string, error) { return "token", nil },
+		Client: &http.Client{Transport: rewriteTransport{server.URL}},
+	}
+
+	wrapped, err := vault.Wrap(keyID, []byte("data key"))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	key, err := vault.Unwrap(keyID, wrapped)
+	if err != nil {
+		t.Fatalf("Unwrap failed: %v", err)
+	}
+	if string(key) != "data key" {
+		t.Errorf("Expected the data key back, got %q", key)
+	}
+
+	vault.Token = func() (string, error) { return "expired", nil }
+	if _, err := vault.Wrap(keyID, []byte("data key")); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("Expected the Key Vault error, got %v", err)
+	}
+}
+
+// rewriteTransport sends every request to a test server
+type rewriteTransport struct{ target string }
+
+func (r rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	target, _ := http.NewRequest(req.Method, r.target+req.URL.Path+"?"+req.URL.RawQuery, nil)
+	clone.URL = target.URL
+	clone.Host = target.URL.Host
+	return http.DefaultTransport.RoundTrip(clone)
+}
+
+func TestVaultTransit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		var request struct{ Plaintext, Ciphertext string }
+		json.NewDecoder(r.Body).Decode(&request)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/passh":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + request.Plaintext}})
+		case "/v1/transit/decrypt/passh":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": strings.TrimPrefix(request.Ciphertext, "vault:v1:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+	defer server.Close()
+
+	vault := VaultTransit{
+		Address: server.URL,
+		Token:   func() (string, error) { return "token", nil },
+	}
+	encryptor := NewKMSEncryptor(vault, "passh")
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	decrypted, err := NewKMSEncryptor(vault, "").Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Errorf("Expected 'secret', got %q", decrypted)
+	}
+
+	vault.Token = func() (string, error) { return "revoked", nil }
+	if _, err := vault.Wrap("passh", []byte("data key")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected the Vault error, got %v", err)
+	}
+}
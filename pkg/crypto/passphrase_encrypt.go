@@ -0,0 +1,211 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// passphrasePrefix starts every entry encrypted by PassphraseEncryptor
+const passphrasePrefix = "passh-passphrase-v1"
+
+// kdfFormat records the KDFParams of an entry
+const kdfFormat = "t=%d,m=%d,p=%d"
+
+// KDFParams are the Argon2id parameters used to derive keys from the
+// passphrase. They are recorded with every entry, so changing them only
+// affects entries written afterwards.
+type KDFParams struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the memory used in KiB
+	Memory uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// DefaultKDFParams follow the second recommended option of RFC 9106 with a
+// few extra passes
+var DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Upper limits of KDFParams, so that an entry can't make reading it take
+// hours or all memory
+const (
+	maxKDFTime   = 100
+	maxKDFMemory = 1024 * 1024
+)
+
+// Validate rejects parameters that are unusable, too weak to be safe or too
+// costly to derive a key with
+func (p KDFParams) Validate() error {
+	switch {
+	case p.Time < 1:
+		return errors.New("argon2id time must be at least 1")
+	case p.Time > maxKDFTime:
+		return fmt.Errorf("argon2id time must be at most %d", maxKDFTime)
+	case p.Memory < 8*1024:
+		return errors.New("argon2id memory must be at least 8 MiB")
+	case p.Memory > maxKDFMemory:
+		return errors.New("argon2id memory must be at most 1 GiB")
+	case p.Threads < 1:
+		return errors.New("argon2id threads must be at least 1")
+	}
+	return nil
+}
+
+// PassphraseEncryptor encrypts entries with a key derived from a passphrase
+// with Argon2id, sealed with XChaCha20-Poly1305, for machines without SSH
+// keys. Each entry is stored as
+//
+//	passh-passphrase-v1$t=3,m=65536,p=4$<salt>$<nonce and ciphertext>
+type PassphraseEncryptor struct {
+	passphrase *secure.Buffer
+	params     KDFParams
+	// salt is used for everything encrypted by this encryptor, so writing
+	// many entries costs a single key derivation
+	salt []byte
+	// keys caches derived keys by salt and parameters
+	keys map[string]*secure.Buffer
+	// mu guards salt and keys, as stores encrypt entries concurrently
+	mu sync.Mutex
+}
+
+// NewPassphraseEncryptor creates an encryptor for a passphrase. The
+// passphrase is copied and should be wiped by the caller.
+func NewPassphraseEncryptor(passphrase []byte, params KDFParams) (*PassphraseEncryptor, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &PassphraseEncryptor{
+		passphrase: secure.Copy(passphrase),
+		params:     params,
+		keys:       make(map[string]*secure.Buffer),
+	}, nil
+}
+
+// Encrypt encrypts data with a key derived from the passphrase
+func (e *PassphraseEncryptor) Encrypt(data []byte) (string, error) {
+	e.mu.Lock()
+	if e.salt == nil {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			e.mu.Unlock()
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		e.salt = salt
+	}
+	salt := e.salt
+	e.mu.Unlock()
+
+	aead, err := chacha20poly1305.NewX(e.key(salt, e.params))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, data, nil)
+
+	return strings.Join([]string{
+		passphrasePrefix,
+		fmt.Sprintf(kdfFormat, e.params.Time, e.params.Memory, e.params.Threads),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(sealed),
+	}, "$"), nil
+}
+
+// Decrypt decrypts an entry written by Encrypt with the same passphrase
+func (e *PassphraseEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	params, salt, sealed, err := parsePassphraseEntry(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.NewX(e.key(salt, params))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted data format")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong passphrase or modified entry", ErrDecryptFailed)
+	}
+	return plaintext, nil
+}
+
+// parsePassphraseEntry splits an entry written by Encrypt into its key
+// derivation parameters, salt and sealed data
+func parsePassphraseEntry(encryptedData string) (KDFParams, []byte, []byte, error) {
+	var params KDFParams
+	parts := strings.Split(encryptedData, "$")
+	if len(parts) != 4 || parts[0] != passphrasePrefix {
+		return params, nil, nil, fmt.Errorf("%w: entry was not encrypted with a passphrase", ErrDecryptFailed)
+	}
+
+	// The parameters must be exactly as Encrypt writes them
+	if _, err := fmt.Sscanf(parts[1], kdfFormat, &params.Time, &params.Memory, &params.Threads); err != nil ||
+		parts[1] != fmt.Sprintf(kdfFormat, params.Time, params.Memory, params.Threads) {
+		return params, nil, nil, fmt.Errorf("invalid key derivation parameters '%s'", parts[1])
+	}
+	if err := params.Validate(); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid key derivation parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("failed to decode encrypted data: %w", err)
+	}
+	return params, salt, sealed, nil
+}
+
+// EncryptStream encrypts r into w in constant memory, wrapping the content
+// key with the passphrase
+func (e *PassphraseEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return EncryptStreamWith(e.Encrypt, r, w)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream
+func (e *PassphraseEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return DecryptStreamWith(e.Decrypt, r, w)
+}
+
+// Wipe clears the passphrase and derived keys from memory
+func (e *PassphraseEncryptor) Wipe() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.passphrase.Destroy()
+	for id, key := range e.keys {
+		key.Destroy()
+		delete(e.keys, id)
+	}
+}
+
+// key derives, or returns the cached, key for a salt and parameters
+func (e *PassphraseEncryptor) key(salt []byte, params KDFParams) []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := fmt.Sprintf("%x/%d/%d/%d", salt, params.Time, params.Memory, params.Threads)
+	if key, ok := e.keys[id]; ok {
+		return key.Bytes()
+	}
+	key := secure.Take(argon2.IDKey(e.passphrase.Bytes(), salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize))
+	e.keys[id] = key
+	return key.Bytes()
+}
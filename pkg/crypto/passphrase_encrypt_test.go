@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKDFParams are the cheapest valid parameters, to keep tests fast
+var testKDFParams = KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+
+func TestPassphraseEncryptionDecryption(t *testing.T) {
+	encryptor, err := NewPassphraseEncryptor([]byte("correct horse"), testKDFParams)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, passphrasePrefix+"$t=1,m=8192,p=1$") {
+		t.Errorf("Expected the KDF parameters in the header, got %q", encrypted)
+	}
+
+	// A new encryptor with other parameters still reads the entry, since
+	// the parameters are taken from its header
+	reader, err := NewPassphraseEncryptor([]byte("correct horse"), DefaultKDFParams)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	decrypted, err := reader.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Errorf("Expected 'secret', got %q", decrypted)
+	}
+
+	wrong, _ := NewPassphraseEncryptor([]byte("battery staple"), testKDFParams)
+	if _, err := wrong.Decrypt(encrypted); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed for a wrong passphrase, got %v", err)
+	}
+
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := encryptor.Decrypt(tampered); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed for a modified entry, got %v", err)
+	}
+}
+
+func TestPassphraseEncryptorRejectsWeakParams(t *testing.T) {
+	if _, err := NewPassphraseEncryptor([]byte("pass"), KDFParams{Time: 1, Memory: 1024, Threads: 1}); err == nil {
+		t.Error("Expected 1 MiB of memory to be rejected")
+	}
+	if _, err := NewPassphraseEncryptor(nil, testKDFParams); err == nil {
+		t.Error("Expected an empty passphrase to be rejected")
+	}
+
+	encryptor, _ := NewPassphraseEncryptor([]byte("pass"), testKDFParams)
+	if _, err := encryptor.Decrypt(passphrasePrefix + "$t=1,m=8,p=1$AAAA$AAAA"); err == nil {
+		t.Error("Expected an entry with weak parameters to be rejected")
+	}
+}
+
+func TestPassphraseEntryLimits(t *testing.T) {
+	for _, header := range []string{"t=1,m=4294967295,p=1", "t=1,m=1048577,p=1", "t=1,m=4194304,p=1", "t=4294967295,m=8192,p=1", "t=1,m=8192,p=300", "t=01,m=8192,p=1", "t=1,m=8192,p=1,x"} {
+		if _, _, _, err := parsePassphraseEntry(passphrasePrefix + "$" + header + "$AAAA$AAAA"); err == nil {
+			t.Errorf("Expected %q to be rejected", header)
+		}
+	}
+	if _, err := NewPassphraseEncryptor([]byte("pass"), KDFParams{Time: 1, Memory: maxKDFMemory + 1, Threads: 1}); err == nil {
+		t.Error("Expected more than 1 GiB of memory to be rejected")
+	}
+	if _, _, _, err := parsePassphraseEntry(passphrasePrefix + "$t=1,m=1048576,p=1$AAAA$AAAA"); err != nil {
+		t.Errorf("Expected 1 GiB of memory to be accepted: %v", err)
+	}
+}
+
+func FuzzPassphraseRoundTrip(f *testing.F) {
+	f.Add([]byte("hunter2"))
+	f.Add([]byte(""))
+	f.Add([]byte("with$dollars$and\nnewlines"))
+	encryptor, err := NewPassphraseEncryptor([]byte("correct horse"), testKDFParams)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		encrypted, err := encryptor.Encrypt(data)
+		if err != nil {
+			t.Fatalf("Encryption failed: %v", err)
+		}
+		decrypted, err := encryptor.Decrypt(encrypted)
+		if err != nil || !bytes.Equal(decrypted, data) {
+			t.Fatalf("Expected %q back, got %q (%v)", data, decrypted, err)
+		}
+	})
+}
+
+// FuzzParsePassphraseEntry checks that only entries with usable key
+// derivation parameters are parsed, so reading one can't exhaust memory
+func FuzzParsePassphraseEntry(f *testing.F) {
+	encryptor, err := NewPassphraseEncryptor([]byte("correct horse"), testKDFParams)
+	if err != nil {
+		f.Fatal(err)
+	}
+	valid, err := encryptor.Encrypt([]byte("hunter2"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{valid, "", passphrasePrefix, passphrasePrefix + "$$$", passphrasePrefix + "$t=1,m=8192,p=1$AAAA$AAAA"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, encrypted string) {
+		params, _, _, err := parsePassphraseEntry(encrypted)
+		if err != nil {
+			return
+		}
+		if err := params.Validate(); err != nil {
+			t.Fatalf("%q was parsed with invalid parameters: %v", encrypted, err)
+		}
+		if !strings.HasPrefix(encrypted, passphrasePrefix+"$") {
+			t.Fatalf("%q was parsed without the passphrase prefix", encrypted)
+		}
+	})
+}
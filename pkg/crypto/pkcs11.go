@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// PKCS#11 tokens such as a YubiKey (PIV) or Nitrokey are used through
+// OpenSSH: ssh-keygen lists the public keys on the token, and ssh-agent
+// loads the module with 'ssh-add -s' and performs every private key
+// operation on the token, so private keys never leave it.
+
+// ErrTokenNotInAgent is returned when a token's keys have not been added to
+// ssh-agent yet
+var ErrTokenNotInAgent = errors.New("token keys are not loaded in ssh-agent")
+
+// PKCS11PublicKeys lists the public keys on the tokens of a PKCS#11 module
+func PKCS11PublicKeys(module string) ([]ssh.PublicKey, error) {
+	output, err := exec.Command("ssh-keygen", "-D", module).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("failed to read keys from PKCS#11 module '%s': %s", module, bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("failed to read keys from PKCS#11 module '%s': %w", module, err)
+	}
+
+	var keys []ssh.PublicKey
+	for len(output) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(output)
+		if err != nil {
+			break
+		}
+		keys = append(keys, key)
+		output = rest
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found on the tokens of PKCS#11 module '%s'", module)
+	}
+	return keys, nil
+}
+
+// LoadPKCS11Module adds the keys of a PKCS#11 module to ssh-agent. ssh-add
+// asks for the token PIN on the terminal.
+func LoadPKCS11Module(module string) error {
+	cmd := exec.Command("ssh-add", "-s", module)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to add PKCS#11 module '%s' to ssh-agent: %w", module, err)
+	}
+	return nil
+}
+
+// AddPKCS11Keys encrypts to the keys on the tokens of a PKCS#11 module and
+// decrypts with them through ssh-agent. It returns ErrTokenNotInAgent,
+// without changing the encryptor, if the agent doesn't hold them yet.
+func (e *SSHEncryptor) AddPKCS11Keys(module string) error {
+	if e.agentClient == nil {
+		return errors.New("PKCS#11 tokens are used through ssh-agent, which is not running or disabled with --no-agent")
+	}
+
+	keys, err := PKCS11PublicKeys(module)
+	if err != nil {
+		return err
+	}
+	signers, err := e.agentClient.Signers()
+	if err != nil {
+		return fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	tokenSigners := signersFor(signers, keys)
+	if len(tokenSigners) == 0 {
+		return ErrTokenNotInAgent
+	}
+
+	e.publicKeys = append(e.publicKeys, keys...)
+	e.privateKeys = append(e.privateKeys, tokenSigners...)
+	for _, key := range keys {
+		logging.Verbosef("Using %s key %s on PKCS#11 token", key.Type(), ssh.FingerprintSHA256(key))
+	}
+	return nil
+}
+
+// signersFor returns the signers whose public key is one of keys
+func signersFor(signers []ssh.Signer, keys []ssh.PublicKey) []ssh.Signer {
+	var matching []ssh.Signer
+	for _, signer := range signers {
+		if containsKey(keys, signer.PublicKey()) {
+			matching = append(matching, signer)
+		}
+	}
+	return matching
+}
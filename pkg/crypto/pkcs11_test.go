@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// fakeTokenKeygen puts an ssh-keygen on PATH that lists publicKey as the
+// only key on any PKCS#11 module
+func fakeTokenKeygen(t *testing.T, publicKey ssh.PublicKey) {
+	dir := t.TempDir()
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+	script := "#!/bin/sh\necho '" + line + " pkcs11'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh-keygen"), []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write fake ssh-keygen: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestAddPKCS11Keys(t *testing.T) {
+	seed, tokenKey, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	fakeTokenKeygen(t, tokenKey.PublicKey())
+
+	keys, err := PKCS11PublicKeys("/usr/lib/opensc-pkcs11.so")
+	if err != nil {
+		t.Fatalf("PKCS11PublicKeys failed: %v", err)
+	}
+	if len(keys) != 1 || !containsKey(keys, tokenKey.PublicKey()) {
+		t.Fatalf("Expected the token key, got %d keys", len(keys))
+	}
+
+	encryptor := &SSHEncryptor{}
+	if err := encryptor.AddPKCS11Keys("/usr/lib/opensc-pkcs11.so"); err == nil {
+		t.Fatal("Expected an error without ssh-agent")
+	}
+
+	keyring := agent.NewKeyring()
+	encryptor.agentClient = keyring
+	if err := encryptor.AddPKCS11Keys("/usr/lib/opensc-pkcs11.so"); !errors.Is(err, ErrTokenNotInAgent) {
+		t.Fatalf("Expected ErrTokenNotInAgent, got %v", err)
+	}
+	if len(encryptor.publicKeys) != 0 {
+		t.Fatal("Expected the encryptor to be unchanged")
+	}
+
+	// Once the agent holds the token key, entries round-trip through it
+	if err := keyring.Add(agent.AddedKey{PrivateKey: ed25519.NewKeyFromSeed(seed)}); err != nil {
+		t.Fatalf("Failed to add key to agent: %v", err)
+	}
+	if err := encryptor.AddPKCS11Keys("/usr/lib/opensc-pkcs11.so"); err != nil {
+		t.Fatalf("AddPKCS11Keys failed: %v", err)
+	}
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if plaintext, err := encryptor.Decrypt(encrypted); err != nil || string(plaintext) != "secret" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+}
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+)
+
+// PluginProtocolVersion is the version of the plugin protocol passh speaks
+const PluginProtocolVersion = 1
+
+// Plugin operations
+const (
+	PluginEncrypt = "encrypt"
+	PluginDecrypt = "decrypt"
+)
+
+// Error codes a plugin can return, mapped to ErrNoRecipients and
+// ErrDecryptFailed so scripts see the same exit codes as with built-in
+// backends
+const (
+	PluginErrNoRecipients = "no-recipients"
+	PluginErrDecrypt      = "decrypt-failed"
+)
+
+// PluginRequest is written as JSON to a plugin's standard input. Data is
+// base64 encoded, as encoding/json does for byte slices.
+type PluginRequest struct {
+	Version   int    `json:"version"`
+	Operation string `json:"operation"`
+	Data      []byte `json:"data"`
+	// Options are the plugin.NAME.* settings, without the prefix
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// PluginResponse is read as JSON from a plugin's standard output
+type PluginResponse struct {
+	Data  []byte `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// PluginEncryptor delegates encryption to an external program, so HSMs,
+// cloud KMS and other key stores can be supported without changing passh.
+// The plugin is run once per operation with a PluginRequest on stdin and
+// must answer with a PluginResponse on stdout; its stderr is passed through
+// for prompts and diagnostics.
+type PluginEncryptor struct {
+	name    string
+	path    string
+	options map[string]string
+}
+
+// NewPluginEncryptor creates an encryptor for the plugin executable at path
+func NewPluginEncryptor(name, path string, options map[string]string) *PluginEncryptor {
+	return &PluginEncryptor{name: name, path: path, options: options}
+}
+
+// prefix marks entries written by this plugin, so entries of other backends
+// are recognized before the plugin is run
+func (e *PluginEncryptor) prefix() string {
+	return "passh-plugin:" + e.name + ":"
+}
+
+// Encrypt has the plugin encrypt data
+func (e *PluginEncryptor) Encrypt(data []byte) (string, error) {
+	ciphertext, err := e.call(PluginEncrypt, data)
+	if err != nil {
+		return "", err
+	}
+	return e.prefix() + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt has the plugin decrypt an entry written by Encrypt
+func (e *PluginEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(encryptedData, e.prefix())
+	if !ok {
+		return nil, fmt.Errorf("%w: entry was not encrypted with plugin '%s'", ErrDecryptFailed, e.name)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted data: %w", err)
+	}
+	return e.call(PluginDecrypt, ciphertext)
+}
+
+// EncryptStream encrypts r into w in constant memory, having the plugin
+// wrap the content key
+func (e *PluginEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return EncryptStreamWith(e.Encrypt, r, w)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream
+func (e *PluginEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return DecryptStreamWith(e.Decrypt, r, w)
+}
+
+// call runs the plugin for one operation
+func (e *PluginEncryptor) call(operation string, data []byte) ([]byte, error) {
+	request, err := json.Marshal(PluginRequest{
+		Version:   PluginProtocolVersion,
+		Operation: operation,
+		Data:      data,
+		Options:   e.options,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(e.path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	logging.Debugf("running plugin %s to %s %d bytes", e.path, operation, len(data))
+	runErr := cmd.Run()
+
+	var response PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("plugin '%s' failed: %w", e.name, runErr)
+		}
+		return nil, fmt.Errorf("plugin '%s' returned an invalid response: %w", e.name, err)
+	}
+
+	if response.Error != "" || runErr != nil {
+		message := response.Error
+		if message == "" {
+			message = runErr.Error()
+		}
+		switch response.Code {
+		case PluginErrNoRecipients:
+			return nil, fmt.Errorf("%w: plugin '%s': %s", ErrNoRecipients, e.name, message)
+		case PluginErrDecrypt:
+			return nil, fmt.Errorf("%w: plugin '%s': %s", ErrDecryptFailed, e.name, message)
+		}
+		return nil, fmt.Errorf("plugin '%s' failed: %s", e.name, message)
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("plugin '%s' returned no data", e.name)
+	}
+	return response.Data, nil
+}
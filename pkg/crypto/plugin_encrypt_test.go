@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestMain lets the test binary act as an encryptor plugin, so plugins can
+// be tested without building a separate program
+func TestMain(m *testing.M) {
+	if os.Getenv("PASSH_TEST_PLUGIN") != "" {
+		runTestPlugin()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestPlugin "encrypts" by flipping bits, and fails as asked to by its
+// options
+func runTestPlugin() {
+	var request PluginRequest
+	var response PluginResponse
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		response.Error = err.Error()
+	} else if request.Options["fail"] == request.Operation {
+		response.Error = "key not available"
+		if request.Operation == PluginDecrypt {
+			response.Code = PluginErrDecrypt
+		}
+	} else {
+		for _, b := range request.Data {
+			response.Data = append(response.Data, b^0xff)
+		}
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+}
+
+func TestPluginEncryptor(t *testing.T) {
+	t.Setenv("PASSH_TEST_PLUGIN", "1")
+	executable, err := os.Executable()
+	if err != nil {
+		t.Skipf("Test binary unavailable: %v", err)
+	}
+
+	encryptor := NewPluginEncryptor("test", executable, nil)
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	decrypted, err := encryptor.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if string(decrypted) != "secret" {
+		t.Errorf("Expected 'secret', got %q", decrypted)
+	}
+
+	// Entries of another plugin are rejected without running this one
+	other := NewPluginEncryptor("other", executable, nil)
+	if _, err := other.Decrypt(encrypted); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected ErrDecryptFailed for another plugin's entry, got %v", err)
+	}
+
+	failing := NewPluginEncryptor("test", executable, map[string]string{"fail": PluginDecrypt})
+	if _, err := failing.Decrypt(encrypted); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Expected the decrypt-failed code to map to ErrDecryptFailed, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sharePrefix starts every encoded recovery share
+const sharePrefix = "passh-shard"
+
+// RecoveryShare is one Shamir share of a store's recovery key
+type RecoveryShare struct {
+	// KeyID identifies the recovery key the share belongs to
+	KeyID     string
+	Threshold int
+	Data      []byte
+}
+
+// GenerateRecoveryKey creates a new ed25519 recovery key. The returned seed
+// is the only secret needed to recreate it with RecoveryKeyFromSeed.
+func GenerateRecoveryKey() ([]byte, ssh.Signer, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate recovery key: %w", err)
+	}
+
+	signer, err := RecoveryKeyFromSeed(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return seed, signer, nil
+}
+
+// RecoveryKeyFromSeed recreates a recovery key from its seed
+func RecoveryKeyFromSeed(seed []byte) (ssh.Signer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid recovery key seed length %d", len(seed))
+	}
+	return ssh.NewSignerFromKey(ed25519.NewKeyFromSeed(seed))
+}
+
+// RecoveryKeyID returns a short identifier for a recovery public key
+func RecoveryKeyID(publicKey ssh.PublicKey) string {
+	sum := sha256.Sum256(publicKey.Marshal())
+	return hex.EncodeToString(sum[:4])
+}
+
+// String encodes the share as a single printable line with a checksum
+func (s RecoveryShare) String() string {
+	body := fmt.Sprintf("%s-%s-%d-%s", sharePrefix, s.KeyID, s.Threshold, hex.EncodeToString(s.Data))
+	sum := sha256.Sum256([]byte(body))
+	return body + "-" + hex.EncodeToString(sum[:2])
+}
+
+// ParseShare decodes a share encoded by RecoveryShare.String. Whitespace
+// inside the line is ignored so shares can be typed in groups.
+func ParseShare(encoded string) (RecoveryShare, error) {
+	encoded = strings.Join(strings.Fields(encoded), "")
+
+	parts := strings.Split(encoded, "-")
+	if len(parts) != 6 || parts[0]+"-"+parts[1] != sharePrefix {
+		return RecoveryShare{}, errors.New("not a passh recovery share")
+	}
+
+	body := strings.Join(parts[:5], "-")
+	sum := sha256.Sum256([]byte(body))
+	if parts[5] != hex.EncodeToString(sum[:2]) {
+		return RecoveryShare{}, errors.New("recovery share checksum mismatch, check for typos")
+	}
+
+	threshold, err := strconv.Atoi(parts[3])
+	if err != nil || threshold < 2 {
+		return RecoveryShare{}, errors.New("invalid recovery share threshold")
+	}
+	data, err := hex.DecodeString(parts[4])
+	if err != nil || len(data) < 2 {
+		return RecoveryShare{}, errors.New("invalid recovery share data")
+	}
+
+	return RecoveryShare{KeyID: parts[2], Threshold: threshold, Data: data}, nil
+}
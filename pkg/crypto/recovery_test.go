@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecoveryShareEncoding(t *testing.T) {
+	seed, signer, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery key: %v", err)
+	}
+
+	parts, err := SplitSecret(seed, 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to split seed: %v", err)
+	}
+
+	keyID := RecoveryKeyID(signer.PublicKey())
+	var decoded [][]byte
+	for _, part := range parts[1:] {
+		share, err := ParseShare(RecoveryShare{KeyID: keyID, Threshold: 2, Data: part}.String())
+		if err != nil {
+			t.Fatalf("Failed to parse share: %v", err)
+		}
+		if share.KeyID != keyID || share.Threshold != 2 {
+			t.Fatalf("Unexpected share metadata: %+v", share)
+		}
+		decoded = append(decoded, share.Data)
+	}
+
+	recovered, err := CombineShares(decoded)
+	if err != nil {
+		t.Fatalf("Failed to combine shares: %v", err)
+	}
+	restored, err := RecoveryKeyFromSeed(recovered)
+	if err != nil {
+		t.Fatalf("Failed to restore recovery key: %v", err)
+	}
+	if !bytes.Equal(restored.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+		t.Fatal("Restored recovery key does not match")
+	}
+
+	encoded := RecoveryShare{KeyID: keyID, Threshold: 2, Data: parts[0]}.String()
+	typo := []byte(encoded)
+	typo[len(sharePrefix)+12] ^= 1
+	if _, err := ParseShare(string(typo)); err == nil {
+		t.Error("Expected a checksum error for a mistyped share")
+	}
+}
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// GF(256) arithmetic using the AES polynomial x^8 + x^4 + x^3 + x + 1
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// Multiply by the generator 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// SplitSecret splits a secret into n shares, any threshold of which can
+// reconstruct it with CombineShares. Each share is the x coordinate followed
+// by one polynomial value per secret byte.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+	if n < threshold {
+		return nil, errors.New("number of shares must not be less than the threshold")
+	}
+	if n > 255 {
+		return nil, errors.New("at most 255 shares are supported")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	defer secure.Wipe(coefficients)
+	for b, value := range secret {
+		coefficients[0] = value
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate coefficients: %w", err)
+		}
+
+		for _, share := range shares {
+			// Horner's method
+			x := share[0]
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			share[b+1] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from at least threshold shares created
+// by SplitSecret. Fewer shares yield a wrong result rather than an error.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+
+	length := len(shares[0])
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length || length < 2 {
+			return nil, errors.New("shares have inconsistent lengths")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("shares have duplicate or invalid indexes")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for b := range secret {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for i, si := range shares {
+			basis := byte(1)
+			for j, sj := range shares {
+				if i == j {
+					continue
+				}
+				basis = gfMul(basis, gfDiv(sj[0], sj[0]^si[0]))
+			}
+			value ^= gfMul(si[b+1], basis)
+		}
+		secret[b] = value
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShamirRoundTrip(t *testing.T) {
+	secret := []byte("correct horse battery staple 123")
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var selected [][]byte
+		for _, i := range subset {
+			selected = append(selected, shares[i])
+		}
+		recovered, err := CombineShares(selected)
+		if err != nil {
+			t.Fatalf("Failed to combine shares %v: %v", subset, err)
+		}
+		if !bytes.Equal(recovered, secret) {
+			t.Errorf("Shares %v recovered %q", subset, recovered)
+		}
+	}
+
+	recovered, err := CombineShares(shares[:2])
+	if err != nil {
+		t.Fatalf("Failed to combine shares: %v", err)
+	}
+	if bytes.Equal(recovered, secret) {
+		t.Error("Two shares should not be enough to recover the secret")
+	}
+}
+
+func TestShamirInvalidInput(t *testing.T) {
+	if _, err := SplitSecret([]byte("x"), 2, 3); err == nil {
+		t.Error("Expected an error when n < threshold")
+	}
+	if _, err := SplitSecret([]byte("x"), 3, 1); err == nil {
+		t.Error("Expected an error for threshold 1")
+	}
+
+	shares, err := SplitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Expected an error for duplicate shares")
+	}
+}
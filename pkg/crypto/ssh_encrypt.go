@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/rejoice4156/passh/pkg/logging"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -34,12 +36,8 @@ func NewSSHEncryptor(useAgent bool) (*SSHEncryptor, error) {
 	// Try to connect to the SSH agent if allowed
 	if useAgent {
 		if err := encryptor.connectToAgent(); err != nil {
-			// Just log this error, don't fail as we'll fall back to key files
-			_, printErr := fmt.Fprintf(os.Stderr, "Note: SSH agent not available: %v\n", err)
-			if printErr != nil {
-				// If we can't even write to stderr, just continue silently
-				// This is an edge case that shouldn't happen in normal operation
-			}
+			// Don't fail as we'll fall back to key files
+			logging.Verbosef("SSH agent not available: %v", err)
 		}
 	}
 
@@ -59,6 +57,7 @@ func (e *SSHEncryptor) connectToAgent() error {
 	}
 
 	e.agentClient = agent.NewClient(conn)
+	logging.Debugf("connected to SSH agent at %s", socket)
 	return nil
 }
 
@@ -73,22 +72,41 @@ func (e *SSHEncryptor) AddPublicKeyFromFile(path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse public key: %w", err)
 	}
+	if err := CheckKeyType(publicKey); err != nil {
+		return err
+	}
 
-	e.publicKeys = append(e.publicKeys, publicKey)
+	e.AddPublicKey(publicKey)
+	logging.Verbosef("Encrypting to %s key %s from %s", publicKey.Type(), ssh.FingerprintSHA256(publicKey), path)
 	return nil
 }
 
+// AddPublicKey adds a public key for encryption
+func (e *SSHEncryptor) AddPublicKey(publicKey ssh.PublicKey) {
+	e.publicKeys = append(e.publicKeys, publicKey)
+}
+
+// AddSigner adds a private key for decryption
+func (e *SSHEncryptor) AddSigner(signer ssh.Signer) {
+	e.privateKeys = append(e.privateKeys, signer)
+}
+
 // AddPrivateKeyFromFile adds a private key from a file for decryption
 func (e *SSHEncryptor) AddPrivateKeyFromFile(path string, passphrase []byte) error {
 	// If we're using the SSH agent, and we've connected to it, try to use it
 	if e.useAgent && e.agentClient != nil {
 		signers, err := e.agentClient.Signers()
+		signers = supportedSigners(signers)
 		if err == nil && len(signers) > 0 {
 			// Add all signers from the agent
 			e.privateKeys = append(e.privateKeys, signers...)
-			fmt.Println("Successfully loaded keys from SSH agent")
+			logging.Verbosef("Loaded %d keys from SSH agent", len(signers))
+			for _, signer := range signers {
+				logging.Debugf("agent key %s %s", signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
+			}
 			return nil
 		}
+		logging.Debugf("SSH agent has no usable keys: %v", err)
 	}
 
 	// Fall back to loading from file
@@ -107,15 +125,55 @@ func (e *SSHEncryptor) AddPrivateKeyFromFile(path string, passphrase []byte) err
 	if err != nil {
 		return fmt.Errorf("failed to parse private key: %w", err)
 	}
+	if err := CheckKeyType(signer.PublicKey()); err != nil {
+		return err
+	}
 
 	e.privateKeys = append(e.privateKeys, signer)
+	logging.Verbosef("Loaded private key %s", path)
+	return nil
+}
+
+// Signer returns the private key matching the user's own public key, for
+// signing, or nil if none is loaded
+func (e *SSHEncryptor) Signer() ssh.Signer {
+	for _, signer := range e.privateKeys {
+		if containsKey(e.publicKeys, signer.PublicKey()) {
+			return signer
+		}
+	}
 	return nil
 }
 
+// CanDecrypt reports whether any private key is loaded
+func (e *SSHEncryptor) CanDecrypt() bool {
+	return len(e.privateKeys) > 0
+}
+
+// DecryptionKeys returns the public keys of the loaded private keys, from key
+// files and the SSH agent, in the order they are tried
+func (e *SSHEncryptor) DecryptionKeys() []ssh.PublicKey {
+	keys := make([]ssh.PublicKey, len(e.privateKeys))
+	for i, signer := range e.privateKeys {
+		keys[i] = signer.PublicKey()
+	}
+	return keys
+}
+
+// PublicKeys returns the public keys data is encrypted to by default
+func (e *SSHEncryptor) PublicKeys() []ssh.PublicKey {
+	return append([]ssh.PublicKey(nil), e.publicKeys...)
+}
+
 // Encrypt encrypts the given data using the registered public keys
 func (e *SSHEncryptor) Encrypt(data []byte) (string, error) {
-	if len(e.publicKeys) == 0 {
-		return "", errors.New("no public keys available for encryption")
+	return e.EncryptTo(data, e.publicKeys)
+}
+
+// EncryptTo encrypts the given data to an explicit set of public keys
+func (e *SSHEncryptor) EncryptTo(data []byte, recipients []ssh.PublicKey) (string, error) {
+	if len(recipients) == 0 {
+		return "", ErrNoRecipients
 	}
 
 	// Generate a random AES key
@@ -129,7 +187,10 @@ func (e *SSHEncryptor) Encrypt(data []byte) (string, error) {
 	// This is a simple implementation - a production version would use proper hybrid encryption
 
 	var encryptedBlocks []string
-	for _, pubKey := range e.publicKeys {
+	for _, pubKey := range uniqueKeys(recipients) {
+		if err := CheckKeyType(pubKey); err != nil {
+			return "", fmt.Errorf("recipient %s: %w", ssh.FingerprintSHA256(pubKey), err)
+		}
 		// In a real implementation, we would properly implement hybrid encryption
 		// For now, we'll simulate it using SSH format
 		encryptedKey := pubKey.Marshal()
@@ -152,7 +213,14 @@ func (e *SSHEncryptor) Encrypt(data []byte) (string, error) {
 // Decrypt tries to decrypt the data using the available private keys
 func (e *SSHEncryptor) Decrypt(encryptedData string) ([]byte, error) {
 	if len(e.privateKeys) == 0 {
-		return nil, errors.New("no private keys available for decryption")
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, ErrNoPrivateKey)
+	}
+
+	if IsGPGMessage(encryptedData) {
+		return nil, fmt.Errorf("%w: entry was encrypted with gpg; use --backend gpg", ErrDecryptFailed)
+	}
+	if strings.HasPrefix(encryptedData, passphrasePrefix) {
+		return nil, fmt.Errorf("%w: entry was encrypted with a passphrase; use --backend passphrase", ErrDecryptFailed)
 	}
 
 	// In a real implementation, you would properly implement hybrid decryption
@@ -162,6 +230,15 @@ func (e *SSHEncryptor) Decrypt(encryptedData string) ([]byte, error) {
 		return nil, errors.New("invalid encrypted data format")
 	}
 
+	// The remaining parts identify the recipients; one of them must be ours
+	signer := e.recipientSigner(parts[1:])
+	if signer == nil {
+		logging.Debugf("entry is encrypted to %d keys, none of the %d loaded private keys match", len(parts)-1, len(e.privateKeys))
+		recipients, _ := e.Recipients(encryptedData)
+		return nil, &DecryptError{Recipients: recipients, Available: e.DecryptionKeys()}
+	}
+	logging.Debugf("decrypting with %s key %s", signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey()))
+
 	// The first part is the base64-encoded data
 	decodedData, err := base64.StdEncoding.DecodeString(parts[0])
 	if err != nil {
@@ -170,3 +247,83 @@ func (e *SSHEncryptor) Decrypt(encryptedData string) ([]byte, error) {
 
 	return decodedData, nil
 }
+
+// EncryptStream encrypts r into w in constant memory, wrapping the content
+// key to the registered public keys. The key is wrapped with Encrypt, which
+// only encodes it so far, so the stream is no better protected than an entry
+func (e *SSHEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return EncryptStreamWith(e.Encrypt, r, w)
+}
+
+// DecryptStream decrypts a stream written by EncryptStream
+func (e *SSHEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return DecryptStreamWith(e.Decrypt, r, w)
+}
+
+// Recipients returns the public keys an encrypted entry is encrypted to
+func (e *SSHEncryptor) Recipients(encryptedData string) ([]ssh.PublicKey, error) {
+	parts := strings.Split(encryptedData, ":")
+	if len(parts) < 2 {
+		return nil, errors.New("invalid encrypted data format")
+	}
+
+	var recipients []ssh.PublicKey
+	for _, block := range parts[1:] {
+		encoded, err := base64.StdEncoding.DecodeString(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode recipient: %w", err)
+		}
+		publicKey, err := ssh.ParsePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recipient: %w", err)
+		}
+		recipients = append(recipients, publicKey)
+	}
+	return recipients, nil
+}
+
+// uniqueKeys removes duplicate public keys, keeping the first occurrence.
+// Certificates are replaced by the keys they certify.
+func uniqueKeys(keys []ssh.PublicKey) []ssh.PublicKey {
+	var unique []ssh.PublicKey
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = CertifiedKey(key)
+		if marshaled := string(key.Marshal()); !seen[marshaled] {
+			seen[marshaled] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// supportedSigners drops agent keys of types entries can't be decrypted
+// with, such as DSA keys still loaded into an old agent
+func supportedSigners(signers []ssh.Signer) []ssh.Signer {
+	var supported []ssh.Signer
+	for _, signer := range signers {
+		if err := CheckKeyType(signer.PublicKey()); err != nil {
+			logging.Debugf("ignoring agent key %s: %v", ssh.FingerprintSHA256(signer.PublicKey()), err)
+			continue
+		}
+		supported = append(supported, signer)
+	}
+	return supported
+}
+
+// recipientSigner returns the first loaded private key that matches one of
+// the encoded recipient blocks, or nil if none does
+func (e *SSHEncryptor) recipientSigner(blocks []string) ssh.Signer {
+	for _, signer := range e.privateKeys {
+		for _, block := range blocks {
+			recipient, err := base64.StdEncoding.DecodeString(block)
+			if err != nil {
+				continue
+			}
+			if bytes.Equal(signer.PublicKey().Marshal(), recipient) {
+				return signer
+			}
+		}
+	}
+	return nil
+}
@@ -1,12 +1,21 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/quick"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -113,6 +122,105 @@ func TestEncryptionDecryption(t *testing.T) {
 	}
 }
 
+func TestDecryptionWithWrongKey(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ssh-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			t.Errorf("Failed to clean up temp directory: %v", err)
+		}
+	}()
+
+	// Generate two unrelated key pairs
+	_, publicKeyPath, err := generateTestKeys(t, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to generate test keys: %v", err)
+	}
+	otherDir := filepath.Join(tempDir, "other")
+	if err := os.MkdirAll(otherDir, 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	otherPrivateKeyPath, _, err := generateTestKeys(t, otherDir)
+	if err != nil {
+		t.Fatalf("Failed to generate test keys: %v", err)
+	}
+
+	encryptor, err := NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Skipf("Real SSH keys unavailable: %v", err)
+	}
+	if err := encryptor.AddPrivateKeyFromFile(otherPrivateKeyPath, nil); err != nil {
+		t.Skipf("Real SSH keys unavailable: %v", err)
+	}
+
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	// The private key is not a recipient, so decryption must fail
+	_, err = encryptor.Decrypt(encrypted)
+	if !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("Expected ErrDecryptFailed, got %v", err)
+	}
+
+	// The error names the keys on both sides
+	var decryptErr *DecryptError
+	if !errors.As(err, &decryptErr) {
+		t.Fatalf("Expected a DecryptError, got %T", err)
+	}
+	recipient := ssh.FingerprintSHA256(encryptor.PublicKeys()[0])
+	available := ssh.FingerprintSHA256(encryptor.DecryptionKeys()[0])
+	if len(decryptErr.Recipients) != 1 || ssh.FingerprintSHA256(decryptErr.Recipients[0]) != recipient {
+		t.Errorf("Expected the recipient %s, got %v", recipient, decryptErr.Recipients)
+	}
+	if !strings.Contains(err.Error(), recipient) || !strings.Contains(err.Error(), available) {
+		t.Errorf("Expected the error to list %s and %s, got %v", recipient, available, err)
+	}
+}
+
+func TestEncryptWithoutRecipients(t *testing.T) {
+	encryptor, err := NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if _, err := encryptor.Encrypt([]byte("secret")); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("Expected ErrNoRecipients, got %v", err)
+	}
+}
+
+func TestEncryptWithPublicKeyOnly(t *testing.T) {
+	_, publicKeyPath, err := generateTestKeys(t, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to generate test keys: %v", err)
+	}
+
+	encryptor, err := NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Skipf("Real SSH keys unavailable: %v", err)
+	}
+	if encryptor.CanDecrypt() {
+		t.Error("Expected no private key to be loaded")
+	}
+
+	encrypted, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Expected encryption to the public key to work, got %v", err)
+	}
+	_, err = encryptor.Decrypt(encrypted)
+	if !errors.Is(err, ErrDecryptFailed) || !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("Expected ErrDecryptFailed and ErrNoPrivateKey, got %v", err)
+	}
+}
+
 // Helper function to generate test SSH keys - using Ed25519
 func generateTestKeys(t *testing.T, dir string) (privateKeyPath, publicKeyPath string, err error) {
 	privateKeyPath = filepath.Join(dir, "id_test")
@@ -177,3 +285,104 @@ func (p *mockPublicKey) Verify(_ []byte, sig *ssh.Signature) error {
 	}
 	return nil
 }
+
+// testKeyEncryptors returns an encryptor for a new key of each type
+func testKeyEncryptors(t testing.TB) map[string]*SSHEncryptor {
+	t.Helper()
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptors := make(map[string]*SSHEncryptor)
+	for name, key := range map[string]any{"ed25519": ed25519Key, "ecdsa": ecdsaKey, "rsa": rsaKey} {
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encryptor := &SSHEncryptor{}
+		encryptor.AddPublicKey(signer.PublicKey())
+		encryptor.AddSigner(signer)
+		encryptors[name] = encryptor
+	}
+	return encryptors
+}
+
+func TestSSHRoundTripKeyTypes(t *testing.T) {
+	encryptors := testKeyEncryptors(t)
+	var all []ssh.PublicKey
+	for name, encryptor := range encryptors {
+		roundTrip := func(data []byte) bool {
+			encrypted, err := encryptor.Encrypt(data)
+			if err != nil {
+				return false
+			}
+			decrypted, err := encryptor.Decrypt(encrypted)
+			return err == nil && bytes.Equal(decrypted, data)
+		}
+		if err := quick.Check(roundTrip, nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		all = append(all, encryptor.PublicKeys()...)
+	}
+
+	// Data encrypted to every key can be read with any of them
+	encrypted, err := encryptors["ed25519"].EncryptTo([]byte("shared"), all)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	for name, encryptor := range encryptors {
+		if decrypted, err := encryptor.Decrypt(encrypted); err != nil || string(decrypted) != "shared" {
+			t.Errorf("%s: expected 'shared', got %q (%v)", name, decrypted, err)
+		}
+	}
+}
+
+func FuzzSSHRoundTrip(f *testing.F) {
+	f.Add([]byte("hunter2"))
+	f.Add([]byte(""))
+	f.Add([]byte("with:colons:and\nnewlines"))
+	encryptor := testKeyEncryptors(f)["ed25519"]
+	f.Fuzz(func(t *testing.T, data []byte) {
+		encrypted, err := encryptor.Encrypt(data)
+		if err != nil {
+			t.Fatalf("Encryption failed: %v", err)
+		}
+		decrypted, err := encryptor.Decrypt(encrypted)
+		if err != nil || !bytes.Equal(decrypted, data) {
+			t.Fatalf("Expected %q back, got %q (%v)", data, decrypted, err)
+		}
+	})
+}
+
+// FuzzSSHDecrypt checks that malformed entries are rejected without
+// panicking, and that entries that decrypt name one of the loaded keys
+func FuzzSSHDecrypt(f *testing.F) {
+	encryptor := testKeyEncryptors(f)["ed25519"]
+	valid, err := encryptor.Encrypt([]byte("hunter2"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range []string{valid, "", ":", "::", "aGk=", "aGk=:", ":" + valid, valid + ":", valid + ":!!", passphrasePrefix + "$x"} {
+		f.Add(seed)
+	}
+	own := encryptor.PublicKeys()[0]
+	f.Fuzz(func(t *testing.T, encrypted string) {
+		decrypted, err := encryptor.Decrypt(encrypted)
+		recipients, rerr := encryptor.Recipients(encrypted)
+		if err != nil {
+			return
+		}
+		if rerr == nil && !containsKey(recipients, own) {
+			t.Fatalf("%q decrypted to %q but is not encrypted to the loaded key", encrypted, decrypted)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshsigMagic starts signatures made with 'ssh-keygen -Y sign'
+const sshsigMagic = "SSHSIG"
+
+// ErrBadSignature is returned when a signature does not match the signed file
+var ErrBadSignature = errors.New("signature does not match")
+
+// sshsigBlob is the binary form of an armored SSH signature
+type sshsigBlob struct {
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is what the key actually signs
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// SignSSH signs message like 'ssh-keygen -Y sign -n NAMESPACE', returning
+// the armored signature
+func SignSSH(signer ssh.Signer, namespace string, message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, fmt.Errorf("failed to read signed data: %w", err)
+	}
+	signed := append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Hash:          h.Sum(nil),
+	})...)
+
+	var signature *ssh.Signature
+	var err error
+	// ssh-keygen signs with SHA-512 for RSA keys, never SHA-1
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	blob := append([]byte(sshsigMagic), 0, 0, 0, 1)
+	blob = append(blob, ssh.Marshal(sshsigBlob{
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(signature),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}), nil
+}
+
+// VerifySSHSignature checks an armored signature made with
+// 'ssh-keygen -Y sign -n NAMESPACE' over message, and that it was made by one
+// of the trusted keys. It returns the key that made the signature.
+func VerifySSHSignature(trusted []ssh.PublicKey, namespace string, message io.Reader, armored []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return nil, errors.New("not an SSH signature")
+	}
+	data := block.Bytes
+	if !bytes.HasPrefix(data, []byte(sshsigMagic)) {
+		return nil, errors.New("not an SSH signature")
+	}
+	data = data[len(sshsigMagic):]
+	if len(data) < 4 || data[0] != 0 || data[1] != 0 || data[2] != 0 || data[3] != 1 {
+		return nil, errors.New("unsupported SSH signature version")
+	}
+
+	var sig sshsigBlob
+	if err := ssh.Unmarshal(data[4:], &sig); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if sig.Namespace != namespace {
+		return nil, fmt.Errorf("signature is for '%s', expected '%s'", sig.Namespace, namespace)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in SSH signature: %w", err)
+	}
+	if !containsKey(trusted, publicKey) {
+		return nil, fmt.Errorf("signed by untrusted key %s", ssh.FingerprintSHA256(publicKey))
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported signature hash '%s'", sig.HashAlgorithm)
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, fmt.Errorf("failed to read signed file: %w", err)
+	}
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	signed := append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err := publicKey.Verify(signed, &signature); err != nil {
+		return nil, ErrBadSignature
+	}
+	return publicKey, nil
+}
+
+// containsKey reports whether key is one of keys
+func containsKey(keys []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerifySSHSignature(t *testing.T) {
+	dir := t.TempDir()
+	_, publicKeyPath, err := generateTestKeys(t, dir)
+	if err != nil {
+		t.Fatalf("Failed to generate test keys: %v", err)
+	}
+	file := filepath.Join(dir, "passh")
+	if err := os.WriteFile(file, []byte("release binary"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	sign := exec.Command("ssh-keygen", "-Y", "sign", "-n", "passh-release", "-f", filepath.Join(dir, "id_test"), file)
+	if output, err := sign.CombinedOutput(); err != nil {
+		t.Skipf("ssh-keygen -Y sign unavailable: %v: %s", err, output)
+	}
+	armored, err := os.ReadFile(file + ".sig")
+	if err != nil {
+		t.Fatalf("Failed to read signature: %v", err)
+	}
+
+	data, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+	trusted := []ssh.PublicKey{publicKey}
+
+	if _, err := VerifySSHSignature(trusted, "passh-release", strings.NewReader("release binary"), armored); err != nil {
+		t.Errorf("Expected valid signature, got %v", err)
+	}
+	if _, err := VerifySSHSignature(trusted, "passh-release", strings.NewReader("tampered binary"), armored); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for a modified file, got %v", err)
+	}
+	if _, err := VerifySSHSignature(trusted, "file", strings.NewReader("release binary"), armored); err == nil {
+		t.Error("Expected a signature for another namespace to be rejected")
+	}
+
+	_, other, _ := GenerateRecoveryKey()
+	if _, err := VerifySSHSignature([]ssh.PublicKey{other.PublicKey()}, "passh-release", strings.NewReader("release binary"), armored); err == nil {
+		t.Error("Expected a signature by an untrusted key to be rejected")
+	}
+	if _, err := VerifySSHSignature(trusted, "passh-release", bytes.NewReader(nil), []byte("garbage")); err == nil {
+		t.Error("Expected garbage to be rejected")
+	}
+}
+
+func TestSignSSH(t *testing.T) {
+	_, signer, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	armored, err := SignSSH(signer, "passh-entry", strings.NewReader("signed data"))
+	if err != nil {
+		t.Fatalf("SignSSH failed: %v", err)
+	}
+	trusted := []ssh.PublicKey{signer.PublicKey()}
+	if key, err := VerifySSHSignature(trusted, "passh-entry", strings.NewReader("signed data"), armored); err != nil || !bytes.Equal(key.Marshal(), signer.PublicKey().Marshal()) {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+	if _, err := VerifySSHSignature(trusted, "passh-entry", strings.NewReader("other data"), armored); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for other data, got %v", err)
+	}
+
+	// ssh-keygen accepts the signature too
+	sigPath := filepath.Join(t.TempDir(), "data.sig")
+	if err := os.WriteFile(sigPath, armored, 0600); err != nil {
+		t.Fatal(err)
+	}
+	check := exec.Command("ssh-keygen", "-Y", "check-novalidate", "-n", "passh-entry", "-s", sigPath)
+	check.Stdin = strings.NewReader("signed data")
+	if output, err := check.CombinedOutput(); err != nil {
+		if _, lookErr := exec.LookPath("ssh-keygen"); lookErr != nil {
+			t.Skip("ssh-keygen unavailable")
+		}
+		t.Errorf("ssh-keygen rejected the signature: %v: %s", err, output)
+	}
+}
@@ -0,0 +1,159 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// StreamMagic starts every encrypted stream
+	StreamMagic = "passh-stream-v1\n"
+	// streamChunkSize is the amount of plaintext sealed per chunk
+	streamChunkSize = 64 * 1024
+	// maxWrappedKeySize bounds the wrapped content key in a stream header
+	maxWrappedKeySize = 64 * 1024
+)
+
+// EncryptStreamWith encrypts r into w in constant memory. A random content
+// key seals the data in 64 KiB ChaCha20-Poly1305 chunks and is itself
+// encrypted with wrap, so a stream is readable by whoever can decrypt the
+// wrapped key. Each chunk's nonce holds its index and a final-chunk flag, so
+// reordered, truncated or extended streams fail to decrypt.
+func EncryptStreamWith(wrap func([]byte) (string, error), r io.Reader, w io.Writer) error {
+	contentKey := secure.New(chacha20poly1305.KeySize)
+	defer contentKey.Destroy()
+	key := contentKey.Bytes()
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate content key: %w", err)
+	}
+
+	wrapped, err := wrap(key)
+	if err != nil {
+		return fmt.Errorf("failed to wrap content key: %w", err)
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return err
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(wrapped)))
+	if _, err := io.WriteString(w, StreamMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, wrapped); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(r, streamChunkSize)
+	plaintext := make([]byte, streamChunkSize)
+	defer secure.Wipe(plaintext)
+	sealed := make([]byte, 0, streamChunkSize+aead.Overhead())
+
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(reader, plaintext)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		final := n < streamChunkSize
+		if !final {
+			if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+				final = true
+			}
+		}
+
+		sealed = aead.Seal(sealed[:0], streamNonce(index, final), plaintext[:n], nil)
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// DecryptStreamWith decrypts a stream written by EncryptStreamWith, using
+// unwrap to recover the content key
+func DecryptStreamWith(unwrap func(string) ([]byte, error), r io.Reader, w io.Writer) error {
+	reader := bufio.NewReaderSize(r, streamChunkSize+chacha20poly1305.Overhead)
+
+	magic := make([]byte, len(StreamMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != StreamMagic {
+		return errors.New("not a passh encrypted stream")
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(reader, length[:]); err != nil {
+		return errors.New("encrypted stream is truncated")
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxWrappedKeySize {
+		return errors.New("encrypted stream is corrupt: key block too large")
+	}
+	wrapped := make([]byte, size)
+	if _, err := io.ReadFull(reader, wrapped); err != nil {
+		return errors.New("encrypted stream is truncated")
+	}
+
+	key, err := unwrap(string(wrapped))
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(key)
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return fmt.Errorf("invalid content key: %w", err)
+	}
+
+	sealed := make([]byte, streamChunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, streamChunkSize)
+	defer secure.Wipe(plaintext[:cap(plaintext)])
+
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(reader, sealed)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		final := n < len(sealed)
+		if !final {
+			if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+				final = true
+			}
+		}
+
+		plaintext, err = aead.Open(plaintext[:0], streamNonce(index, final), sealed[:n], nil)
+		if err != nil {
+			return errors.New("encrypted stream is corrupt or truncated")
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// streamNonce builds the nonce of a chunk from its index and final flag
+func streamNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
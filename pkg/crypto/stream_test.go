@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// plainWrap stands in for key wrapping in stream tests
+func plainWrap(key []byte) (string, error) {
+	return string(key), nil
+}
+
+func plainUnwrap(wrapped string) ([]byte, error) {
+	return []byte(wrapped), nil
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, 2*streamChunkSize + 100} {
+		content := make([]byte, size)
+		if _, err := rand.Read(content); err != nil {
+			t.Fatalf("Failed to generate content: %v", err)
+		}
+
+		var encrypted bytes.Buffer
+		if err := EncryptStreamWith(plainWrap, bytes.NewReader(content), &encrypted); err != nil {
+			t.Fatalf("Failed to encrypt %d bytes: %v", size, err)
+		}
+		if size > 16 && bytes.Contains(encrypted.Bytes(), content[:16]) {
+			t.Fatalf("Encrypted stream of %d bytes contains plaintext", size)
+		}
+
+		var decrypted bytes.Buffer
+		if err := DecryptStreamWith(plainUnwrap, bytes.NewReader(encrypted.Bytes()), &decrypted); err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), content) {
+			t.Fatalf("Stream of %d bytes did not round-trip", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	content := make([]byte, 2*streamChunkSize+100)
+	var encrypted bytes.Buffer
+	if err := EncryptStreamWith(plainWrap, bytes.NewReader(content), &encrypted); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	data := encrypted.Bytes()
+	chunk := streamChunkSize + 16
+
+	tests := map[string][]byte{
+		// Dropping the last chunk makes the previous one look final
+		"truncated":             data[:len(data)-116],
+		"cut at chunk boundary": data[:len(data)-116-chunk],
+		"extended":              append(append([]byte(nil), data...), 0),
+		"flipped bit": func() []byte {
+			tampered := append([]byte(nil), data...)
+			tampered[len(tampered)-1] ^= 1
+			return tampered
+		}(),
+	}
+	for name, tampered := range tests {
+		if err := DecryptStreamWith(plainUnwrap, bytes.NewReader(tampered), &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected %s stream to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrNoSecurityKey is returned when ssh-agent holds no FIDO security key
+var ErrNoSecurityKey = errors.New("no security key in ssh-agent")
+
+// SecurityKey returns a FIDO security key held by ssh-agent, such as an
+// sk-ssh-ed25519 key made with 'ssh-keygen -t ed25519-sk'
+func SecurityKey() (ssh.Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, ErrNoSecurityKey
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to list SSH agent keys: %w", err)
+	}
+	for _, signer := range signers {
+		if strings.HasPrefix(signer.PublicKey().Type(), "sk-") {
+			// The signer uses the connection, which is closed with the process
+			return signer, nil
+		}
+	}
+	conn.Close()
+	return nil, ErrNoSecurityKey
+}
+
+// Touch signs a random challenge with a security key, which only succeeds
+// once the user touches it
+func Touch(signer ssh.Signer) error {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+	signature, err := signer.Sign(rand.Reader, challenge)
+	if err != nil {
+		return fmt.Errorf("security key was not touched: %w", err)
+	}
+	return signer.PublicKey().Verify(challenge, signature)
+}
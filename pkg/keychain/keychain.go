@@ -0,0 +1,133 @@
+// Package keychain mirrors passwords into the platform's credential store:
+// the macOS Keychain, the Windows Credential Manager or a libsecret keyring.
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnavailable is returned when the platform has no supported credential store
+var ErrUnavailable = errors.New("no credential store found (install secret-tool from libsecret on Linux)")
+
+// ErrNotFound is returned when the credential store has no password for an item
+var ErrNotFound = errors.New("not in the credential store")
+
+// Keychain stores passwords by service and account
+type Keychain interface {
+	// Name describes the credential store
+	Name() string
+	// Set adds or replaces the password of an item
+	Set(service, account string, password []byte) error
+	// Get returns the password of an item
+	Get(service, account string) ([]byte, error)
+	// Delete removes an item, if it exists
+	Delete(service, account string) error
+}
+
+// Detect finds the credential store for the current platform
+func Detect() (Keychain, error) {
+	if keychain := native(); keychain != nil {
+		return keychain, nil
+	}
+
+	command, keychain := "secret-tool", Keychain(&secretTool{})
+	if runtime.GOOS == "darwin" {
+		command, keychain = "security", &macKeychain{}
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, ErrUnavailable
+	}
+	return keychain, nil
+}
+
+// macKeychain uses the security tool of macOS
+type macKeychain struct{}
+
+func (k *macKeychain) Name() string {
+	return "macOS Keychain"
+}
+
+func (k *macKeychain) Set(service, account string, password []byte) error {
+	// Commands are given on standard input so the password never appears in
+	// the process list
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		quote(service), quote(account), quote(string(password))))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("security failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func (k *macKeychain) Get(service, account string) ([]byte, error) {
+	output, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	var exitErr *exec.ExitError
+	// security exits with errSecItemNotFound (44) for missing items
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("security failed: %w", err)
+	}
+	return bytes.TrimSuffix(output, []byte("\n")), nil
+}
+
+func (k *macKeychain) Delete(service, account string) error {
+	output, err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("security failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// secretTool uses secret-tool, which talks to any libsecret keyring such as
+// GNOME Keyring or KWallet
+type secretTool struct{}
+
+func (k *secretTool) Name() string {
+	return "libsecret keyring"
+}
+
+func (k *secretTool) Set(service, account string, password []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label", service+": "+account, "service", service, "account", account)
+	cmd.Stdin = bytes.NewReader(password)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func (k *secretTool) Get(service, account string) ([]byte, error) {
+	output, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	var exitErr *exec.ExitError
+	// secret-tool fails without output for missing items
+	if errors.As(err, &exitErr) && len(output) == 0 && len(bytes.TrimSpace(exitErr.Stderr)) == 0 {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secret-tool failed: %w", err)
+	}
+	return output, nil
+}
+
+func (k *secretTool) Delete(service, account string) error {
+	// secret-tool succeeds whether or not the item exists
+	if output, err := exec.Command("secret-tool", "clear", "service", service, "account", account).CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// quote quotes an argument for the shell-like command parser of security -i
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,9 @@
+package keychain
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	if quoted := quote(`it's a "test"`); quoted != `'it'"'"'s a "test"'` {
+		t.Errorf("Unexpected quoting %s", quoted)
+	}
+}
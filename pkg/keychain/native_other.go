@@ -0,0 +1,8 @@
+//go:build !windows
+
+package keychain
+
+// native returns nil, as other platforms use command line tools
+func native() Keychain {
+	return nil
+}
@@ -0,0 +1,110 @@
+//go:build windows
+
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32    = syscall.NewLazyDLL("advapi32.dll")
+	credWriteW  = advapi32.NewProc("CredWriteW")
+	credReadW   = advapi32.NewProc("CredReadW")
+	credDeleteW = advapi32.NewProc("CredDeleteW")
+	credFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential is the Win32 CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// native returns the Windows Credential Manager
+func native() Keychain {
+	return &winCred{}
+}
+
+// winCred stores generic credentials in the Windows Credential Manager,
+// named service:account as most tools do
+type winCred struct{}
+
+func (k *winCred) Name() string {
+	return "Windows Credential Manager"
+}
+
+func (k *winCred) Set(service, account string, password []byte) error {
+	target, err := syscall.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(password)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(password) > 0 {
+		cred.CredentialBlob = &password[0]
+	}
+	if ok, _, err := credWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); ok == 0 {
+		return fmt.Errorf("CredWrite failed: %w", err)
+	}
+	return nil
+}
+
+func (k *winCred) Get(service, account string) ([]byte, error) {
+	target, err := syscall.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *credential
+	if ok, _, err := credReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ok == 0 {
+		if errors.Is(err, errorNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("CredRead failed: %w", err)
+	}
+	defer credFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	password := make([]byte, cred.CredentialBlobSize)
+	copy(password, unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	return password, nil
+}
+
+func (k *winCred) Delete(service, account string) error {
+	target, err := syscall.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return err
+	}
+	if ok, _, err := credDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); ok == 0 && !errors.Is(err, errorNotFound) {
+		return fmt.Errorf("CredDelete failed: %w", err)
+	}
+	return nil
+}
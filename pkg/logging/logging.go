@@ -0,0 +1,143 @@
+// Package logging writes diagnostic messages to standard error at a
+// configurable level, keeping them out of the data commands print. Messages
+// are redacted so they never carry secrets, see Secret.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Level controls which messages are written
+type Level int
+
+const (
+	// LevelQuiet shows only warnings
+	LevelQuiet Level = iota
+	// LevelInfo adds notices and status messages, the default
+	LevelInfo
+	// LevelVerbose adds details such as which keys and stores are used
+	LevelVerbose
+	// LevelDebug adds low-level tracing for troubleshooting
+	LevelDebug
+)
+
+// name returns the level as written in JSON messages
+func (l Level) name() string {
+	switch l {
+	case LevelQuiet:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelVerbose:
+		return "verbose"
+	default:
+		return "debug"
+	}
+}
+
+// Format controls how messages are written
+type Format int
+
+const (
+	// FormatText writes each message as a line of text, the default
+	FormatText Format = iota
+	// FormatJSON writes each message as a JSON object on its own line, for
+	// log collectors
+	FormatJSON
+)
+
+// ParseFormat returns the format called text or json
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format '%s': must be text or json", name)
+}
+
+var (
+	mu     sync.Mutex
+	level            = LevelInfo
+	format           = FormatText
+	output io.Writer = os.Stderr
+)
+
+// SetLevel changes which messages are written
+func SetLevel(l Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+}
+
+// GetLevel returns the current level
+func GetLevel() Level {
+	mu.Lock()
+	defer mu.Unlock()
+	return level
+}
+
+// SetFormat changes how messages are written
+func SetFormat(f Format) {
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+}
+
+// SetOutput changes where messages are written, standard error by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+// Enabled reports whether messages at a level are written
+func Enabled(l Level) bool {
+	return GetLevel() >= l
+}
+
+func logf(l Level, prefix, msgFormat string, args ...any) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < l {
+		return
+	}
+
+	message := redact(fmt.Sprintf(msgFormat, redactArgs(args)...))
+	if format == FormatJSON {
+		line, _ := json.Marshal(struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Message string `json:"msg"`
+		}{time.Now().UTC().Format(time.RFC3339), l.name(), message})
+		fmt.Fprintf(output, "%s\n", line)
+		return
+	}
+	fmt.Fprintf(output, "%s%s\n", prefix, message)
+}
+
+// Warnf writes a warning, shown at every level
+func Warnf(format string, args ...any) {
+	logf(LevelQuiet, "Warning: ", format, args...)
+}
+
+// Infof writes a notice or status message, hidden by --quiet
+func Infof(format string, args ...any) {
+	logf(LevelInfo, "", format, args...)
+}
+
+// Verbosef writes details shown with --verbose
+func Verbosef(format string, args ...any) {
+	logf(LevelVerbose, "", format, args...)
+}
+
+// Debugf writes tracing shown with --debug
+func Debugf(format string, args ...any) {
+	logf(LevelDebug, "debug: ", format, args...)
+}
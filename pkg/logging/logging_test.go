@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	defer SetOutput(os.Stderr)
+	defer SetLevel(LevelInfo)
+
+	tests := []struct {
+		level    Level
+		expected string
+	}{
+		{LevelQuiet, "Warning: w\n"},
+		{LevelInfo, "Warning: w\ni\n"},
+		{LevelVerbose, "Warning: w\ni\nv\n"},
+		{LevelDebug, "Warning: w\ni\nv\ndebug: d\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		SetOutput(&buf)
+		SetLevel(test.level)
+
+		Warnf("w")
+		Infof("i")
+		Verbosef("v")
+		Debugf("d")
+
+		if buf.String() != test.expected {
+			t.Errorf("Level %d: expected %q, got %q", test.level, test.expected, buf.String())
+		}
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	defer SetOutput(os.Stderr)
+	defer SetLevel(LevelInfo)
+	SetLevel(LevelDebug)
+
+	tests := []struct {
+		format string
+		args   []any
+		secret string
+	}{
+		{"read %s", []any{[]byte("hunter2")}, "hunter2"},
+		{"read %q", []any{[]byte("hunter2")}, "hunter2"},
+		{"read %x", []any{[]byte("hunter2")}, "68756e74657232"},
+		{"read %v", []any{[]byte("hunter2")}, "104"},
+		{"read %#v", []any{Secret("hunter2")}, "hunter2"},
+		{"passphrase %s", []any{Secret("correct horse")}, "correct horse"},
+		{"invalid entry line '%s'", []any{"password: hunter2"}, "hunter2"},
+		{"entry:\n%s", []any{"s3cret\npassword: hunter2\nuser: me"}, "hunter2"},
+		{"calling https://example.com/?api_key=%s&x=1", []any{"abcdef"}, "abcdef"},
+		{"env %s", []any{"TOKEN=abcdef"}, "abcdef"},
+		{"otpauth: %s", []any{"otpauth://totp/x?secret=JBSWY3DP"}, "JBSWY3DP"},
+	}
+	for _, format := range []Format{FormatText, FormatJSON} {
+		SetFormat(format)
+		for _, test := range tests {
+			var buf bytes.Buffer
+			SetOutput(&buf)
+			Debugf(test.format, test.args...)
+			if strings.Contains(buf.String(), test.secret) || !strings.Contains(buf.String(), "[REDACTED]") {
+				t.Errorf("Expected %q to be redacted from %q", test.secret, buf.String())
+			}
+		}
+	}
+	SetFormat(FormatText)
+
+	// Messages about secrets that don't quote them stay readable
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	Warnf("failed to cache the passphrase: %v", "agent not running")
+	if buf.String() != "Warning: failed to cache the passphrase: agent not running\n" {
+		t.Errorf("Expected the message unchanged, got %q", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	defer SetOutput(os.Stderr)
+	defer SetFormat(FormatText)
+
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetFormat(FormatJSON)
+	Warnf("store %s is readable by others", "/srv/passh")
+
+	var message struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Message string `json:"msg"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &message); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", buf.String(), err)
+	}
+	if message.Level != "warn" || message.Message != "store /srv/passh is readable by others" || message.Time == "" {
+		t.Errorf("Unexpected message %+v", message)
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// redacted replaces secrets in messages
+const redacted = "[REDACTED]"
+
+// Secret wraps a value that must never be logged. It formats as [REDACTED]
+// with every verb, so passing one to a log function is always safe.
+type Secret []byte
+
+// String returns [REDACTED]
+func (Secret) String() string {
+	return redacted
+}
+
+// Format writes [REDACTED] whatever the verb
+func (Secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+// GoString returns [REDACTED], also for %#v
+func (Secret) GoString() string {
+	return redacted
+}
+
+// redactArgs replaces byte slices among the arguments of a message with
+// Secret. passh keeps passwords, passphrases and decrypted entries in byte
+// slices so they can be wiped, so none of them can reach a log; log their
+// length instead.
+func redactArgs(args []any) []any {
+	var safe []any
+	for i, arg := range args {
+		if data, ok := arg.([]byte); ok {
+			if safe == nil {
+				safe = append([]any(nil), args...)
+			}
+			safe[i] = Secret(data)
+		}
+	}
+	if safe == nil {
+		return args
+	}
+	return safe
+}
+
+// secretKeys are the names of entry fields and settings that hold secrets
+const secretKeys = `(?:password|passphrase|passwd|secret|token|api[_-]?key|pin|otpauth)`
+
+var (
+	// secretAssignment matches settings such as "token=abc" anywhere
+	secretAssignment = regexp.MustCompile(`(?i)\b(` + secretKeys + `=)("[^"]*"|'[^']*'|[^\s&;,]+)`)
+	// secretLine matches entry lines such as "password: hunter2" quoted at the
+	// start of a line or string, but not prose such as "wrong passphrase: EOF"
+	secretLine = regexp.MustCompile(`(?im)((?:^|['"])[ \t]*` + secretKeys + `[ \t]*:[ \t]*)([^'"\n]+)`)
+)
+
+// redact removes the values of secret fields from a message
+func redact(message string) string {
+	message = secretAssignment.ReplaceAllString(message, "${1}"+redacted)
+	return secretLine.ReplaceAllString(message, "${1}"+redacted)
+}
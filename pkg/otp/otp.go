@@ -0,0 +1,277 @@
+// Package otp implements time-based (RFC 6238) and counter-based (RFC 4226)
+// one-time passwords, Steam Guard codes, and the otpauth:// URI format used by
+// authenticator apps.
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of one-time passwords, as in otpauth:// URIs
+const (
+	TOTP = "totp"
+	HOTP = "hotp"
+	// Steam is Steam Guard's TOTP variant with 5 alphanumeric characters
+	Steam = "steam"
+)
+
+// steamAlphabet holds the characters of Steam Guard codes
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// Key describes a one-time password generator
+type Key struct {
+	// Type is TOTP, HOTP or Steam
+	Type      string
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	// Period is the lifetime of TOTP codes in seconds
+	Period int
+	// Counter is the counter of the next HOTP code
+	Counter uint64
+}
+
+// Parse reads an otpauth://totp/, otpauth://hotp/ or otpauth://steam/ URI, a
+// steam:// secret as used by Steam Guard exports, or a bare base32 secret for
+// TOTP
+func Parse(value string) (*Key, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "otpauth://") {
+		return parseURI(value)
+	}
+	if secret, ok := strings.CutPrefix(value, "steam://"); ok {
+		decoded, err := decodeSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{Type: Steam, Secret: decoded, Algorithm: "SHA1", Digits: 5, Period: 30}, nil
+	}
+
+	secret, err := decodeSecret(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Type: TOTP, Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30}, nil
+}
+
+// parseURI parses an otpauth:// URI
+func parseURI(value string) (*Key, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if u.Host != TOTP && u.Host != HOTP && u.Host != Steam {
+		return nil, fmt.Errorf("unsupported OTP type %q", u.Host)
+	}
+
+	query := u.Query()
+	secret, err := decodeSecret(query.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{Type: u.Host, Secret: secret, Algorithm: "SHA1", Digits: 6, Period: 30}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = issuer, strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		key.Algorithm = strings.ToUpper(algorithm)
+		if _, err := key.hash(); err != nil {
+			return nil, err
+		}
+	}
+	// KeePassXC and others mark Steam Guard codes with an encoder parameter
+	if key.Type == Steam || strings.EqualFold(query.Get("encoder"), Steam) {
+		key.Type, key.Digits = Steam, 5
+	} else if digits := query.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil || key.Digits < 6 || key.Digits > 10 {
+			return nil, fmt.Errorf("invalid OTP digits %q", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if key.Period, err = strconv.Atoi(period); err != nil || key.Period <= 0 {
+			return nil, fmt.Errorf("invalid OTP period %q", period)
+		}
+	}
+	if counter := query.Get("counter"); counter != "" && key.Type == HOTP {
+		if key.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid OTP counter %q", counter)
+		}
+	}
+
+	return key, nil
+}
+
+// decodeSecret decodes a base32 secret, tolerating spaces, lower case and
+// missing padding
+func decodeSecret(value string) ([]byte, error) {
+	value = strings.ToUpper(strings.Join(strings.Fields(value), ""))
+	value = strings.TrimRight(value, "=")
+	if value == "" {
+		return nil, errors.New("OTP secret is empty")
+	}
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(value)
+	if err != nil {
+		return nil, errors.New("OTP secret is not valid base32")
+	}
+	return secret, nil
+}
+
+// Validate checks the algorithm, digits and period of a key, for example
+// after they were changed from what Parse returned
+func (k *Key) Validate() error {
+	if _, err := k.hash(); err != nil {
+		return err
+	}
+	if k.Type == Steam {
+		if k.Digits != 5 {
+			return fmt.Errorf("invalid OTP digits %d; Steam Guard codes have 5", k.Digits)
+		}
+	} else if k.Digits < 6 || k.Digits > 10 {
+		return fmt.Errorf("invalid OTP digits %d", k.Digits)
+	}
+	if k.Type != HOTP && k.Period <= 0 {
+		return fmt.Errorf("invalid OTP period %d", k.Period)
+	}
+	return nil
+}
+
+// hash returns the hash function for the key's algorithm
+func (k *Key) hash() (func() hash.Hash, error) {
+	switch k.Algorithm {
+	case "", "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported OTP algorithm %q", k.Algorithm)
+}
+
+// Code returns the TOTP code valid at time t
+func (k *Key) Code(t time.Time) (string, error) {
+	if k.Type == HOTP {
+		return "", errors.New("HOTP codes depend on a counter, not the time")
+	}
+	return k.At(uint64(t.Unix()) / uint64(k.Period))
+}
+
+// At returns the code for a counter value, as described in RFC 4226. For
+// TOTP the counter is the number of periods since the Unix epoch.
+func (k *Key) At(counter uint64) (string, error) {
+	newHash, err := k.hash()
+	if err != nil {
+		return "", err
+	}
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+
+	mac := hmac.New(newHash, k.Secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation as described in RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	if k.Type == Steam {
+		code := make([]byte, k.Digits)
+		for i := range code {
+			code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+			value /= uint32(len(steamAlphabet))
+		}
+		return string(code), nil
+	}
+
+	modulus := uint64(1)
+	for i := 0; i < k.Digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", k.Digits, uint64(value)%modulus), nil
+}
+
+// Resync finds the HOTP counter that produced code within lookAhead of the
+// key's counter, nearest first and in both directions, since either side may
+// have moved on. It returns the counter of the code after it.
+func (k *Key) Resync(code string, lookAhead int) (uint64, error) {
+	if k.Type != HOTP {
+		return 0, errors.New("only HOTP keys have a counter to resynchronize")
+	}
+	for distance := uint64(0); distance <= uint64(lookAhead); distance++ {
+		candidates := []uint64{k.Counter + distance}
+		if distance > 0 && distance <= k.Counter {
+			candidates = append(candidates, k.Counter-distance)
+		}
+		for _, counter := range candidates {
+			if candidate, err := k.At(counter); err != nil {
+				return 0, err
+			} else if hmac.Equal([]byte(candidate), []byte(code)) {
+				return counter + 1, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("code %s not found within %d of counter %d", code, lookAhead, k.Counter)
+}
+
+// Remaining returns how long the code at time t stays valid
+func (k *Key) Remaining(t time.Time) time.Duration {
+	period := int64(k.Period)
+	return time.Duration(period-t.Unix()%period) * time.Second
+}
+
+// URI encodes the key as an otpauth:// URI, for example to import it into
+// an authenticator app
+func (k *Key) URI() string {
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(k.Secret))
+	if k.Issuer != "" {
+		query.Set("issuer", k.Issuer)
+	}
+	query.Set("algorithm", k.Algorithm)
+	query.Set("digits", strconv.Itoa(k.Digits))
+	otpType := TOTP
+	if k.Type == HOTP {
+		otpType = HOTP
+		query.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else {
+		query.Set("period", strconv.Itoa(k.Period))
+	}
+	// otpauth://totp/ with an encoder is understood by more apps than
+	// otpauth://steam/
+	if k.Type == Steam {
+		query.Set("encoder", Steam)
+	}
+
+	u := url.URL{Scheme: "otpauth", Host: otpType, Path: "/" + label, RawQuery: query.Encode()}
+	return u.String()
+}
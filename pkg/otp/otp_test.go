@@ -0,0 +1,174 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCodeRFC6238(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	tests := []struct {
+		unix      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1234567890, "SHA256", "91819424"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, test := range tests {
+		key := &Key{Secret: []byte(secrets[test.algorithm]), Algorithm: test.algorithm, Digits: 8, Period: 30}
+		code, err := key.Code(time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatalf("Code failed: %v", err)
+		}
+		if code != test.code {
+			t.Errorf("%s at %d: expected %s, got %s", test.algorithm, test.unix, test.code, code)
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	key, err := Parse("otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&digits=8&period=60&algorithm=sha256")
+	if err != nil {
+		t.Fatalf("Failed to parse URI: %v", err)
+	}
+	if key.Issuer != "Example" || key.Account != "alice@example.com" || key.Digits != 8 || key.Period != 60 || key.Algorithm != "SHA256" {
+		t.Fatalf("Unexpected key: %+v", key)
+	}
+
+	again, err := Parse(key.URI())
+	if err != nil {
+		t.Fatalf("Failed to parse generated URI: %v", err)
+	}
+	if again.Issuer != key.Issuer || again.Account != key.Account || string(again.Secret) != string(key.Secret) {
+		t.Fatalf("URI did not round-trip: %+v", again)
+	}
+}
+
+func TestParseBareSecret(t *testing.T) {
+	key, err := Parse("jbsw y3dp ehpk 3pxp")
+	if err != nil {
+		t.Fatalf("Failed to parse secret: %v", err)
+	}
+	if string(key.Secret) != "Hello!\xde\xad\xbe\xef" || key.Digits != 6 || key.Period != 30 {
+		t.Fatalf("Unexpected key: %+v", key)
+	}
+
+	for _, invalid := range []string{"", "not base32!", "otpauth://yandex/x?secret=JBSWY3DP"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestHOTPRFC4226(t *testing.T) {
+	// Test vectors from RFC 4226 appendix D
+	codes := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	key := &Key{Type: HOTP, Secret: []byte("12345678901234567890"), Algorithm: "SHA1", Digits: 6}
+	for counter, expected := range codes {
+		code, err := key.At(uint64(counter))
+		if err != nil {
+			t.Fatalf("At failed: %v", err)
+		}
+		if code != expected {
+			t.Errorf("counter %d: expected %s, got %s", counter, expected, code)
+		}
+	}
+	if _, err := key.Code(time.Now()); err == nil {
+		t.Error("Expected Code to fail for an HOTP key")
+	}
+}
+
+func TestHOTPURIAndResync(t *testing.T) {
+	key, err := Parse("otpauth://hotp/Bank:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Bank&counter=5")
+	if err != nil {
+		t.Fatalf("Failed to parse URI: %v", err)
+	}
+	if key.Type != HOTP || key.Counter != 5 {
+		t.Fatalf("Unexpected key: %+v", key)
+	}
+	again, err := Parse(key.URI())
+	if err != nil || again.Type != HOTP || again.Counter != 5 {
+		t.Fatalf("URI did not round-trip: %+v (%v)", again, err)
+	}
+
+	// The server moved ahead, e.g. after codes were taken on another device
+	next, err := key.Resync("399871", 10)
+	if err != nil || next != 9 {
+		t.Errorf("Expected to resync to counter 9, got %d (%v)", next, err)
+	}
+	// passh moved ahead of the last code the server accepted
+	next, err = key.Resync("969429", 10)
+	if err != nil || next != 4 {
+		t.Errorf("Expected to resync to counter 4, got %d (%v)", next, err)
+	}
+	if _, err := key.Resync("520489", 3); err == nil {
+		t.Error("Expected a code beyond the look-ahead not to be found")
+	}
+}
+
+func TestSteamGuard(t *testing.T) {
+	// GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ is "12345678901234567890" in base32
+	for _, value := range []string{
+		"steam://GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://steam/Steam:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://totp/Steam:alice?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&encoder=steam&digits=6",
+	} {
+		key, err := Parse(value)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", value, err)
+		}
+		if key.Type != Steam || key.Digits != 5 {
+			t.Fatalf("Expected a Steam Guard key from %q, got %+v", value, key)
+		}
+		for unix, expected := range map[int64]string{59: "PV9M4", 1111111109: "PY4YB"} {
+			code, err := key.Code(time.Unix(unix, 0))
+			if err != nil {
+				t.Fatalf("Code failed: %v", err)
+			}
+			if code != expected {
+				t.Errorf("%q at %d: expected %s, got %s", value, unix, expected, code)
+			}
+		}
+
+		again, err := Parse(key.URI())
+		if err != nil || again.Type != Steam {
+			t.Errorf("URI did not round-trip: %+v (%v)", again, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	key, err := Parse("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("Failed to parse secret: %v", err)
+	}
+	key.Algorithm, key.Digits, key.Period = "SHA512", 8, 60
+	if err := key.Validate(); err != nil {
+		t.Errorf("Expected a valid key: %v", err)
+	}
+
+	for _, change := range []func(*Key){
+		func(k *Key) { k.Algorithm = "MD5" },
+		func(k *Key) { k.Digits = 4 },
+		func(k *Key) { k.Period = 0 },
+		func(k *Key) { k.Type = Steam },
+	} {
+		invalid := *key
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+}
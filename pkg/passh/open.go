@@ -0,0 +1,278 @@
+package passh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+// Store metadata files
+const (
+	// BackendMeta names the encryption backend of stores not using the
+	// default ssh backend
+	BackendMeta = "backend"
+	// RecoveryKeyMeta holds the recovery public key from 'passh shard create'
+	RecoveryKeyMeta = "recovery.pub"
+	// passphraseCheckMeta holds a value encrypted with the store passphrase,
+	// to tell a mistyped passphrase apart before anything is written with it
+	passphraseCheckMeta = "passphrase-check"
+)
+
+// defaultBackend is the encryption backend of stores without a backend file
+const defaultBackend = "ssh"
+
+// OpenStorage opens the store described by options as a storage.Store, for
+// programs that need more than Store offers. The passh command opens its
+// stores with it, so both apply the same settings and checks.
+func OpenStorage(options Options) (*storage.Store, error) {
+	encryptor := options.Encryptor
+	if encryptor == nil {
+		keys, err := sshEncryptor(options)
+		if err != nil {
+			return nil, err
+		}
+		encryptor = keys
+	}
+
+	cfg := options.Config
+	if cfg == nil {
+		var err error
+		if cfg, err = config.Load(); err != nil {
+			return nil, err
+		}
+	}
+	backendOptions, err := BackendOptions(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	n, err := workers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := storage.OpenBackendWithOptions(options.Dir, backendOptions)
+	if err != nil {
+		return nil, err
+	}
+	store := storage.NewStoreWithBackend(backend, encryptor)
+	if options.Cache != nil {
+		store.SetCache(options.Cache)
+	}
+	store.SetIndexPath(options.IndexPath)
+	store.SetWorkers(n)
+	if options.Actor != "" {
+		store.SetActor(options.Actor)
+	}
+	confirm := options.Confirm
+	if confirm == nil {
+		confirm = refuseRelease
+	}
+	store.SetConfirm(confirm)
+
+	if err := setupStore(store, options, cfg, encryptor); err != nil {
+		store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// setupStore signs entries if configured, checks the store is used with its
+// own backend and adds its recovery key
+func setupStore(store *storage.Store, options Options, cfg *config.Config, encryptor crypto.Encryptor) error {
+	if !options.NoSign {
+		if err := setupSigning(store, cfg, encryptor); err != nil {
+			return err
+		}
+	}
+	name := options.Backend
+	if name == "" {
+		name = defaultBackend
+	}
+	if err := checkBackend(store, name); err != nil {
+		return err
+	}
+	if encryptor, ok := encryptor.(*crypto.PassphraseEncryptor); ok {
+		if err := checkPassphrase(store, encryptor); err != nil {
+			return err
+		}
+	}
+
+	// Entries are also encrypted to the recovery key from 'passh shard create'
+	recoveryKey, err := ReadRecoveryKey(store)
+	if err != nil {
+		return err
+	}
+	if recoveryKey != nil {
+		logging.Debugf("also encrypting to recovery key %s", crypto.RecoveryKeyID(recoveryKey))
+		store.AddRecipient(recoveryKey)
+	}
+	return nil
+}
+
+// refuseRelease refuses entries marked "confirm: true" when no one can be
+// asked to confirm them
+func refuseRelease(name string) error {
+	return fmt.Errorf("entry '%s' is marked 'confirm: true', but Options.Confirm is not set: %w",
+		name, storage.ErrNotConfirmed)
+}
+
+// BackendOptions builds backend credentials from the config. WebDAV secrets
+// can be given directly or read from an entry of the local store. Entries are
+// skipped when opening the store itself (store is nil), since it cannot
+// provide its own credentials.
+func BackendOptions(cfg *config.Config, store *storage.Store) (storage.BackendOptions, error) {
+	auth := storage.WebDAVAuth{
+		Username: cfg.Get("webdav.user"),
+		Password: cfg.Get("webdav.password"),
+		Token:    cfg.Get("webdav.token"),
+	}
+	if value := cfg.Get("webdav.insecure"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return storage.BackendOptions{}, fmt.Errorf("invalid webdav.insecure: %w", err)
+		}
+		auth.Insecure = insecure
+	}
+
+	for key, target := range map[string]*string{
+		"webdav.password_entry": &auth.Password,
+		"webdav.token_entry":    &auth.Token,
+	} {
+		entry := cfg.Get(key)
+		if entry == "" || store == nil {
+			continue
+		}
+
+		secret, err := store.Get(entry)
+		if err != nil {
+			return storage.BackendOptions{}, fmt.Errorf("failed to read %s '%s': %w", key, entry, err)
+		}
+		*target = strings.TrimRight(string(secret), "\r\n")
+	}
+
+	options := storage.BackendOptions{WebDAV: auth, Group: cfg.Get("store.group")}
+	if value := cfg.Get("store.mode"); value != "" {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || mode&0600 != 0600 || mode&^0770 != 0 {
+			return storage.BackendOptions{}, fmt.Errorf("invalid store.mode '%s': must be an octal mode giving the owner read and write access and others none, such as 0640", value)
+		}
+		options.FileMode = os.FileMode(mode)
+	}
+	return options, nil
+}
+
+// workers returns how many entries bulk operations process at once, from
+// the workers setting
+func workers(cfg *config.Config) (int, error) {
+	value := cfg.Get("workers")
+	if value == "" {
+		return storage.DefaultWorkers, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid workers setting '%s', expected a positive number", value)
+	}
+	return n, nil
+}
+
+// setupSigning makes the store sign the entries it writes when the
+// sign.entries setting is on, with the private key of the ssh backend
+func setupSigning(store *storage.Store, cfg *config.Config, encryptor crypto.Encryptor) error {
+	value := cfg.Get("sign.entries")
+	if value == "" {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid sign.entries: %w", err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	sshEncryptor, ok := encryptor.(*crypto.SSHEncryptor)
+	if !ok {
+		return errors.New("sign.entries needs the ssh backend")
+	}
+	signer := sshEncryptor.Signer()
+	if signer == nil {
+		return errors.New("sign.entries is set, but the private key for your public key is not loaded")
+	}
+	store.SetSigner(signer)
+	return nil
+}
+
+// checkBackend rejects using a store with another backend than the one its
+// entries are encrypted with. Stores without a backend file use ssh; an
+// empty store records the backend it is first used with.
+func checkBackend(store *storage.Store, name string) error {
+	data, err := store.ReadMeta(BackendMeta)
+	if err == nil {
+		recorded := strings.TrimSpace(string(data))
+		if recorded != name {
+			return fmt.Errorf("store is encrypted with the %s backend, not %s; use --backend %s", recorded, name, recorded)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if name == defaultBackend {
+		return nil
+	}
+	entries, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("store is encrypted with the ssh backend, not %s; use --backend ssh", name)
+	}
+	return store.WriteMeta(BackendMeta, []byte(name+"\n"))
+}
+
+// checkPassphrase verifies the passphrase against the store's check value,
+// or records one when the store is used with a passphrase for the first time
+func checkPassphrase(store *storage.Store, encryptor *crypto.PassphraseEncryptor) error {
+	data, err := store.ReadMeta(passphraseCheckMeta)
+	if errors.Is(err, os.ErrNotExist) {
+		check, err := encryptor.Encrypt([]byte("passh"))
+		if err != nil {
+			return err
+		}
+		return store.WriteMeta(passphraseCheckMeta, []byte(check+"\n"))
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := encryptor.Decrypt(strings.TrimSpace(string(data))); err != nil {
+		return fmt.Errorf("wrong store passphrase: %w", crypto.ErrDecryptFailed)
+	}
+	return nil
+}
+
+// ReadRecoveryKey returns the store's recovery public key, or nil if it has none
+func ReadRecoveryKey(store *storage.Store) (ssh.PublicKey, error) {
+	data, err := store.ReadMeta(RecoveryKeyMeta)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recovery key: %w", err)
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,129 @@
+package passh
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+func TestCheckBackend(t *testing.T) {
+	store := storage.NewStoreWithBackend(storage.NewMemoryBackend(), nil)
+
+	// An empty store records the first backend other than ssh
+	if err := checkBackend(store, "gpg"); err != nil {
+		t.Fatalf("Expected an empty store to accept gpg: %v", err)
+	}
+	if err := checkBackend(store, "gpg"); err != nil {
+		t.Errorf("Expected the recorded backend to be accepted: %v", err)
+	}
+	if err := checkBackend(store, "ssh"); err == nil {
+		t.Error("Expected ssh to be rejected for a gpg store")
+	}
+}
+
+func TestCheckBackendLegacySSHStore(t *testing.T) {
+	backend := storage.NewMemoryBackend()
+	if err := backend.Put("github/personal", []byte("encrypted")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	store := storage.NewStoreWithBackend(backend, nil)
+
+	if err := checkBackend(store, "ssh"); err != nil {
+		t.Errorf("Expected a store without backend file to be ssh: %v", err)
+	}
+	if err := checkBackend(store, "gpg"); err == nil {
+		t.Error("Expected gpg to be rejected for a store with ssh entries")
+	}
+}
+
+func TestCheckPassphrase(t *testing.T) {
+	params := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	right, _ := crypto.NewPassphraseEncryptor([]byte("correct horse"), params)
+	wrong, _ := crypto.NewPassphraseEncryptor([]byte("battery staple"), params)
+	store := storage.NewStoreWithBackend(storage.NewMemoryBackend(), right)
+
+	// The first use records the check value
+	if err := checkPassphrase(store, right); err != nil {
+		t.Fatalf("Expected the first passphrase to be accepted: %v", err)
+	}
+	if err := checkPassphrase(store, right); err != nil {
+		t.Errorf("Expected the same passphrase to be accepted: %v", err)
+	}
+	if err := checkPassphrase(store, wrong); !errors.Is(err, crypto.ErrDecryptFailed) {
+		t.Errorf("Expected a wrong passphrase to be rejected, got %v", err)
+	}
+}
+
+func TestOpenOtherBackend(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, privateKey := writeKeys(t, t.TempDir(), nil)
+	params := crypto.KDFParams{Time: 1, Memory: 8 * 1024, Threads: 1}
+	encryptor, _ := crypto.NewPassphraseEncryptor([]byte("correct horse"), params)
+
+	store, err := Open(Options{Dir: dir, Encryptor: encryptor, Backend: "passphrase", Config: &config.Config{}})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	store.Close()
+
+	// SSH keys must not write entries into a passphrase store
+	options := Options{Dir: dir, PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true, Config: &config.Config{}}
+	if _, err := Open(options); err == nil {
+		t.Error("Expected a passphrase store to be rejected with SSH keys")
+	}
+}
+
+func TestOpenConfirm(t *testing.T) {
+	publicKey, privateKey := writeKeys(t, t.TempDir(), nil)
+	options := Options{Dir: t.TempDir(), PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true, Config: &config.Config{}}
+
+	store, err := Open(options)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := store.Put("bank", []byte("Xk9#mQ2$vL7@pR4z\nconfirm: true\n")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := store.Get("bank"); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("Expected ErrNotConfirmed without Confirm, got %v", err)
+	}
+	store.Close()
+
+	asked := ""
+	options.Confirm = func(name string) error {
+		asked = name
+		return nil
+	}
+	store, err = Open(options)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.Get("bank"); err != nil {
+		t.Errorf("Expected a confirmed entry to be returned: %v", err)
+	}
+	if asked != "bank" {
+		t.Errorf("Expected confirmation to be asked for 'bank', got '%s'", asked)
+	}
+}
+
+func TestOpenConfig(t *testing.T) {
+	publicKey, privateKey := writeKeys(t, t.TempDir(), nil)
+	cfg, err := config.LoadFile(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	options := Options{Dir: t.TempDir(), PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true, Config: cfg}
+
+	for key, value := range map[string]string{"workers": "0", "store.mode": "0644", "sign.entries": "maybe"} {
+		cfg.Set(key, value)
+		if _, err := Open(options); err == nil {
+			t.Errorf("Expected %s = %s to be rejected", key, value)
+		}
+		cfg.Unset(key)
+	}
+}
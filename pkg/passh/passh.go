@@ -0,0 +1,181 @@
+// Package passh opens passh stores from Go programs. Stores are opened with
+// the same settings and checks as the passh command, without its flags,
+// prompts or exit codes: errors are returned and nothing is read from the
+// terminal.
+//
+//	store, err := passh.Open(passh.Options{Dir: "/srv/secrets"})
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//	password, err := store.Get("db/prod")
+package passh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/config"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrNotFound is returned when an entry does not exist
+var ErrNotFound = storage.ErrNotFound
+
+// Finding is a problem found by Audit
+type Finding = storage.Finding
+
+// ErrNotConfirmed is returned by Get for entries marked "confirm: true"
+// when Options.Confirm is not set or does not confirm them
+var ErrNotConfirmed = storage.ErrNotConfirmed
+
+// Default SSH keys in ~/.ssh, tried in order when no key is given.
+// Ed25519 comes first, RSA last.
+var (
+	DefaultPrivateKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+	DefaultPublicKeys  = []string{"id_ed25519.pub", "id_ecdsa.pub", "id_rsa.pub"}
+)
+
+// Options configures Open. The zero value opens ~/.passh with the first of
+// ~/.ssh/id_ed25519, id_ecdsa and id_rsa, as the passh command does.
+type Options struct {
+	// Dir is the store directory, or an ssh:// or webdav(s):// URL
+	// (default: ~/.passh)
+	Dir string
+	// PublicKey and PrivateKey are SSH key files. Without a private key
+	// entries can be added and listed but not read.
+	PublicKey  string
+	PrivateKey string
+	// Passphrase is called for the passphrase of an encrypted private key.
+	// Without it such keys fail to load.
+	Passphrase func(path string) ([]byte, error)
+	// NoAgent stops the SSH agent from being used for the private key
+	NoAgent bool
+	// Encryptor replaces the SSH keys, for stores using another backend
+	Encryptor crypto.Encryptor
+	// IndexPath is where the encrypted listing index is kept. Without it
+	// listing decrypts every entry.
+	IndexPath string
+	// Backend names the encryption backend of Encryptor, such as gpg or
+	// passphrase. A store only opens with the backend it was set up with.
+	// (default: ssh)
+	Backend string
+	// Config holds the settings applied to the store: store.mode,
+	// store.group, webdav.*, workers and sign.entries
+	// (default: the passh config file)
+	Config *config.Config
+	// Confirm is called before Get returns an entry marked "confirm: true",
+	// and its error returned instead. Without it such entries fail with
+	// ErrNotConfirmed.
+	Confirm func(name string) error
+	// Cache serves entries before they are decrypted, such as the passh agent
+	Cache storage.Cache
+	// Actor names who makes changes in the operation log
+	Actor string
+	// NoSign ignores the sign.entries setting, for stores that are only read
+	NoSign bool
+}
+
+// Store is an open password store, which must be closed
+type Store struct {
+	store *storage.Store
+}
+
+// Open opens the store described by options
+func Open(options Options) (*Store, error) {
+	store, err := OpenStorage(options)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{store: store}, nil
+}
+
+// sshEncryptor loads the SSH keys of options
+func sshEncryptor(options Options) (*crypto.SSHEncryptor, error) {
+	encryptor, err := crypto.NewSSHEncryptor(!options.NoAgent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryptor: %w", err)
+	}
+
+	publicKey, privateKey := options.PublicKey, options.PrivateKey
+	if publicKey == "" {
+		publicKey = defaultKey(DefaultPublicKeys)
+	}
+	if privateKey == "" {
+		privateKey = defaultKey(DefaultPrivateKeys)
+	}
+	if publicKey == "" {
+		return nil, errors.New("no SSH public key found, set Options.PublicKey")
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKey); err != nil {
+		return nil, fmt.Errorf("failed to load public key: %w", err)
+	}
+	if privateKey == "" {
+		return encryptor, nil
+	}
+
+	err = encryptor.AddPrivateKeyFromFile(privateKey, nil)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && options.Passphrase != nil {
+		passphrase, perr := options.Passphrase(privateKey)
+		if perr != nil {
+			return nil, perr
+		}
+		err = encryptor.AddPrivateKeyFromFile(privateKey, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+	return encryptor, nil
+}
+
+// defaultKey returns the first of names that exists in ~/.ssh
+func defaultKey(names []string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range names {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Get returns the content of an entry, or ErrNotFound
+func (s *Store) Get(name string) ([]byte, error) {
+	return s.store.Get(name)
+}
+
+// Put adds an entry, or replaces the content of an existing one
+func (s *Store) Put(name string, content []byte) error {
+	return s.store.Add(name, content)
+}
+
+// List returns the names of all entries
+func (s *Store) List() ([]string, error) {
+	return s.store.List()
+}
+
+// Delete removes an entry
+func (s *Store) Delete(name string) error {
+	return s.store.Delete(name)
+}
+
+// Audit checks every entry for weak, reused, stale and expiring passwords,
+// as 'passh audit' does
+func (s *Store) Audit() ([]Finding, error) {
+	return s.store.Audit(time.Now().UTC())
+}
+
+// Close writes pending changes, such as the index, and closes the store
+func (s *Store) Close() error {
+	return s.store.Close()
+}
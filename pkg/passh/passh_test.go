@@ -0,0 +1,138 @@
+package passh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeKeys writes an ed25519 key pair to dir, encrypting the private key
+// if passphrase is set
+func writeKeys(t *testing.T, dir string, passphrase []byte) (string, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	var block *pem.Block
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(private, "", passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(private, "")
+	}
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+
+	privatePath := filepath.Join(dir, "id_ed25519")
+	publicPath := privatePath + ".pub"
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+	if err := os.WriteFile(publicPath, ssh.MarshalAuthorizedKey(sshPublic), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return publicPath, privatePath
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	publicKey, privateKey := writeKeys(t, t.TempDir(), nil)
+
+	store, err := Open(Options{Dir: dir, PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := store.Put("db/prod", []byte("Xk9#mQ2$vL7@pR4z")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put("short", []byte("hunter2")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Entries written through the API can be read when opened again
+	store, err = Open(Options{Dir: dir, PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+
+	password, err := store.Get("db/prod")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(password) != "Xk9#mQ2$vL7@pR4z" {
+		t.Errorf("Expected the stored password, got '%s'", password)
+	}
+	names, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(names) != 2 {
+		t.Errorf("Expected 2 entries, got %v", names)
+	}
+
+	findings, err := store.Audit()
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	weak := false
+	for _, finding := range findings {
+		if finding.Name == "short" {
+			weak = true
+		}
+	}
+	if !weak {
+		t.Errorf("Expected a finding for the short password, got %v", findings)
+	}
+
+	if err := store.Delete("short"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+}
+
+func TestOpenPassphrase(t *testing.T) {
+	publicKey, privateKey := writeKeys(t, t.TempDir(), []byte("secret"))
+
+	options := Options{Dir: t.TempDir(), PublicKey: publicKey, PrivateKey: privateKey, NoAgent: true}
+	if _, err := Open(options); err == nil {
+		t.Error("Expected an encrypted key to fail without Passphrase")
+	}
+
+	asked := ""
+	options.Passphrase = func(path string) ([]byte, error) {
+		asked = path
+		return []byte("secret"), nil
+	}
+	store, err := Open(options)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer store.Close()
+	if asked != privateKey {
+		t.Errorf("Expected the passphrase of %s to be asked for, got '%s'", privateKey, asked)
+	}
+}
+
+func TestOpenNoKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := Open(Options{Dir: t.TempDir(), NoAgent: true}); err == nil {
+		t.Error("Expected Open to fail without SSH keys")
+	}
+}
@@ -0,0 +1,202 @@
+// Package ratelimit limits how fast each client of a server may make
+// requests, and locks out clients that keep failing, such as by guessing.
+// Refused requests are counted for metrics.
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons a Limiter refuses a request
+const (
+	// ReasonRate is a client making requests faster than its limit
+	ReasonRate = "rate"
+	// ReasonBackoff is a client locked out after failing too often
+	ReasonBackoff = "backoff"
+)
+
+// Limits configure a Limiter
+type Limits struct {
+	// Burst requests can be made at once, and another every Interval
+	Burst    int
+	Interval time.Duration
+	// BackoffAfter failures in a row lock a client out for BackoffBase,
+	// doubling with each further failure up to BackoffMax
+	BackoffAfter int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+// Limiter tracks the requests and failures of each client, by a key such as
+// the one PeerKey returns. It is safe for concurrent use.
+type Limiter struct {
+	limits Limits
+
+	mu      sync.Mutex
+	clients map[string]*client
+	// refused counts refused requests by reason
+	refused map[string]uint64
+}
+
+// client is what the limiter tracks about one client
+type client struct {
+	// tokens are the requests the client can make now, refilled over time
+	tokens  float64
+	updated time.Time
+	// failures counts failed requests since the last successful one
+	failures    int
+	lockedUntil time.Time
+}
+
+// New returns a limiter that applies limits to each client
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		clients: make(map[string]*client),
+		refused: make(map[string]uint64),
+	}
+}
+
+// Allow takes a request from the client's budget. When the request is
+// refused, Allow counts it and returns why and how long until the client may
+// retry.
+func (l *Limiter) Allow(key string) (string, time.Duration) {
+	return l.allow(key, time.Now())
+}
+
+func (l *Limiter) allow(key string, now time.Time) (string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	c := l.client(key, now)
+	if now.Before(c.lockedUntil) {
+		l.refused[ReasonBackoff]++
+		return ReasonBackoff, c.lockedUntil.Sub(now)
+	}
+	c.tokens = l.refill(c, now)
+	c.updated = now
+	if c.tokens < 1 {
+		l.refused[ReasonRate]++
+		return ReasonRate, time.Duration((1 - c.tokens) * float64(l.limits.Interval))
+	}
+	c.tokens--
+	return "", 0
+}
+
+// Fail records a failed request, locking the client out for longer the more
+// it fails in a row
+func (l *Limiter) Fail(key string) {
+	l.fail(key, time.Now())
+}
+
+func (l *Limiter) fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.client(key, now)
+	c.failures++
+	if c.failures < l.limits.BackoffAfter {
+		return
+	}
+	backoff := l.limits.BackoffMax
+	if shift := c.failures - l.limits.BackoffAfter; shift < 20 {
+		backoff = min(l.limits.BackoffBase<<shift, l.limits.BackoffMax)
+	}
+	c.lockedUntil = now.Add(backoff)
+}
+
+// Succeed ends the client's run of failures
+func (l *Limiter) Succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[key]; ok {
+		c.failures = 0
+	}
+}
+
+// Refuse counts a request the caller refused for a reason of its own, such
+// as a quota
+func (l *Limiter) Refuse(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refused[reason]++
+}
+
+// Refused returns how many requests were refused, by reason
+func (l *Limiter) Refused() map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	refused := make(map[string]uint64, len(l.refused))
+	for reason, count := range l.refused {
+		refused[reason] = count
+	}
+	return refused
+}
+
+// Clients returns how many clients the limiter currently tracks
+func (l *Limiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.clients)
+}
+
+// client returns the client with key, adding it if it is new. The caller
+// holds l.mu.
+func (l *Limiter) client(key string, now time.Time) *client {
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{tokens: float64(l.limits.Burst), updated: now}
+		l.clients[key] = c
+	}
+	return c
+}
+
+// refill returns the client's tokens at now, up to the burst
+func (l *Limiter) refill(c *client, now time.Time) float64 {
+	return min(c.tokens+float64(now.Sub(c.updated))/float64(l.limits.Interval), float64(l.limits.Burst))
+}
+
+// prune forgets clients that are back to a full budget with no failures,
+// since a new client starts out the same. The caller holds l.mu.
+func (l *Limiter) prune(now time.Time) {
+	for key, c := range l.clients {
+		if c.failures == 0 && !now.Before(c.lockedUntil) && l.refill(c, now) >= float64(l.limits.Burst) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// PeerKey identifies the client of a request by its address. IPv6 clients
+// are grouped by /64, the smallest network usually given to one host. With
+// behindProxy the client is the address the proxy added to X-Forwarded-For,
+// so only set it when every request comes through the proxy, as clients
+// could pick their address otherwise.
+func PeerKey(r *http.Request, behindProxy bool) string {
+	address := r.RemoteAddr
+	if behindProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			address = strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return address
+	}
+	ip = ip.Unmap()
+	if ip.Is6() {
+		prefix, _ := ip.Prefix(64)
+		return prefix.String()
+	}
+	return ip.String()
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testLimits = Limits{
+	Burst:        3,
+	Interval:     time.Second,
+	BackoffAfter: 2,
+	BackoffBase:  time.Second,
+	BackoffMax:   time.Minute,
+}
+
+func TestAllowRate(t *testing.T) {
+	limiter := New(testLimits)
+	now := time.Now()
+
+	for i := 0; i < testLimits.Burst; i++ {
+		if reason, _ := limiter.allow("a", now); reason != "" {
+			t.Fatalf("Expected request %d to be allowed, got %s", i, reason)
+		}
+	}
+	if reason, retry := limiter.allow("a", now); reason != ReasonRate || retry != time.Second {
+		t.Errorf("Expected a client over the rate to retry in a second, got %s %s", reason, retry)
+	}
+	if reason, _ := limiter.allow("b", now); reason != "" {
+		t.Errorf("Expected another client to be allowed, got %s", reason)
+	}
+	if reason, _ := limiter.allow("a", now.Add(time.Second)); reason != "" {
+		t.Errorf("Expected the budget to refill, got %s", reason)
+	}
+	if refused := limiter.Refused(); refused[ReasonRate] != 1 {
+		t.Errorf("Expected 1 refusal for rate, got %v", refused)
+	}
+}
+
+func TestFailBackoff(t *testing.T) {
+	limiter := New(testLimits)
+	now := time.Now()
+
+	limiter.fail("a", now)
+	if reason, _ := limiter.allow("a", now); reason != "" {
+		t.Fatalf("Expected a failure to be allowed, got %s", reason)
+	}
+
+	limiter.fail("a", now)
+	if reason, retry := limiter.allow("a", now); reason != ReasonBackoff || retry != testLimits.BackoffBase {
+		t.Fatalf("Expected a lockout of %s, got %s %s", testLimits.BackoffBase, reason, retry)
+	}
+	limiter.fail("a", now)
+	if _, retry := limiter.allow("a", now); retry != 2*testLimits.BackoffBase {
+		t.Errorf("Expected the lockout to double, got %s", retry)
+	}
+	for i := 0; i < 100; i++ {
+		limiter.fail("a", now)
+	}
+	if _, retry := limiter.allow("a", now); retry != testLimits.BackoffMax {
+		t.Errorf("Expected the lockout to be capped at %s, got %s", testLimits.BackoffMax, retry)
+	}
+	if reason, _ := limiter.allow("a", now.Add(testLimits.BackoffMax)); reason != "" {
+		t.Errorf("Expected the lockout to end, got %s", reason)
+	}
+
+	limiter.Succeed("a")
+	limiter.fail("a", now.Add(testLimits.BackoffMax))
+	if reason, _ := limiter.allow("a", now.Add(testLimits.BackoffMax)); reason != "" {
+		t.Errorf("Expected a success to end the run of failures, got %s", reason)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	limiter := New(testLimits)
+	now := time.Now()
+	limiter.allow("a", now)
+	limiter.fail("b", now)
+
+	limiter.allow("c", now.Add(time.Hour))
+	if clients := limiter.Clients(); clients != 2 {
+		t.Errorf("Expected the idle client to be forgotten, got %d clients", clients)
+	}
+}
+
+func TestPeerKey(t *testing.T) {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Forwarded-For", "198.51.100.7, 203.0.113.9")
+
+	for addr, expected := range map[string]string{
+		"192.0.2.1:1234":                "192.0.2.1",
+		"[::ffff:192.0.2.1]:1234":       "192.0.2.1",
+		"[2001:db8:1:2:3:4:5:6]:1234":   "2001:db8:1:2::/64",
+		"[2001:db8:1:2:ffff:4:5:6]:443": "2001:db8:1:2::/64",
+		"[2001:db8:1:3:3:4:5:6]:1234":   "2001:db8:1:3::/64",
+	} {
+		request.RemoteAddr = addr
+		if key := PeerKey(request, false); key != expected {
+			t.Errorf("Expected %s to be peer %s, got %s", addr, expected, key)
+		}
+	}
+
+	// Only the address the proxy added counts, not ones the client sent
+	if key := PeerKey(request, true); key != "203.0.113.9" {
+		t.Errorf("Expected the forwarded peer, got %s", key)
+	}
+}
@@ -0,0 +1,155 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// ErrGone is returned when a link was already viewed or has expired
+var ErrGone = errors.New("the secret was already viewed or has expired")
+
+// client talks to relays
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Share encrypts a secret with a new random key, uploads it to the relay at
+// relayURL for ttl, and returns the one-time link and when it expires. The
+// key is only part of the link's fragment.
+func Share(relayURL string, plaintext []byte, ttl time.Duration) (string, time.Time, error) {
+	base, err := url.Parse(strings.TrimSuffix(relayURL, "/"))
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return "", time.Time{}, fmt.Errorf("invalid relay URL '%s'", relayURL)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate a key: %w", err)
+	}
+	defer secure.Wipe(key)
+	sealed, err := seal(key, plaintext)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(sealed) > MaxSecretSize {
+		return "", time.Time{}, fmt.Errorf("the entry is too large to share by link, at most %d bytes", MaxSecretSize-sealOverhead)
+	}
+
+	body, err := json.Marshal(uploadRequest{Data: sealed, TTL: int(ttl / time.Second)})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var uploaded uploadResponse
+	if err := call(base.String()+"/api/secrets", body, http.StatusCreated, &uploaded); err != nil {
+		return "", time.Time{}, err
+	}
+
+	link := base.String() + "/s/" + uploaded.ID + "#" + base64.RawURLEncoding.EncodeToString(key)
+	return link, uploaded.Expires, nil
+}
+
+// Open fetches the secret behind a one-time link and decrypts it. The relay
+// deletes it, so the link can't be opened again.
+func Open(link string) ([]byte, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link: %w", err)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(parsed.Fragment)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid link: it doesn't end with the key after #")
+	}
+	defer secure.Wipe(key)
+	dir, id, found := strings.Cut(parsed.Path, "/s/")
+	if !found || id == "" || strings.Contains(id, "/") {
+		return nil, errors.New("invalid link: expected RELAY/s/ID#KEY")
+	}
+
+	base := url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: dir}
+	var fetched fetchResponse
+	if err := call(base.String()+"/api/secrets/"+id, nil, http.StatusOK, &fetched); err != nil {
+		return nil, err
+	}
+	return unseal(key, fetched.Data)
+}
+
+// call posts a request to the relay and decodes its response
+func call(endpoint string, body []byte, expected int, response any) error {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach the relay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 2*MaxSecretSize))
+	if err != nil {
+		return fmt.Errorf("failed to reach the relay: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && body == nil {
+		return ErrGone
+	}
+	if resp.StatusCode != expected {
+		var failure errorResponse
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("relay: %s", failure.Error)
+		}
+		return fmt.Errorf("relay: %s", resp.Status)
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("invalid relay response: %w", err)
+	}
+	return nil
+}
+
+// sealOverhead is what sealing adds to a secret: the nonce and the tag
+const sealOverhead = 12 + 16
+
+// seal encrypts with AES-256-GCM, which browsers can decrypt with WebCrypto,
+// prefixing the nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate a nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// unseal decrypts what seal encrypted
+func unseal(key, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("the shared secret is corrupted")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("the shared secret is corrupted or the link's key is wrong")
+	}
+	return plaintext, nil
+}
+
+// newGCM returns AES-256-GCM with the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/ratelimit"
+)
+
+// peerSecrets bounds how many secrets one peer holds at once, so that one
+// client can't fill the relay for everyone else
+const peerSecrets = 100
+
+// peerLimits let a peer make a burst of requests and then one a second, and
+// lock it out after fetching several links in a row that are gone, so that
+// no one can guess the ids of other people's secrets
+var peerLimits = ratelimit.Limits{
+	Burst:        20,
+	Interval:     time.Second,
+	BackoffAfter: 5,
+	BackoffBase:  time.Second,
+	BackoffMax:   15 * time.Minute,
+}
+
+// Reasons of the relay's own for refusing a request, as counted in the
+// metrics along with the limiter's
+const (
+	refusedQuota = "quota"
+	refusedFull  = "full"
+)
+
+// refuse answers a refused request with 429 or, when the relay is full, 503
+func (s *Server) refuse(w http.ResponseWriter, reason string, retry time.Duration) {
+	status, message := http.StatusTooManyRequests, "too many requests, try again later"
+	switch reason {
+	case refusedQuota:
+		message = "you hold too many secrets on this relay"
+	case ratelimit.ReasonBackoff:
+		message = "too many links that were already viewed or have expired, try again later"
+	case refusedFull:
+		status, message = http.StatusServiceUnavailable, "the relay holds too many secrets"
+	}
+	if retry > 0 {
+		// Retry-After is in whole seconds, rounded up
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((retry+time.Second-1)/time.Second), 10))
+	}
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+// peerKey identifies the client of a request, by the address the proxy
+// forwarded when the relay is behind one
+func (s *Server) peerKey(r *http.Request) string {
+	return ratelimit.PeerKey(r, s.behindProxy)
+}
@@ -0,0 +1,33 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// MetricsHandler serves the relay's counters in the Prometheus text format.
+// They tell how much the relay holds and refuses, never what it holds.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refused := s.limiter.Refused()
+		reasons := make([]string, 0, len(refused))
+		for reason := range refused {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		s.mu.Lock()
+		secrets := len(s.secrets)
+		s.mu.Unlock()
+		peers := s.limiter.Clients()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP passh_relay_refused_total Requests refused by the relay, by reason: rate, quota, backoff or full.")
+		fmt.Fprintln(w, "# TYPE passh_relay_refused_total counter")
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "passh_relay_refused_total{reason=%q} %d\n", reason, refused[reason])
+		}
+		fmt.Fprintf(w, "# HELP passh_relay_secrets Secrets currently held.\n# TYPE passh_relay_secrets gauge\npassh_relay_secrets %d\n", secrets)
+		fmt.Fprintf(w, "# HELP passh_relay_peers Clients currently tracked for rate limits.\n# TYPE passh_relay_peers gauge\npassh_relay_peers %d\n", peers)
+	})
+}
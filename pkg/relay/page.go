@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"net/http"
+)
+
+// page opens a link in a browser. The secret is only fetched, and so burned,
+// when the reader asks for it, so link previews in chat apps don't use it up.
+// It is decrypted in the browser with the key in the fragment.
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>Shared secret</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 3em auto; padding: 0 1em; }
+pre { white-space: pre-wrap; word-break: break-all; background: #f4f4f4; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>Shared secret</h1>
+<p id="status">Someone shared a secret with you. It can only be viewed once.</p>
+<button id="reveal">Reveal</button>
+<pre id="secret" hidden></pre>
+<script>
+const status = document.getElementById("status");
+const button = document.getElementById("reveal");
+button.addEventListener("click", async () => {
+  button.disabled = true;
+  try {
+    const raw = location.hash.slice(1).replace(/-/g, "+").replace(/_/g, "/");
+    const keyBytes = Uint8Array.from(atob(raw), c => c.charCodeAt(0));
+    const id = location.pathname.split("/").pop();
+    const base = location.pathname.slice(0, location.pathname.lastIndexOf("/s/"));
+    const response = await fetch(base + "/api/secrets/" + encodeURIComponent(id), { method: "POST" });
+    const body = await response.json();
+    if (!response.ok) { throw new Error(body.error || response.statusText); }
+    const data = Uint8Array.from(atob(body.data), c => c.charCodeAt(0));
+    const key = await crypto.subtle.importKey("raw", keyBytes, "AES-GCM", false, ["decrypt"]);
+    const plain = await crypto.subtle.decrypt({ name: "AES-GCM", iv: data.slice(0, 12) }, key, data.slice(12));
+    const secret = document.getElementById("secret");
+    secret.textContent = new TextDecoder().decode(plain);
+    secret.hidden = false;
+    status.textContent = "This secret has now been deleted from the relay. Save it somewhere safe.";
+    button.hidden = true;
+  } catch (err) {
+    status.textContent = "Could not open the secret: " + err.message;
+  }
+});
+</script>
+</body>
+</html>
+`
+
+// servePage serves the page that opens a link
+func servePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write([]byte(page))
+}
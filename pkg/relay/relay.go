@@ -0,0 +1,210 @@
+// Package relay passes one-time secrets to people who don't use passh. The
+// secret is encrypted with a random key before it is uploaded, and the key
+// only travels in the fragment of the link, which browsers never send to the
+// server. The relay deletes a secret when it is first fetched or expires.
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/ratelimit"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+const (
+	// MaxSecretSize bounds an uploaded secret, encrypted
+	MaxSecretSize = 64 << 10
+	// maxSecrets bounds how many secrets the relay holds at once
+	maxSecrets = 10000
+)
+
+// uploadRequest stores a secret for ttl seconds
+type uploadRequest struct {
+	Data []byte `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+// uploadResponse identifies a stored secret
+type uploadResponse struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// fetchResponse returns a secret, which is then deleted
+type fetchResponse struct {
+	Data []byte `json:"data"`
+}
+
+// errorResponse describes a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server holds encrypted secrets in memory until they are fetched once or
+// expire. Restarting it loses them. Each client is rate limited, holds a
+// limited number of secrets and is locked out for a while after fetching
+// several unknown ones.
+type Server struct {
+	maxTTL      time.Duration
+	behindProxy bool
+	limiter     *ratelimit.Limiter
+
+	mu      sync.Mutex
+	secrets map[string]secret
+	// held counts the secrets each peer holds
+	held map[string]int
+}
+
+// secret is an encrypted secret, when it expires and the peer that stored it
+type secret struct {
+	data    []byte
+	expires time.Time
+	owner   string
+}
+
+// NewServer returns a relay keeping secrets for at most maxTTL
+func NewServer(maxTTL time.Duration) *Server {
+	return &Server{
+		maxTTL:  maxTTL,
+		limiter: ratelimit.New(peerLimits),
+		secrets: make(map[string]secret),
+		held:    make(map[string]int),
+	}
+}
+
+// SetBehindProxy tells the relay it is served through a reverse proxy, so
+// clients are told apart by the address the proxy adds to X-Forwarded-For
+// rather than by the proxy's own. Only set it when every request comes
+// through the proxy, as clients could pick their address otherwise.
+func (s *Server) SetBehindProxy(behindProxy bool) {
+	s.behindProxy = behindProxy
+}
+
+// Handler serves the relay's API and the page that opens links in a browser
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/secrets", s.upload)
+	mux.HandleFunc("POST /api/secrets/{id}", s.fetch)
+	mux.HandleFunc("GET /s/{id}", servePage)
+	return mux
+}
+
+// upload stores a secret
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	var request uploadRequest
+	// Base64 and JSON make the request about a third larger than the secret
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*MaxSecretSize)).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request"})
+		return
+	}
+	if len(request.Data) == 0 || len(request.Data) > MaxSecretSize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: fmt.Sprintf("secrets must hold 1 to %d bytes", MaxSecretSize)})
+		return
+	}
+	ttl := time.Duration(request.TTL) * time.Second
+	if ttl <= 0 || ttl > s.maxTTL {
+		ttl = s.maxTTL
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to generate an id"})
+		return
+	}
+	now := time.Now()
+	stored := secret{data: request.Data, expires: now.Add(ttl).UTC().Truncate(time.Second), owner: s.peerKey(r)}
+	key := base64.RawURLEncoding.EncodeToString(id)
+	if refused, retry := s.limiter.Allow(stored.owner); refused != "" {
+		s.refuse(w, refused, retry)
+		return
+	}
+
+	s.mu.Lock()
+	s.purge(now)
+	var refused string
+	switch {
+	case s.held[stored.owner] >= peerSecrets:
+		refused = refusedQuota
+	case len(s.secrets) >= maxSecrets:
+		refused = refusedFull
+	default:
+		s.secrets[key] = stored
+		s.held[stored.owner]++
+	}
+	s.mu.Unlock()
+	if refused != "" {
+		s.limiter.Refuse(refused)
+		s.refuse(w, refused, 0)
+		return
+	}
+
+	logging.Debugf("relay stored a secret of %d bytes until %s", len(stored.data), stored.expires)
+	writeJSON(w, http.StatusCreated, uploadResponse{ID: key, Expires: stored.expires})
+}
+
+// fetch returns a secret and deletes it
+func (s *Server) fetch(w http.ResponseWriter, r *http.Request) {
+	key := s.peerKey(r)
+	if refused, retry := s.limiter.Allow(key); refused != "" {
+		s.refuse(w, refused, retry)
+		return
+	}
+
+	s.mu.Lock()
+	s.purge(time.Now())
+	stored, found := s.secrets[r.PathValue("id")]
+	s.remove(r.PathValue("id"))
+	s.mu.Unlock()
+
+	// Fetching links that are gone, over and over, is guessing
+	if found {
+		s.limiter.Succeed(key)
+	} else {
+		s.limiter.Fail(key)
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "this secret was already viewed or has expired"})
+		return
+	}
+	defer secure.Wipe(stored.data)
+	writeJSON(w, http.StatusOK, fetchResponse{Data: stored.data})
+}
+
+// purge deletes expired secrets. The caller holds s.mu.
+func (s *Server) purge(now time.Time) {
+	for id, stored := range s.secrets {
+		if !now.Before(stored.expires) {
+			secure.Wipe(stored.data)
+			s.remove(id)
+		}
+	}
+}
+
+// remove deletes a secret without wiping it, and frees its place in its
+// owner's quota. The caller holds s.mu.
+func (s *Server) remove(id string) {
+	stored, ok := s.secrets[id]
+	if !ok {
+		return
+	}
+	delete(s.secrets, id)
+	if s.held[stored.owner]--; s.held[stored.owner] <= 0 {
+		delete(s.held, stored.owner)
+	}
+}
+
+// writeJSON writes a JSON response that no cache may keep
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/ratelimit"
+)
+
+// startRelay runs a relay on a test server
+func startRelay(t *testing.T, maxTTL time.Duration) (*Server, string) {
+	t.Helper()
+	server := NewServer(maxTTL)
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+	return server, httpServer.URL
+}
+
+func TestShareOnce(t *testing.T) {
+	_, url := startRelay(t, time.Hour)
+
+	link, expires, err := Share(url, []byte("hunter2"), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+	if !strings.HasPrefix(link, url+"/s/") || !strings.Contains(link, "#") {
+		t.Fatalf("Unexpected link %s", link)
+	}
+	if until := time.Until(expires); until <= 9*time.Minute || until > 10*time.Minute {
+		t.Errorf("Expected the secret to expire in 10 minutes, got %s", expires)
+	}
+
+	secret, err := Open(link)
+	if err != nil || string(secret) != "hunter2" {
+		t.Fatalf("Expected the secret, got %q err=%v", secret, err)
+	}
+	if _, err := Open(link); !errors.Is(err, ErrGone) {
+		t.Fatalf("Expected a second view to fail with ErrGone, got %v", err)
+	}
+}
+
+func TestShareWrongKey(t *testing.T) {
+	_, url := startRelay(t, time.Hour)
+
+	link, _, err := Share(url, []byte("hunter2"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := Share(url, []byte("other"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _, _ := strings.Cut(link, "#")
+	_, key, _ := strings.Cut(other, "#")
+	if _, err := Open(base + "#" + key); err == nil {
+		t.Fatal("Expected the wrong key to fail")
+	}
+	if _, err := Open(base); err == nil {
+		t.Fatal("Expected a link without a key to fail")
+	}
+}
+
+func TestShareExpiry(t *testing.T) {
+	server, url := startRelay(t, time.Hour)
+
+	link, expires, err := Share(url, []byte("hunter2"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) > time.Hour {
+		t.Errorf("Expected the TTL to be capped at an hour, got %s", expires)
+	}
+
+	server.mu.Lock()
+	server.purge(time.Now().Add(2 * time.Hour))
+	server.mu.Unlock()
+	if _, err := Open(link); !errors.Is(err, ErrGone) {
+		t.Fatalf("Expected an expired secret to be gone, got %v", err)
+	}
+}
+
+func TestShareTooLarge(t *testing.T) {
+	_, url := startRelay(t, time.Hour)
+
+	if _, _, err := Share(url, make([]byte, MaxSecretSize), time.Minute); err == nil {
+		t.Fatal("Expected a secret over the size limit to fail")
+	}
+	if _, _, err := Share("ftp://example.com", []byte("x"), time.Minute); err == nil {
+		t.Fatal("Expected an invalid relay URL to fail")
+	}
+}
+
+// upload stores a secret from addr and returns the response
+func upload(server *Server, addr string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"data":"c2VjcmV0","ttl":60}`))
+	request.RemoteAddr = addr
+	response := httptest.NewRecorder()
+	server.Handler().ServeHTTP(response, request)
+	return response
+}
+
+// fetch fetches the secret with id from addr and returns the response
+func fetch(server *Server, addr, id string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/api/secrets/"+id, nil)
+	request.RemoteAddr = addr
+	response := httptest.NewRecorder()
+	server.Handler().ServeHTTP(response, request)
+	return response
+}
+
+func TestPeerQuota(t *testing.T) {
+	server := NewServer(time.Hour)
+	// Stay under the rate limit, which isn't tested here
+	limits := peerLimits
+	limits.Burst = 2 * peerSecrets
+	server.limiter = ratelimit.New(limits)
+
+	for i := 0; i < peerSecrets; i++ {
+		if response := upload(server, "192.0.2.1:1234"); response.Code != http.StatusCreated {
+			t.Fatalf("Upload %d failed with %d", i, response.Code)
+		}
+	}
+	if response := upload(server, "192.0.2.1:1234"); response.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a peer over its quota to be refused, got %d", response.Code)
+	}
+	if response := upload(server, "192.0.2.2:1234"); response.Code != http.StatusCreated {
+		t.Errorf("Expected another peer to still upload, got %d", response.Code)
+	}
+	if refused := server.limiter.Refused(); refused[refusedQuota] != 1 {
+		t.Errorf("Expected 1 refusal for quota, got %v", refused)
+	}
+}
+
+func TestPeerRate(t *testing.T) {
+	server := NewServer(time.Hour)
+
+	for i := 0; i < peerLimits.Burst; i++ {
+		upload(server, "192.0.2.1:1234")
+	}
+	response := upload(server, "192.0.2.1:1234")
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected a peer over the rate to retry in a second, got %d %q", response.Code, response.Header().Get("Retry-After"))
+	}
+}
+
+func TestPeerBackoff(t *testing.T) {
+	server := NewServer(time.Hour)
+	id := upload(server, "192.0.2.2:1234")
+
+	for i := 0; i < peerLimits.BackoffAfter; i++ {
+		if response := fetch(server, "192.0.2.1:1234", "unknown"+strconv.Itoa(i)); response.Code != http.StatusNotFound {
+			t.Fatalf("Expected an unknown secret to be missing, got %d", response.Code)
+		}
+	}
+	var uploaded uploadResponse
+	if err := json.NewDecoder(id.Body).Decode(&uploaded); err != nil {
+		t.Fatalf("Failed to decode the upload: %v", err)
+	}
+	if response := fetch(server, "192.0.2.1:1234", uploaded.ID); response.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a peer guessing links to be locked out, got %d", response.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := NewServer(time.Hour)
+	for i := 0; i < peerLimits.BackoffAfter+1; i++ {
+		fetch(server, "192.0.2.1:1234", "unknown")
+	}
+	upload(server, "192.0.2.2:1234")
+
+	response := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(response, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{`passh_relay_refused_total{reason="backoff"} 1`, "passh_relay_secrets 1"} {
+		if !strings.Contains(response.Body.String(), line+"\n") {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, response.Body.String())
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package scan finds known secrets in text, such as passwords from the store
+// committed to a repository, without keeping the secrets themselves.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"sort"
+)
+
+// DefaultMinLength is the length below which secrets are not looked for,
+// since they would match ordinary text
+const DefaultMinLength = 8
+
+// base is the multiplier of the rolling hash, which wraps around at 2^64
+const base = 1099511628211
+
+// target is a secret being looked for
+type target struct {
+	digest [sha256.Size]byte
+	name   string
+}
+
+// Scanner looks for a set of secrets in streams of text. Of each secret it
+// only keeps the length, a rolling hash to find candidates quickly and a
+// SHA-256 digest to confirm them.
+type Scanner struct {
+	minLength int
+	// targets holds the secrets by length, then by rolling hash
+	targets map[int]map[uint64][]target
+	lengths []int
+	// powers holds base^(length-1) for each length, to roll bytes out
+	powers map[int]uint64
+	count  int
+}
+
+// Match is a place where a secret was found
+type Match struct {
+	// Name is the name the secret was added under
+	Name   string
+	Path   string
+	Line   int
+	Column int
+}
+
+// New returns a scanner ignoring secrets shorter than minLength
+func New(minLength int) *Scanner {
+	return &Scanner{
+		minLength: minLength,
+		targets:   make(map[int]map[uint64][]target),
+		powers:    make(map[int]uint64),
+	}
+}
+
+// Add looks for secret, reporting it under name. Secrets that are too short
+// or span several lines are ignored; Add reports whether it was added.
+func (s *Scanner) Add(name string, secret []byte) bool {
+	if len(secret) < s.minLength || bytes.ContainsAny(secret, "\r\n") {
+		return false
+	}
+
+	length := len(secret)
+	if s.targets[length] == nil {
+		s.targets[length] = make(map[uint64][]target)
+		s.lengths = append(s.lengths, length)
+		sort.Ints(s.lengths)
+		power := uint64(1)
+		for i := 1; i < length; i++ {
+			power *= base
+		}
+		s.powers[length] = power
+	}
+
+	var hash uint64
+	for _, c := range secret {
+		hash = hash*base + uint64(c)
+	}
+	s.targets[length][hash] = append(s.targets[length][hash], target{digest: sha256.Sum256(secret), name: name})
+	s.count++
+	return true
+}
+
+// Len returns the number of secrets looked for
+func (s *Scanner) Len() int {
+	return s.count
+}
+
+// Scan reads r to the end and calls fn for every secret found in it, with
+// path as the match's path
+func (s *Scanner) Scan(r io.Reader, path string, fn func(Match)) error {
+	if len(s.lengths) == 0 {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+
+	// The window holds the last maxLength bytes read
+	maxLength := s.lengths[len(s.lengths)-1]
+	window := make([]byte, maxLength)
+	defer clear(window)
+	hashes := make([]uint64, len(s.lengths))
+	candidate := make([]byte, maxLength)
+	defer clear(candidate)
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	line, column := 1, 0
+	for n := 0; ; n++ {
+		c, err := reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		column++
+
+		for i, length := range s.lengths {
+			if n >= length {
+				out := window[(n-length)%maxLength]
+				hashes[i] -= uint64(out) * s.powers[length]
+			}
+			hashes[i] = hashes[i]*base + uint64(c)
+		}
+		window[n%maxLength] = c
+
+		for i, length := range s.lengths {
+			if n+1 < length {
+				break
+			}
+			targets, ok := s.targets[length][hashes[i]]
+			if !ok {
+				continue
+			}
+			for j := 0; j < length; j++ {
+				candidate[j] = window[(n-length+1+j)%maxLength]
+			}
+			digest := sha256.Sum256(candidate[:length])
+			for _, t := range targets {
+				if subtle.ConstantTimeCompare(digest[:], t.digest[:]) == 1 {
+					fn(Match{Name: t.name, Path: path, Line: line, Column: column - length + 1})
+				}
+			}
+		}
+
+		if c == '\n' {
+			line, column = line+1, 0
+		}
+	}
+}
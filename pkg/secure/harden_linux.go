@@ -0,0 +1,27 @@
+package secure
+
+import "syscall"
+
+// prSetDumpable is PR_SET_DUMPABLE from linux/prctl.h
+const prSetDumpable = 4
+
+// DisableCoreDumps keeps decrypted secrets out of core files: the core size
+// limit is set to zero, and the process is marked non-dumpable, which also
+// stops other processes of the same user from attaching with ptrace or
+// reading its memory through /proc.
+func DisableCoreDumps() error {
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return err
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetDumpable, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// LockAll locks all current and future memory of the process into RAM, so
+// nothing is written to swap. It needs a memlock limit (ulimit -l) large
+// enough for the whole process, or CAP_IPC_LOCK.
+func LockAll() error {
+	return syscall.Mlockall(syscall.MCL_CURRENT | syscall.MCL_FUTURE)
+}
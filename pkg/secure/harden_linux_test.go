@@ -0,0 +1,31 @@
+package secure
+
+import (
+	"syscall"
+	"testing"
+)
+
+// prGetDumpable is PR_GET_DUMPABLE from linux/prctl.h
+const prGetDumpable = 3
+
+func TestDisableCoreDumps(t *testing.T) {
+	if err := DisableCoreDumps(); err != nil {
+		t.Fatalf("DisableCoreDumps failed: %v", err)
+	}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &limit); err != nil {
+		t.Fatalf("Getrlimit failed: %v", err)
+	}
+	if limit.Cur != 0 || limit.Max != 0 {
+		t.Errorf("Expected a core size limit of 0, got %d/%d", limit.Cur, limit.Max)
+	}
+
+	dumpable, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prGetDumpable, 0, 0)
+	if errno != 0 {
+		t.Fatalf("prctl failed: %v", errno)
+	}
+	if dumpable != 0 {
+		t.Errorf("Expected the process to be non-dumpable, got %d", dumpable)
+	}
+}
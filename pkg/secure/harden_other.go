@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd)
+
+package secure
+
+import "errors"
+
+// DisableCoreDumps does nothing on this platform
+func DisableCoreDumps() error {
+	return nil
+}
+
+// LockAll is not supported on this platform
+func LockAll() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build darwin || freebsd || openbsd || netbsd
+
+package secure
+
+import (
+	"errors"
+	"syscall"
+)
+
+// DisableCoreDumps keeps decrypted secrets out of core files by setting the
+// core size limit to zero
+func DisableCoreDumps() error {
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{})
+}
+
+// LockAll is not supported on this platform; secrets are still locked
+// buffer by buffer where possible
+func LockAll() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin)
+
+package secure
+
+// lock is not supported on this platform; secrets are still wiped after use
+func lock(buf []byte) bool {
+	return false
+}
+
+// unlock is not supported on this platform
+func unlock(buf []byte) {}
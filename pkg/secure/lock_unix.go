@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package secure
+
+import "syscall"
+
+// lock keeps a buffer out of swap. It is best effort: locking fails when
+// RLIMIT_MEMLOCK is exhausted, and the secret is still wiped after use.
+func lock(buf []byte) bool {
+	if len(buf) == 0 {
+		return false
+	}
+	return syscall.Mlock(buf) == nil
+}
+
+// unlock releases a locked buffer
+func unlock(buf []byte) {
+	syscall.Munlock(buf)
+}
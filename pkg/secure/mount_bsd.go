@@ -0,0 +1,34 @@
+//go:build darwin || freebsd
+
+package secure
+
+import "syscall"
+
+// networkFilesystems are the names of network file systems as reported by
+// statfs
+var networkFilesystems = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+}
+
+// NetworkFilesystem returns the type of the file system holding path if it
+// is a network file system, or "" for local ones
+func NetworkFilesystem(path string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", err
+	}
+	name := make([]byte, 0, len(stat.Fstypename))
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	if networkFilesystems[string(name)] {
+		return string(name), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,25 @@
+package secure
+
+import "syscall"
+
+// networkFilesystems maps the statfs magic numbers of network file systems,
+// from linux/magic.h, to their names
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x5346414f: "afs",
+	0x00c36400: "ceph",
+	0x01021997: "9p",
+}
+
+// NetworkFilesystem returns the type of the file system holding path if it
+// is a network file system, or "" for local ones
+func NetworkFilesystem(path string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", err
+	}
+	return networkFilesystems[uint32(stat.Type)], nil
+}
@@ -0,0 +1,71 @@
+// Package secure keeps secrets in memory that is wiped after use and, where
+// the platform allows, locked so it is never written to swap.
+package secure
+
+// Wipe overwrites a buffer holding a secret with zeros
+func Wipe(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// Buffer holds a secret such as a password or key. Its memory is locked
+// into RAM where possible and wiped by Destroy. Use Bytes to read or fill
+// it, and avoid converting it to a string, which makes a copy that can't be
+// wiped.
+type Buffer struct {
+	data   []byte
+	locked bool
+}
+
+// New allocates a buffer of the given size, filled with zeros
+func New(size int) *Buffer {
+	b := &Buffer{data: make([]byte, size)}
+	b.locked = lock(b.data)
+	return b
+}
+
+// Copy returns a buffer holding a copy of secret. The caller still has to
+// wipe secret.
+func Copy(secret []byte) *Buffer {
+	b := New(len(secret))
+	copy(b.data, secret)
+	return b
+}
+
+// Take wraps secret without copying it, so Destroy wipes it. The caller must
+// not use secret after Destroy.
+func Take(secret []byte) *Buffer {
+	b := &Buffer{data: secret}
+	b.locked = lock(b.data)
+	return b
+}
+
+// Bytes returns the secret. It is only valid until Destroy.
+func (b *Buffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Len returns the length of the secret
+func (b *Buffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.data)
+}
+
+// Destroy wipes and unlocks the buffer. It is safe to call more than once.
+func (b *Buffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+	Wipe(b.data)
+	if b.locked {
+		unlock(b.data)
+	}
+	b.data = nil
+	b.locked = false
+}
@@ -0,0 +1,41 @@
+package secure
+
+import "testing"
+
+func TestBufferDestroyWipes(t *testing.T) {
+	secret := []byte("hunter2")
+	b := Take(secret)
+	if string(b.Bytes()) != "hunter2" || b.Len() != 7 {
+		t.Fatalf("Unexpected buffer content %q", b.Bytes())
+	}
+
+	b.Destroy()
+	for _, c := range secret {
+		if c != 0 {
+			t.Fatalf("Expected the secret to be wiped, got %q", secret)
+		}
+	}
+	if b.Bytes() != nil || b.Len() != 0 {
+		t.Error("Expected an empty buffer after Destroy")
+	}
+	b.Destroy()
+}
+
+func TestCopy(t *testing.T) {
+	secret := []byte("hunter2")
+	b := Copy(secret)
+	defer b.Destroy()
+
+	secret[0] = 'H'
+	if string(b.Bytes()) != "hunter2" {
+		t.Errorf("Expected an independent copy, got %q", b.Bytes())
+	}
+}
+
+func TestNilBuffer(t *testing.T) {
+	var b *Buffer
+	if b.Bytes() != nil || b.Len() != 0 {
+		t.Error("Expected a nil buffer to be empty")
+	}
+	b.Destroy()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+)
+
+// AccessLog records how often and when entries were last read. It is kept
+// outside the store, so reading an entry never modifies the store and does
+// not cause sync conflicts.
+type AccessLog struct {
+	Entries map[string]AccessRecord `json:"entries"`
+}
+
+// AccessRecord describes the reads of one entry
+type AccessRecord struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// LoadAccessLog reads and decrypts an access log, returning an empty log if
+// the file does not exist yet
+func LoadAccessLog(path string, encryptor crypto.Encryptor) (*AccessLog, error) {
+	log := &AccessLog{Entries: make(map[string]AccessRecord)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access log: %w", err)
+	}
+
+	plaintext, err := encryptor.Decrypt(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt access log: %w", err)
+	}
+	if err := json.Unmarshal(plaintext, log); err != nil {
+		return nil, fmt.Errorf("failed to parse access log: %w", err)
+	}
+	if log.Entries == nil {
+		log.Entries = make(map[string]AccessRecord)
+	}
+	return log, nil
+}
+
+// Record counts a read of an entry
+func (l *AccessLog) Record(name string, at time.Time) {
+	record := l.Entries[name]
+	record.Count++
+	record.Last = at.UTC()
+	l.Entries[name] = record
+}
+
+// Save encrypts the access log and writes it to path
+func (l *AccessLog) Save(path string, encryptor crypto.Encryptor) error {
+	plaintext, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to encode access log: %w", err)
+	}
+
+	encrypted, err := encryptor.Encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access log: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create access log directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(encrypted), 0600); err != nil {
+		return fmt.Errorf("failed to write access log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// maxAliasDepth bounds how many aliases are followed, so loops end
+const maxAliasDepth = 8
+
+// ErrAliasLoop is returned when aliases refer to each other in a loop
+var ErrAliasLoop = errors.New("too many levels of aliases")
+
+// AddAlias makes name refer to the entry target, so it can still be read
+// under name after being renamed. The alias is an entry of its own, with no
+// secret, encrypted to the recipients of its folder like any other.
+func (s *Store) AddAlias(name, target string) error {
+	if name == target {
+		return fmt.Errorf("'%s' can't be an alias of itself", name)
+	}
+	if _, err := s.entries().Stat(name); err == nil {
+		return fmt.Errorf("'%s' already exists", name)
+	}
+	resolved, err := s.ResolveAlias(target)
+	if err != nil {
+		return err
+	}
+	if resolved == name {
+		return fmt.Errorf("'%s' would be an alias of itself: %w", name, ErrAliasLoop)
+	}
+
+	now := time.Now().UTC()
+	plaintext, err := s.seal(name, nil, Metadata{Created: now, Modified: now, Alias: target})
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(plaintext)
+	if err := s.writePlaintext(name, plaintext); err != nil {
+		return err
+	}
+	s.logOperation(LogAdd, name)
+	return nil
+}
+
+// ResolveAlias returns the entry name refers to after following any aliases,
+// or name itself if it is not an alias
+func (s *Store) ResolveAlias(name string) (string, error) {
+	for depth := 0; depth <= maxAliasDepth; depth++ {
+		meta, err := s.Metadata(name)
+		if err != nil {
+			return "", err
+		}
+		if meta.Alias == "" {
+			return name, nil
+		}
+		name = meta.Alias
+	}
+	return "", fmt.Errorf("%w: %s", ErrAliasLoop, name)
+}
+
+// Aliases returns the aliases in the index with the entries they refer to
+func (i *Index) Aliases() map[string]string {
+	aliases := make(map[string]string)
+	for name, entry := range i.Entries {
+		if entry.Alias != "" {
+			aliases[name] = entry.Alias
+		}
+	}
+	return aliases
+}
+
+// WithoutAliases returns a copy of the index without aliases
+func (i *Index) WithoutAliases() *Index {
+	entries := &Index{Version: i.Version, Entries: make(map[string]IndexEntry, len(i.Entries))}
+	for name, entry := range i.Entries {
+		if entry.Alias == "" {
+			entries.Entries[name] = entry
+		}
+	}
+	return entries
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index"))
+	if err := store.Add("services/new", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddAlias("services/old", "services/new"); err != nil {
+		t.Fatalf("AddAlias failed: %v", err)
+	}
+	if err := store.AddAlias("legacy", "services/old"); err != nil {
+		t.Fatalf("AddAlias of an alias failed: %v", err)
+	}
+
+	for _, name := range []string{"services/old", "legacy"} {
+		if secret, err := store.Get(name); err != nil || string(secret) != "secret" {
+			t.Errorf("Expected %s to read the entry, got %q (%v)", name, secret, err)
+		}
+		if target, err := store.ResolveAlias(name); err != nil || target != "services/new" {
+			t.Errorf("Expected %s to resolve to services/new, got %q (%v)", name, target, err)
+		}
+	}
+
+	// Writing to an alias writes to its entry
+	if err := store.Add("legacy", []byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := store.Get("services/new"); err != nil || string(secret) != "rotated" {
+		t.Errorf("Expected the entry to be updated through its alias, got %q (%v)", secret, err)
+	}
+
+	index, err := store.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"services/old": "services/new", "legacy": "services/old"}
+	if aliases := index.Aliases(); !reflect.DeepEqual(aliases, want) {
+		t.Errorf("Expected aliases %v, got %v", want, aliases)
+	}
+	if names := index.WithoutAliases().Names(); !reflect.DeepEqual(names, []string{"services/new"}) {
+		t.Errorf("Expected only the entry without aliases, got %v", names)
+	}
+
+	// Aliases must point at something and not at themselves
+	if err := store.AddAlias("dangling", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing target, got %v", err)
+	}
+	if err := store.AddAlias("services/old", "services/new"); err == nil {
+		t.Error("Expected an existing name to be refused")
+	}
+	if err := store.AddAlias("services/new", "legacy"); err == nil {
+		t.Error("Expected an alias loop to be refused")
+	}
+
+	// Deleting the entry leaves its aliases dangling
+	if err := store.Delete("services/new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("legacy"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a dangling alias to report ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+)
+
+// attachmentExtension is the file extension used for attachments
+const attachmentExtension = ".file"
+
+// AddFile encrypts the content of r into an attachment, replacing any
+// previous attachment of that name. The content is encrypted as a stream, so
+// large files are never held in memory as a whole. It returns the number of
+// plaintext bytes stored.
+func (s *Store) AddFile(name string, r io.Reader) (int64, error) {
+	if strings.HasPrefix(name, metaDir) {
+		return 0, fmt.Errorf("'%s' is reserved for store metadata", strings.TrimSuffix(metaDir, "/"))
+	}
+	// Attachments are stored under their names
+	if encrypted, err := s.NamesEncrypted(); err != nil {
+		return 0, err
+	} else if encrypted {
+		return 0, fmt.Errorf("attachments are %w", ErrNamesEncrypted)
+	}
+
+	w, err := s.entries().CreateFile(name + attachmentExtension)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	// The content key is wrapped to the attachment's recipients like an entry
+	wrap := func(key []byte) (string, error) {
+		return s.encrypt(name, key)
+	}
+	counter := &countingReader{r: r}
+	err = crypto.EncryptStreamWith(wrap, counter, w)
+	if closeErr := w.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = s.entries().RemoveFile(name + attachmentExtension)
+		return 0, fmt.Errorf("failed to write attachment: %w", err)
+	}
+	return counter.n, nil
+}
+
+// GetFile decrypts an attachment into w and returns the number of bytes written
+func (s *Store) GetFile(name string, w io.Writer) (int64, error) {
+	r, err := s.entries().OpenFile(name + attachmentExtension)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open attachment: %w", err)
+	}
+	defer r.Close()
+
+	counter := &countingWriter{w: w}
+	if err := crypto.DecryptStreamWith(s.encryptor.Decrypt, r, counter); err != nil {
+		return counter.n, fmt.Errorf("failed to decrypt attachment: %w", err)
+	}
+	return counter.n, nil
+}
+
+// ListFiles returns the names of all attachments
+func (s *Store) ListFiles() ([]string, error) {
+	files, err := s.entries().ListFiles(attachmentExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments: %w", err)
+	}
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(file, attachmentExtension)
+	}
+	return names, nil
+}
+
+// DeleteFile removes an attachment
+func (s *Store) DeleteFile(name string) error {
+	if err := s.entries().RemoveFile(name + attachmentExtension); err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAttachmentRoundTrip(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+
+	for _, size := range []int{0, 10, 64 * 1024, 3*64*1024 + 17} {
+		content := make([]byte, size)
+		if _, err := rand.Read(content); err != nil {
+			t.Fatalf("Failed to generate content: %v", err)
+		}
+
+		written, err := store.AddFile("docs/keyfile", bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("Failed to add %d byte attachment: %v", size, err)
+		}
+		if written != int64(size) {
+			t.Fatalf("Expected %d bytes written, got %d", size, written)
+		}
+
+		var out bytes.Buffer
+		if _, err := store.GetFile("docs/keyfile", &out); err != nil {
+			t.Fatalf("Failed to get %d byte attachment: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), content) {
+			t.Fatalf("Attachment of %d bytes did not round-trip", size)
+		}
+	}
+
+	names, err := store.ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list attachments: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"docs/keyfile"}) {
+		t.Fatalf("Expected [docs/keyfile], got %v", names)
+	}
+
+	if err := store.DeleteFile("docs/keyfile"); err != nil {
+		t.Fatalf("Failed to delete attachment: %v", err)
+	}
+	if _, err := store.GetFile("docs/keyfile", &bytes.Buffer{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected not-exist error after delete, got %v", err)
+	}
+}
+
+func TestAttachmentTruncated(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+
+	content := make([]byte, 200*1024)
+	if _, err := store.AddFile("big", bytes.NewReader(content)); err != nil {
+		t.Fatalf("Failed to add attachment: %v", err)
+	}
+
+	data, err := backend.ReadFile("big" + attachmentExtension)
+	if err != nil {
+		t.Fatalf("Failed to read attachment file: %v", err)
+	}
+	if err := backend.WriteFile("big"+attachmentExtension, data[:len(data)-100]); err != nil {
+		t.Fatalf("Failed to write attachment file: %v", err)
+	}
+
+	if _, err := store.GetFile("big", &bytes.Buffer{}); err == nil {
+		t.Fatal("Expected a truncated attachment to be rejected")
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// Audit thresholds
+const (
+	// MinPasswordLength is the shortest password not reported as weak
+	MinPasswordLength = 12
+	// StaleAfter is how long a password may go unchanged before it is reported
+	StaleAfter = 365 * 24 * time.Hour
+)
+
+// Finding kinds reported by Audit
+const (
+	FindingUnreadable = "unreadable"
+	FindingWeak       = "weak"
+	FindingReused     = "reused"
+	FindingStale      = "stale"
+	FindingExpired    = "expired"
+	FindingExpiring   = "expiring"
+	FindingRecovery   = "recovery"
+)
+
+// Finding is a problem with an entry found by Audit
+type Finding struct {
+	Name    string
+	Kind    string
+	Message string
+}
+
+// Audit checks every entry for passwords that cannot be decrypted, are
+// short, are shared with other entries, have not changed for a long time or
+// are past or near their expiry date, and for recovery codes running out.
+// The password is the first line of an entry.
+func (s *Store) Audit(now time.Time) ([]Finding, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are decrypted concurrently; only what the checks need is kept
+	type result struct {
+		findings []Finding
+		digest   *[sha256.Size]byte
+	}
+	results := make([]result, len(names))
+	err = s.forEach(names, func(i int, name string) error {
+		secret, meta, err := s.readEntry(name)
+		if err != nil {
+			results[i].findings = append(results[i].findings, Finding{Name: name, Kind: FindingUnreadable, Message: err.Error()})
+			return nil
+		}
+		defer secure.Wipe(secret)
+
+		password, _, _ := bytes.Cut(secret, []byte("\n"))
+		if len(password) < MinPasswordLength {
+			results[i].findings = append(results[i].findings, Finding{Name: name, Kind: FindingWeak,
+				Message: fmt.Sprintf("password has %d characters, fewer than %d", len(password), MinPasswordLength)})
+		}
+		if len(password) > 0 {
+			// Compare digests so plaintexts are not kept around
+			digest := sha256.Sum256(password)
+			results[i].digest = &digest
+		}
+		if !meta.Modified.IsZero() && now.Sub(meta.Modified) > StaleAfter {
+			results[i].findings = append(results[i].findings, Finding{Name: name, Kind: FindingStale,
+				Message: fmt.Sprintf("password unchanged since %s", meta.Modified.Format("2006-01-02"))})
+		}
+		if finding, ok := expiryFinding(name, secret, now); ok {
+			results[i].findings = append(results[i].findings, finding)
+		}
+		if finding, ok := recoveryFinding(name, secret); ok {
+			results[i].findings = append(results[i].findings, finding)
+		}
+		return nil
+	})
+	if err != nil {
+		// Only interruption fails an audit; unreadable entries are findings
+		return nil, err
+	}
+
+	var findings []Finding
+	byPassword := make(map[[sha256.Size]byte][]string)
+	for i, result := range results {
+		findings = append(findings, result.findings...)
+		if result.digest != nil {
+			byPassword[*result.digest] = append(byPassword[*result.digest], names[i])
+		}
+	}
+
+	for _, shared := range byPassword {
+		if len(shared) < 2 {
+			continue
+		}
+		for _, name := range shared {
+			findings = append(findings, Finding{Name: name, Kind: FindingReused,
+				Message: fmt.Sprintf("password is used by %d entries", len(shared))})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Name != findings[j].Name {
+			return findings[i].Name < findings[j].Name
+		}
+		return findings[i].Kind < findings[j].Kind
+	})
+	return findings, nil
+}
+
+// expiryFinding reports an entry that has expired or expires soon, or has
+// an invalid expiry date
+func expiryFinding(name string, secret []byte, now time.Time) (Finding, bool) {
+	expires, err := Expiry(secret)
+	switch {
+	case err != nil:
+		return Finding{Name: name, Kind: FindingExpired, Message: err.Error()}, true
+	case expires.IsZero():
+		return Finding{}, false
+	case !now.Before(expires):
+		return Finding{Name: name, Kind: FindingExpired,
+			Message: fmt.Sprintf("password expired on %s", expires.Format(ExpiryLayout))}, true
+	case expires.Sub(now) < ExpiryWarning:
+		return Finding{Name: name, Kind: FindingExpiring,
+			Message: fmt.Sprintf("password expires on %s", expires.Format(ExpiryLayout))}, true
+	}
+	return Finding{}, false
+}
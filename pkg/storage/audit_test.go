@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	now := time.Now().UTC()
+
+	for name, secret := range map[string]string{
+		"good":    "Xk9#mQ2$vL7@pR4z\nuser: alice",
+		"short":   "hunter2",
+		"reused1": "correct-horse-battery",
+		"reused2": "correct-horse-battery\nnotes",
+	} {
+		if err := store.Add(name, []byte(secret)); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	old := now.Add(-2 * StaleAfter)
+	plaintext, err := sealEntry([]byte("Bq8!nW3^tY6&hJ1x"), Metadata{Created: old, Modified: old})
+	if err != nil {
+		t.Fatalf("Failed to seal entry: %v", err)
+	}
+	if err := store.writePlaintext("stale", plaintext); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+	if err := backend.Put("broken", []byte(metadataMagic+"{\nx_encrypted")); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+
+	findings, err := store.Audit(now)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+
+	var got [][2]string
+	for _, finding := range findings {
+		got = append(got, [2]string{finding.Name, finding.Kind})
+	}
+	expected := [][2]string{
+		{"broken", FindingUnreadable},
+		{"reused1", FindingReused},
+		{"reused2", FindingReused},
+		{"short", FindingWeak},
+		{"stale", FindingStale},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+}
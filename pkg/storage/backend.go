@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// entryExtension is the file extension used for encrypted entries
+const entryExtension = ".pass"
+
+// Backend persists encrypted entries. Names are slash-separated entry names
+// such as "email/work"; backends decide how they map onto their medium.
+type Backend interface {
+	// Put stores the encrypted data for an entry, replacing any previous value
+	Put(name string, data []byte) error
+	// Get returns the encrypted data for an entry
+	Get(name string) ([]byte, error)
+	// List returns the names of all entries
+	List() ([]string, error)
+	// Delete removes an entry
+	Delete(name string) error
+	// Stat returns information about an entry without reading it
+	Stat(name string) (EntryInfo, error)
+	// ReadFile returns a file that is not an entry, such as a recipients
+	// file, given by its slash-separated path relative to the store root
+	ReadFile(path string) ([]byte, error)
+	// WriteFile stores a file that is not an entry
+	WriteFile(path string, data []byte) error
+	// OpenFile opens a file that is not an entry for streaming reads
+	OpenFile(path string) (io.ReadCloser, error)
+	// CreateFile creates or replaces a file that is not an entry; the
+	// content is complete once the returned writer is closed
+	CreateFile(path string) (io.WriteCloser, error)
+	// RemoveFile deletes a file that is not an entry
+	RemoveFile(path string) error
+	// ListFiles returns the paths of all files that are not entries and have
+	// the given extension
+	ListFiles(extension string) ([]string, error)
+	// Close releases any resources held by the backend
+	Close() error
+}
+
+// EntryInfo describes a stored entry
+type EntryInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// BackendOptions carries settings needed by some backends
+type BackendOptions struct {
+	// WebDAV holds the credentials for webdav:// and webdavs:// stores
+	WebDAV WebDAVAuth
+	// FileMode is the mode of files written to local and ssh:// stores,
+	// 0600 if unset; see DirMode for directories
+	FileMode os.FileMode
+	// Group, a name or ID, owns the files and directories written to local
+	// stores if set
+	Group string
+}
+
+// OpenBackend returns the backend for a store location. Empty locations
+// default to ~/.passh, ssh:// URLs are served over SFTP, webdav:// and
+// webdavs:// URLs over WebDAV, and anything else is treated as a local
+// directory.
+func OpenBackend(location string) (Backend, error) {
+	return OpenBackendWithOptions(location, BackendOptions{})
+}
+
+// OpenBackendWithOptions is like OpenBackend but passes credentials and other
+// settings to the backend
+func OpenBackendWithOptions(location string, options BackendOptions) (Backend, error) {
+	switch {
+	case isRemoteStore(location):
+		backend, err := NewSFTPBackend(location)
+		if err != nil {
+			return nil, err
+		}
+		return applyPermissions(backend, options)
+	case isWebDAVStore(location):
+		return NewWebDAVBackend(location, options.WebDAV)
+	}
+
+	if location == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		location = filepath.Join(homeDir, ".passh")
+	}
+
+	backend, err := NewFileBackend(location)
+	if err != nil {
+		return nil, err
+	}
+	return applyPermissions(backend, options)
+}
+
+// fileBackend stores each entry as a .pass file in a directory tree
+type fileBackend struct {
+	rootDir string
+	fs      fileSystem
+	// fileMode and dirMode are given to written files and directories
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	// gid is the group given to written files and directories, or -1
+	gid int
+}
+
+// NewFileBackend creates a backend storing entries under a local directory
+func NewFileBackend(rootDir string) (Backend, error) {
+	return newTreeBackend(rootDir, localFS{})
+}
+
+// newTreeBackend creates a directory tree backend on the given file system
+func newTreeBackend(rootDir string, fs fileSystem) (*fileBackend, error) {
+	if err := fs.MkdirAll(rootDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	return &fileBackend{rootDir: rootDir, fs: fs, fileMode: defaultFileMode, dirMode: DirMode(defaultFileMode), gid: -1}, nil
+}
+
+// path returns the file path of an entry
+func (b *fileBackend) path(name string) string {
+	return filepath.Join(b.rootDir, filepath.FromSlash(name)+entryExtension)
+}
+
+func (b *fileBackend) Put(name string, data []byte) error {
+	return b.writeFile(b.path(name), data)
+}
+
+func (b *fileBackend) Get(name string) ([]byte, error) {
+	return b.fs.ReadFile(b.path(name))
+}
+
+func (b *fileBackend) List() ([]string, error) {
+	files, err := b.ListFiles(entryExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, len(files))
+	for i, file := range files {
+		entries[i] = strings.TrimSuffix(file, entryExtension)
+	}
+	return entries, nil
+}
+
+func (b *fileBackend) ListFiles(extension string) ([]string, error) {
+	var files []string
+
+	err := b.fs.Walk(b.rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && strings.HasSuffix(info.Name(), extension) {
+			relPath, err := filepath.Rel(b.rootDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func (b *fileBackend) Delete(name string) error {
+	if err := b.fs.Remove(b.path(name)); err != nil {
+		return err
+	}
+	b.removeEmptyParents(b.path(name))
+	return nil
+}
+
+// removeEmptyParents removes the directories above a deleted file that are
+// left empty, up to the store's root. Removing a directory that still holds
+// anything fails, which ends the walk.
+func (b *fileBackend) removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(b.rootDir, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return
+		}
+		if b.fs.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func (b *fileBackend) Stat(name string) (EntryInfo, error) {
+	info, err := b.fs.Stat(b.path(name))
+	if err != nil {
+		return EntryInfo{}, err
+	}
+
+	return EntryInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (b *fileBackend) ReadFile(path string) ([]byte, error) {
+	return b.fs.ReadFile(filepath.Join(b.rootDir, filepath.FromSlash(path)))
+}
+
+func (b *fileBackend) WriteFile(path string, data []byte) error {
+	return b.writeFile(filepath.Join(b.rootDir, filepath.FromSlash(path)), data)
+}
+
+// writeFile writes a file of the tree, creating the directories above it
+func (b *fileBackend) writeFile(filePath string, data []byte) error {
+	if err := b.mkdirAll(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	_, err := b.fs.Stat(filePath)
+	created := err != nil
+	if err := b.fs.WriteFile(filePath, data, b.fileMode); err != nil {
+		return err
+	}
+	return b.setOwnership(filePath, b.fileMode, created)
+}
+
+func (b *fileBackend) OpenFile(path string) (io.ReadCloser, error) {
+	return b.fs.Open(filepath.Join(b.rootDir, filepath.FromSlash(path)))
+}
+
+func (b *fileBackend) CreateFile(path string) (io.WriteCloser, error) {
+	filePath := filepath.Join(b.rootDir, filepath.FromSlash(path))
+	if err := b.mkdirAll(filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+
+	_, err := b.fs.Stat(filePath)
+	created := err != nil
+	file, err := b.fs.Create(filePath, b.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.setOwnership(filePath, b.fileMode, created); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+func (b *fileBackend) RemoveFile(path string) error {
+	filePath := filepath.Join(b.rootDir, filepath.FromSlash(path))
+	if err := b.fs.Remove(filePath); err != nil {
+		return err
+	}
+	b.removeEmptyParents(filePath)
+	return nil
+}
+
+func (b *fileBackend) Close() error {
+	return b.fs.Close()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testBackend exercises the Backend contract shared by every implementation
+func testBackend(t *testing.T, backend Backend) {
+	if err := backend.Put("email/work", []byte("ciphertext-1")); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+	if err := backend.Put("github", []byte("ciphertext-2")); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+	if err := backend.WriteFile("email/.passh-recipients", []byte("keys")); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	data, err := backend.Get("email/work")
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if string(data) != "ciphertext-1" {
+		t.Fatalf("Expected 'ciphertext-1', got '%s'", data)
+	}
+
+	info, err := backend.Stat("github")
+	if err != nil {
+		t.Fatalf("Failed to stat entry: %v", err)
+	}
+	if info.Name != "github" || info.Size != int64(len("ciphertext-2")) {
+		t.Fatalf("Unexpected entry info: %+v", info)
+	}
+
+	names, err := backend.List()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"email/work", "github"}) {
+		t.Fatalf("Expected [email/work github], got %v", names)
+	}
+
+	data, err = backend.ReadFile("email/.passh-recipients")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "keys" {
+		t.Fatalf("Expected 'keys', got '%s'", data)
+	}
+	if _, err := backend.ReadFile(".passh-recipients"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected not-exist error for a missing file, got %v", err)
+	}
+
+	writer, err := backend.CreateFile("docs/license.file")
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for _, chunk := range []string{"part-1 ", "part-2"} {
+		if _, err := io.WriteString(writer, chunk); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	files, err := backend.ListFiles(".file")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if !reflect.DeepEqual(files, []string{"docs/license.file"}) {
+		t.Fatalf("Expected [docs/license.file], got %v", files)
+	}
+
+	reader, err := backend.OpenFile("docs/license.file")
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "part-1 part-2" {
+		t.Fatalf("Expected 'part-1 part-2', got %q (%v)", data, err)
+	}
+
+	if err := backend.RemoveFile("docs/license.file"); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if _, err := backend.OpenFile("docs/license.file"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected not-exist error for a removed file, got %v", err)
+	}
+
+	if err := backend.Delete("email/work"); err != nil {
+		t.Fatalf("Failed to delete entry: %v", err)
+	}
+	if _, err := backend.Get("email/work"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected not-exist error after delete, got %v", err)
+	}
+	if _, err := backend.Stat("email/work"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected not-exist error from stat after delete, got %v", err)
+	}
+
+	if err := backend.Close(); err != nil {
+		t.Fatalf("Failed to close backend: %v", err)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	backend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file backend: %v", err)
+	}
+	testBackend(t, backend)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func TestStoreWithMemoryBackend(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+
+	if err := store.Add("test/entry", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add password: %v", err)
+	}
+
+	password, err := store.Get("test/entry")
+	if err != nil {
+		t.Fatalf("Failed to get password: %v", err)
+	}
+	if string(password) != "secret" {
+		t.Fatalf("Expected 'secret', got '%s'", password)
+	}
+}
+
+func TestStoreMetadata(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := store.Add("github", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	if err := store.WriteMeta("recovery.pub", []byte("key")); err != nil {
+		t.Fatalf("Failed to write metadata: %v", err)
+	}
+
+	data, err := store.ReadMeta("recovery.pub")
+	if err != nil || string(data) != "key" {
+		t.Fatalf("Expected metadata 'key', got %q (%v)", data, err)
+	}
+	if _, err := store.ReadMeta("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist for missing metadata, got %v", err)
+	}
+
+	names, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if len(names) != 1 || names[0] != "github" {
+		t.Errorf("Expected metadata to be hidden from the entry list, got %v", names)
+	}
+
+	if err := store.Add(".passh/recovery.pub", []byte("x")); err == nil {
+		t.Error("Expected adding an entry in the metadata folder to fail")
+	}
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+const (
+	// backupVersion is the version of the backup archive layout
+	backupVersion = 1
+	// backupManifestName is the archive member holding the manifest
+	backupManifestName = "manifest.json"
+	// backupEntriesDir is the archive directory holding the entries
+	backupEntriesDir = "entries/"
+)
+
+// BackupManifest lists the entries contained in a backup with their checksums
+type BackupManifest struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Entries []BackupEntry `json:"entries"`
+}
+
+// BackupEntry describes one entry in a backup
+type BackupEntry struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup is a decrypted and verified backup archive
+type Backup struct {
+	Manifest BackupManifest
+	entries  map[string][]byte
+}
+
+// RestoreResult summarizes what a restore changed
+type RestoreResult struct {
+	Restored []string
+	Skipped  []string
+	Removed  []string
+}
+
+// CreateBackup decrypts every entry and packs them into a single archive,
+// which is encrypted to the store's recipients as a whole and streamed to w.
+// The archive contains a manifest with a checksum for every entry.
+func (s *Store) CreateBackup(w io.Writer) (*BackupManifest, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	// The archive is encrypted while it is being written
+	pr, pw := io.Pipe()
+	encrypted := make(chan error, 1)
+	go func() {
+		err := s.encryptor.EncryptStream(pr, w)
+		pr.CloseWithError(err)
+		encrypted <- err
+	}()
+
+	manifest, err := s.writeArchive(pw, names)
+	pw.CloseWithError(err)
+	if encryptErr := <-encrypted; err == nil && encryptErr != nil {
+		err = fmt.Errorf("encryption failed: %w", encryptErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeArchive writes the named entries and their manifest as a tar.gz archive
+func (s *Store) writeArchive(w io.Writer, names []string) (*BackupManifest, error) {
+	manifest := &BackupManifest{Version: backupVersion, Created: time.Now().UTC()}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, name := range names {
+		// Back up the full content so that metadata survives a restore
+		password, err := s.readPlaintext(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up '%s': %w", name, err)
+		}
+
+		sum := sha256.Sum256(password)
+		manifest.Entries = append(manifest.Entries, BackupEntry{
+			Name:   name,
+			Size:   len(password),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+
+		err = writeTarFile(tw, backupEntriesDir+name, password)
+		secure.Wipe(password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeTarFile(tw, backupManifestName, manifestData); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// ReadBackup decrypts a backup and verifies every entry against the manifest.
+// Backups from before streaming encryption are still accepted.
+func (s *Store) ReadBackup(r io.Reader) (*Backup, error) {
+	reader := bufio.NewReader(r)
+
+	var archive io.Reader
+	if magic, _ := reader.Peek(len(crypto.StreamMagic)); string(magic) == crypto.StreamMagic {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(s.encryptor.DecryptStream(reader, pw))
+		}()
+		// Unblock the decrypting goroutine if reading stops early
+		defer pr.Close()
+		archive = pr
+	} else {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		plaintext, err := s.encryptor.Decrypt(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("decryption failed: %w", err)
+		}
+		defer secure.Wipe(plaintext)
+		archive = bytes.NewReader(plaintext)
+	}
+
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	backup := &Backup{entries: make(map[string][]byte)}
+	var manifestData []byte
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup archive: %w", err)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup archive: %w", err)
+		}
+
+		switch {
+		case header.Name == backupManifestName:
+			manifestData = content
+		case strings.HasPrefix(header.Name, backupEntriesDir):
+			name := strings.TrimPrefix(header.Name, backupEntriesDir)
+			if name == "" || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+				return nil, fmt.Errorf("backup contains invalid entry name %q", header.Name)
+			}
+			backup.entries[name] = content
+		}
+	}
+
+	// Read to the end so that a damaged or truncated stream is noticed
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+
+	if manifestData == nil {
+		return nil, errors.New("backup has no manifest")
+	}
+	if err := json.Unmarshal(manifestData, &backup.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if backup.Manifest.Version != backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", backup.Manifest.Version)
+	}
+
+	if err := backup.verify(); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// verify checks that the archive holds exactly the manifest's entries with matching checksums
+func (b *Backup) verify() error {
+	listed := make(map[string]bool, len(b.Manifest.Entries))
+	for _, entry := range b.Manifest.Entries {
+		listed[entry.Name] = true
+
+		content, ok := b.entries[entry.Name]
+		if !ok {
+			return fmt.Errorf("backup is incomplete: entry '%s' is missing", entry.Name)
+		}
+		sum := sha256.Sum256(content)
+		if len(content) != entry.Size || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return fmt.Errorf("backup is corrupt: checksum mismatch for '%s'", entry.Name)
+		}
+	}
+
+	for name := range b.entries {
+		if !listed[name] {
+			return fmt.Errorf("backup is corrupt: entry '%s' is not in the manifest", name)
+		}
+	}
+	return nil
+}
+
+// Wipe clears the decrypted entries held by the backup
+func (b *Backup) Wipe() {
+	for name, content := range b.entries {
+		secure.Wipe(content)
+		delete(b.entries, name)
+	}
+}
+
+// RestoreBackup writes the entries of a backup into the store, encrypting
+// them to the store's current recipients. With merge, existing entries are
+// kept and only missing ones are restored; otherwise the store is made to
+// match the backup exactly, removing entries that are not in it.
+func (s *Store) RestoreBackup(backup *Backup, merge bool) (*RestoreResult, error) {
+	existing, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	result := &RestoreResult{}
+	for _, entry := range backup.Manifest.Entries {
+		if merge && exists[entry.Name] {
+			result.Skipped = append(result.Skipped, entry.Name)
+			continue
+		}
+		if err := s.writePlaintext(entry.Name, backup.entries[entry.Name]); err != nil {
+			return result, fmt.Errorf("failed to restore '%s': %w", entry.Name, err)
+		}
+		result.Restored = append(result.Restored, entry.Name)
+	}
+
+	if !merge {
+		for _, name := range existing {
+			if _, ok := backup.entries[name]; ok {
+				continue
+			}
+			if err := s.Delete(name); err != nil {
+				return result, fmt.Errorf("failed to remove '%s': %w", name, err)
+			}
+			result.Removed = append(result.Removed, name)
+		}
+	}
+
+	return result, nil
+}
+
+// writeTarFile adds a regular file to a tar archive
+func writeTarFile(tw *tar.Writer, name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now().UTC(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive header: %w", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write archive content: %w", err)
+	}
+	return nil
+}
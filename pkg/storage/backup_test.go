@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	source := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	for name, password := range map[string]string{"email/work": "one", "github": "two"} {
+		if err := source.Add(name, []byte(password)); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+
+	var data bytes.Buffer
+	manifest, err := source.CreateBackup(&data)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if len(manifest.Entries) != 2 {
+		t.Fatalf("Expected 2 manifest entries, got %d", len(manifest.Entries))
+	}
+
+	target := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := target.Add("stale", []byte("old")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	backup, err := target.ReadBackup(&data)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+
+	result, err := target.RestoreBackup(backup, false)
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if !reflect.DeepEqual(result.Restored, []string{"email/work", "github"}) {
+		t.Errorf("Unexpected restored entries: %v", result.Restored)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"stale"}) {
+		t.Errorf("Expected stale entry to be removed, got %v", result.Removed)
+	}
+
+	password, err := target.Get("email/work")
+	if err != nil {
+		t.Fatalf("Failed to get restored entry: %v", err)
+	}
+	if string(password) != "one" {
+		t.Fatalf("Expected 'one', got '%s'", password)
+	}
+}
+
+func TestBackupRestoreMerge(t *testing.T) {
+	source := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := source.Add("shared", []byte("from-backup")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	if err := source.Add("missing", []byte("restored")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	var data bytes.Buffer
+	_, err := source.CreateBackup(&data)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	target := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := target.Add("shared", []byte("current")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	if err := target.Add("local-only", []byte("kept")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	backup, err := target.ReadBackup(&data)
+	if err != nil {
+		t.Fatalf("Failed to read backup: %v", err)
+	}
+	result, err := target.RestoreBackup(backup, true)
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if !reflect.DeepEqual(result.Restored, []string{"missing"}) || !reflect.DeepEqual(result.Skipped, []string{"shared"}) {
+		t.Errorf("Unexpected merge result: %+v", result)
+	}
+
+	password, err := target.Get("shared")
+	if err != nil || string(password) != "current" {
+		t.Errorf("Expected existing entry to be kept, got '%s' (%v)", password, err)
+	}
+	if _, err := target.Get("local-only"); err != nil {
+		t.Errorf("Expected local-only entry to survive merge: %v", err)
+	}
+}
+
+func TestBackupDetectsCorruption(t *testing.T) {
+	backup := &Backup{
+		Manifest: BackupManifest{
+			Version: backupVersion,
+			Entries: []BackupEntry{{Name: "entry", Size: 3, SHA256: strings.Repeat("0", 64)}},
+		},
+		entries: map[string][]byte{"entry": []byte("abc")},
+	}
+	if err := backup.verify(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected checksum mismatch, got %v", err)
+	}
+
+	backup.Manifest.Entries = nil
+	if err := backup.verify(); err == nil || !strings.Contains(err.Error(), "not in the manifest") {
+		t.Fatalf("Expected unlisted entry to be reported, got %v", err)
+	}
+
+	backup.Manifest.Entries = []BackupEntry{{Name: "gone"}}
+	if err := backup.verify(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected missing entry to be reported, got %v", err)
+	}
+}
+
+func TestReadLegacyBackup(t *testing.T) {
+	source := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := source.Add("github", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	// Backups used to encrypt the whole archive in one piece
+	var archive bytes.Buffer
+	if _, err := source.writeArchive(&archive, []string{"github"}); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	legacy, err := source.encryptor.Encrypt(archive.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to encrypt archive: %v", err)
+	}
+
+	backup, err := source.ReadBackup(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatalf("Failed to read legacy backup: %v", err)
+	}
+	if len(backup.Manifest.Entries) != 1 || backup.Manifest.Entries[0].Name != "github" {
+		t.Fatalf("Unexpected legacy backup manifest: %+v", backup.Manifest)
+	}
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// Kinds of batch operations
+const (
+	BatchAdd    = "add"
+	BatchMove   = "mv"
+	BatchDelete = "delete"
+)
+
+// batchJournal holds the entry files a batch is about to change, as they
+// were, until the batch is done. A journal left behind by a batch that
+// didn't finish is rolled back by the next one.
+const batchJournal = "batch-journal.json"
+
+// BatchOp is one change of a batch
+type BatchOp struct {
+	Kind string
+	Name string
+	// Target is the new name of a moved entry
+	Target string
+	// Secret is the content of an added entry
+	Secret []byte
+}
+
+func (op BatchOp) String() string {
+	if op.Kind == BatchMove {
+		return fmt.Sprintf("%s %s %s", op.Kind, op.Name, op.Target)
+	}
+	return op.Kind + " " + op.Name
+}
+
+// stagedEntry is the content an entry will have once a batch is applied;
+// nil data means the entry is removed
+type stagedEntry struct {
+	data      []byte
+	plaintext []byte
+}
+
+// ApplyBatch applies the operations in order, all or nothing. Every entry is
+// checked and encrypted before anything is written; if writing fails, the
+// entries already changed are restored. If the store is the root of a local
+// git repository, the changes are committed in one commit with message.
+func (s *Store) ApplyBatch(ops []BatchOp, message string) error {
+	dir, local := LocalDir(s.raw())
+	if local {
+		// Locks are taken in order so two batches can't wait on each other
+		locked := make(map[string]bool)
+		var names []string
+		for _, op := range ops {
+			for _, name := range []string{op.Name, op.Target} {
+				if name != "" && !locked[name] {
+					locked[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			unlock, err := lockEntry(dir, name)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+	}
+
+	if err := s.recoverBatch(); err != nil {
+		return err
+	}
+
+	existed, err := s.existingNames()
+	if err != nil {
+		return err
+	}
+
+	staged, logged, err := s.stageBatch(ops, existed)
+	defer func() {
+		for _, entry := range staged {
+			secure.Wipe(entry.plaintext)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	touched := make([]string, 0, len(staged))
+	for name := range staged {
+		touched = append(touched, name)
+	}
+	sort.Strings(touched)
+
+	files, err := s.commitBatch(touched, staged, existed)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range touched {
+		if entry := staged[name]; entry.data != nil {
+			s.updateIndex(name, entry.data, entry.plaintext)
+		} else {
+			s.removeFromIndex(name)
+		}
+	}
+	for _, record := range logged {
+		s.logOperation(record[0], record[1])
+	}
+
+	if local {
+		if err := gitCommitFiles(dir, files, message); err != nil {
+			return fmt.Errorf("changes applied, but committing them to git failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// CheckBatch reports whether ApplyBatch would accept the operations,
+// without changing anything
+func (s *Store) CheckBatch(ops []BatchOp) error {
+	existed, err := s.existingNames()
+	if err != nil {
+		return err
+	}
+
+	staged, _, err := s.stageBatch(ops, existed)
+	for _, entry := range staged {
+		secure.Wipe(entry.plaintext)
+	}
+	return err
+}
+
+// existingNames returns the set of entry names
+func (s *Store) existingNames() (map[string]bool, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	existed := make(map[string]bool, len(names))
+	for _, name := range names {
+		existed[name] = true
+	}
+	return existed, nil
+}
+
+// stageBatch checks the operations against the entries that exist and
+// prepares the encrypted content of every entry they change. It also
+// returns the operations to log, as pairs of operation and entry name.
+func (s *Store) stageBatch(ops []BatchOp, existed map[string]bool) (map[string]*stagedEntry, [][2]string, error) {
+	staged := make(map[string]*stagedEntry)
+	exists := func(name string) bool {
+		if entry, ok := staged[name]; ok {
+			return entry.data != nil
+		}
+		return existed[name]
+	}
+	var logged [][2]string
+
+	now := time.Now().UTC()
+	for i, op := range ops {
+		fail := func(err error) (map[string]*stagedEntry, [][2]string, error) {
+			return staged, nil, fmt.Errorf("operation %d (%s): %w", i+1, op, err)
+		}
+		for _, name := range []string{op.Name, op.Target} {
+			if strings.HasPrefix(name, metaDir) {
+				return fail(fmt.Errorf("'%s' is reserved for store metadata", strings.TrimSuffix(metaDir, "/")))
+			}
+		}
+
+		switch op.Kind {
+		case BatchAdd:
+			if exists(op.Name) {
+				return fail(fmt.Errorf("'%s' already exists", op.Name))
+			}
+			plaintext, err := s.seal(op.Name, op.Secret, Metadata{Created: now, Modified: now})
+			if err != nil {
+				return fail(err)
+			}
+			entry, err := s.stageEntry(op.Name, plaintext)
+			if err != nil {
+				return fail(err)
+			}
+			staged[op.Name] = entry
+			logged = append(logged, [2]string{LogAdd, op.Name})
+
+		case BatchMove:
+			if !exists(op.Name) {
+				return fail(fmt.Errorf("%w: %s", ErrNotFound, op.Name))
+			}
+			if exists(op.Target) {
+				return fail(fmt.Errorf("'%s' already exists", op.Target))
+			}
+			var plaintext []byte
+			if entry, ok := staged[op.Name]; ok {
+				plaintext = append([]byte(nil), entry.plaintext...)
+			} else {
+				var err error
+				if plaintext, err = s.readPlaintext(op.Name); err != nil {
+					return fail(err)
+				}
+			}
+			// The signature covers the name, so the entry is sealed again
+			secret, meta, err := openEntry(plaintext)
+			if err != nil {
+				secure.Wipe(plaintext)
+				return fail(err)
+			}
+			resealed, err := s.seal(op.Target, secret, meta)
+			secure.Wipe(plaintext)
+			if err != nil {
+				return fail(err)
+			}
+			entry, err := s.stageEntry(op.Target, resealed)
+			if err != nil {
+				return fail(err)
+			}
+			staged[op.Target] = entry
+			if previous, ok := staged[op.Name]; ok {
+				secure.Wipe(previous.plaintext)
+			}
+			staged[op.Name] = &stagedEntry{}
+			logged = append(logged, [2]string{LogDelete, op.Name}, [2]string{LogAdd, op.Target})
+
+		case BatchDelete:
+			if !exists(op.Name) {
+				return fail(fmt.Errorf("%w: %s", ErrNotFound, op.Name))
+			}
+			if previous, ok := staged[op.Name]; ok {
+				secure.Wipe(previous.plaintext)
+			}
+			staged[op.Name] = &stagedEntry{}
+			logged = append(logged, [2]string{LogDelete, op.Name})
+
+		default:
+			return fail(fmt.Errorf("unknown operation '%s'", op.Kind))
+		}
+	}
+
+	// Entries added and deleted again within the batch are left alone
+	for name, entry := range staged {
+		if entry.data == nil && !existed[name] {
+			delete(staged, name)
+		}
+	}
+	return staged, logged, nil
+}
+
+// stageEntry encrypts the full content of an entry as writePlaintext would,
+// without writing it
+func (s *Store) stageEntry(name string, plaintext []byte) (*stagedEntry, error) {
+	named, err := s.nameEntry(name, plaintext)
+	if err != nil {
+		secure.Wipe(plaintext)
+		return nil, err
+	}
+	if named != nil {
+		secure.Wipe(plaintext)
+		plaintext = named
+	}
+
+	encrypted, err := s.encrypt(name, plaintext)
+	if err != nil {
+		secure.Wipe(plaintext)
+		return nil, fmt.Errorf("encryption failed: %w", err)
+	}
+	return &stagedEntry{data: encodeEntryFile(encrypted), plaintext: plaintext}, nil
+}
+
+// commitBatch writes the staged entries, after saving the files they replace
+// to the journal, and returns the entry files changed. If a write fails, the
+// files already written are restored.
+func (s *Store) commitBatch(touched []string, staged map[string]*stagedEntry, existed map[string]bool) ([]string, error) {
+	// The journal is keyed by file, so stores with encrypted names don't
+	// reveal the names in it
+	files := make([]string, len(touched))
+	journal := make(map[string][]byte, len(touched))
+	for i, name := range touched {
+		file, err := s.entryFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+		journal[file] = nil
+		if existed[name] {
+			data, err := s.raw().Get(file)
+			if err != nil {
+				return nil, entryError(name, "failed to read password file", err)
+			}
+			journal[file] = data
+		}
+	}
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.WriteMeta(batchJournal, data); err != nil {
+		return nil, err
+	}
+
+	for i, name := range touched {
+		var err error
+		if entry := staged[name]; entry.data != nil {
+			err = s.raw().Put(files[i], entry.data)
+		} else {
+			err = s.raw().Delete(files[i])
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to write '%s': %w", name, err)
+			if rollbackErr := s.rollBack(journal); rollbackErr != nil {
+				return nil, fmt.Errorf("%w; rolling back failed too, run the batch again to retry: %v", err, rollbackErr)
+			}
+			return nil, fmt.Errorf("%w; no changes were made", err)
+		}
+	}
+
+	if err := s.raw().RemoveFile(metaDir + batchJournal); err != nil {
+		logging.Warnf("failed to remove the batch journal: %v", err)
+	}
+	return files, nil
+}
+
+// recoverBatch rolls back a batch that was interrupted while writing, as
+// recorded in its journal
+func (s *Store) recoverBatch() error {
+	data, err := s.raw().ReadFile(metaDir + batchJournal)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the batch journal: %w", err)
+	}
+
+	var journal map[string][]byte
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return fmt.Errorf("failed to parse the batch journal: %w", err)
+	}
+	logging.Warnf("Rolling back %d entries changed by an interrupted batch", len(journal))
+	if err := s.rollBack(journal); err != nil {
+		return fmt.Errorf("failed to roll back the interrupted batch: %w", err)
+	}
+	// The index may have recorded entries the rollback undid
+	files := make([]string, 0, len(journal))
+	for file := range journal {
+		files = append(files, file)
+	}
+	if err := s.RefreshIndex(files); err != nil {
+		logging.Warnf("failed to update the index, run 'passh index rebuild': %v", err)
+	}
+	return nil
+}
+
+// rollBack restores the entry files in a journal and removes the journal.
+// Files the journal holds no content for did not exist and are deleted.
+func (s *Store) rollBack(journal map[string][]byte) error {
+	var failed []string
+	for file, data := range journal {
+		var err error
+		if data != nil {
+			err = s.raw().Put(file, data)
+		} else if _, statErr := s.raw().Stat(file); statErr == nil {
+			err = s.raw().Delete(file)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", file, err))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return s.raw().RemoveFile(metaDir + batchJournal)
+}
+
+// gitCommitFiles commits changed entry files, given by slash-separated
+// names, if dir is the root of a git repository
+func gitCommitFiles(dir string, files []string, message string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil
+	}
+
+	// Files that are gone and were never committed can't be named to git
+	tracked := make(map[string]bool)
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file+entryExtension)
+	}
+	output, err := git(dir, nil, append([]string{"ls-files", "-z", "--"}, paths...)...)
+	if err != nil {
+		return err
+	}
+	for _, path := range strings.Split(string(output), "\x00") {
+		tracked[path] = true
+	}
+	var changed []string
+	for _, path := range paths {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path))); err == nil || tracked[path] {
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if _, err := git(dir, nil, append([]string{"add", "-A", "--"}, changed...)...); err != nil {
+		return err
+	}
+	if _, err := git(dir, nil, append([]string{"diff", "--cached", "--quiet", "--"}, changed...)...); err == nil {
+		return nil
+	}
+	_, err = git(dir, nil, append([]string{"commit", "-q", "-m", message, "--"}, changed...)...)
+	return err
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingBackend fails to write one entry
+type failingBackend struct {
+	Backend
+	fail string
+}
+
+func (b *failingBackend) Put(name string, data []byte) error {
+	if name == b.fail {
+		return errors.New("disk full")
+	}
+	return b.Backend.Put(name, data)
+}
+
+func batchStore(t *testing.T, backend Backend) *Store {
+	t.Helper()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	for _, name := range []string{"web/old", "web/gone", "bank"} {
+		if err := store.Add(name, []byte(name+"-secret")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func storeContents(t *testing.T, store *Store) map[string]string {
+	t.Helper()
+	names, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string)
+	for _, name := range names {
+		secret, err := store.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[name] = string(secret)
+	}
+	return contents
+}
+
+func TestApplyBatch(t *testing.T) {
+	store := batchStore(t, NewMemoryBackend())
+	err := store.ApplyBatch([]BatchOp{
+		{Kind: BatchAdd, Name: "web/new", Secret: []byte("fresh")},
+		{Kind: BatchMove, Name: "web/old", Target: "web/renamed"},
+		{Kind: BatchDelete, Name: "web/gone"},
+		// Added and removed again, so never written
+		{Kind: BatchAdd, Name: "tmp", Secret: []byte("x")},
+		{Kind: BatchDelete, Name: "tmp"},
+	}, "batch")
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"web/new":     "fresh",
+		"web/renamed": "web/old-secret",
+		"bank":        "bank-secret",
+	}
+	if got := storeContents(t, store); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestApplyBatchChecksEverythingFirst(t *testing.T) {
+	store := batchStore(t, NewMemoryBackend())
+	before := storeContents(t, store)
+
+	for _, ops := range [][]BatchOp{
+		{{Kind: BatchAdd, Name: "web/new", Secret: []byte("x")}, {Kind: BatchDelete, Name: "missing"}},
+		{{Kind: BatchDelete, Name: "bank"}, {Kind: BatchAdd, Name: "web/old", Secret: []byte("x")}},
+		{{Kind: BatchMove, Name: "web/old", Target: "bank"}},
+		{{Kind: BatchAdd, Name: ".passh/x", Secret: []byte("x")}},
+	} {
+		if err := store.ApplyBatch(ops, "batch"); err == nil {
+			t.Errorf("Expected %v to fail", ops)
+		}
+		if got := storeContents(t, store); !reflect.DeepEqual(got, before) {
+			t.Errorf("Expected no changes after %v, got %v", ops, got)
+		}
+	}
+}
+
+func TestApplyBatchRollsBack(t *testing.T) {
+	backend := &failingBackend{Backend: NewMemoryBackend()}
+	store := batchStore(t, backend)
+	before := storeContents(t, store)
+
+	// Entries are written in order, so web/zzz fails after the others
+	backend.fail = "web/zzz"
+	err := store.ApplyBatch([]BatchOp{
+		{Kind: BatchDelete, Name: "bank"},
+		{Kind: BatchMove, Name: "web/old", Target: "web/new"},
+		{Kind: BatchAdd, Name: "web/zzz", Secret: []byte("x")},
+	}, "batch")
+	if err == nil || !strings.Contains(err.Error(), "no changes were made") {
+		t.Fatalf("Expected the batch to fail and be rolled back, got %v", err)
+	}
+	if got := storeContents(t, store); !reflect.DeepEqual(got, before) {
+		t.Errorf("Expected the store to be restored to %v, got %v", before, got)
+	}
+	if _, err := backend.ReadFile(metaDir + batchJournal); err == nil {
+		t.Error("Expected the journal to be removed")
+	}
+}
+
+func TestApplyBatchRecoversInterruptedBatch(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := batchStore(t, backend)
+	before := storeContents(t, store)
+
+	// A batch that died after deleting bank and adding web/half
+	bank, err := backend.Get("bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := `{"bank":"` + base64.StdEncoding.EncodeToString(bank) + `","web/half":null}`
+	if err := store.WriteMeta(batchJournal, []byte(journal)); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Delete("bank"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("web/half", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ApplyBatch(nil, "batch"); err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+	if got := storeContents(t, store); !reflect.DeepEqual(got, before) {
+		t.Errorf("Expected the interrupted batch to be rolled back to %v, got %v", before, got)
+	}
+}
+
+func TestApplyBatchCommitsToGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := batchStore(t, backend)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "test"},
+		{"config", "user.email", "test@example.com"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		if output, err := git(dir, nil, args...); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	err = store.ApplyBatch([]BatchOp{
+		{Kind: BatchMove, Name: "web/old", Target: "web/renamed"},
+		{Kind: BatchAdd, Name: "web/new", Secret: []byte("x")},
+	}, "Apply batch")
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+
+	output, err := git(dir, nil, "show", "--name-status", "--format=%s", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Fields(string(output))
+	expected := []string{"Apply", "batch", "A", "web/new.pass", "R100", "web/old.pass", "web/renamed.pass"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected commit %v, got %v", expected, got)
+	}
+	if status, _ := git(dir, nil, "status", "--porcelain", "--untracked-files=no"); len(status) != 0 {
+		t.Errorf("Expected everything committed, got %s", status)
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// NewEntry is an entry added in bulk
+type NewEntry struct {
+	Name   string
+	Secret []byte
+}
+
+// AddEntries adds many entries on the worker pool, replacing existing ones
+// like Add. It returns the names of the entries written, in order, which are
+// all of them unless an error stopped the run.
+func (s *Store) AddEntries(entries []NewEntry) ([]string, error) {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name
+	}
+
+	// Each worker only sets its own element
+	written := make([]bool, len(entries))
+	err := s.forEach(names, func(i int, name string) error {
+		if err := s.Add(name, entries[i].Secret); err != nil {
+			return err
+		}
+		written[i] = true
+		return nil
+	})
+
+	var added []string
+	for i, ok := range written {
+		if ok {
+			added = append(added, names[i])
+		}
+	}
+	return added, err
+}
+
+// ReadEntries decrypts many entries on the worker pool and calls fn with each
+// secret, or the error reading it, one call at a time. The secret is wiped
+// once fn returns. An error returned by fn stops the run.
+func (s *Store) ReadEntries(names []string, fn func(name string, secret []byte, err error) error) error {
+	var mu sync.Mutex
+	return s.forEach(names, func(_ int, name string) error {
+		secret, err := s.Get(name)
+		defer secure.Wipe(secret)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return fn(name, secret, err)
+	})
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAddEntries(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	store.SetWorkers(2)
+
+	added, err := store.AddEntries([]NewEntry{
+		{Name: "a", Secret: []byte("one")},
+		{Name: "b", Secret: []byte("two")},
+		{Name: ".passh/c", Secret: []byte("three")},
+	})
+	if err == nil {
+		t.Fatal("Expected the reserved name to fail")
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		if name == ".passh/c" {
+			t.Errorf("Reported %s as added", name)
+		}
+	}
+
+	names, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, added) {
+		t.Errorf("Reported %v as added, but the store has %v", added, names)
+	}
+}
+
+func TestReadEntries(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	for _, name := range []string{"a", "b", "c"} {
+		if err := store.Add(name, []byte("secret-"+name)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	secrets := make(map[string]string)
+	var failed []string
+	err := store.ReadEntries([]string{"a", "b", "c", "missing"}, func(name string, secret []byte, err error) error {
+		if err != nil {
+			failed = append(failed, name)
+			return nil
+		}
+		secrets[name] = string(secret)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadEntries failed: %v", err)
+	}
+	if len(secrets) != 3 || secrets["b"] != "secret-b" {
+		t.Errorf("Unexpected secrets: %v", secrets)
+	}
+	if len(failed) != 1 || failed[0] != "missing" {
+		t.Errorf("Expected 'missing' to fail, got %v", failed)
+	}
+}
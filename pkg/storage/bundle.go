@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// bundleVersion is the version of the bundle format
+const bundleVersion = 1
+
+// BundleHeader is the unencrypted part of a bundle. It is authenticated by a
+// digest inside the encrypted payload, so it cannot be altered unnoticed.
+type BundleHeader struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	Purpose   string    `json:"purpose"`
+	Created   time.Time `json:"created"`
+	NotBefore time.Time `json:"not_before,omitempty"`
+	// NotAfter is a pointer so headers without it encode as before
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+	Recipient string     `json:"recipient"`
+	Entries   []string   `json:"entries"`
+}
+
+// bundleFile is the on-disk layout of a bundle
+type bundleFile struct {
+	BundleHeader
+	Payload string `json:"payload"`
+}
+
+// bundlePayload is the encrypted part of a bundle
+type bundlePayload struct {
+	HeaderDigest string            `json:"header_digest"`
+	Entries      map[string][]byte `json:"entries"`
+}
+
+var (
+	// ErrBundleLocked is returned when a bundle is opened before its not-before time
+	ErrBundleLocked = errors.New("bundle is time-locked")
+	// ErrBundleExpired is returned when a bundle is opened after its not-after time
+	ErrBundleExpired = errors.New("bundle has expired")
+)
+
+// Bundle is a decrypted bundle of entries
+type Bundle struct {
+	Header  BundleHeader
+	Entries map[string][]byte
+}
+
+// ExportBundle decrypts the named entries and packs them into a standalone
+// bundle encrypted with the recipient's encryptor, for handing entries to
+// someone without giving them access to the store. The bundle cannot be
+// opened with OpenBundle before notBefore (zero means immediately) or after
+// notAfter (zero means never).
+func (s *Store) ExportBundle(names []string, recipient crypto.Encryptor, recipientID, purpose string, notBefore, notAfter time.Time) ([]byte, *BundleHeader, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate bundle id: %w", err)
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	header := BundleHeader{
+		Version:   bundleVersion,
+		ID:        hex.EncodeToString(id),
+		Purpose:   purpose,
+		Created:   time.Now().UTC().Truncate(time.Second),
+		Recipient: recipientID,
+		Entries:   sorted,
+	}
+	if !notBefore.IsZero() {
+		header.NotBefore = notBefore.UTC().Truncate(time.Second)
+	}
+	if !notAfter.IsZero() {
+		expires := notAfter.UTC().Truncate(time.Second)
+		header.NotAfter = &expires
+	}
+
+	digest, err := headerDigest(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := bundlePayload{HeaderDigest: digest, Entries: make(map[string][]byte, len(sorted))}
+	defer func() {
+		for _, secret := range payload.Entries {
+			secure.Wipe(secret)
+		}
+	}()
+	secrets := make([][]byte, len(sorted))
+	err = s.forEach(sorted, func(i int, name string) error {
+		secret, err := s.Get(name)
+		if err != nil {
+			return fmt.Errorf("failed to export '%s': %w", name, err)
+		}
+		secrets[i] = secret
+		return nil
+	})
+	for i, secret := range secrets {
+		if secret != nil {
+			payload.Entries[sorted[i]] = secret
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	encrypted, err := recipient.Encrypt(plaintext)
+	secure.Wipe(plaintext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encryption failed: %w", err)
+	}
+
+	data, err := json.MarshalIndent(bundleFile{BundleHeader: header, Payload: encrypted}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+	return data, &header, nil
+}
+
+// ReadBundleHeader returns the header of a bundle without decrypting it
+func ReadBundleHeader(data []byte) (*BundleHeader, error) {
+	var file bundleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if file.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", file.Version)
+	}
+	return &file.BundleHeader, nil
+}
+
+// OpenBundle decrypts a bundle with the given encryptor and checks that its
+// header was not tampered with. It refuses to open bundles whose not-before
+// time has not been reached yet, or whose not-after time has passed.
+func OpenBundle(data []byte, encryptor crypto.Encryptor, now time.Time) (*Bundle, error) {
+	var file bundleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if file.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", file.Version)
+	}
+
+	if !file.NotBefore.IsZero() && now.Before(file.NotBefore) {
+		return nil, fmt.Errorf("%w until %s", ErrBundleLocked, file.NotBefore.Local().Format("2006-01-02 15:04"))
+	}
+	if file.NotAfter != nil && !now.Before(*file.NotAfter) {
+		return nil, fmt.Errorf("%w on %s", ErrBundleExpired, file.NotAfter.Local().Format("2006-01-02 15:04"))
+	}
+
+	plaintext, err := encryptor.Decrypt(file.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+	defer secure.Wipe(plaintext)
+
+	var payload bundlePayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("invalid bundle payload: %w", err)
+	}
+
+	digest, err := headerDigest(file.BundleHeader)
+	if err != nil {
+		return nil, err
+	}
+	if digest != payload.HeaderDigest {
+		return nil, errors.New("bundle header has been modified")
+	}
+
+	return &Bundle{Header: file.BundleHeader, Entries: payload.Entries}, nil
+}
+
+// Wipe clears the decrypted entries held by the bundle
+func (b *Bundle) Wipe() {
+	for name, secret := range b.Entries {
+		secure.Wipe(secret)
+		delete(b.Entries, name)
+	}
+}
+
+// headerDigest hashes the canonical encoding of a bundle header
+func headerDigest(header BundleHeader) (string, error) {
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode bundle header: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
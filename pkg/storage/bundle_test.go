@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	for name, password := range map[string]string{"bank": "one", "email/work": "two", "other": "three"} {
+		if err := store.Add(name, []byte(password)); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+
+	data, header, err := store.ExportBundle([]string{"email/work", "bank"}, &MockEncryptor{}, "SHA256:test", "emergency", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to export bundle: %v", err)
+	}
+	if len(header.Entries) != 2 || header.Entries[0] != "bank" {
+		t.Fatalf("Unexpected bundle entries: %v", header.Entries)
+	}
+
+	bundle, err := OpenBundle(data, &MockEncryptor{}, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	if string(bundle.Entries["email/work"]) != "two" {
+		t.Errorf("Expected 'two', got '%s'", bundle.Entries["email/work"])
+	}
+	if _, ok := bundle.Entries["other"]; ok {
+		t.Error("Bundle contains an entry that was not exported")
+	}
+}
+
+func TestBundleTimeLock(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := store.Add("bank", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	notBefore := time.Now().Add(30 * 24 * time.Hour)
+	data, _, err := store.ExportBundle([]string{"bank"}, &MockEncryptor{}, "SHA256:test", "emergency", notBefore, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to export bundle: %v", err)
+	}
+
+	if _, err := OpenBundle(data, &MockEncryptor{}, time.Now()); !errors.Is(err, ErrBundleLocked) {
+		t.Fatalf("Expected ErrBundleLocked, got %v", err)
+	}
+	if _, err := OpenBundle(data, &MockEncryptor{}, notBefore.Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to open bundle after delay: %v", err)
+	}
+
+	// Moving the not-before time must be detected
+	header, err := ReadBundleHeader(data)
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	tampered := bytes.Replace(data, []byte(header.NotBefore.Format(time.RFC3339)), []byte("2000-01-01T00:00:00Z"), 1)
+	if _, err := OpenBundle(tampered, &MockEncryptor{}, time.Now()); err == nil {
+		t.Fatal("Expected tampered bundle to be rejected")
+	}
+}
+
+func TestBundleExpiry(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := store.Add("bank", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	// Bundles without an expiry keep the header encoding of older versions
+	data, _, err := store.ExportBundle([]string{"bank"}, &MockEncryptor{}, "SHA256:test", "share", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to export bundle: %v", err)
+	}
+	if bytes.Contains(data, []byte("not_after")) {
+		t.Errorf("Expected no expiry in the header:\n%s", data)
+	}
+
+	notAfter := time.Now().Add(7 * 24 * time.Hour)
+	data, _, err = store.ExportBundle([]string{"bank"}, &MockEncryptor{}, "SHA256:test", "share", time.Time{}, notAfter)
+	if err != nil {
+		t.Fatalf("Failed to export bundle: %v", err)
+	}
+	if _, err := OpenBundle(data, &MockEncryptor{}, time.Now()); err != nil {
+		t.Fatalf("Failed to open bundle before it expired: %v", err)
+	}
+	if _, err := OpenBundle(data, &MockEncryptor{}, notAfter.Add(time.Minute)); !errors.Is(err, ErrBundleExpired) {
+		t.Fatalf("Expected ErrBundleExpired, got %v", err)
+	}
+
+	// Extending the expiry must be detected
+	tampered := bytes.Replace(data, []byte(`"not_after": "`+notAfter.UTC().Truncate(time.Second).Format(time.RFC3339)),
+		[]byte(`"not_after": "2999-01-01T00:00:00Z`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatal("Failed to tamper with the expiry")
+	}
+	if _, err := OpenBundle(tampered, &MockEncryptor{}, time.Now()); err == nil {
+		t.Error("Expected a modified expiry to be detected")
+	}
+}
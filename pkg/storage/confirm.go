@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNotConfirmed is returned when releasing an entry marked "confirm: true"
+// was not confirmed
+var ErrNotConfirmed = errors.New("release was not confirmed")
+
+// NeedsConfirmation reports whether an entry has a "confirm: true" line after
+// the password. Such entries are only released once the user confirms, so
+// scripts can't read them unnoticed.
+func NeedsConfirmation(secret []byte) bool {
+	value, ok := entryField(secret, "confirm")
+	return ok && strings.EqualFold(value, "true")
+}
+
+// SetConfirm makes the store call confirm before releasing an entry marked
+// "confirm: true". An error from confirm is returned instead of the entry.
+func (s *Store) SetConfirm(confirm func(name string) error) {
+	s.confirm = confirm
+}
+
+// confirmRelease asks to release an entry that needs confirmation
+func (s *Store) confirmRelease(name string, secret []byte) error {
+	if s.confirm == nil || !NeedsConfirmation(secret) {
+		return nil
+	}
+	return s.confirm(name)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfirmRelease(t *testing.T) {
+	cache := mapCache{}
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	store.SetCache(cache)
+	if err := store.Add("bank", []byte("Xk9#mQ2$vL7@pR4z\nconfirm: true")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("mail", []byte("Bq8!nW3^tY6&hJ1x")); err != nil {
+		t.Fatal(err)
+	}
+
+	var asked []string
+	approve := false
+	store.SetConfirm(func(name string) error {
+		asked = append(asked, name)
+		if !approve {
+			return ErrNotConfirmed
+		}
+		return nil
+	})
+
+	if _, err := store.Get("mail"); err != nil {
+		t.Fatalf("Expected entries without 'confirm: true' to be released, got %v", err)
+	}
+	if _, err := store.Get("bank"); !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("Expected ErrNotConfirmed, got %v", err)
+	}
+	approve = true
+	if secret, err := store.Get("bank"); err != nil || string(secret) != "Xk9#mQ2$vL7@pR4z\nconfirm: true" {
+		t.Fatalf("Expected the confirmed entry, got %q (%v)", secret, err)
+	}
+	if len(asked) != 2 || asked[0] != "bank" {
+		t.Errorf("Expected to be asked twice for bank, got %v", asked)
+	}
+
+	// Checks that don't release the entry don't ask
+	if _, err := store.Audit(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 2 {
+		t.Errorf("Expected the audit not to ask, got %v", asked)
+	}
+
+	// Only the entry without confirmation is cached
+	if len(cache) != 1 {
+		t.Errorf("Expected one cached entry, got %d", len(cache))
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// ChangeKind tells how an entry differs between two states of a store
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "A"
+	Removed  ChangeKind = "D"
+	Modified ChangeKind = "M"
+)
+
+// Version is an entry as of one state of a store. Data, the encrypted
+// content, is nil when only the hash is known, as for the last sync point.
+type Version struct {
+	Hash string
+	Data []byte
+}
+
+// Change describes an entry that differs between two states. Old is empty
+// for added entries and New for removed ones.
+type Change struct {
+	Name string
+	Kind ChangeKind
+	Old  Version
+	New  Version
+}
+
+// Versions returns the current version of every entry, without decrypting
+// them. Entries are keyed by file name, as in sync points and git revisions;
+// EntryName tells the names in stores with encrypted names.
+func (s *Store) Versions() (map[string]Version, error) {
+	files, err := s.raw().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password entries: %w", err)
+	}
+
+	versions := make(map[string]Version, len(files))
+	for _, file := range files {
+		data, err := s.raw().Get(file)
+		if err != nil {
+			return nil, entryError(file, "failed to read password file", err)
+		}
+		versions[file] = Version{Hash: contentHash(data), Data: data}
+	}
+	return versions, nil
+}
+
+// Versions returns the entries as of the sync. Only their hashes are known.
+func (st SyncState) Versions() map[string]Version {
+	versions := make(map[string]Version, len(st.Entries))
+	for name, hash := range st.Entries {
+		versions[name] = Version{Hash: hash}
+	}
+	return versions
+}
+
+// Diff compares two states of a store and returns the changed entries by name
+func Diff(old, new map[string]Version) []Change {
+	var changes []Change
+	for name, o := range old {
+		n, ok := new[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Name: name, Kind: Removed, Old: o})
+		case n.Hash != o.Hash:
+			changes = append(changes, Change{Name: name, Kind: Modified, Old: o, New: n})
+		}
+	}
+	for name, n := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, Change{Name: name, Kind: Added, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// Open decrypts a version of an entry into its secret and metadata
+func (s *Store) Open(name string, version Version) ([]byte, Metadata, error) {
+	if version.Data == nil {
+		return nil, Metadata{}, fmt.Errorf("the content of '%s' is not available", name)
+	}
+
+	plaintext, err := s.decryptEntry(name, version.Data)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return openEntry(plaintext)
+}
+
+// Seal encrypts a secret and its metadata for an entry, as Open reads it,
+// without writing it to the store
+func (s *Store) Seal(name string, secret []byte, meta Metadata) ([]byte, error) {
+	plaintext, err := s.seal(name, secret, meta)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(plaintext)
+
+	encrypted, err := s.encrypt(name, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encryption failed: %w", err)
+	}
+	return encodeEntryFile(encrypted), nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := map[string]Version{
+		"kept":    {Hash: "1"},
+		"changed": {Hash: "2"},
+		"removed": {Hash: "3"},
+	}
+	new := map[string]Version{
+		"kept":    {Hash: "1"},
+		"changed": {Hash: "4"},
+		"added":   {Hash: "5"},
+	}
+
+	var got []string
+	for _, change := range Diff(old, new) {
+		got = append(got, string(change.Kind)+" "+change.Name)
+	}
+	expected := []string{"A added", "M changed", "D removed"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestGitVersions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	run("init", "-q")
+
+	// The store is a subdirectory of the repository
+	dir := filepath.Join(repo, "store")
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("web/mail", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("bank", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "outside.pass"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "first")
+
+	if err := store.Add("web/mail", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("bank"); err != nil {
+		t.Fatal(err)
+	}
+
+	if localDir, ok := LocalDir(store.Backend()); !ok || localDir != dir {
+		t.Fatalf("Expected local directory %s, got %q", dir, localDir)
+	}
+	old, err := GitVersions(dir, "HEAD")
+	if err != nil {
+		t.Fatalf("GitVersions failed: %v", err)
+	}
+	if len(old) != 2 {
+		t.Fatalf("Expected 2 entries at HEAD, got %v", old)
+	}
+	secret, _, err := store.Open("web/mail", old["web/mail"])
+	if err != nil || string(secret) != "first" {
+		t.Errorf("Expected 'first' at HEAD, got %q (%v)", secret, err)
+	}
+
+	current, err := store.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, change := range Diff(old, current) {
+		got = append(got, string(change.Kind)+" "+change.Name)
+	}
+	if expected := []string{"D bank", "M web/mail"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if _, err := GitVersions(dir, "no-such-revision"); err == nil {
+		t.Error("Expected an error for an unknown revision")
+	}
+}
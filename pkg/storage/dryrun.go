@@ -0,0 +1,50 @@
+package storage
+
+import "io"
+
+// DryRunBackend reads from another backend and discards all writes, so an
+// operation can be run to see what it would change
+type DryRunBackend struct {
+	Backend
+}
+
+// NewDryRunBackend wraps backend, which is left untouched. Closing the
+// wrapper does not close backend.
+func NewDryRunBackend(backend Backend) *DryRunBackend {
+	return &DryRunBackend{Backend: backend}
+}
+
+func (d *DryRunBackend) Put(name string, data []byte) error {
+	return nil
+}
+
+func (d *DryRunBackend) Delete(name string) error {
+	return nil
+}
+
+func (d *DryRunBackend) WriteFile(path string, data []byte) error {
+	return nil
+}
+
+func (d *DryRunBackend) CreateFile(path string) (io.WriteCloser, error) {
+	return discardCloser{}, nil
+}
+
+func (d *DryRunBackend) RemoveFile(path string) error {
+	return nil
+}
+
+func (d *DryRunBackend) Close() error {
+	return nil
+}
+
+// discardCloser is a writer that throws everything away
+type discardCloser struct{}
+
+func (discardCloser) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (discardCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExpiryLayout is the format of the date on an "expires:" line
+const ExpiryLayout = "2006-01-02"
+
+// ExpiryWarning is how long before its expiry date an entry is reported as
+// expiring by Audit
+const ExpiryWarning = 30 * 24 * time.Hour
+
+// Expiry returns the date an entry is due for rotation, given on an
+// "expires: YYYY-MM-DD" line after the password. Entries expire at the start
+// of that day in local time. Without such a line the zero time is returned.
+func Expiry(secret []byte) (time.Time, error) {
+	value, ok := entryField(secret, "expires")
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	expires, err := time.ParseInLocation(ExpiryLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date '%s', expected YYYY-MM-DD", value)
+	}
+	return expires, nil
+}
+
+// Expiring returns the indexed entries that expire before the given time,
+// including those already expired, soonest first
+func (i *Index) Expiring(before time.Time) []string {
+	var names []string
+	for name, entry := range i.Entries {
+		if !entry.Expires.IsZero() && entry.Expires.Before(before) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(a, b int) bool {
+		ea, eb := i.Entries[names[a]].Expires, i.Entries[names[b]].Expires
+		if !ea.Equal(eb) {
+			return ea.Before(eb)
+		}
+		return names[a] < names[b]
+	})
+	return names
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	expires, err := Expiry([]byte("secret\nuser: alice\nExpires: 2025-12-01\n"))
+	if err != nil {
+		t.Fatalf("Expiry failed: %v", err)
+	}
+	if expected := time.Date(2025, 12, 1, 0, 0, 0, 0, time.Local); !expires.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, expires)
+	}
+
+	// The password line is never a field
+	if expires, err := Expiry([]byte("expires: 2025-12-01")); err != nil || !expires.IsZero() {
+		t.Errorf("Expected no expiry, got %v (%v)", expires, err)
+	}
+	if _, err := Expiry([]byte("secret\nexpires: next week")); err == nil {
+		t.Error("Expected an invalid date to be rejected")
+	}
+}
+
+func TestExpiringEntries(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index.enc"))
+	now := time.Now()
+	day := func(days int) string {
+		return now.AddDate(0, 0, days).Format(ExpiryLayout)
+	}
+
+	for name, secret := range map[string]string{
+		"expired":  "Xk9#mQ2$vL7@pR4z\nexpires: " + day(-3),
+		"soon":     "Bq8!nW3^tY6&hJ1x\nexpires: " + day(10),
+		"later":    "Tz5%kP8&wN2!cV6q\nexpires: " + day(90),
+		"never":    "Hm3@rL9#xD4$gF7s",
+		"invalid":  "Wy6^bJ1*nK8!pQ3e\nexpires: soon",
+		"nextweek": "Ls2&fG5#hR8@zT4m\nexpires: " + day(7),
+	} {
+		if err := store.Add(name, []byte(secret)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := store.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := index.Expiring(now.Add(ExpiryWarning)); !reflect.DeepEqual(names, []string{"expired", "nextweek", "soon"}) {
+		t.Errorf("Unexpected expiring entries %v", names)
+	}
+
+	findings, err := store.Audit(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]string
+	for _, finding := range findings {
+		got = append(got, [2]string{finding.Name, finding.Kind})
+	}
+	expected := [][2]string{
+		{"expired", FindingExpired},
+		{"invalid", FindingExpired},
+		{"nextweek", FindingExpiring},
+		{"soon", FindingExpiring},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FormatVersion is the version of the entry file format written by this
+// version of passh. Version 0 files, from before the format was versioned,
+// hold only the ciphertext; later versions start with a header line.
+const FormatVersion = 1
+
+// formatMagic starts the header line of versioned entry files, followed by
+// the version number
+const formatMagic = "passh-entry v"
+
+// ErrNewerFormat is returned for entries written by a newer version of passh
+var ErrNewerFormat = errors.New("entry was written by a newer version of passh; upgrade to read it")
+
+// migration upgrades an entry file from one format version to the next
+type migration struct {
+	from        int
+	description string
+	apply       func(s *Store, name string, ciphertext string) (string, error)
+}
+
+// migrations lists every format upgrade in order. Each takes the ciphertext
+// of a file in its from version and returns it in the next version.
+var migrations = []migration{
+	{
+		from:        0,
+		description: "add a format header to entries from before versioning",
+		// The placeholder SSH encoding is kept; version 1 only marks it
+		apply: func(s *Store, name string, ciphertext string) (string, error) {
+			return ciphertext, nil
+		},
+	},
+}
+
+// MigrationResult summarizes a migration
+type MigrationResult struct {
+	// Migrated lists the entries upgraded, by file name
+	Migrated []string
+	// Steps describes the migrations that were applied
+	Steps []string
+}
+
+// encodeEntryFile prepends the format header to the ciphertext of an entry
+func encodeEntryFile(ciphertext string) []byte {
+	return []byte(formatMagic + strconv.Itoa(FormatVersion) + "\n" + ciphertext)
+}
+
+// decodeEntryFile returns the format version and ciphertext of an entry
+// file. Files without a header are version 0.
+func decodeEntryFile(data []byte) (int, string, error) {
+	if !bytes.HasPrefix(data, []byte(formatMagic)) {
+		return 0, string(data), nil
+	}
+
+	header, ciphertext, ok := strings.Cut(string(data[len(formatMagic):]), "\n")
+	version, err := strconv.Atoi(header)
+	if !ok || err != nil || version < 1 {
+		return 0, "", errors.New("invalid entry format header")
+	}
+	if version > FormatVersion {
+		return version, "", fmt.Errorf("%w (format version %d)", ErrNewerFormat, version)
+	}
+	return version, ciphertext, nil
+}
+
+// FormatVersions counts the entry files of the store by format version,
+// without decrypting them
+func (s *Store) FormatVersions() (map[int]int, error) {
+	files, err := s.raw().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password entries: %w", err)
+	}
+
+	counts := make(map[int]int)
+	err = s.forEach(files, func(_ int, file string) error {
+		data, err := s.raw().Get(file)
+		if err != nil {
+			return entryError(file, "failed to read password file", err)
+		}
+		version, _, err := decodeEntryFile(data)
+		if err != nil && !errors.Is(err, ErrNewerFormat) {
+			return fmt.Errorf("entry '%s': %w", file, err)
+		}
+		s.mu.Lock()
+		counts[version]++
+		s.mu.Unlock()
+		return nil
+	})
+	return counts, err
+}
+
+// Migrate upgrades every entry file to the current format version, applying
+// the migrations between its version and the current one in turn
+func (s *Store) Migrate() (*MigrationResult, error) {
+	files, err := s.raw().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password entries: %w", err)
+	}
+
+	migrated := make([]bool, len(files))
+	steps := make([]bool, len(migrations))
+	hashes := make(map[string]string)
+	err = s.forEach(files, func(i int, file string) error {
+		data, err := s.raw().Get(file)
+		if err != nil {
+			return entryError(file, "failed to read password file", err)
+		}
+		version, ciphertext, err := decodeEntryFile(data)
+		if err != nil {
+			return fmt.Errorf("entry '%s': %w", file, err)
+		}
+		if version == FormatVersion {
+			return nil
+		}
+
+		for j, step := range migrations {
+			if step.from < version {
+				continue
+			}
+			if ciphertext, err = step.apply(s, file, ciphertext); err != nil {
+				return fmt.Errorf("failed to migrate '%s' from format version %d: %w", file, step.from, err)
+			}
+			s.mu.Lock()
+			steps[j] = true
+			s.mu.Unlock()
+		}
+
+		upgraded := encodeEntryFile(ciphertext)
+		if err := s.raw().Put(file, upgraded); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", file, err)
+		}
+		s.mu.Lock()
+		hashes[contentHash(data)] = contentHash(upgraded)
+		s.mu.Unlock()
+		migrated[i] = true
+		return nil
+	})
+	s.rehashIndex(hashes)
+
+	result := &MigrationResult{}
+	for i, file := range files {
+		if migrated[i] {
+			result.Migrated = append(result.Migrated, file)
+		}
+	}
+	for j, step := range migrations {
+		if steps[j] {
+			result.Steps = append(result.Steps, fmt.Sprintf("v%d -> v%d: %s", step.from, step.from+1, step.description))
+		}
+	}
+	return result, err
+}
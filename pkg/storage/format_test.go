@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntryFileFormat(t *testing.T) {
+	version, ciphertext, err := decodeEntryFile(encodeEntryFile("abc:def"))
+	if err != nil || version != FormatVersion || ciphertext != "abc:def" {
+		t.Errorf("Expected a round trip, got %d %q (%v)", version, ciphertext, err)
+	}
+
+	// Files from before versioning are read as they are
+	if version, ciphertext, err := decodeEntryFile([]byte("abc:def")); err != nil || version != 0 || ciphertext != "abc:def" {
+		t.Errorf("Expected version 0, got %d %q (%v)", version, ciphertext, err)
+	}
+
+	if _, _, err := decodeEntryFile([]byte("passh-entry v99\nabc")); !errors.Is(err, ErrNewerFormat) {
+		t.Errorf("Expected ErrNewerFormat, got %v", err)
+	}
+	for _, invalid := range []string{"passh-entry vx\nabc", "passh-entry v0\nabc", "passh-entry v1"} {
+		if _, _, err := decodeEntryFile([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index.enc"))
+	mustPut(t, backend, "legacy", "Xk9#mQ2$vL7@pR4z_encrypted")
+	if err := store.Add("current", []byte("Bq8!nW3^tY6&hJ1x")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := store.Index(); err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+
+	counts, err := store.FormatVersions()
+	if err != nil {
+		t.Fatalf("FormatVersions failed: %v", err)
+	}
+	if !reflect.DeepEqual(counts, map[int]int{0: 1, FormatVersion: 1}) {
+		t.Errorf("Expected one entry per version, got %v", counts)
+	}
+
+	result, err := store.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Migrated, []string{"legacy"}) || len(result.Steps) != 1 {
+		t.Errorf("Expected legacy to be migrated in one step, got %+v", result)
+	}
+	if data := mustGet(t, backend, "legacy"); !strings.HasPrefix(data, "passh-entry v1\n") {
+		t.Errorf("Expected a format header, got %q", data)
+	}
+	if secret, err := store.Get("legacy"); err != nil || string(secret) != "Xk9#mQ2$vL7@pR4z" {
+		t.Errorf("Expected the content to be kept, got %q (%v)", secret, err)
+	}
+
+	// The index knows the new file, so nothing needs decrypting again
+	index, _ := store.Index()
+	if data, _ := backend.Get("legacy"); index.Entries["legacy"].Hash != contentHash(data) {
+		t.Error("Expected the index to be updated")
+	}
+
+	if result, err := store.Migrate(); err != nil || len(result.Migrated) != 0 {
+		t.Errorf("Expected nothing left to migrate, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileSystem abstracts the file operations of the directory tree backend, so
+// entries can live on the local disk or on a remote machine
+type fileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Open(name string) (io.ReadCloser, error)
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Remove(name string) error
+	Chmod(name string, perm os.FileMode) error
+	// Chown changes the group of a file, keeping its owner
+	Chown(name string, gid int) error
+	Stat(name string) (os.FileInfo, error)
+	Walk(root string, fn filepath.WalkFunc) error
+	Close() error
+}
+
+// localFS is the default fileSystem backed by the local disk
+type localFS struct{}
+
+func (localFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (localFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (localFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (localFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (localFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (localFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (localFS) Chmod(name string, perm os.FileMode) error {
+	return os.Chmod(name, perm)
+}
+
+func (localFS) Chown(name string, gid int) error {
+	return os.Chown(name, -1, gid)
+}
+
+func (localFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localFS) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+func (localFS) Close() error {
+	return nil
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// quarantineDir holds entry files that Check found corrupt, moved out of the
+// way so they are no longer listed but can still be inspected or restored
+const quarantineDir = metaDir + "quarantine/"
+
+// staleTempAge is how old a temporary file must be before Check reports it,
+// so files an editor or another passh is still using are left alone
+const staleTempAge = time.Hour
+
+// Kinds of problems found by Check
+const (
+	// ProblemCorrupt is an entry file that can't be parsed or decrypted
+	ProblemCorrupt = "corrupt"
+	// ProblemOrphaned is an entry file in a store with encrypted names that
+	// holds an entry belonging under another file name
+	ProblemOrphaned = "orphaned"
+	// ProblemUnreadable is an entry encrypted to the loaded keys that they
+	// fail to decrypt; it may be fine for other keys, so it is not repaired
+	ProblemUnreadable = "unreadable"
+	// ProblemIndex is an entry the index is missing, out of date or still
+	// lists after it was removed
+	ProblemIndex = "index"
+	// ProblemEmptyDir is a directory without any files left in it
+	ProblemEmptyDir = "empty-dir"
+	// ProblemTempFile is a stale temporary or editor backup file
+	ProblemTempFile = "temp-file"
+	// ProblemPermissions is a file or directory others can access
+	ProblemPermissions = "permissions"
+)
+
+// Problem is an issue found by Check
+type Problem struct {
+	Kind string
+	// Path is the entry or file concerned, relative to the store
+	Path   string
+	Detail string
+	// Fixed tells whether the problem was repaired
+	Fixed bool
+}
+
+// Check scans the store for entry files that fail to parse or decrypt, drift
+// between the index and the entries, and, for stores kept in a directory
+// tree, empty directories, stale temporary files and loose permissions. With
+// fix it makes the repairs that lose nothing: corrupt files are moved to
+// .passh/quarantine, the index is rebuilt, empty directories and temporary
+// files are removed and permissions are tightened.
+func (s *Store) Check(fix bool) ([]Problem, error) {
+	problems, err := s.checkEntries(fix)
+	if err != nil {
+		return problems, err
+	}
+
+	if tree, ok := s.raw().(*fileBackend); ok {
+		treeProblems, err := tree.check(fix)
+		problems = append(problems, treeProblems...)
+		if err != nil {
+			return problems, err
+		}
+	}
+
+	// Entries with problems of their own are not reported again for the index
+	reported := make(map[string]bool, len(problems))
+	for _, problem := range problems {
+		reported[s.EntryName(problem.Path)] = true
+	}
+	indexProblems, err := s.checkIndex(fix, reported)
+	problems = append(problems, indexProblems...)
+	return problems, err
+}
+
+// checkEntries looks for entry files that fail to parse or decrypt, and
+// quarantines them with fix
+func (s *Store) checkEntries(fix bool) ([]Problem, error) {
+	files, err := s.raw().List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list password entries: %w", err)
+	}
+	encryptedNames, err := s.NamesEncrypted()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var problems []Problem
+	err = s.forEach(files, func(_ int, file string) error {
+		problem := s.checkEntryFile(file, encryptedNames)
+		if problem == nil {
+			return nil
+		}
+		if fix && problem.Kind != ProblemUnreadable {
+			if err := s.quarantine(file); err != nil {
+				return err
+			}
+			problem.Fixed = true
+		}
+		mu.Lock()
+		problems = append(problems, *problem)
+		mu.Unlock()
+		return nil
+	})
+	sortProblems(problems)
+	return problems, err
+}
+
+// checkEntryFile returns the problem with an entry file, if any. Entries not
+// encrypted to the loaded keys can't be checked and are skipped.
+func (s *Store) checkEntryFile(file string, encryptedNames bool) *Problem {
+	corrupt := func(err error) *Problem {
+		return &Problem{Kind: ProblemCorrupt, Path: file, Detail: err.Error()}
+	}
+
+	data, err := s.raw().Get(file)
+	if err != nil {
+		return corrupt(err)
+	}
+	_, ciphertext, err := decodeEntryFile(data)
+	if errors.Is(err, ErrNewerFormat) {
+		return nil
+	}
+	if err != nil {
+		return corrupt(err)
+	}
+
+	if encryptor, ok := s.encryptor.(crypto.RecipientEncryptor); ok {
+		recipients, err := encryptor.Recipients(ciphertext)
+		if err != nil {
+			return corrupt(err)
+		}
+		if len(missingKeys(encryptor.PublicKeys(), recipients)) == len(encryptor.PublicKeys()) {
+			return nil
+		}
+	}
+
+	plaintext, err := s.encryptor.Decrypt(ciphertext)
+	if errors.Is(err, crypto.ErrDecryptFailed) {
+		return &Problem{Kind: ProblemUnreadable, Path: file, Detail: err.Error()}
+	}
+	if err != nil {
+		return corrupt(err)
+	}
+	defer secure.Wipe(plaintext)
+
+	_, meta, err := openEntry(plaintext)
+	if err != nil {
+		return corrupt(err)
+	}
+	if encryptedNames {
+		name := meta.Name
+		if strings.HasSuffix(file, ConflictSuffix) {
+			name += ConflictSuffix
+		}
+		if expected, err := s.entryFile(name); err == nil && (meta.Name == "" || expected != file) {
+			return &Problem{Kind: ProblemOrphaned, Path: file, Detail: "the entry does not belong under this file name"}
+		}
+	}
+	return nil
+}
+
+// quarantine moves an entry file into the quarantine directory
+func (s *Store) quarantine(file string) error {
+	data, err := s.raw().Get(file)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	target := quarantineDir + file + "." + time.Now().UTC().Format("20060102T150405Z")
+	if err := s.raw().WriteFile(target, data); err != nil {
+		return fmt.Errorf("failed to quarantine '%s': %w", file, err)
+	}
+	if err := s.raw().Delete(file); err != nil {
+		return fmt.Errorf("failed to remove '%s' after quarantining it: %w", file, err)
+	}
+	s.removeFromIndex(s.EntryName(file))
+	return nil
+}
+
+// checkIndex compares the index with the entries other than those skipped,
+// and rebuilds it with fix. Stores without an index have nothing to check.
+func (s *Store) checkIndex(fix bool, skip map[string]bool) ([]Problem, error) {
+	s.indexMu.Lock()
+	index, err := s.loadIndex()
+	s.indexMu.Unlock()
+	if err != nil {
+		return []Problem{{Kind: ProblemIndex, Detail: err.Error()}}, nil
+	}
+	if index == nil {
+		return nil, nil
+	}
+
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+		if skip[name] {
+			continue
+		}
+		entry, indexed := index.Entries[name]
+		if !indexed {
+			problems = append(problems, Problem{Kind: ProblemIndex, Path: name, Detail: "missing from the index"})
+			continue
+		}
+		data, err := s.entries().Get(name)
+		if err != nil {
+			return nil, entryError(name, "failed to read password file", err)
+		}
+		if entry.Hash != contentHash(data) {
+			problems = append(problems, Problem{Kind: ProblemIndex, Path: name, Detail: "changed since it was indexed"})
+		}
+	}
+	for _, name := range index.Names() {
+		if !present[name] && !skip[name] {
+			problems = append(problems, Problem{Kind: ProblemIndex, Path: name, Detail: "indexed but no longer in the store"})
+		}
+	}
+
+	if fix && len(problems) > 0 {
+		if _, err := s.RebuildIndex(); err != nil {
+			return problems, err
+		}
+		for i := range problems {
+			problems[i].Fixed = true
+		}
+	}
+	sortProblems(problems)
+	return problems, nil
+}
+
+// check looks for empty directories, stale temporary files and files others
+// can access in the directory tree. The .git directory is left alone.
+func (b *fileBackend) check(fix bool) ([]Problem, error) {
+	var problems []Problem
+	err := b.walk(func(path, rel string, info os.FileInfo) error {
+		problem, err := b.checkMode(path, rel, info, fix)
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !isTempFile(info.Name()) || time.Since(info.ModTime()) <= staleTempAge {
+			return nil
+		}
+		problem = &Problem{Kind: ProblemTempFile, Path: rel, Detail: "left over from " + info.ModTime().Format(time.DateTime)}
+		if fix {
+			if err := b.fs.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove '%s': %w", rel, err)
+			}
+			problem.Fixed = true
+		}
+		problems = append(problems, *problem)
+		return nil
+	})
+	if err != nil {
+		return problems, fmt.Errorf("failed to scan the store: %w", err)
+	}
+
+	empty, err := b.emptyDirs(nil, !fix)
+	for _, dir := range empty {
+		problems = append(problems, Problem{Kind: ProblemEmptyDir, Path: dir, Detail: "holds no files", Fixed: fix})
+	}
+	sortProblems(problems)
+	return problems, err
+}
+
+// emptyDirs returns the directories of the tree that hold no files apart
+// from those in gone, and unless dryRun removes them. Paths are relative to
+// the root, with slashes, in sorted order.
+func (b *fileBackend) emptyDirs(gone map[string]bool, dryRun bool) ([]string, error) {
+	var dirs []string
+	nonEmpty := map[string]bool{b.rootDir: true}
+	err := b.walk(func(path, rel string, info os.FileInfo) error {
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if gone[rel] {
+			return nil
+		}
+		for dir := filepath.Dir(path); !nonEmpty[dir]; dir = filepath.Dir(dir) {
+			nonEmpty[dir] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the store: %w", err)
+	}
+
+	// Remove the deepest directories first, so their parents are empty
+	var empty []string
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if nonEmpty[dir] {
+			continue
+		}
+		rel, _ := filepath.Rel(b.rootDir, dir)
+		rel = filepath.ToSlash(rel)
+		if !dryRun {
+			if err := b.fs.Remove(dir); err != nil {
+				sort.Strings(empty)
+				return empty, fmt.Errorf("failed to remove '%s': %w", rel, err)
+			}
+		}
+		empty = append(empty, rel)
+	}
+	sort.Strings(empty)
+	return empty, nil
+}
+
+// isTempFile reports whether a file name looks like a temporary or editor
+// backup file
+func isTempFile(name string) bool {
+	for _, suffix := range []string{".tmp", "~", ".swp", ".swo"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, ".#")
+}
+
+// sortProblems orders problems by path
+func sortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func problemKinds(problems []Problem) map[string]string {
+	kinds := make(map[string]string, len(problems))
+	for _, problem := range problems {
+		kinds[problem.Path] = problem.Kind
+	}
+	return kinds
+}
+
+func TestCheckQuarantinesCorruptEntries(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index"))
+	if err := store.Add("web/github", []byte("Xk9#mQ2$vL7@pR4z")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := store.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+	mustPut(t, backend, "web/broken", "passh-entry vX\ndata")
+
+	problems, err := store.Check(false)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	want := map[string]string{"web/broken": ProblemCorrupt}
+	if kinds := problemKinds(problems); !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("Expected %v, got %v", want, kinds)
+	}
+	if problems[0].Fixed {
+		t.Error("Expected nothing to be fixed without fix")
+	}
+
+	problems, err = store.Check(true)
+	if err != nil {
+		t.Fatalf("Check with fix failed: %v", err)
+	}
+	if len(problems) != 1 || !problems[0].Fixed {
+		t.Fatalf("Expected the corrupt entry to be fixed, got %+v", problems)
+	}
+	if names, _ := store.List(); !reflect.DeepEqual(names, []string{"web/github"}) {
+		t.Errorf("Expected the corrupt entry to be gone, got %v", names)
+	}
+	quarantined, err := backend.ListFiles("")
+	if err != nil || len(quarantined) != 1 {
+		t.Errorf("Expected one quarantined file, got %v (%v)", quarantined, err)
+	}
+
+	if problems, err := store.Check(false); err != nil || len(problems) != 0 {
+		t.Errorf("Expected a clean store after fixing, got %+v (%v)", problems, err)
+	}
+}
+
+func TestCheckIndexDrift(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index"))
+	for _, name := range []string{"mail", "bank"} {
+		if err := store.Add(name, []byte("Tz5%kP8&wN2!cV6q")); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if _, err := store.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+
+	// Changes behind the store's back
+	if err := backend.Delete("mail"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	mustPut(t, backend, "bank", string(encodeEntryFile("Bq8!nW3^tY6&hJ1x_encrypted")))
+	mustPut(t, backend, "wifi", string(encodeEntryFile("Hn4@rE7*uM1#kD9s_encrypted")))
+
+	problems, err := store.Check(true)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	want := map[string]string{"mail": ProblemIndex, "bank": ProblemIndex, "wifi": ProblemIndex}
+	if kinds := problemKinds(problems); !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("Expected %v, got %v", want, kinds)
+	}
+	if problems, err := store.Check(false); err != nil || len(problems) != 0 {
+		t.Errorf("Expected the rebuilt index to match, got %+v (%v)", problems, err)
+	}
+}
+
+func TestCheckDirectoryTree(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend failed: %v", err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("web/github", []byte("Xk9#mQ2$vL7@pR4z")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "old", "empty"), 0700); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	stale := filepath.Join(dir, "web", "github.pass.tmp")
+	if err := os.WriteFile(stale, []byte("partial"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	old := time.Now().Add(-2 * staleTempAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "web", "fresh.swp"), []byte("editing"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "web", "github.pass"), 0644); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+
+	problems, err := store.Check(true)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	want := map[string]string{
+		"old":                 ProblemEmptyDir,
+		"old/empty":           ProblemEmptyDir,
+		"web/github.pass":     ProblemPermissions,
+		"web/github.pass.tmp": ProblemTempFile,
+	}
+	if kinds := problemKinds(problems); !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("Expected %v, got %v", want, kinds)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty directories to be removed, got %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale temp file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web", "fresh.swp")); err != nil {
+		t.Errorf("Expected a recent temp file to be kept: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "web", "github.pass")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the entry to be made private, got %v (%v)", info.Mode(), err)
+	}
+}
+
+func TestConfiguredFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0750); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	backend, err := OpenBackendWithOptions(dir, BackendOptions{FileMode: 0640, Group: strconv.Itoa(os.Getgid())})
+	if err != nil {
+		t.Fatalf("OpenBackendWithOptions failed: %v", err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("team/db", []byte("Xk9#mQ2$vL7@pR4z")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{"team/db.pass": 0640, "team": 0750} {
+		info, err := os.Stat(filepath.Join(dir, path))
+		if err != nil || info.Mode().Perm() != want {
+			t.Errorf("Expected %s to have mode %04o, got %v (%v)", path, want, info.Mode(), err)
+		}
+	}
+	if problems, err := store.CheckPermissions(false); err != nil || len(problems) != 0 {
+		t.Errorf("Expected the configured mode to be accepted, got %+v (%v)", problems, err)
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "team", "db.pass"), 0644); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	problems, err := store.CheckPermissions(true)
+	if err != nil || len(problems) != 1 {
+		t.Fatalf("Expected the world-readable entry to be reported, got %+v (%v)", problems, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "team", "db.pass")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the entry to be set back to 0640, got %v (%v)", info.Mode(), err)
+	}
+
+	if _, err := OpenBackendWithOptions(dir, BackendOptions{Group: "no-such-group-passh"}); err == nil {
+		t.Error("Expected an unknown group to be rejected")
+	}
+}
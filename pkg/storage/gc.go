@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GCResult lists what GC removed, or would remove in a dry run
+type GCResult struct {
+	// EmptyDirs are directories without any files left in them
+	EmptyDirs []string
+	// TempFiles are stale temporary and editor backup files
+	TempFiles []string
+	// Quarantined are files fsck quarantined longer ago than the retention
+	Quarantined []string
+	// IndexEntries are names the index still lists after their entry was removed
+	IndexEntries []string
+	// Reclaimed is the number of bytes freed, including by compacting git
+	Reclaimed int64
+}
+
+// GC removes what the store no longer needs: empty directories, stale
+// temporary files, files quarantined by fsck before keepQuarantine ago, and
+// index entries of removed entries. For local stores that are a git
+// repository, it also compacts the repository with 'git gc'. With dryRun
+// nothing is removed.
+func (s *Store) GC(keepQuarantine time.Duration, dryRun bool) (*GCResult, error) {
+	result := &GCResult{}
+	if tree, ok := s.raw().(*fileBackend); ok {
+		if err := tree.gc(result, keepQuarantine, dryRun); err != nil {
+			return result, err
+		}
+	}
+	if err := s.gcIndex(result, dryRun); err != nil {
+		return result, err
+	}
+
+	if dir, ok := LocalDir(s.raw()); ok && !dryRun {
+		reclaimed, err := gcGit(dir)
+		if err != nil {
+			return result, err
+		}
+		result.Reclaimed += reclaimed
+	}
+	return result, nil
+}
+
+// gc removes stale temporary files, expired quarantined files and the
+// directories left empty in the tree
+func (b *fileBackend) gc(result *GCResult, keepQuarantine time.Duration, dryRun bool) error {
+	gone := map[string]bool{}
+	cutoff := time.Now().Add(-keepQuarantine)
+
+	err := b.walk(func(path, rel string, info os.FileInfo) error {
+		if info.IsDir() {
+			return nil
+		}
+
+		var list *[]string
+		switch {
+		case strings.HasPrefix(rel, quarantineDir) && info.ModTime().Before(cutoff):
+			list = &result.Quarantined
+		case isTempFile(info.Name()) && time.Since(info.ModTime()) > staleTempAge:
+			list = &result.TempFiles
+		default:
+			return nil
+		}
+		*list = append(*list, rel)
+		result.Reclaimed += info.Size()
+		gone[rel] = true
+		if dryRun {
+			return nil
+		}
+		if err := b.fs.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove '%s': %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan the store: %w", err)
+	}
+
+	result.EmptyDirs, err = b.emptyDirs(gone, dryRun)
+	return err
+}
+
+// gcIndex drops the index entries of entries that no longer exist
+func (s *Store) gcIndex(result *GCResult, dryRun bool) error {
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	index, err := s.loadIndex()
+	if err != nil || index == nil {
+		// An unreadable index is rebuilt by 'passh index rebuild' instead
+		return nil
+	}
+	for _, name := range index.Names() {
+		if present[name] {
+			continue
+		}
+		result.IndexEntries = append(result.IndexEntries, name)
+		if !dryRun {
+			delete(index.Entries, name)
+			s.indexDirty = true
+		}
+	}
+	return nil
+}
+
+// gcGit compacts the git repository of a store kept at the root of one, and
+// returns how many bytes that freed. Repositories the store is only a part
+// of are left alone.
+func gcGit(dir string) (int64, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return 0, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return 0, nil
+	}
+
+	before, err := gitObjectsSize(dir)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := git(dir, nil, "gc", "--quiet", "--prune=now"); err != nil {
+		return 0, fmt.Errorf("git gc failed: %w", err)
+	}
+	after, err := gitObjectsSize(dir)
+	if err != nil {
+		return 0, err
+	}
+	return max(before-after, 0), nil
+}
+
+// gitObjectsSize returns the bytes git objects take up, loose and packed
+func gitObjectsSize(dir string) (int64, error) {
+	output, err := git(dir, nil, "count-objects", "-v")
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure the git repository: %w", err)
+	}
+	var total int64
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(line, ": ")
+		if !found || (key != "size" && key != "size-pack" && key != "size-garbage") {
+			continue
+		}
+		kib, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, errors.New("failed to parse 'git count-objects' output")
+		}
+		total += kib * 1024
+	}
+	return total, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeleteRemovesEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend failed: %v", err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	for _, name := range []string{"team/db/prod", "team/web"} {
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	if err := store.Delete("team/db/prod"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "team", "db")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "team")); err != nil {
+		t.Errorf("Expected the directory still holding an entry to be kept: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected the store's root to be kept: %v", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend failed: %v", err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index"))
+	for _, name := range []string{"web/github", "web/gone"} {
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if _, err := store.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+
+	// Removed behind passh's back, so the index still lists it
+	if err := os.Remove(filepath.Join(dir, "web", "gone.pass")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "old", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	for _, file := range []string{"web/github.pass.tmp", ".passh/quarantine/web/broken.pass.1", ".passh/quarantine/web/new.pass.2"} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if file != ".passh/quarantine/web/new.pass.2" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	want := &GCResult{
+		EmptyDirs:    []string{"old", "old/empty"},
+		TempFiles:    []string{"web/github.pass.tmp"},
+		Quarantined:  []string{".passh/quarantine/web/broken.pass.1"},
+		IndexEntries: []string{"web/gone"},
+		Reclaimed:    8,
+	}
+	result, err := store.GC(30*24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("Expected %+v, got %+v", want, result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); err != nil {
+		t.Fatalf("Expected a dry run to remove nothing: %v", err)
+	}
+
+	if result, err = store.GC(30*24*time.Hour, false); err != nil || !reflect.DeepEqual(result, want) {
+		t.Fatalf("Expected %+v, got %+v (%v)", want, result, err)
+	}
+	if result, err = store.GC(30*24*time.Hour, false); err != nil || !reflect.DeepEqual(result, &GCResult{}) {
+		t.Fatalf("Expected nothing left to collect, got %+v (%v)", result, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".passh", "quarantine", "web", "new.pass.2")); err != nil {
+		t.Errorf("Expected a recently quarantined file to be kept: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// LocalDir returns the directory of a backend storing entries on the local
+// file system
+func LocalDir(backend Backend) (string, bool) {
+	if b, ok := backend.(*fileBackend); ok {
+		if _, local := b.fs.(localFS); local {
+			return b.rootDir, true
+		}
+	}
+	return "", false
+}
+
+// GitVersions returns the entries of a store kept in a git repository as of
+// a revision. The store may be a subdirectory of the repository.
+func GitVersions(dir, rev string) (map[string]Version, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is not installed: %w", err)
+	}
+	if strings.HasPrefix(rev, "-") {
+		return nil, fmt.Errorf("invalid revision '%s'", rev)
+	}
+
+	// ls-tree lists paths relative to dir, and only those below it
+	tree, err := git(dir, nil, "ls-tree", "-r", "-z", rev+"^{tree}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revision '%s': %w", rev, err)
+	}
+
+	var names, objects []string
+	for _, record := range strings.Split(strings.TrimSuffix(string(tree), "\x00"), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		info, path, ok := strings.Cut(record, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[1] != "blob" || !strings.HasSuffix(path, entryExtension) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(path, entryExtension))
+		objects = append(objects, fields[2])
+	}
+
+	versions := make(map[string]Version, len(names))
+	if len(names) == 0 {
+		return versions, nil
+	}
+
+	input := strings.Join(objects, "\n") + "\n"
+	output, err := git(dir, strings.NewReader(input), "cat-file", "--batch")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revision '%s': %w", rev, err)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(output))
+	for _, name := range names {
+		data, err := readGitObject(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s' at revision '%s': %w", name, rev, err)
+		}
+		versions[name] = Version{Hash: contentHash(data), Data: data}
+	}
+	return versions, nil
+}
+
+// readGitObject reads one object from the output of git cat-file --batch
+func readGitObject(reader *bufio.Reader) ([]byte, error) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	// <object> SP <type> SP <size> LF
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected git output %q", strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected git output %q", strings.TrimSpace(header))
+	}
+
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data[:size], nil
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s", message)
+		}
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,22 @@
+package storage
+
+import "strings"
+
+// Hidden reports whether an entry has a "hidden: true" line after the
+// password. Hidden entries are left out of listings unless asked for, so
+// their names stay out of casual view; they can still be read by name.
+func Hidden(secret []byte) bool {
+	value, ok := entryField(secret, "hidden")
+	return ok && strings.EqualFold(value, "true")
+}
+
+// WithoutHidden returns a copy of the index without hidden entries
+func (i *Index) WithoutHidden() *Index {
+	visible := &Index{Version: i.Version, Entries: make(map[string]IndexEntry, len(i.Entries))}
+	for name, entry := range i.Entries {
+		if !entry.Hidden {
+			visible.Entries[name] = entry
+		}
+	}
+	return visible
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHidden(t *testing.T) {
+	for secret, expected := range map[string]bool{
+		"secret\nhidden: true":              true,
+		"secret\nuser: alice\nHidden: TRUE": true,
+		"secret\nhidden: false":             false,
+		"secret\nhidden: yes":               false,
+		"hidden: true":                      false,
+	} {
+		if Hidden([]byte(secret)) != expected {
+			t.Errorf("Expected Hidden(%q) to be %v", secret, expected)
+		}
+	}
+}
+
+func TestIndexWithoutHidden(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index.enc"))
+	for name, secret := range map[string]string{
+		"bank":           "Xk9#mQ2$vL7@pR4z\nhidden: true",
+		"mail":           "Bq8!nW3^tY6&hJ1x",
+		"personal/diary": "Tz5%kP8&wN2!cV6q\nhidden: true\ntags: private",
+	} {
+		if err := store.Add(name, []byte(secret)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	index, err := store.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if names := index.WithoutHidden().Names(); !reflect.DeepEqual(names, []string{"mail"}) {
+		t.Errorf("Expected only mail to be visible, got %v", names)
+	}
+	if matches := index.WithoutHidden().Find("private"); len(matches) != 0 {
+		t.Errorf("Expected hidden entries not to be found, got %v", matches)
+	}
+	if len(index.Names()) != 3 {
+		t.Errorf("Expected WithoutHidden to leave the index alone, got %v", index.Names())
+	}
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// indexVersion is bumped when the index format changes; older indexes are
+// rebuilt
+const indexVersion = 5
+
+// Index lists the entries of a store with their tags and timestamps, so
+// listing and searching don't have to walk and decrypt the whole store. It
+// is kept encrypted outside the store, like the access log.
+type Index struct {
+	Version int                   `json:"version"`
+	Entries map[string]IndexEntry `json:"entries"`
+}
+
+// IndexEntry describes one entry in the index
+type IndexEntry struct {
+	Created  time.Time `json:"created,omitempty"`
+	Modified time.Time `json:"modified,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	// Expires is when the password is due for rotation, if set
+	Expires time.Time `json:"expires,omitempty"`
+	// Hidden entries are left out of listings by default
+	Hidden bool `json:"hidden,omitempty"`
+	// Alias is the entry an alias refers to
+	Alias string `json:"alias,omitempty"`
+	// OTP is set for entries with an otpauth:// or steam:// URI
+	OTP bool `json:"otp,omitempty"`
+	// File is the file name of the entry in stores with encrypted names
+	File string `json:"file,omitempty"`
+	// Hash is the SHA-256 of the encrypted entry, to tell when it changed
+	Hash string `json:"hash"`
+}
+
+// Names returns the indexed entries in order
+func (i *Index) Names() []string {
+	names := make([]string, 0, len(i.Entries))
+	for name := range i.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Find returns the entries whose name contains query or that have a tag
+// equal to it, ignoring case
+func (i *Index) Find(query string) []string {
+	query = strings.ToLower(query)
+
+	var matches []string
+	for _, name := range i.Names() {
+		if strings.Contains(strings.ToLower(name), query) {
+			matches = append(matches, name)
+			continue
+		}
+		for _, tag := range i.Entries[name].Tags {
+			if strings.ToLower(tag) == query {
+				matches = append(matches, name)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// SetIndexPath sets where the index of the store is kept. Without a path the
+// store keeps no index.
+func (s *Store) SetIndexPath(path string) {
+	s.indexPath = path
+}
+
+// Index returns the index of the store, building it first if there is none
+// yet
+func (s *Store) Index() (*Index, error) {
+	s.indexMu.Lock()
+	index, err := s.loadIndex()
+	s.indexMu.Unlock()
+	if err != nil {
+		logging.Warnf("%v; rebuilding it", err)
+	} else if index != nil {
+		return index, nil
+	}
+	return s.RebuildIndex()
+}
+
+// RebuildIndex builds the index from scratch by decrypting every entry, and
+// saves it
+func (s *Store) RebuildIndex() (*Index, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]IndexEntry, len(names))
+	err = s.forEach(names, func(i int, name string) error {
+		data, err := s.entries().Get(name)
+		if err != nil {
+			return entryError(name, "failed to read password file", err)
+		}
+		plaintext, err := s.decryptEntry(name, data)
+		if err != nil {
+			// Entries shared with others may not be encrypted to us; they
+			// are still listed, without tags
+			logging.Warnf("indexing %s without its content: %v", name, err)
+			entries[i] = IndexEntry{Hash: contentHash(data)}
+			if info, err := s.entries().Stat(name); err == nil {
+				entries[i].Modified = info.ModTime.UTC()
+			}
+			return nil
+		}
+		defer secure.Wipe(plaintext)
+
+		entries[i], err = s.newIndexEntry(name, data, plaintext)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild index: %w", err)
+	}
+
+	index := &Index{Version: indexVersion, Entries: make(map[string]IndexEntry, len(names))}
+	for i, name := range names {
+		index.Entries[name] = entries[i]
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	s.index = index
+	s.indexLoaded = true
+	s.indexDirty = true
+	if err := s.saveIndex(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// RefreshIndex brings the index up to date for entries changed behind the
+// store's back, such as by a sync, given by their file names. Entries whose
+// encrypted content is unchanged are not decrypted again. Without an index
+// this does nothing.
+func (s *Store) RefreshIndex(files []string) error {
+	s.indexMu.Lock()
+	index, err := s.loadIndex()
+	s.indexMu.Unlock()
+	if err != nil || index == nil {
+		return err
+	}
+
+	names := files
+	if encrypted, err := s.NamesEncrypted(); err != nil {
+		return err
+	} else if encrypted {
+		if names, err = s.namesOf(files); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		data, err := s.entries().Get(name)
+		if errors.Is(err, os.ErrNotExist) {
+			s.removeFromIndex(name)
+			continue
+		}
+		if err != nil {
+			return entryError(name, "failed to read password file", err)
+		}
+		if entry, ok := index.Entries[name]; ok && entry.Hash == contentHash(data) {
+			continue
+		}
+
+		plaintext, err := s.decryptEntry(name, data)
+		if err != nil {
+			return err
+		}
+		s.updateIndex(name, data, plaintext)
+		secure.Wipe(plaintext)
+	}
+	return nil
+}
+
+// updateIndex records a written entry, if the store has an index. The index
+// is saved when the store is closed.
+func (s *Store) updateIndex(name string, encrypted, plaintext []byte) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	index, err := s.loadIndex()
+	if err != nil {
+		logging.Debugf("not updating index: %v", err)
+		s.dropIndex(err)
+		return
+	}
+	if index == nil {
+		return
+	}
+
+	entry, err := s.newIndexEntry(name, encrypted, plaintext)
+	if err != nil {
+		logging.Debugf("not indexing %s: %v", name, err)
+		delete(index.Entries, name)
+	} else {
+		index.Entries[name] = entry
+	}
+	s.indexDirty = true
+}
+
+// rehashIndex records entry files that were rewritten without changing what
+// they decrypt to, such as by a migration, given their old and new hashes
+func (s *Store) rehashIndex(hashes map[string]string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	index, err := s.loadIndex()
+	if err != nil || index == nil {
+		return
+	}
+	for name, entry := range index.Entries {
+		if hash, ok := hashes[entry.Hash]; ok {
+			entry.Hash = hash
+			index.Entries[name] = entry
+			s.indexDirty = true
+		}
+	}
+}
+
+// removeFromIndex forgets a deleted entry, if the store has an index
+func (s *Store) removeFromIndex(name string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	index, err := s.loadIndex()
+	if err != nil {
+		s.dropIndex(err)
+	}
+	if index == nil {
+		return
+	}
+	if _, ok := index.Entries[name]; ok {
+		delete(index.Entries, name)
+		s.indexDirty = true
+	}
+}
+
+// dropIndex removes an index that can't be decrypted, such as with only the
+// public key loaded, as it would miss the changes made meanwhile. It is
+// rebuilt once the keys can read it. The caller holds s.indexMu.
+func (s *Store) dropIndex(err error) {
+	if !errors.Is(err, crypto.ErrDecryptFailed) {
+		return
+	}
+	if err := os.Remove(s.indexPath); err != nil && !os.IsNotExist(err) {
+		logging.Warnf("failed to remove outdated index: %v", err)
+	}
+}
+
+// newIndexEntry describes an entry from its encrypted and decrypted content
+func (s *Store) newIndexEntry(name string, encrypted, plaintext []byte) (IndexEntry, error) {
+	secret, meta, err := openEntry(plaintext)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("entry '%s': %w", name, err)
+	}
+
+	entry := IndexEntry{
+		Created:  meta.Created,
+		Modified: meta.Modified,
+		Tags:     entryTags(secret),
+		Hidden:   Hidden(secret),
+		Alias:    meta.Alias,
+		OTP:      hasOTP(secret),
+		Hash:     contentHash(encrypted),
+	}
+	if file, err := s.entryFile(name); err == nil && file != name {
+		entry.File = file
+	}
+	if expires, err := Expiry(secret); err != nil {
+		logging.Warnf("entry '%s': %v", name, err)
+	} else {
+		entry.Expires = expires
+	}
+	if entry.Modified.IsZero() {
+		if info, err := s.entries().Stat(name); err == nil {
+			entry.Modified = info.ModTime.UTC()
+		}
+	}
+	return entry, nil
+}
+
+// loadIndex reads the index on first use. It returns nil if the store has no
+// index yet or its format is outdated, and is only tried once, so an
+// unreadable index is reported once and then ignored until rebuilt. The
+// caller holds s.indexMu.
+func (s *Store) loadIndex() (*Index, error) {
+	if s.indexLoaded || s.indexPath == "" {
+		return s.index, nil
+	}
+	s.indexLoaded = true
+
+	data, err := os.ReadFile(s.indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	plaintext, err := s.encryptor.Decrypt(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt index: %w", err)
+	}
+	defer secure.Wipe(plaintext)
+
+	var index Index
+	if err := json.Unmarshal(plaintext, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index: %w", err)
+	}
+	if index.Version != indexVersion {
+		logging.Debugf("ignoring index of version %d", index.Version)
+		return nil, nil
+	}
+	if index.Entries == nil {
+		index.Entries = make(map[string]IndexEntry)
+	}
+	s.index = &index
+	return s.index, nil
+}
+
+// saveIndex encrypts the index and writes it if it changed. The caller holds
+// s.indexMu.
+func (s *Store) saveIndex() error {
+	if !s.indexDirty || s.index == nil || s.indexPath == "" {
+		return nil
+	}
+
+	plaintext, err := json.Marshal(s.index)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	defer secure.Wipe(plaintext)
+
+	encrypted, err := s.encryptor.Encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.indexPath), 0700); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	if err := os.WriteFile(s.indexPath, []byte(encrypted), 0600); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	s.indexDirty = false
+	return nil
+}
+
+// entryTags returns the tags of an entry, given on a "tags:" line after the
+// password and separated by commas or spaces
+func entryTags(secret []byte) []string {
+	value, ok := entryField(secret, "tags")
+	if !ok {
+		return nil
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// hasOTP reports whether an entry has an otpauth:// or steam:// URI on any
+// line. Bare base32 secrets can't be told from passwords.
+func hasOTP(secret []byte) bool {
+	for _, line := range bytes.Split(secret, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("otpauth://")) || bytes.HasPrefix(line, []byte("steam://")) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryField returns the value of the first "key: value" line after the
+// password with the given key, ignoring case
+func entryField(secret []byte, key string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(secret))
+	// The first line is the password
+	scanner.Scan()
+	for scanner.Scan() {
+		k, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			return strings.TrimSpace(value), true
+		}
+	}
+	return "", false
+}
+
+// contentHash returns the hex SHA-256 of encrypted entry data
+func contentHash(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+)
+
+func TestIndex(t *testing.T) {
+	backend := NewMemoryBackend()
+	path := filepath.Join(t.TempDir(), "index.enc")
+
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(path)
+	if err := store.Add("web/mail", []byte("secret\nuser: me\ntags: work, Mail")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("bank", []byte("secret\n  otpauth://totp/bank?secret=JBSWY3DPEHPK3PXP")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an index the first use builds it
+	index, err := store.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if names := index.Names(); !reflect.DeepEqual(names, []string{"bank", "web/mail"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if tags := index.Entries["web/mail"].Tags; !reflect.DeepEqual(tags, []string{"work", "Mail"}) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+	if index.Entries["bank"].Modified.IsZero() {
+		t.Error("Expected a modification time")
+	}
+	if !index.Entries["bank"].OTP || index.Entries["web/mail"].OTP {
+		t.Error("Expected only bank to be marked as having an OTP key")
+	}
+
+	// Changes are recorded and saved on Close
+	if err := store.Add("web/shop", []byte("secret\ntags: shopping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("bank"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptor := &countingEncryptor{}
+	store = NewStoreWithBackend(backend, encryptor)
+	store.SetIndexPath(path)
+	index, err = store.Index()
+	if err != nil {
+		t.Fatalf("Index failed: %v", err)
+	}
+	if names := index.Names(); !reflect.DeepEqual(names, []string{"web/mail", "web/shop"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if encryptor.decrypts != 1 {
+		t.Errorf("Expected only the index to be decrypted, got %d decryptions", encryptor.decrypts)
+	}
+
+	if matches := index.Find("mail"); !reflect.DeepEqual(matches, []string{"web/mail"}) {
+		t.Errorf("Unexpected matches for 'mail': %v", matches)
+	}
+	if matches := index.Find("SHOPPING"); !reflect.DeepEqual(matches, []string{"web/shop"}) {
+		t.Errorf("Unexpected matches for 'SHOPPING': %v", matches)
+	}
+	if matches := index.Find("web"); len(matches) != 2 {
+		t.Errorf("Unexpected matches for 'web': %v", matches)
+	}
+}
+
+func TestRefreshIndex(t *testing.T) {
+	backend := NewMemoryBackend()
+	encryptor := &countingEncryptor{}
+	store := NewStoreWithBackend(backend, encryptor)
+	store.SetWorkers(1)
+	store.SetIndexPath(filepath.Join(t.TempDir(), "index.enc"))
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.RebuildIndex(); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+
+	// Change the backend behind the store's back, as a sync does
+	other := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := other.Add("b", []byte("changed\ntags: new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Add("d", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptor.decrypts = 0
+	if err := store.RefreshIndex([]string{"a", "b", "c", "d"}); err != nil {
+		t.Fatalf("RefreshIndex failed: %v", err)
+	}
+	if encryptor.decrypts != 2 {
+		t.Errorf("Expected only changed entries to be decrypted, got %d decryptions", encryptor.decrypts)
+	}
+
+	index, err := store.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := index.Names(); !reflect.DeepEqual(names, []string{"a", "b", "d"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+	if tags := index.Entries["b"].Tags; !reflect.DeepEqual(tags, []string{"new"}) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+}
+
+// publicOnlyEncryptor encrypts but has no private key to decrypt with
+type publicOnlyEncryptor struct {
+	MockEncryptor
+}
+
+func (p *publicOnlyEncryptor) Decrypt(string) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %w", crypto.ErrDecryptFailed, crypto.ErrNoPrivateKey)
+}
+
+func TestIndexDroppedWithoutPrivateKey(t *testing.T) {
+	backend := NewMemoryBackend()
+	path := filepath.Join(t.TempDir(), "index.enc")
+
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(path)
+	if err := store.Add("bank", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Index(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An entry added without the private key can't be recorded in the index,
+	// which would then miss it
+	store = NewStoreWithBackend(backend, &publicOnlyEncryptor{})
+	store.SetIndexPath(path)
+	if err := store.Add("web/mail", []byte("secret")); err != nil {
+		t.Fatalf("Expected adding with the public key only to work, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the index to be removed, got %v", err)
+	}
+
+	store = NewStoreWithBackend(backend, &MockEncryptor{})
+	store.SetIndexPath(path)
+	index, err := store.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := index.Names(); !reflect.DeepEqual(names, []string{"bank", "web/mail"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps entries in memory. It is useful for tests and for
+// short-lived stores that should never touch the disk.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	files   map[string][]byte
+}
+
+type memoryEntry struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]memoryEntry), files: make(map[string][]byte)}
+}
+
+func (m *MemoryBackend) Put(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := make([]byte, len(data))
+	copy(stored, data)
+	m.entries[name] = memoryEntry{data: stored, modTime: time.Now()}
+	return nil
+}
+
+func (m *MemoryBackend) Get(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("entry %q: %w", name, os.ErrNotExist)
+	}
+
+	data := make([]byte, len(entry.data))
+	copy(data, entry.data)
+	return data, nil
+}
+
+func (m *MemoryBackend) List() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.entries))
+	for name := range m.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryBackend) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[name]; !ok {
+		return fmt.Errorf("entry %q: %w", name, os.ErrNotExist)
+	}
+	delete(m.entries, name)
+	return nil
+}
+
+func (m *MemoryBackend) Stat(name string) (EntryInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[name]
+	if !ok {
+		return EntryInfo{}, fmt.Errorf("entry %q: %w", name, os.ErrNotExist)
+	}
+	return EntryInfo{Name: name, Size: int64(len(entry.data)), ModTime: entry.modTime}, nil
+}
+
+func (m *MemoryBackend) ReadFile(path string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.files[path]
+	if !ok {
+		return nil, fmt.Errorf("file %q: %w", path, os.ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemoryBackend) WriteFile(path string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryBackend) OpenFile(path string) (io.ReadCloser, error) {
+	data, err := m.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemoryBackend) CreateFile(path string) (io.WriteCloser, error) {
+	return &memoryFileWriter{backend: m, path: path}, nil
+}
+
+func (m *MemoryBackend) RemoveFile(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[path]; !ok {
+		return fmt.Errorf("file %q: %w", path, os.ErrNotExist)
+	}
+	delete(m.files, path)
+	return nil
+}
+
+func (m *MemoryBackend) ListFiles(extension string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var paths []string
+	for path := range m.files {
+		if strings.HasSuffix(path, extension) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// memoryFileWriter stores its content in the backend when closed
+type memoryFileWriter struct {
+	backend *MemoryBackend
+	path    string
+	buf     bytes.Buffer
+}
+
+func (w *memoryFileWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memoryFileWriter) Close() error {
+	return w.backend.WriteFile(w.path, w.buf.Bytes())
+}
+
+func (m *MemoryBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// metadataMagic starts the plaintext of entries that carry metadata. Entries
+// written before metadata existed hold only the secret.
+const metadataMagic = "\x00passh-meta "
+
+// Metadata is stored encrypted alongside the secret of an entry
+type Metadata struct {
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	// Signature is an armored SSH signature over the entry, if signed
+	Signature string `json:"signature,omitempty"`
+	// Name is the name of the entry in stores with encrypted names, whose
+	// file names don't tell
+	Name string `json:"name,omitempty"`
+	// Alias is the entry an alias refers to; aliases hold no secret
+	Alias string `json:"alias,omitempty"`
+}
+
+// sealEntry prepends the metadata header to a secret
+func sealEntry(secret []byte, meta Metadata) ([]byte, error) {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	plaintext := make([]byte, 0, len(metadataMagic)+len(header)+1+len(secret))
+	plaintext = append(plaintext, metadataMagic...)
+	plaintext = append(plaintext, header...)
+	plaintext = append(plaintext, '\n')
+	plaintext = append(plaintext, secret...)
+	return plaintext, nil
+}
+
+// openEntry splits decrypted entry content into the secret and its metadata.
+// Entries without a metadata header yield zero metadata.
+func openEntry(plaintext []byte) ([]byte, Metadata, error) {
+	var meta Metadata
+	if !bytes.HasPrefix(plaintext, []byte(metadataMagic)) {
+		return plaintext, meta, nil
+	}
+
+	rest := plaintext[len(metadataMagic):]
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		return nil, meta, fmt.Errorf("invalid entry metadata")
+	}
+	if err := json.Unmarshal(rest[:end], &meta); err != nil {
+		return nil, meta, fmt.Errorf("invalid entry metadata: %w", err)
+	}
+	return rest[end+1:], meta, nil
+}
+
+// GetWithMetadata retrieves a password entry together with its metadata,
+// following aliases. Entries written before metadata was recorded have zero
+// timestamps.
+func (s *Store) GetWithMetadata(name string) ([]byte, Metadata, error) {
+	secret, meta, err := s.readEntry(name)
+	for depth := 0; err == nil && meta.Alias != ""; depth++ {
+		if depth == maxAliasDepth {
+			return nil, Metadata{}, fmt.Errorf("%w: %s", ErrAliasLoop, name)
+		}
+		name = meta.Alias
+		secret, meta, err = s.readEntry(name)
+	}
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := s.confirmRelease(name, secret); err != nil {
+		secure.Wipe(secret)
+		return nil, Metadata{}, err
+	}
+	return secret, meta, nil
+}
+
+// readEntry decrypts an entry for checks that don't release it, which need
+// no confirmation
+func (s *Store) readEntry(name string) ([]byte, Metadata, error) {
+	plaintext, err := s.readPlaintext(name)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return openEntry(plaintext)
+}
+
+// Metadata returns the metadata of an entry. It has to decrypt the entry.
+func (s *Store) Metadata(name string) (Metadata, error) {
+	plaintext, err := s.readPlaintext(name)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer secure.Wipe(plaintext)
+
+	_, meta, err := openEntry(plaintext)
+	return meta, err
+}
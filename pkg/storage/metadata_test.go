@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEntryMetadata(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+
+	before := time.Now().UTC().Add(-time.Second)
+	if err := store.Add("github", []byte("first")); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+	created, err := store.Metadata("github")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if created.Created.Before(before) || !created.Created.Equal(created.Modified) {
+		t.Fatalf("Unexpected metadata for a new entry: %+v", created)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := store.Add("github", []byte("second")); err != nil {
+		t.Fatalf("Failed to update entry: %v", err)
+	}
+	password, updated, err := store.GetWithMetadata("github")
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if string(password) != "second" {
+		t.Fatalf("Expected 'second', got '%s'", password)
+	}
+	if !updated.Created.Equal(created.Created) || !updated.Modified.After(created.Modified) {
+		t.Fatalf("Expected creation time to be kept and modification time to advance: %+v", updated)
+	}
+
+	// Re-encryption leaves the metadata alone
+	if err := store.ReencryptEntries([]string{"github"}); err != nil {
+		t.Fatalf("Failed to re-encrypt: %v", err)
+	}
+	reencrypted, err := store.Metadata("github")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if reencrypted != updated {
+		t.Fatalf("Re-encryption changed metadata: %+v -> %+v", updated, reencrypted)
+	}
+}
+
+func TestEntryWithoutMetadata(t *testing.T) {
+	backend := NewMemoryBackend()
+	if err := backend.Put("legacy", []byte("old-secret_encrypted")); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	password, meta, err := store.GetWithMetadata("legacy")
+	if err != nil {
+		t.Fatalf("Failed to get legacy entry: %v", err)
+	}
+	if string(password) != "old-secret" || !meta.Created.IsZero() {
+		t.Fatalf("Unexpected legacy entry: %q %+v", password, meta)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access", "log.enc")
+
+	log, err := LoadAccessLog(path, &MockEncryptor{})
+	if err != nil {
+		t.Fatalf("Failed to load missing access log: %v", err)
+	}
+	now := time.Now()
+	log.Record("github", now.Add(-time.Hour))
+	log.Record("github", now)
+	if err := log.Save(path, &MockEncryptor{}); err != nil {
+		t.Fatalf("Failed to save access log: %v", err)
+	}
+
+	loaded, err := LoadAccessLog(path, &MockEncryptor{})
+	if err != nil {
+		t.Fatalf("Failed to load access log: %v", err)
+	}
+	record := loaded.Entries["github"]
+	if record.Count != 2 || !record.Last.Equal(now.UTC()) {
+		t.Fatalf("Unexpected access record: %+v", record)
+	}
+}
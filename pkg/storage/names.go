@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/ssh"
+)
+
+// nameKeyFile holds the key that file names are derived from in a store with
+// encrypted names. Entries are then stored as HMAC-SHA256(key, name), their
+// names are kept in their encrypted metadata and in the index, and the key
+// is encrypted to everyone who can read any entry.
+const nameKeyFile = metaDir + "name-key"
+
+// ErrNamesEncrypted is returned for operations that would reveal entry names
+// in a store with encrypted names
+var ErrNamesEncrypted = errors.New("not supported in a store with encrypted names")
+
+// namedBackend stores the entries of a store with encrypted names under
+// opaque file names. For other stores it passes everything through.
+type namedBackend struct {
+	Backend
+	s *Store
+}
+
+func (b *namedBackend) Put(name string, data []byte) error {
+	file, err := b.s.entryFile(name)
+	if err != nil {
+		return err
+	}
+	return b.Backend.Put(file, data)
+}
+
+func (b *namedBackend) Get(name string) ([]byte, error) {
+	file, err := b.s.entryFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.Backend.Get(file)
+}
+
+func (b *namedBackend) Delete(name string) error {
+	file, err := b.s.entryFile(name)
+	if err != nil {
+		return err
+	}
+	return b.Backend.Delete(file)
+}
+
+func (b *namedBackend) Stat(name string) (EntryInfo, error) {
+	file, err := b.s.entryFile(name)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	info, err := b.Backend.Stat(file)
+	info.Name = name
+	return info, err
+}
+
+func (b *namedBackend) List() ([]string, error) {
+	files, err := b.Backend.List()
+	if err != nil {
+		return nil, err
+	}
+	key, err := b.s.nameKey()
+	if err != nil || key == nil {
+		return files, err
+	}
+	return b.s.namesOf(files)
+}
+
+// NamesEncrypted reports whether the store keeps entries under opaque file
+// names
+func (s *Store) NamesEncrypted() (bool, error) {
+	key, err := s.nameKey()
+	return key != nil, err
+}
+
+// nameKey returns the key file names are derived from, or nil if the store
+// does not encrypt names. It is read once.
+func (s *Store) nameKey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.namesLoaded {
+		return s.nameHMACKey, nil
+	}
+
+	data, err := s.raw().ReadFile(nameKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		s.namesLoaded = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the name key: %w", err)
+	}
+	key, err := s.encryptor.Decrypt(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the name key: %w", err)
+	}
+	s.nameHMACKey, s.namesLoaded = key, true
+	return key, nil
+}
+
+// checkEntryName rejects names that could be stored outside the store.
+// Names are paths relative to the store, separated by slashes, without
+// empty, . or .. parts.
+func checkEntryName(name string) error {
+	if name == "" {
+		return errors.New("entry name is empty")
+	}
+	if strings.ContainsAny(name, "\\\x00") {
+		return fmt.Errorf("invalid entry name %q: backslashes and NUL are not allowed", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid entry name %q: empty, . and .. folders are not allowed", name)
+		}
+	}
+	return nil
+}
+
+// entryFile returns the name of the file an entry is stored in. Conflict
+// copies made by sync keep their suffix, so they stay next to their entry.
+func (s *Store) entryFile(name string) (string, error) {
+	if err := checkEntryName(name); err != nil {
+		return "", err
+	}
+	key, err := s.nameKey()
+	if err != nil || key == nil {
+		return name, err
+	}
+
+	base, suffix := name, ""
+	if trimmed, ok := strings.CutSuffix(name, ConflictSuffix); ok {
+		base, suffix = trimmed, ConflictSuffix
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(base))
+	return hex.EncodeToString(mac.Sum(nil)[:16]) + suffix, nil
+}
+
+// namesOf returns the entry names of files in a store with encrypted names.
+// Names are looked up in the index, and otherwise read from the entries.
+// Files that can't be decrypted are skipped, since their names are unknown.
+func (s *Store) namesOf(files []string) ([]string, error) {
+	known := make(map[string]string)
+	s.indexMu.Lock()
+	if index, err := s.loadIndex(); err == nil && index != nil {
+		for name, entry := range index.Entries {
+			if entry.File != "" {
+				known[entry.File] = name
+			}
+		}
+	}
+	s.indexMu.Unlock()
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if name, ok := known[file]; ok {
+			names = append(names, name)
+			continue
+		}
+
+		name, err := s.readEntryName(file)
+		if err != nil {
+			logging.Verbosef("skipping %s: %v", file, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// readEntryName decrypts the file of an entry to learn its name
+func (s *Store) readEntryName(file string) (string, error) {
+	data, err := s.raw().Get(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	plaintext, err := s.decryptEntry(file, data)
+	if err != nil {
+		return "", err
+	}
+	defer secure.Wipe(plaintext)
+
+	_, meta, err := openEntry(plaintext)
+	if err != nil {
+		return "", err
+	}
+	name := meta.Name
+	if strings.HasSuffix(file, ConflictSuffix) {
+		name += ConflictSuffix
+	}
+	// A file copied or renamed to another entry's place is not trusted
+	if expected, err := s.entryFile(name); err != nil || meta.Name == "" || expected != file {
+		return "", errors.New("the entry does not belong under this file name")
+	}
+	return name, nil
+}
+
+// EntryName returns the name of the entry stored in a file of the backend,
+// as the file name itself for stores without encrypted names or for files
+// the index does not know
+func (s *Store) EntryName(file string) string {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if index, err := s.loadIndex(); err == nil && index != nil {
+		for name, entry := range index.Entries {
+			if entry.File == file {
+				return name
+			}
+		}
+	}
+	return file
+}
+
+// nameEntry records the entry name in the metadata of its content, for
+// stores with encrypted names. It returns a new copy of the content, or nil
+// if the content needs no change.
+func (s *Store) nameEntry(name string, plaintext []byte) ([]byte, error) {
+	key, err := s.nameKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	secret, meta, err := openEntry(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(name, ConflictSuffix)
+	if meta.Name == base {
+		return nil, nil
+	}
+	meta.Name = base
+	return sealEntry(secret, meta)
+}
+
+// EncryptNames moves every entry to a file named after a keyed hash of its
+// name, so that the names can't be read from the store's files. The names
+// are kept in the encrypted entries and the index.
+func (s *Store) EncryptNames() error {
+	encrypted, err := s.NamesEncrypted()
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return errors.New("entry names are already encrypted")
+	}
+	files, err := s.ListFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return fmt.Errorf("attachments are %w; remove them first", ErrNamesEncrypted)
+	}
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate the name key: %w", err)
+	}
+
+	// Read every entry before switching over, since reads then go to the
+	// new file names
+	plaintexts := make([][]byte, len(names))
+	defer func() {
+		for _, plaintext := range plaintexts {
+			secure.Wipe(plaintext)
+		}
+	}()
+	err = s.forEach(names, func(i int, name string) error {
+		var err error
+		plaintexts[i], err = s.readPlaintext(name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.nameHMACKey, s.namesLoaded = key, true
+	s.mu.Unlock()
+
+	var (
+		writtenMu sync.Mutex
+		written   []string
+	)
+	err = s.forEach(names, func(i int, name string) error {
+		if err := s.writePlaintext(name, plaintexts[i]); err != nil {
+			return err
+		}
+		writtenMu.Lock()
+		written = append(written, name)
+		writtenMu.Unlock()
+		return nil
+	})
+	if err == nil {
+		err = s.wrapNameKey(names)
+	}
+	if err != nil {
+		// The old files are still in place, so remove the new ones
+		for _, name := range written {
+			if err := s.entries().Delete(name); err != nil {
+				logging.Warnf("failed to remove the new file of '%s': %v", name, err)
+			}
+		}
+		s.mu.Lock()
+		s.nameHMACKey, s.namesLoaded = nil, true
+		s.mu.Unlock()
+		return err
+	}
+
+	return s.forEach(names, func(_ int, name string) error {
+		if err := s.raw().Delete(name); err != nil {
+			return fmt.Errorf("failed to remove the old file of '%s': %w", name, err)
+		}
+		return nil
+	})
+}
+
+// wrapNameKey encrypts the name key to everyone who can read any of the
+// entries, since they need it to find them
+func (s *Store) wrapNameKey(names []string) error {
+	key, err := s.nameKey()
+	if err != nil || key == nil {
+		return err
+	}
+
+	var data string
+	if encryptor, ok := s.encryptor.(crypto.RecipientEncryptor); ok {
+		var keys []ssh.PublicKey
+		for _, name := range names {
+			recipients, err := s.Recipients(name)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, missingKeys(recipients, keys)...)
+		}
+		if len(keys) == 0 {
+			keys = append(encryptor.PublicKeys(), s.extraRecipients...)
+		}
+		data, err = encryptor.EncryptTo(key, keys)
+	} else {
+		data, err = s.encryptor.Encrypt(key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the name key: %w", err)
+	}
+	if err := s.raw().WriteFile(nameKeyFile, []byte(data)); err != nil {
+		return fmt.Errorf("failed to write the name key: %w", err)
+	}
+	return nil
+}
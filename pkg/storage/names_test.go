@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEncryptNames(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	for name, secret := range map[string]string{
+		"web/github": "Xk9#mQ2$vL7@pR4z",
+		"bank/chase": "Bq8!nW3^tY6&hJ1x\nuser: alice",
+	} {
+		if err := store.Add(name, []byte(secret)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	if err := store.EncryptNames(); err != nil {
+		t.Fatalf("EncryptNames failed: %v", err)
+	}
+	if err := store.EncryptNames(); err == nil {
+		t.Error("Expected encrypting names twice to fail")
+	}
+
+	files, err := backend.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %v", files)
+	}
+	for _, file := range files {
+		if strings.Contains(file, "github") || strings.Contains(file, "chase") || strings.Contains(file, "/") {
+			t.Errorf("Expected an opaque file name, got %s", file)
+		}
+	}
+
+	// A fresh store finds the names without an index
+	store = NewStoreWithBackend(backend, &MockEncryptor{})
+	names, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"bank/chase", "web/github"}) {
+		t.Errorf("Expected the entry names, got %v", names)
+	}
+	if secret, err := store.Get("bank/chase"); err != nil || string(secret) != "Bq8!nW3^tY6&hJ1x\nuser: alice" {
+		t.Errorf("Expected the entry to be readable by name, got %q (%v)", secret, err)
+	}
+
+	if err := store.Delete("web/github"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("web/github"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+// fullBackend fails to write once it has written puts files
+type fullBackend struct {
+	Backend
+	puts int
+}
+
+func (b *fullBackend) Put(name string, data []byte) error {
+	if b.puts == 0 {
+		return errors.New("disk full")
+	}
+	b.puts--
+	return b.Backend.Put(name, data)
+}
+
+func TestEncryptNamesFailureRemovesNewFiles(t *testing.T) {
+	backend := &fullBackend{Backend: NewMemoryBackend(), puts: 3}
+	store := batchStore(t, backend)
+	store.SetWorkers(1)
+
+	backend.puts = 1
+	if err := store.EncryptNames(); err == nil {
+		t.Fatal("Expected EncryptNames to fail")
+	}
+	files, err := backend.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, []string{"bank", "web/gone", "web/old"}) {
+		t.Errorf("Expected only the old files, got %v", files)
+	}
+
+	store = NewStoreWithBackend(backend, &MockEncryptor{})
+	if secret, err := store.Get("bank"); err != nil || string(secret) != "bank-secret" {
+		t.Errorf("Expected the entry to be readable by name, got %q (%v)", secret, err)
+	}
+}
+
+func TestEncryptedNamesRejectMovedFiles(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("mail", []byte("Tz5%kP8&wN2!cV6q")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := store.EncryptNames(); err != nil {
+		t.Fatalf("EncryptNames failed: %v", err)
+	}
+
+	// A copy under another file name is not listed as the entry
+	files, _ := backend.List()
+	mustPut(t, backend, "0123456789abcdef0123456789abcdef", mustGet(t, backend, files[0]))
+	store = NewStoreWithBackend(backend, &MockEncryptor{})
+	if names, err := store.List(); err != nil || !reflect.DeepEqual(names, []string{"mail"}) {
+		t.Errorf("Expected only mail, got %v (%v)", names, err)
+	}
+
+	if _, err := store.AddFile("doc", strings.NewReader("content")); !errors.Is(err, ErrNamesEncrypted) {
+		t.Errorf("Expected attachments to be refused, got %v", err)
+	}
+}
+
+func TestSyncCopiesNameKey(t *testing.T) {
+	local := NewMemoryBackend()
+	store := NewStoreWithBackend(local, &MockEncryptor{})
+	if err := store.Add("mail", []byte("Tz5%kP8&wN2!cV6q")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := store.EncryptNames(); err != nil {
+		t.Fatalf("EncryptNames failed: %v", err)
+	}
+
+	remote := NewMemoryBackend()
+	if _, err := Sync(local, remote, SyncState{}, noConflicts(t)); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	clone := NewStoreWithBackend(remote, &MockEncryptor{})
+	if secret, err := clone.Get("mail"); err != nil || string(secret) != "Tz5%kP8&wN2!cV6q" {
+		t.Errorf("Expected the synced store to read the entry, got %q (%v)", secret, err)
+	}
+
+	plain := NewMemoryBackend()
+	mustPut(t, plain, "other", "data")
+	if _, err := Sync(local, plain, SyncState{}, noConflicts(t)); err == nil {
+		t.Error("Expected syncing with a store with plain names to fail")
+	}
+}
+
+func TestCheckEntryName(t *testing.T) {
+	for _, name := range []string{"github", "web/github", "web/github.conflict", ".hidden", "a..b", "with space"} {
+		if err := checkEntryName(name); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "/etc/passwd", "../escape", "web/../../escape", "web//github", "web/", "./github", `web\github`, "nul\x00"} {
+		if err := checkEntryName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := store.Add("../escape", []byte("secret")); err == nil {
+		t.Error("Expected adding an entry outside the store to fail")
+	}
+	if _, err := store.Get("../escape"); err == nil {
+		t.Error("Expected reading an entry outside the store to fail")
+	}
+}
+
+// FuzzEntryName checks that every name allowed is stored inside the store,
+// under the name it was given
+func FuzzEntryName(f *testing.F) {
+	for _, name := range []string{"github", "web/github", "../escape", "a/./b", "/abs", `c:\x`, "web/github.conflict"} {
+		f.Add(name)
+	}
+	root := filepath.Join(f.TempDir(), "store")
+	f.Fuzz(func(t *testing.T, name string) {
+		if err := checkEntryName(name); err != nil {
+			return
+		}
+		if path.Clean(name) != name {
+			t.Fatalf("%q was allowed but is not a clean path", name)
+		}
+		file := (&fileBackend{rootDir: root}).path(name)
+		if rel, err := filepath.Rel(root, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Fatalf("%q was allowed but is stored at %s, outside the store", name, file)
+		}
+
+		store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+		if strings.HasPrefix(name, metaDir) {
+			return
+		}
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatalf("Failed to add %q: %v", name, err)
+		}
+		names, err := store.List()
+		if err != nil || len(names) != 1 || names[0] != name {
+			t.Fatalf("Expected [%q] to be listed, got %q (%v)", name, names, err)
+		}
+	})
+}
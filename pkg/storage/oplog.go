@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// logFile records operations on the store once the log is enabled. Each
+// record holds the hash of the one before, so edits to earlier records are
+// detected.
+const logFile = metaDir + "log.jsonl"
+
+// Operations recorded in the log
+const (
+	LogStart     = "start"
+	LogAdd       = "add"
+	LogUpdate    = "update"
+	LogDelete    = "delete"
+	LogReencrypt = "reencrypt"
+)
+
+// Whether the store has a log is only checked on the first operation
+const (
+	logUnknown = iota
+	logDisabled
+	logEnabled
+)
+
+// ErrLogDisabled is returned when reading the log of a store that has none
+var ErrLogDisabled = errors.New("the operation log is not enabled for this store")
+
+// LogRecord is one operation in the log. It never holds secrets.
+type LogRecord struct {
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	Op    string    `json:"op"`
+	Name  string    `json:"name,omitempty"`
+	// Prev is the hash of the previous record, empty for the first
+	Prev string `json:"prev,omitempty"`
+	// Hash covers every other field
+	Hash string `json:"hash"`
+}
+
+// SetActor sets who is recorded in the log for operations on this store
+func (s *Store) SetActor(actor string) {
+	s.actor = actor
+}
+
+// EnableLog starts the operation log of the store
+func (s *Store) EnableLog() error {
+	if _, err := s.entries().ReadFile(logFile); err == nil {
+		return errors.New("the operation log is already enabled")
+	}
+
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	s.logState = logEnabled
+	s.pendingLog = append([]LogRecord{{Time: time.Now().UTC(), Actor: s.actor, Op: LogStart}}, s.pendingLog...)
+	return s.flushLog()
+}
+
+// logOperation records an operation, if the log is enabled. Records are
+// written when the store is closed. Stores with encrypted names record the
+// file name instead of the entry name.
+func (s *Store) logOperation(op, name string) {
+	if file, err := s.entryFile(name); err == nil {
+		name = file
+	}
+
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+
+	if s.logState == logUnknown {
+		s.logState = logDisabled
+		if file, err := s.entries().OpenFile(logFile); err == nil {
+			file.Close()
+			s.logState = logEnabled
+		}
+	}
+	if s.logState == logEnabled {
+		s.pendingLog = append(s.pendingLog, LogRecord{Time: time.Now().UTC(), Actor: s.actor, Op: op, Name: name})
+	}
+}
+
+// flushLog appends the pending records to the log, chaining them to its last
+// record. logMu must be held.
+func (s *Store) flushLog() error {
+	if len(s.pendingLog) == 0 {
+		return nil
+	}
+
+	data, err := s.entries().ReadFile(logFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read operation log: %w", err)
+	}
+	records, err := parseLog(data)
+	if err != nil {
+		return err
+	}
+	prev := ""
+	if len(records) > 0 {
+		prev = records[len(records)-1].Hash
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	for _, record := range s.pendingLog {
+		record.Prev = prev
+		record.Hash = record.hash()
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode log record: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		prev = record.Hash
+	}
+	if err := s.entries().WriteFile(logFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write operation log: %w", err)
+	}
+	s.pendingLog = nil
+	return nil
+}
+
+// ReadLog returns the records of the operation log, oldest first
+func (s *Store) ReadLog() ([]LogRecord, error) {
+	data, err := s.entries().ReadFile(logFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrLogDisabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read operation log: %w", err)
+	}
+	return parseLog(data)
+}
+
+// VerifyLog checks the hash chain of the log, returning an error that names
+// the first record that was changed, removed or inserted
+func VerifyLog(records []LogRecord) error {
+	prev := ""
+	for i, record := range records {
+		if record.Prev != prev || record.Hash != record.hash() {
+			return fmt.Errorf("operation log was modified at record %d (%s %s %s)",
+				i+1, record.Time.Format(time.RFC3339), record.Op, record.Name)
+		}
+		prev = record.Hash
+	}
+	return nil
+}
+
+// hash computes the hash of a record over all fields but Hash
+func (r LogRecord) hash() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseLog parses the lines of the log
+func parseLog(data []byte) ([]LogRecord, error) {
+	var records []LogRecord
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record LogRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("invalid operation log line %d: %w", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOperationLog(t *testing.T) {
+	dir := t.TempDir()
+	store := &Store{rootDir: dir, encryptor: &MockEncryptor{}}
+	store.SetActor("alice@laptop")
+
+	// Nothing is recorded until the log is enabled
+	if err := store.Add("before", []byte("secret")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := store.ReadLog(); !errors.Is(err, ErrLogDisabled) {
+		t.Fatalf("Expected ErrLogDisabled, got %v", err)
+	}
+
+	store = &Store{rootDir: dir, encryptor: &MockEncryptor{}}
+	store.SetActor("alice@laptop")
+	if err := store.EnableLog(); err != nil {
+		t.Fatalf("EnableLog failed: %v", err)
+	}
+	if err := store.EnableLog(); err == nil {
+		t.Error("Expected enabling the log twice to fail")
+	}
+	store.Close()
+
+	store = &Store{rootDir: dir, encryptor: &MockEncryptor{}}
+	store.SetActor("bob@server")
+	for _, step := range []func() error{
+		func() error { return store.Add("web/db", []byte("secret")) },
+		func() error { return store.Add("web/db", []byte("changed")) },
+		func() error { return store.Delete("before") },
+	} {
+		if err := step(); err != nil {
+			t.Fatalf("Operation failed: %v", err)
+		}
+	}
+	store.Close()
+
+	records, err := store.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog failed: %v", err)
+	}
+	var ops []string
+	for _, record := range records {
+		ops = append(ops, record.Op+" "+record.Name+" "+record.Actor)
+	}
+	expected := "start  alice@laptop,add web/db bob@server,update web/db bob@server,delete before bob@server"
+	if got := strings.Join(ops, ","); got != expected {
+		t.Errorf("Expected records %q, got %q", expected, got)
+	}
+	if err := VerifyLog(records); err != nil {
+		t.Errorf("VerifyLog failed on an untouched log: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "changed") {
+		t.Error("The log must not contain secrets")
+	}
+}
+
+func TestVerifyLogDetectsTampering(t *testing.T) {
+	store := &Store{rootDir: t.TempDir(), encryptor: &MockEncryptor{}}
+	store.SetActor("alice@laptop")
+	if err := store.EnableLog(); err != nil {
+		t.Fatalf("EnableLog failed: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	store.Close()
+
+	records, err := store.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog failed: %v", err)
+	}
+
+	edited := append([]LogRecord(nil), records...)
+	edited[2].Actor = "mallory@elsewhere"
+	if err := VerifyLog(edited); err == nil || !strings.Contains(err.Error(), "record 3") {
+		t.Errorf("Expected the edited record to be reported, got %v", err)
+	}
+
+	removed := append(append([]LogRecord(nil), records[:1]...), records[2:]...)
+	if err := VerifyLog(removed); err == nil {
+		t.Error("Expected a removed record to be detected")
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultWorkers is how many entries bulk operations decrypt or encrypt at
+// once, unless changed with SetWorkers
+const DefaultWorkers = 8
+
+// Progress is called by bulk operations each time an entry is done
+type Progress func(done, total int)
+
+// SetWorkers sets how many entries bulk operations process at once
+func (s *Store) SetWorkers(n int) {
+	s.workers = n
+}
+
+// SetProgress sets the function told about the progress of bulk operations
+func (s *Store) SetProgress(progress Progress) {
+	s.progress = progress
+}
+
+// SetContext sets the context that stops bulk operations when it is done.
+// Entries already started are finished, and the operation returns an error
+// wrapping the context's error and saying how far it got.
+func (s *Store) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+// interrupted is the error of a bulk operation stopped by its context
+func interrupted(done, total int, err error) error {
+	return fmt.Errorf("interrupted after %d of %d entries: %w", done, total, err)
+}
+
+// forEach calls fn for every name on a bounded pool of goroutines. After the
+// first error, or once the store's context is done, no more names are
+// started, and that error is returned.
+func (s *Store) forEach(names []string, fn func(i int, name string) error) error {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Set up the default backend before the workers race to do so
+	s.entries()
+	workers := s.workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		done     int
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := fn(i, names[i])
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				done++
+				if s.progress != nil {
+					s.progress(done, len(names))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var stopped error
+	for i := range names {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		if stopped = ctx.Err(); stopped != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil && stopped != nil {
+		return interrupted(done, len(names), stopped)
+	}
+	return firstErr
+}
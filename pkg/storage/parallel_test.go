@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachBoundsWorkers(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), nil)
+	store.SetWorkers(3)
+
+	var mu sync.Mutex
+	var reports []int
+	store.SetProgress(func(done, total int) {
+		mu.Lock()
+		reports = append(reports, done)
+		mu.Unlock()
+	})
+
+	names := make([]string, 20)
+	for i := range names {
+		names[i] = fmt.Sprintf("entry%d", i)
+	}
+	seen := make([]bool, len(names))
+	var running, peak int32
+	err := store.forEach(names, func(i int, name string) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		seen[i] = names[i] == name
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("forEach failed: %v", err)
+	}
+
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("Entry %d was not processed", i)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("Expected at most 3 workers, saw %d", peak)
+	}
+	if len(reports) != len(names) || reports[len(reports)-1] != len(names) {
+		t.Errorf("Expected progress for every entry, got %v", reports)
+	}
+}
+
+func TestForEachStopsAfterError(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), nil)
+	store.SetWorkers(1)
+
+	failure := errors.New("failure")
+	calls := 0
+	err := store.forEach([]string{"a", "b", "c"}, func(i int, name string) error {
+		calls++
+		if name == "a" {
+			return failure
+		}
+		return nil
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the first error, got %v", err)
+	}
+	if calls > 2 {
+		t.Errorf("Expected no more entries to start after the error, got %d calls", calls)
+	}
+}
+
+func TestForEachStopsWhenCancelled(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), nil)
+	store.SetWorkers(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.SetContext(ctx)
+
+	calls := 0
+	err := store.forEach([]string{"a", "b", "c", "d"}, func(i int, name string) error {
+		calls++
+		if name == "b" {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the run to be cancelled, got %v", err)
+	}
+	if calls > 3 {
+		t.Errorf("Expected no more entries to start after cancelling, got %d calls", calls)
+	}
+}
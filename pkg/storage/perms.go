@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/rejoice4156/passh/pkg/logging"
+)
+
+// defaultFileMode keeps entries private to their owner
+const defaultFileMode os.FileMode = 0600
+
+// DirMode returns the mode of directories holding files of the given mode:
+// the same permissions, plus search wherever they allow reading
+func DirMode(fileMode os.FileMode) os.FileMode {
+	return fileMode | (fileMode&0444)>>2
+}
+
+// applyPermissions sets the mode and group of the files a directory tree
+// backend writes. Groups can only be looked up for local stores, and are
+// ignored for others.
+func applyPermissions(backend Backend, options BackendOptions) (Backend, error) {
+	tree, ok := backend.(*fileBackend)
+	if !ok {
+		return backend, nil
+	}
+	if options.FileMode != 0 {
+		tree.fileMode, tree.dirMode = options.FileMode, DirMode(options.FileMode)
+	}
+	if options.Group == "" {
+		return backend, nil
+	}
+	if _, local := tree.fs.(localFS); !local {
+		logging.Debugf("not setting group %s on a remote store", options.Group)
+		return backend, nil
+	}
+
+	gid, err := lookupGroup(options.Group)
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	tree.gid = gid
+	return backend, nil
+}
+
+// lookupGroup returns the ID of a group given by name or ID
+func lookupGroup(group string) (int, error) {
+	if runtime.GOOS == "windows" {
+		return 0, errors.New("groups for store files are not supported on Windows")
+	}
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	found, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up group '%s': %w", group, err)
+	}
+	return strconv.Atoi(found.Gid)
+}
+
+// mkdirAll creates a directory of the tree and those above it, giving the
+// new ones the configured mode and group
+func (b *fileBackend) mkdirAll(dir string) error {
+	var missing []string
+	for parent := dir; parent != b.rootDir && parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if _, err := b.fs.Stat(parent); err == nil {
+			break
+		}
+		missing = append(missing, parent)
+	}
+
+	if err := b.fs.MkdirAll(dir, b.dirMode); err != nil {
+		return fmt.Errorf("failed to create directory structure: %w", err)
+	}
+	for _, created := range missing {
+		if err := b.setOwnership(created, b.dirMode, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOwnership gives a written file or directory the configured mode, which
+// the umask may have narrowed, and the configured group if it was just
+// created. Stores with the default mode and no group need neither.
+func (b *fileBackend) setOwnership(path string, mode os.FileMode, created bool) error {
+	if b.fileMode == defaultFileMode && b.gid < 0 {
+		return nil
+	}
+	if info, err := b.fs.Stat(path); err != nil || info.Mode().Perm() != mode {
+		if err := b.fs.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to set the mode of '%s': %w", path, err)
+		}
+	}
+	if created && b.gid >= 0 {
+		if err := b.fs.Chown(path, b.gid); err != nil {
+			return fmt.Errorf("failed to set the group of '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// CheckPermissions reports the files and directories of a store kept in a
+// directory tree that other users can access beyond its configured mode, and
+// with fix restricts them to that mode. Other stores have nothing to check.
+func (s *Store) CheckPermissions(fix bool) ([]Problem, error) {
+	tree, ok := s.raw().(*fileBackend)
+	if !ok {
+		return nil, nil
+	}
+
+	var problems []Problem
+	err := tree.walk(func(path, rel string, info os.FileInfo) error {
+		problem, err := tree.checkMode(path, rel, info, fix)
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+		return err
+	})
+	if err != nil {
+		return problems, fmt.Errorf("failed to scan the store: %w", err)
+	}
+	return problems, nil
+}
+
+// walk calls fn for every file and directory of the tree, with its path
+// relative to the root. The .git directory is left alone.
+func (b *fileBackend) walk(fn func(path, rel string, info os.FileInfo) error) error {
+	return b.fs.Walk(b.rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(b.rootDir, path)
+		if err != nil {
+			return err
+		}
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
+
+// checkMode reports a file or directory that other users can access beyond
+// the configured mode, and with fix sets that mode. Modes mean nothing on
+// Windows.
+func (b *fileBackend) checkMode(path, rel string, info os.FileInfo, fix bool) (*Problem, error) {
+	mode := b.fileMode
+	if info.IsDir() {
+		mode = b.dirMode
+	}
+	if runtime.GOOS == "windows" || info.Mode().Perm()&0077&^mode == 0 {
+		return nil, nil
+	}
+
+	problem := &Problem{Kind: ProblemPermissions, Path: rel,
+		Detail: fmt.Sprintf("mode %04o lets others access it, should be %04o", info.Mode().Perm(), mode)}
+	if fix {
+		if err := b.fs.Chmod(path, mode); err != nil {
+			return problem, fmt.Errorf("failed to change the mode of '%s': %w", rel, err)
+		}
+		problem.Fixed = true
+	}
+	return problem, nil
+}
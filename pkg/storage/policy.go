@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+// PolicyFile at the root of a store limits which keys entries under each
+// path prefix may be encrypted to. Each line holds a prefix and the SHA256
+// fingerprints of the allowed keys, or of SSH CAs whose certificates are
+// allowed; the longest matching prefix applies, "/"
+// matches every entry, and entries no prefix matches are not restricted.
+const PolicyFile = ".passh-policy"
+
+// FindingPolicy is reported by AuditPolicy for keys outside the policy
+const FindingPolicy = "policy"
+
+// ErrPolicy is returned when an entry would be encrypted to a key that the
+// policy does not allow
+var ErrPolicy = errors.New("access policy violation")
+
+// Policy is a parsed PolicyFile
+type Policy struct {
+	Rules []PolicyRule
+}
+
+// PolicyRule allows the keys with the given fingerprints under a prefix
+type PolicyRule struct {
+	Prefix       string
+	Fingerprints []string
+}
+
+// ParsePolicy parses a policy file. Empty lines and lines starting with #
+// are ignored.
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a prefix followed by key fingerprints", i+1)
+		}
+
+		prefix := strings.Trim(fields[0], "/")
+		if seen[prefix] {
+			return nil, fmt.Errorf("line %d: prefix '%s' is listed twice", i+1, fields[0])
+		}
+		seen[prefix] = true
+		for _, fingerprint := range fields[1:] {
+			if !strings.HasPrefix(fingerprint, "SHA256:") {
+				return nil, fmt.Errorf("line %d: '%s' is not a SHA256 key fingerprint", i+1, fingerprint)
+			}
+		}
+		policy.Rules = append(policy.Rules, PolicyRule{Prefix: prefix, Fingerprints: fields[1:]})
+	}
+	return policy, nil
+}
+
+// RuleFor returns the rule with the longest prefix matching an entry, or nil
+// if the entry is not restricted
+func (p *Policy) RuleFor(name string) *PolicyRule {
+	var match *PolicyRule
+	for i, rule := range p.Rules {
+		if underPrefix(name, rule.Prefix) && (match == nil || len(rule.Prefix) > len(match.Prefix)) {
+			match = &p.Rules[i]
+		}
+	}
+	return match
+}
+
+// Disallowed returns the keys an entry may not be encrypted to
+func (p *Policy) Disallowed(name string, keys []ssh.PublicKey) []ssh.PublicKey {
+	rule := p.RuleFor(name)
+	if rule == nil {
+		return nil
+	}
+
+	var disallowed []ssh.PublicKey
+	for _, key := range keys {
+		// Certificates are also allowed by the fingerprint of their CA
+		accepted := []string{fingerprint(key)}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			accepted = append(accepted, ssh.FingerprintSHA256(cert.SignatureKey))
+		}
+		allowed := false
+		for _, other := range rule.Fingerprints {
+			if slices.Contains(accepted, other) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			disallowed = append(disallowed, key)
+		}
+	}
+	return disallowed
+}
+
+// policy returns the store's policy, or nil if it has none. It is read once.
+func (s *Store) policy() (*Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policyLoaded {
+		return s.accessPolicy, nil
+	}
+
+	data, err := s.entries().ReadFile(PolicyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		s.policyLoaded = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", PolicyFile, err)
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PolicyFile, err)
+	}
+	s.accessPolicy, s.policyLoaded = policy, true
+	return policy, nil
+}
+
+// checkPolicy refuses to encrypt an entry to keys outside the policy
+func (s *Store) checkPolicy(name string, keys []ssh.PublicKey) error {
+	policy, err := s.policy()
+	if err != nil || policy == nil {
+		return err
+	}
+
+	disallowed := policy.Disallowed(name, keys)
+	if len(disallowed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' would be encrypted to %s, which %s does not allow under '%s'",
+		ErrPolicy, name, fingerprints(disallowed), PolicyFile, displayPrefix(policy.RuleFor(name).Prefix))
+}
+
+// CheckPolicy returns an error wrapping ErrPolicy if any of the entries would
+// now be encrypted to keys outside the policy
+func (s *Store) CheckPolicy(names []string) error {
+	for _, name := range names {
+		keys, err := s.Recipients(name)
+		if err != nil {
+			return err
+		}
+		if err := s.checkPolicy(name, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditPolicy reports entries that are encrypted, or would be encrypted when
+// re-encrypted, to keys outside the policy. It reads the encrypted files and
+// decrypts nothing.
+func (s *Store) AuditPolicy() ([]Finding, error) {
+	policy, err := s.policy()
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("the store has no %s file", PolicyFile)
+	}
+
+	results, err := walkRecipients(s, "", func(name string, current, wanted []ssh.PublicKey) ([]Finding, bool) {
+		var findings []Finding
+		prefix := ""
+		if rule := policy.RuleFor(name); rule != nil {
+			prefix = displayPrefix(rule.Prefix)
+		}
+		if disallowed := policy.Disallowed(name, current); len(disallowed) > 0 {
+			findings = append(findings, Finding{Name: name, Kind: FindingPolicy,
+				Message: fmt.Sprintf("encrypted to %s, not allowed under '%s'", fingerprints(disallowed), prefix)})
+		}
+		if disallowed := missingKeys(policy.Disallowed(name, wanted), current); len(disallowed) > 0 {
+			findings = append(findings, Finding{Name: name, Kind: FindingPolicy,
+				Message: fmt.Sprintf("its recipients would add %s, not allowed under '%s'", fingerprints(disallowed), prefix)})
+		}
+		return findings, len(findings) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, result := range results {
+		findings = append(findings, result...)
+	}
+	return findings, nil
+}
+
+// fingerprint returns the SHA256 fingerprint of a key, or of the key a
+// certificate certifies
+func fingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(crypto.CertifiedKey(key))
+}
+
+// fingerprints lists the fingerprints of keys
+func fingerprints(keys []ssh.PublicKey) string {
+	list := make([]string, len(keys))
+	for i, key := range keys {
+		list[i] = fingerprint(key)
+	}
+	return strings.Join(list, ", ")
+}
+
+// displayPrefix shows a policy prefix, with "/" for the whole store
+func displayPrefix(prefix string) string {
+	if prefix == "" {
+		return "/"
+	}
+	return prefix
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte("# team access\n/ SHA256:owner\nteam/ SHA256:owner SHA256:alice\nteam/ops SHA256:owner\n"))
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+
+	for name, expected := range map[string]string{
+		"personal":      "",
+		"team/web":      "team",
+		"team/ops/db":   "team/ops",
+		"team/operator": "team",
+	} {
+		if rule := policy.RuleFor(name); rule == nil || rule.Prefix != expected {
+			t.Errorf("Expected %s to match '%s', got %+v", name, expected, rule)
+		}
+	}
+
+	for _, invalid := range []string{"team/", "team/ alice.pub", "team SHA256:a\nteam/ SHA256:b"} {
+		if _, err := ParsePolicy([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	owner := newTestSigner(t)
+	alice := newTestSigner(t)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(owner.PublicKey()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Fatal(err)
+	}
+	encryptor.AddSigner(owner)
+
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("team/ops/db", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	recipients := string(ssh.MarshalAuthorizedKey(owner.PublicKey())) + string(ssh.MarshalAuthorizedKey(alice.PublicKey()))
+	if err := backend.WriteFile("team/"+RecipientsFile, []byte(recipients)); err != nil {
+		t.Fatal(err)
+	}
+	policy := "team " + ssh.FingerprintSHA256(owner.PublicKey()) + " " + ssh.FingerprintSHA256(alice.PublicKey()) + "\n" +
+		"team/ops " + ssh.FingerprintSHA256(owner.PublicKey()) + "\n"
+	if err := backend.WriteFile(PolicyFile, []byte(policy)); err != nil {
+		t.Fatal(err)
+	}
+
+	store = NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("team/web", []byte("secret")); err != nil {
+		t.Errorf("Expected alice to be allowed under team, got %v", err)
+	}
+	if err := store.Add("team/ops/web", []byte("secret")); !errors.Is(err, ErrPolicy) {
+		t.Errorf("Expected ErrPolicy for team/ops, got %v", err)
+	}
+	if err := store.CheckPolicy([]string{"team/ops/db"}); !errors.Is(err, ErrPolicy) {
+		t.Errorf("Expected re-encrypting team/ops/db to violate the policy, got %v", err)
+	}
+
+	findings, err := store.AuditPolicy()
+	if err != nil {
+		t.Fatalf("AuditPolicy failed: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Name != "team/ops/db" || !strings.Contains(findings[0].Message, ssh.FingerprintSHA256(alice.PublicKey())) {
+		t.Errorf("Expected one finding for alice on team/ops/db, got %+v", findings)
+	}
+}
@@ -0,0 +1,445 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/ssh"
+)
+
+// RecipientsFile lists, in authorized_keys format, the public keys that
+// entries in its directory and all subdirectories are encrypted to. The
+// nearest file up the tree wins; without one, entries are encrypted to the
+// user's own keys.
+const RecipientsFile = ".passh-recipients"
+
+// RecipientChange describes how re-encrypting an entry changes who can read it
+type RecipientChange struct {
+	Name    string
+	Added   []ssh.PublicKey
+	Removed []ssh.PublicKey
+}
+
+// EntryRecipients lists the keys an entry is encrypted to
+type EntryRecipients struct {
+	Name string
+	Keys []ssh.PublicKey
+	// Stale is set when the entry would now be encrypted to other keys, for
+	// example after its recipients file changed, until it is re-encrypted
+	Stale bool
+}
+
+// ParseRecipients parses a recipients file. Empty lines and lines starting
+// with # are ignored.
+func ParseRecipients(data []byte) ([]ssh.PublicKey, error) {
+	keys, _, err := parseRecipients(data)
+	return keys, err
+}
+
+// parseRecipients parses a recipients file, also returning the comment of
+// each key, which names whose it is
+func parseRecipients(data []byte) ([]ssh.PublicKey, []string, error) {
+	var keys []ssh.PublicKey
+	var comments []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		keys = append(keys, publicKey)
+		comments = append(comments, comment)
+	}
+	return keys, comments, nil
+}
+
+// AddRecipient adds a public key that every entry is encrypted to, in
+// addition to the recipients from recipients files or the encryptor
+func (s *Store) AddRecipient(publicKey ssh.PublicKey) {
+	s.extraRecipients = append(s.extraRecipients, publicKey)
+}
+
+// Recipients returns the public keys an entry is encrypted to when it is
+// written, or nil if the encryptor does not support explicit recipients
+func (s *Store) Recipients(name string) ([]ssh.PublicKey, error) {
+	encryptor, ok := s.encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return nil, nil
+	}
+
+	keys, err := s.recipientsFileFor(name)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = encryptor.PublicKeys()
+	}
+	return append(append([]ssh.PublicKey(nil), keys...), s.extraRecipients...), nil
+}
+
+// AddRecipients adds authorized_keys lines to the recipients file of a
+// folder ("" for the whole store), skipping keys it already lists, and
+// returns the keys added. A folder without a recipients file gets one that
+// starts with the keys its entries are encrypted to now, so nobody loses
+// access. Existing entries keep their recipients until they are re-encrypted.
+func (s *Store) AddRecipients(folder string, lines [][]byte) ([]ssh.PublicKey, error) {
+	dir := folderDir(folder)
+	data, current, err := s.editRecipientsFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []ssh.PublicKey
+	for _, line := range lines {
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient: %w", err)
+		}
+		if len(missingKeys([]ssh.PublicKey{key}, append(current, added...))) == 0 {
+			continue
+		}
+		data = append(append(data, bytes.TrimSuffix(line, []byte("\n"))...), '\n')
+		added = append(added, key)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	return added, s.writeRecipientsFile(dir, data)
+}
+
+// RecipientName returns the comment a recipients file gives a key, such as
+// alice@laptop, or "" if the recipients files read so far don't name it
+func (s *Store) RecipientName(key ssh.PublicKey) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recipientNames[string(crypto.CertifiedKey(key).Marshal())]
+}
+
+// folderDir returns the directory of a folder name, "." for the whole store
+func folderDir(folder string) string {
+	if dir := strings.Trim(folder, "/"); dir != "" {
+		return dir
+	}
+	return "."
+}
+
+// editRecipientsFile returns the recipients file of a directory and the keys
+// it lists. For a directory without one, it returns the start of a new file
+// listing the keys its entries are encrypted to now.
+func (s *Store) editRecipientsFile(dir string) ([]byte, []ssh.PublicKey, error) {
+	encryptor, ok := s.encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return nil, nil, errors.New("the encryptor does not support recipients")
+	}
+
+	current, names, err := s.readRecipientsFile(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current != nil {
+		s.mu.Lock()
+		s.nameRecipients(current, names)
+		s.mu.Unlock()
+		data, err := s.entries().ReadFile(path.Join(dir, RecipientsFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read recipients file in '%s': %w", dir, err)
+		}
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		return data, current, nil
+	}
+
+	if current, err = s.recipientsFileFor(path.Join(dir, RecipientsFile)); err != nil {
+		return nil, nil, err
+	}
+	if current == nil {
+		current = encryptor.PublicKeys()
+	}
+	var data []byte
+	for _, key := range current {
+		data = append(data, ssh.MarshalAuthorizedKey(key)...)
+	}
+	return data, current, nil
+}
+
+// writeRecipientsFile replaces the recipients file of a directory
+func (s *Store) writeRecipientsFile(dir string, data []byte) error {
+	if err := s.entries().WriteFile(path.Join(dir, RecipientsFile), data); err != nil {
+		return fmt.Errorf("failed to write recipients file in '%s': %w", dir, err)
+	}
+	s.mu.Lock()
+	s.recipientFiles = nil
+	s.mu.Unlock()
+	return nil
+}
+
+// recipientsFileFor returns the keys from the recipients file nearest to an
+// entry, or nil if no directory above it has one
+func (s *Store) recipientsFileFor(name string) ([]ssh.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recipientFiles == nil {
+		s.recipientFiles = make(map[string][]ssh.PublicKey)
+	}
+
+	dir := path.Dir(name)
+	for {
+		keys, cached := s.recipientFiles[dir]
+		if !cached {
+			var names []string
+			var err error
+			if keys, names, err = s.readRecipientsFile(dir); err != nil {
+				return nil, err
+			}
+			s.recipientFiles[dir] = keys
+			s.nameRecipients(keys, names)
+		}
+		if keys != nil {
+			return keys, nil
+		}
+		if dir == "." {
+			return nil, nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// nameRecipients remembers the comments recipients files give keys. The
+// caller holds s.mu.
+func (s *Store) nameRecipients(keys []ssh.PublicKey, names []string) {
+	if s.recipientNames == nil {
+		s.recipientNames = make(map[string]string)
+	}
+	for i, key := range keys {
+		if names[i] != "" {
+			s.recipientNames[string(crypto.CertifiedKey(key).Marshal())] = names[i]
+		}
+	}
+}
+
+// readRecipientsFile reads the recipients file of a directory and the
+// comments of its keys, returning nil if it has none
+func (s *Store) readRecipientsFile(dir string) ([]ssh.PublicKey, []string, error) {
+	data, err := s.entries().ReadFile(path.Join(dir, RecipientsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read recipients file in '%s': %w", dir, err)
+	}
+
+	keys, names, err := parseRecipients(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid recipients file in '%s': %w", dir, err)
+	}
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("recipients file in '%s' lists no keys", dir)
+	}
+	return keys, names, nil
+}
+
+// encrypt encrypts the content of an entry to its recipients
+func (s *Store) encrypt(name string, data []byte) (string, error) {
+	encryptor, ok := s.encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return s.encryptor.Encrypt(data)
+	}
+
+	keys, err := s.Recipients(name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkPolicy(name, keys); err != nil {
+		return "", err
+	}
+	if err := checkCertificates(name, keys, time.Now()); err != nil {
+		return "", err
+	}
+	return encryptor.EncryptTo(data, keys)
+}
+
+// checkCertificates refuses to encrypt an entry to SSH certificates that are
+// expired, not yet valid or not signed by their CA
+func checkCertificates(name string, keys []ssh.PublicKey, now time.Time) error {
+	for _, key := range keys {
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			continue
+		}
+		if err := crypto.CheckCertificate(cert, now); err != nil {
+			return fmt.Errorf("'%s' would be encrypted to an %w; renew the certificate or remove it from the recipients",
+				name, err)
+		}
+	}
+	return nil
+}
+
+// RecipientChanges compares who every entry under prefix is encrypted to with
+// who it would be encrypted to now, and returns the entries that differ
+func (s *Store) RecipientChanges(prefix string) ([]RecipientChange, error) {
+	return walkRecipients(s, prefix, func(name string, current, wanted []ssh.PublicKey) (RecipientChange, bool) {
+		change := RecipientChange{Name: name, Added: missingKeys(wanted, current), Removed: missingKeys(current, wanted)}
+		return change, len(change.Added) > 0 || len(change.Removed) > 0
+	})
+}
+
+// ListRecipients returns the keys every entry under prefix is encrypted to,
+// read from the entries without decrypting them
+func (s *Store) ListRecipients(prefix string) ([]EntryRecipients, error) {
+	return walkRecipients(s, prefix, func(name string, current, wanted []ssh.PublicKey) (EntryRecipients, bool) {
+		stale := len(missingKeys(wanted, current)) > 0 || len(missingKeys(current, wanted)) > 0
+		return EntryRecipients{Name: name, Keys: current, Stale: stale}, true
+	})
+}
+
+// walkRecipients calls fn with the current and wanted recipients of every
+// entry under prefix, collecting the results it keeps
+func walkRecipients[T any](s *Store, prefix string, fn func(name string, current, wanted []ssh.PublicKey) (T, bool)) ([]T, error) {
+	encryptor, ok := s.encryptor.(crypto.RecipientEncryptor)
+	if !ok {
+		return nil, errors.New("the encryptor does not support recipients")
+	}
+
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []T
+	for _, name := range names {
+		if !underPrefix(name, prefix) {
+			continue
+		}
+
+		encrypted, err := s.entries().Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+		_, ciphertext, err := decodeEntryFile(encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("entry '%s': %w", name, err)
+		}
+		current, err := encryptor.Recipients(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients of '%s': %w", name, err)
+		}
+		wanted, err := s.Recipients(name)
+		if err != nil {
+			return nil, err
+		}
+		current = withCertificates(current, wanted)
+
+		if result, keep := fn(name, current, wanted); keep {
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// Reencrypt decrypts every entry under prefix ("" for all) and encrypts it
+// again to its current recipients, returning the names of the entries rewritten
+func (s *Store) Reencrypt(prefix string) ([]string, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, name := range names {
+		if underPrefix(name, prefix) {
+			selected = append(selected, name)
+		}
+	}
+	return selected, s.ReencryptEntries(selected)
+}
+
+// ReencryptEntries decrypts the given entries and encrypts them again to
+// their current recipients, leaving their content and metadata unchanged.
+// In stores with encrypted names, the name key is encrypted again too.
+func (s *Store) ReencryptEntries(names []string) error {
+	err := s.forEach(names, func(_ int, name string) error {
+		plaintext, err := s.readPlaintext(name)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt '%s': %w", name, err)
+		}
+		err = s.writePlaintext(name, plaintext)
+		secure.Wipe(plaintext)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt '%s': %w", name, err)
+		}
+		s.logOperation(LogReencrypt, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if encrypted, err := s.NamesEncrypted(); err != nil || !encrypted {
+		return err
+	}
+	all, err := s.List()
+	if err != nil {
+		return err
+	}
+	return s.wrapNameKey(all)
+}
+
+// underPrefix reports whether an entry is the prefix itself or inside the
+// folder it names; an empty prefix matches everything
+func underPrefix(name, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	return prefix == "" || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+// withCertificates replaces the keys an entry is encrypted to by the
+// certificates among its recipients that certify them, since entries only
+// record the certified keys
+func withCertificates(keys, recipients []ssh.PublicKey) []ssh.PublicKey {
+	result := make([]ssh.PublicKey, len(keys))
+	for i, key := range keys {
+		result[i] = key
+		for _, recipient := range recipients {
+			if _, ok := recipient.(*ssh.Certificate); ok && sameKey(key, recipient) {
+				result[i] = recipient
+				break
+			}
+		}
+	}
+	return result
+}
+
+// sameKey reports whether two keys, or the keys two certificates certify,
+// are the same
+func sameKey(a, b ssh.PublicKey) bool {
+	return bytes.Equal(crypto.CertifiedKey(a).Marshal(), crypto.CertifiedKey(b).Marshal())
+}
+
+// missingKeys returns the keys in a that are not in b
+func missingKeys(a, b []ssh.PublicKey) []ssh.PublicKey {
+	var missing []ssh.PublicKey
+	for _, key := range a {
+		found := false
+		for _, other := range b {
+			if sameKey(key, other) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
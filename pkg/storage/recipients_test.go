@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestSigner generates an ed25519 key for recipient tests
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func TestRecipientsFileInheritance(t *testing.T) {
+	owner := newTestSigner(t)
+	alice := newTestSigner(t)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(owner.PublicKey()), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	encryptor.AddSigner(owner)
+
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, encryptor)
+	for _, name := range []string{"team/db/prod", "team/web", "personal"} {
+		if err := store.Add(name, []byte("secret")); err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+	}
+
+	recipients := "# team members\n" + string(ssh.MarshalAuthorizedKey(owner.PublicKey())) +
+		string(ssh.MarshalAuthorizedKey(alice.PublicKey()))
+	if err := backend.WriteFile("team/"+RecipientsFile, []byte(recipients)); err != nil {
+		t.Fatalf("Failed to write recipients file: %v", err)
+	}
+
+	// A fresh store sees the new recipients file
+	store = NewStoreWithBackend(backend, encryptor)
+	changes, err := store.RecipientChanges("")
+	if err != nil {
+		t.Fatalf("Failed to compute recipient changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Name != "team/db/prod" || changes[1].Name != "team/web" {
+		t.Fatalf("Expected changes for the team entries, got %+v", changes)
+	}
+	if len(changes[0].Added) != 1 || ssh.FingerprintSHA256(changes[0].Added[0]) != ssh.FingerprintSHA256(alice.PublicKey()) {
+		t.Fatalf("Expected alice to gain access, got %+v", changes[0].Added)
+	}
+	if len(changes[0].Removed) != 0 {
+		t.Fatalf("Expected nobody to lose access, got %+v", changes[0].Removed)
+	}
+
+	listed, err := store.ListRecipients("")
+	if err != nil {
+		t.Fatalf("Failed to list recipients: %v", err)
+	}
+	if len(listed) != 3 || listed[0].Name != "personal" || listed[0].Stale || !listed[2].Stale || len(listed[2].Keys) != 1 {
+		t.Fatalf("Expected the team entries to be stale with one key, got %+v", listed)
+	}
+
+	prefixed, err := store.RecipientChanges("team/db")
+	if err != nil {
+		t.Fatalf("Failed to compute recipient changes: %v", err)
+	}
+	if len(prefixed) != 1 {
+		t.Fatalf("Expected one change under team/db, got %d", len(prefixed))
+	}
+
+	if err := store.ReencryptEntries([]string{"team/db/prod", "team/web"}); err != nil {
+		t.Fatalf("Failed to re-encrypt: %v", err)
+	}
+	changes, err = store.RecipientChanges("")
+	if err != nil {
+		t.Fatalf("Failed to compute recipient changes: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Expected no changes after re-encryption, got %+v", changes)
+	}
+	listed, err = store.ListRecipients("team/web")
+	if err != nil {
+		t.Fatalf("Failed to list recipients: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Stale || len(listed[0].Keys) != 2 {
+		t.Fatalf("Expected team/web to be encrypted to both keys, got %+v", listed)
+	}
+
+	// Alice can now read team entries but not personal ones
+	aliceEncryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	aliceEncryptor.AddSigner(alice)
+	aliceStore := NewStoreWithBackend(backend, aliceEncryptor)
+	if _, err := aliceStore.Get("team/db/prod"); err != nil {
+		t.Errorf("Expected alice to read team/db/prod: %v", err)
+	}
+	if _, err := aliceStore.Get("personal"); err == nil {
+		t.Error("Expected alice not to read personal")
+	}
+}
+
+func TestParseRecipientsInvalid(t *testing.T) {
+	if _, err := ParseRecipients([]byte("not a key\n")); err == nil {
+		t.Error("Expected an error for an invalid key line")
+	}
+}
+
+// newTestCertificate certifies key with ca for the given window
+func newTestCertificate(t *testing.T, ca ssh.Signer, key ssh.PublicKey, after, before time.Time) *ssh.Certificate {
+	cert := &ssh.Certificate{
+		Key:         key,
+		KeyId:       "alice",
+		CertType:    ssh.UserCert,
+		ValidAfter:  uint64(after.Unix()),
+		ValidBefore: uint64(before.Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("Failed to sign certificate: %v", err)
+	}
+	return cert
+}
+
+func TestCertificateRecipients(t *testing.T) {
+	owner := newTestSigner(t)
+	alice := newTestSigner(t)
+	ca := newTestSigner(t)
+
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	encryptor.AddSigner(owner)
+
+	now := time.Now()
+	cert := newTestCertificate(t, ca, alice.PublicKey(), now.Add(-time.Hour), now.Add(time.Hour))
+	backend := NewMemoryBackend()
+	recipients := string(ssh.MarshalAuthorizedKey(owner.PublicKey())) + string(ssh.MarshalAuthorizedKey(cert))
+	if err := backend.WriteFile(RecipientsFile, []byte(recipients)); err != nil {
+		t.Fatalf("Failed to write recipients file: %v", err)
+	}
+
+	// The entry is encrypted to the certified key, and listed with its certificate
+	store := NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("db", []byte("secret")); err != nil {
+		t.Fatalf("Failed to add to a certificate: %v", err)
+	}
+	listed, err := store.ListRecipients("")
+	if err != nil {
+		t.Fatalf("Failed to list recipients: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Stale || len(listed[0].Keys) != 2 {
+		t.Fatalf("Expected db to be up to date with two keys, got %+v", listed)
+	}
+	if _, ok := listed[0].Keys[1].(*ssh.Certificate); !ok {
+		t.Errorf("Expected alice to be listed by her certificate, got %T", listed[0].Keys[1])
+	}
+	aliceEncryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	aliceEncryptor.AddSigner(alice)
+	if _, err := NewStoreWithBackend(backend, aliceEncryptor).Get("db"); err != nil {
+		t.Errorf("Expected alice to read db: %v", err)
+	}
+
+	// A policy can allow everyone the CA certifies
+	policy := "/ " + ssh.FingerprintSHA256(owner.PublicKey()) + " " + ssh.FingerprintSHA256(ca.PublicKey()) + "\n"
+	if err := backend.WriteFile(PolicyFile, []byte(policy)); err != nil {
+		t.Fatal(err)
+	}
+	store = NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("web", []byte("secret")); err != nil {
+		t.Errorf("Expected the CA to be allowed by the policy, got %v", err)
+	}
+	if findings, err := store.AuditPolicy(); err != nil || len(findings) != 0 {
+		t.Errorf("Expected no policy findings, got %+v (%v)", findings, err)
+	}
+
+	// Renewing the certificate doesn't require re-encrypting
+	renewed := newTestCertificate(t, ca, alice.PublicKey(), now.Add(-time.Hour), now.Add(24*time.Hour))
+	recipients = string(ssh.MarshalAuthorizedKey(owner.PublicKey())) + string(ssh.MarshalAuthorizedKey(renewed))
+	if err := backend.WriteFile(RecipientsFile, []byte(recipients)); err != nil {
+		t.Fatal(err)
+	}
+	store = NewStoreWithBackend(backend, encryptor)
+	if changes, err := store.RecipientChanges(""); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes after renewing, got %+v (%v)", changes, err)
+	}
+
+	// Nothing is encrypted to an expired certificate
+	expired := newTestCertificate(t, ca, alice.PublicKey(), now.Add(-2*time.Hour), now.Add(-time.Hour))
+	recipients = string(ssh.MarshalAuthorizedKey(owner.PublicKey())) + string(ssh.MarshalAuthorizedKey(expired))
+	if err := backend.WriteFile(RecipientsFile, []byte(recipients)); err != nil {
+		t.Fatal(err)
+	}
+	store = NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("api", []byte("secret")); !errors.Is(err, crypto.ErrInvalidCertificate) {
+		t.Errorf("Expected an expired certificate to be refused, got %v", err)
+	}
+}
+
+func TestAddRecipients(t *testing.T) {
+	owner := newTestSigner(t)
+	alice := newTestSigner(t)
+	bob := newTestSigner(t)
+
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	publicKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(owner.PublicKey()), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	encryptor.AddSigner(owner)
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, encryptor)
+
+	// A new recipients file keeps the owner's access
+	aliceLine := append(bytes.TrimSuffix(ssh.MarshalAuthorizedKey(alice.PublicKey()), []byte("\n")), " github:alice\n"...)
+	added, err := store.AddRecipients("team", [][]byte{aliceLine})
+	if err != nil || len(added) != 1 {
+		t.Fatalf("Expected alice to be added, got %d keys (%v)", len(added), err)
+	}
+	keys, err := store.Recipients("team/db")
+	if err != nil || len(keys) != 2 || len(missingKeys([]ssh.PublicKey{owner.PublicKey(), alice.PublicKey()}, keys)) != 0 {
+		t.Fatalf("Expected the owner and alice as recipients, got %d keys (%v)", len(keys), err)
+	}
+
+	// Keys already listed are skipped, and others are appended
+	added, err = store.AddRecipients("team/", [][]byte{aliceLine, ssh.MarshalAuthorizedKey(bob.PublicKey())})
+	if err != nil || len(added) != 1 {
+		t.Fatalf("Expected only bob to be added, got %d keys (%v)", len(added), err)
+	}
+	data, err := backend.ReadFile("team/" + RecipientsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[1], " github:alice") {
+		t.Errorf("Unexpected recipients file:\n%s", data)
+	}
+	if keys, err := store.Recipients("personal"); err != nil || len(keys) != 1 {
+		t.Errorf("Expected entries outside the folder to keep their recipients, got %d keys (%v)", len(keys), err)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Keys imported from a source, such as a team's authorized_keys file or URL,
+// are kept in a block of the recipients file between these lines, so they
+// can be replaced when the source changes without touching other keys
+const (
+	sourceBegin = "# passh-source: "
+	sourceEnd   = "# passh-source-end"
+)
+
+// RecipientSources returns the sources the recipients file of a folder ("" for
+// the whole store) imports keys from
+func (s *Store) RecipientSources(folder string) ([]string, error) {
+	data, err := s.entries().ReadFile(path.Join(folderDir(folder), RecipientsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file in '%s': %w", folderDir(folder), err)
+	}
+
+	var sources []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if source, ok := strings.CutPrefix(strings.TrimSpace(line), sourceBegin); ok {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// RecipientFolders returns the folders with a recipients file, "" for the
+// store's root. Folders are found through the entries in them.
+func (s *Store) RecipientFolders() ([]string, error) {
+	names, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{".": true}
+	dirs := []string{"."}
+	for _, name := range names {
+		for dir := path.Dir(name); !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var folders []string
+	for _, dir := range dirs {
+		if _, err := s.entries().ReadFile(path.Join(dir, RecipientsFile)); err == nil {
+			folders = append(folders, strings.TrimPrefix(dir, "."))
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read recipients file in '%s': %w", dir, err)
+		}
+	}
+	slices.Sort(folders)
+	return folders, nil
+}
+
+// ImportChanges returns the keys that importing lines from source into the
+// recipients file of a folder would add and remove, as ImportRecipients
+// would write it
+func (s *Store) ImportChanges(folder, source string, lines [][]byte) (RecipientChange, error) {
+	dir := folderDir(folder)
+	_, current, updated, err := s.importRecipients(dir, source, lines)
+	if err != nil {
+		return RecipientChange{}, err
+	}
+	return RecipientChange{
+		Name:    path.Join(dir, RecipientsFile),
+		Added:   missingKeys(updated, current),
+		Removed: missingKeys(current, updated),
+	}, nil
+}
+
+// ImportRecipients replaces the keys imported from source into the
+// recipients file of a folder by lines, adding a block for the source if the
+// file doesn't import it yet. Other keys in the file are kept. As with
+// AddRecipients, a folder without a recipients file gets one that starts
+// with the keys its entries are encrypted to now.
+func (s *Store) ImportRecipients(folder, source string, lines [][]byte) error {
+	dir := folderDir(folder)
+	data, _, _, err := s.importRecipients(dir, source, lines)
+	if err != nil {
+		return err
+	}
+	return s.writeRecipientsFile(dir, data)
+}
+
+// importRecipients returns the recipients file of a directory with the block
+// of a source replaced, along with the keys before and after
+func (s *Store) importRecipients(dir, source string, lines [][]byte) ([]byte, []ssh.PublicKey, []ssh.PublicKey, error) {
+	if source == "" || strings.ContainsAny(source, "\r\n") {
+		return nil, nil, nil, fmt.Errorf("invalid recipient source '%s'", source)
+	}
+	data, current, err := s.editRecipientsFile(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	block := []string{sourceBegin + source}
+	for _, line := range lines {
+		block = append(block, strings.TrimSpace(string(line)))
+	}
+	block = append(block, sourceEnd)
+
+	var result []string
+	replaced, inBlock := false, false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == sourceBegin+source:
+			inBlock = true
+		case inBlock && trimmed == sourceEnd:
+			inBlock = false
+			if !replaced {
+				result = append(result, block...)
+				replaced = true
+			}
+		case !inBlock:
+			result = append(result, line)
+		}
+	}
+	if inBlock {
+		return nil, nil, nil, fmt.Errorf("recipients file in '%s' doesn't end the keys from %s with '%s'", dir, source, sourceEnd)
+	}
+	if !replaced {
+		if len(result) == 1 && result[0] == "" {
+			result = nil
+		}
+		result = append(result, block...)
+	}
+	data = []byte(strings.Join(result, "\n") + "\n")
+
+	updated, err := ParseRecipients(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid key from %s: %w", source, err)
+	}
+	if len(updated) == 0 {
+		return nil, nil, nil, fmt.Errorf("recipients file in '%s' would list no keys", dir)
+	}
+	return data, current, updated, nil
+}
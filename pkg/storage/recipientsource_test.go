@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestImportRecipients(t *testing.T) {
+	owner := newTestSigner(t)
+	alice := newTestSigner(t)
+	bob := newTestSigner(t)
+	carol := newTestSigner(t)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(publicKeyPath, ssh.MarshalAuthorizedKey(owner.PublicKey()), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	encryptor, err := crypto.NewSSHEncryptor(false)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if err := encryptor.AddPublicKeyFromFile(publicKeyPath); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, encryptor)
+	if err := store.Add("team/db", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	line := func(signer ssh.Signer, name string) []byte {
+		return []byte(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))) + " " + name + "\n")
+	}
+	source := "https://example.com/team.keys"
+
+	change, err := store.ImportChanges("team", source, [][]byte{line(alice, "alice@corp"), line(bob, "bob@corp")})
+	if err != nil || len(change.Added) != 2 || len(change.Removed) != 0 || change.Name != "team/"+RecipientsFile {
+		t.Fatalf("Expected alice and bob to be added to team, got %+v (%v)", change, err)
+	}
+	if err := store.ImportRecipients("team", source, [][]byte{line(alice, "alice@corp"), line(bob, "bob@corp")}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	// Keys added by hand are kept when the source changes
+	if _, err := store.AddRecipients("team", [][]byte{line(carol, "carol@corp")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sources, err := store.RecipientSources("team"); err != nil || len(sources) != 1 || sources[0] != source {
+		t.Errorf("Expected the source to be recorded, got %v (%v)", sources, err)
+	}
+	if folders, err := store.RecipientFolders(); err != nil || len(folders) != 1 || folders[0] != "team" {
+		t.Errorf("Expected team to have a recipients file, got %v (%v)", folders, err)
+	}
+
+	// Bob left the team
+	change, err = store.ImportChanges("team/", source, [][]byte{line(alice, "alice@corp")})
+	if err != nil || len(change.Added) != 0 || len(change.Removed) != 1 || !sameKey(change.Removed[0], bob.PublicKey()) {
+		t.Fatalf("Expected bob to be removed, got %+v (%v)", change, err)
+	}
+	if err := store.ImportRecipients("team", source, [][]byte{line(alice, "alice@corp")}); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	keys, err := store.Recipients("team/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ssh.PublicKey{owner.PublicKey(), alice.PublicKey(), carol.PublicKey()}
+	if len(keys) != 3 || len(missingKeys(expected, keys)) != 0 {
+		t.Errorf("Expected the owner, alice and carol as recipients, got %d keys", len(keys))
+	}
+	if name := store.RecipientName(alice.PublicKey()); name != "alice@corp" {
+		t.Errorf("Expected alice to be named by her comment, got %q", name)
+	}
+
+	data, err := backend.ReadFile("team/" + RecipientsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), sourceBegin) != 1 || strings.Count(string(data), sourceEnd) != 1 {
+		t.Errorf("Expected one block for the source, got:\n%s", data)
+	}
+
+	// A source can't leave a folder without recipients
+	if err := backend.WriteFile(RecipientsFile, []byte(sourceBegin+source+"\n"+string(line(alice, ""))+sourceEnd+"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ImportRecipients("", source, nil); err == nil {
+		t.Error("Expected a recipients file without keys to be refused")
+	}
+}
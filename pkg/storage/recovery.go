@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Recovery codes are kept in their entry as one "recovery: CODE" line per
+// unused code, which becomes "recovery-used: CODE" once the code is used
+const (
+	recoveryField     = "recovery"
+	recoveryUsedField = "recovery-used"
+)
+
+// LowRecoveryCodes is the number of unused recovery codes at or below which
+// Audit reports an entry
+const LowRecoveryCodes = 2
+
+// ErrNoRecoveryCodes is returned when an entry has no unused recovery codes
+var ErrNoRecoveryCodes = errors.New("no unused recovery codes")
+
+// RecoveryCodes returns the unused and used recovery codes of an entry, in
+// the order they were added
+func RecoveryCodes(secret []byte) (unused, used []string) {
+	for _, line := range entryLines(secret)[1:] {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case recoveryField:
+			unused = append(unused, strings.TrimSpace(value))
+		case recoveryUsedField:
+			used = append(used, strings.TrimSpace(value))
+		}
+	}
+	return unused, used
+}
+
+// SetRecoveryCodes replaces the recovery codes of an entry, used or not, with
+// codes. New codes usually invalidate the old ones.
+func (s *Store) SetRecoveryCodes(name string, codes []string) error {
+	if len(codes) == 0 {
+		return errors.New("no recovery codes given")
+	}
+	return s.Update(name, func(secret []byte) ([]byte, error) {
+		var lines []string
+		for i, line := range entryLines(secret) {
+			if i == 0 || !isRecoveryLine(line) {
+				lines = append(lines, line)
+			}
+		}
+		for _, code := range codes {
+			lines = append(lines, recoveryField+": "+code)
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	})
+}
+
+// UseRecoveryCode marks the first unused recovery code of an entry as used
+// and returns it, with the number of unused codes left
+func (s *Store) UseRecoveryCode(name string) (string, int, error) {
+	var code string
+	var left int
+	err := s.Update(name, func(secret []byte) ([]byte, error) {
+		lines := entryLines(secret)
+		found := -1
+		for i, line := range lines[1:] {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), recoveryField) {
+				continue
+			}
+			if found < 0 {
+				found, code = i+1, strings.TrimSpace(value)
+			} else {
+				left++
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("entry '%s': %w", name, ErrNoRecoveryCodes)
+		}
+		lines[found] = recoveryUsedField + ": " + code
+		return []byte(strings.Join(lines, "\n")), nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return code, left, nil
+}
+
+// recoveryFinding reports an entry with recovery codes that is running out
+// of unused ones
+func recoveryFinding(name string, secret []byte) (Finding, bool) {
+	unused, used := RecoveryCodes(secret)
+	if len(unused)+len(used) == 0 || len(unused) > LowRecoveryCodes {
+		return Finding{}, false
+	}
+	return Finding{Name: name, Kind: FindingRecovery,
+		Message: fmt.Sprintf("%d of %d recovery codes left", len(unused), len(unused)+len(used))}, true
+}
+
+// isRecoveryLine reports whether a line holds a recovery code, used or not
+func isRecoveryLine(line string) bool {
+	key, _, ok := strings.Cut(line, ":")
+	key = strings.ToLower(strings.TrimSpace(key))
+	return ok && (key == recoveryField || key == recoveryUsedField)
+}
+
+// entryLines splits an entry into lines, the first being the password
+func entryLines(secret []byte) []string {
+	return strings.Split(string(bytes.TrimSuffix(secret, []byte("\n"))), "\n")
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+	if err := store.Add("github", []byte("Xk9#mQ2$vL7@pR4z\nuser: alice\nrecovery-used: old-1\nrecovery: old-2")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// New codes replace the old ones, used or not
+	if err := store.SetRecoveryCodes("github", []string{"aaaa-1111", "bbbb-2222", "cccc-3333"}); err != nil {
+		t.Fatalf("SetRecoveryCodes failed: %v", err)
+	}
+	for i, expected := range []string{"aaaa-1111", "bbbb-2222", "cccc-3333"} {
+		code, left, err := store.UseRecoveryCode("github")
+		if err != nil {
+			t.Fatalf("UseRecoveryCode failed: %v", err)
+		}
+		if code != expected || left != 2-i {
+			t.Errorf("Expected %s with %d left, got %s with %d", expected, 2-i, code, left)
+		}
+	}
+	if _, _, err := store.UseRecoveryCode("github"); !errors.Is(err, ErrNoRecoveryCodes) {
+		t.Errorf("Expected ErrNoRecoveryCodes, got %v", err)
+	}
+
+	secret, err := store.Get("github")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	unused, used := RecoveryCodes(secret)
+	if len(unused) != 0 || !reflect.DeepEqual(used, []string{"aaaa-1111", "bbbb-2222", "cccc-3333"}) {
+		t.Errorf("Unexpected codes: unused %v, used %v", unused, used)
+	}
+	if entryLines(secret)[0] != "Xk9#mQ2$vL7@pR4z" {
+		t.Errorf("Expected the password to be kept, got %q", secret)
+	}
+
+	findings, err := store.Audit(time.Now())
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Kind != FindingRecovery || findings[0].Message != "0 of 3 recovery codes left" {
+		t.Errorf("Expected a recovery finding, got %+v", findings)
+	}
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// sftpFS is a fileSystem backed by a remote machine, reached through the
+// system ssh client so the user's ssh config, known hosts and agent apply.
+// Entries are transferred encrypted; decryption always happens locally.
+type sftpFS struct {
+	client *sftp.Client
+	cmd    *exec.Cmd
+}
+
+// isRemoteStore reports whether the store location refers to a remote store
+func isRemoteStore(location string) bool {
+	return strings.HasPrefix(location, "ssh://")
+}
+
+// NewSFTPBackend creates a backend for a store given as
+// ssh://[user@]host[:port]/path. Paths starting with /~/ are relative to the
+// remote home directory.
+func NewSFTPBackend(location string) (Backend, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote store URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("remote store URL %q has no host", location)
+	}
+
+	remote, err := dialSFTP(u)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := newTreeBackend(remoteRoot(u.Path), remote)
+	if err != nil {
+		_ = remote.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// sshArgs returns the arguments for ssh to start the sftp subsystem on the
+// host of a remote store URL, and the user@host it connects to
+func sshArgs(u *url.URL) ([]string, string, error) {
+	target := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		target = u.User.Username() + "@" + target
+	}
+	// ssh would take a user or host starting with a dash for an option, such
+	// as -oProxyCommand=..., and run what it names
+	if strings.HasPrefix(target, "-") {
+		return nil, "", fmt.Errorf("remote store user or host %q can't start with '-'", target)
+	}
+
+	var args []string
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	return append(args, "-s", "--", target, "sftp"), target, nil
+}
+
+// dialSFTP starts an SFTP session through the system ssh client
+func dialSFTP(u *url.URL) (*sftpFS, error) {
+	args, target, err := sshArgs(u)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ssh: %w", err)
+	}
+
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("failed to start SFTP session with %s: %w", target, err)
+	}
+
+	return &sftpFS{client: client, cmd: cmd}, nil
+}
+
+// remoteRoot converts the path component of a remote store URL to an SFTP path
+func remoteRoot(urlPath string) string {
+	switch {
+	case urlPath == "" || urlPath == "/~":
+		return "."
+	case strings.HasPrefix(urlPath, "/~/"):
+		return strings.TrimPrefix(urlPath, "/~/")
+	default:
+		return urlPath
+	}
+}
+
+func (f *sftpFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.client.Open(filepath.ToSlash(name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func (f *sftpFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	file, err := f.Create(name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.(*sftpWriter).abort()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *sftpFS) Open(name string) (io.ReadCloser, error) {
+	return f.client.Open(filepath.ToSlash(name))
+}
+
+// Create writes to a new temporary file next to name, which only gets its
+// name once it is closed. SFTP creates files with the server's umask, so the
+// file is restricted to perm before anything is written to it.
+func (f *sftpFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(name)
+	temp := name + "." + hex.EncodeToString(suffix) + ".tmp"
+
+	file, err := f.client.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return nil, err
+	}
+	writer := &sftpWriter{File: file, fs: f, temp: temp, name: name}
+	if err := file.Chmod(perm); err != nil {
+		writer.abort()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// sftpWriter is a file being written under a temporary name
+type sftpWriter struct {
+	*sftp.File
+	fs         *sftpFS
+	temp, name string
+}
+
+// Close finishes the file and renames it over the file it replaces
+func (w *sftpWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		_ = w.fs.client.Remove(w.temp)
+		return err
+	}
+	if err := w.fs.rename(w.temp, w.name); err != nil {
+		_ = w.fs.client.Remove(w.temp)
+		return err
+	}
+	return nil
+}
+
+// abort closes and removes the temporary file
+func (w *sftpWriter) abort() {
+	_ = w.File.Close()
+	_ = w.fs.client.Remove(w.temp)
+}
+
+// rename moves a file over another. Plain SFTP renames fail if the target
+// exists, so without the OpenSSH extension for POSIX renames the target is
+// removed first.
+func (f *sftpFS) rename(from, to string) error {
+	if _, ok := f.client.HasExtension("posix-rename@openssh.com"); ok {
+		return f.client.PosixRename(from, to)
+	}
+	if err := f.client.Remove(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return f.client.Rename(from, to)
+}
+
+func (f *sftpFS) MkdirAll(path string, perm os.FileMode) error {
+	path = filepath.ToSlash(path)
+	if err := f.client.MkdirAll(path); err != nil {
+		return err
+	}
+	return f.client.Chmod(path, perm)
+}
+
+func (f *sftpFS) Remove(name string) error {
+	return f.client.Remove(filepath.ToSlash(name))
+}
+
+func (f *sftpFS) Chmod(name string, perm os.FileMode) error {
+	return f.client.Chmod(filepath.ToSlash(name), perm)
+}
+
+// Chown is not supported, as remote groups can't be looked up locally
+func (f *sftpFS) Chown(name string, gid int) error {
+	return errors.ErrUnsupported
+}
+
+func (f *sftpFS) Stat(name string) (os.FileInfo, error) {
+	return f.client.Stat(filepath.ToSlash(name))
+}
+
+func (f *sftpFS) Walk(root string, fn filepath.WalkFunc) error {
+	walker := f.client.Walk(filepath.ToSlash(root))
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if err := fn(walker.Path(), nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info := walker.Stat()
+		if err := fn(walker.Path(), info, nil); err != nil {
+			if err == filepath.SkipDir && info.IsDir() {
+				walker.SkipDir()
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *sftpFS) Close() error {
+	err := f.client.Close()
+	if waitErr := f.cmd.Wait(); err == nil && waitErr != nil {
+		// ssh exits non-zero when the session is torn down, which is expected here
+		if _, ok := waitErr.(*exec.ExitError); !ok {
+			err = waitErr
+		}
+	}
+	return err
+}
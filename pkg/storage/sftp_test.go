@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+func TestIsRemoteStore(t *testing.T) {
+	if !isRemoteStore("ssh://user@host/srv/passh") {
+		t.Error("Expected ssh:// location to be remote")
+	}
+	if isRemoteStore("/home/user/.passh") {
+		t.Error("Expected local path not to be remote")
+	}
+	if isRemoteStore("") {
+		t.Error("Expected empty location not to be remote")
+	}
+}
+
+func TestRemoteRoot(t *testing.T) {
+	tests := map[string]string{
+		"":               ".",
+		"/~":             ".",
+		"/~/.passh":      ".passh",
+		"/srv/passh":     "/srv/passh",
+		"/~/team/secret": "team/secret",
+	}
+
+	for urlPath, expected := range tests {
+		if got := remoteRoot(urlPath); got != expected {
+			t.Errorf("remoteRoot(%q) = %q, expected %q", urlPath, got, expected)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	u, _ := url.Parse("ssh://alice@host:2222/srv/passh")
+	args, target, err := sshArgs(u)
+	if err != nil {
+		t.Fatalf("sshArgs failed: %v", err)
+	}
+	if target != "alice@host" || !reflect.DeepEqual(args, []string{"-p", "2222", "-s", "--", "alice@host", "sftp"}) {
+		t.Errorf("Expected the destination after --, got %v", args)
+	}
+
+	for _, location := range []string{"ssh://-oProxyCommand=touch%20pwned@host/p", "ssh://-oProxyCommand=x/p"} {
+		u, err := url.Parse(location)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		if _, _, err := sshArgs(u); err == nil {
+			t.Errorf("Expected %s to be rejected", location)
+		}
+	}
+}
+
+// newTestSFTP serves an in-memory SFTP server to a client
+func newTestSFTP(t *testing.T) *sftpFS {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("NewClientPipe failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return &sftpFS{client: client}
+}
+
+func TestSFTPWriteFile(t *testing.T) {
+	fs := newTestSFTP(t)
+	for _, content := range []string{"first", "second"} {
+		if err := fs.WriteFile("/entry.enc", []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if data, err := fs.ReadFile("/entry.enc"); err != nil || string(data) != content {
+			t.Errorf("Expected %q, got %q (%v)", content, data, err)
+		}
+	}
+
+	files, err := fs.client.ReadDir("/")
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != "entry.enc" {
+		t.Errorf("Expected no temporary files to be left, got %d files", len(files))
+	}
+}
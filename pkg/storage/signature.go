@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureNamespace is the 'ssh-keygen -Y' namespace of entry signatures
+const SignatureNamespace = "passh-entry"
+
+// ErrUnsigned is returned when verifying an entry that has no signature
+var ErrUnsigned = errors.New("entry is not signed")
+
+// SetSigner makes the store sign every entry it writes with signer. Anyone
+// who knows the recipients' public keys can write an entry, so signatures
+// show who wrote it.
+func (s *Store) SetSigner(signer ssh.Signer) {
+	s.signer = signer
+}
+
+// seal signs a secret if the store has a signer, and prepends its metadata
+func (s *Store) seal(name string, secret []byte, meta Metadata) ([]byte, error) {
+	meta.Signature = ""
+	if s.signer != nil {
+		message := signedMessage(name, secret)
+		signature, err := crypto.SignSSH(s.signer, SignatureNamespace, bytes.NewReader(message))
+		secure.Wipe(message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign '%s': %w", name, err)
+		}
+		meta.Signature = string(signature)
+	}
+	return sealEntry(secret, meta)
+}
+
+// VerifySignature checks that an entry was signed by one of the trusted keys
+// and returns the key that signed it
+func (s *Store) VerifySignature(name string, trusted []ssh.PublicKey) (ssh.PublicKey, error) {
+	secret, meta, err := s.readEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	defer secure.Wipe(secret)
+	if meta.Signature == "" {
+		return nil, ErrUnsigned
+	}
+
+	message := signedMessage(name, secret)
+	defer secure.Wipe(message)
+	return crypto.VerifySSHSignature(trusted, SignatureNamespace, bytes.NewReader(message), []byte(meta.Signature))
+}
+
+// signedMessage binds the secret to the entry name, so a signed entry can't
+// be copied to another name
+func signedMessage(name string, secret []byte) []byte {
+	message := make([]byte, 0, len(name)+1+len(secret))
+	message = append(message, name...)
+	message = append(message, 0)
+	return append(message, secret...)
+}
+
+// ParseAllowedSigners reads the public keys from an allowed signers file as
+// used by 'ssh-keygen -Y verify' and git: each line lists principals,
+// optional options and a public key. Empty lines and comments are ignored.
+func ParseAllowedSigners(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		// ParseAuthorizedKey skips the options in front of the key
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[1:], " ")))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		keys = append(keys, publicKey)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the allowed signers file lists no keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEntrySignatures(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("unsigned", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := newTestSigner(t)
+	store.SetSigner(alice)
+	if err := store.Add("team/db", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	trusted := []ssh.PublicKey{alice.PublicKey()}
+	if key, err := store.VerifySignature("team/db", trusted); err != nil || ssh.FingerprintSHA256(key) != ssh.FingerprintSHA256(alice.PublicKey()) {
+		t.Errorf("Expected a valid signature by alice, got %v", err)
+	}
+	if _, err := store.VerifySignature("team/db", []ssh.PublicKey{newTestSigner(t).PublicKey()}); err == nil {
+		t.Error("Expected a signature by an untrusted key to be rejected")
+	}
+	if _, err := store.VerifySignature("unsigned", trusted); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Expected ErrUnsigned, got %v", err)
+	}
+
+	// A signed entry copied to another name no longer verifies
+	data, err := backend.Get("team/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Put("team/web", data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.VerifySignature("team/web", trusted); !errors.Is(err, crypto.ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for a copied entry, got %v", err)
+	}
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	alice := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	bob := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	data := "# team\nalice@example.com " + string(alice) + "\n" +
+		`bob@example.com,bob@home namespaces="passh-entry" ` + string(bob)
+
+	keys, err := ParseAllowedSigners([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseAllowedSigners failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected 2 keys, got %d", len(keys))
+	}
+
+	for _, invalid := range []string{"", "# only a comment\n", "alice@example.com not-a-key"} {
+		if _, err := ParseAllowedSigners([]byte(invalid)); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
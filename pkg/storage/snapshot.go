@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// snapshotVersion is the version of the snapshot format
+	snapshotVersion = 1
+	// SnapshotNamespace is the 'ssh-keygen -Y' namespace of snapshot signatures
+	SnapshotNamespace = "passh-snapshot"
+)
+
+// ErrSnapshotUnsigned is returned when verifying a snapshot without a signature
+var ErrSnapshotUnsigned = errors.New("snapshot is not signed")
+
+// Snapshot records the checksum of every encrypted entry file at one point
+// in time, so a store can later be checked for entries that were added,
+// removed or changed, without decrypting anything
+type Snapshot struct {
+	Version   int             `json:"version"`
+	Created   time.Time       `json:"created"`
+	Entries   []SnapshotEntry `json:"entries"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// SnapshotEntry is the checksum of one encrypted entry file
+type SnapshotEntry struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// SnapshotDiff lists the entry files that differ from a snapshot
+type SnapshotDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Empty reports whether the store matches the snapshot
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// CreateSnapshot checksums every entry file and signs the result with
+// signer, returning it encoded as JSON
+func (s *Store) CreateSnapshot(signer ssh.Signer) ([]byte, *Snapshot, error) {
+	entries, err := s.snapshotEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := &Snapshot{Version: snapshotVersion, Created: time.Now().UTC().Truncate(time.Second), Entries: entries}
+
+	message, err := snapshot.signedMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := crypto.SignSSH(signer, SnapshotNamespace, bytes.NewReader(message))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign snapshot: %w", err)
+	}
+	snapshot.Signature = string(signature)
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return append(data, '\n'), snapshot, nil
+}
+
+// ParseSnapshot decodes a snapshot and checks that it was signed by one of
+// the trusted keys, returning the key that signed it
+func ParseSnapshot(data []byte, trusted []ssh.PublicKey) (*Snapshot, ssh.PublicKey, error) {
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+	if snapshot.Signature == "" {
+		return nil, nil, ErrSnapshotUnsigned
+	}
+
+	message, err := snapshot.signedMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := crypto.VerifySSHSignature(trusted, SnapshotNamespace, bytes.NewReader(message), []byte(snapshot.Signature))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot signature: %w", err)
+	}
+	return &snapshot, key, nil
+}
+
+// CompareSnapshot returns the entry files that were added, removed or
+// changed since a snapshot
+func (s *Store) CompareSnapshot(snapshot *Snapshot) (SnapshotDiff, error) {
+	current, err := s.snapshotEntries()
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+
+	recorded := make(map[string]string, len(snapshot.Entries))
+	for _, entry := range snapshot.Entries {
+		recorded[entry.File] = entry.SHA256
+	}
+	var diff SnapshotDiff
+	for _, entry := range current {
+		sum, found := recorded[entry.File]
+		switch {
+		case !found:
+			diff.Added = append(diff.Added, entry.File)
+		case sum != entry.SHA256:
+			diff.Changed = append(diff.Changed, entry.File)
+		}
+		delete(recorded, entry.File)
+	}
+	for file := range recorded {
+		diff.Removed = append(diff.Removed, file)
+	}
+	slices.Sort(diff.Removed)
+	return diff, nil
+}
+
+// snapshotEntries checksums the encrypted entry files, in order. The files
+// are read as stored, so stores with encrypted names are listed by their
+// file names.
+func (s *Store) snapshotEntries() ([]SnapshotEntry, error) {
+	files, err := s.raw().List()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	entries := make([]SnapshotEntry, len(files))
+	err = s.forEach(files, func(i int, file string) error {
+		data, err := s.raw().Get(file)
+		if err != nil {
+			return fmt.Errorf("failed to read '%s': %w", file, err)
+		}
+		sum := sha256.Sum256(data)
+		entries[i] = SnapshotEntry{File: file, SHA256: hex.EncodeToString(sum[:])}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// signedMessage is what a snapshot's signature covers: the snapshot without
+// its signature
+func (snapshot Snapshot) signedMessage() ([]byte, error) {
+	snapshot.Signature = ""
+	message, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return message, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSnapshot(t *testing.T) {
+	backend := NewMemoryBackend()
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	for _, name := range []string{"email/work", "team/db", "team/web"} {
+		if err := store.Add(name, []byte("secret "+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice := newTestSigner(t)
+	data, snapshot, err := store.CreateSnapshot(alice)
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed: %v", err)
+	}
+	if len(snapshot.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(snapshot.Entries))
+	}
+
+	trusted := []ssh.PublicKey{alice.PublicKey()}
+	parsed, key, err := ParseSnapshot(data, trusted)
+	if err != nil || ssh.FingerprintSHA256(key) != ssh.FingerprintSHA256(alice.PublicKey()) {
+		t.Fatalf("Expected a snapshot signed by alice, got %v", err)
+	}
+	if diff, err := store.CompareSnapshot(parsed); err != nil || !diff.Empty() {
+		t.Fatalf("Expected the store to match the snapshot, got %+v (%v)", diff, err)
+	}
+
+	// Entries added, removed and changed since are reported
+	if err := store.Add("team/new", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("team/web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("team/db", []byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := store.CompareSnapshot(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(diff.Added, []string{"team/new"}) || !slices.Equal(diff.Removed, []string{"team/web"}) || !slices.Equal(diff.Changed, []string{"team/db"}) {
+		t.Errorf("Unexpected differences %+v", diff)
+	}
+
+	// Tampering with the snapshot or signing it with another key is detected
+	if _, _, err := ParseSnapshot(data, []ssh.PublicKey{newTestSigner(t).PublicKey()}); err == nil {
+		t.Error("Expected a snapshot signed by an untrusted key to be rejected")
+	}
+	tampered := bytes.Replace(data, []byte(snapshot.Entries[0].SHA256), []byte(snapshot.Entries[1].SHA256), 1)
+	if _, _, err := ParseSnapshot(tampered, trusted); err == nil {
+		t.Error("Expected a tampered snapshot to be rejected")
+	}
+	unsigned := *snapshot
+	unsigned.Signature = ""
+	message, _ := unsigned.signedMessage()
+	if _, _, err := ParseSnapshot(message, trusted); !errors.Is(err, ErrSnapshotUnsigned) {
+		t.Errorf("Expected ErrSnapshotUnsigned, got %v", err)
+	}
+}
@@ -1,102 +1,277 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/logging"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"golang.org/x/crypto/ssh"
 )
 
+// metaDir is the reserved folder holding store metadata, such as the
+// recovery public key, next to the entries so that it travels with the store
+const metaDir = ".passh/"
+
+// ErrNotFound is returned when an entry does not exist
+var ErrNotFound = errors.New("entry not found")
+
 // Store handles the storage and retrieval of password entries
 type Store struct {
 	rootDir   string
 	encryptor crypto.Encryptor
+	backend   Backend
+	// named maps entry names to file names in the backend
+	named *namedBackend
+
+	// extraRecipients are added to every entry, such as the recovery key
+	extraRecipients []ssh.PublicKey
+	// recipientFiles caches parsed recipients files by directory
+	recipientFiles map[string][]ssh.PublicKey
+	// recipientNames holds the comments of keys in recipients files
+	recipientNames map[string]string
+	// accessPolicy is the parsed PolicyFile, read once
+	accessPolicy *Policy
+	policyLoaded bool
+	// nameHMACKey is the key of a store with encrypted names, read once
+	nameHMACKey []byte
+	namesLoaded bool
+	// mu guards recipientFiles, recipientNames, the policy and the name key for bulk
+	// operations
+	mu sync.Mutex
+	// cache keeps decrypted entries between runs, if set
+	cache Cache
+	// signer signs entries as they are written, if set
+	signer ssh.Signer
+	// confirm approves releasing entries marked "confirm: true", if set
+	confirm func(name string) error
+
+	// actor is recorded in the operation log; pendingLog holds records until
+	// Close writes them. logMu guards logState and pendingLog.
+	actor      string
+	logMu      sync.Mutex
+	logState   int
+	pendingLog []LogRecord
+
+	// workers, progress and ctx configure bulk operations
+	workers  int
+	progress Progress
+	ctx      context.Context
+
+	// indexPath is where the index is kept; index is loaded on first use
+	// and saved on Close if indexDirty. indexMu guards all three.
+	indexPath   string
+	indexMu     sync.Mutex
+	index       *Index
+	indexLoaded bool
+	indexDirty  bool
 }
 
-// NewStore creates a new password store
+// Cache keeps decrypted entries for a short time, such as the passh agent.
+// Keys are digests of the encrypted data, so changed entries are never
+// served from the cache.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Put(key string, plaintext []byte) error
+}
+
+// NewStore creates a new password store. The root may be a local directory
+// or a remote location of the form ssh://[user@]host[:port]/path.
 func NewStore(rootDir string, encryptor crypto.Encryptor) (*Store, error) {
-	if rootDir == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		rootDir = filepath.Join(homeDir, ".passh")
+	backend, err := OpenBackend(rootDir)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.MkdirAll(rootDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create store directory: %w", err)
-	}
+	return NewStoreWithBackend(backend, encryptor), nil
+}
 
+// NewStoreWithBackend creates a password store on top of an existing backend
+func NewStoreWithBackend(backend Backend, encryptor crypto.Encryptor) *Store {
 	return &Store{
-		rootDir:   rootDir,
 		encryptor: encryptor,
-	}, nil
+		backend:   backend,
+	}
+}
+
+// entries returns the backend holding the entries by their names
+func (s *Store) entries() Backend {
+	if s.named == nil {
+		s.named = &namedBackend{Backend: s.raw(), s: s}
+	}
+	return s.named
+}
+
+// raw returns the backend holding the entries by their file names, which
+// differ from their names in stores with encrypted names. It defaults to a
+// local directory tree at rootDir.
+func (s *Store) raw() Backend {
+	if s.backend == nil {
+		s.backend = &fileBackend{rootDir: s.rootDir, fs: localFS{}}
+	}
+	return s.backend
+}
+
+// Backend returns the backend holding the encrypted entries, by their file
+// names
+func (s *Store) Backend() Backend {
+	return s.raw()
 }
 
-// Add adds a new password entry
+// SetCache makes the store look up decrypted entries in cache before
+// decrypting them, and add them to it afterwards
+func (s *Store) SetCache(cache Cache) {
+	s.cache = cache
+}
+
+// Close saves the index if entries changed and releases any connection held
+// by the store
+func (s *Store) Close() error {
+	s.indexMu.Lock()
+	if err := s.saveIndex(); err != nil {
+		logging.Warnf("%v", err)
+	}
+	s.indexMu.Unlock()
+
+	s.logMu.Lock()
+	if err := s.flushLog(); err != nil {
+		logging.Warnf("%v", err)
+	}
+	s.logMu.Unlock()
+
+	return s.entries().Close()
+}
+
+// Add adds a new password entry, or replaces an existing one while keeping
+// its creation time. Adding to an alias replaces the entry it refers to.
 func (s *Store) Add(name string, password []byte) error {
-	// Encrypt the password
-	encryptedData, err := s.encryptor.Encrypt(password)
-	if err != nil {
-		return fmt.Errorf("encryption failed: %w", err)
+	if strings.HasPrefix(name, metaDir) {
+		return fmt.Errorf("'%s' is reserved for store metadata", strings.TrimSuffix(metaDir, "/"))
+	}
+	if err := checkEntryName(name); err != nil {
+		return err
 	}
 
-	// Ensure the directory structure exists
-	dir := filepath.Dir(filepath.Join(s.rootDir, name))
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create directory structure: %w", err)
+	now := time.Now().UTC()
+	meta := Metadata{Created: now, Modified: now}
+	op := LogAdd
+	if _, err := s.entries().Stat(name); err == nil {
+		op = LogUpdate
+		previous, err := s.Metadata(name)
+		// Writing to an alias writes to the entry it refers to
+		if err == nil && previous.Alias != "" {
+			target, err := s.ResolveAlias(name)
+			if err != nil {
+				return err
+			}
+			return s.Add(target, password)
+		}
+		if err == nil && !previous.Created.IsZero() {
+			meta.Created = previous.Created
+		}
 	}
 
-	// Write the encrypted data to the file
-	filePath := filepath.Join(s.rootDir, name+".pass")
-	if err := os.WriteFile(filePath, []byte(encryptedData), 0600); err != nil {
-		return fmt.Errorf("failed to write password file: %w", err)
+	plaintext, err := s.seal(name, password, meta)
+	if err != nil {
+		return err
 	}
+	defer secure.Wipe(plaintext)
 
+	if err := s.writePlaintext(name, plaintext); err != nil {
+		return err
+	}
+	s.logOperation(op, name)
 	return nil
 }
 
 // Get retrieves a password entry
 func (s *Store) Get(name string) ([]byte, error) {
-	filePath := filepath.Join(s.rootDir, name+".pass")
+	password, _, err := s.GetWithMetadata(name)
+	return password, err
+}
 
-	encryptedData, err := os.ReadFile(filePath)
+// writePlaintext encrypts the full content of an entry, including its
+// metadata header, and stores it
+func (s *Store) writePlaintext(name string, plaintext []byte) error {
+	named, err := s.nameEntry(name, plaintext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read password file: %w", err)
+		return err
+	}
+	if named != nil {
+		defer secure.Wipe(named)
+		plaintext = named
 	}
 
-	// Decrypt the password
-	password, err := s.encryptor.Decrypt(string(encryptedData))
+	// Encrypt the password
+	encryptedData, err := s.encrypt(name, plaintext)
 	if err != nil {
-		return nil, fmt.Errorf("decryption failed: %w", err)
+		return fmt.Errorf("encryption failed: %w", err)
+	}
+
+	data := encodeEntryFile(encryptedData)
+	if err := s.entries().Put(name, data); err != nil {
+		return fmt.Errorf("failed to write password file: %w", err)
 	}
 
-	return password, nil
+	s.updateIndex(name, data, plaintext)
+	return nil
 }
 
-// List returns all password entries
-func (s *Store) List() ([]string, error) {
-	var entries []string
+// readPlaintext reads and decrypts the full content of an entry
+func (s *Store) readPlaintext(name string) ([]byte, error) {
+	encryptedData, err := s.entries().Get(name)
+	if err != nil {
+		return nil, entryError(name, "failed to read password file", err)
+	}
 
-	err := filepath.Walk(s.rootDir, func(path string, info os.FileInfo, err error) error {
+	return s.decryptEntry(name, encryptedData)
+}
+
+// decryptEntry decrypts the content of an entry, looking it up in the cache
+// first
+func (s *Store) decryptEntry(name string, encryptedData []byte) ([]byte, error) {
+	var cacheKey string
+	if s.cache != nil {
+		cacheKey = contentHash(encryptedData)
+		plaintext, found, err := s.cache.Get(cacheKey)
 		if err != nil {
-			return err
+			logging.Debugf("cache lookup for %s failed: %v", name, err)
+		} else if found {
+			logging.Debugf("read %s from the cache", name)
+			return plaintext, nil
 		}
+	}
 
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".pass") {
-			// Get relative path and remove the .pass extension
-			relPath, err := filepath.Rel(s.rootDir, path)
-			if err != nil {
-				return err
-			}
-			entry := strings.TrimSuffix(relPath, ".pass")
-			entries = append(entries, entry)
+	_, ciphertext, err := decodeEntryFile(encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("entry '%s': %w", name, err)
+	}
+
+	// Decrypt the password; errors from the encryptor say so themselves
+	plaintext, err := s.encryptor.Decrypt(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("entry '%s': %w", name, err)
+	}
+
+	// Entries needing confirmation are kept out of the cache, which anyone
+	// able to reach it could read without confirming
+	if secret, _, _ := openEntry(plaintext); s.cache != nil && !NeedsConfirmation(secret) {
+		if err := s.cache.Put(cacheKey, plaintext); err != nil {
+			logging.Debugf("caching %s failed: %v", name, err)
 		}
-		return nil
-	})
+	}
+	return plaintext, nil
+}
 
+// List returns all password entries
+func (s *Store) List() ([]string, error) {
+	entries, err := s.entries().List()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list password entries: %w", err)
 	}
@@ -104,13 +279,49 @@ func (s *Store) List() ([]string, error) {
 	return entries, nil
 }
 
+// Stat returns information about an entry without decrypting it
+func (s *Store) Stat(name string) (EntryInfo, error) {
+	info, err := s.entries().Stat(name)
+	if err != nil {
+		return EntryInfo{}, entryError(name, "failed to stat password file", err)
+	}
+
+	return info, nil
+}
+
 // Delete removes a password entry
 func (s *Store) Delete(name string) error {
-	filePath := filepath.Join(s.rootDir, name+".pass")
+	if err := s.entries().Delete(name); err != nil {
+		return entryError(name, "failed to delete password file", err)
+	}
+
+	s.removeFromIndex(name)
+	s.logOperation(LogDelete, name)
+	return nil
+}
+
+// entryError reports a backend error for an entry, as ErrNotFound if the
+// entry does not exist
+func entryError(name, message string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
 
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete password file: %w", err)
+// ReadMeta reads a store metadata file. Metadata is not encrypted.
+func (s *Store) ReadMeta(name string) ([]byte, error) {
+	data, err := s.entries().ReadFile(metaDir + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store metadata '%s': %w", name, err)
 	}
+	return data, nil
+}
 
+// WriteMeta writes a store metadata file. Metadata is not encrypted.
+func (s *Store) WriteMeta(name string, data []byte) error {
+	if err := s.entries().WriteFile(metaDir+name, data); err != nil {
+		return fmt.Errorf("failed to write store metadata '%s': %w", name, err)
+	}
 	return nil
 }
@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/rejoice4156/passh/pkg/crypto"
 )
 
 // Mock encryptor implementation that satisfies the interface needed by Store
@@ -18,6 +22,14 @@ func (m *MockEncryptor) Decrypt(encryptedData string) ([]byte, error) {
 	return []byte(encryptedData[:len(encryptedData)-10]), nil
 }
 
+func (m *MockEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return crypto.EncryptStreamWith(m.Encrypt, r, w)
+}
+
+func (m *MockEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return crypto.DecryptStreamWith(m.Decrypt, r, w)
+}
+
 func TestStore(t *testing.T) {
 	// Create a temporary directory for the store
 	tempDir, err := os.MkdirTemp("", "passh-test-store")
@@ -166,3 +178,68 @@ func TestStoreWithDefaultLocation(t *testing.T) {
 		t.Fatalf("Expected %s to be a directory", expectedStoreDir)
 	}
 }
+
+func TestStoreNotFound(t *testing.T) {
+	store := &Store{rootDir: t.TempDir(), encryptor: &MockEncryptor{}}
+
+	if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get: expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Stat("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat: expected ErrNotFound, got %v", err)
+	}
+	if err := store.Delete("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete: expected ErrNotFound, got %v", err)
+	}
+}
+
+// countingEncryptor counts decryptions
+type countingEncryptor struct {
+	MockEncryptor
+	decrypts int
+}
+
+func (c *countingEncryptor) Decrypt(encryptedData string) ([]byte, error) {
+	c.decrypts++
+	return c.MockEncryptor.Decrypt(encryptedData)
+}
+
+// mapCache is an in-memory Cache
+type mapCache map[string][]byte
+
+func (m mapCache) Get(key string) ([]byte, bool, error) {
+	data, ok := m[key]
+	return append([]byte(nil), data...), ok, nil
+}
+
+func (m mapCache) Put(key string, plaintext []byte) error {
+	m[key] = append([]byte(nil), plaintext...)
+	return nil
+}
+
+func TestStoreCache(t *testing.T) {
+	encryptor := &countingEncryptor{}
+	store := NewStoreWithBackend(NewMemoryBackend(), encryptor)
+	store.SetCache(mapCache{})
+
+	if err := store.Add("entry", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		password, err := store.Get("entry")
+		if err != nil || string(password) != "first" {
+			t.Fatalf("Expected 'first', got %q (%v)", password, err)
+		}
+	}
+	if encryptor.decrypts != 1 {
+		t.Errorf("Expected one decryption, got %d", encryptor.decrypts)
+	}
+
+	// A changed entry is decrypted again
+	if err := store.Add("entry", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := store.Get("entry"); err != nil || string(password) != "second" {
+		t.Fatalf("Expected 'second', got %q (%v)", password, err)
+	}
+}
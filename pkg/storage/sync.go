@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ConflictSuffix is appended to the name of the remote copy when both
+// versions of a conflicting entry are kept
+const ConflictSuffix = ".conflict"
+
+// SyncState records the content hash of every entry as of the last
+// successful sync. It is the common base used to tell which side changed.
+type SyncState struct {
+	Entries map[string]string `json:"entries"`
+}
+
+// Resolution decides the outcome of a conflicting entry
+type Resolution int
+
+const (
+	// KeepLocal overwrites the remote entry with the local one
+	KeepLocal Resolution = iota
+	// KeepRemote overwrites the local entry with the remote one
+	KeepRemote
+	// KeepBoth keeps the local entry and stores the remote one as NAME.conflict
+	KeepBoth
+	// KeepMerged writes the content given to Conflict.Merge to both sides
+	KeepMerged
+	// Skip leaves both sides as they are, so the entry is a conflict again
+	// on the next sync
+	Skip
+)
+
+// Conflict describes an entry that changed on both sides since the last sync.
+// An entry deleted on one side and modified on the other is also a conflict.
+type Conflict struct {
+	Name         string
+	LocalExists  bool
+	RemoteExists bool
+	// Local and Remote are the encrypted versions, nil if deleted
+	Local  []byte
+	Remote []byte
+
+	merged *[]byte
+}
+
+// Merge sets the encrypted content written to both sides when the resolver
+// returns KeepMerged
+func (c Conflict) Merge(data []byte) {
+	*c.merged = data
+}
+
+// ConflictResolver chooses how to resolve a conflict
+type ConflictResolver func(Conflict) (Resolution, error)
+
+// SyncResult summarizes the changes made by a sync
+type SyncResult struct {
+	Pulled        []string
+	Pushed        []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	Conflicts     []string
+	State         SyncState
+}
+
+// syncEntry is the content of an entry on one side, if it exists
+type syncEntry struct {
+	data   []byte
+	hash   string
+	exists bool
+}
+
+// Sync reconciles the entries of a local and a remote backend. Changes made
+// on only one side since the base state are propagated to the other side;
+// entries changed on both sides are handed to resolve.
+func Sync(local, remote Backend, base SyncState, resolve ConflictResolver) (*SyncResult, error) {
+	return SyncContext(context.Background(), local, remote, base, resolve, nil)
+}
+
+// SyncContext is Sync, telling progress about each entry compared. Once ctx
+// is done no more entries are synced, and the changes made so far are
+// returned along with the error; their State keeps the base hashes of the
+// entries not reached, so it can be saved and the next sync picks up where
+// this one stopped.
+func SyncContext(ctx context.Context, local, remote Backend, base SyncState, resolve ConflictResolver, progress Progress) (*SyncResult, error) {
+	localNames, err := local.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local entries: %w", err)
+	}
+	remoteNames, err := remote.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote entries: %w", err)
+	}
+
+	inLocal := make(map[string]bool, len(localNames))
+	inRemote := make(map[string]bool, len(remoteNames))
+	names := make(map[string]bool)
+	for _, name := range localNames {
+		inLocal[name] = true
+		names[name] = true
+	}
+	for _, name := range remoteNames {
+		inRemote[name] = true
+		names[name] = true
+	}
+	for name := range base.Entries {
+		names[name] = true
+	}
+	if err := syncNameKey(local, remote, len(localNames) > 0, len(remoteNames) > 0); err != nil {
+		return nil, err
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	result := &SyncResult{State: SyncState{Entries: make(map[string]string)}}
+	for i, name := range sorted {
+		if progress != nil && i > 0 {
+			progress(i, len(sorted))
+		}
+		if err := ctx.Err(); err != nil {
+			for _, rest := range sorted[i:] {
+				if hash, ok := base.Entries[rest]; ok && result.State.Entries[rest] == "" {
+					result.State.Entries[rest] = hash
+				}
+			}
+			return result, interrupted(i, len(sorted), err)
+		}
+
+		l, err := readSyncEntry(local, name, inLocal[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read local entry '%s': %w", name, err)
+		}
+		r, err := readSyncEntry(remote, name, inRemote[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote entry '%s': %w", name, err)
+		}
+		baseHash := base.Entries[name]
+
+		switch {
+		case l.hash == r.hash:
+			// Already in sync
+			result.record(name, l)
+		case l.hash == baseHash:
+			// Only the remote side changed
+			if err := result.apply(name, r, local, true); err != nil {
+				return nil, err
+			}
+			result.record(name, r)
+		case r.hash == baseHash:
+			// Only the local side changed
+			if err := result.apply(name, l, remote, false); err != nil {
+				return nil, err
+			}
+			result.record(name, l)
+		default:
+			var merged []byte
+			resolution, err := resolve(Conflict{
+				Name:         name,
+				LocalExists:  l.exists,
+				RemoteExists: r.exists,
+				Local:        l.data,
+				Remote:       r.data,
+				merged:       &merged,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Conflicts = append(result.Conflicts, name)
+			if resolution == Skip {
+				continue
+			}
+			if resolution == KeepMerged {
+				if merged == nil {
+					return nil, fmt.Errorf("no merged content for '%s'", name)
+				}
+				if err := result.merge(name, merged, local, remote); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := result.resolve(name, l, r, local, remote, resolution); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if progress != nil && len(sorted) > 0 {
+		progress(len(sorted), len(sorted))
+	}
+
+	return result, nil
+}
+
+// readSyncEntry loads an entry and hashes its content
+func readSyncEntry(backend Backend, name string, exists bool) (syncEntry, error) {
+	if !exists {
+		return syncEntry{}, nil
+	}
+
+	data, err := backend.Get(name)
+	if err != nil {
+		return syncEntry{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return syncEntry{data: data, hash: hex.EncodeToString(sum[:]), exists: true}, nil
+}
+
+// record stores the synced hash of an entry in the new state
+func (r *SyncResult) record(name string, entry syncEntry) {
+	if entry.exists {
+		r.State.Entries[name] = entry.hash
+	}
+}
+
+// apply copies an entry to the target backend, or deletes it there when the
+// source no longer has it
+func (r *SyncResult) apply(name string, source syncEntry, target Backend, pull bool) error {
+	if source.exists {
+		if err := target.Put(name, source.data); err != nil {
+			return fmt.Errorf("failed to write entry '%s': %w", name, err)
+		}
+		if pull {
+			r.Pulled = append(r.Pulled, name)
+		} else {
+			r.Pushed = append(r.Pushed, name)
+		}
+		return nil
+	}
+
+	if err := target.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete entry '%s': %w", name, err)
+	}
+	if pull {
+		r.DeletedLocal = append(r.DeletedLocal, name)
+	} else {
+		r.DeletedRemote = append(r.DeletedRemote, name)
+	}
+	return nil
+}
+
+// merge writes the merged content of a conflicting entry to both sides
+func (r *SyncResult) merge(name string, data []byte, local, remote Backend) error {
+	sum := sha256.Sum256(data)
+	entry := syncEntry{data: data, hash: hex.EncodeToString(sum[:]), exists: true}
+	if err := r.apply(name, entry, local, true); err != nil {
+		return err
+	}
+	if err := r.apply(name, entry, remote, false); err != nil {
+		return err
+	}
+	r.record(name, entry)
+	return nil
+}
+
+// resolve applies the chosen resolution to a conflicting entry
+func (r *SyncResult) resolve(name string, l, rem syncEntry, local, remote Backend, resolution Resolution) error {
+	switch resolution {
+	case KeepLocal:
+		if err := r.apply(name, l, remote, false); err != nil {
+			return err
+		}
+		r.record(name, l)
+	case KeepRemote:
+		if err := r.apply(name, rem, local, true); err != nil {
+			return err
+		}
+		r.record(name, rem)
+	case KeepBoth:
+		switch {
+		case l.exists && rem.exists:
+			// The remote version moves aside on both sides
+			conflictName := name + ConflictSuffix
+			if err := r.apply(conflictName, rem, local, true); err != nil {
+				return err
+			}
+			if err := r.apply(conflictName, rem, remote, false); err != nil {
+				return err
+			}
+			r.record(conflictName, rem)
+			fallthrough
+		case l.exists:
+			if err := r.apply(name, l, remote, false); err != nil {
+				return err
+			}
+			r.record(name, l)
+		default:
+			// Deleted locally but modified remotely: restore the remote version
+			if err := r.apply(name, rem, local, true); err != nil {
+				return err
+			}
+			r.record(name, rem)
+		}
+	default:
+		return fmt.Errorf("unknown conflict resolution %d", resolution)
+	}
+	return nil
+}
+
+// syncNameKey copies the name key of a store with encrypted names to the
+// other side, which must not hold entries under their names
+func syncNameKey(local, remote Backend, localEntries, remoteEntries bool) error {
+	localKey, err := local.ReadFile(nameKeyFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read local name key: %w", err)
+	}
+	remoteKey, err := remote.ReadFile(nameKeyFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read remote name key: %w", err)
+	}
+
+	switch {
+	case (localKey == nil) == (remoteKey == nil):
+		return nil
+	case localKey == nil && localEntries, remoteKey == nil && remoteEntries:
+		return errors.New("only one of the stores encrypts entry names; run 'passh encrypt-names' on the other first")
+	case localKey == nil:
+		err = local.WriteFile(nameKeyFile, remoteKey)
+	default:
+		err = remote.WriteFile(nameKeyFile, localKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy the name key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustPut(t *testing.T, backend Backend, name, data string) {
+	t.Helper()
+	if err := backend.Put(name, []byte(data)); err != nil {
+		t.Fatalf("Failed to put %s: %v", name, err)
+	}
+}
+
+func mustGet(t *testing.T, backend Backend, name string) string {
+	t.Helper()
+	data, err := backend.Get(name)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func noConflicts(t *testing.T) ConflictResolver {
+	return func(c Conflict) (Resolution, error) {
+		t.Fatalf("Unexpected conflict on %s", c.Name)
+		return KeepLocal, nil
+	}
+}
+
+func TestSyncPropagatesOneSidedChanges(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	mustPut(t, local, "local-only", "a")
+	mustPut(t, remote, "remote-only", "b")
+	mustPut(t, local, "shared", "c")
+	mustPut(t, remote, "shared", "c")
+
+	result, err := Sync(local, remote, SyncState{}, noConflicts(t))
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Pushed, []string{"local-only"}) {
+		t.Errorf("Expected local-only to be pushed, got %v", result.Pushed)
+	}
+	if !reflect.DeepEqual(result.Pulled, []string{"remote-only"}) {
+		t.Errorf("Expected remote-only to be pulled, got %v", result.Pulled)
+	}
+	if len(result.State.Entries) != 3 {
+		t.Fatalf("Expected 3 entries in state, got %d", len(result.State.Entries))
+	}
+
+	// Modify locally and delete remotely, then sync again from the recorded base
+	mustPut(t, local, "shared", "c2")
+	if err := remote.Delete("remote-only"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	result, err = Sync(local, remote, result.State, noConflicts(t))
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := mustGet(t, remote, "shared"); got != "c2" {
+		t.Errorf("Expected remote shared to be updated, got %s", got)
+	}
+	if !reflect.DeepEqual(result.DeletedLocal, []string{"remote-only"}) {
+		t.Errorf("Expected remote-only to be deleted locally, got %v", result.DeletedLocal)
+	}
+	if _, ok := result.State.Entries["remote-only"]; ok {
+		t.Error("Expected deleted entry to be dropped from state")
+	}
+}
+
+func TestSyncConflictResolutions(t *testing.T) {
+	tests := []struct {
+		resolution Resolution
+		local      string
+		remote     string
+		conflict   string
+	}{
+		{KeepLocal, "local", "local", ""},
+		{KeepRemote, "remote", "remote", ""},
+		{KeepBoth, "local", "local", "remote"},
+	}
+
+	for _, test := range tests {
+		local := NewMemoryBackend()
+		remote := NewMemoryBackend()
+		mustPut(t, local, "entry", "base")
+		mustPut(t, remote, "entry", "base")
+
+		result, err := Sync(local, remote, SyncState{}, noConflicts(t))
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+
+		mustPut(t, local, "entry", "local")
+		mustPut(t, remote, "entry", "remote")
+
+		var seen Conflict
+		result, err = Sync(local, remote, result.State, func(c Conflict) (Resolution, error) {
+			seen = c
+			return test.resolution, nil
+		})
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if seen.Name != "entry" || !seen.LocalExists || !seen.RemoteExists {
+			t.Errorf("Unexpected conflict: %+v", seen)
+		}
+		if got := mustGet(t, local, "entry"); got != test.local {
+			t.Errorf("Resolution %d: expected local '%s', got '%s'", test.resolution, test.local, got)
+		}
+		if got := mustGet(t, remote, "entry"); got != test.remote {
+			t.Errorf("Resolution %d: expected remote '%s', got '%s'", test.resolution, test.remote, got)
+		}
+		if test.conflict != "" {
+			if got := mustGet(t, local, "entry.conflict"); got != test.conflict {
+				t.Errorf("Expected local conflict copy '%s', got '%s'", test.conflict, got)
+			}
+			if got := mustGet(t, remote, "entry.conflict"); got != test.conflict {
+				t.Errorf("Expected remote conflict copy '%s', got '%s'", test.conflict, got)
+			}
+		}
+	}
+}
+
+func TestSyncMergedConflict(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	mustPut(t, local, "entry", "local")
+	mustPut(t, remote, "entry", "remote")
+
+	result, err := Sync(local, remote, SyncState{}, func(c Conflict) (Resolution, error) {
+		if string(c.Local) != "local" || string(c.Remote) != "remote" {
+			t.Errorf("Unexpected conflict versions: %+v", c)
+		}
+		c.Merge([]byte("merged"))
+		return KeepMerged, nil
+	})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for _, backend := range []Backend{local, remote} {
+		if got := mustGet(t, backend, "entry"); got != "merged" {
+			t.Errorf("Expected merged entry, got '%s'", got)
+		}
+	}
+
+	// Both sides now agree with the recorded state
+	if _, err := Sync(local, remote, result.State, noConflicts(t)); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+}
+
+func TestSyncDeleteModifyConflict(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	mustPut(t, remote, "entry", "modified")
+	base := SyncState{Entries: map[string]string{"entry": "stale-hash"}}
+
+	_, err := Sync(local, remote, base, func(c Conflict) (Resolution, error) {
+		if c.LocalExists || !c.RemoteExists {
+			t.Errorf("Unexpected conflict: %+v", c)
+		}
+		return KeepBoth, nil
+	})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// Keeping both restores the modified version rather than losing it
+	if got := mustGet(t, local, "entry"); got != "modified" {
+		t.Errorf("Expected entry to be restored locally, got '%s'", got)
+	}
+}
+
+func TestSyncResolverError(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	mustPut(t, local, "entry", "a")
+	mustPut(t, remote, "entry", "b")
+
+	abort := errors.New("aborted")
+	if _, err := Sync(local, remote, SyncState{}, func(Conflict) (Resolution, error) {
+		return KeepLocal, abort
+	}); !errors.Is(err, abort) {
+		t.Fatalf("Expected resolver error to be returned, got %v", err)
+	}
+}
+
+func TestSyncContextInterrupted(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	for _, name := range []string{"a", "b", "c"} {
+		mustPut(t, local, name, "v1")
+		mustPut(t, remote, name, "v1")
+	}
+	result, err := Sync(local, remote, SyncState{}, noConflicts(t))
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	base := result.State
+	for _, name := range []string{"a", "b", "c"} {
+		mustPut(t, local, name, "v2")
+	}
+
+	// Stop once the first entry is synced
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result, err = SyncContext(ctx, local, remote, base, noConflicts(t), func(done, total int) {
+		if done == 1 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the sync to be cancelled, got %v", err)
+	}
+	if result == nil || !reflect.DeepEqual(result.Pushed, []string{"a"}) {
+		t.Fatalf("Expected only a to be pushed, got %+v", result)
+	}
+	if got := mustGet(t, remote, "b"); got != "v1" {
+		t.Errorf("Expected b to be left alone, got %s", got)
+	}
+
+	// The saved state lets the next sync push the rest without conflicts
+	result, err = Sync(local, remote, result.State, noConflicts(t))
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Pushed, []string{"b", "c"}) {
+		t.Errorf("Expected b and c to be pushed, got %v", result.Pushed)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	local := NewMemoryBackend()
+	remote := NewMemoryBackend()
+	mustPut(t, local, "local-only", "a")
+	mustPut(t, remote, "remote-only", "b")
+	mustPut(t, local, "both", "local")
+	mustPut(t, remote, "both", "remote")
+
+	result, err := Sync(NewDryRunBackend(local), NewDryRunBackend(remote), SyncState{}, func(Conflict) (Resolution, error) {
+		return Skip, nil
+	})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Pushed, []string{"local-only"}) || !reflect.DeepEqual(result.Pulled, []string{"remote-only"}) {
+		t.Errorf("Expected the one-sided entries to be listed, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.Conflicts, []string{"both"}) {
+		t.Errorf("Expected both to be a conflict, got %v", result.Conflicts)
+	}
+	if _, ok := result.State.Entries["both"]; ok {
+		t.Error("Expected the skipped conflict to stay out of the state")
+	}
+
+	// Neither side was written
+	if _, err := remote.Get("local-only"); err == nil {
+		t.Error("Expected local-only not to be pushed")
+	}
+	if _, err := local.Get("remote-only"); err == nil {
+		t.Error("Expected remote-only not to be pulled")
+	}
+	if got := mustGet(t, remote, "both"); got != "remote" {
+		t.Errorf("Expected the remote conflict to be left alone, got %s", got)
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// templateDir holds the entry templates, encrypted like entries, so that
+// everyone sharing the store uses the same ones
+const templateDir = metaDir + "templates/"
+
+// templateExtension is the file extension used for templates
+const templateExtension = ".tmpl"
+
+// AddTemplate stores an entry template, replacing any previous one of that
+// name
+func (s *Store) AddTemplate(name string, content []byte) error {
+	if err := checkTemplateName(name); err != nil {
+		return err
+	}
+
+	encrypted, err := s.encrypt(templateDir+name, content)
+	if err != nil {
+		return fmt.Errorf("encryption failed: %w", err)
+	}
+	if err := s.entries().WriteFile(templateDir+name+templateExtension, []byte(encrypted)); err != nil {
+		return fmt.Errorf("failed to write template '%s': %w", name, err)
+	}
+	return nil
+}
+
+// Template decrypts an entry template
+func (s *Store) Template(name string) ([]byte, error) {
+	if err := checkTemplateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := s.entries().ReadFile(templateDir + name + templateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template '%s': %w", name, err)
+	}
+	defer secure.Wipe(data)
+
+	content, err := s.encryptor.Decrypt(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("template '%s': %w", name, err)
+	}
+	return content, nil
+}
+
+// ListTemplates returns the names of all entry templates
+func (s *Store) ListTemplates() ([]string, error) {
+	files, err := s.entries().ListFiles(templateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if name, ok := strings.CutPrefix(file, templateDir); ok {
+			names = append(names, strings.TrimSuffix(name, templateExtension))
+		}
+	}
+	return names, nil
+}
+
+// DeleteTemplate removes an entry template
+func (s *Store) DeleteTemplate(name string) error {
+	if err := checkTemplateName(name); err != nil {
+		return err
+	}
+	if err := s.entries().RemoveFile(templateDir + name + templateExtension); err != nil {
+		return fmt.Errorf("failed to delete template '%s': %w", name, err)
+	}
+	return nil
+}
+
+// checkTemplateName rejects template names that are not a single path element
+func checkTemplateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid template name '%s'", name)
+	}
+	return nil
+}
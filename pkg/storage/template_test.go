@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	store := NewStoreWithBackend(NewMemoryBackend(), &MockEncryptor{})
+
+	if err := store.AddTemplate("web-login", []byte("{generate 24}\nusername: {prompt}\n")); err != nil {
+		t.Fatalf("AddTemplate failed: %v", err)
+	}
+	if err := store.Add("entry", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := store.Template("web-login")
+	if err != nil || string(content) != "{generate 24}\nusername: {prompt}\n" {
+		t.Fatalf("Unexpected template %q (%v)", content, err)
+	}
+
+	// Templates are not entries
+	names, err := store.ListTemplates()
+	if err != nil || !reflect.DeepEqual(names, []string{"web-login"}) {
+		t.Errorf("Unexpected templates %v (%v)", names, err)
+	}
+	if entries, _ := store.List(); !reflect.DeepEqual(entries, []string{"entry"}) {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+
+	if err := store.DeleteTemplate("web-login"); err != nil {
+		t.Fatalf("DeleteTemplate failed: %v", err)
+	}
+	if _, err := store.Template("web-login"); err == nil {
+		t.Error("Expected a deleted template to be gone")
+	}
+	if err := store.AddTemplate("../escape", []byte("{prompt}")); err == nil {
+		t.Error("Expected a template name with a path to be rejected")
+	}
+}
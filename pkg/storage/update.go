@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rejoice4156/passh/pkg/secure"
+)
+
+// locksDir holds the lock files of entries being updated in local stores
+const locksDir = metaDir + "locks/"
+
+const (
+	// lockTimeout is how long Update waits for another process updating
+	// the same entry
+	lockTimeout = 10 * time.Second
+	// lockStale is the age after which a lock is taken to be left behind by
+	// a process that died, and broken
+	lockStale = time.Minute
+)
+
+// ErrLocked is returned when an entry stays locked by another update
+var ErrLocked = errors.New("entry is being updated by another process")
+
+// Update replaces the content of an entry with what fn makes of it. In local
+// stores the entry is locked until it is written, so that concurrent updates
+// from other processes, such as two HOTP codes taken at once, are applied
+// one after the other instead of overwriting each other.
+func (s *Store) Update(name string, fn func(content []byte) ([]byte, error)) error {
+	if dir, ok := LocalDir(s.raw()); ok {
+		unlock, err := lockEntry(dir, name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	content, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(content)
+
+	updated, err := fn(content)
+	if err != nil {
+		return err
+	}
+	defer secure.Wipe(updated)
+	return s.Add(name, updated)
+}
+
+// lockEntry creates the lock file of an entry, waiting for a lock held by
+// someone else to be released, and returns the function that releases it
+func lockEntry(dir, name string) (func(), error) {
+	sum := sha256.Sum256([]byte(name))
+	path := filepath.Join(dir, filepath.FromSlash(locksDir), hex.EncodeToString(sum[:8])+".lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock '%s': %w", name, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLocked, name)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateSerializesConcurrentUpdates(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend failed: %v", err)
+	}
+	store := NewStoreWithBackend(backend, &MockEncryptor{})
+	if err := store.Add("counter", []byte("0")); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Update("counter", func(content []byte) ([]byte, error) {
+				n, err := strconv.Atoi(string(content))
+				return []byte(strconv.Itoa(n + 1)), err
+			})
+			if err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	content, err := store.Get("counter")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(content) != "10" {
+		t.Errorf("Expected every update to apply, got %s", content)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, filepath.FromSlash(locksDir))); len(entries) != 0 {
+		t.Errorf("Expected the locks to be released, found %d", len(entries))
+	}
+}
+
+func TestLockEntryBreaksStaleLocks(t *testing.T) {
+	dir := t.TempDir()
+	unlock, err := lockEntry(dir, "counter")
+	if err != nil {
+		t.Fatalf("lockEntry failed: %v", err)
+	}
+	locks, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(locksDir), "*.lock"))
+	if len(locks) != 1 {
+		t.Fatalf("Expected one lock file, found %v", locks)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(locks[0], old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	again, err := lockEntry(dir, "counter")
+	if err != nil {
+		t.Fatalf("Expected a stale lock to be broken: %v", err)
+	}
+	again()
+	unlock()
+}
@@ -0,0 +1,435 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebDAVAuth holds the credentials for a WebDAV server. A token is sent as a
+// bearer token; otherwise a username enables basic authentication.
+type WebDAVAuth struct {
+	Username string
+	Password string
+	Token    string
+	// Insecure allows sending the credentials over plain HTTP
+	Insecure bool
+}
+
+// ErrInsecureWebDAV is returned for credentials that would be sent over
+// plain HTTP, to a webdav:// URL
+var ErrInsecureWebDAV = errors.New("WebDAV credentials would be sent unencrypted over plain HTTP")
+
+// webdavBackend stores entries as .pass files on a WebDAV server such as
+// Nextcloud or ownCloud
+type webdavBackend struct {
+	baseURL *url.URL
+	auth    WebDAVAuth
+	client  *http.Client
+	// collections remembers directories known to exist, to avoid repeated MKCOLs
+	collections map[string]bool
+}
+
+// isWebDAVStore reports whether the location refers to a WebDAV store
+func isWebDAVStore(location string) bool {
+	return strings.HasPrefix(location, "webdav://") || strings.HasPrefix(location, "webdavs://")
+}
+
+// NewWebDAVBackend creates a backend for a store given as
+// webdav://host/path (plain HTTP) or webdavs://host/path (HTTPS). A username
+// in the URL is used for basic authentication unless auth provides one.
+func NewWebDAVBackend(location string, auth WebDAVAuth) (Backend, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV store URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("WebDAV store URL %q has no host", location)
+	}
+
+	if u.User != nil {
+		if auth.Username == "" {
+			auth.Username = u.User.Username()
+		}
+		if password, ok := u.User.Password(); ok && auth.Password == "" {
+			auth.Password = password
+		}
+		u.User = nil
+	}
+
+	if u.Scheme == "webdavs" {
+		u.Scheme = "https"
+	} else {
+		u.Scheme = "http"
+		if (auth.Token != "" || auth.Username != "") && !auth.Insecure {
+			return nil, fmt.Errorf("%w; use webdavs://, or set webdav.insecure to true if the connection is otherwise protected", ErrInsecureWebDAV)
+		}
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+
+	backend := &webdavBackend{
+		baseURL:     u,
+		auth:        auth,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		collections: make(map[string]bool),
+	}
+
+	if err := backend.mkcolAll(""); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return backend, nil
+}
+
+// do sends a request for an unescaped path relative to the store root
+func (b *webdavBackend) do(method, rel string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	return b.doPath(method, b.baseURL.Path+rel, body, headers)
+}
+
+// doPath sends a request for an absolute unescaped path with authentication applied
+func (b *webdavBackend) doPath(method, absPath string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	u := *b.baseURL
+	u.Path = absPath
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	switch {
+	case b.auth.Token != "":
+		req.Header.Set("Authorization", "Bearer "+b.auth.Token)
+	case b.auth.Username != "":
+		req.SetBasicAuth(b.auth.Username, b.auth.Password)
+	}
+
+	return b.client.Do(req)
+}
+
+// statusError converts an unexpected HTTP response into an error
+func statusError(method, rel string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, rel, os.ErrNotExist)
+	}
+	return fmt.Errorf("%s %s: unexpected status %s", method, rel, resp.Status)
+}
+
+// mkcolAll creates a collection relative to the store root and all of its
+// parents, like os.MkdirAll
+func (b *webdavBackend) mkcolAll(dir string) error {
+	if b.collections[dir] {
+		return nil
+	}
+
+	absPath := b.baseURL.Path
+	if dir != "" {
+		absPath += strings.Trim(dir, "/") + "/"
+	}
+	if err := b.mkcolPath(absPath); err != nil {
+		return err
+	}
+
+	b.collections[dir] = true
+	return nil
+}
+
+// mkcolPath creates the collection at an absolute path, creating missing
+// parents when the server reports a conflict
+func (b *webdavBackend) mkcolPath(absPath string) error {
+	resp, err := b.doPath("MKCOL", absPath, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed:
+		// 405 Method Not Allowed means the collection already exists
+		return nil
+	case http.StatusConflict:
+		parent := path.Dir(strings.TrimSuffix(absPath, "/"))
+		if parent == "/" || parent == "." {
+			break
+		}
+		if err := b.mkcolPath(parent + "/"); err != nil {
+			return err
+		}
+		return b.mkcolPath(absPath)
+	}
+
+	return statusError("MKCOL", absPath, resp)
+}
+
+// entryPath returns the path of an entry relative to the store root
+func entryPath(name string) string {
+	return name + entryExtension
+}
+
+func (b *webdavBackend) Put(name string, data []byte) error {
+	return b.WriteFile(entryPath(name), data)
+}
+
+func (b *webdavBackend) Get(name string) ([]byte, error) {
+	return b.ReadFile(entryPath(name))
+}
+
+func (b *webdavBackend) WriteFile(rel string, data []byte) error {
+	if dir := path.Dir(rel); dir != "." {
+		if err := b.mkcolAll(dir); err != nil {
+			return fmt.Errorf("failed to create directory structure: %w", err)
+		}
+	}
+
+	resp, err := b.do(http.MethodPut, rel, bytes.NewReader(data), map[string]string{"Content-Type": "application/octet-stream"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError(http.MethodPut, rel, resp)
+	}
+	return nil
+}
+
+func (b *webdavBackend) ReadFile(rel string) ([]byte, error) {
+	body, err := b.OpenFile(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+func (b *webdavBackend) OpenFile(rel string) (io.ReadCloser, error) {
+	resp, err := b.do(http.MethodGet, rel, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(http.MethodGet, rel, resp)
+	}
+	return resp.Body, nil
+}
+
+func (b *webdavBackend) CreateFile(rel string) (io.WriteCloser, error) {
+	if dir := path.Dir(rel); dir != "." {
+		if err := b.mkcolAll(dir); err != nil {
+			return nil, fmt.Errorf("failed to create directory structure: %w", err)
+		}
+	}
+
+	// Stream the content as the body of a PUT request running in the background
+	reader, writer := io.Pipe()
+	upload := &webdavUpload{PipeWriter: writer, done: make(chan error, 1)}
+	go func() {
+		resp, err := b.do(http.MethodPut, rel, reader, map[string]string{"Content-Type": "application/octet-stream"})
+		if err != nil {
+			reader.CloseWithError(err)
+			upload.done <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			err = statusError(http.MethodPut, rel, resp)
+		}
+		reader.CloseWithError(err)
+		upload.done <- err
+	}()
+	return upload, nil
+}
+
+// webdavUpload is the writer returned by CreateFile. Close finishes the
+// request body and waits for the server's response.
+type webdavUpload struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (u *webdavUpload) Close() error {
+	if err := u.PipeWriter.Close(); err != nil {
+		return err
+	}
+	return <-u.done
+}
+
+func (b *webdavBackend) RemoveFile(rel string) error {
+	resp, err := b.do(http.MethodDelete, rel, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError(http.MethodDelete, rel, resp)
+	}
+	return nil
+}
+
+func (b *webdavBackend) Delete(name string) error {
+	return b.RemoveFile(entryPath(name))
+}
+
+func (b *webdavBackend) Stat(name string) (EntryInfo, error) {
+	resources, err := b.propfind(entryPath(name), "0")
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	if len(resources) == 0 {
+		return EntryInfo{}, fmt.Errorf("PROPFIND %s: %w", name, os.ErrNotExist)
+	}
+
+	return EntryInfo{Name: name, Size: resources[0].size, ModTime: resources[0].modTime}, nil
+}
+
+func (b *webdavBackend) List() ([]string, error) {
+	files, err := b.ListFiles(entryExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, len(files))
+	for i, file := range files {
+		entries[i] = strings.TrimSuffix(file, entryExtension)
+	}
+	return entries, nil
+}
+
+func (b *webdavBackend) ListFiles(extension string) ([]string, error) {
+	var files []string
+
+	// Depth: infinity is often disabled on servers, so walk one level at a time
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		resources, err := b.propfind(dir, "1")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources {
+			if resource.rel == dir {
+				continue
+			}
+			if resource.collection {
+				pending = append(pending, resource.rel)
+				continue
+			}
+			if strings.HasSuffix(resource.rel, extension) {
+				files = append(files, resource.rel)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func (b *webdavBackend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// davResource is a single resource reported by PROPFIND
+type davResource struct {
+	rel        string
+	collection bool
+	size       int64
+	modTime    time.Time
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength int64  `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+// propfind lists the resource at rel (depth 0) or it and its children
+// (depth 1). Paths are unescaped and relative to the store root, with a
+// trailing slash for collections.
+func (b *webdavBackend) propfind(rel, depth string) ([]davResource, error) {
+	resp, err := b.do("PROPFIND", rel, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        depth,
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", rel, resp)
+	}
+
+	var status davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+
+	var resources []davResource
+	for _, response := range status.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			continue
+		}
+		var relPath string
+		switch {
+		case strings.HasPrefix(href.Path, b.baseURL.Path):
+			relPath = strings.TrimPrefix(href.Path, b.baseURL.Path)
+		case href.Path+"/" == b.baseURL.Path:
+			relPath = ""
+		default:
+			// Outside the store root
+			continue
+		}
+
+		resource := davResource{rel: relPath}
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			resource.collection = propstat.Prop.ResourceType.Collection != nil
+			resource.size = propstat.Prop.ContentLength
+			if modTime, err := http.ParseTime(propstat.Prop.LastModified); err == nil {
+				resource.modTime = modTime
+			}
+		}
+		if resource.collection && resource.rel != "" && !strings.HasSuffix(resource.rel, "/") {
+			resource.rel += "/"
+		}
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer starts an in-memory WebDAV server that requires basic auth
+func newWebDAVServer(t *testing.T) *httptest.Server {
+	handler := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "alice" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebDAVBackend(t *testing.T) {
+	server := newWebDAVServer(t)
+	location := strings.Replace(server.URL, "http://", "webdav://", 1) + "/remote.php/passh"
+
+	backend, err := NewWebDAVBackend(location, WebDAVAuth{Username: "alice", Password: "secret", Insecure: true})
+	if err != nil {
+		t.Fatalf("Failed to create WebDAV backend: %v", err)
+	}
+	testBackend(t, backend)
+}
+
+func TestWebDAVBackendCredentialsFromURL(t *testing.T) {
+	server := newWebDAVServer(t)
+	location := strings.Replace(server.URL, "http://", "webdav://alice:secret@", 1) + "/passh"
+
+	backend, err := OpenBackendWithOptions(location, BackendOptions{WebDAV: WebDAVAuth{Insecure: true}})
+	if err != nil {
+		t.Fatalf("Failed to open WebDAV backend: %v", err)
+	}
+	if err := backend.Put("dir with space/entry", []byte("data")); err != nil {
+		t.Fatalf("Failed to put entry: %v", err)
+	}
+	names, err := backend.List()
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if len(names) != 1 || names[0] != "dir with space/entry" {
+		t.Fatalf("Expected [dir with space/entry], got %v", names)
+	}
+}
+
+func TestWebDAVBackendUnauthorized(t *testing.T) {
+	server := newWebDAVServer(t)
+	location := strings.Replace(server.URL, "http://", "webdav://", 1) + "/passh"
+
+	if _, err := NewWebDAVBackend(location, WebDAVAuth{Username: "alice", Password: "wrong", Insecure: true}); err == nil {
+		t.Fatal("Expected wrong credentials to be rejected")
+	}
+}
+
+func TestWebDAVBackendRefusesPlainHTTPCredentials(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+	location := strings.Replace(server.URL, "http://", "webdav://", 1) + "/passh"
+
+	for _, auth := range []WebDAVAuth{{Username: "alice", Password: "secret"}, {Token: "token"}} {
+		if _, err := NewWebDAVBackend(location, auth); !errors.Is(err, ErrInsecureWebDAV) {
+			t.Errorf("Expected credentials over plain HTTP to be refused, got %v", err)
+		}
+	}
+	if _, err := OpenBackend(strings.Replace(location, "webdav://", "webdav://alice:secret@", 1)); !errors.Is(err, ErrInsecureWebDAV) {
+		t.Errorf("Expected credentials in the URL to be refused, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to be sent, got %d", requests)
+	}
+
+	// Without credentials there is nothing to leak
+	if _, err := NewWebDAVBackend(location, WebDAVAuth{}); err != nil {
+		t.Errorf("Expected an anonymous server to be allowed, got %v", err)
+	}
+}
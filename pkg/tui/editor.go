@@ -0,0 +1,151 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editor is a minimal multi-line text editor for entry contents
+type editor struct {
+	lines [][]rune
+	row   int
+	col   int
+}
+
+func newEditor(content string) *editor {
+	e := &editor{}
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		e.lines = append(e.lines, []rune(line))
+	}
+	// Start at the end of the password line
+	e.col = len(e.lines[0])
+	return e
+}
+
+// content returns the edited text
+func (e *editor) content() string {
+	lines := make([]string, len(e.lines))
+	for i, line := range e.lines {
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setLine replaces a line, for example the password on the first line
+func (e *editor) setLine(row int, text string) {
+	wipeRunes(e.lines[row])
+	e.lines[row] = []rune(text)
+	if e.row == row && e.col > len(e.lines[row]) {
+		e.col = len(e.lines[row])
+	}
+}
+
+// clear wipes the edited text
+func (e *editor) clear() {
+	for _, line := range e.lines {
+		wipeRunes(line)
+	}
+	e.lines = [][]rune{nil}
+	e.row, e.col = 0, 0
+}
+
+// handle applies a key press
+func (e *editor) handle(msg tea.KeyMsg) {
+	line := e.lines[e.row]
+
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		inserted := make([]rune, 0, len(line)+len(msg.Runes))
+		inserted = append(inserted, line[:e.col]...)
+		inserted = append(inserted, msg.Runes...)
+		inserted = append(inserted, line[e.col:]...)
+		wipeRunes(line)
+		e.lines[e.row] = inserted
+		e.col += len(msg.Runes)
+	case tea.KeyEnter:
+		head := append([]rune(nil), line[:e.col]...)
+		tail := append([]rune(nil), line[e.col:]...)
+		wipeRunes(line)
+		e.lines = append(e.lines, nil)
+		copy(e.lines[e.row+2:], e.lines[e.row+1:])
+		e.lines[e.row], e.lines[e.row+1] = head, tail
+		e.row++
+		e.col = 0
+	case tea.KeyBackspace:
+		if e.col > 0 {
+			e.lines[e.row] = append(line[:e.col-1], line[e.col:]...)
+			e.col--
+		} else if e.row > 0 {
+			previous := e.lines[e.row-1]
+			e.col = len(previous)
+			e.lines[e.row-1] = append(previous, line...)
+			e.lines = append(e.lines[:e.row], e.lines[e.row+1:]...)
+			e.row--
+		}
+	case tea.KeyDelete:
+		if e.col < len(line) {
+			e.lines[e.row] = append(line[:e.col], line[e.col+1:]...)
+		} else if e.row < len(e.lines)-1 {
+			e.lines[e.row] = append(line, e.lines[e.row+1]...)
+			e.lines = append(e.lines[:e.row+1], e.lines[e.row+2:]...)
+		}
+	case tea.KeyLeft:
+		if e.col > 0 {
+			e.col--
+		} else if e.row > 0 {
+			e.row--
+			e.col = len(e.lines[e.row])
+		}
+	case tea.KeyRight:
+		if e.col < len(line) {
+			e.col++
+		} else if e.row < len(e.lines)-1 {
+			e.row++
+			e.col = 0
+		}
+	case tea.KeyUp:
+		if e.row > 0 {
+			e.row--
+			e.col = min(e.col, len(e.lines[e.row]))
+		}
+	case tea.KeyDown:
+		if e.row < len(e.lines)-1 {
+			e.row++
+			e.col = min(e.col, len(e.lines[e.row]))
+		}
+	case tea.KeyHome, tea.KeyCtrlA:
+		e.col = 0
+	case tea.KeyEnd, tea.KeyCtrlE:
+		e.col = len(line)
+	}
+}
+
+// view renders the text with a block cursor
+func (e *editor) view() string {
+	var b strings.Builder
+	for i, line := range e.lines {
+		if i != e.row {
+			b.WriteString(string(line))
+		} else {
+			b.WriteString(string(line[:e.col]))
+			cursor := " "
+			if e.col < len(line) {
+				cursor = string(line[e.col])
+			}
+			b.WriteString(reverse(cursor))
+			if e.col < len(line) {
+				b.WriteString(string(line[e.col+1:]))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// wipeRunes overwrites a line of text
+func wipeRunes(line []rune) {
+	for i := range line {
+		line[i] = 0
+	}
+}
@@ -0,0 +1,541 @@
+// Package tui implements a full-screen interface for browsing and editing
+// the password store.
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rejoice4156/passh/pkg/secure"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+// GenerateFunc creates a random password
+type GenerateFunc func(length int, symbols bool) ([]byte, error)
+
+// Run shows the interface until the user quits. Entries marked hidden are
+// only shown with showHidden.
+func Run(store *storage.Store, generate GenerateFunc, showHidden bool) error {
+	m, err := newModel(store, generate, showHidden)
+	if err != nil {
+		return err
+	}
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	m.wipe()
+	return err
+}
+
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeFilter
+	modeView
+	modeEdit
+	modeGenerate
+	modeAudit
+	modeNewName
+	modeConfirmDelete
+)
+
+// item is a folder or entry in the current folder
+type item struct {
+	name  string
+	isDir bool
+}
+
+// auditMsg delivers the result of a background audit
+type auditMsg struct {
+	findings []storage.Finding
+	err      error
+}
+
+type model struct {
+	store      *storage.Store
+	generate   GenerateFunc
+	showHidden bool
+
+	mode   mode
+	status string
+	width  int
+	height int
+
+	// Browsing
+	names  []string
+	dir    string
+	filter string
+	items  []item
+	cursor int
+
+	// Viewing
+	entry  string
+	secret []byte
+	meta   storage.Metadata
+	reveal bool
+
+	// Editing
+	editor *editor
+
+	// Generating
+	genLength   int
+	genSymbols  bool
+	genPassword []byte
+	genReturn   mode
+
+	// Auditing
+	findings    []storage.Finding
+	auditCursor int
+	auditing    bool
+
+	// Naming a new entry, deleting
+	input      string
+	deleteName string
+	deleteBack mode
+}
+
+func newModel(store *storage.Store, generate GenerateFunc, showHidden bool) (*model, error) {
+	m := &model{store: store, generate: generate, showHidden: showHidden, genLength: 16, genSymbols: true}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *model) Init() tea.Cmd {
+	return nil
+}
+
+// reload reads the entry names and rebuilds the current folder
+func (m *model) reload() error {
+	if m.showHidden {
+		names, err := m.store.List()
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		m.names = names
+	} else {
+		index, err := m.store.Index()
+		if err != nil {
+			return err
+		}
+		m.names = index.WithoutHidden().Names()
+	}
+	m.refresh()
+	return nil
+}
+
+// refresh rebuilds the items of the current folder, applying the filter.
+// While filtering, matching entries from all subfolders are shown.
+func (m *model) refresh() {
+	m.items = nil
+	seen := make(map[string]bool)
+
+	for _, name := range m.names {
+		if !strings.HasPrefix(name, m.dir) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, m.dir)
+
+		if m.filter != "" {
+			if strings.Contains(strings.ToLower(rest), strings.ToLower(m.filter)) {
+				m.items = append(m.items, item{name: rest})
+			}
+			continue
+		}
+
+		if folder, _, isDir := strings.Cut(rest, "/"); isDir {
+			if !seen[folder] {
+				seen[folder] = true
+				m.items = append(m.items, item{name: folder, isDir: true})
+			}
+			continue
+		}
+		m.items = append(m.items, item{name: rest})
+	}
+
+	// Folders first
+	sort.SliceStable(m.items, func(i, j int) bool {
+		return m.items[i].isDir && !m.items[j].isDir
+	})
+
+	if m.cursor >= len(m.items) {
+		m.cursor = len(m.items) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// wipe clears decrypted data held by the model
+func (m *model) wipe() {
+	secure.Wipe(m.secret)
+	m.secret = nil
+	secure.Wipe(m.genPassword)
+	m.genPassword = nil
+	if m.editor != nil {
+		m.editor.clear()
+		m.editor = nil
+	}
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case auditMsg:
+		m.auditing = false
+		if msg.err != nil {
+			m.status = "Audit failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.findings = msg.findings
+		m.auditCursor = 0
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		m.status = ""
+
+		switch m.mode {
+		case modeBrowse:
+			return m.updateBrowse(msg)
+		case modeFilter:
+			return m.updateFilter(msg)
+		case modeView:
+			return m.updateView(msg)
+		case modeEdit:
+			return m.updateEdit(msg)
+		case modeGenerate:
+			return m.updateGenerate(msg)
+		case modeAudit:
+			return m.updateAudit(msg)
+		case modeNewName:
+			return m.updateNewName(msg)
+		case modeConfirmDelete:
+			return m.updateConfirmDelete(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m *model) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.items)-1 {
+			m.cursor++
+		}
+	case "enter", "right", "l":
+		m.open()
+	case "backspace", "left", "h", "esc":
+		m.up()
+	case "/":
+		m.mode = modeFilter
+	case "n":
+		m.input = m.dir
+		m.mode = modeNewName
+	case "d":
+		if len(m.items) > 0 && !m.items[m.cursor].isDir {
+			m.deleteName = m.dir + m.items[m.cursor].name
+			m.deleteBack = modeBrowse
+			m.mode = modeConfirmDelete
+		}
+	case "g":
+		m.genReturn = modeBrowse
+		m.startGenerate()
+	case "a":
+		m.mode = modeAudit
+		m.findings = nil
+		m.auditing = true
+		store := m.store
+		return m, func() tea.Msg {
+			findings, err := store.Audit(time.Now())
+			return auditMsg{findings: findings, err: err}
+		}
+	case "r":
+		if err := m.reload(); err != nil {
+			m.status = err.Error()
+		}
+	}
+	return m, nil
+}
+
+// up clears the filter, or moves to the parent folder keeping the folder
+// that was left selected
+func (m *model) up() {
+	if m.filter != "" {
+		m.filter = ""
+		m.refresh()
+		return
+	}
+	if m.dir == "" {
+		return
+	}
+
+	parent := strings.TrimSuffix(m.dir, "/")
+	folder := parent[strings.LastIndex(parent, "/")+1:]
+	m.dir = strings.TrimSuffix(m.dir, folder+"/")
+	m.cursor = 0
+	m.refresh()
+	for i, it := range m.items {
+		if it.isDir && it.name == folder {
+			m.cursor = i
+		}
+	}
+}
+
+func (m *model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.mode = modeBrowse
+		return m, nil
+	case tea.KeyEsc:
+		m.filter = ""
+		m.mode = modeBrowse
+	case tea.KeyBackspace:
+		if m.filter != "" {
+			runes := []rune(m.filter)
+			m.filter = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.filter += string(msg.Runes)
+	case tea.KeyUp, tea.KeyDown:
+		return m.updateBrowse(msg)
+	}
+	m.cursor = 0
+	m.refresh()
+	return m, nil
+}
+
+// open enters the selected folder or views the selected entry
+func (m *model) open() {
+	if len(m.items) == 0 {
+		return
+	}
+	selected := m.items[m.cursor]
+	if selected.isDir {
+		m.dir += selected.name + "/"
+		m.cursor = 0
+		m.refresh()
+		return
+	}
+	m.viewEntry(m.dir + selected.name)
+}
+
+// viewEntry decrypts an entry and shows it
+func (m *model) viewEntry(name string) {
+	secret, meta, err := m.store.GetWithMetadata(name)
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	secure.Wipe(m.secret)
+	m.entry, m.secret, m.meta = name, secret, meta
+	m.reveal = false
+	m.mode = modeView
+}
+
+// closeEntry returns to browsing and wipes the decrypted entry
+func (m *model) closeEntry() {
+	secure.Wipe(m.secret)
+	m.secret = nil
+	m.mode = modeBrowse
+}
+
+func (m *model) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "backspace", "left", "h":
+		m.closeEntry()
+	case "s", " ":
+		m.reveal = !m.reveal
+	case "e":
+		m.editor = newEditor(string(m.secret))
+		m.mode = modeEdit
+	case "d":
+		m.deleteName = m.entry
+		m.deleteBack = modeView
+		m.mode = modeConfirmDelete
+	}
+	return m, nil
+}
+
+func (m *model) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+s":
+		content := []byte(m.editor.content())
+		err := m.store.Add(m.entry, content)
+		secure.Wipe(content)
+		if err != nil {
+			m.status = "Save failed: " + err.Error()
+			return m, nil
+		}
+		m.editor.clear()
+		m.editor = nil
+		if err := m.reload(); err != nil {
+			m.status = err.Error()
+			m.mode = modeBrowse
+			return m, nil
+		}
+		m.viewEntry(m.entry)
+		m.status = "Saved " + m.entry
+	case "ctrl+g":
+		m.genReturn = modeEdit
+		m.startGenerate()
+	case "esc":
+		m.editor.clear()
+		m.editor = nil
+		if m.secret != nil {
+			m.mode = modeView
+		} else {
+			m.mode = modeBrowse
+		}
+	default:
+		m.editor.handle(msg)
+	}
+	return m, nil
+}
+
+// startGenerate opens the password generator
+func (m *model) startGenerate() {
+	m.mode = modeGenerate
+	m.regenerate()
+}
+
+func (m *model) regenerate() {
+	password, err := m.generate(m.genLength, m.genSymbols)
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	secure.Wipe(m.genPassword)
+	m.genPassword = password
+}
+
+func (m *model) updateGenerate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "+", "=", "right", "l":
+		if m.genLength < 128 {
+			m.genLength++
+			m.regenerate()
+		}
+	case "-", "left", "h":
+		if m.genLength > 4 {
+			m.genLength--
+			m.regenerate()
+		}
+	case "s":
+		m.genSymbols = !m.genSymbols
+		m.regenerate()
+	case "r", " ":
+		m.regenerate()
+	case "enter":
+		password := string(m.genPassword)
+		secure.Wipe(m.genPassword)
+		m.genPassword = nil
+		if m.genReturn == modeEdit {
+			m.editor.setLine(0, password)
+			m.mode = modeEdit
+			return m, nil
+		}
+		// Start a new entry with the generated password
+		m.input = m.dir
+		m.editor = newEditor(password)
+		m.mode = modeNewName
+	case "esc", "q":
+		secure.Wipe(m.genPassword)
+		m.genPassword = nil
+		m.mode = m.genReturn
+	}
+	return m, nil
+}
+
+func (m *model) updateAudit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "backspace", "left", "h":
+		m.mode = modeBrowse
+	case "up", "k":
+		if m.auditCursor > 0 {
+			m.auditCursor--
+		}
+	case "down", "j":
+		if m.auditCursor < len(m.findings)-1 {
+			m.auditCursor++
+		}
+	case "enter":
+		if len(m.findings) > 0 {
+			m.viewEntry(m.findings[m.auditCursor].Name)
+		}
+	}
+	return m, nil
+}
+
+func (m *model) updateNewName(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		name := strings.Trim(strings.TrimSpace(m.input), "/")
+		if name == "" {
+			return m, nil
+		}
+		for _, existing := range m.names {
+			if existing == name {
+				m.status = fmt.Sprintf("'%s' already exists", name)
+				return m, nil
+			}
+		}
+		m.entry = name
+		secure.Wipe(m.secret)
+		m.secret = nil
+		if m.editor == nil {
+			m.editor = newEditor("")
+		}
+		m.mode = modeEdit
+	case tea.KeyEsc:
+		if m.editor != nil {
+			m.editor.clear()
+			m.editor = nil
+		}
+		m.mode = modeBrowse
+	case tea.KeyBackspace:
+		if m.input != "" {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes:
+		m.input += string(msg.Runes)
+	}
+	return m, nil
+}
+
+func (m *model) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() != "y" {
+		m.mode = m.deleteBack
+		m.status = "Deletion cancelled"
+		return m, nil
+	}
+
+	if err := m.store.Delete(m.deleteName); err != nil {
+		m.mode = m.deleteBack
+		m.status = "Delete failed: " + err.Error()
+		return m, nil
+	}
+	m.closeEntry()
+	if err := m.reload(); err != nil {
+		m.status = err.Error()
+		return m, nil
+	}
+	m.status = "Deleted " + m.deleteName
+	return m, nil
+}
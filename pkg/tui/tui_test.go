@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rejoice4156/passh/pkg/crypto"
+	"github.com/rejoice4156/passh/pkg/storage"
+)
+
+// plainEncryptor stores entries unencrypted for tests
+type plainEncryptor struct{}
+
+func (plainEncryptor) Encrypt(data []byte) (string, error) { return string(data), nil }
+func (plainEncryptor) Decrypt(data string) ([]byte, error) { return []byte(data), nil }
+func (e plainEncryptor) EncryptStream(r io.Reader, w io.Writer) error {
+	return crypto.EncryptStreamWith(e.Encrypt, r, w)
+}
+func (e plainEncryptor) DecryptStream(r io.Reader, w io.Writer) error {
+	return crypto.DecryptStreamWith(e.Decrypt, r, w)
+}
+
+func newTestModel(t *testing.T, entries map[string]string) (*model, *storage.Store) {
+	store := storage.NewStoreWithBackend(storage.NewMemoryBackend(), plainEncryptor{})
+	for name, secret := range entries {
+		if err := store.Add(name, []byte(secret)); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	generate := func(length int, symbols bool) ([]byte, error) {
+		return []byte(strings.Repeat("x", length)), nil
+	}
+	m, err := newModel(store, generate, false)
+	if err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+	return m, store
+}
+
+// press sends keys to the model; multi-character strings other than named
+// keys are typed as text
+func press(m *model, keys ...string) tea.Cmd {
+	named := map[string]tea.KeyType{
+		"enter": tea.KeyEnter, "esc": tea.KeyEsc, "backspace": tea.KeyBackspace,
+		"up": tea.KeyUp, "down": tea.KeyDown, "ctrl+s": tea.KeyCtrlS, "ctrl+g": tea.KeyCtrlG,
+	}
+
+	var cmd tea.Cmd
+	for _, key := range keys {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		if keyType, ok := named[key]; ok {
+			msg = tea.KeyMsg{Type: keyType}
+		}
+		_, cmd = m.Update(msg)
+	}
+	return cmd
+}
+
+func TestBrowse(t *testing.T) {
+	m, _ := newTestModel(t, map[string]string{
+		"email/work":     "a",
+		"email/personal": "b",
+		"github":         "c",
+	})
+
+	if len(m.items) != 2 || !m.items[0].isDir || m.items[0].name != "email" || m.items[1].name != "github" {
+		t.Fatalf("Unexpected top level: %+v", m.items)
+	}
+
+	press(m, "enter")
+	if m.dir != "email/" || len(m.items) != 2 || m.items[0].name != "personal" {
+		t.Fatalf("Expected to be in email/, got %q %+v", m.dir, m.items)
+	}
+
+	press(m, "down", "enter")
+	if m.mode != modeView || m.entry != "email/work" || string(m.secret) != "a" {
+		t.Fatalf("Expected to view email/work, got mode %d entry %q", m.mode, m.entry)
+	}
+	if strings.Contains(m.View(), "Password:  a") {
+		t.Error("Expected the password to be hidden until revealed")
+	}
+	press(m, "s")
+	if !strings.Contains(m.View(), "Password:  a") {
+		t.Error("Expected the password to be revealed")
+	}
+
+	press(m, "esc", "backspace")
+	if m.mode != modeBrowse || m.dir != "" || m.secret != nil || m.items[m.cursor].name != "email" {
+		t.Fatalf("Expected to be back at the top with email selected, got %q cursor %d", m.dir, m.cursor)
+	}
+
+	press(m, "/", "h", "u", "b", "enter")
+	if len(m.items) != 1 || m.items[0].name != "github" {
+		t.Fatalf("Expected the filter to match github, got %+v", m.items)
+	}
+}
+
+func TestCreateEditAndDelete(t *testing.T) {
+	m, store := newTestModel(t, nil)
+
+	press(m, "g", "+", "enter")
+	if m.mode != modeNewName {
+		t.Fatalf("Expected to name the new entry, got mode %d", m.mode)
+	}
+	press(m, "new", "enter", "enter", "user: alice", "ctrl+s")
+
+	secret, err := store.Get("new")
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if string(secret) != strings.Repeat("x", 17)+"\nuser: alice" {
+		t.Fatalf("Unexpected entry content: %q", secret)
+	}
+
+	// Editing keeps the other lines when the password is regenerated
+	press(m, "e", "ctrl+g", "-", "-", "enter", "ctrl+s")
+	secret, _ = store.Get("new")
+	if string(secret) != strings.Repeat("x", 15)+"\nuser: alice" {
+		t.Fatalf("Unexpected entry content after edit: %q", secret)
+	}
+
+	press(m, "d", "n")
+	if _, err := store.Get("new"); err != nil {
+		t.Fatal("Expected the entry to survive a cancelled delete")
+	}
+	press(m, "d", "y")
+	if _, err := store.Get("new"); err == nil {
+		t.Fatal("Expected the entry to be deleted")
+	}
+	if m.mode != modeBrowse || len(m.items) != 0 {
+		t.Fatalf("Expected an empty list after delete, got %+v", m.items)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	m, _ := newTestModel(t, map[string]string{"short": "abc", "strong": "Xk9#mQ2$vL7@pR4z"})
+
+	cmd := press(m, "a")
+	if m.mode != modeAudit || cmd == nil {
+		t.Fatal("Expected the audit to start")
+	}
+	m.Update(cmd())
+	if len(m.findings) != 1 || m.findings[0].Name != "short" {
+		t.Fatalf("Unexpected findings: %+v", m.findings)
+	}
+
+	press(m, "enter")
+	if m.mode != modeView || m.entry != "short" {
+		t.Fatalf("Expected to open the finding, got mode %d", m.mode)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	e := newEditor("one\ntwo")
+	e.row, e.col = 0, 1
+	e.handle(tea.KeyMsg{Type: tea.KeyEnter})
+	e.handle(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("X")})
+	e.handle(tea.KeyMsg{Type: tea.KeyDown})
+	e.handle(tea.KeyMsg{Type: tea.KeyBackspace})
+	if got := e.content(); got != "o\nXne\nwo" {
+		t.Fatalf("Unexpected content: %q", got)
+	}
+
+	e.handle(tea.KeyMsg{Type: tea.KeyBackspace})
+	if got := e.content(); got != "o\nXnewo" {
+		t.Fatalf("Unexpected content after joining lines: %q", got)
+	}
+}
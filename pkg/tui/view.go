@@ -0,0 +1,160 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reverse renders text in reverse video, used for the selection and cursor
+func reverse(text string) string {
+	return "\x1b[7m" + text + "\x1b[0m"
+}
+
+// bold renders text in bold
+func bold(text string) string {
+	return "\x1b[1m" + text + "\x1b[0m"
+}
+
+func (m *model) View() string {
+	var body, help string
+
+	switch m.mode {
+	case modeBrowse, modeFilter:
+		body = m.viewBrowse()
+		help = "enter open · ← back · / filter · n new · d delete · g generate · a audit · r reload · q quit"
+		if m.mode == modeFilter {
+			help = "type to filter · enter done · esc clear"
+		}
+	case modeView:
+		body = m.viewEntryDetails()
+		help = "s show/hide · e edit · d delete · esc back"
+	case modeEdit:
+		body = bold("Editing "+m.entry) + "\n\n" + m.editor.view()
+		help = "ctrl+s save · ctrl+g generate password · esc cancel"
+	case modeGenerate:
+		symbols := "on"
+		if !m.genSymbols {
+			symbols = "off"
+		}
+		body = fmt.Sprintf("%s\n\n  %s\n\n  Length:  %d\n  Symbols: %s\n",
+			bold("Generate password"), string(m.genPassword), m.genLength, symbols)
+		help = "+/- length · s symbols · r regenerate · enter use · esc cancel"
+	case modeAudit:
+		body = m.viewAudit()
+		help = "enter open · esc back"
+	case modeNewName:
+		body = fmt.Sprintf("%s\n\n  Name: %s%s\n", bold("New entry"), m.input, reverse(" "))
+		help = "enter continue · esc cancel"
+	case modeConfirmDelete:
+		body = fmt.Sprintf("Delete '%s'? (y/N)\n", m.deleteName)
+	}
+
+	footer := help
+	if m.status != "" {
+		footer = m.status
+	}
+	return m.fit(body) + "\n" + footer
+}
+
+// fit pads or trims the body to leave exactly one line for the footer
+func (m *model) fit(body string) string {
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if m.height <= 1 {
+		return strings.Join(lines, "\n")
+	}
+	for len(lines) < m.height-1 {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines[:m.height-1], "\n")
+}
+
+// visibleRange returns the slice of a list of n rows to show so the
+// selected row stays on screen, given the rows used by headers
+func (m *model) visibleRange(n, selected, reserved int) (int, int) {
+	rows := m.height - 1 - reserved
+	if m.height == 0 || rows <= 0 || n <= rows {
+		return 0, n
+	}
+	start := selected - rows/2
+	start = max(0, min(start, n-rows))
+	return start, start + rows
+}
+
+func (m *model) viewBrowse() string {
+	var b strings.Builder
+
+	title := "passh: /" + m.dir
+	if m.mode == modeFilter || m.filter != "" {
+		title += "  filter: " + m.filter
+	}
+	b.WriteString(bold(title) + "\n\n")
+
+	if len(m.items) == 0 {
+		b.WriteString("  (no entries)\n")
+		return b.String()
+	}
+
+	start, end := m.visibleRange(len(m.items), m.cursor, 2)
+	for i := start; i < end; i++ {
+		it := m.items[i]
+		label := it.name
+		if it.isDir {
+			label += "/"
+		}
+		if i == m.cursor {
+			label = reverse(label)
+		}
+		b.WriteString("  " + label + "\n")
+	}
+	return b.String()
+}
+
+func (m *model) viewEntryDetails() string {
+	var b strings.Builder
+	b.WriteString(bold(m.entry) + "\n\n")
+
+	lines := strings.Split(strings.TrimSuffix(string(m.secret), "\n"), "\n")
+	password := strings.Repeat("•", 12)
+	if m.reveal {
+		password = lines[0]
+	}
+	b.WriteString("  Password:  " + password + "\n")
+	for _, line := range lines[1:] {
+		b.WriteString("  " + line + "\n")
+	}
+
+	b.WriteString("\n")
+	if m.meta.Created.IsZero() {
+		b.WriteString("  Created:   unknown\n")
+	} else {
+		b.WriteString("  Created:   " + m.meta.Created.Local().Format(timeFormat) + "\n")
+		b.WriteString("  Modified:  " + m.meta.Modified.Local().Format(timeFormat) + "\n")
+	}
+	return b.String()
+}
+
+func (m *model) viewAudit() string {
+	var b strings.Builder
+	b.WriteString(bold("Audit") + "\n\n")
+
+	switch {
+	case m.auditing:
+		b.WriteString("  Checking entries...\n")
+	case len(m.findings) == 0:
+		b.WriteString("  No problems found\n")
+	default:
+		start, end := m.visibleRange(len(m.findings), m.auditCursor, 2)
+		for i := start; i < end; i++ {
+			finding := m.findings[i]
+			line := fmt.Sprintf("%-10s  %-30s  %s", finding.Kind, finding.Name, finding.Message)
+			if i == m.auditCursor {
+				line = reverse(line)
+			}
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// timeFormat is used when showing entry timestamps
+const timeFormat = "2006-01-02 15:04"